@@ -0,0 +1,52 @@
+"""Parse source files, extract identifiers and entities, and annotate them."""
+
+from __future__ import annotations
+
+import importlib
+from typing import TYPE_CHECKING, Any
+
+if TYPE_CHECKING:
+    from .analysis import FileLimits, FileResult, Options, Result, analyze, iter_analyze
+    from .constraints import BuildTags
+    from .extracting import Entity
+    from .plugins import Plugin, register_plugin
+    from .sinks import ResultSink, register_sink
+
+__all__ = [
+    "BuildTags",
+    "Entity",
+    "FileLimits",
+    "FileResult",
+    "Options",
+    "Plugin",
+    "Result",
+    "ResultSink",
+    "analyze",
+    "iter_analyze",
+    "register_plugin",
+    "register_sink",
+]
+
+# Imported on first use, so ``python -m autosg`` can hand a command to the
+# daemon without loading the parsers (see client.py).
+_MODULES: dict[str, str] = {
+    "BuildTags": "constraints",
+    "Entity": "extracting",
+    "FileLimits": "analysis",
+    "FileResult": "analysis",
+    "Options": "analysis",
+    "Plugin": "plugins",
+    "Result": "analysis",
+    "ResultSink": "sinks",
+    "analyze": "analysis",
+    "iter_analyze": "analysis",
+    "register_plugin": "plugins",
+    "register_sink": "sinks",
+}
+
+
+def __getattr__(name: str) -> Any:
+    module: str | None = _MODULES.get(name)
+    if module is None:
+        raise AttributeError(f"module {__name__!r} has no attribute {name!r}")
+    return getattr(importlib.import_module(f".{module}", __name__), name)
@@ -2,50 +2,211 @@
 
 from __future__ import annotations
 
+if __name__ == "__main__":
+    # Before the imports below: a running daemon makes loading them moot.
+    import sys
+
+    from .client import delegate
+
+    _status: int | None = delegate(sys.argv[1:])
+    if _status is not None:
+        raise SystemExit(_status)
+
+import contextlib
 import csv
+import dataclasses
 import json
+import logging
 import os
+import re
+import shutil
 import sys
+import time
+from collections import Counter
 from collections.abc import Callable, Iterator
+from datetime import datetime, timezone
 from pathlib import Path
 from typing import Any, TextIO
 
 import click
 
+from . import (
+    baselining,
+    batching,
+    checking,
+    client,
+    config,
+    daemon,
+    diffing,
+    fetching,
+    gating,
+    history,
+    languageserver,
+    linting,
+    modeling,
+    openapi,
+    querying,
+    reporting,
+    schema,
+    serving,
+    sharding,
+    sinks,
+    snapshotting,
+    stubbing,
+    summarizing,
+    surface,
+    templating,
+    tracing,
+    watching,
+)
+from .analysis import Analysis, FileLimits, Options, iter_analyze
+from .caching import open_cache_db
+from .canonicalizing import CanonicalAnalysis
+from .cloning import DEFAULT_THRESHOLD
+from .components import COMPONENT_EXTENSIONS
+from .constraints import BuildTags
+from .coverage import Coverage
 from .annotating import (
     FileEncoding,
     annotate_source,
     encode_output,
     read_source_utf8,
 )
-from .parsing import byte_col_to_char_col, detect_language, parse_identifiers
+from .embedding import TEMPLATE_EXTENSIONS
+from .extracting import qualified_names
+from .exporting import (
+    CLUSTER_MODES,
+    DSM_ORDERS,
+    FILE_FORMATS,
+    FORMATS,
+    POSITION_MODES,
+    REPORT_EDGES,
+    REPORTS,
+    ExportOptions,
+)
+from .features import ALL_LANGUAGES, register_features
+from .hierarchy import AGGREGATIONS, GRANULARITIES, HierarchicalAnalysis
+from .idl import IDL_LANGUAGES
+from .linking import EDGE_KINDS
+from .notebooks import NOTEBOOK_EXTENSIONS
+from .overriding import register_queries
+from .ownership import Owners, find_codeowners
+from .parsing import (
+    EXTENSION_TO_LANGUAGE,
+    FILENAME_TO_LANGUAGE,
+    byte_col_to_char_col,
+    detect_language,
+    parse_identifiers,
+    register_filetypes,
+    source_lines,
+)
+from .plugins import register_plugin, registered_plugins
+from .positioning import COLUMN_UNITS, ColumnAnalysis
+from .redacting import RedactedAnalysis, new_key
+from .spilling import parse_size
+from .walking import ANNOTATED_SUFFIX, WalkOptions, resolve_source_paths
+from .zig import ZIG_EXTENSIONS
 
 # ---------------------------------------------------------------------------
-# Path resolution
+# Logging
 # ---------------------------------------------------------------------------
 
-ANNOTATED_SUFFIX: str = ".annotated"
 
+class _CLIFormatter(logging.Formatter):
+    """Render library log records as ``Warning: ...`` lines on stderr."""
 
-def resolve_paths(paths: tuple[Path, ...], recursive: bool) -> Iterator[Path]:
-    """Expand directories into individual file paths."""
-    for path in paths:
-        if path.is_file():
-            yield path
-        elif path.is_dir():
-            if recursive:
-                yield from sorted(p for p in path.rglob("*") if p.is_file())
-            else:
-                yield from sorted(p for p in path.iterdir() if p.is_file())
-        else:
-            click.echo(f"Warning: {path} is not a file or directory, skipping.", err=True)
+    def format(self, record: logging.LogRecord) -> str:
+        return f"{record.levelname.capitalize()}: {record.getMessage()}"
+
+
+class _JSONFormatter(logging.Formatter):
+    """Render each log record as one JSON object, with its structured fields."""
+
+    def format(self, record: logging.LogRecord) -> str:
+        data: dict[str, Any] = {
+            "time": datetime.fromtimestamp(record.created, timezone.utc).isoformat(
+                timespec="milliseconds",
+            ),
+            "level": record.levelname.lower(),
+            "message": record.getMessage(),
+            **getattr(record, "fields", {}),
+        }
+        if record.exc_info:
+            data["exception"] = self.formatException(record.exc_info)
+        return json.dumps(data)
+
+
+class _ProgressHandler(logging.Handler):
+    """Draw a progress bar on *stream* from the analysis' per-file log events."""
+
+    _BAR_WIDTH: int = 24
+
+    def __init__(self, stream: TextIO) -> None:
+        super().__init__(logging.INFO)
+        self.stream: TextIO = stream
+        self.total: int = 0
+        self.done: int = 0
+        self.started: float = 0.0
+        self.drawn: bool = False
 
+    def emit(self, record: logging.LogRecord) -> None:
+        fields: dict[str, Any] = getattr(record, "fields", {})
+        event: str | None = fields.get("event")
+        if event == "start":
+            self.total, self.done, self.started = fields["files"], 0, time.monotonic()
+        elif event in ("file", "skipped") and self.total:
+            self.done += 1
+        elif event == "done":
+            self.total = 0
+        if record.levelno >= logging.WARNING or not self.total:
+            self.clear()  # make room for the message, which the next handler writes
+            return
+        self.draw(fields.get("path", ""))
 
-def resolve_source_paths(paths: tuple[Path, ...], recursive: bool) -> Iterator[Path]:
-    """Like resolve_paths but skips .annotated files."""
-    for path in resolve_paths(paths, recursive):
-        if not path.name.endswith(ANNOTATED_SUFFIX):
-            yield path
+    def draw(self, path: str) -> None:
+        filled: int = self._BAR_WIDTH * self.done // self.total
+        elapsed: float = time.monotonic() - self.started
+        line: str = (
+            f"[{'#' * filled}{'-' * (self._BAR_WIDTH - filled)}] "
+            f"{self.done}/{self.total} files, {elapsed:.0f}s  {path}"
+        )
+        width: int = shutil.get_terminal_size().columns - 1
+        self.stream.write("\r" + line[:width].ljust(width))
+        self.stream.flush()
+        self.drawn = True
+
+    def clear(self) -> None:
+        if self.drawn:
+            self.stream.write("\r\x1b[K")
+            self.stream.flush()
+            self.drawn = False
+
+
+LOG_FORMATS: tuple[str, ...] = ("text", "json")
+
+
+def _configure_logging(log_format: str = "text", progress: bool = False) -> None:
+    """Route the ``autosg`` logger to stderr, replacing earlier handlers.
+
+    Text output only shows warnings; JSON output also has the per-file
+    ``info`` records, for CI logs.  The progress bar is only drawn when
+    stderr is a terminal.
+    """
+    logger: logging.Logger = logging.getLogger("autosg")
+    for old in list(logger.handlers):
+        logger.removeHandler(old)
+    if progress and sys.stderr.isatty():
+        logger.addHandler(_ProgressHandler(sys.stderr))  # first: it clears its line
+    handler: logging.Handler = logging.StreamHandler(sys.stderr)
+    if log_format == "json":
+        handler.setFormatter(_JSONFormatter())
+    else:
+        handler.setFormatter(_CLIFormatter())
+        handler.setLevel(logging.WARNING)
+    logger.addHandler(handler)
+    verbose: bool = log_format == "json" or len(logger.handlers) > 1
+    logger.setLevel(logging.INFO if verbose else logging.WARNING)
+    logger.propagate = False
 
 
 # ---------------------------------------------------------------------------
@@ -53,26 +214,327 @@ def resolve_source_paths(paths: tuple[Path, ...], recursive: bool) -> Iterator[P
 # ---------------------------------------------------------------------------
 
 
+def _split_globs(
+    _ctx: click.Context, _param: click.Parameter, values: tuple[str, ...],
+) -> tuple[str, ...]:
+    """Accept both repeated options and comma-separated lists of globs."""
+    return tuple(g.strip() for v in values for g in v.split(",") if g.strip())
+
+
+def _parse_size(
+    _ctx: click.Context, _param: click.Parameter, value: str | None,
+) -> int | None:
+    """Accept sizes like 512M and 2G, in bytes."""
+    if value is None:
+        return None
+    try:
+        return parse_size(value)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc)) from None
+
+
+def _parse_shard(
+    _ctx: click.Context, _param: click.Parameter, value: str | None,
+) -> tuple[int, int] | None:
+    """Accept shards like 2/8: the second of eight."""
+    if value is None:
+        return None
+    try:
+        return sharding.parse_shard(value)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc)) from None
+
+
+def _parse_fail_on(
+    _ctx: click.Context, _param: click.Parameter, values: tuple[str, ...],
+) -> list[gating.Threshold]:
+    """Accept threshold expressions like 'cycles>0, max-complexity>25'."""
+    try:
+        return [t for value in values for t in gating.parse_thresholds(value)]
+    except ValueError as exc:
+        raise click.BadParameter(str(exc)) from None
+
+
+def _fail_on(gate: gating.GatedAnalysis | None, thresholds: list[gating.Threshold]) -> None:
+    """Exit with status 1 if any of *thresholds* holds for what *gate* measured."""
+    if gate is None:
+        return
+    failures: list[gating.Threshold] = gate.failures(thresholds)
+    for threshold in failures:
+        click.echo(
+            f"fail-on: {threshold} ({threshold.metric} is {gate.metrics[threshold.metric]})",
+            err=True,
+        )
+    if failures:
+        sys.exit(1)
+
+
+KNOWN_LANGUAGES: frozenset[str] = frozenset(
+    [
+        *EXTENSION_TO_LANGUAGE.values(), *FILENAME_TO_LANGUAGE.values(), *IDL_LANGUAGES,
+        *ZIG_EXTENSIONS.values(), *COMPONENT_EXTENSIONS.values(), *TEMPLATE_EXTENSIONS.values(),
+        *NOTEBOOK_EXTENSIONS.values(),
+    ],
+)
+
+
+def _split_languages(
+    ctx: click.Context, param: click.Parameter, values: tuple[str, ...],
+) -> frozenset[str]:
+    """Like _split_globs, but checks each name is a language autosg knows."""
+    languages: tuple[str, ...] = _split_globs(ctx, param, values)
+    known: frozenset[str] = KNOWN_LANGUAGES | {p.name for p in registered_plugins()}
+    unknown: list[str] = sorted(set(languages) - known)
+    if unknown:
+        raise click.BadParameter(
+            f"unknown language(s): {', '.join(unknown)}. "
+            f"Choose from: {', '.join(sorted(known))}.",
+        )
+    return frozenset(languages)
+
+
+def filter_options(f: Callable[..., object]) -> Callable[..., object]:
+    """Options that select which files a directory traversal yields."""
+    f = click.option(
+        "--languages",
+        multiple=True,
+        callback=_split_languages,
+        help="Only process files in these languages (repeatable, comma-separated).",
+    )(f)
+    f = click.option(
+        "--follow-symlinks",
+        is_flag=True,
+        default=False,
+        help="Walk symbolic links to directories, unless they lead back into the tree.",
+    )(f)
+    f = click.option(
+        "--no-gitignore",
+        is_flag=True,
+        default=False,
+        help="Do not skip files ignored by .gitignore.",
+    )(f)
+    f = click.option(
+        "--exclude",
+        multiple=True,
+        callback=_split_globs,
+        help="Skip files and directories matching these globs (repeatable, comma-separated).",
+    )(f)
+    f = click.option(
+        "--include",
+        multiple=True,
+        callback=_split_globs,
+        help="Only process files matching these globs (repeatable, comma-separated).",
+    )(f)
+    return f
+
+
+def _traversal_options(f: Callable[..., object]) -> Callable[..., object]:
+    f = filter_options(f)
+    f = click.option(
+        "-r", "--recursive",
+        is_flag=True,
+        default=False,
+        help="Recurse into directories.",
+    )(f)
+    return f
+
+
 def common_options(f: Callable[..., object]) -> Callable[..., object]:
-    """Shared PATHS argument and -r/--recursive option for all subcommands."""
+    """Shared PATHS argument and traversal options for all subcommands."""
     f = click.argument(
         "paths",
         nargs=-1,
         required=True,
         type=click.Path(exists=True, path_type=Path),
     )(f)
+    return _traversal_options(f)
+
+
+def _check_inputs(
+    _ctx: click.Context, _param: click.Parameter, values: tuple[str, ...],
+) -> tuple[str, ...]:
+    """Paths must exist, unless they are git URLs or - for stdin."""
+    for value in values:
+        if value != fetching.STDIN and not fetching.is_git_url(value):
+            if not os.path.exists(value):
+                raise click.BadParameter(f"Path {value!r} does not exist.")
+    return values
+
+
+def input_options(f: Callable[..., object]) -> Callable[..., object]:
+    """Like common_options, but PATHS may also be archives, git URLs, or - for stdin."""
+    f = click.argument("paths", nargs=-1, required=True, callback=_check_inputs)(f)
+    f = _traversal_options(f)
     f = click.option(
-        "-r", "--recursive",
+        "--lang", "stdin_language",
+        type=click.Choice(sorted(KNOWN_LANGUAGES)),
+        default=None,
+        help="Language of the source read from stdin when a PATH is -.",
+    )(f)
+    return f
+
+
+def _walk_options(
+    recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool,
+    follow_symlinks: bool, languages: frozenset[str],
+) -> WalkOptions:
+    """Bundle the traversal options declared by ``common_options``."""
+    return WalkOptions(recursive, not no_gitignore, include, exclude, languages, follow_symlinks)
+
+
+jobs_option: Callable[[Callable[..., object]], Callable[..., object]] = click.option(
+    "-j", "--jobs",
+    type=click.IntRange(min=1),
+    default=os.cpu_count() or 1,
+    show_default="number of CPUs",
+    help="Parse files in this many worker processes.",
+)
+
+
+def _parse_file_size(
+    ctx: click.Context, param: click.Parameter, value: str,
+) -> int | None:
+    """Like _parse_size, with 0 for no limit."""
+    return None if value.strip() == "0" else _parse_size(ctx, param, value)
+
+
+def _parse_build_tags(
+    _ctx: click.Context, _param: click.Parameter, value: str | None,
+) -> BuildTags | None:
+    return BuildTags.parse(value) if value is not None else None
+
+
+def limit_options(f: Callable[..., object]) -> Callable[..., object]:
+    """Options that skip files unparsed: large, binary, minified, or not built."""
+    f = click.option(
+        "--build-tags",
+        callback=_parse_build_tags,
+        default=None,
+        metavar="TAGS",
+        help="Only extract the Go files and C preprocessor branches a build with these "
+        "comma-separated tags uses, e.g. linux,amd64,integration.",
+    )(f)
+    f = click.option(
+        "--include-minified",
         is_flag=True,
         default=False,
-        help="Recurse into directories.",
+        help="Parse files that look minified (very long lines) instead of skipping them.",
+    )(f)
+    f = click.option(
+        "--max-file-size",
+        callback=_parse_file_size,
+        default="4M",
+        show_default=True,
+        metavar="SIZE",
+        help="Skip files larger than this (e.g. 512K, 16M; 0 for no limit).",
     )(f)
     return f
 
 
+no_cache_option: Callable[[Callable[..., object]], Callable[..., object]] = click.option(
+    "--no-cache",
+    is_flag=True,
+    default=False,
+    help="Re-extract every file instead of reusing .autosg/cache.",
+)
+
+
+# Context meta key for the config file and the architecture rules it declares.
+_RULES_KEY: str = "autosg.rules"
+
+# Lines of the --trace breakdown written to stderr.
+_TRACE_LINES: int = 10
+
+# Commands that wait for requests; their phases are the requests', not theirs.
+_SERVER_COMMANDS: frozenset[str] = frozenset({"daemon", "lsp", "serve"})
+
+
+@contextlib.contextmanager
+def _traced(path: Path, command: str) -> Iterator[None]:
+    """Profile what runs inside, then write the profile to *path* and sum it up."""
+    profiler: tracing.Profiler = tracing.Profiler(comments=(
+        f"autosg {command}", f"python {sys.version.split()[0]}",
+    ))
+    try:
+        with profiler:
+            yield
+    finally:
+        profiler.write(path)
+        click.echo(
+            f"trace: wrote {path}: {profiler.samples:,} samples over {profiler.seconds:.2f} s; "
+            f"view it with go tool pprof -http=: {path}",
+            err=True,
+        )
+        for name, seconds in profiler.breakdown().most_common(_TRACE_LINES):
+            click.echo(f"  {seconds:8.2f} s  {name}", err=True)
+
+
 @click.group()
-def cli() -> None:
+@click.option(
+    "--config",
+    "config_path",
+    type=click.Path(exists=True, dir_okay=False, path_type=Path),
+    default=None,
+    help="Config file (default: nearest autosg.yaml or .autosg.toml).",
+)
+@click.option(
+    "--log-format",
+    type=click.Choice(LOG_FORMATS),
+    default="text",
+    show_default=True,
+    help="How to write log messages to stderr; json adds per-file timing records.",
+)
+@click.option(
+    "--progress",
+    is_flag=True,
+    default=False,
+    help="Show a progress bar on stderr while files are analyzed.",
+)
+@click.option(
+    "--trace",
+    "trace_path",
+    type=click.Path(dir_okay=False, path_type=Path),
+    default=None,
+    metavar="FILE",
+    help="Write a pprof profile of where the command spends its time, by phase and "
+    "language, to FILE.",
+)
+@click.pass_context
+def cli(
+    ctx: click.Context, config_path: Path | None, log_format: str, progress: bool,
+    trace_path: Path | None,
+) -> None:
     """Parse source files and annotate identifiers."""
+    _configure_logging(log_format, progress)
+    command: str = ctx.invoked_subcommand or ""
+    if trace_path is not None:
+        ctx.with_resource(_traced(trace_path, command))
+    if command not in _SERVER_COMMANDS:
+        ctx.with_resource(tracing.phase("command", command=command))
+    path: Path | None = config_path or config.find_config()
+    try:
+        loaded: dict[str, Any] = config.load_config(path) if path is not None else {}
+        for query_file in config.load_queries(loaded, path):
+            register_queries(query_file)
+        if path is None:
+            return
+        for plugin in config.load_plugins(loaded, path):
+            register_plugin(plugin)
+        for scheme, factory in config.load_sinks(loaded, path).items():
+            sinks.register_sink(scheme, factory)
+        register_features(config.load_features(loaded, path))
+        register_filetypes(config.load_filetypes(loaded, path))
+        ctx.meta[_RULES_KEY] = (path, config.load_rules(loaded, path))
+        ctx.default_map = config.default_map(
+            loaded,
+            {
+                name: {p.name for p in command.params if p.name}
+                for name, command in cli.commands.items()
+            },
+            path,
+        )
+    except config.ConfigError as exc:
+        raise click.ClickException(str(exc)) from None
 
 
 @cli.command("dump-identifiers")
@@ -83,8 +545,15 @@ def cli() -> None:
     default=None,
     help="Output CSV path (default: stdout).",
 )
-def dump_identifiers(paths: tuple[Path, ...], recursive: bool, output: Path | None) -> None:
+def dump_identifiers(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    output: Path | None,
+) -> None:
     """Dump all identifiers to CSV."""
+    walk: WalkOptions = _walk_options(
+        recursive, include, exclude, no_gitignore, follow_symlinks, languages,
+    )
     out: TextIO
     if output is not None:
         out = open(output, "w", newline="")
@@ -94,7 +563,7 @@ def dump_identifiers(paths: tuple[Path, ...], recursive: bool, output: Path | No
         writer = csv.writer(out)
         writer.writerow(["id", "path", "row", "col", "text"])
         global_id: int = 0
-        for file_path in resolve_source_paths(paths, recursive):
+        for file_path in resolve_source_paths(paths, walk):
             language: str | None = detect_language(file_path)
             if language is None:
                 click.echo(
@@ -111,10 +580,10 @@ def dump_identifiers(paths: tuple[Path, ...], recursive: bool, output: Path | No
                 )
                 continue
             utf8_bytes, _enc = result
-            rel_path: str = os.path.relpath(file_path)
-            source_lines: list[bytes] = utf8_bytes.splitlines()
+            rel_path: str = Path(os.path.relpath(file_path)).as_posix()
+            lines: list[bytes] = source_lines(utf8_bytes)
             for row, byte_col, text in parse_identifiers(utf8_bytes, language):
-                char_col: int = byte_col_to_char_col(source_lines[row - 1], byte_col)
+                char_col: int = byte_col_to_char_col(lines[row - 1], byte_col)
                 writer.writerow([global_id, rel_path, row, char_col, text])
                 global_id += 1
     finally:
@@ -122,59 +591,1956 @@ def dump_identifiers(paths: tuple[Path, ...], recursive: bool, output: Path | No
             out.close()
 
 
-@cli.command("annotate-files")
+@cli.command("dump-entities")
 @common_options
 @click.option(
-    "--clean",
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output CSV path (default: stdout).",
+)
+@limit_options
+@jobs_option
+@no_cache_option
+def dump_entities(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    output: Path | None, max_file_size: int | None, include_minified: bool,
+    build_tags: BuildTags | None, jobs: int, no_cache: bool,
+) -> None:
+    """Dump declarations (functions, types, imports, ...) to CSV."""
+    out: TextIO
+    if output is not None:
+        out = open(output, "w", newline="")
+    else:
+        out = sys.stdout
+    try:
+        writer = csv.writer(out)
+        writer.writerow(
+            ["id", "path", "row", "col", "end_row", "end_col", "kind", "name", "parent", "uid"],
+        )
+        options: Options = Options(
+            recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+            include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+            limits=FileLimits(max_file_size, not include_minified, build_tags),
+        )
+        for file_result in iter_analyze(paths, options):
+            for e in file_result.entities:
+                writer.writerow([
+                    e.id, e.path, e.row, e.col, e.end_row, e.end_col,
+                    e.kind, e.name, "" if e.parent is None else e.parent, e.uid,
+                ])
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+def _load_owners(path: Path | None) -> Owners:
+    """Owners from *path*, or from the CODEOWNERS file of the current repository."""
+    base: Path | None = None
+    if path is None:
+        found: tuple[Path, Path] | None = find_codeowners()
+        if found is None:
+            raise click.UsageError("No CODEOWNERS file found; use --owners-file.")
+        path, base = found
+    try:
+        return Owners.load(path, base)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc), param_hint="--owners-file") from None
+
+
+@cli.command("analyze")
+@input_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(sorted([*FORMATS, *FILE_FORMATS, "template"])),
+    default="json",
+    show_default=True,
+    help="Output format; template renders --template.",
+)
+@click.option(
+    "-o", "--output", "--out",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout; required for arrow, csv, parquet, and sqlite).",
+)
+@click.option(
+    "--sink", "sink_url",
+    default=None,
+    metavar="URL",
+    help="Send the output to a result sink instead: file:PATH, sqlite:PATH, an http(s) URL "
+    "to POST to, s3://BUCKET/KEY, or a scheme registered in the config file.",
+)
+@click.option(
+    "--template",
+    type=click.Path(exists=True, dir_okay=False, path_type=Path),
+    default=None,
+    help="Jinja2 template rendered with the result by -f template.",
+)
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    help="Resolve and emit edges of this kind (repeatable).",
+)
+@click.option(
+    "--clone-threshold",
+    type=click.FloatRange(0, 1),
+    default=DEFAULT_THRESHOLD,
+    show_default=True,
+    help="How alike two functions must be, as the share of their token runs in common, "
+    "for a clone-of edge.",
+)
+@click.option(
+    "--min-confidence",
+    type=click.FloatRange(0, 1),
+    default=0.0,
+    show_default=True,
+    help="Drop edges less certain than this, e.g. 1 for exact resolutions only.",
+)
+@click.option(
+    "--cluster",
+    type=click.Choice(CLUSTER_MODES),
+    default="directory",
+    show_default=True,
+    help="How to group nodes in dot output, rows in dsm output, and nodes in mermaid output; "
+    "owner groups by CODEOWNERS owner.",
+)
+@click.option(
+    "--dsm-order",
+    type=click.Choice(DSM_ORDERS),
+    default="name",
+    show_default=True,
+    help="Row order of dsm output; partition groups cycles and puts dependencies first.",
+)
+@click.option(
+    "--adjacency",
     is_flag=True,
     default=False,
-    help="Remove .annotated files instead of creating them.",
+    help="With -f csv, also write adjacency.csv: the matrix of dsm output, rows grouped "
+    "by --cluster.",
 )
-def annotate_files(
-    paths: tuple[Path, ...], recursive: bool, clean: bool,
+@click.option(
+    "--positions",
+    type=click.Choice(POSITION_MODES),
+    default="both",
+    show_default=True,
+    help="Entity spans in json and jsonl output: rows and columns (lines), UTF-8 byte "
+    "offsets (bytes), or both.",
+)
+@click.option(
+    "--columns",
+    type=click.Choice(COLUMN_UNITS),
+    default="chars",
+    show_default=True,
+    help="What columns count: characters (code points), UTF-16 code units, as LSP and "
+    "JavaScript do, or UTF-8 bytes.  Notebooks keep character columns.",
+)
+@click.option(
+    "--report",
+    type=click.Choice(sorted(REPORTS)),
+    default=None,
+    help="Write a report instead of the entities: cycles lists dependency cycles "
+    "among --cluster groups with a suggested break point, dependencies the declared "
+    "dependencies nothing imports and the imports nothing declares, layers the "
+    "--cluster groups in dependency layers with the upward dependencies that close "
+    "cycles, licenses the files missing a license header or at odds with the "
+    "others, owners the dependencies between code owners, todos the TODO, FIXME, "
+    "HACK, and XXX comments, unused the exported functions nothing calls (text, or "
+    "JSON with -f json).",
+)
+@click.option(
+    "--root", "scope",
+    type=click.Path(exists=True, path_type=Path),
+    multiple=True,
+    help="Only output files under this path (repeatable); the other PATHS are still "
+    "analyzed so edges into them resolve.",
+)
+@click.option(
+    "--canonical",
+    is_flag=True,
+    default=False,
+    help="Sort entities by span within each file, renumbering them, and edges by their "
+    "endpoints, for byte-identical output to commit and diff.",
+)
+@click.option(
+    "--hierarchy",
+    is_flag=True,
+    default=False,
+    help="Add repository, module, and package entities above the files, with parent links.",
+)
+@click.option(
+    "--granularity",
+    type=click.Choice(GRANULARITIES),
+    default="entity",
+    show_default=True,
+    help="Roll edges up to the files or packages of their endpoints, keeping only entities "
+    "at that level (package implies --hierarchy).",
+)
+@click.option(
+    "--aggregate",
+    type=click.Choice(AGGREGATIONS),
+    default="count",
+    show_default=True,
+    help="Weight of each rolled-up edge: the edges it merges, the distinct entities they "
+    "come from (distinct-callers), or 1 (binary).",
+)
+@click.option(
+    "--redact",
+    is_flag=True,
+    default=False,
+    help="Replace names, paths, and string values with hashes, keeping the graph's shape.",
+)
+@click.option(
+    "--redact-key",
+    envvar="AUTOSG_REDACT_KEY",
+    default=None,
+    help="Secret that keeps --redact hashes the same across runs (default: new per run).",
+)
+@click.option(
+    "--owners", "use_owners",
+    is_flag=True,
+    default=False,
+    help="Give every entity an owner attr from the repository's CODEOWNERS file.",
+)
+@click.option(
+    "--owners-file",
+    type=click.Path(exists=True, dir_okay=False, path_type=Path),
+    default=None,
+    help="Read owners from this file in CODEOWNERS syntax instead (implies --owners).",
+)
+@click.option(
+    "--coverage", "coverage_files",
+    type=click.Path(exists=True, dir_okay=False, path_type=Path),
+    multiple=True,
+    help="Give entities a coverage attr, the share of their lines the tests ran, from a "
+    "Go coverprofile, lcov tracefile, or Cobertura XML report (repeatable).",
+)
+@click.option(
+    "--max-memory",
+    callback=_parse_size,
+    default=None,
+    metavar="SIZE",
+    help="Spill references and edges beyond this much memory (e.g. 512M, 2G) to "
+    "temporary files.",
+)
+@click.option(
+    "--shard",
+    callback=_parse_shard,
+    default=None,
+    metavar="I/N",
+    help="Only analyze the I-th of N slices of the files, writing a partial result for "
+    "merge.",
+)
+@click.option(
+    "--fail-on", "fail_on",
+    multiple=True,
+    callback=_parse_fail_on,
+    metavar="EXPR",
+    help="Exit with status 1 once the output is written if a threshold holds, e.g. "
+    "'cycles>0, max-complexity>25' (repeatable, comma-separated; metrics: "
+    f"{', '.join(gating.METRICS)}).",
+)
+@limit_options
+@jobs_option
+@no_cache_option
+@click.pass_context
+def analyze_cmd(
+    ctx: click.Context, paths: tuple[str, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    stdin_language: str | None, fmt: str, output: Path | None, sink_url: str | None,
+    template: Path | None, edges: tuple[str, ...], clone_threshold: float,
+    min_confidence: float, cluster: str, dsm_order: str, adjacency: bool, positions: str,
+    columns: str, report: str | None, scope: tuple[Path, ...], canonical: bool, hierarchy: bool,
+    granularity: str, aggregate: str, redact: bool, redact_key: str | None, use_owners: bool,
+    owners_file: Path | None, coverage_files: tuple[Path, ...], max_memory: int | None,
+    shard: tuple[int, int] | None, fail_on: list[gating.Threshold], max_file_size: int | None,
+    include_minified: bool, build_tags: BuildTags | None, jobs: int, no_cache: bool,
 ) -> None:
-    """Annotate identifiers in source files, producing .annotated copies."""
-    if clean:
-        removed: int = 0
-        for path in paths:
-            if path.is_file():
-                annotated: Path = path.parent / (path.name + ANNOTATED_SUFFIX)
-                if annotated.exists():
-                    annotated.unlink()
-                    removed += 1
-            elif path.is_dir():
-                pattern: str = "**/*" + ANNOTATED_SUFFIX if recursive else "*" + ANNOTATED_SUFFIX
-                for annotated_file in sorted(path.glob(pattern)):
-                    annotated_file.unlink()
-                    removed += 1
-        click.echo(f"Removed {removed} .annotated file(s).")
-        return
+    """Extract entities and write them in a structured format.
 
-    file_count: int = 0
-    total_ids: int = 0
-    for file_path in resolve_source_paths(paths, recursive):
-        language: str | None = detect_language(file_path)
-        if language is None:
-            click.echo(
-                f"Warning: unsupported file extension {file_path.suffix!r} "
-                f"for {file_path}, skipping.",
-                err=True,
+    Several PATHS are analyzed as one workspace: edges resolve across them,
+    and each file records the path it was found under as its root.  A PATH
+    can also be a tarball or zip file, a git URL with an optional @ref to
+    shallow-clone, or - to read one file from stdin.
+
+    With --shard, output is a partial result that merge combines with
+    those of the other shards and writes in the format asked for there.
+    """
+    if shard is not None and (
+        ctx.get_parameter_source("fmt") not in (
+            click.core.ParameterSource.DEFAULT, click.core.ParameterSource.DEFAULT_MAP,
+        )
+        or report is not None or template is not None or scope or canonical or hierarchy
+        or granularity != "entity" or redact or fail_on or columns != "chars"
+    ):
+        raise click.UsageError(
+            "--shard writes a partial result for merge; -f, --report, --template, --root, "
+            "--canonical, --hierarchy, --granularity, --redact, --fail-on, and --columns do "
+            "not apply.",
+        )
+    if report is not None:
+        if ctx.get_parameter_source("fmt") in (
+            click.core.ParameterSource.DEFAULT, click.core.ParameterSource.DEFAULT_MAP,
+        ):
+            fmt = "text"
+        elif fmt not in REPORTS[report]:
+            raise click.UsageError(
+                f"--report {report} is written as {' or '.join(sorted(REPORTS[report]))}, "
+                f"not {fmt}.",
             )
-            continue
-        result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
-        if result is None:
-            click.echo(
-                f"Warning: unsupported encoding for {file_path}, skipping.",
-                err=True,
+        edges = edges or REPORT_EDGES[report]
+        if report == "todos":
+            # Comments are not extracted unless asked for (see features.py).
+            register_features({ALL_LANGUAGES: {"comments": True}})
+    if (fmt == "template") != (template is not None):
+        raise click.UsageError("--format template and --template go together.")
+    sink: sinks.ResultSink | None = None
+    if sink_url is not None:
+        if output is not None or shard is not None or report is not None or template is not None:
+            raise click.UsageError(
+                "--sink sends the -f output; --output, --shard, --report, and --template "
+                "do not apply.",
+            )
+        try:
+            sink = sinks.open_sink(sink_url)
+        except sinks.SinkError as exc:
+            raise click.BadParameter(str(exc), param_hint="--sink") from None
+    gated: set[str] = {threshold.metric for threshold in fail_on}
+    gate_edges: tuple[str, ...] = (
+        gating.GATE_EDGES if gated & gating.EDGE_METRICS and not edges else ()
+    )
+    if "secrets" in gated:
+        register_features({ALL_LANGUAGES: {"secrets": True}})
+    owners: Owners | None = None
+    if (
+        use_owners or owners_file is not None or cluster == "owner" or report == "owners"
+        or "entities-without-owner" in gated
+    ):
+        owners = _load_owners(owners_file)
+    coverage: Coverage | None = None
+    if coverage_files:
+        coverage = Coverage()
+        for coverage_file in coverage_files:
+            try:
+                coverage.load(coverage_file)
+            except ValueError as exc:
+                raise click.BadParameter(str(exc), param_hint="--coverage") from None
+    roots: list[Path]
+    labels: dict[Path, str]
+    try:
+        roots, labels = ctx.with_resource(fetching.fetch_inputs(paths, stdin_language))
+    except fetching.FetchError as exc:
+        raise click.BadParameter(str(exc), param_hint="PATHS") from None
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache,
+        edges=frozenset(edges or gate_edges), jobs=jobs, scope=scope, owners=owners,
+        coverage=coverage, labels=labels,
+        max_memory=max_memory, limits=FileLimits(max_file_size, not include_minified, build_tags),
+        clone_threshold=clone_threshold, min_confidence=min_confidence, shard=shard,
+    )
+    try:
+        analysis: Analysis = iter_analyze(roots, options)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc), param_hint="--root") from None
+    # Measured before the wrappers below change entities and edges.
+    gate: gating.GatedAnalysis | None = None
+    if fail_on:
+        analysis = gate = gating.GatedAnalysis(analysis, pass_edges=not gate_edges)
+    if canonical:
+        analysis = CanonicalAnalysis(analysis)
+    if hierarchy or granularity != "entity":
+        if report is not None:
+            raise click.UsageError("--hierarchy and --granularity do not apply to --report.")
+        analysis = HierarchicalAnalysis(
+            analysis, granularity, containers=hierarchy or granularity == "package",
+            aggregate=aggregate,
+        )
+    if columns != "chars":
+        if fmt == "lsif":
+            raise click.UsageError("lsif positions are always in UTF-16 code units.")
+        analysis = ColumnAnalysis(analysis, columns)
+    if redact:
+        if fmt == "lsif":
+            raise click.UsageError("--redact cannot be used with lsif, which links the sources.")
+        analysis = RedactedAnalysis(
+            analysis, redact_key.encode() if redact_key is not None else new_key(),
+        )
+    export_options: ExportOptions = ExportOptions(
+        cluster=cluster, dsm_order=dsm_order, positions=positions, adjacency=adjacency,
+    )
+    if fmt.startswith("dsm") and not edges:
+        click.echo("Warning: dsm output without --edges has no dependencies to show.", err=True)
+    # Extraction happens as the output is written; its phases nest inside this one.
+    ctx.with_resource(tracing.phase("write", format=fmt))
+    if sink is not None:
+        try:
+            sink.write(analysis, fmt, export_options)
+        except sinks.SinkError as exc:
+            raise click.ClickException(str(exc)) from None
+        _fail_on(gate, fail_on)
+        return
+    if report is None and fmt in FILE_FORMATS:
+        if output is None:
+            raise click.UsageError(f"--format {fmt} requires --output.")
+        FILE_FORMATS[fmt](analysis, output, export_options)
+        _fail_on(gate, fail_on)
+        return
+    out: TextIO
+    if output is not None:
+        out = open(output, "w", newline="")
+    else:
+        out = sys.stdout
+    try:
+        if shard is not None:
+            sharding.write_shard(analysis, out)
+        elif report is not None:
+            REPORTS[report][fmt](analysis, out, export_options)
+        elif template is not None:
+            templating.write_template(analysis, out, template)
+        else:
+            FORMATS[fmt](analysis, out, export_options)
+    except templating.TemplateError as exc:
+        raise click.ClickException(str(exc)) from None
+    finally:
+        if out is not sys.stdout:
+            out.close()
+    _fail_on(gate, fail_on)
+
+
+@cli.command("merge")
+@click.argument(
+    "parts", nargs=-1, required=True,
+    type=click.Path(exists=True, dir_okay=False, path_type=Path),
+)
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(sorted([*FORMATS, *FILE_FORMATS])),
+    default="json",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "-o", "--output", "--out",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout; required for arrow, csv, parquet, and sqlite).",
+)
+@click.option(
+    "--canonical",
+    is_flag=True,
+    default=False,
+    help="Sort entities and edges as analyze --canonical does.",
+)
+@click.option(
+    "--max-memory",
+    callback=_parse_size,
+    default=None,
+    metavar="SIZE",
+    help="Spill references and edges beyond this much memory (e.g. 512M, 2G) to "
+    "temporary files.",
+)
+def merge_cmd(
+    parts: tuple[Path, ...], fmt: str, output: Path | None, canonical: bool,
+    max_memory: int | None,
+) -> None:
+    """Combine the partial results of analyze --shard into one result.
+
+    PARTS are the outputs of every shard of one run, in any order.  Edges
+    between files of different shards are resolved here, so run merge in
+    the same checkout as the shards.
+    """
+    try:
+        analysis: Analysis = sharding.MergedAnalysis(list(parts), max_memory)
+    except sharding.ShardError as exc:
+        raise click.BadParameter(str(exc), param_hint="PARTS") from None
+    if canonical:
+        analysis = CanonicalAnalysis(analysis)
+    try:
+        if fmt in FILE_FORMATS:
+            if output is None:
+                raise click.UsageError(f"--format {fmt} requires --output.")
+            FILE_FORMATS[fmt](analysis, output, ExportOptions())
+            return
+        out: TextIO = open(output, "w", newline="") if output is not None else sys.stdout
+        try:
+            FORMATS[fmt](analysis, out, ExportOptions())
+        finally:
+            if out is not sys.stdout:
+                out.close()
+    except sharding.ShardError as exc:
+        raise click.ClickException(str(exc)) from None
+
+
+@cli.command("schema")
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json-schema"]),
+    default="json-schema",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "--document",
+    type=click.Choice(schema.DOCUMENTS),
+    default="json",
+    show_default=True,
+    help="Describe analyze -f json output, or one line of -f jsonl.",
+)
+def schema_cmd(fmt: str, document: str) -> None:
+    """Print the schema of analyze output, whose version every output records.
+
+    json output has a top-level schema_version, jsonl a leading header
+    record, sqlite its user_version, and parquet and arrow tables the
+    autosg.schema_version metadata key.
+    """
+    click.echo(json.dumps(schema.json_schema(document), indent=2))
+
+
+@cli.command("batch")
+@click.argument("repo_list", type=click.Path(exists=True, dir_okay=False, path_type=Path))
+@filter_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(sorted([*FORMATS, *FILE_FORMATS])),
+    default="json",
+    show_default=True,
+    help="Output format of each repository.",
+)
+@click.option(
+    "-o", "--output-dir",
+    type=click.Path(file_okay=False, path_type=Path),
+    default=Path("autosg-batch"),
+    show_default=True,
+    help="Directory for the per-repository outputs and summary.json.",
+)
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    help="Resolve and emit edges of this kind (repeatable).",
+)
+@click.option(
+    "-c", "--concurrency",
+    type=click.IntRange(min=1),
+    default=os.cpu_count() or 1,
+    show_default="number of CPUs",
+    help="Analyze this many repositories at once, each in its own process.",
+)
+@no_cache_option
+def batch_cmd(
+    repo_list: Path, include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool,
+    follow_symlinks: bool, languages: frozenset[str], fmt: str, output_dir: Path,
+    edges: tuple[str, ...], concurrency: int, no_cache: bool,
+) -> None:
+    """Analyze every repository in REPO_LIST and summarize them together.
+
+    REPO_LIST has one directory, archive, or git URL per line, optionally
+    followed by a name.  Each repository's output goes to
+    OUTPUT_DIR/NAME.FORMAT, and counts per repository and in total to
+    OUTPUT_DIR/summary.json.  Exits with status 1 if any repository failed.
+    """
+    try:
+        entries: list[batching.BatchEntry] = batching.parse_batch_file(repo_list)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc), param_hint="REPO_LIST") from None
+    if fmt.startswith("dsm") and not edges:
+        click.echo("Warning: dsm output without --edges has no dependencies to show.", err=True)
+    options: Options = Options(
+        gitignore=not no_gitignore, follow_symlinks=follow_symlinks, include=include,
+        exclude=exclude, languages=languages, cache=not no_cache, edges=frozenset(edges),
+    )
+
+    def done(repo: batching.RepoSummary) -> None:
+        if repo.error is not None:
+            click.echo(f"failed  {repo.name}: {repo.error}")
+        else:
+            click.echo(
+                f"ok      {repo.name}: {repo.files} files, "
+                f"{sum(repo.entities.values())} entities, {sum(repo.edges.values())} edges "
+                f"({repo.seconds:.1f}s)",
+            )
+
+    repos: list[batching.RepoSummary] = batching.run_batch(
+        entries, options, fmt, output_dir, concurrency, done,
+    )
+    failed: int = sum(1 for r in repos if r.error is not None)
+    click.echo(
+        f"{len(repos) - failed} of {len(repos)} repositories analyzed; "
+        f"summary in {output_dir / batching.SUMMARY_NAME}",
+    )
+    if failed:
+        sys.exit(1)
+
+
+@cli.command("diff")
+@click.argument("old")
+@click.argument("new")
+@filter_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "markdown", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    help="Also compare edges of this kind (repeatable).",
+)
+@click.option(
+    "--exit-code",
+    is_flag=True,
+    default=False,
+    help="Exit with status 1 if there are differences.",
+)
+@jobs_option
+@no_cache_option
+def diff_cmd(
+    old: str, new: str, include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool,
+    follow_symlinks: bool, languages: frozenset[str], fmt: str, edges: tuple[str, ...],
+    exit_code: bool, jobs: int, no_cache: bool,
+) -> None:
+    """Compare entities and edges between two git revisions or directories.
+
+    OLD and NEW are each a directory or a git revision (commit, branch,
+    tag).  Revisions are taken from the repository containing the working
+    directory, and the comparison covers the working directory's subtree.
+    """
+    options: Options = Options(
+        gitignore=not no_gitignore, follow_symlinks=follow_symlinks, include=include,
+        exclude=exclude, languages=languages, cache=not no_cache, edges=frozenset(edges), jobs=jobs,
+    )
+    try:
+        result: diffing.Diff = diffing.diff_trees(old, new, options)
+    except diffing.DiffError as exc:
+        raise click.ClickException(str(exc)) from None
+    if fmt == "json":
+        click.echo(json.dumps(result.to_dict(), indent=2))
+    elif fmt == "markdown":
+        click.echo(diffing.render_markdown(result), nl=False)
+    else:
+        click.echo(diffing.render_text(result), nl=False)
+    if exit_code and result:
+        sys.exit(1)
+
+
+@cli.group("snapshot")
+def snapshot_group() -> None:
+    """Store analysis snapshots and compare their metrics over time."""
+
+
+snapshot_dir_option: Callable[[Callable[..., object]], Callable[..., object]] = click.option(
+    "--dir", "directory",
+    type=click.Path(file_okay=False, path_type=Path),
+    default=snapshotting.DEFAULT_SNAPSHOT_DIR,
+    show_default=True,
+    help="Directory snapshots are stored in.",
+)
+
+
+@snapshot_group.command("save")
+@common_options
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    help="Resolve edges of this kind (repeatable; default: calls and imports).",
+)
+@click.option("--label", default=None, help="Name the snapshot, e.g. after a release.")
+@snapshot_dir_option
+@jobs_option
+@no_cache_option
+def snapshot_save(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    edges: tuple[str, ...], label: str | None, directory: Path, jobs: int, no_cache: bool,
+) -> None:
+    """Analyze PATHS and store the result and its metrics as a new snapshot."""
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache,
+        edges=frozenset(edges), jobs=jobs,
+    )
+    try:
+        snapshot: snapshotting.Snapshot = snapshotting.save_snapshot(
+            paths, options, directory, label,
+        )
+    except snapshotting.SnapshotError as exc:
+        raise click.ClickException(str(exc)) from None
+    metrics: dict[str, Any] = snapshot.metrics
+    click.echo(
+        f"Saved snapshot {snapshot.id}: {metrics['files']} files, {metrics['entities']} "
+        f"entities, {metrics['edges']} edges, {metrics['cycles']} cycle(s).",
+    )
+
+
+@snapshot_group.command("list")
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format.",
+)
+@snapshot_dir_option
+def snapshot_list(fmt: str, directory: Path) -> None:
+    """List stored snapshots, oldest first, with their headline metrics."""
+    try:
+        snapshots: list[snapshotting.Snapshot] = snapshotting.list_snapshots(directory)
+    except snapshotting.SnapshotError as exc:
+        raise click.ClickException(str(exc)) from None
+    if fmt == "json":
+        click.echo(json.dumps([s.to_dict() for s in snapshots], indent=2))
+    elif snapshots:
+        click.echo(snapshotting.render_list(snapshots), nl=False)
+    else:
+        click.echo(f"No snapshots in {directory}.", err=True)
+
+
+@snapshot_group.command("compare")
+@click.argument("old", default="latest~1")
+@click.argument("new", default="latest")
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "markdown", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format.",
+)
+@snapshot_dir_option
+def snapshot_compare(old: str, new: str, fmt: str, directory: Path) -> None:
+    """Compare the metrics of two snapshots, and count what changed between them.
+
+    OLD and NEW are snapshot ids (or unique prefixes), labels, latest, or
+    latest~N for the Nth snapshot before the latest.  They default to the
+    last two snapshots.
+    """
+    try:
+        snapshots: list[snapshotting.Snapshot] = snapshotting.list_snapshots(directory)
+        comparison: snapshotting.Comparison = snapshotting.compare_snapshots(
+            snapshotting.find_snapshot(snapshots, old), snapshotting.find_snapshot(snapshots, new),
+        )
+    except snapshotting.SnapshotError as exc:
+        raise click.ClickException(str(exc)) from None
+    if fmt == "json":
+        click.echo(json.dumps(comparison.to_dict(), indent=2))
+    elif fmt == "markdown":
+        click.echo(snapshotting.render_markdown(comparison), nl=False)
+    else:
+        click.echo(snapshotting.render_text(comparison), nl=False)
+
+
+@cli.command("history")
+@click.argument("paths", nargs=-1, type=click.Path(exists=True, path_type=Path))
+@filter_options
+@click.option(
+    "--granularity",
+    type=click.Choice(history.GRANULARITIES),
+    default="file",
+    show_default=True,
+    help="Couple whole files, or the declarations whose lines changed.",
+)
+@click.option("--since", default=None, help="Only commits after this date (as for git log).")
+@click.option(
+    "--max-commits",
+    type=click.IntRange(min=1),
+    default=1000,
+    show_default=True,
+    help="Only look at this many of the most recent commits.",
+)
+@click.option(
+    "--max-changeset",
+    type=click.IntRange(min=2),
+    default=30,
+    show_default=True,
+    help="Skip commits that touch more files or entities than this.",
+)
+@click.option(
+    "--min-support",
+    type=click.IntRange(min=1),
+    default=2,
+    show_default=True,
+    help="Only report pairs that changed together at least this often.",
+)
+@click.option(
+    "--independent",
+    is_flag=True,
+    default=False,
+    help="Only report pairs with no call or import edge between them today.",
+)
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["csv", "json"]),
+    default="json",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@no_cache_option
+def history_cmd(
+    paths: tuple[Path, ...], include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool,
+    follow_symlinks: bool, languages: frozenset[str], granularity: str, since: str | None,
+    max_commits: int, max_changeset: int, min_support: int, independent: bool, fmt: str,
+    output: Path | None, no_cache: bool,
+) -> None:
+    """Find files or entities that change together in git history.
+
+    Walks the history of PATHS (default: the working directory) and
+    reports co-change edges, strongest first, with how often each pair
+    changed together (support) and how strongly (coupling, 0 to 1).
+    """
+    options: history.HistoryOptions = history.HistoryOptions(
+        granularity=granularity, since=since, max_commits=max_commits,
+        max_changeset=max_changeset, min_support=min_support, include=include,
+        exclude=exclude, languages=languages,
+    )
+    path_args: list[str] = [str(p) for p in paths]
+    cache = open_cache_db() if not no_cache and granularity == "entity" else None
+    try:
+        result: history.CoChange = history.cochange(path_args, options, cache)
+    except history.HistoryError as exc:
+        raise click.ClickException(str(exc)) from None
+    finally:
+        if cache is not None:
+            cache.commit()
+            cache.close()
+    if independent:
+        linked: set[frozenset[history.UnitKey]] = history.structural_pairs(
+            path_args, granularity,
+            Options(
+                gitignore=not no_gitignore, follow_symlinks=follow_symlinks, include=include,
+                exclude=exclude, languages=languages, cache=not no_cache,
+            ),
+        )
+        result.edges = [e for e in result.edges if frozenset(e[:2]) not in linked]
+    out: TextIO = open(output, "w", newline="") if output is not None else sys.stdout
+    try:
+        if fmt == "csv":
+            history.write_csv(result, out)
+        else:
+            json.dump({"commits": result.commits, "edges": result.edge_dicts()}, out, indent=2)
+            out.write("\n")
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+@cli.command("blame")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(sorted({"csv", *FORMATS, *FILE_FORMATS})),
+    default="json",
+    show_default=True,
+    help="Output format; csv lists one entity per row.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout; required for arrow, parquet, and sqlite).",
+)
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    help="Resolve and emit edges of this kind (repeatable); csv counts each entity's "
+    "dependents over them.",
+)
+@click.option(
+    "--since",
+    default=None,
+    help="Only count changes in commits after this date (as for git log).",
+)
+@click.option(
+    "--max-commits",
+    type=click.IntRange(min=1),
+    default=1000,
+    show_default=True,
+    help="Only count changes in this many of the most recent commits.",
+)
+@click.option(
+    "--no-changes",
+    is_flag=True,
+    default=False,
+    help="Skip counting changes, which reads every commit; blame alone is faster.",
+)
+@jobs_option
+@no_cache_option
+def blame_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, edges: tuple[str, ...], since: str | None, max_commits: int,
+    no_changes: bool, jobs: int, no_cache: bool,
+) -> None:
+    """Extract entities with who changed them last, when, and how often.
+
+    Every entity gets last_modified, last_author, last_commit, and authors
+    attrs from git blame of the working tree, and changes, the number of
+    commits that touched its lines (within --since and --max-commits).
+    """
+    changes: Counter[history.UnitKey] | None = None
+    if not no_changes:
+        cache = open_cache_db() if not no_cache else None
+        try:
+            changes = history.change_counts(
+                [str(p) for p in paths],
+                history.HistoryOptions(
+                    since=since, max_commits=max_commits, include=include, exclude=exclude,
+                    languages=languages,
+                ),
+                cache,
+            )
+        except history.HistoryError as exc:
+            raise click.ClickException(str(exc)) from None
+        finally:
+            if cache is not None:
+                cache.commit()
+                cache.close()
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache,
+        edges=frozenset(edges), jobs=jobs,
+    )
+    analysis: Analysis = history.BlamedAnalysis(iter_analyze(list(paths), options), changes)
+    if fmt in FILE_FORMATS and fmt != "csv":  # blame's own csv goes to a stream
+        if output is None:
+            raise click.UsageError(f"--format {fmt} requires --output.")
+        FILE_FORMATS[fmt](analysis, output, ExportOptions())
+        return
+    out: TextIO = open(output, "w", newline="") if output is not None else sys.stdout
+    try:
+        if fmt == "csv":
+            history.write_blame_csv(analysis, out)
+        else:
+            FORMATS[fmt](analysis, out, ExportOptions())
+    except history.HistoryError as exc:
+        raise click.ClickException(str(exc)) from None
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+def _parse_attr_filters(
+    _ctx: click.Context, _param: click.Parameter, values: tuple[str, ...],
+) -> tuple[querying.AttrFilter, ...]:
+    try:
+        return tuple(querying.parse_attr_filter(v) for v in values)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc)) from None
+
+
+def _compile_name(
+    _ctx: click.Context, _param: click.Parameter, value: str | None,
+) -> re.Pattern[str] | None:
+    if value is None:
+        return None
+    try:
+        return re.compile(value)
+    except re.error as exc:
+        raise click.BadParameter(f"invalid regular expression: {exc}") from None
+
+
+@cli.command("query")
+@common_options
+@click.option("--kind", "kinds", multiple=True, help="Entity kind (repeatable).")
+@click.option(
+    "--name",
+    callback=_compile_name,
+    default=None,
+    help="Regular expression searched in the qualified name (e.g. 'Handler$').",
+)
+@click.option(
+    "--file", "files",
+    multiple=True,
+    callback=_split_globs,
+    help="Glob matched against the entity's path (repeatable, comma-separated).",
+)
+@click.option(
+    "--attr", "attrs",
+    multiple=True,
+    callback=_parse_attr_filters,
+    help="Attribute test: KEY, KEY=VALUE, KEY!=VALUE, or KEY>=N (repeatable).",
+)
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "jsonl", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format.",
+)
+@click.option("--count", is_flag=True, default=False, help="Only print the number of matches.")
+@jobs_option
+@no_cache_option
+def query_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    kinds: tuple[str, ...], name: re.Pattern[str] | None, files: tuple[str, ...],
+    attrs: tuple[querying.AttrFilter, ...], fmt: str, count: bool, jobs: int, no_cache: bool,
+) -> None:
+    """Find entities by kind, name, path, and attributes.
+
+    All given tests must pass.  Text output is one ``path:row:col: kind
+    name`` line per match, like grep, with qualified names.
+    """
+    query: querying.Query = querying.Query(frozenset(kinds), name, files, attrs)
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+    )
+    matches: list[dict[str, Any]] = []
+    total: int = 0
+    for file_result in iter_analyze(paths, options):
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            if not query.matches(entity, names[entity.id]):
+                continue
+            total += 1
+            if count:
+                continue
+            if fmt == "text":
+                click.echo(
+                    f"{entity.path}:{entity.row}:{entity.col}: {entity.kind} {names[entity.id]}",
+                )
+            elif fmt == "jsonl":
+                click.echo(
+                    json.dumps({**dataclasses.asdict(entity), "qualified": names[entity.id]}),
+                )
+            else:
+                matches.append({**dataclasses.asdict(entity), "qualified": names[entity.id]})
+    if count:
+        click.echo(total)
+    elif fmt == "json":
+        click.echo(json.dumps(matches, indent=2))
+
+
+@cli.command("report")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(reporting.REPORT_FORMATS),
+    default="html",
+    show_default=True,
+    help="Report format; HTML is a single self-contained file.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@click.option("--title", default=None, help="Report title (default: the analyzed directory).")
+@click.option(
+    "--top",
+    type=click.IntRange(min=1),
+    default=20,
+    show_default=True,
+    help="Rows in the largest-files and most-depended-on tables.",
+)
+@jobs_option
+@no_cache_option
+def report_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, title: str | None, top: int, jobs: int, no_cache: bool,
+) -> None:
+    """Write an architecture report for a design review.
+
+    Shows entity counts per package (directory), the package dependency
+    diagram built from call and import edges, the largest files, and the
+    most depended-on packages.
+    """
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+        edges=frozenset({"calls", "imports"}),
+    )
+    if title is None:
+        root: Path = paths[0] if len(paths) == 1 and paths[0].is_dir() else Path.cwd()
+        title = f"Architecture of {root.resolve().name}"
+    report: reporting.Report = reporting.build_report(iter_analyze(paths, options), title)
+    out: TextIO = open(output, "w", encoding="utf-8") if output is not None else sys.stdout
+    try:
+        if fmt == "html":
+            reporting.write_html(report, out, top)
+        else:
+            reporting.write_markdown(report, out, top)
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+@cli.command("summary")
+@common_options
+@click.option(
+    "--top",
+    type=click.IntRange(min=1),
+    default=10,
+    show_default=True,
+    help="Rows in each ranking.",
+)
+@click.option(
+    "--color/--no-color",
+    default=None,
+    help="Color the output (default: when writing to a terminal).",
+)
+@jobs_option
+@no_cache_option
+def summary_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], top: int,
+    color: bool | None, jobs: int, no_cache: bool,
+) -> None:
+    """Print an overview of PATHS for a first look.
+
+    Shows files and lines per language, the largest entities, the most
+    depended-on modules (files), the functions with the most distinct
+    callees, and the dependency cycles among files, from call and import
+    edges.
+    """
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+        edges=frozenset({"calls", "imports"}),
+    )
+    root: Path = paths[0] if len(paths) == 1 and paths[0].is_dir() else Path.cwd()
+    summary: summarizing.Summary = summarizing.build_summary(
+        iter_analyze(paths, options), f"Summary of {root.resolve().name}", top,
+    )
+    summarizing.write_summary(summary, sys.stdout, top, color)
+
+
+@cli.command("openapi")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "yaml"]),
+    default="yaml",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@click.option("--title", default=None, help="API title (default: the analyzed directory).")
+@click.option(
+    "--api-version", default="0.1.0", show_default=True, help="The document's info.version.",
+)
+@jobs_option
+@no_cache_option
+def openapi_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, title: str | None, api_version: str, jobs: int, no_cache: bool,
+) -> None:
+    """Write an OpenAPI 3 skeleton from the HTTP endpoints in PATHS.
+
+    Lists every route with its handler, path and query parameters, and,
+    for Go handlers, the response schema of the struct they encode.
+    """
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+        edges=frozenset({"handles"}),
+    )
+    if title is None:
+        root: Path = paths[0] if len(paths) == 1 and paths[0].is_dir() else Path.cwd()
+        title = f"{root.resolve().name} API"
+    document: dict[str, Any] = openapi.build_openapi(
+        iter_analyze(paths, options), title, api_version,
+    )
+    out: TextIO = open(output, "w", encoding="utf-8") if output is not None else sys.stdout
+    try:
+        if fmt == "yaml":
+            # Import lazily, as for config files.
+            import yaml
+
+            yaml.safe_dump(document, out, sort_keys=False, allow_unicode=True)
+        else:
+            json.dump(document, out, indent=2)
+            out.write("\n")
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+class _DefaultGroup(click.Group):
+    """A group that runs *default* when its first argument is not a subcommand."""
+
+    def __init__(self, *args: Any, default: str, **kwargs: Any) -> None:
+        super().__init__(*args, **kwargs)
+        self.default: str = default
+
+    def parse_args(self, ctx: click.Context, args: list[str]) -> list[str]:
+        if args and args[0] not in self.commands and args[0] not in ctx.help_option_names:
+            args = [self.default, *args]
+        return super().parse_args(ctx, args)
+
+
+@cli.group("api", cls=_DefaultGroup, default="show")
+def api_group() -> None:
+    """List the exported API of Go, Java, and JavaScript/TypeScript code, or compare two.
+
+    autosg api PATHS is short for autosg api show PATHS.
+    """
+
+
+@api_group.command("show")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format; json can be compared later with api diff.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@jobs_option
+@no_cache_option
+def api_show(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, jobs: int, no_cache: bool,
+) -> None:
+    """List the exported functions, types, methods, and fields in PATHS.
+
+    Paths are shown relative to PATHS when it is a single directory, as
+    api diff shows them.
+    """
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+    )
+    root: Path | None = paths[0] if len(paths) == 1 and paths[0].is_dir() else None
+    symbols: list[surface.Symbol] = surface.analyze_surface(paths, options, root)
+    text: str = (
+        json.dumps(surface.to_json(symbols), indent=2) + "\n" if fmt == "json"
+        else surface.render_symbols(symbols)
+    )
+    if output is not None:
+        output.write_text(text, encoding="utf-8")
+    else:
+        click.echo(text, nl=False)
+
+
+@api_group.command("diff")
+@click.argument("old")
+@click.argument("new")
+@filter_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(["json", "markdown", "text"]),
+    default="text",
+    show_default=True,
+    help="Output format.",
+)
+@click.option(
+    "--exit-code",
+    is_flag=True,
+    default=False,
+    help="Exit with status 1 if there are breaking changes.",
+)
+@jobs_option
+@no_cache_option
+def api_diff(
+    old: str, new: str, include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool,
+    follow_symlinks: bool, languages: frozenset[str], fmt: str, exit_code: bool, jobs: int,
+    no_cache: bool,
+) -> None:
+    """Classify API changes as breaking or compatible and suggest a version bump.
+
+    OLD and NEW are each a directory, a git revision, or a surface saved
+    with api -f json.
+    """
+    options: Options = Options(
+        gitignore=not no_gitignore, follow_symlinks=follow_symlinks, include=include,
+        exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+    )
+    try:
+        result: surface.ApiDiff = surface.diff_api(old, new, options)
+    except (diffing.DiffError, surface.SurfaceError) as exc:
+        raise click.ClickException(str(exc)) from None
+    if fmt == "json":
+        click.echo(json.dumps(result.to_dict(), indent=2))
+    elif fmt == "markdown":
+        click.echo(surface.render_markdown(result), nl=False)
+    else:
+        click.echo(surface.render_text(result), nl=False)
+    if exit_code and result.breaking:
+        sys.exit(1)
+
+
+@cli.command("check")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(linting.LINT_FORMATS),
+    default="text",
+    show_default=True,
+    help="Output format; SARIF is for GitHub code scanning and other CI annotations.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@click.option(
+    "--baseline",
+    type=click.Path(dir_okay=False, path_type=Path),
+    default=None,
+    help="Only list and fail on violations this baseline file does not; create it with "
+    "--update-baseline.",
+)
+@click.option(
+    "--update-baseline",
+    is_flag=True,
+    default=False,
+    help="Record the current violations in --baseline, replacing it, and exit 0.",
+)
+@jobs_option
+@no_cache_option
+@click.pass_context
+def check_cmd(
+    ctx: click.Context, paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    fmt: str, output: Path | None, baseline: Path | None, update_baseline: bool, jobs: int,
+    no_cache: bool,
+) -> None:
+    """Check PATHS against the architecture rules in the config file.
+
+    Lists every dependency that breaks a rule and exits with status 1 if
+    there is any.  Rules are declared under ``rules``; see the README.
+    With --baseline, violations recorded there are known and only new
+    ones are listed and fail the check.
+    """
+    if update_baseline and baseline is None:
+        raise click.UsageError("--update-baseline needs --baseline.")
+    if baseline is not None and not update_baseline and not baseline.exists():
+        raise click.UsageError(
+            f"no baseline at {baseline}; record one with --update-baseline.",
+        )
+    config_path: Path | None
+    rules: list[checking.ArchRule]
+    config_path, rules = ctx.meta.get(_RULES_KEY, (None, []))
+    if not rules:
+        where: str = str(config_path) if config_path is not None else "no config file found"
+        raise click.ClickException(f"no rules to check ({where}); declare them under 'rules'")
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+        edges=checking.rule_edges(rules),
+    )
+    findings: list[linting.Finding] = checking.check(iter_analyze(paths, options), rules)
+    comparison: baselining.Comparison | None = None
+    if baseline is not None and not update_baseline:
+        try:
+            comparison = baselining.compare(findings, baselining.read_baseline(baseline))
+        except baselining.BaselineError as exc:
+            raise click.ClickException(str(exc)) from None
+        findings = comparison.new
+    out: TextIO = open(output, "w", encoding="utf-8") if output is not None else sys.stdout
+    try:
+        if fmt == "sarif":
+            linting.write_sarif(findings, out, checking.sarif_rules(rules))
+        elif fmt == "json":
+            linting.write_json(findings, out)
+        else:
+            linting.write_text(findings, out)
+    finally:
+        if out is not sys.stdout:
+            out.close()
+    if update_baseline:
+        assert baseline is not None
+        baselining.write_baseline(baseline, findings)
+        click.echo(f"Recorded {len(findings)} violation(s) in {baseline}", err=True)
+        return
+    if comparison is not None:
+        click.echo(f"{comparison.known} known violation(s) in {baseline}", err=True)
+        if comparison.fixed:
+            click.echo(
+                f"{comparison.fixed} baseline violation(s) are fixed; run with "
+                "--update-baseline to drop them",
+                err=True,
+            )
+    if findings:
+        new: str = "new " if comparison is not None else ""
+        click.echo(
+            f"{len(findings)} {new}violation(s) of {len({f.rule for f in findings})} rule(s)",
+            err=True,
+        )
+        sys.exit(1)
+
+
+@cli.command("datamodel")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(modeling.DATAMODEL_FORMATS),
+    default="markdown",
+    show_default=True,
+    help="Output format; CSV has one row per field.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@jobs_option
+@no_cache_option
+def datamodel_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, jobs: int, no_cache: bool,
+) -> None:
+    """List the serialized types in PATHS with their wire field names.
+
+    A type is serialized when its fields carry serialization tags or
+    annotations (Go ``json:"..."`` tags, serde, Jackson, Gson,
+    System.Text.Json, kotlinx.serialization) or it is a pydantic model.
+    """
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+    )
+    types: list[modeling.ModelType] = modeling.build_data_model(iter_analyze(paths, options))
+    out: TextIO = open(output, "w", encoding="utf-8", newline="") if output else sys.stdout
+    try:
+        if fmt == "json":
+            modeling.write_json(types, out)
+        elif fmt == "csv":
+            modeling.write_csv(types, out)
+        else:
+            modeling.write_markdown(types, out)
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+def _limit_option(name: str, default: int, what: str) -> Callable[..., object]:
+    return click.option(
+        f"--max-{name}",
+        type=click.IntRange(min=0),
+        default=default,
+        show_default=True,
+        help=f"Flag functions with more {what}; 0 turns the check off.",
+    )
+
+
+@cli.command("lint")
+@common_options
+@click.option(
+    "-f", "--format", "fmt",
+    type=click.Choice(linting.LINT_FORMATS),
+    default="text",
+    show_default=True,
+    help="Output format; SARIF is for GitHub code scanning and other CI annotations.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(path_type=Path),
+    default=None,
+    help="Output path (default: stdout).",
+)
+@_limit_option("loc", 100, "lines of code")
+@_limit_option("complexity", 15, "cyclomatic complexity")
+@_limit_option("params", 6, "parameters")
+@_limit_option("depth", 5, "nesting depth")
+@click.option(
+    "--cycles/--no-cycles",
+    default=True,
+    show_default=True,
+    help="Flag files in call or import dependency cycles.",
+)
+@click.option(
+    "--secrets/--no-secrets",
+    default=False,
+    show_default=True,
+    help="Flag string literals that look like hard-coded credentials: known key and "
+    "token formats, and long random-looking strings.",
+)
+@jobs_option
+@no_cache_option
+def lint_cmd(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], fmt: str,
+    output: Path | None, max_loc: int, max_complexity: int, max_params: int, max_depth: int,
+    cycles: bool, secrets: bool, jobs: int, no_cache: bool,
+) -> None:
+    """Report oversized or complex functions, dependency cycles, and secrets.
+
+    Each finding points at the function, the dependency that closes the
+    cycle, or the string literal, so SARIF output shows up as annotations
+    on those lines.
+    """
+    if secrets:
+        register_features({ALL_LANGUAGES: {"secrets": True}})
+    options: Options = Options(
+        recursive=recursive, gitignore=not no_gitignore, follow_symlinks=follow_symlinks,
+        include=include, exclude=exclude, languages=languages, cache=not no_cache, jobs=jobs,
+        edges=frozenset({"calls", "imports"}) if cycles else frozenset(),
+    )
+    lint_options: linting.LintOptions = linting.LintOptions(
+        max_loc=max_loc or None,
+        max_complexity=max_complexity or None,
+        max_params=max_params or None,
+        max_depth=max_depth or None,
+        cycles=cycles,
+        secrets=secrets,
+    )
+    findings: list[linting.Finding] = linting.lint(iter_analyze(paths, options), lint_options)
+    out: TextIO = open(output, "w", encoding="utf-8") if output is not None else sys.stdout
+    try:
+        if fmt == "sarif":
+            linting.write_sarif(findings, out)
+        elif fmt == "json":
+            linting.write_json(findings, out)
+        else:
+            linting.write_text(findings, out)
+    finally:
+        if out is not sys.stdout:
+            out.close()
+
+
+def _annotate_file(file_path: Path) -> int | None:
+    """Write the .annotated copy of one file.
+
+    Returns the number of identifiers annotated, or *None* if the file was
+    skipped (a warning has already been printed).
+    """
+    language: str | None = detect_language(file_path)
+    if language is None:
+        click.echo(
+            f"Warning: unsupported file extension {file_path.suffix!r} "
+            f"for {file_path}, skipping.",
+            err=True,
+        )
+        return None
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        click.echo(
+            f"Warning: unsupported encoding for {file_path}, skipping.",
+            err=True,
+        )
+        return None
+    utf8_bytes, enc = result
+    annotated_utf8, next_id = annotate_source(utf8_bytes, language, 0)
+    out_path: Path = file_path.parent / (file_path.name + ANNOTATED_SUFFIX)
+    out_path.write_bytes(encode_output(annotated_utf8, enc))
+    return next_id
+
+
+@cli.command("annotate-files")
+@common_options
+@click.option(
+    "--clean",
+    is_flag=True,
+    default=False,
+    help="Remove .annotated files instead of creating them.",
+)
+@click.option(
+    "--watch",
+    is_flag=True,
+    default=False,
+    help="Keep running and re-annotate files as they change.",
+)
+def annotate_files(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...], exclude: tuple[str, ...],
+    no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str], clean: bool, watch: bool,
+) -> None:
+    """Annotate identifiers in source files, producing .annotated copies."""
+    walk: WalkOptions = _walk_options(
+        recursive, include, exclude, no_gitignore, follow_symlinks, languages,
+    )
+    if clean:
+        if watch:
+            raise click.UsageError("--clean cannot be combined with --watch.")
+        removed: int = 0
+        for path in paths:
+            if path.is_file():
+                annotated: Path = path.parent / (path.name + ANNOTATED_SUFFIX)
+                if annotated.exists():
+                    annotated.unlink()
+                    removed += 1
+            elif path.is_dir():
+                pattern: str = "**/*" + ANNOTATED_SUFFIX if recursive else "*" + ANNOTATED_SUFFIX
+                for annotated_file in sorted(path.glob(pattern)):
+                    annotated_file.unlink()
+                    removed += 1
+        click.echo(f"Removed {removed} .annotated file(s).")
+        return
+
+    file_count: int = 0
+    total_ids: int = 0
+    for file_path in resolve_source_paths(paths, walk):
+        count: int | None = _annotate_file(file_path)
+        if count is not None:
+            file_count += 1
+            total_ids += count
+    click.echo(f"Annotated {file_count} file(s), {total_ids} identifier(s).")
+    if not watch:
+        return
+
+    def on_change(changed: list[Path], removed: list[Path]) -> None:
+        for file_path in changed:
+            count = _annotate_file(file_path)
+            if count is not None:
+                click.echo(f"Annotated {file_path}, {count} identifier(s).")
+        for file_path in removed:
+            stale: Path = file_path.parent / (file_path.name + ANNOTATED_SUFFIX)
+            if stale.exists():
+                stale.unlink()
+                click.echo(f"Removed {stale}.")
+
+    click.echo("Watching for changes (Ctrl+C to stop)...")
+    watching.watch(
+        lambda: list(resolve_source_paths(paths, walk)), on_change,
+    )
+
+
+def _parse_placeholders(
+    _ctx: click.Context, _param: click.Parameter, values: tuple[str, ...],
+) -> dict[str, str]:
+    """Turn repeated ``LANG=TEXT`` values into a mapping."""
+    placeholders: dict[str, str] = {}
+    for value in values:
+        language, sep, text = value.partition("=")
+        if not sep or not text:
+            raise click.BadParameter(f"expected LANG=TEXT, got {value!r}")
+        if not stubbing.supports(language):
+            raise click.BadParameter(f"stubs are not supported for {language!r}")
+        placeholders[language] = text
+    return placeholders
+
+
+def _stub_root(paths: tuple[Path, ...]) -> Path:
+    """Directory that output paths are made relative to."""
+    dirs: list[str] = [str(p.resolve() if p.is_dir() else p.resolve().parent) for p in paths]
+    return Path(os.path.commonpath(dirs))
+
+
+@cli.command("stub")
+@common_options
+@click.option(
+    "-o", "--output",
+    type=click.Path(file_okay=False, path_type=Path),
+    default=None,
+    help="Write stubs into this directory, mirroring the input tree (default: stdout).",
+)
+@click.option(
+    "--placeholder",
+    multiple=True,
+    metavar="LANG=TEXT",
+    callback=_parse_placeholders,
+    help="Statement that replaces function bodies in LANG (repeatable).",
+)
+@click.option(
+    "--validate",
+    is_flag=True,
+    default=False,
+    help="Re-parse every stub (and type-check Go modules) and report failures.",
+)
+def stub(
+    paths: tuple[Path, ...], recursive: bool, include: tuple[str, ...],
+    exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool, languages: frozenset[str],
+    output: Path | None, placeholder: dict[str, str], validate: bool,
+) -> None:
+    """Write copies of source files with function bodies stubbed out.
+
+    Signatures, types, imports, and comments are preserved; each function
+    body becomes a placeholder such as panic("stub") or "...".  With
+    --validate, exits with status 1 if any stub is not valid code.
+    """
+    walk: WalkOptions = _walk_options(
+        recursive, include, exclude, no_gitignore, follow_symlinks, languages,
+    )
+    root: Path = _stub_root(paths)
+    file_count: int = 0
+    body_count: int = 0
+    problems: list[stubbing.StubProblem] = []
+    wrote_go: bool = False
+    for file_path in resolve_source_paths(paths, walk):
+        if file_path.name in stubbing.COPIED_FILES:
+            if output is not None:
+                copy_path: Path = output / file_path.resolve().relative_to(root)
+                copy_path.parent.mkdir(parents=True, exist_ok=True)
+                copy_path.write_bytes(file_path.read_bytes())
+            continue
+        language: str | None = detect_language(file_path)
+        if language is None or not stubbing.supports(language):
+            click.echo(
+                f"Warning: stubs are not supported for {file_path}, skipping.", err=True,
+            )
+            continue
+        result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+        if result is None:
+            click.echo(
+                f"Warning: unsupported encoding for {file_path}, skipping.",
+                err=True,
             )
             continue
         utf8_bytes, enc = result
-        annotated_utf8, next_id = annotate_source(utf8_bytes, language, 0)
-        out_path: Path = file_path.parent / (file_path.name + ANNOTATED_SUFFIX)
-        out_path.write_bytes(encode_output(annotated_utf8, enc))
+        stubbed, count = stubbing.stub_source(utf8_bytes, language, placeholder.get(language))
+        rel_path: Path = file_path.resolve().relative_to(root)
+        if validate:
+            errors: list[str] = stubbing.syntax_errors(stubbed, language)
+            if errors and stubbing.syntax_errors(utf8_bytes, language):
+                errors = ["source file already has syntax errors"]
+            problems.extend(stubbing.StubProblem(rel_path.as_posix(), e) for e in errors)
+            wrote_go = wrote_go or language == "go"
+        if output is None:
+            click.echo(f"==> {rel_path.as_posix()} <==")
+            click.echo(stubbed.decode("utf-8"), nl=not stubbed.endswith(b"\n"))
+        else:
+            out_path: Path = output / rel_path
+            out_path.parent.mkdir(parents=True, exist_ok=True)
+            out_path.write_bytes(encode_output(stubbed, enc))
         file_count += 1
-        total_ids += next_id
-    click.echo(f"Annotated {file_count} file(s), {total_ids} identifier(s).")
+        body_count += count
+    click.echo(f"Stubbed {file_count} file(s), {body_count} function(s).", err=True)
+    if not validate:
+        return
+    if wrote_go:
+        if output is None:
+            click.echo("Warning: Go stubs are only type-checked with --output.", err=True)
+        else:
+            type_problems, notes = stubbing.go_type_check(output)
+            problems.extend(type_problems)
+            for note in notes:
+                click.echo(f"Warning: {note}", err=True)
+    if problems:
+        failed: int = len({p.path for p in problems})
+        click.echo(f"Stub validation failed for {failed} file(s):", err=True)
+        for problem in problems:
+            click.echo(f"  {problem.path}: {problem.message}", err=True)
+        sys.exit(1)
+    click.echo("All stubs are valid.", err=True)
+
+
+@cli.group("daemon")
+def daemon_group() -> None:
+    """Keep a background process warm for faster commands.
+
+    While a daemon runs, other commands are handed to it over a Unix
+    socket, so they skip start-up and reuse extraction results held in
+    memory.  Set AUTOSG_NO_DAEMON=1 to run a command in-process anyway.
+    """
+    if not client.supported():
+        raise click.ClickException("the daemon needs Unix domain sockets.")
+
+
+@daemon_group.command("start")
+@click.option(
+    "--idle-timeout",
+    type=click.FloatRange(min=1),
+    default=daemon.DEFAULT_IDLE_TIMEOUT,
+    show_default=True,
+    help="Exit after this many seconds without a command.",
+)
+@click.option(
+    "--foreground",
+    is_flag=True,
+    default=False,
+    help="Run in this process instead of in the background.",
+)
+def daemon_start(idle_timeout: float, foreground: bool) -> None:
+    """Start the daemon, listening on AUTOSG_DAEMON_SOCKET or a per-user socket."""
+    try:
+        if foreground:
+            daemon.run_daemon(cli, idle_timeout)
+            return
+        if daemon.daemon_status() is not None:
+            click.echo(f"A daemon is already running on {client.socket_path()}.", err=True)
+            return
+        pid: int = daemon.start_daemon(idle_timeout)
+    except daemon.DaemonError as exc:
+        raise click.ClickException(str(exc)) from None
+    click.echo(f"Started daemon {pid} on {client.socket_path()}.", err=True)
+
+
+@daemon_group.command("stop")
+def daemon_stop() -> None:
+    """Stop the daemon once its current command is done."""
+    try:
+        stopped: bool = daemon.stop_daemon()
+    except daemon.DaemonError as exc:
+        raise click.ClickException(str(exc)) from None
+    click.echo("Stopped the daemon." if stopped else "No daemon is running.", err=True)
+
+
+@daemon_group.command("status")
+def daemon_status() -> None:
+    """Show whether the daemon runs, and exit 1 if not."""
+    try:
+        status: dict[str, Any] | None = daemon.daemon_status()
+    except daemon.DaemonError as exc:
+        raise click.ClickException(str(exc)) from None
+    if status is None:
+        click.echo("No daemon is running.")
+        sys.exit(1)
+    click.echo(
+        f"Daemon {status['pid']} on {client.socket_path()}: up "
+        f"{time.time() - status['started']:.0f}s, {status['commands']} command(s) run, "
+        f"{status['cached']} result(s) in memory",
+    )
+
+
+@daemon_group.command("profile")
+@click.option(
+    "--seconds",
+    type=click.IntRange(1, tracing.MAX_PROFILE_SECONDS),
+    default=30,
+    show_default=True,
+    help="How long to sample for.",
+)
+@click.option(
+    "-o", "--output",
+    type=click.Path(dir_okay=False, path_type=Path),
+    default=Path("daemon.pprof"),
+    show_default=True,
+    help="Where to write the profile.",
+)
+def daemon_profile(seconds: int, output: Path) -> None:
+    """Write a pprof profile of the commands the daemon runs over the next --seconds."""
+    try:
+        profile: bytes | None = daemon.profile_daemon(seconds)
+    except daemon.DaemonError as exc:
+        raise click.ClickException(str(exc)) from None
+    if profile is None:
+        click.echo("No daemon is running.", err=True)
+        sys.exit(1)
+    output.write_bytes(profile)
+    click.echo(f"Wrote {output}; view it with go tool pprof -http=: {output}", err=True)
+
+
+@cli.command("serve")
+@click.option(
+    "--addr",
+    default="127.0.0.1:8080",
+    show_default=True,
+    help="Address to listen on; use :PORT for all interfaces.",
+)
+@click.option(
+    "--root",
+    type=click.Path(exists=True, file_okay=False, path_type=Path),
+    default=Path("."),
+    show_default=True,
+    help="Directory that POST /analyze paths are resolved against.",
+)
+@click.option(
+    "--max-upload",
+    type=click.IntRange(min=1),
+    default=serving.DEFAULT_MAX_UPLOAD,
+    show_default=True,
+    help="Largest accepted request body, in bytes.",
+)
+@click.option(
+    "--max-unpacked",
+    type=click.IntRange(min=1),
+    default=serving.DEFAULT_MAX_UNPACKED,
+    show_default=True,
+    help="Most bytes an uploaded archive may unpack to.",
+)
+@click.option(
+    "--max-concurrent",
+    type=click.IntRange(min=1),
+    default=serving.DEFAULT_MAX_CONCURRENT,
+    show_default=True,
+    help="Analyses run at once; further requests wait in a queue.",
+)
+@click.option(
+    "--grpc-addr",
+    default=None,
+    help="Also serve the gRPC API of autosg.proto on this address, e.g. :50051.",
+)
+@click.option(
+    "--no-http",
+    is_flag=True,
+    default=False,
+    help="Serve only the gRPC API (requires --grpc-addr).",
+)
+@no_cache_option
+def serve(
+    addr: str, root: Path, max_upload: int, max_unpacked: int, max_concurrent: int,
+    grpc_addr: str | None, no_http: bool, no_cache: bool,
+) -> None:
+    """Serve analyses over HTTP as a JSON API, and optionally over gRPC.
+
+    POST /analyze with {"path": ...} or an uploaded archive, then query
+    GET /entities and GET /edges, or browse them at /.  GET /health and
+    GET /metrics (in Prometheus format) are for monitoring.  The gRPC
+    service streams entities and edges instead; its definition is
+    autosg/autosg.proto.
+    """
+    if no_http and grpc_addr is None:
+        raise click.UsageError("--no-http requires --grpc-addr.")
+    try:
+        host, port = serving.parse_addr(addr)
+    except ValueError as exc:
+        raise click.BadParameter(str(exc), param_hint="--addr") from None
+    grpc_host_port: tuple[str, int] | None = None
+    if grpc_addr is not None:
+        try:
+            grpc_host_port = serving.parse_addr(grpc_addr)
+        except ValueError as exc:
+            raise click.BadParameter(str(exc), param_hint="--grpc-addr") from None
+        grpc_host, grpc_port = grpc_host_port
+        click.echo(f"Serving {root.resolve()} over gRPC on {grpc_host or '[::]'}:{grpc_port}")
+    if not no_http:
+        click.echo(
+            f"Serving {root.resolve()} on http://{host or '0.0.0.0'}:{port} (Ctrl+C to stop)",
+        )
+    serving.serve(
+        None if no_http else (host, port), root, max_upload, max_concurrent,
+        cache=not no_cache, grpc_addr=grpc_host_port, max_unpacked=max_unpacked,
+    )
+
+
+@cli.command("lsp")
+@filter_options
+@click.option(
+    "--edges",
+    type=click.Choice(EDGE_KINDS),
+    multiple=True,
+    default=("calls", "imports"),
+    show_default=True,
+    help="Edge kinds that count as dependencies in code lenses (repeatable).",
+)
+@jobs_option
+@no_cache_option
+def lsp(
+    include: tuple[str, ...], exclude: tuple[str, ...], no_gitignore: bool, follow_symlinks: bool,
+    languages: frozenset[str], edges: tuple[str, ...], jobs: int, no_cache: bool,
+) -> None:
+    """Run a language server on stdin and stdout for editor integration.
+
+    Serves the workspace folder's entities as document outlines and
+    workspace symbols, with a code lens on each file listing its
+    dependencies.  The workspace is analyzed again whenever a file is saved.
+    """
+    options: Options = Options(
+        gitignore=not no_gitignore, follow_symlinks=follow_symlinks, include=include,
+        exclude=exclude, languages=languages, cache=not no_cache, edges=frozenset(edges), jobs=jobs,
+    )
+    sys.exit(languageserver.serve_stdio(sys.stdin.buffer, sys.stdout.buffer, options))
 
 
 @cli.command("llm-resolve")
@@ -0,0 +1,843 @@
+"""The core pipeline: walk paths, parse files, and extract entities.
+
+This module is the library entry point; the CLI is a thin layer over it::
+
+    import autosg
+
+    result = autosg.analyze("examples/go")
+    for entity in result.entities:
+        print(entity.kind, entity.name)
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import logging
+import os
+import sqlite3
+import time
+from collections.abc import Callable, Iterable, Iterator
+from concurrent.futures import ProcessPoolExecutor
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Any
+
+from tree_sitter import Tree
+
+from .annotating import FileEncoding, long_path, read_source_utf8, sniff_utf16
+from .caching import DEFAULT_CACHE_DIR, cache_get, cache_put, content_hash, open_cache_db
+from .cloning import DEFAULT_THRESHOLD
+from .components import component_entities, component_language
+from .constraints import BuildTags, c_selected, go_constraint, go_selected
+from .coverage import Coverage
+from .directives import annotate
+from .embedding import embedded_entities, region_digest, template_entities, template_language
+from .extracting import (
+    Edge, Entity, ParseError, assign_uids, extract_entities, file_attrs, file_entity,
+    syntax_errors,
+)
+from .features import feature_digest, register_features, registered_features
+from .idl import idl_entities, idl_language
+from .infrastructure import (
+    dockerfile_entities, infrastructure_language, kubernetes_entities, terraform_entities,
+)
+from .licensing import license_attrs, read_header
+from .linking import Linker
+from .manifests import MANIFESTS, is_manifest, manifest_entities
+from .notebooks import notebook_entities, notebook_language
+from .ownership import Owners
+from .overriding import QueryFile, cache_digest, register_queries, registered_queries
+from .parsing import detect_language, parse_tree, register_filetypes, registered_filetypes
+from .plugins import (
+    Plugin,
+    PluginError,
+    plugin_for,
+    register_plugin,
+    registered_plugins,
+    run_plugin,
+)
+from .spilling import Spool
+from .tracing import phase, record
+from .sql import sql_entities
+from .walking import WalkOptions, resolve_source_paths
+from .zig import zig_entities, zig_language
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+
+DEFAULT_MAX_FILE_SIZE: int = 4 << 20
+
+
+@dataclass(frozen=True)
+class FileLimits:
+    """Which files are skipped as too large, not worth parsing, or not built."""
+
+    max_file_size: int | None = DEFAULT_MAX_FILE_SIZE  # bytes; None for no limit
+    skip_minified: bool = True  # skip files whose lines average over MINIFIED_LINE_LENGTH
+    # Skip Go files, and blank C and C++ branches, a build with these tags
+    # leaves out (see constraints.py); None keeps every file and branch.
+    build_tags: BuildTags | None = None
+
+
+@dataclass
+class Options:
+    """Settings that control which files are analyzed and how."""
+
+    recursive: bool = True  # recurse into directories
+    gitignore: bool = True  # skip files ignored by .gitignore
+    include: tuple[str, ...] = ()  # only analyze files matching these globs
+    exclude: tuple[str, ...] = ()  # skip files and directories matching these globs
+    languages: frozenset[str] = frozenset()  # only analyze these languages (default: all)
+    follow_symlinks: bool = False  # walk symbolic links to directories (see walking)
+    cache: bool = False  # reuse extraction results for unchanged files
+    cache_dir: Path = DEFAULT_CACHE_DIR
+    edges: frozenset[str] = frozenset()  # edge kinds to resolve, e.g. {"calls"}
+    jobs: int = 1  # worker processes used for parsing
+    # Only output files under these paths; files elsewhere are still analyzed
+    # so references into them resolve (e.g. imports of a shared library).
+    scope: tuple[Path, ...] = ()
+    owners: Owners | None = None  # tag files and entities with their "owner" attr
+    coverage: Coverage | None = None  # give entities their "coverage" attr
+    # How files under these resolved paths are named in output instead, e.g.
+    # an unpacked archive by the archive's name (see fetching.fetch_inputs).
+    labels: dict[Path, str] = field(default_factory=dict)
+    # Bytes of references and edges kept in memory before they spill to
+    # temporary files (default: no limit).
+    max_memory: int | None = None
+    limits: FileLimits = FileLimits()
+    # How alike two functions must be for a clone-of edge (see cloning).
+    clone_threshold: float = DEFAULT_THRESHOLD
+    # Edges less certain than this are dropped (see linking, Provenance).
+    min_confidence: float = 0.0
+    # (i, n): only analyze every n-th file, starting from the i-th (1-based),
+    # for one of n parallel jobs whose outputs are merged (see sharding).
+    shard: tuple[int, int] | None = None
+
+    def walk_options(self) -> WalkOptions:
+        """The subset of options that controls directory traversal."""
+        return WalkOptions(
+            self.recursive, self.gitignore, self.include, self.exclude, self.languages,
+            self.follow_symlinks,
+        )
+
+
+@dataclass
+class FileResult:
+    """Everything extracted from a single source file."""
+
+    path: str
+    language: str
+    entities: list[Entity] = field(default_factory=list)
+    references: list[Edge] = field(default_factory=list)  # unresolved
+    root: str | None = None  # the analyzed path the file was found under, if several
+    errors: list[ParseError] = field(default_factory=list)
+
+    def to_dict(self) -> dict[str, Any]:
+        """File metadata only; entities are emitted separately."""
+        data: dict[str, Any] = {"path": self.path, "language": self.language}
+        if self.root is not None:
+            data["root"] = self.root
+        return data
+
+
+@dataclass
+class Result:
+    """The outcome of analyzing one or more paths."""
+
+    files: list[FileResult] = field(default_factory=list)
+    edges: list[Edge] = field(default_factory=list)
+
+    @property
+    def entities(self) -> list[Entity]:
+        """All entities, in file order."""
+        return [e for f in self.files for e in f.entities]
+
+    @property
+    def errors(self) -> list[ParseError]:
+        """Parse errors of all files, in file order."""
+        return [e for f in self.files for e in f.errors]
+
+    def to_dict(self) -> dict[str, Any]:
+        """JSON-serializable form of the whole result."""
+        return {
+            "files": [f.to_dict() for f in self.files],
+            "entities": [dataclasses.asdict(e) for e in self.entities],
+            "edges": [dataclasses.asdict(e) for e in self.edges],
+            "errors": [dataclasses.asdict(e) for e in self.errors],
+        }
+
+
+# ---------------------------------------------------------------------------
+# Per-file analysis
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class _Outcome:
+    """What processing one file produced, before any side effects."""
+
+    result: FileResult | None
+    warning: str | None = None  # why the file was skipped
+    digest: str | None = None  # set on a cache miss: store result under this hash
+    reason: str | None = None  # the skip reason as a short code, for structured logs
+    cached: bool = False  # served from the cache
+    path: str = ""
+    seconds: float = 0.0  # time spent reading and extracting
+
+
+def log_fields(event: str, **fields: Any) -> dict[str, Any]:
+    """``extra`` for a log record that structured log output can pick apart.
+
+    The fields land on the record as ``record.fields``, with the event name
+    under ``event``: ``start``, ``file``, ``parse-error``, ``skipped``, or
+    ``done``.
+    """
+    return {"fields": {"event": event, **fields}}
+
+
+# Binary files are told by a NUL byte near the start, as git tells them.
+_BINARY_PROBE: int = 8000
+_WIDE_BOMS: tuple[bytes, ...] = (b"\xff\xfe", b"\xfe\xff")  # UTF-16 and UTF-32 have NULs
+
+# Files over this size whose lines average more bytes than MINIFIED_LINE_LENGTH
+# are taken for minified bundles or data.
+_MINIFIED_MIN_SIZE: int = 16 << 10
+MINIFIED_LINE_LENGTH: int = 1000
+
+
+def _check_limits(file_path: Path, shown: str, limits: FileLimits) -> _Outcome | None:
+    """Why *file_path* should be skipped before it is parsed, if it should."""
+    native: Path = long_path(file_path)
+    try:
+        size: int = native.stat().st_size
+    except OSError:
+        return None  # reported when the file is read
+    if limits.max_file_size is not None and size > limits.max_file_size:
+        return _Outcome(
+            None, f"{shown} is {size:,} bytes, over the {limits.max_file_size:,}-byte limit, "
+            "skipping.", reason="too-large",
+        )
+    with open(native, "rb") as f:
+        head: bytes = f.read(_BINARY_PROBE)
+        if b"\0" in head and not head.startswith(_WIDE_BOMS) and sniff_utf16(head) is None:
+            return _Outcome(None, f"{shown} is a binary file, skipping.", reason="binary")
+        if not limits.skip_minified or size < _MINIFIED_MIN_SIZE:
+            return None
+        lines: int = head.count(b"\n")
+        for chunk in iter(lambda: f.read(1 << 16), b""):
+            lines += chunk.count(b"\n")
+    if size / (lines + 1) > MINIFIED_LINE_LENGTH:
+        return _Outcome(
+            None, f"{shown} looks minified (lines average over {MINIFIED_LINE_LENGTH:,} "
+            "bytes), skipping.", reason="minified",
+        )
+    return None
+
+
+def _process(
+    file_path: Path, cache: sqlite3.Connection | None, label: str | None = None,
+    limits: FileLimits = FileLimits(),
+) -> _Outcome:
+    """Read and extract one file, consulting but never writing the cache.
+
+    The file is named *label* in the result and messages, if given.  Files
+    *limits* rule out are skipped unparsed.
+    """
+    started: float = time.perf_counter()
+    rel_path: str = label or _label(file_path)
+    shown: str = label or str(file_path)
+    with phase("extract") as labels:
+        outcome: _Outcome = _check_limits(file_path, shown, limits) or _extract(
+            file_path, rel_path, shown, cache, limits.build_tags,
+        )
+        labels.update(_trace_labels(outcome))
+        if (
+            outcome.result is not None and not outcome.cached  # cached results are annotated
+            and notebook_language(file_path) is None  # notebooks are, cell by cell
+        ):
+            with phase("annotate"):
+                outcome = _annotated(outcome, file_path, shown)
+        if outcome.result is not None:  # cached file entities do not keep them
+            outcome.result.entities[0].attrs.update(license_attrs(read_header(file_path)))
+    outcome.path = rel_path
+    outcome.seconds = time.perf_counter() - started
+    return outcome
+
+
+def _trace_labels(outcome: _Outcome) -> dict[str, str]:
+    """How --trace labels the time spent on *outcome*'s file."""
+    if outcome.result is None:
+        return {"language": "skipped"}
+    cache: str = "hit" if outcome.cached else "miss" if outcome.digest is not None else "none"
+    return {"language": outcome.result.language, "cache": cache}
+
+
+def _annotated(outcome: _Outcome, file_path: Path, shown: str) -> _Outcome:
+    """*outcome* with the file's ``autosg:`` directives applied."""
+    assert outcome.result is not None
+    source: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if source is None:
+        return outcome
+    annotated: tuple[list[Entity], list[Edge]] | None = annotate(
+        outcome.result.entities, outcome.result.references, source[0],
+    )
+    if annotated is None:
+        return _Outcome(None, f"{shown} is marked autosg:ignore, skipping.", reason="ignored")
+    outcome.result.entities, outcome.result.references = annotated
+    return outcome
+
+
+def _extract(
+    file_path: Path, rel_path: str, shown: str, cache: sqlite3.Connection | None,
+    build_tags: BuildTags | None = None,
+) -> _Outcome:
+    plugin: Plugin | None = plugin_for(file_path)
+    if plugin is not None:
+        return _process_with_plugin(file_path, rel_path, shown, plugin)
+    if is_manifest(file_path):
+        return _process_manifest(file_path, rel_path, shown)
+    if idl_language(file_path) is not None:
+        return _process_idl(file_path, rel_path, shown)
+    if zig_language(file_path) is not None:
+        return _process_zig(file_path, rel_path, shown)
+    if component_language(file_path) is not None:
+        return _process_component(file_path, rel_path, shown)
+    if template_language(file_path) is not None:
+        return _process_template(file_path, rel_path, shown)
+    if notebook_language(file_path) is not None:
+        return _process_notebook(file_path, rel_path, shown)
+    language: str | None = infrastructure_language(file_path)
+    if language is not None:
+        return _process_infrastructure(file_path, rel_path, shown, language)
+    language = detect_language(file_path)
+    if language == "sql":
+        return _process_sql(file_path, rel_path, shown)
+    if language is None:
+        return _Outcome(
+            None, f"unsupported file extension {file_path.suffix!r} for {shown}, skipping.",
+            reason="unsupported-extension",
+        )
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    utf8_bytes, _enc = result
+    if build_tags is not None and language == "go" and not go_selected(
+        rel_path, utf8_bytes, build_tags,
+    ):
+        return _Outcome(
+            None, f"{shown} is not part of the build --build-tags selects, skipping.",
+            reason="not-built",
+        )
+    if build_tags is not None and language in ("c", "cpp"):
+        utf8_bytes = c_selected(utf8_bytes, build_tags)
+    if language == "yaml":
+        objects: list[Entity] | None = kubernetes_entities(utf8_bytes, rel_path)
+        if objects is not None:
+            return _Outcome(FileResult(rel_path, language, objects))
+    digest: str | None = None
+    if cache is not None:
+        digest = feature_digest(cache_digest(content_hash(utf8_bytes), language), language)
+        digest = region_digest(digest, language, rel_path)
+        cached: dict[str, Any] | None = cache_get(cache, digest, language)
+        if cached is not None:
+            return _Outcome(_from_cached(cached, rel_path, language), cached=True)
+    try:
+        tree: Tree = parse_tree(utf8_bytes, language)
+        entities, references, _next_id = extract_entities(utf8_bytes, language, rel_path, 0, tree)
+        embedded, embedded_references, embedded_errors = embedded_entities(
+            utf8_bytes, language, rel_path, len(entities), 0,
+        )
+        constraint: str | None = go_constraint(utf8_bytes) if language == "go" else None
+        if constraint is not None:
+            entities[0].attrs["build"] = constraint
+    except Exception as exc:  # keep the file, with what can be said without its tree
+        entity: Entity = file_entity(utf8_bytes, language, rel_path, 0)
+        assign_uids([entity])
+        error: ParseError = ParseError(
+            rel_path, "extraction", f"extraction failed: {type(exc).__name__}: {exc}",
+            1, 1, entity.end_row, entity.end_col,
+        )
+        return _Outcome(FileResult(rel_path, language, [entity], errors=[error]))
+    if embedded:
+        entities.extend(embedded)
+        references.extend(embedded_references)
+        assign_uids(entities)
+    errors: list[ParseError] = [*syntax_errors(tree, utf8_bytes, rel_path), *embedded_errors]
+    return _Outcome(
+        FileResult(rel_path, language, entities, references, errors=errors), digest=digest,
+    )
+
+
+def _process_with_plugin(
+    file_path: Path, rel_path: str, shown: str, plugin: Plugin,
+) -> _Outcome:
+    """Extract one file with an external plugin.  Plugin output is not cached."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    try:
+        entities, references = run_plugin(plugin, rel_path, result[0])
+    except PluginError as exc:
+        return _Outcome(
+            None, f"plugin {plugin.name!r} failed on {shown}: {exc}, skipping.",
+            reason="plugin-failed",
+        )
+    return _Outcome(FileResult(rel_path, plugin.name, entities, references))
+
+
+def _process_manifest(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one package manifest.  Manifests are cheap to read, so not cached."""
+    language: str = MANIFESTS[file_path.name][1]
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    try:
+        entities: list[Entity] = manifest_entities(result[0], rel_path)
+    except ValueError as exc:
+        entity: Entity = file_entity(result[0], language, rel_path, 0)
+        assign_uids([entity])
+        error: ParseError = ParseError(
+            rel_path, "syntax", f"malformed manifest: {exc}",
+            1, 1, entity.end_row, entity.end_col,
+        )
+        return _Outcome(FileResult(rel_path, language, [entity], errors=[error]))
+    return _Outcome(FileResult(rel_path, language, entities))
+
+
+def _process_idl(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one Protobuf, Thrift, or GraphQL schema.  Not cached, like manifests."""
+    language: str = idl_language(file_path)  # type: ignore[assignment]
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    entities, errors = idl_entities(result[0], language, rel_path)
+    return _Outcome(FileResult(rel_path, language, entities, errors=errors))
+
+
+def _process_zig(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one Zig file token by token.  Not cached, like schemas."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    entities, errors = zig_entities(result[0], rel_path)
+    return _Outcome(FileResult(rel_path, "zig", entities, errors=errors))
+
+
+def _process_component(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one Vue or Svelte file, section by section.  Not cached, like schemas."""
+    language: str = component_language(file_path)  # type: ignore[assignment]
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    entities, references, errors = component_entities(result[0], language, rel_path)
+    return _Outcome(FileResult(rel_path, language, entities, references, errors=errors))
+
+
+def _process_template(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one Go template, action by action.  Not cached, like schemas."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    entities, references, errors = template_entities(result[0], rel_path)
+    return _Outcome(FileResult(rel_path, "gotemplate", entities, references, errors=errors))
+
+
+def _process_notebook(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one Jupyter notebook, cell by cell.  Not cached, like schemas."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    try:
+        entities, references, errors = notebook_entities(result[0], rel_path)
+    except Exception as exc:  # as for other Python, keep the file
+        entity: Entity = file_entity(result[0], "jupyter", rel_path, 0)
+        assign_uids([entity])
+        error: ParseError = ParseError(
+            rel_path, "extraction", f"extraction failed: {type(exc).__name__}: {exc}",
+            1, 1, entity.end_row, entity.end_col,
+        )
+        return _Outcome(FileResult(rel_path, "jupyter", [entity], errors=[error]))
+    return _Outcome(FileResult(rel_path, "jupyter", entities, references, errors=errors))
+
+
+def _process_sql(file_path: Path, rel_path: str, shown: str) -> _Outcome:
+    """Read one SQL file statement by statement.  Not cached, like schemas."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    entities, references, errors = sql_entities(result[0], rel_path)
+    return _Outcome(FileResult(rel_path, "sql", entities, references, errors=errors))
+
+
+def _process_infrastructure(
+    file_path: Path, rel_path: str, shown: str, language: str,
+) -> _Outcome:
+    """Read one Dockerfile or Terraform file.  Not cached, like manifests."""
+    result: tuple[bytes, FileEncoding] | None = read_source_utf8(file_path)
+    if result is None:
+        return _Outcome(
+            None, f"unsupported encoding for {shown}, skipping.",
+            reason="unsupported-encoding",
+        )
+    if language == "dockerfile":
+        return _Outcome(FileResult(rel_path, language, dockerfile_entities(result[0], rel_path)))
+    return _Outcome(FileResult(rel_path, language, terraform_entities(result[0], rel_path)))
+
+
+def _settle(outcome: _Outcome, cache: sqlite3.Connection | None) -> FileResult | None:
+    """Apply an outcome's side effects: log it and fill the cache."""
+    if outcome.warning is not None:
+        # Files left out of the build or marked ignored are skipped by request.
+        log: Callable[..., None] = (
+            logger.info if outcome.reason in ("not-built", "ignored") else logger.warning
+        )
+        log("%s", outcome.warning, extra=log_fields(
+            "skipped", path=outcome.path, reason=outcome.reason,
+            seconds=round(outcome.seconds, 6),
+        ))
+    elif outcome.result is not None:
+        errors: list[ParseError] = outcome.result.errors
+        if errors:
+            logger.warning(
+                "%s:%d:%d: %s%s; %s.", outcome.path, errors[0].row, errors[0].col,
+                errors[0].message, f" (and {len(errors) - 1} more)" if len(errors) > 1 else "",
+                "kept the file entity only" if len(outcome.result.entities) == 1
+                else "extracted what parsed",
+                extra=log_fields(
+                    "parse-error", path=outcome.path,
+                    errors=[dataclasses.asdict(e) for e in errors],
+                ),
+            )
+        logger.info(
+            "analyzed %s in %.1f ms", outcome.path, outcome.seconds * 1000,
+            extra=log_fields(
+                "file", path=outcome.path, language=outcome.result.language,
+                entities=len(outcome.result.entities), errors=len(errors),
+                cached=outcome.cached, seconds=round(outcome.seconds, 6),
+            ),
+        )
+    if outcome.result is not None and outcome.digest is not None and cache is not None:
+        with phase("cache", language=outcome.result.language):
+            cache_put(cache, outcome.digest, outcome.result.language, _to_cached(outcome.result))
+    return outcome.result
+
+
+def analyze_file(
+    file_path: Path, cache: sqlite3.Connection | None = None,
+) -> FileResult | None:
+    """Extract entities from one file, numbering them from 0.
+
+    When *cache* is given, unchanged content is served from it instead of
+    being re-parsed.  Returns *None* (after logging a warning) if the file
+    cannot be analyzed.
+    """
+    return _settle(_process(file_path, cache), cache)
+
+
+# Worker processes get their own read-only view of the cache; only the
+# parent process writes to it.
+_worker_cache: sqlite3.Connection | None = None
+_worker_limits: FileLimits = FileLimits()
+
+
+def _worker_init(
+    cache_dir: Path | None, plugins: tuple[Plugin, ...], queries: tuple[QueryFile, ...],
+    features: dict[str, dict[str, bool]], filetypes: dict[str, str], limits: FileLimits,
+) -> None:
+    global _worker_cache, _worker_limits
+    _worker_limits = limits
+    if cache_dir is not None:
+        _worker_cache = open_cache_db(cache_dir)
+    for plugin in plugins:  # not inherited unless workers are forked
+        register_plugin(plugin)
+    for query_file in queries:
+        register_queries(query_file)
+    register_features(features)
+    register_filetypes(filetypes)
+
+
+def _worker_process(file_path: Path, label: str | None) -> _Outcome:
+    return _process(file_path, _worker_cache, label, _worker_limits)
+
+
+def _to_cached(file_result: FileResult) -> dict[str, Any]:
+    """Serialize a freshly extracted (0-based) file result for the cache.
+
+    The file entity's location-dependent attrs are left out; they are
+    computed afresh for wherever the entry is reused.
+    """
+    entities: list[dict[str, Any]] = [dataclasses.asdict(e) for e in file_result.entities]
+    if entities:
+        located: dict[str, Any] = file_attrs(file_result.language, file_result.path)
+        entities[0]["attrs"] = {
+            k: v for k, v in entities[0]["attrs"].items() if k not in located
+        }
+    return {
+        "entities": entities,
+        "references": [dataclasses.asdict(r) for r in file_result.references],
+        "errors": [dataclasses.asdict(e) for e in file_result.errors],
+    }
+
+
+def _from_cached(data: dict[str, Any], rel_path: str, language: str) -> FileResult:
+    """Rebuild a file result from the cache, relocated to *rel_path*."""
+    entities: list[Entity] = [Entity(**e) for e in data["entities"]]
+    for entity in entities:
+        entity.path = rel_path
+    entities[0].name = Path(rel_path).name
+    entities[0].attrs = {**entities[0].attrs, **file_attrs(language, rel_path)}
+    assign_uids(entities)  # they hash the path
+    references: list[Edge] = [Edge(**r) for r in data["references"]]
+    errors: list[ParseError] = [ParseError(**{**e, "path": rel_path}) for e in data["errors"]]
+    return FileResult(rel_path, language, entities, references, errors=errors)
+
+
+def _relabeled(path: Path, labels: dict[Path, str]) -> str | None:
+    """How *path* is named in output if it is under one of *labels*' paths."""
+    resolved: Path = path.resolve()
+    for root, label in labels.items():
+        if resolved == root:
+            return label
+        if resolved.is_relative_to(root):
+            return f"{label}/{resolved.relative_to(root).as_posix()}"
+    return None
+
+
+def _label(path: Path) -> str:
+    """How a root or scope path is written in output: relative, with slashes."""
+    return Path(os.path.relpath(path)).as_posix()
+
+
+def _under(path: str, prefixes: list[str]) -> str | None:
+    """The longest of *prefixes* that is *path* or one of its directories."""
+    posix: str = Path(path).as_posix()
+    found: list[str] = [
+        p for p in prefixes if p == "." or posix == p or posix.startswith(p.rstrip("/") + "/")
+    ]
+    return max(found, key=len) if found else None
+
+
+def rebase(file_result: FileResult, offset: int) -> FileResult:
+    """Shift a file's local entity ids so they start at *offset*."""
+    for entity in file_result.entities:
+        entity.id += offset
+        if entity.parent is not None:
+            entity.parent += offset
+    for ref in file_result.references:
+        ref.source += offset
+        if ref.target is not None:  # resolved by a plugin
+            ref.target += offset
+    return file_result
+
+
+# ---------------------------------------------------------------------------
+# Public API
+# ---------------------------------------------------------------------------
+
+
+class Analysis:
+    """An analysis run that streams its results.
+
+    Iterating yields one :class:`FileResult` per file as it is parsed.
+    Edges need every file before they can be resolved, so :attr:`edges`
+    is only available once iteration has finished.  With
+    ``options.max_memory``, references and edges beyond it wait in
+    temporary files instead of memory.
+
+    With several paths, each file records the one it was found under as
+    its ``root`` (and the ``root`` attr of its file entity).  With
+    ``options.scope``, files outside the scope are analyzed but not
+    yielded, and only edges between yielded entities are kept.  With
+    ``options.owners``, every entity of an owned file gets an ``owner`` attr,
+    and with ``options.coverage``, entities of covered files a ``coverage`` attr.
+    Files under a path in ``options.labels`` are named after its label.
+    With ``options.cache``, :attr:`cache_hits` and :attr:`cache_misses`
+    count the files read from the cache and the files extracted afresh.
+    With ``options.shard``, only the shard's files are analyzed and no
+    edges are resolved: sharding.MergedAnalysis resolves them across
+    shards, putting files back in order by :attr:`positions`, which maps
+    each file's path to its index among all files.
+    """
+
+    def __init__(self, paths: Iterable[str | os.PathLike[str]], options: Options) -> None:
+        self.roots: list[Path] = [Path(p) for p in paths]
+        self.options: Options = options
+        self._edges: Spool[Edge] | None = None
+        self.cache_hits: int = 0
+        self.cache_misses: int = 0
+        self.positions: dict[str, int] = {}
+        for root in self.roots:
+            if not root.exists():
+                raise FileNotFoundError(f"No such file or directory: {root}")
+        labels: list[str] = [_label(root) for root in self.roots]
+        for scope in options.scope:
+            if _under(_label(scope), labels) is None:
+                raise ValueError(f"scope {scope} is not under any analyzed path")
+
+    def __iter__(self) -> Iterator[FileResult]:
+        started: float = time.perf_counter()
+        linker: Linker = Linker(
+            self.options.edges, self.options.max_memory, self.options.clone_threshold,
+            self.options.min_confidence,
+        )
+        cache: sqlite3.Connection | None = None
+        if self.options.cache:
+            cache = open_cache_db(self.options.cache_dir)
+        pool: ProcessPoolExecutor | None = None
+        try:
+            with phase("walk"):
+                file_paths: list[Path] = list(resolve_source_paths(
+                    self.roots, self.options.walk_options(),
+                ))
+            indexes: list[int] = list(range(len(file_paths)))
+            if self.options.shard is not None:
+                shard, count = self.options.shard
+                indexes = indexes[shard - 1::count]
+                file_paths = [file_paths[i] for i in indexes]
+            logger.info(
+                "analyzing %d file(s)", len(file_paths),
+                extra=log_fields("start", files=len(file_paths)),
+            )
+            labels: list[str | None] = [
+                _relabeled(p, self.options.labels) if self.options.labels else None
+                for p in file_paths
+            ]
+            outcomes: Iterable[_Outcome]
+            if self.options.jobs > 1:
+                pool = ProcessPoolExecutor(
+                    self.options.jobs,
+                    initializer=_worker_init,
+                    initargs=(
+                        self.options.cache_dir if cache is not None else None,
+                        registered_plugins(),
+                        registered_queries(),
+                        registered_features(),
+                        registered_filetypes(),
+                        self.options.limits,
+                    ),
+                )
+                # map() preserves input order, so output stays deterministic.
+                outcomes = pool.map(_worker_process, file_paths, labels, chunksize=8)
+            else:
+                outcomes = (
+                    _process(p, cache, label, self.options.limits)
+                    for p, label in zip(file_paths, labels)
+                )
+            roots: list[str] = [
+                self.options.labels.get(root.resolve()) or _label(root) for root in self.roots
+            ]
+            scopes: list[str] = [_label(scope) for scope in self.options.scope]
+            shown: set[int] = set()
+            next_id: int = 0
+            analyzed: int = 0
+            for index, outcome in zip(indexes, outcomes):
+                if pool is not None:  # out of the sampler's sight
+                    record("extract", outcome.seconds, **_trace_labels(outcome))
+                file_result: FileResult | None = _settle(outcome, cache)
+                if file_result is None:
+                    continue
+                if self.options.shard is not None:
+                    self.positions[file_result.path] = index
+                analyzed += 1
+                if outcome.cached:
+                    self.cache_hits += 1
+                elif outcome.digest is not None:
+                    self.cache_misses += 1
+                rebase(file_result, next_id)
+                next_id += len(file_result.entities)
+                if len(roots) > 1:
+                    file_result.root = _under(file_result.path, roots)
+                    file_result.entities[0].attrs["root"] = file_result.root
+                owner: str | None = (
+                    self.options.owners.owner(file_result.path)
+                    if self.options.owners is not None else None
+                )
+                if owner is not None:
+                    for entity in file_result.entities:
+                        entity.attrs["owner"] = owner
+                if self.options.coverage is not None:
+                    self.options.coverage.annotate(file_result.path, file_result.entities)
+                if self.options.shard is None:
+                    with phase("link", language=file_result.language):
+                        linker.add(file_result.entities, file_result.references)
+                if scopes and _under(file_result.path, scopes) is None:
+                    continue
+                shown.update(e.id for e in file_result.entities)
+                yield file_result
+        finally:
+            if pool is not None:
+                pool.shutdown(cancel_futures=True)
+            if cache is not None:
+                cache.commit()
+                cache.close()
+        with phase("resolve"):
+            self._edges = linker.resolve()
+        if self.options.scope:
+            edges: Spool[Edge] = Spool(self._edges.max_memory)
+            edges.extend(
+                e for e in self._edges
+                if e.source in shown and (e.target is None or e.target in shown)
+            )
+            self._edges = edges
+        seconds: float = time.perf_counter() - started
+        logger.info(
+            "analyzed %d of %d file(s) in %.2f s", analyzed, len(file_paths), seconds,
+            extra=log_fields(
+                "done", files=analyzed, skipped=len(file_paths) - analyzed,
+                edges=len(self._edges), seconds=round(seconds, 6),
+            ),
+        )
+
+    @property
+    def edges(self) -> Spool[Edge]:
+        """Resolved edges; raises ``RuntimeError`` before iteration ends."""
+        if self._edges is None:
+            raise RuntimeError("edges are only available after iterating the analysis")
+        return self._edges
+
+
+def iter_analyze(
+    paths: Iterable[str | os.PathLike[str]], options: Options | None = None,
+) -> Analysis:
+    """Analyze files lazily, yielding one result per file as it is parsed.
+
+    Entity ids are unique across the whole run.  Missing paths raise
+    ``FileNotFoundError``; unsupported files are skipped with a warning.
+    """
+    return Analysis(paths, options or Options())
+
+
+def analyze(
+    path: str | os.PathLike[str], options: Options | None = None,
+) -> Result:
+    """Analyze a file or directory and return the full result."""
+    analysis: Analysis = iter_analyze([path], options)
+    files: list[FileResult] = list(analysis)
+    return Result(files, list(analysis.edges))
@@ -2,6 +2,7 @@
 
 from __future__ import annotations
 
+import os
 from collections import defaultdict
 from dataclasses import dataclass
 from pathlib import Path
@@ -30,16 +31,48 @@ _BOM_TABLE: list[tuple[bytes, str]] = [
     (b"\xef\xbb\xbf", "utf-8"),
 ]
 
+# BOM-less UTF-16 (as some Windows tools write it) is told by its NULs: of
+# the bytes sampled, the high byte of most ASCII characters is zero.
+_UTF16_PROBE: int = 4096
+_UTF16_NUL_SHARE: float = 0.9
+
+# Longest path Windows opens without the ``\\?\`` prefix (MAX_PATH).
+_MAX_PATH: int = 260
+
+
+def sniff_utf16(raw: bytes) -> str | None:
+    """``utf-16-le`` or ``utf-16-be`` if *raw* looks like UTF-16 without a BOM, else None."""
+    sample: bytes = raw[:_UTF16_PROBE]
+    sample = sample[: len(sample) - len(sample) % 2]
+    half: int = len(sample) // 2
+    if half < 2:
+        return None
+    even: int = sample[0::2].count(0)
+    odd: int = sample[1::2].count(0)
+    if odd >= _UTF16_NUL_SHARE * half and even <= (1 - _UTF16_NUL_SHARE) * half:
+        return "utf-16-le"
+    if even >= _UTF16_NUL_SHARE * half and odd <= (1 - _UTF16_NUL_SHARE) * half:
+        return "utf-16-be"
+    return None
+
 
 def detect_encoding(raw: bytes) -> FileEncoding | None:
     """Detect file encoding via BOM, falling back to UTF-8.
 
     Returns *None* if the encoding is unsupported (not valid UTF-8 and
-    no recognised BOM).
+    no recognised BOM).  UTF-16 without a BOM is recognised by
+    :func:`sniff_utf16`; it is valid UTF-8 too, NULs and all.
     """
     for bom, encoding in _BOM_TABLE:
         if raw.startswith(bom):
             return FileEncoding(encoding, bom)
+    wide: str | None = sniff_utf16(raw)
+    if wide is not None:
+        try:
+            raw.decode(wide)
+            return FileEncoding(wide, b"")
+        except UnicodeDecodeError:
+            pass
     # No BOM — try UTF-8
     try:
         raw.decode("utf-8")
@@ -54,7 +87,23 @@ def read_source_utf8(source_path: Path) -> tuple[bytes, FileEncoding] | None:
     The BOM is stripped from the returned bytes.  UTF-16/32 content is
     transcoded to UTF-8.  Returns *None* for unsupported encodings.
     """
-    raw: bytes = source_path.read_bytes()
+    return source_to_utf8(long_path(source_path).read_bytes())
+
+
+def long_path(path: Path) -> Path:
+    """*path* as Windows opens it even past MAX_PATH; elsewhere, *path* itself."""
+    if os.name != "nt":
+        return path
+    absolute: str = os.path.abspath(path)
+    if len(absolute) < _MAX_PATH or absolute.startswith("\\\\?\\"):
+        return path
+    if absolute.startswith("\\\\"):  # \\server\share\...
+        return Path("\\\\?\\UNC\\" + absolute[2:])
+    return Path("\\\\?\\" + absolute)
+
+
+def source_to_utf8(raw: bytes) -> tuple[bytes, FileEncoding] | None:
+    """Like :func:`read_source_utf8`, for content already in memory."""
     enc: FileEncoding | None = detect_encoding(raw)
     if enc is None:
         return None
@@ -94,7 +143,8 @@ def annotate_source(
     stay aligned.
     """
     identifiers: list[tuple[int, int, str]] = parse_identifiers(utf8_bytes, language)
-    lines: list[bytes] = utf8_bytes.splitlines(keepends=True)
+    # Split where tree-sitter counts rows; a \r stays at the end of its line.
+    lines: list[bytes] = utf8_bytes.split(b"\n")
 
     # Build {0-indexed row: [(byte_col_0indexed, text, global_id), ...]}
     by_row: dict[int, list[tuple[int, str, int]]] = defaultdict(list)
@@ -112,4 +162,4 @@ def annotate_source(
             line = line[:byte_col] + replacement + line[byte_col + len(text_bytes) :]
         lines[row_idx] = line
 
-    return b"".join(lines), current_id
+    return b"\n".join(lines), current_id
@@ -0,0 +1,86 @@
+"""Baselines of known violations, so ``check --baseline`` fails only on new ones.
+
+A baseline is a JSON file listing the findings of an earlier run by rule,
+path, and message::
+
+    {"version": 1, "findings": [
+      {"rule": "handlers-skip-database", "path": "src/handlers/user.go",
+       "message": "src/handlers must not depend on src/database (calls Query in ...)"}]}
+
+Rows and columns are left out, so findings stay known while the code
+around them moves.  A finding is known as often as the baseline lists
+it: a second, identical violation in the same file is new.
+"""
+
+from __future__ import annotations
+
+import json
+from collections import Counter
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Any
+
+from .linting import Finding
+
+BASELINE_VERSION: int = 1
+
+
+class BaselineError(Exception):
+    """Raised when a baseline file cannot be read or is malformed."""
+
+
+def _key(finding: Finding) -> tuple[str, str, str]:
+    return (finding.rule, finding.location.path, finding.message)
+
+
+def read_baseline(path: Path) -> Counter[tuple[str, str, str]]:
+    """The findings *path* lists, as (rule, path, message) counts."""
+    try:
+        data: Any = json.loads(path.read_text(encoding="utf-8"))
+    except OSError as exc:
+        raise BaselineError(f"cannot read {path}: {exc.strerror}") from None
+    except ValueError as exc:
+        raise BaselineError(f"{path}: {exc}") from None
+    if not isinstance(data, dict) or data.get("version") != BASELINE_VERSION:
+        raise BaselineError(f"{path}: not a version {BASELINE_VERSION} baseline")
+    known: Counter[tuple[str, str, str]] = Counter()
+    for i, entry in enumerate(data.get("findings", [])):
+        if not isinstance(entry, dict) or not all(
+            isinstance(entry.get(k), str) for k in ("rule", "path", "message")
+        ):
+            raise BaselineError(f"{path}: findings[{i}] needs rule, path, and message strings")
+        known[(entry["rule"], entry["path"], entry["message"])] += 1
+    return known
+
+
+def write_baseline(path: Path, findings: list[Finding]) -> None:
+    """Record *findings* in *path*, sorted so the file diffs well."""
+    entries: list[dict[str, str]] = [
+        {"rule": rule, "path": file, "message": message}
+        for rule, file, message in sorted(_key(f) for f in findings)
+    ]
+    path.write_text(
+        json.dumps({"version": BASELINE_VERSION, "findings": entries}, indent=2) + "\n",
+        encoding="utf-8",
+    )
+
+
+@dataclass
+class Comparison:
+    new: list[Finding]  # not in the baseline
+    known: int  # in the baseline and still found
+    fixed: int  # in the baseline but no longer found
+
+
+def compare(findings: list[Finding], known: Counter[tuple[str, str, str]]) -> Comparison:
+    """Split *findings* into the new ones and those *known* lists."""
+    remaining: Counter[tuple[str, str, str]] = Counter(known)
+    new: list[Finding] = []
+    for finding in findings:
+        key: tuple[str, str, str] = _key(finding)
+        if remaining[key] > 0:
+            remaining[key] -= 1
+        else:
+            new.append(finding)
+    fixed: int = sum(remaining.values())
+    return Comparison(new, sum(known.values()) - fixed, fixed)
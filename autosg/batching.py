@@ -0,0 +1,218 @@
+"""Analysis of many repositories at once, for the ``batch`` command.
+
+A repository list has one input per line: a directory, an archive, or a
+git URL, as ``analyze`` accepts them, and optionally a name for it::
+
+    # services.txt
+    ../billing
+    https://github.com/org/auth@v2.3.0      auth
+    git@github.com:org/search.git
+
+Blank lines and ``#`` comments are skipped.  Without a name, a repository
+is named after the last part of its input.  Each repository is analyzed
+on its own, and its output written to ``<name>.<format>``; its files are
+named ``<name>/<path in the repository>``.  A summary of every repository
+and their totals goes to ``summary.json``.
+"""
+
+from __future__ import annotations
+
+import json
+import re
+import time
+from collections import Counter
+from collections.abc import Callable, Iterator
+from concurrent.futures import ProcessPoolExecutor
+from dataclasses import asdict, dataclass, field, replace
+from pathlib import Path
+from typing import Any, TextIO
+
+from .analysis import Analysis, FileResult, Options
+from .exporting import FILE_FORMATS, FORMATS, ExportOptions
+from .extracting import Edge
+from .features import register_features, registered_features
+from .fetching import FetchError, fetch_inputs, is_git_url, split_git_url
+from .overriding import QueryFile, register_queries, registered_queries
+from .parsing import register_filetypes, registered_filetypes
+from .plugins import Plugin, register_plugin, registered_plugins
+from .spilling import Spool
+
+# Output file suffixes for formats not named like their usual extension.
+_SUFFIXES: dict[str, str] = {
+    "cypher": "cypher", "dsm": "txt", "dsm-json": "json", "mermaid": "mmd",
+    "mermaid-class": "mmd", "sqlite": "db",
+}
+
+SUMMARY_NAME: str = "summary.json"
+
+
+@dataclass(frozen=True)
+class BatchEntry:
+    input: str  # as written in the list
+    name: str
+
+
+@dataclass
+class RepoSummary:
+    """What analyzing one repository produced."""
+
+    name: str
+    input: str
+    output: str | None = None  # None if the repository failed
+    files: int = 0
+    languages: dict[str, int] = field(default_factory=dict)  # files per language
+    entities: dict[str, int] = field(default_factory=dict)  # by kind
+    edges: dict[str, int] = field(default_factory=dict)  # by kind
+    errors: int = 0  # parse errors
+    seconds: float = 0.0
+    error: str | None = None  # why the repository failed
+
+
+def _default_name(spec: str) -> str:
+    """``auth-v2.3.0`` for ``https://github.com/org/auth@v2.3.0``."""
+    ref: str | None = None
+    if is_git_url(spec):
+        spec, ref = split_git_url(spec)
+    name: str = re.split(r"[/:]", spec.rstrip("/"))[-1] or "repo"
+    name = re.sub(r"\.(git|zip|tar|tgz|tbz2|txz)$|\.tar\.\w+$", "", name)
+    return f"{name}-{ref}" if ref is not None else name
+
+
+def parse_batch_file(path: Path) -> list[BatchEntry]:
+    """Read a repository list; raises ``ValueError`` for a bad or repeated name."""
+    entries: list[BatchEntry] = []
+    seen: dict[str, int] = {}
+    for number, line in enumerate(path.read_text(encoding="utf-8").splitlines(), 1):
+        line = line.split(" #", 1)[0].strip()
+        if not line or line.startswith("#"):
+            continue
+        fields: list[str] = line.split()
+        if len(fields) > 2:
+            raise ValueError(f"{path}:{number}: expected an input and an optional name")
+        name: str = fields[1] if len(fields) == 2 else _default_name(fields[0])
+        if not re.fullmatch(r"[\w.@-]+", name) or name.startswith("."):
+            raise ValueError(f"{path}:{number}: {name!r} cannot be used as a file name")
+        if name in seen:
+            raise ValueError(
+                f"{path}:{number}: name {name!r} is already used on line {seen[name]}; "
+                "give one of them a name",
+            )
+        seen[name] = number
+        entries.append(BatchEntry(fields[0], name))
+    return entries
+
+
+class _CountingAnalysis(Analysis):
+    """*analysis*, counting what passes through for the summary."""
+
+    def __init__(self, analysis: Analysis, summary: RepoSummary) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.summary: RepoSummary = summary
+        self._languages: Counter[str] = Counter()
+        self._entities: Counter[str] = Counter()
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            self.summary.files += 1
+            self.summary.errors += len(file_result.errors)
+            self._languages[file_result.language] += 1
+            self._entities.update(e.kind for e in file_result.entities)
+            yield file_result
+        self.summary.languages = dict(sorted(self._languages.items()))
+        self.summary.entities = dict(sorted(self._entities.items()))
+        self.summary.edges = dict(sorted(Counter(e.kind for e in self.edges).items()))
+
+    @property
+    def edges(self) -> Spool[Edge]:
+        return self.analysis.edges
+
+
+def analyze_repo(
+    entry: BatchEntry, options: Options, fmt: str, output_dir: Path,
+) -> RepoSummary:
+    """Analyze one repository and write its output; failures are recorded, not raised."""
+    summary: RepoSummary = RepoSummary(entry.name, entry.input)
+    started: float = time.perf_counter()
+    output: Path = output_dir / f"{entry.name}.{_SUFFIXES.get(fmt, fmt)}"
+    try:
+        with fetch_inputs([entry.input]) as (paths, _labels):
+            repo_options: Options = replace(options, labels={paths[0].resolve(): entry.name})
+            analysis: Analysis = _CountingAnalysis(Analysis(paths, repo_options), summary)
+            if fmt in FILE_FORMATS:
+                FILE_FORMATS[fmt](analysis, output, ExportOptions())
+            else:
+                out: TextIO
+                with open(output, "w", newline="") as out:
+                    FORMATS[fmt](analysis, out, ExportOptions())
+        summary.output = str(output)
+    except (FetchError, OSError, ValueError) as exc:
+        output.unlink(missing_ok=True)
+        summary = RepoSummary(entry.name, entry.input, error=str(exc))
+    summary.seconds = round(time.perf_counter() - started, 3)
+    return summary
+
+
+def summarize(repos: list[RepoSummary]) -> dict[str, Any]:
+    """The ``summary.json`` document: every repository, and totals across them."""
+    totals: dict[str, Any] = {
+        "repos": len(repos),
+        "failed": sum(1 for r in repos if r.error is not None),
+        "files": sum(r.files for r in repos),
+        "errors": sum(r.errors for r in repos),
+    }
+    for key in ("languages", "entities", "edges"):
+        counts: Counter[str] = Counter()
+        for repo in repos:
+            counts.update(getattr(repo, key))
+        totals[key] = dict(sorted(counts.items()))
+    return {"repos": [asdict(r) for r in repos], "totals": totals}
+
+
+def _worker_init(
+    plugins: tuple[Plugin, ...], queries: tuple[QueryFile, ...],
+    features: dict[str, dict[str, bool]], filetypes: dict[str, str],
+) -> None:
+    for plugin in plugins:  # not inherited unless workers are forked
+        register_plugin(plugin)
+    for query_file in queries:
+        register_queries(query_file)
+    register_features(features)
+    register_filetypes(filetypes)
+
+
+def run_batch(
+    entries: list[BatchEntry], options: Options, fmt: str, output_dir: Path,
+    concurrency: int = 1, done: Callable[[RepoSummary], None] | None = None,
+) -> list[RepoSummary]:
+    """Analyze *entries*, *concurrency* at a time, and write ``summary.json``.
+
+    Summaries come back in list order, and *done* is called with each in turn.
+    """
+    output_dir.mkdir(parents=True, exist_ok=True)
+    repos: list[RepoSummary] = []
+    if concurrency > 1 and len(entries) > 1:
+        with ProcessPoolExecutor(
+            min(concurrency, len(entries)),
+            initializer=_worker_init,
+            initargs=(
+                registered_plugins(), registered_queries(), registered_features(),
+                registered_filetypes(),
+            ),
+        ) as pool:
+            for summary in pool.map(
+                analyze_repo, entries, [options] * len(entries), [fmt] * len(entries),
+                [output_dir] * len(entries),
+            ):
+                repos.append(summary)
+                if done is not None:
+                    done(summary)
+    else:
+        for entry in entries:
+            repos.append(analyze_repo(entry, options, fmt, output_dir))
+            if done is not None:
+                done(repos[-1])
+    with open(output_dir / SUMMARY_NAME, "w") as out:
+        json.dump(summarize(repos), out, indent=2)
+        out.write("\n")
+    return repos
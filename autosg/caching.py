@@ -0,0 +1,108 @@
+"""Persistent cache of per-file extraction results.
+
+Cache is stored in ``.autosg/cache/entities.db`` (SQLite) under the
+working directory.  The cache key is (content_hash, language,
+extractor_version), so a file is re-extracted whenever its content
+changes or the extractor itself changes.  Paths are not part of the key:
+a moved or copied file is still a cache hit.
+
+A long-running process (``autosg daemon``) can also keep recent results
+in memory with :func:`enable_memory_cache`, in front of the database.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import json
+import sqlite3
+from collections import OrderedDict
+from pathlib import Path
+from typing import Any
+
+DEFAULT_CACHE_DIR: Path = Path(".autosg") / "cache"
+
+# Bump this when extraction output changes so stale entries are not reused.
+EXTRACTOR_VERSION: int = 33
+
+# Results kept in memory, as JSON text, most recently used last; None when off.
+_memory: OrderedDict[tuple[str, str], str] | None = None
+_memory_limit: int = 0
+
+
+def enable_memory_cache(limit: int) -> None:
+    """Keep the last *limit* results read or stored in memory as well."""
+    global _memory, _memory_limit
+    _memory, _memory_limit = OrderedDict(), limit
+
+
+def memory_cache_size() -> int:
+    return len(_memory) if _memory is not None else 0
+
+
+def _remember(digest: str, language: str, text: str) -> None:
+    if _memory is None:
+        return
+    _memory[digest, language] = text
+    _memory.move_to_end((digest, language))
+    while len(_memory) > _memory_limit:
+        _memory.popitem(last=False)
+
+
+def open_cache_db(cache_dir: Path = DEFAULT_CACHE_DIR) -> sqlite3.Connection:
+    """Connect to ``entities.db`` in *cache_dir*, ``.autosg/cache`` by default.
+
+    The directory and the ``extractions`` table are created on first use.
+    There is no migration: each row records the EXTRACTOR_VERSION it was
+    written under, and rows of other versions are never read.  Under
+    ``--no-cache`` this is not called, so nothing is read or written.
+    """
+    cache_dir.mkdir(parents=True, exist_ok=True)
+    conn: sqlite3.Connection = sqlite3.connect(cache_dir / "entities.db")
+    conn.execute(
+        "CREATE TABLE IF NOT EXISTS extractions ("
+        "  content_hash       TEXT    NOT NULL,"
+        "  language           TEXT    NOT NULL,"
+        "  extractor_version  INTEGER NOT NULL,"
+        "  result             TEXT    NOT NULL,"
+        "  PRIMARY KEY (content_hash, language, extractor_version)"
+        ")"
+    )
+    return conn
+
+
+def content_hash(source_utf8: bytes) -> str:
+    """SHA-256 hex digest of the file content."""
+    return hashlib.sha256(source_utf8).hexdigest()
+
+
+def cache_get(
+    conn: sqlite3.Connection, digest: str, language: str,
+) -> dict[str, Any] | None:
+    """Return a cached extraction result, or *None* on cache miss."""
+    if _memory is not None and (digest, language) in _memory:
+        _memory.move_to_end((digest, language))
+        # Parsed afresh each time: callers rebase and annotate the dicts.
+        return json.loads(_memory[digest, language])  # type: ignore[no-any-return]
+    row = conn.execute(
+        "SELECT result FROM extractions"
+        " WHERE content_hash = ? AND language = ? AND extractor_version = ?",
+        (digest, language, EXTRACTOR_VERSION),
+    ).fetchone()
+    if row is not None:
+        _remember(digest, language, row[0])
+        return json.loads(row[0])  # type: ignore[no-any-return]
+    return None
+
+
+def cache_put(
+    conn: sqlite3.Connection, digest: str, language: str, result: dict[str, Any],
+) -> None:
+    """Store an extraction result.  The caller commits."""
+    text: str = json.dumps(result)
+    _remember(digest, language, text)
+    conn.execute(
+        "INSERT OR REPLACE INTO extractions"
+        " (content_hash, language, extractor_version, result)"
+        " VALUES (?, ?, ?, ?)",
+        (digest, language, EXTRACTOR_VERSION, text),
+    )
@@ -0,0 +1,85 @@
+"""Canonical output, for committing analysis results and diffing them.
+
+Output is already in path order whatever ``--jobs`` is, but within a file
+entities come in extraction order and edges in the order the linker found
+them, which changes as extractors and the linker do.  Canonical output
+sorts both: entities by span within their file (renumbered to match, so
+ids keep counting up through the output), errors by position, and edges
+by their endpoints, kind, and attrs.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import json
+from collections.abc import Iterator
+
+from .analysis import Analysis, FileResult
+from .extracting import Edge, Entity, ParseError
+
+
+def _entity_key(entity: Entity) -> tuple[int, int, int, int, str, str]:
+    # Start first and end last, so an entity sorts before the ones it contains.
+    return (entity.row, entity.col, -entity.end_row, -entity.end_col, entity.kind, entity.name)
+
+
+def _error_key(error: ParseError) -> tuple[int, int, int, int, str, str]:
+    return (error.row, error.col, error.end_row, error.end_col, error.kind, error.message)
+
+
+def edge_key(edge: Edge) -> tuple[int, int, str, str]:
+    """Sort key of an edge in canonical output."""
+    return (
+        edge.source, edge.target if edge.target is not None else -1, edge.kind,
+        json.dumps(edge.attrs, sort_keys=True, default=str),
+    )
+
+
+class CanonicalAnalysis(Analysis):
+    """*analysis* with its results in canonical order as they are read.
+
+    Entities are copied before they are renumbered, so the wrapped
+    analysis keeps resolving edges between the original ids.  Edges are
+    sorted in memory.
+    """
+
+    def __init__(self, analysis: Analysis) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self._ids: dict[int, int] = {}  # original id -> canonical id
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            yield self.file_result(file_result)
+
+    def file_result(self, file_result: FileResult) -> FileResult:
+        """*file_result* with entities sorted by span and renumbered within its id range."""
+        if not file_result.entities:
+            return file_result
+        first: int = min(e.id for e in file_result.entities)
+        ordered: list[Entity] = sorted(file_result.entities, key=_entity_key)
+        local: dict[int, int] = {e.id: first + i for i, e in enumerate(ordered)}
+        self._ids.update(local)
+        return dataclasses.replace(
+            file_result,
+            entities=[
+                dataclasses.replace(
+                    e, id=local[e.id],
+                    parent=local.get(e.parent, e.parent) if e.parent is not None else None,
+                )
+                for e in ordered
+            ],
+            errors=sorted(file_result.errors, key=_error_key),
+        )
+
+    @property
+    def edges(self) -> list[Edge]:
+        edges: list[Edge] = [
+            dataclasses.replace(
+                e, source=self._ids.get(e.source, e.source),
+                target=self._ids.get(e.target, e.target) if e.target is not None else None,
+            )
+            for e in self.analysis.edges
+        ]
+        edges.sort(key=edge_key)
+        return edges
@@ -0,0 +1,293 @@
+"""Architecture rules, for the ``check`` command.
+
+Rules are declared under ``rules`` in the config file and checked
+against the call and import edges between packages (directories)::
+
+    rules:
+      - name: handlers-skip-database
+        forbid: {from: handlers, to: database}
+      - name: domain-is-self-contained
+        only: {from: domain, to: [domain, shared]}
+      - name: no-package-cycles
+        no-cycles: {depth: 1}
+
+A package pattern is a glob (see walking.glob_to_regex) that matches a
+directory and everything below it, so ``handlers`` covers
+``src/handlers`` and ``src/handlers/v2``.  ``forbid`` flags every
+dependency from a ``from`` package on a ``to`` package; ``only`` flags
+those on anything else, other than the package itself.  ``no-cycles``
+flags cycles among packages, cut to the first ``depth`` directories
+below the common root of the analyzed files when given.  ``edges``
+narrows a rule to some edge kinds (default: calls and imports).
+
+A ``key=value`` pattern selects entities instead, by an attr they or
+their nearest enclosing entity with one have, as ``autosg:`` comments
+set them (see directives.py): ``forbid: {from: layer=domain, to:
+layer=infra}``.  Rules with such a pattern check dependencies within a
+package too.
+
+An ``autosg:allow=RULE`` comment suppresses a rule for the entity it
+annotates, everything inside it, and dependencies on the line the entity
+starts on (an import): they are not flagged by ``forbid`` or ``only``,
+nor counted in ``no-cycles``.  Several rules are joined with ``|``, and a
+bare ``autosg:allow`` suppresses all of them.
+"""
+
+from __future__ import annotations
+
+import os
+import re
+from dataclasses import dataclass
+from typing import Any
+
+from . import counting, walking
+from .analysis import Analysis
+from .extracting import Entity
+from .linting import Finding, Location, Rule, cycle_findings, edge_location
+
+RULE_KINDS: tuple[str, ...] = ("forbid", "no-cycles", "only")
+
+_DEFAULT_EDGES: frozenset[str] = frozenset({"calls", "imports"})
+
+# A pattern selecting entities by attr rather than package.
+_SELECTOR_RE: re.Pattern[str] = re.compile(r"([\w.-]+)=(\S+)")
+
+
+@dataclass(frozen=True)
+class ArchRule:
+    name: str
+    kind: str  # one of RULE_KINDS
+    sources: tuple[str, ...] = ()  # package globs; forbid and only
+    targets: tuple[str, ...] = ()
+    depth: int | None = None  # no-cycles
+    edges: frozenset[str] = _DEFAULT_EDGES
+    description: str = ""
+
+    def explain(self) -> str:
+        """What the rule asks for, for listings and SARIF rule metadata."""
+        if self.description:
+            return self.description
+        if self.kind == "forbid":
+            return f"{' or '.join(self.sources)} must not depend on {' or '.join(self.targets)}."
+        if self.kind == "only":
+            return f"{' or '.join(self.sources)} may only depend on {', '.join(self.targets)}."
+        if self.depth == 1:
+            return "No dependency cycles among top-level packages."
+        if self.depth is not None:
+            return f"No dependency cycles among packages {self.depth} directories deep."
+        return "No dependency cycles among packages."
+
+
+def _globs(value: Any, where: str) -> tuple[str, ...]:
+    if isinstance(value, str):
+        value = [value]
+    if not isinstance(value, list) or not value or not all(isinstance(v, str) for v in value):
+        raise ValueError(f"{where}: expected a package glob or a list of them")
+    for pattern in value:
+        if "=" in pattern and not _SELECTOR_RE.fullmatch(pattern):
+            raise ValueError(f"{where}: {pattern!r} is neither a package glob nor key=value")
+    return tuple(value)
+
+
+def parse_rule(spec: Any, where: str) -> ArchRule:
+    """Build a rule from a config entry; raises ``ValueError`` if malformed."""
+    if not isinstance(spec, dict):
+        raise ValueError(f"{where}: expected a table with 'name' and a rule")
+    unknown: list[str] = sorted(set(spec) - {"name", "description", "edges", *RULE_KINDS})
+    if unknown:
+        raise ValueError(f"{where}: unknown key(s) {', '.join(map(repr, unknown))}")
+    kinds: list[str] = [k for k in RULE_KINDS if k in spec]
+    if len(kinds) != 1:
+        raise ValueError(f"{where}: expected exactly one of {', '.join(RULE_KINDS)}")
+    kind: str = kinds[0]
+    name: Any = spec.get("name")
+    if not isinstance(name, str) or not name:
+        raise ValueError(f"{where}: 'name' must be a non-empty string")
+    description: Any = spec.get("description", "")
+    if not isinstance(description, str):
+        raise ValueError(f"{where}: 'description' must be a string")
+    edges: Any = spec.get("edges", sorted(_DEFAULT_EDGES))
+    if isinstance(edges, str):
+        edges = [edges]
+    if not isinstance(edges, list) or not edges or not all(isinstance(e, str) for e in edges):
+        raise ValueError(f"{where}: 'edges' must be an edge kind or a list of them")
+    body: Any = spec[kind]
+    if kind == "no-cycles":
+        if body is True:
+            return ArchRule(name, kind, edges=frozenset(edges), description=description)
+        depth: Any = body.get("depth") if isinstance(body, dict) and set(body) <= {"depth"} else 0
+        if not isinstance(depth, int) or isinstance(depth, bool) or depth < 1:
+            raise ValueError(f"{where}: 'no-cycles' must be true or {{depth: N}} with N >= 1")
+        return ArchRule(
+            name, kind, depth=depth, edges=frozenset(edges), description=description,
+        )
+    if not isinstance(body, dict) or set(body) != {"from", "to"}:
+        raise ValueError(f"{where}: {kind!r} must be a table with 'from' and 'to'")
+    return ArchRule(
+        name, kind,
+        sources=_globs(body["from"], f"{where}: {kind}.from"),
+        targets=_globs(body["to"], f"{where}: {kind}.to"),
+        edges=frozenset(edges),
+        description=description,
+    )
+
+
+def rule_edges(rules: list[ArchRule]) -> frozenset[str]:
+    """The edge kinds an analysis must resolve to check *rules*."""
+    return frozenset().union(*(r.edges for r in rules))
+
+
+def _package_matcher(patterns: tuple[str, ...]) -> re.Pattern[str] | None:
+    globs: list[str] = [p for p in patterns if "=" not in p]
+    if not globs:
+        return None
+    return re.compile("|".join(f"(?:{walking.glob_to_regex(p).pattern})" for p in globs))
+
+
+def _matches(matcher: re.Pattern[str] | None, package: str) -> bool:
+    """Whether *package* or one of its parent directories matches."""
+    if matcher is None:
+        return False
+    parts: list[str] = package.split("/")
+    return any(matcher.match("/".join(parts[:i])) for i in range(len(parts), 0, -1))
+
+
+def _selectors(patterns: tuple[str, ...]) -> list[tuple[str, str]]:
+    return [(m.group(1), m.group(2)) for p in patterns if (m := _SELECTOR_RE.fullmatch(p))]
+
+
+def _attr(entity: Entity, key: str, entities: dict[int, Entity]) -> str | None:
+    """*entity*'s attr *key* as text, or its nearest enclosing entity's."""
+    current: Entity | None = entity
+    while current is not None:
+        if key in current.attrs:
+            value: Any = current.attrs[key]
+            return "true" if value is True else str(value)
+        current = entities.get(current.parent) if current.parent is not None else None
+    return None
+
+
+def _allows(value: Any, rule: str) -> bool:
+    """Whether the ``allow`` attr *value* suppresses *rule*."""
+    return value is True or (isinstance(value, str) and rule in value.split("|"))
+
+
+def _allowed(
+    rule: str, dependency: tuple[str, str, str, Location, Entity, Entity],
+    entities: dict[int, Entity], allowed_at: dict[tuple[str, int], Any],
+) -> bool:
+    """Whether an ``allow`` attr suppresses *rule* for *dependency*.
+
+    The attr counts on the depending entity or one around it, and on an
+    entity starting on the dependency's line, such as the import it is.
+    """
+    location: Location = dependency[3]
+    if _allows(allowed_at.get((location.path, location.row)), rule):
+        return True
+    current: Entity | None = dependency[4]
+    while current is not None:
+        if _allows(current.attrs.get("allow"), rule):
+            return True
+        current = entities.get(current.parent) if current.parent is not None else None
+    return False
+
+
+def _selected(
+    selectors: list[tuple[str, str]], entity: Entity, entities: dict[int, Entity],
+) -> str | None:
+    """The first of *selectors* *entity* matches, as written, or None."""
+    for key, value in selectors:
+        if _attr(entity, key, entities) == value:
+            return f"{key}={value}"
+    return None
+
+
+def _shown(package: str, label: str | None) -> str:
+    return f"{package} ({label})" if label is not None else package
+
+
+def _cut(package: str, root: str, depth: int | None) -> str:
+    """*package* cut to *depth* directories below *root*; unchanged without a depth."""
+    if depth is None:
+        return package
+    relative: str = package[len(root) :].lstrip("/") if root not in ("", ".") else package
+    prefix: str = f"{root}/" if root not in ("", ".") else ""
+    return prefix + "/".join(relative.split("/")[:depth]) if relative else package
+
+
+def check(analysis: Analysis, rules: list[ArchRule]) -> list[Finding]:
+    """Violations of *rules* in *analysis*, which should resolve ``rule_edges(rules)``."""
+    entities: dict[int, Entity] = {}
+    packages: set[str] = set()
+    allowed_at: dict[tuple[str, int], Any] = {}  # (path, row) -> allow attr starting there
+    for file_result in analysis:
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+            packages.add(counting.package(entity.path))
+            if "allow" in entity.attrs and entity.kind != "file":
+                allowed_at.setdefault((entity.path, entity.row), entity.attrs["allow"])
+    root: str = os.path.commonpath(sorted(packages)).replace(os.sep, "/") if packages else ""
+    # (edge kind, source package, target package, location, source, target).
+    dependencies: list[tuple[str, str, str, Location, Entity, Entity]] = []
+    for edge in analysis.edges:
+        source: Entity | None = entities.get(edge.source)
+        target: Entity | None = entities.get(edge.target) if edge.target is not None else None
+        if source is None or target is None:
+            continue
+        dependencies.append((
+            edge.kind, counting.package(source.path), counting.package(target.path),
+            edge_location(edge, source), source, target,
+        ))
+    findings: list[Finding] = []
+    for rule in rules:
+        relevant: list[tuple[str, str, str, Location, Entity, Entity]] = [
+            d for d in dependencies
+            if d[0] in rule.edges and not _allowed(rule.name, d, entities, allowed_at)
+        ]
+        if rule.kind == "no-cycles":
+            findings.extend(cycle_findings(rule.name, "error", [
+                (_cut(s, root, rule.depth), _cut(t, root, rule.depth), location)
+                for _kind, s, t, location, _source, _target in relevant if s != t
+            ]))
+            continue
+        sources: re.Pattern[str] | None = _package_matcher(rule.sources)
+        targets: re.Pattern[str] | None = _package_matcher(rule.targets)
+        source_selectors: list[tuple[str, str]] = _selectors(rule.sources)
+        target_selectors: list[tuple[str, str]] = _selectors(rule.targets)
+        within: bool = bool(source_selectors or target_selectors)
+        seen: set[tuple[str, int, int]] = set()
+        for kind, source_package, target_package, location, source, target in relevant:
+            if source_package == target_package and not within:
+                continue
+            source_label: str | None = _selected(source_selectors, source, entities)
+            if source_label is None and not _matches(sources, source_package):
+                continue
+            target_label: str | None = _selected(target_selectors, target, entities)
+            listed: bool = target_label is not None or _matches(targets, target_package)
+            if rule.kind == "only":
+                listed = not listed and not (
+                    _selected(source_selectors, target, entities) is not None
+                    or _matches(sources, target_package)
+                )
+            key: tuple[str, int, int] = (location.path, location.row, location.col)
+            if not listed or key in seen:
+                continue
+            seen.add(key)
+            verb: str = "must not depend on" if rule.kind == "forbid" else "may not depend on"
+            findings.append(Finding(
+                rule=rule.name,
+                message=(
+                    f"{_shown(source_package, source_label)} {verb} "
+                    f"{_shown(target_package, target_label)} "
+                    f"({kind} {target.name} in {target.path})"
+                ),
+                location=location,
+                level="error",
+            ))
+    findings.sort(key=lambda f: (f.location.path, f.location.row, f.location.col, f.rule))
+    return findings
+
+
+def sarif_rules(rules: list[ArchRule]) -> dict[str, Rule]:
+    """SARIF rule metadata for *rules*."""
+    return {r.name: Rule(r.name, r.explain(), "error") for r in rules}
@@ -0,0 +1,201 @@
+"""Hand a command to a running ``autosg daemon``, if there is one.
+
+``python -m autosg`` calls :func:`delegate` before importing anything
+else, so this module only uses the standard library: a command the
+daemon runs costs a socket round trip rather than loading the parsers.
+The client sends one JSON line with the arguments, working directory,
+the environment variables commands read (:func:`command_env`), and
+:func:`fingerprint`; the daemon answers with
+``{"stdout": text}`` and ``{"stderr": text}`` lines as the command writes,
+then ``{"exit": status}``.  A daemon started from other code answers
+``{"stale": true}`` instead and exits, and the command runs here.
+
+Commands that read stdin, run until stopped, or draw a progress bar run
+here too, as does everything with ``AUTOSG_NO_DAEMON`` set.
+
+The socket's directory must be a real directory of this user's with mode
+0700, and the socket this user's, or nothing is sent: otherwise another
+user could have made it first and be listening.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import json
+import os
+import socket
+import stat
+import sys
+import tempfile
+from pathlib import Path
+from typing import Any
+
+# Global options that take a value, skipped when finding the command.
+_GLOBAL_VALUES: frozenset[str] = frozenset({"--config", "--log-format", "--trace"})
+
+# Commands that must run in the calling process.  llm-resolve reads API
+# keys from the environment, which are not sent to the daemon.
+_LOCAL: frozenset[str] = frozenset(
+    {"annotate-files", "batch", "daemon", "llm-resolve", "lsp", "serve"},
+)
+
+# Environment variables commands read, themselves or through git, go, and
+# boto3; the daemon is sent only these, and those AUTOSG_DAEMON_ENV names.
+_ENV_NAMES: frozenset[str] = frozenset({
+    "COLUMNS", "GOFLAGS", "GOMODCACHE", "GOPATH", "GOPROXY", "GOROOT", "HOME", "LANG",
+    "NO_COLOR", "PATH", "SSH_AUTH_SOCK", "TERM", "TMPDIR", "TZ", "USER", "XDG_CACHE_HOME",
+    "XDG_CONFIG_HOME",
+})
+_ENV_PREFIXES: tuple[str, ...] = ("AUTOSG_", "AWS_", "GIT_", "LC_")
+
+
+class UnsafeSocketError(OSError):
+    """Raised when the daemon socket or its directory may be another user's."""
+
+
+def supported() -> bool:
+    """Whether this platform has the Unix sockets and user ids the daemon needs."""
+    return hasattr(socket, "AF_UNIX") and hasattr(os, "getuid")
+
+
+def socket_path() -> Path:
+    """Where the daemon listens: ``AUTOSG_DAEMON_SOCKET``, or a per-user directory.
+
+    That is ``$XDG_RUNTIME_DIR/autosg`` when it is set, else ``autosg-<uid>``
+    in the temp directory.
+    """
+    override: str | None = os.environ.get("AUTOSG_DAEMON_SOCKET")
+    if override:
+        return Path(override)
+    runtime: str | None = os.environ.get("XDG_RUNTIME_DIR")
+    if runtime:
+        return Path(runtime) / "autosg" / "daemon.sock"
+    return Path(tempfile.gettempdir()) / f"autosg-{os.getuid()}" / "daemon.sock"
+
+
+def check_private(directory: Path) -> None:
+    """Raise UnsafeSocketError unless *directory* is this user's alone, mode 0700."""
+    info: os.stat_result = os.lstat(directory)
+    if stat.S_ISLNK(info.st_mode) or not stat.S_ISDIR(info.st_mode):
+        raise UnsafeSocketError(f"{directory} is not a directory")
+    if info.st_uid != os.getuid():
+        raise UnsafeSocketError(f"{directory} belongs to another user")
+    if stat.S_IMODE(info.st_mode) != 0o700:
+        raise UnsafeSocketError(
+            f"{directory} has mode {stat.S_IMODE(info.st_mode):04o}, not 0700",
+        )
+
+
+def _check_socket(path: Path) -> None:
+    check_private(path.parent)
+    info: os.stat_result = os.lstat(path)
+    if not stat.S_ISSOCK(info.st_mode) or info.st_uid != os.getuid():
+        raise UnsafeSocketError(f"{path} is not a socket of this user's")
+
+
+def command_env() -> dict[str, str]:
+    """The part of the environment sent with a command."""
+    extra: set[str] = {n for n in os.environ.get("AUTOSG_DAEMON_ENV", "").split(",") if n}
+    return {
+        name: value for name, value in os.environ.items()
+        if name in _ENV_NAMES or name in extra or name.startswith(_ENV_PREFIXES)
+    }
+
+
+def fingerprint() -> str:
+    """Identifies the interpreter and the autosg source files, by size and mtime."""
+    digest = hashlib.sha256(f"{sys.executable}\x00{sys.version}".encode())
+    package: Path = Path(__file__).parent
+    for entry in sorted(os.scandir(package), key=lambda e: e.name):
+        if entry.is_file():
+            stat: os.stat_result = entry.stat()
+            digest.update(f"\x00{entry.name}\x00{stat.st_mtime_ns}\x00{stat.st_size}".encode())
+    return digest.hexdigest()
+
+
+def _command(args: list[str]) -> str | None:
+    """The subcommand *args* run, or None for --help and the like."""
+    skip: bool = False
+    for arg in args:
+        if skip:
+            skip = False
+        elif arg in _GLOBAL_VALUES:
+            skip = True
+        elif not arg.startswith("-"):
+            return arg
+    return None
+
+
+def delegable(args: list[str]) -> bool:
+    command: str | None = _command(args)
+    return (
+        command is not None
+        and command not in _LOCAL
+        and "-" not in args
+        and "--progress" not in args
+        and not os.environ.get("AUTOSG_NO_DAEMON")
+        and supported()
+    )
+
+
+def connect(path: Path, timeout: float | None = None) -> socket.socket | None:
+    """A connection to the daemon at *path*, or None when none is listening.
+
+    Raises UnsafeSocketError when *path* may be another user's.
+    """
+    if not path.exists():
+        return None
+    _check_socket(path)
+    sock: socket.socket = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    sock.settimeout(timeout)
+    try:
+        sock.connect(str(path))
+    except OSError:
+        sock.close()
+        return None
+    return sock
+
+
+def send(sock: socket.socket, message: dict[str, Any]) -> None:
+    sock.sendall(json.dumps(message).encode() + b"\n")
+
+
+def delegate(args: list[str]) -> int | None:
+    """Run *args* in the daemon and return its exit status, or None to run them here."""
+    if not delegable(args):
+        return None
+    try:
+        sock: socket.socket | None = connect(socket_path())
+    except UnsafeSocketError as exc:
+        print(f"autosg: not using the daemon: {exc}", file=sys.stderr)
+        return None
+    if sock is None:
+        return None
+    answered: bool = False
+    with sock:
+        try:
+            send(sock, {
+                "args": args, "cwd": os.getcwd(), "env": command_env(),
+                "fingerprint": fingerprint(),
+            })
+            for line in sock.makefile("r", encoding="utf-8"):
+                message: dict[str, Any] = json.loads(line)
+                if message.get("stale"):
+                    return None
+                answered = True
+                if "stdout" in message:
+                    sys.stdout.write(message["stdout"])
+                    sys.stdout.flush()
+                elif "stderr" in message:
+                    sys.stderr.write(message["stderr"])
+                    sys.stderr.flush()
+                elif "exit" in message:
+                    return int(message["exit"])
+        except BrokenPipeError:
+            return 1  # our reader stopped reading, e.g. head
+        except (OSError, ValueError):
+            pass
+    if not answered:
+        return None  # the daemon went away before starting; run here instead
+    print("autosg: lost the connection to the daemon", file=sys.stderr)
+    return 1
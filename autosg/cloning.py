@@ -0,0 +1,127 @@
+"""Near-duplicate functions, for ``clone-of`` edges.
+
+Each function and method is reduced to its tokens, with identifiers and
+literals normalized so that copies with renamed variables or changed
+constants still match, and comments and nested functions left out.  The
+overlapping runs of ``SHINGLE`` tokens are summarized by a MinHash
+signature, which extraction records on a ``clone-of`` reference and the
+linker compares.  Two functions of one language are clones when the
+share of signature values they have in common, which estimates the
+Jaccard similarity of their runs, reaches the threshold
+(``--clone-threshold``, 0.9 by default).
+
+Functions under ``MIN_TOKENS`` tokens are not compared: short getters
+and wrappers look alike everywhere.  Candidate pairs are found by
+locality-sensitive hashing, bands of the signature in buckets, rather
+than by comparing every pair, so a pair near the threshold may be
+missed.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import random
+from collections import defaultdict
+from collections.abc import Iterable, Iterator
+
+from tree_sitter import Node
+
+SHINGLE: int = 3
+MIN_TOKENS: int = 50
+DEFAULT_THRESHOLD: float = 0.9
+
+_PRIME: int = (1 << 61) - 1
+_BANDS: int = 16
+_ROWS: int = 4  # signature values per band
+
+
+def _permutations(count: int) -> list[tuple[int, int]]:
+    """*count* hashes ``(a * h + b) % _PRIME``, seeded so signatures compare across runs."""
+    rng: random.Random = random.Random(0x5CA1AB1E)
+    return [(rng.randrange(1, _PRIME), rng.randrange(_PRIME)) for _ in range(count)]
+
+
+_PERMUTATIONS: list[tuple[int, int]] = _permutations(_BANDS * _ROWS)
+
+# Words in the node types of literals, across grammars.
+_LITERAL_WORDS: tuple[str, ...] = (
+    "char", "float", "integer", "literal", "number", "rune", "string",
+)
+
+
+def _token(node: Node) -> str:
+    if not node.is_named:
+        return node.type  # keywords and punctuation stand for themselves
+    if any(word in node.type for word in _LITERAL_WORDS):
+        return "$lit"
+    return "$id"
+
+
+def tokens(node: Node, function_types: frozenset[str] = frozenset()) -> list[str]:
+    """The normalized tokens of the function whose declaration is *node*.
+
+    Descendants whose type is in *function_types* are nested functions,
+    compared on their own, so they are skipped.
+    """
+    found: list[str] = []
+    stack: list[Node] = [node]
+    while stack:
+        current: Node = stack.pop()
+        if current is not node and current.type in function_types:
+            continue
+        if "comment" in current.type:
+            continue
+        if not current.children:
+            found.append(_token(current))
+            continue
+        stack.extend(reversed(current.children))
+    return found
+
+
+def clone_signature(
+    node: Node, function_types: frozenset[str] = frozenset(),
+) -> list[int] | None:
+    """The MinHash signature of *node*'s function, or None if it is too short to compare."""
+    found: list[str] = tokens(node, function_types)
+    if len(found) < MIN_TOKENS:
+        return None
+    hashes: set[int] = {
+        int.from_bytes(
+            hashlib.blake2b("\0".join(found[i : i + SHINGLE]).encode(), digest_size=8).digest(),
+            "big",
+        )
+        for i in range(len(found) - SHINGLE + 1)
+    }
+    return [min((a * h + b) % _PRIME for h in hashes) for a, b in _PERMUTATIONS]
+
+
+def similarity(left: Iterable[int], right: Iterable[int]) -> float:
+    """The estimated Jaccard similarity of two signatures."""
+    pairs: list[tuple[int, int]] = list(zip(left, right))
+    return sum(a == b for a, b in pairs) / len(pairs) if pairs else 0.0
+
+
+def clones(
+    signatures: Iterable[tuple[int, list[int]]], threshold: float = DEFAULT_THRESHOLD,
+) -> Iterator[tuple[int, int, float]]:
+    """(clone, original, similarity) for each function that duplicates an earlier one.
+
+    *signatures* are (entity id, signature) pairs in the order seen.  Each
+    clone is paired with the first function it is similar enough to, so
+    ten copies make nine pairs rather than forty-five.
+    """
+    buckets: dict[tuple[int, tuple[int, ...]], list[int]] = defaultdict(list)
+    seen: dict[int, tuple[int, list[int]]] = {}  # id -> (order seen, signature)
+    for entity_id, values in signatures:
+        bands: list[tuple[int, tuple[int, ...]]] = [
+            (band, tuple(values[band * _ROWS : (band + 1) * _ROWS])) for band in range(_BANDS)
+        ]
+        candidates: set[int] = {other for key in bands for other in buckets.get(key, ())}
+        for other in sorted(candidates, key=lambda c: seen[c][0]):
+            score: float = similarity(values, seen[other][1])
+            if score >= threshold:
+                yield entity_id, other, score
+                break
+        seen[entity_id] = (len(seen), values)
+        for key in bands:
+            buckets[key].append(entity_id)
@@ -0,0 +1,207 @@
+"""Single-file components: Vue (``.vue``) and Svelte (``.svelte``) files.
+
+A component file holds a template, scripts, and styles.  It is split into
+those sections, and each ``<script>`` is extracted as JavaScript or, with
+``lang="ts"``, TypeScript.  Scripts are parsed in place, with the rest of
+the file blanked out, so their entities and syntax errors keep their
+positions in the component file.
+
+One ``component`` entity, named after the file, spans the file and
+encloses the declarations of its scripts.  It records its ``sections``
+(``template``, ``script``, or ``style``, with their ``language`` and rows;
+``setup`` and ``module`` scripts and ``scoped`` styles are marked as
+such) and the ``components`` its template uses: capitalized tags, and in
+Vue hyphenated ones (``<my-button>`` is ``MyButton``).  In Svelte the
+template is what is left outside scripts and styles.
+"""
+
+from __future__ import annotations
+
+import re
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from .embedding import attributes, extract_region, position
+from .extracting import Edge, Entity, ParseError, assign_uids, file_entity
+
+COMPONENT_EXTENSIONS: dict[str, str] = {".svelte": "svelte", ".vue": "vue"}
+
+
+def component_language(path: Path) -> str | None:
+    return COMPONENT_EXTENSIONS.get(path.suffix)
+
+
+# Script languages by ``lang`` attribute; scripts in others are not extracted.
+_SCRIPT_LANGUAGES: dict[str, str] = {
+    "": "javascript", "javascript": "javascript", "js": "javascript", "jsx": "javascript",
+    "ts": "typescript", "tsx": "tsx", "typescript": "typescript",
+}
+
+_SECTION_RE: re.Pattern[bytes] = re.compile(
+    rb"<!--.*?(?:-->|\Z)|<(template|script|style)\b((?:[^>\"']|\"[^\"]*\"|'[^']*')*)>",
+    re.DOTALL | re.IGNORECASE,
+)
+
+_TAG_RE: re.Pattern[str] = re.compile(r"<!--.*?(?:-->|\Z)|<([A-Za-z][\w.-]*)", re.DOTALL)
+
+# Components Vue provides itself, as they are written in templates.
+_VUE_BUILTINS: frozenset[str] = frozenset({
+    "Component", "KeepAlive", "Slot", "Suspense", "Teleport", "Template", "Transition",
+    "TransitionGroup",
+})
+
+
+def _section_end(source: bytes, name: bytes, start: int) -> tuple[int, int] | None:
+    """Where the body of a section opened before *start* ends, and where its closing tag does.
+
+    ``<template>`` sections may nest ``<template v-if>`` tags of their own.
+    """
+    depth: int = 1
+    pattern: re.Pattern[bytes] = re.compile(rb"<(/?)" + name + rb"\b[^>]*>", re.IGNORECASE)
+    for match in pattern.finditer(source, start):
+        if not match.group(1):
+            if name == b"template" and not match.group().endswith(b"/>"):
+                depth += 1
+            continue
+        depth -= 1
+        if depth == 0:
+            return match.start(), match.end()
+    return None
+
+
+def _component_name(path: str) -> str:
+    return PurePosixPath(path).stem
+
+
+def _pascal(tag: str) -> str:
+    return "".join(part[:1].upper() + part[1:] for part in tag.split("-"))
+
+
+def _used_components(markup: str, language: str) -> list[str]:
+    """Tags in *markup* that name components, in order of first use."""
+    used: dict[str, None] = {}
+    for match in _TAG_RE.finditer(markup):
+        tag: str | None = match.group(1)
+        if tag is None:
+            continue  # a comment
+        if tag[0].isupper():
+            name: str = tag
+        elif language == "vue" and "-" in tag:
+            name = _pascal(tag)
+        else:
+            continue
+        if language == "vue" and name in _VUE_BUILTINS:
+            continue
+        used.setdefault(name)
+    return list(used)
+
+
+class _Component:
+    """Entities, references, and errors of one component file, section by section."""
+
+    def __init__(self, source_utf8: bytes, language: str, path: str) -> None:
+        self.source: bytes = source_utf8
+        self.language: str = language
+        self.path: str = path
+        self.file: Entity = file_entity(source_utf8, language, path, 0)
+        self.component: Entity = Entity(
+            id=1, kind="component", name=_component_name(path), path=path, language=language,
+            row=1, col=1, end_row=self.file.end_row, end_col=self.file.end_col, parent=0,
+            attrs={}, start_byte=0, end_byte=len(source_utf8),
+        )
+        self.entities: list[Entity] = [self.file, self.component]
+        self.references: list[Edge] = []
+        self.errors: list[ParseError] = []
+        self.sections: list[dict[str, Any]] = []
+        self.markup: list[str] = []
+
+    def position(self, offset: int) -> tuple[int, int]:
+        return position(self.source, offset)
+
+    def section(self, name: str, attrs: dict[str, str], start: int, end: int) -> None:
+        kind: dict[str, Any] = {"section": name}
+        lang: str = attrs.get("lang", "").lower()
+        if name == "template":
+            kind["language"] = lang or "html"
+        elif name == "style":
+            kind["language"] = lang or "css"
+            if "scoped" in attrs:
+                kind["scoped"] = True
+        else:
+            kind["language"] = _SCRIPT_LANGUAGES.get(lang, lang)
+            if "setup" in attrs:
+                kind["setup"] = True
+            if "module" in attrs or attrs.get("context") == "module":
+                kind["module"] = True
+        kind["row"], kind["end_row"] = self.position(start)[0], self.position(end)[0]
+        self.sections.append(kind)
+
+    def script(self, language: str, start: int, end: int) -> None:
+        """Extract the script body from *start* to *end*, parsed where it stands."""
+        first: int = len(self.entities) - 1  # the id of the script's own file entity
+        entities, references, errors, _tree = extract_region(
+            self.source, language, start, end, self.path, first, self.component.id,
+        )
+        self.entities.extend(entities)
+        self.references.extend(references)
+        self.errors.extend(errors)
+
+    def error(self, message: str, start: int, end: int) -> None:
+        row, col = self.position(start)
+        end_row, end_col = self.position(end)
+        self.errors.append(ParseError(self.path, "syntax", message, row, col, end_row, end_col))
+
+    def read(self) -> None:
+        position: int = 0
+        outside: list[tuple[int, int]] = []  # Svelte markup: the file outside scripts and styles
+        for match in _SECTION_RE.finditer(self.source):
+            if match.group(1) is None or match.start() < position:
+                continue  # a comment, or a tag inside a section already read
+            name: str = match.group(1).decode().lower()
+            attrs: dict[str, str] = attributes(match.group(2).decode("utf-8", errors="replace"))
+            if match.group().endswith(b"/>"):
+                continue
+            found: tuple[int, int] | None = _section_end(
+                self.source, name.encode(), match.end(),
+            )
+            if found is None:
+                self.error(f"unclosed <{name}>", match.start(), match.end())
+                break
+            body_end, end = found
+            if name == "template" and self.language == "svelte":
+                continue  # a block of markup, not a section
+            outside.append((position, match.start()))
+            self.section(name, attrs, match.start(), end)
+            body: str = self.source[match.end() : body_end].decode("utf-8", errors="replace")
+            if name == "template":
+                self.markup.append(body)
+            elif name == "script" and self.sections[-1]["language"] in _SCRIPT_LANGUAGES.values():
+                self.script(self.sections[-1]["language"], match.end(), body_end)
+            position = end
+        outside.append((position, len(self.source)))
+        spans: list[tuple[int, int]] = [
+            (start + len(chunk) - len(chunk.lstrip()), start + len(chunk.rstrip()))
+            for start, end in outside
+            if (chunk := self.source[start:end]).strip()
+        ]
+        if self.language == "svelte" and spans:
+            self.markup.extend(
+                self.source[start:end].decode("utf-8", errors="replace") for start, end in spans
+            )
+            self.section("template", {}, spans[0][0], spans[-1][1])
+            self.sections.sort(key=lambda section: section["row"])
+        attrs: dict[str, Any] = self.component.attrs
+        attrs["sections"] = self.sections
+        components: list[str] = _used_components("".join(self.markup), self.language)
+        if components:
+            attrs["components"] = components
+
+
+def component_entities(
+    source_utf8: bytes, language: str, path: str,
+) -> tuple[list[Entity], list[Edge], list[ParseError]]:
+    """The entities of a Vue or Svelte file, the references of its scripts, and errors."""
+    component: _Component = _Component(source_utf8, language, path)
+    component.read()
+    assign_uids(component.entities)
+    return component.entities, component.references, component.errors
@@ -0,0 +1,247 @@
+"""Project configuration files (``autosg.yaml`` or ``.autosg.toml``).
+
+A config file pins the options a project always runs with, so CI and
+developers get identical results without long command lines.  Top-level
+keys apply to every subcommand that has a matching option; a table named
+after a subcommand applies to that subcommand only::
+
+    languages: [go, typescript]
+    exclude: ["**/vendor/**"]
+    format: jsonl
+
+    analyze:
+      edges: [calls]
+
+Keys are option names without the leading dashes (``no-cache`` or
+``no_cache``).  ``gitignore: false`` and ``cache: false`` are accepted as
+the positive spellings of ``--no-gitignore`` and ``--no-cache``.  Options
+given on the command line always win over the config file.
+
+A ``plugins`` list declares external extractors (see plugins.py); their
+commands run from the config file's directory.  A ``rules`` list declares
+architecture rules for ``check`` (see checking.py).  ``queries`` names
+a directory of tree-sitter query files (see overriding.py), relative to
+the config file; ``.autosg/queries`` is used when it exists.  A
+``features`` table switches extraction features off per language (see
+features.py).  A ``filetypes`` table maps extensions and file names to
+languages, ahead of autosg's own detection (see parsing.py)::
+
+    filetypes:
+      .inc: php
+      .bats: bash
+      Vagrantfile: ruby
+
+A ``sinks`` table maps URL schemes to the result sinks ``--sink`` opens
+for them, by import path (see sinks.py).
+"""
+
+from __future__ import annotations
+
+import tomllib
+from pathlib import Path
+from typing import Any
+
+from . import overriding
+from .checking import ArchRule, parse_rule
+from .features import parse_features
+from .parsing import parse_filetypes
+from .plugins import Plugin, parse_plugin
+from .sinks import SinkFactory, parse_sinks
+
+CONFIG_FILENAMES: tuple[str, ...] = ("autosg.yaml", "autosg.yml", ".autosg.toml")
+
+# Config keys whose click parameter is spelled differently.
+_RENAMED_KEYS: dict[str, str] = {
+    "format": "fmt",
+}
+
+# Positive spellings of negative flags: ``gitignore: false`` -> ``no_gitignore: true``.
+_NEGATED_KEYS: dict[str, str] = {
+    "cache": "no_cache",
+    "gitignore": "no_gitignore",
+}
+
+
+class ConfigError(Exception):
+    """Raised when a config file cannot be read or is malformed."""
+
+
+def find_config(start: Path = Path(".")) -> Path | None:
+    """Return the nearest config file in *start* or its parents.
+
+    The search stops at the repository root (the first directory holding
+    ``.git``) so a config from an unrelated enclosing project is not picked up.
+    """
+    current: Path = start.resolve()
+    for directory in (current, *current.parents):
+        for name in CONFIG_FILENAMES:
+            candidate: Path = directory / name
+            if candidate.is_file():
+                return candidate
+        if (directory / ".git").exists():
+            break
+    return None
+
+
+def load_config(path: Path) -> dict[str, Any]:
+    """Parse a YAML or TOML config file into a plain dict."""
+    try:
+        text: str = path.read_text(encoding="utf-8")
+    except OSError as exc:
+        raise ConfigError(f"cannot read {path}: {exc.strerror}") from None
+    data: Any
+    if path.suffix == ".toml":
+        try:
+            data = tomllib.loads(text)
+        except tomllib.TOMLDecodeError as exc:
+            raise ConfigError(f"{path}: {exc}") from None
+    else:
+        # Import lazily so TOML-only projects do not need PyYAML.
+        import yaml
+
+        try:
+            data = yaml.safe_load(text)
+        except yaml.YAMLError as exc:
+            raise ConfigError(f"{path}: {exc}") from None
+    if data is None:
+        return {}
+    if not isinstance(data, dict):
+        raise ConfigError(f"{path}: expected a mapping at the top level")
+    return data
+
+
+def _param_name(key: str) -> str:
+    return _RENAMED_KEYS.get(key, key.replace("-", "_"))
+
+
+def _to_defaults(
+    section: dict[str, Any], params: set[str], path: Path, where: str = "",
+) -> dict[str, Any]:
+    """Translate config keys and values into click parameter defaults.
+
+    Keys that do not name one of *params* are reported rather than being
+    silently ignored, which is what click would do with them.
+    """
+    defaults: dict[str, Any] = {}
+    for key, value in section.items():
+        name: str = _param_name(str(key))
+        if name in _NEGATED_KEYS:
+            if not isinstance(value, bool):
+                raise ConfigError(f"{path}: {key!r} must be true or false")
+            name, value = _NEGATED_KEYS[name], not value
+        elif isinstance(value, list):
+            value = tuple(str(v) for v in value)
+        if name not in params:
+            raise ConfigError(f"{path}: unknown option {key!r}{where}")
+        defaults[name] = value
+    return defaults
+
+
+def default_map(
+    config: dict[str, Any], commands: dict[str, set[str]], path: Path,
+) -> dict[str, Any]:
+    """Build a click ``default_map`` from a loaded config.
+
+    *commands* maps each subcommand name to its parameter names.
+    """
+    shared: dict[str, Any] = {}
+    sections: dict[str, dict[str, Any]] = {}
+    for key, value in config.items():
+        if key in ("features", "filetypes", "plugins", "queries", "rules", "sinks"):
+            continue  # read by load_features, load_filetypes, and so on
+        if key in commands:
+            if not isinstance(value, dict):
+                raise ConfigError(f"{path}: [{key}] must be a table of options")
+            sections[key] = value
+        elif isinstance(value, dict):
+            raise ConfigError(f"{path}: unknown command section {key!r}")
+        else:
+            shared[key] = value
+
+    shared_defaults: dict[str, Any] = _to_defaults(
+        shared, set().union(*commands.values()), path,
+    )
+    return {
+        command: {
+            **shared_defaults,
+            **_to_defaults(sections.get(command, {}), params, path, f" in [{command}]"),
+        }
+        for command, params in commands.items()
+    }
+
+
+def load_plugins(config: dict[str, Any], path: Path) -> list[Plugin]:
+    """The plugins a loaded config declares."""
+    specs: Any = config.get("plugins", [])
+    if not isinstance(specs, list):
+        raise ConfigError(f"{path}: 'plugins' must be a list")
+    plugins: list[Plugin] = []
+    for i, spec in enumerate(specs):
+        try:
+            plugins.append(parse_plugin(spec, f"{path}: plugins[{i}]", str(path.parent)))
+        except ValueError as exc:
+            raise ConfigError(str(exc)) from None
+    return plugins
+
+
+def load_features(config: dict[str, Any], path: Path) -> dict[str, dict[str, bool]]:
+    """The feature toggles of a loaded config, by language."""
+    try:
+        return parse_features(config.get("features", {}), str(path))
+    except ValueError as exc:
+        raise ConfigError(str(exc)) from None
+
+
+def load_filetypes(config: dict[str, Any], path: Path) -> dict[str, str]:
+    """The languages a loaded config assigns to extensions and file names."""
+    try:
+        return parse_filetypes(config.get("filetypes", {}), str(path))
+    except ValueError as exc:
+        raise ConfigError(str(exc)) from None
+
+
+def load_sinks(config: dict[str, Any], path: Path) -> dict[str, SinkFactory]:
+    """The result sinks a loaded config registers, by URL scheme."""
+    try:
+        return parse_sinks(config.get("sinks", {}), str(path), str(path.parent))
+    except ValueError as exc:
+        raise ConfigError(str(exc)) from None
+
+
+def load_rules(config: dict[str, Any], path: Path) -> list[ArchRule]:
+    """The architecture rules a loaded config declares."""
+    specs: Any = config.get("rules", [])
+    if not isinstance(specs, list):
+        raise ConfigError(f"{path}: 'rules' must be a list")
+    rules: list[ArchRule] = []
+    for i, spec in enumerate(specs):
+        try:
+            rules.append(parse_rule(spec, f"{path}: rules[{i}]"))
+        except ValueError as exc:
+            raise ConfigError(str(exc)) from None
+    names: list[str] = [r.name for r in rules]
+    duplicates: list[str] = sorted({n for n in names if names.count(n) > 1})
+    if duplicates:
+        raise ConfigError(f"{path}: duplicate rule name(s) {', '.join(map(repr, duplicates))}")
+    return rules
+
+
+def load_queries(config: dict[str, Any], path: Path | None) -> list[overriding.QueryFile]:
+    """The query files of a loaded config, or of ``.autosg/queries`` without one.
+
+    *path* is the config file, or None when there is none.
+    """
+    base: Path = path.parent if path is not None else Path(".")
+    directory: Any = config.get("queries")
+    if directory is None:
+        if not (base / overriding.DEFAULT_QUERY_DIR).is_dir():
+            return []
+        directory = overriding.DEFAULT_QUERY_DIR
+    elif not isinstance(directory, str):
+        raise ConfigError(f"{path}: 'queries' must be a directory path")
+    elif not (base / directory).is_dir():
+        raise ConfigError(f"{path}: queries directory {directory!r} does not exist")
+    try:
+        return overriding.load_queries(base / directory)
+    except ValueError as exc:
+        raise ConfigError(str(exc)) from None
@@ -0,0 +1,303 @@
+"""Build constraints: which Go files, and which C preprocessor branches, a build uses.
+
+Without ``--build-tags`` every file and branch is extracted, so code for
+several platforms is counted once per platform.  ``--build-tags
+linux,amd64,integration`` picks one build, as ``go build -tags`` and
+``GOOS``/``GOARCH`` would, and leaves out the rest:
+
+- Go files whose ``//go:build`` line (or legacy ``// +build`` lines) is
+  not satisfied, or whose name ends in another ``_GOOS``, ``_GOARCH``, or
+  ``_GOOS_GOARCH``, are skipped.  The operating system and architecture
+  are the ones the tags name, else linux and amd64; ``unix`` holds for
+  Unix systems, release tags (``go1.21``) always hold, and other tags only
+  when given.  Go file entities record their constraint as ``build``.
+- C and C++ branches of ``#if``, ``#ifdef``, ``#ifndef``, ``#elif``, and
+  ``#else`` that the tags rule out are blanked before parsing, keeping
+  their lines.  Only conditions made of ``defined``, ``!``, ``&&``,
+  ``||``, and ``0``/``1`` are decided: a macro is defined when it is a
+  tag, or the platform macro of the chosen system or architecture
+  (``__linux__``, ``_WIN32``, ``__x86_64__``, ...), and undefined when it
+  is another platform's.  Branches depending on anything else are kept.
+"""
+
+from __future__ import annotations
+
+import re
+from collections.abc import Callable, Iterator
+from dataclasses import dataclass
+from pathlib import PurePosixPath
+
+# As in go/build's syslist.go.
+GO_OSES: frozenset[str] = frozenset({
+    "aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "js",
+    "linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos",
+})
+GO_ARCHES: frozenset[str] = frozenset({
+    "386", "amd64", "amd64p32", "arm", "arm64", "arm64be", "armbe", "loong64", "mips",
+    "mips64", "mips64le", "mips64p32", "mips64p32le", "mipsle", "ppc", "ppc64", "ppc64le",
+    "riscv", "riscv64", "s390", "s390x", "sparc", "sparc64", "wasm",
+})
+_UNIX_OSES: frozenset[str] = frozenset({
+    "aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios", "linux",
+    "netbsd", "openbsd", "solaris",
+})
+# Systems that satisfy another's tag: GOOS=android builds linux files.
+_IMPLIED_OSES: dict[str, str] = {"android": "linux", "illumos": "solaris", "ios": "darwin"}
+
+# Macros C compilers predefine for a Go system or architecture name.
+_PLATFORM_MACROS: dict[str, tuple[str, ...]] = {
+    "386": ("__i386__", "_M_IX86"),
+    "amd64": ("__x86_64__", "__amd64__", "_M_X64"),
+    "android": ("__ANDROID__",),
+    "arm": ("__arm__", "_M_ARM"),
+    "arm64": ("__aarch64__", "_M_ARM64"),
+    "darwin": ("__APPLE__", "__MACH__"),
+    "freebsd": ("__FreeBSD__",),
+    "linux": ("__linux__", "__linux", "linux"),
+    "netbsd": ("__NetBSD__",),
+    "openbsd": ("__OpenBSD__",),
+    "riscv64": ("__riscv",),
+    "windows": ("_WIN32", "WIN32"),
+}
+
+
+@dataclass(frozen=True)
+class BuildTags:
+    """The tags of one build, with the operating system and architecture they name."""
+
+    tags: frozenset[str]
+
+    @classmethod
+    def parse(cls, text: str) -> BuildTags:
+        """``linux,amd64,integration`` as build tags; spaces separate them too."""
+        return cls(frozenset(t for t in re.split(r"[\s,]+", text) if t))
+
+    @property
+    def goos(self) -> str:
+        return min((t for t in self.tags if t in GO_OSES), default="linux")
+
+    @property
+    def goarch(self) -> str:
+        return min((t for t in self.tags if t in GO_ARCHES), default="amd64")
+
+    def satisfied(self, tag: str) -> bool:
+        """Whether a Go build constraint's *tag* holds."""
+        if tag in GO_OSES:
+            return tag == self.goos or _IMPLIED_OSES.get(self.goos) == tag
+        if tag in GO_ARCHES:
+            return tag == self.goarch
+        if tag == "unix":
+            return self.goos in _UNIX_OSES
+        return tag in self.tags or re.fullmatch(r"go1\.\d+", tag) is not None
+
+    def defined(self, macro: str) -> bool | None:
+        """Whether *macro* is defined in a C build, or None when that cannot be told."""
+        if macro in self.tags:
+            return True
+        for platform, macros in _PLATFORM_MACROS.items():
+            if macro in macros:
+                return platform in (self.goos, self.goarch, _IMPLIED_OSES.get(self.goos))
+        return None
+
+
+# ---------------------------------------------------------------------------
+# Expressions
+# ---------------------------------------------------------------------------
+
+_TOKEN_RE: re.Pattern[str] = re.compile(r"\s*(&&|\|\||!|\(|\)|[\w.]+)")
+
+
+def _tokens(text: str) -> list[str] | None:
+    """The tokens of a boolean expression, or None if it has others."""
+    tokens: list[str] = []
+    position: int = 0
+    text = text.strip()
+    while position < len(text):
+        match: re.Match[str] | None = _TOKEN_RE.match(text, position)
+        if match is None:
+            return None
+        tokens.append(match.group(1))
+        position = match.end()
+    return tokens
+
+
+def _or(left: bool | None, right: bool | None) -> bool | None:
+    return True if True in (left, right) else None if None in (left, right) else False
+
+
+def _and(left: bool | None, right: bool | None) -> bool | None:
+    return False if False in (left, right) else None if None in (left, right) else True
+
+
+def _evaluate(
+    tokens: list[str], value: Callable[[str], bool | None],
+) -> bool | None:
+    """A ``!``, ``&&``, ``||`` expression over names, in three-valued logic.
+
+    None is unknown: ``false && unknown`` is still false.  Malformed
+    expressions are unknown too.
+    """
+    position: int = 0
+
+    def peek() -> str | None:
+        return tokens[position] if position < len(tokens) else None
+
+    def either() -> bool | None:
+        nonlocal position
+        result: bool | None = both()
+        while peek() == "||":
+            position += 1
+            right: bool | None = both()
+            result = _or(result, right)
+        return result
+
+    def both() -> bool | None:
+        nonlocal position
+        result: bool | None = unary()
+        while peek() == "&&":
+            position += 1
+            right: bool | None = unary()
+            result = _and(result, right)
+        return result
+
+    def unary() -> bool | None:
+        nonlocal position
+        token: str | None = peek()
+        if token is None:
+            raise ValueError("unexpected end")
+        position += 1
+        if token == "!":
+            inner: bool | None = unary()
+            return None if inner is None else not inner
+        if token == "(":
+            result: bool | None = either()
+            if peek() != ")":
+                raise ValueError("unclosed (")
+            position += 1
+            return result
+        if token in ("&&", "||", ")"):
+            raise ValueError(f"unexpected {token}")
+        return value(token)
+
+    try:
+        result: bool | None = either()
+    except ValueError:
+        return None
+    return result if position == len(tokens) else None
+
+
+# ---------------------------------------------------------------------------
+# Go
+# ---------------------------------------------------------------------------
+
+
+def go_constraint(source_utf8: bytes) -> str | None:
+    """The build constraint in the header of a Go file, as a ``//go:build`` expression."""
+    plus: list[str] = []
+    for raw in source_utf8.split(b"\n"):
+        line: str = raw.decode("utf-8", errors="replace").strip()
+        if line.startswith("//go:build "):
+            return line[len("//go:build ") :].strip()
+        if line.startswith("// +build "):
+            # Spaces are ||, commas &&, and the lines are joined by &&.
+            options: list[str] = [
+                " && ".join(term.split(",")) for term in line[len("// +build ") :].split()
+            ]
+            plus.append(f"({' || '.join(options)})" if len(options) > 1 else options[0])
+        elif line and not line.startswith("//"):
+            break  # the package clause; constraints only come before it
+    return " && ".join(plus) if plus else None
+
+
+def _name_constraints(path: str) -> Iterator[str]:
+    """The system or architecture a ``*_GOOS_GOARCH.go`` file name restricts it to."""
+    stem: str = PurePosixPath(path).stem.removesuffix("_test")
+    parts: list[str] = stem.split("_")[1:]  # a file named linux.go is not constrained
+    if parts and parts[-1] in GO_ARCHES:
+        yield parts.pop()
+    if parts and parts[-1] in GO_OSES:
+        yield parts[-1]
+
+
+def go_selected(path: str, source_utf8: bytes, tags: BuildTags) -> bool:
+    """Whether a build with *tags* compiles the Go file at *path*."""
+    if not all(tags.satisfied(tag) for tag in _name_constraints(path)):
+        return False
+    constraint: str | None = go_constraint(source_utf8)
+    if constraint is None:
+        return True
+    tokens: list[str] | None = _tokens(constraint)
+    return tokens is None or _evaluate(tokens, tags.satisfied) is not False
+
+
+# ---------------------------------------------------------------------------
+# C preprocessor
+# ---------------------------------------------------------------------------
+
+_DIRECTIVE_RE: re.Pattern[bytes] = re.compile(
+    rb"^\s*#\s*(if|ifdef|ifndef|elif|else|endif)\b(.*)$", re.DOTALL,
+)
+
+_DEFINED_RE: re.Pattern[str] = re.compile(r"\bdefined\s*(?:\(\s*(\w+)\s*\)|(\w+))")
+
+
+def _c_condition(directive: str, text: str, tags: BuildTags) -> bool | None:
+    """The value of an ``#if``-family condition, or None when it cannot be told."""
+    text = re.sub(r"/\*.*?\*/|//.*", "", text).strip()
+    if directive in ("ifdef", "ifndef"):
+        defined: bool | None = tags.defined(text.split()[0]) if text else None
+        return defined if directive == "ifdef" or defined is None else not defined
+    # defined(X) becomes a name only the lookup below knows.
+    text = _DEFINED_RE.sub(lambda m: f"defined.{m.group(1) or m.group(2)}", text)
+    tokens: list[str] | None = _tokens(text)
+    if tokens is None:
+        return None
+
+    def value(token: str) -> bool | None:
+        if token.startswith("defined."):
+            return tags.defined(token[len("defined.") :])
+        if token.isdigit():
+            return int(token) != 0
+        return True if token in tags.tags else None
+
+    return _evaluate(tokens, value)
+
+
+def c_selected(source_utf8: bytes, tags: BuildTags) -> bytes:
+    """*source_utf8* with the branches a build with *tags* leaves out blanked.
+
+    Directives are kept, and so are the line breaks of blanked lines, so
+    positions do not move.
+    """
+    lines: list[bytes] = source_utf8.split(b"\n")
+    # Per open #if: whether an earlier branch surely holds if reached, so
+    # that no later one is, and whether the current branch is kept.
+    stack: list[list[bool]] = []
+    index: int = 0
+    while index < len(lines):
+        start: int = index
+        line: bytes = lines[index]
+        while line.endswith(b"\\") and index + 1 < len(lines):  # continued directive
+            index += 1
+            line = line[:-1] + lines[index]
+        index += 1
+        live: bool = all(frame[1] for frame in stack)
+        match: re.Match[bytes] | None = _DIRECTIVE_RE.match(line)
+        if match is None:
+            if not live:
+                for row in range(start, index):
+                    lines[row] = re.sub(rb"[^\s]", b" ", lines[row])
+            continue
+        directive: str = match.group(1).decode()
+        text: str = match.group(2).decode("utf-8", errors="replace")
+        if directive in ("if", "ifdef", "ifndef"):
+            value: bool | None = _c_condition(directive, text, tags)
+            stack.append([value is True, value is not False])
+        elif directive in ("elif", "else") and stack:
+            frame: list[bool] = stack[-1]
+            value = True if directive == "else" else _c_condition("if", text, tags)
+            frame[1] = not frame[0] and value is not False
+            frame[0] = frame[0] or value is True
+        elif directive == "endif" and stack:
+            stack.pop()
+    return b"\n".join(lines)
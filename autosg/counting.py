@@ -0,0 +1,73 @@
+"""What reports, snapshots, summaries, and ``--fail-on`` count, counted once.
+
+All of them count files, their lines, and their entities by kind, and
+find cycles among the packages or files the edges link.  Entities too
+fine-grained to count (files themselves, imports, uses, and comments)
+are left out, and a file's package is its directory, as for ``--cluster
+directory``.
+"""
+
+from __future__ import annotations
+
+import os
+from collections import Counter
+from collections.abc import Iterable, Iterator
+from dataclasses import dataclass, field
+
+from .analysis import FileResult
+from .exporting import strongly_connected_components
+from .extracting import Entity
+
+UNCOUNTED_KINDS: frozenset[str] = frozenset({"comment", "file", "import", "use"})
+
+
+def package(path: str) -> str:
+    """The package of the file at *path*: its directory, or ``.``."""
+    return os.path.dirname(path).replace(os.sep, "/") or "."
+
+
+def lines(entity: Entity) -> int:
+    """How many lines *entity* spans."""
+    # A final newline leaves the end position at column 1 of the next row.
+    last: int = entity.end_row if entity.end_col > 1 else entity.end_row - 1
+    return last - entity.row + 1
+
+
+def counted(entities: Iterable[Entity]) -> Iterator[Entity]:
+    """The *entities* that count, i.e. not of UNCOUNTED_KINDS."""
+    return (e for e in entities if e.kind not in UNCOUNTED_KINDS)
+
+
+@dataclass
+class Totals:
+    """Files, lines, parse errors, and counted entities by kind, over some files."""
+
+    files: int = 0
+    lines: int = 0
+    errors: int = 0
+    kinds: Counter[str] = field(default_factory=Counter)
+
+    @property
+    def entities(self) -> int:
+        return sum(self.kinds.values())
+
+    def add(self, file_result: FileResult) -> None:
+        self.files += 1
+        self.lines += lines(file_result.entities[0])
+        self.errors += len(file_result.errors)
+        self.kinds.update(e.kind for e in counted(file_result.entities))
+
+
+def cycles(dependencies: Iterable[tuple[str, str]]) -> list[list[str]]:
+    """The dependency cycles among what *dependencies* link, (source, target) pairs."""
+    pairs: set[tuple[str, str]] = set(dependencies)
+    nodes: list[str] = sorted({node for pair in pairs for node in pair})
+    index: dict[str, int] = {node: i for i, node in enumerate(nodes)}
+    successors: list[set[int]] = [set() for _ in nodes]
+    for source, target in pairs:
+        successors[index[source]].add(index[target])
+    return [
+        [nodes[i] for i in component]
+        for component in strongly_connected_components(len(nodes), successors)
+        if len(component) > 1
+    ]
@@ -0,0 +1,167 @@
+"""Test coverage reports, attached to entities as their ``coverage`` attr.
+
+Three report formats are read, told apart by their contents:
+
+- Go coverprofiles (``go test -coverprofile``), whose blocks mark every
+  line they span as run or not;
+- lcov tracefiles (``lcov.info``, from c8, nyc, Jest, gcov, ...), by
+  their ``DA:`` line records;
+- Cobertura XML (coverage.py, JaCoCo converters, ...), by its ``<line>``
+  elements, with file names relative to the report's ``<source>``.
+
+Reports name files by absolute path, import path, or a path relative to
+some root, so an analyzed file is matched with the report file sharing
+the most trailing path components with it: at least the file name, and
+its directory too when several report files have that name.  The hits
+of equally good matches, such as one file in two reports, are merged.
+Each entity of a covered file gets the share of its coverable lines the
+tests ran, from 0 to 1, as ``coverage``; entities without coverable
+lines, and the cells of notebooks, get none.
+"""
+
+from __future__ import annotations
+
+import bisect
+import itertools
+import os
+import re
+import xml.etree.ElementTree as ElementTree
+from collections import defaultdict
+from pathlib import Path
+
+from .extracting import Entity
+
+# file.go:startLine.startCol,endLine.endCol numStatements count
+_GO_BLOCK_RE: re.Pattern[str] = re.compile(r"^(.+):(\d+)\.\d+,(\d+)\.\d+ \d+ (\d+)$")
+
+
+def _parts(path: str) -> tuple[str, ...]:
+    return tuple(p for p in path.replace("\\", "/").split("/") if p and p != ".")
+
+
+class Coverage:
+    """Line hits by file, merged from any number of reports."""
+
+    def __init__(self) -> None:
+        # report path components -> row -> hits
+        self._files: dict[tuple[str, ...], dict[int, int]] = {}
+        self._by_name: dict[str, list[tuple[str, ...]]] = defaultdict(list)
+        self._matched: dict[str, dict[int, int] | None] = {}
+
+    def _record(self, path: str, row: int, hits: int) -> None:
+        parts: tuple[str, ...] = _parts(path)
+        if not parts:
+            return
+        lines: dict[int, int] | None = self._files.get(parts)
+        if lines is None:
+            lines = self._files[parts] = {}
+            self._by_name[parts[-1]].append(parts)
+        lines[row] = max(lines.get(row, 0), hits)
+
+    def load(self, path: Path) -> str:
+        """Merge in the report at *path*; returns its format, raises ValueError if unknown."""
+        try:
+            text: str = path.read_text(encoding="utf-8", errors="replace")
+        except OSError as exc:
+            raise ValueError(f"cannot read {path}: {exc.strerror}") from None
+        head: str = text.lstrip()[:4096]
+        self._matched.clear()
+        if head.startswith("mode:"):
+            self._load_go(text, path)
+            return "go"
+        if "<coverage" in head:
+            self._load_cobertura(text, path)
+            return "cobertura"
+        if re.search(r"^(?:TN|SF):", head, re.MULTILINE):
+            self._load_lcov(text)
+            return "lcov"
+        raise ValueError(f"{path}: not a Go coverprofile, lcov tracefile, or Cobertura report")
+
+    def _load_go(self, text: str, path: Path) -> None:
+        for number, line in enumerate(text.splitlines()[1:], 2):
+            if not line.strip():
+                continue
+            block: re.Match[str] | None = _GO_BLOCK_RE.match(line.strip())
+            if block is None:
+                raise ValueError(f"{path}:{number}: malformed coverprofile block")
+            for row in range(int(block.group(2)), int(block.group(3)) + 1):
+                self._record(block.group(1), row, int(block.group(4)))
+
+    def _load_lcov(self, text: str) -> None:
+        current: str | None = None
+        for line in text.splitlines():
+            if line.startswith("SF:"):
+                current = line[3:].strip()
+            elif line.startswith("DA:") and current is not None:
+                fields: list[str] = line[3:].split(",")
+                if len(fields) >= 2 and fields[0].isdigit():
+                    hits: str = fields[1].strip()
+                    self._record(current, int(fields[0]), int(hits) if hits.isdigit() else 0)
+            elif line.startswith("end_of_record"):
+                current = None
+
+    def _load_cobertura(self, text: str, path: Path) -> None:
+        try:
+            root: ElementTree.Element = ElementTree.fromstring(text)
+        except ElementTree.ParseError as exc:
+            raise ValueError(f"{path}: {exc}") from None
+        sources: list[str] = [s.text.strip() for s in root.iter("source") if s.text]
+        for element in root.iter("class"):
+            filename: str = element.get("filename", "")
+            if not filename:
+                continue
+            if sources and not os.path.isabs(filename):
+                filename = f"{sources[0]}/{filename}"
+            for line in element.iter("line"):
+                number: str = line.get("number", "")
+                hits: str = line.get("hits", "0")
+                if number.isdigit():
+                    self._record(filename, int(number), int(hits) if hits.isdigit() else 0)
+
+    def lines(self, path: str) -> dict[int, int] | None:
+        """Hits by row of the analyzed file *path*, or None when no report covers it."""
+        if path not in self._matched:
+            self._matched[path] = self._match(_parts(os.path.abspath(path)))
+        return self._matched[path]
+
+    def _match(self, analyzed: tuple[str, ...]) -> dict[int, int] | None:
+        """The hits of the report files ending the most like *analyzed*, merged."""
+        best: list[tuple[str, ...]] = []
+        best_length: int = 0
+        for candidate in self._by_name.get(analyzed[-1], []) if analyzed else []:
+            length: int = 0
+            while (
+                length < min(len(candidate), len(analyzed))
+                and candidate[-1 - length] == analyzed[-1 - length]
+            ):
+                length += 1
+            if length > best_length:
+                best, best_length = [candidate], length
+            elif length == best_length:
+                best.append(candidate)
+        if not best or (len(best) > 1 and best_length < 2):
+            return None  # only the file name in common, with several files of that name
+        if len(best) == 1:
+            return self._files[best[0]]
+        merged: dict[int, int] = {}
+        for candidate in best:
+            for row, hits in self._files[candidate].items():
+                merged[row] = max(merged.get(row, 0), hits)
+        return merged
+
+    def annotate(self, path: str, entities: list[Entity]) -> None:
+        """Give *entities*, of the analyzed file *path*, their ``coverage`` attrs."""
+        lines: dict[int, int] | None = self.lines(path)
+        if lines is None:
+            return
+        rows: list[int] = sorted(lines)
+        # covered[i]: how many of the first i coverable rows ran
+        covered: list[int] = [0, *itertools.accumulate(1 if lines[r] > 0 else 0 for r in rows)]
+        for entity in entities:
+            if "cell" in entity.attrs:
+                continue  # rows count from the top of the cell
+            first: int = bisect.bisect_left(rows, entity.row)
+            last: int = bisect.bisect_right(rows, entity.end_row)
+            if last > first:
+                ran: int = covered[last] - covered[first]
+                entity.attrs["coverage"] = round(ran / (last - first), 4)
@@ -0,0 +1,111 @@
+"""Likely hard-coded secrets in string literals, for the ``secrets`` feature.
+
+Extraction hands every string literal to find_secrets, which matches it
+against the formats of well-known credentials (AWS access key IDs,
+GitHub and Slack tokens, private key blocks, ...) and otherwise flags
+long tokens of random-looking characters, measured by their Shannon
+entropy.  Both are heuristics: a test fixture looks like a key, and a
+key split across literals is missed.
+
+The secret itself is never kept: results name what was found and where.
+"""
+
+from __future__ import annotations
+
+import math
+import re
+from collections import Counter
+from dataclasses import dataclass
+
+# Shortest token the entropy check considers; shorter ones are rarely keys.
+MIN_TOKEN_LENGTH: int = 20
+
+# Bits per character above which a token counts as random, by alphabet:
+# hex digits carry at most 4 bits, base64 characters at most 6.
+HEX_ENTROPY: float = 3.0
+BASE64_ENTROPY: float = 4.5
+
+
+@dataclass(frozen=True)
+class Secret:
+    rule: str  # a key of SECRET_RULES
+    offset: int  # characters into the literal's contents
+    entropy: float | None = None  # for high-entropy-string
+
+
+# Rule -> what it finds, as messages name it.
+SECRET_RULES: dict[str, str] = {
+    "aws-access-key-id": "AWS access key ID",
+    "aws-secret-access-key": "AWS secret access key",
+    "github-token": "GitHub token",
+    "google-api-key": "Google API key",
+    "private-key": "private key",
+    "slack-token": "Slack token",
+    "stripe-secret-key": "Stripe secret key",
+    "high-entropy-string": "high-entropy string",
+}
+
+_PATTERNS: tuple[tuple[str, re.Pattern[str]], ...] = (
+    ("aws-access-key-id", re.compile(r"\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b")),
+    ("github-token", re.compile(r"\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_\w{82})\b")),
+    ("google-api-key", re.compile(r"\bAIza[0-9A-Za-z_-]{35}\b")),
+    ("private-key", re.compile(r"-----BEGIN (?:[A-Z]+ )*PRIVATE KEY( BLOCK)?-----")),
+    ("slack-token", re.compile(r"\bxox[abprs]-[0-9A-Za-z-]{10,}\b")),
+    ("stripe-secret-key", re.compile(r"\b[sr]k_live_[0-9A-Za-z]{24,}\b")),
+)
+
+# An AWS secret access key is 40 base64 characters, only told apart by
+# what it is assigned to or written next to.
+_AWS_SECRET_RE: re.Pattern[str] = re.compile(
+    r"(?<![A-Za-z0-9+/])[A-Za-z0-9+/]{40}(?![A-Za-z0-9+/=])",
+)
+_AWS_CONTEXT_RE: re.Pattern[str] = re.compile(r"aws.{0,20}secret|secret.?access.?key", re.I)
+
+_TOKEN_RE: re.Pattern[str] = re.compile(r"[A-Za-z0-9+/=_-]{%d,}" % MIN_TOKEN_LENGTH)
+_HEX_RE: re.Pattern[str] = re.compile(r"[0-9a-fA-F]+")
+# Shapes of long tokens that are not secrets.
+_UUID_RE: re.Pattern[str] = re.compile(r"[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}")
+_WORDS_RE: re.Pattern[str] = re.compile(r"(?:[A-Za-z][a-z]+|[A-Z]+|\d+|[_/-])+")
+
+
+def entropy(token: str) -> float:
+    """Shannon entropy of *token*, in bits per character."""
+    counts: Counter[str] = Counter(token)
+    return -sum(n / len(token) * math.log2(n / len(token)) for n in counts.values())
+
+
+def _random(token: str) -> float | None:
+    """The entropy of *token* if it looks random, else None."""
+    if _UUID_RE.fullmatch(token) or _WORDS_RE.fullmatch(token):
+        return None  # ids and identifiers, paths, and CamelCase words
+    if not any(c.isdigit() for c in token) or not any(c.isalpha() for c in token):
+        return None
+    bits: float = entropy(token)
+    threshold: float = HEX_ENTROPY if _HEX_RE.fullmatch(token) else BASE64_ENTROPY
+    return bits if bits >= threshold else None
+
+
+def find_secrets(text: str, context: str = "") -> list[Secret]:
+    """The likely secrets in the string literal contents *text*.
+
+    *context* is the source line the literal is on, which tells an AWS
+    secret access key from other 40-character tokens.
+    """
+    found: list[Secret] = []
+    covered: list[tuple[int, int]] = []
+    for rule, pattern in _PATTERNS:
+        for match in pattern.finditer(text):
+            found.append(Secret(rule, match.start()))
+            covered.append(match.span())
+    if _AWS_CONTEXT_RE.search(context):
+        for match in _AWS_SECRET_RE.finditer(text):
+            found.append(Secret("aws-secret-access-key", match.start()))
+            covered.append(match.span())
+    for match in _TOKEN_RE.finditer(text):
+        if any(start < match.end() and match.start() < end for start, end in covered):
+            continue
+        bits: float | None = _random(match.group(0))
+        if bits is not None:
+            found.append(Secret("high-entropy-string", match.start(), round(bits, 2)))
+    found.sort(key=lambda s: s.offset)
+    return found
@@ -0,0 +1,309 @@
+"""Background process for ``autosg daemon``: commands run warm.
+
+The daemon listens on a Unix socket (see client.py for the protocol) and
+runs one command at a time in its own process, in the client's working
+directory and the environment it sends, with the client's stdout and
+stderr.  Between
+commands it keeps the grammars and parsers loaded and the most recent
+extraction results in memory, in front of the ``.autosg/cache``
+database, so repeated commands skip both start-up and re-extraction.
+Config files are read afresh for every command.
+
+It exits after ``idle_timeout`` seconds without a command, on ``autosg
+daemon stop``, or when a client runs newer autosg code than it was
+started from.  ``autosg daemon profile`` samples the command running
+meanwhile into a pprof profile (see tracing.py); requests other than
+commands are answered while one runs.
+"""
+
+from __future__ import annotations
+
+import base64
+import io
+import json
+import logging
+import os
+import socket
+import socketserver
+import subprocess
+import sys
+import threading
+import time
+import traceback
+from pathlib import Path
+from typing import Any
+
+import click
+
+from .caching import enable_memory_cache, memory_cache_size
+from .client import UnsafeSocketError, check_private, connect, fingerprint, send, socket_path
+from .features import clear_features
+from .overriding import clear_queries
+from .parsing import clear_filetypes
+from .plugins import clear_plugins
+from .sinks import clear_sinks
+from .tracing import sample_for
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+DEFAULT_IDLE_TIMEOUT: float = 30 * 60
+
+# Extraction results kept in memory between commands.
+MEMORY_CACHE_ENTRIES: int = 100_000
+
+# How long ``daemon start`` waits for the new process to listen.
+_START_TIMEOUT: float = 10.0
+
+# How often the server checks whether to exit while no connection comes.
+_POLL_INTERVAL: float = 0.5
+
+
+class DaemonError(Exception):
+    """Raised when the daemon cannot be started, reached, or stopped."""
+
+
+class _Relay(io.TextIOBase):
+    """A text stream sending what is written to the client as *name* messages."""
+
+    def __init__(self, sock: socket.socket, name: str) -> None:
+        super().__init__()
+        self._sock: socket.socket = sock
+        self._name: str = name
+
+    @property
+    def encoding(self) -> str:  # type: ignore[override]
+        return "utf-8"
+
+    def writable(self) -> bool:
+        return True
+
+    def write(self, text: str) -> int:
+        if not isinstance(text, str):
+            # Also tells click this is no binary stream.
+            raise TypeError(f"write() argument must be str, not {type(text).__name__}")
+        if text:
+            send(self._sock, {self._name: text})
+        return len(text)
+
+
+def _exit_status(exc: SystemExit) -> int:
+    if exc.code is None or isinstance(exc.code, int):
+        return exc.code or 0
+    print(exc.code, file=sys.stderr)
+    return 1
+
+
+def _run(command: click.Command, request: dict[str, Any], sock: socket.socket) -> int:
+    """Run one client's command as ``autosg`` would, restoring this process after."""
+    cwd: str = os.getcwd()
+    env: dict[str, str] = dict(os.environ)
+    streams: tuple[Any, Any] = (sys.stdout, sys.stderr)
+    package_logger: logging.Logger = logging.getLogger("autosg")
+    handlers: list[logging.Handler] = list(package_logger.handlers)
+    level: int = package_logger.level
+    # Plugins, queries, features, filetypes, and sinks are set from each command's config file.
+    clear_features()
+    clear_filetypes()
+    clear_plugins()
+    clear_queries()
+    clear_sinks()
+    try:
+        os.chdir(request["cwd"])
+        os.environ.clear()
+        os.environ.update(request["env"])
+        sys.stdout, sys.stderr = _Relay(sock, "stdout"), _Relay(sock, "stderr")
+        try:
+            command.main(request["args"], standalone_mode=True)
+        except SystemExit as exc:
+            return _exit_status(exc)
+        except Exception:
+            traceback.print_exc()  # to the client, as a crash in its own process would
+            return 1
+        return 0
+    finally:
+        sys.stdout, sys.stderr = streams
+        package_logger.handlers[:] = handlers
+        package_logger.setLevel(level)
+        os.environ.clear()
+        os.environ.update(env)
+        os.chdir(cwd)
+
+
+class _Server(socketserver.ThreadingMixIn, socketserver.UnixStreamServer):
+    daemon_threads = True
+
+    def __init__(self, path: Path, command: click.Command, idle_timeout: float) -> None:
+        super().__init__(str(path), _Handler)
+        self.command: click.Command = command
+        self.timeout: float = _POLL_INTERVAL
+        self.idle_timeout: float = idle_timeout
+        self.fingerprint: str = fingerprint()
+        self.started: float = time.time()
+        self.commands: int = 0
+        self.stopping: bool = False
+        # Held by the command running, since commands change the process's
+        # working directory, environment, and streams.
+        self.busy: threading.Lock = threading.Lock()
+        self.idle_since: float = time.monotonic()
+
+    def handle_timeout(self) -> None:
+        if self.busy.locked() or time.monotonic() - self.idle_since < self.idle_timeout:
+            return
+        logger.info("idle for %.0fs, exiting", self.idle_timeout)
+        self.stopping = True
+
+
+class _Handler(socketserver.StreamRequestHandler):
+    server: _Server
+
+    def handle(self) -> None:
+        try:
+            self._handle()
+        finally:
+            self.server.idle_since = time.monotonic()
+
+    def _handle(self) -> None:
+        try:
+            request: dict[str, Any] = json.loads(self.rfile.readline())
+        except ValueError:
+            return
+        if request.get("command") == "status":
+            send(self.request, {
+                "pid": os.getpid(), "started": self.server.started,
+                "commands": self.server.commands, "cached": memory_cache_size(),
+            })
+        elif request.get("command") == "stop":
+            self.server.stopping = True
+            send(self.request, {"stopping": True})
+        elif request.get("command") == "profile":
+            profile: bytes = sample_for(float(request.get("seconds", 30)))
+            send(self.request, {"profile": base64.b64encode(profile).decode()})
+        elif request.get("fingerprint") != self.server.fingerprint:
+            logger.info("a client runs different autosg code, exiting")
+            self.server.stopping = True
+            send(self.request, {"stale": True})
+        else:
+            with self.server.busy:
+                self.server.commands += 1
+                try:
+                    status: int = _run(self.server.command, request, self.request)
+                    send(self.request, {"exit": status})
+                except OSError:
+                    logger.info("client went away")  # e.g. interrupted; its output is moot
+
+
+def _private_dir(directory: Path) -> None:
+    """Create the socket's *directory*, or check the one there is only this user's."""
+    try:
+        directory.mkdir(mode=0o700, parents=True)
+        os.chmod(directory, 0o700)  # whatever the umask
+    except FileExistsError:
+        pass
+    try:
+        check_private(directory)
+    except UnsafeSocketError as exc:
+        raise DaemonError(f"{exc}; remove it, or set AUTOSG_DAEMON_SOCKET") from None
+
+
+def _connect(path: Path, timeout: float | None = None) -> socket.socket | None:
+    try:
+        return connect(path, timeout)
+    except UnsafeSocketError as exc:
+        raise DaemonError(str(exc)) from None
+
+
+def run_daemon(command: click.Command, idle_timeout: float = DEFAULT_IDLE_TIMEOUT) -> None:
+    """Serve *command* (the ``autosg`` group) at :func:`socket_path` until stopped."""
+    path: Path = socket_path()
+    _private_dir(path.parent)
+    probe: socket.socket | None = _connect(path)
+    if probe is not None:
+        probe.close()
+        raise DaemonError(f"a daemon is already listening on {path}")
+    path.unlink(missing_ok=True)  # left behind by one that was killed
+    enable_memory_cache(MEMORY_CACHE_ENTRIES)
+    server: _Server = _Server(path, command, idle_timeout)
+    try:
+        os.chmod(path, 0o600)
+        logger.info("listening on %s", path)
+        while not server.stopping:
+            server.handle_request()
+        with server.busy:  # let the command running finish
+            pass
+    finally:
+        server.server_close()
+        path.unlink(missing_ok=True)
+
+
+def start_daemon(idle_timeout: float = DEFAULT_IDLE_TIMEOUT) -> int:
+    """Start a daemon in the background and wait until it listens; returns its pid."""
+    path: Path = socket_path()
+    _private_dir(path.parent)
+    log_path: Path = path.with_suffix(".log")
+    # Found again from any working directory, even when not installed.
+    env: dict[str, str] = dict(os.environ)
+    env["PYTHONPATH"] = os.pathsep.join(
+        p for p in (str(Path(__file__).parent.parent), env.get("PYTHONPATH")) if p
+    )
+    with open(log_path, "ab") as log:
+        process: subprocess.Popen[bytes] = subprocess.Popen(
+            [
+                sys.executable, "-m", "autosg", "daemon", "start", "--foreground",
+                "--idle-timeout", str(idle_timeout),
+            ],
+            stdin=subprocess.DEVNULL,
+            stdout=log,
+            stderr=subprocess.STDOUT,
+            cwd=path.parent,
+            env=env,
+            start_new_session=True,
+        )
+    deadline: float = time.monotonic() + _START_TIMEOUT
+    while time.monotonic() < deadline:
+        if process.poll() is not None:
+            raise DaemonError(
+                f"the daemon exited with status {process.returncode}; see {log_path}",
+            )
+        sock: socket.socket | None = _connect(path)
+        if sock is not None:
+            sock.close()
+            return process.pid
+        time.sleep(0.05)
+    raise DaemonError(f"the daemon did not start listening on {path}; see {log_path}")
+
+
+def _ask(message: dict[str, Any], wait: float = 0.0) -> dict[str, Any] | None:
+    """The daemon's answer to *message*, given *wait* more seconds; None when none runs."""
+    sock: socket.socket | None = _connect(socket_path(), timeout=_START_TIMEOUT + wait)
+    if sock is None:
+        return None
+    with sock:
+        try:
+            send(sock, message)
+            line: bytes = sock.makefile("rb").readline()
+        except OSError as exc:
+            raise DaemonError(f"cannot reach the daemon: {exc}") from None
+    if not line:
+        raise DaemonError("the daemon closed the connection")
+    return json.loads(line)  # type: ignore[no-any-return]
+
+
+def daemon_status() -> dict[str, Any] | None:
+    """Pid, start time, command count, and cached results of the daemon, if running."""
+    return _ask({"command": "status"})
+
+
+def profile_daemon(seconds: float) -> bytes | None:
+    """A pprof profile of the daemon over the next *seconds*, or None if none runs."""
+    answer: dict[str, Any] | None = _ask({"command": "profile", "seconds": seconds}, seconds)
+    return base64.b64decode(answer["profile"]) if answer is not None else None
+
+
+def stop_daemon() -> bool:
+    """Ask the daemon to exit once its current command is done; False if none runs."""
+    if _ask({"command": "stop"}) is None:
+        return False
+    deadline: float = time.monotonic() + _START_TIMEOUT
+    while socket_path().exists() and time.monotonic() < deadline:
+        time.sleep(0.05)
+    return True
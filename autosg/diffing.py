@@ -0,0 +1,373 @@
+"""Comparison of two analysis results: what entities and edges changed.
+
+Either side may be a directory or a git revision.  Revisions are exported
+with ``git archive`` into a temporary directory and analyzed like any
+other tree, so the extraction cache is shared between both sides.
+
+Entities are matched by (path, kind, qualified name), where the qualified
+name joins the names of enclosing declarations (``Server.Start``).  A
+matched entity counts as changed when its own source text differs,
+ignoring whitespace and the text of nested declarations, so editing one
+method does not also report the class around it.
+
+An entity removed in one place and added in another with the same
+structural fingerprint (see fingerprinting) was renamed or moved rather
+than replaced, when no other entity of its kind shares the fingerprint.
+It is reported once, and its edges are compared under its new key.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import hashlib
+import os
+import subprocess
+import tarfile
+import tempfile
+from collections.abc import Iterator
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Any
+
+from .analysis import FileResult, Options, Result, analyze
+from .annotating import FileEncoding, read_source_utf8
+from .extracting import Entity, qualified_names
+
+# (path relative to the compared root, kind, qualified name)
+EntityKey = tuple[str, str, str]
+
+
+@dataclass
+class EntityChange:
+    """An entity that was added, removed, or changed between two trees."""
+
+    status: str  # "added", "removed", "changed", "renamed", or "moved"
+    path: str
+    kind: str
+    name: str  # qualified name
+    old: Entity | None = None
+    new: Entity | None = None
+    # Where a renamed or moved entity was: (path, qualified name).
+    was: tuple[str, str] | None = None
+
+    def to_dict(self) -> dict[str, Any]:
+        data: dict[str, Any] = {
+            "status": self.status, "path": self.path, "kind": self.kind, "name": self.name,
+        }
+        if self.was is not None:
+            data["was"] = {"path": self.was[0], "name": self.was[1]}
+        for side, entity in (("old", self.old), ("new", self.new)):
+            if entity is not None:
+                data[side] = {"row": entity.row, "col": entity.col,
+                              "end_row": entity.end_row, "end_col": entity.end_col}
+        return data
+
+
+@dataclass
+class EdgeChange:
+    """An edge that exists on only one side."""
+
+    status: str  # "added" or "removed"
+    kind: str
+    source: EntityKey
+    target: EntityKey
+
+    def to_dict(self) -> dict[str, Any]:
+        return {
+            "status": self.status,
+            "kind": self.kind,
+            "source": {"path": self.source[0], "kind": self.source[1], "name": self.source[2]},
+            "target": {"path": self.target[0], "kind": self.target[1], "name": self.target[2]},
+        }
+
+
+@dataclass
+class Diff:
+    """Every difference between two trees, sorted for stable output."""
+
+    entities: list[EntityChange] = field(default_factory=list)
+    edges: list[EdgeChange] = field(default_factory=list)
+
+    def to_dict(self) -> dict[str, Any]:
+        return {
+            "entities": [c.to_dict() for c in self.entities],
+            "edges": [c.to_dict() for c in self.edges],
+        }
+
+    def __bool__(self) -> bool:
+        return bool(self.entities or self.edges)
+
+
+# ---------------------------------------------------------------------------
+# Materializing revisions
+# ---------------------------------------------------------------------------
+
+
+class DiffError(Exception):
+    """Raised when a revision cannot be resolved or exported."""
+
+
+def _git(args: list[str], cwd: Path) -> bytes:
+    try:
+        proc: subprocess.CompletedProcess[bytes] = subprocess.run(
+            ["git", *args], cwd=cwd, capture_output=True, check=True,
+        )
+    except FileNotFoundError:
+        raise DiffError("git is not installed") from None
+    except subprocess.CalledProcessError as exc:
+        message: str = exc.stderr.decode(errors="replace").strip()
+        raise DiffError(message or f"git {' '.join(args)} failed") from None
+    return proc.stdout
+
+
+@contextlib.contextmanager
+def materialize(spec: str) -> Iterator[Path]:
+    """Yield a directory holding *spec*: a directory as-is, or a git revision.
+
+    A revision is exported from the repository containing the working
+    directory; the yielded path corresponds to the working directory
+    within that export, so both sides of a diff line up.
+    """
+    if os.path.isdir(spec):
+        yield Path(spec)
+        return
+    cwd: Path = Path.cwd()
+    toplevel: Path = Path(_git(["rev-parse", "--show-toplevel"], cwd).decode().strip())
+    prefix: str = _git(["rev-parse", "--show-prefix"], cwd).decode().strip()
+    try:
+        _git(["rev-parse", "--verify", "--quiet", f"{spec}^{{commit}}"], cwd)
+    except DiffError:
+        raise DiffError(f"{spec!r} is neither a directory nor a git revision") from None
+    archive: bytes = _git(["archive", "--format=tar", spec], toplevel)
+    with tempfile.TemporaryDirectory(prefix="autosg-diff-") as tmp:
+        with tempfile.TemporaryFile() as buffer:
+            buffer.write(archive)
+            buffer.seek(0)
+            with tarfile.open(fileobj=buffer) as tar:
+                tar.extractall(tmp, filter="data")
+        root: Path = Path(tmp) / prefix
+        root.mkdir(parents=True, exist_ok=True)  # subtree may not exist at *spec*
+        yield root
+
+
+# ---------------------------------------------------------------------------
+# Comparison
+# ---------------------------------------------------------------------------
+
+
+def _line_offsets(text: str) -> list[int]:
+    """Character offset at which each (1-indexed) row starts."""
+    offsets: list[int] = [0]
+    for line in text.split("\n"):
+        offsets.append(offsets[-1] + len(line) + 1)
+    return offsets
+
+
+def _own_digests(file_result: FileResult, text: str) -> dict[int, str]:
+    """Hash each entity's text with nested entities and whitespace removed."""
+    offsets: list[int] = _line_offsets(text)
+
+    def span(e: Entity) -> tuple[int, int]:
+        return offsets[e.row - 1] + e.col - 1, offsets[e.end_row - 1] + e.end_col - 1
+
+    children: dict[int, list[Entity]] = {}
+    for entity in file_result.entities:
+        if entity.parent is not None:
+            children.setdefault(entity.parent, []).append(entity)
+    digests: dict[int, str] = {}
+    for entity in file_result.entities:
+        start, end = span(entity)
+        pieces: list[str] = []
+        for child in children.get(entity.id, []):
+            child_start, child_end = span(child)
+            pieces.append(text[start:child_start])
+            start = max(start, child_end)
+        pieces.append(text[start:end])
+        own: str = "".join("".join(pieces).split())
+        digests[entity.id] = hashlib.sha256(own.encode()).hexdigest()
+    return digests
+
+
+@dataclass
+class _Side:
+    """One analyzed tree, indexed by entity key."""
+
+    entities: dict[EntityKey, Entity]
+    digests: dict[EntityKey, str]
+    edges: set[tuple[str, EntityKey, EntityKey]]
+
+
+def _index(result: Result, root: Path, sources: bool = True) -> _Side:
+    keys: dict[int, EntityKey] = {}
+    entities: dict[EntityKey, Entity] = {}
+    digests: dict[EntityKey, str] = {}
+    for file_result in result.files:
+        rel_path: str = Path(os.path.relpath(file_result.path, root)).as_posix()
+        qualified_by_id: dict[int, str] = qualified_names(file_result.entities)
+        source: tuple[bytes, FileEncoding] | None = (
+            read_source_utf8(Path(file_result.path)) if sources else None
+        )
+        own: dict[int, str] = {}
+        if source is not None:
+            own = _own_digests(file_result, source[0].decode("utf-8", errors="replace"))
+        for entity in file_result.entities:
+            qualified: str = rel_path if entity.kind == "file" else qualified_by_id[entity.id]
+            key: EntityKey = (rel_path, entity.kind, qualified)
+            # Same-named siblings (overloads, repeated impl blocks) get an ordinal.
+            ordinal: int = 2
+            while key in entities:
+                key = (rel_path, entity.kind, f"{qualified}#{ordinal}")
+                ordinal += 1
+            keys[entity.id] = key
+            entities[key] = entity
+            if entity.id in own:
+                digests[key] = own[entity.id]
+    edges: set[tuple[str, EntityKey, EntityKey]] = {
+        (e.kind, keys[e.source], keys[e.target])
+        for e in result.edges
+        if e.target is not None and e.source in keys and e.target in keys
+    }
+    return _Side(entities, digests, edges)
+
+
+def _relocations(
+    removed: list[tuple[EntityKey, Entity]], added: list[tuple[EntityKey, Entity]],
+) -> dict[EntityKey, EntityKey]:
+    """Old key -> new key of entities whose fingerprint is unique on both sides."""
+    # (kind, fingerprint) -> keys; a fingerprint seen twice matches nothing.
+    before: dict[tuple[str, str], list[EntityKey]] = {}
+    after: dict[tuple[str, str], list[EntityKey]] = {}
+    for pairs, found in ((removed, before), (added, after)):
+        for key, entity in pairs:
+            structure: str | None = entity.attrs.get("fingerprint")
+            if structure is not None:
+                found.setdefault((key[1], structure), []).append(key)
+    return {
+        olds[0]: after[fingerprint][0]
+        for fingerprint, olds in before.items()
+        if len(olds) == 1 and len(after.get(fingerprint, [])) == 1
+    }
+
+
+def diff_results(
+    old: Result, old_root: Path, new: Result, new_root: Path, sources: bool = True,
+) -> Diff:
+    """Compare two results whose paths are relative to their respective roots.
+
+    Without *sources*, the files are not re-read (they may be gone, as for
+    stored snapshots) and no entity counts as changed.
+    """
+    before: _Side = _index(old, old_root, sources)
+    after: _Side = _index(new, new_root, sources)
+    relocated: dict[EntityKey, EntityKey] = _relocations(
+        [(k, e) for k, e in before.entities.items() if k not in after.entities],
+        [(k, e) for k, e in after.entities.items() if k not in before.entities],
+    )
+    arrived: dict[EntityKey, EntityKey] = {new: old for old, new in relocated.items()}
+    diff: Diff = Diff()
+    for key in sorted(before.entities.keys() | after.entities.keys()):
+        path, kind, name = key
+        old_entity: Entity | None = before.entities.get(key)
+        new_entity: Entity | None = after.entities.get(key)
+        if key in relocated:
+            continue  # reported under its new key
+        if key in arrived:
+            origin: EntityKey = arrived[key]
+            diff.entities.append(EntityChange(
+                "moved" if origin[2].rsplit(".", 1)[-1] == name.rsplit(".", 1)[-1] else "renamed",
+                path, kind, name, old=before.entities[origin], new=new_entity,
+                was=(origin[0], origin[2]),
+            ))
+        elif old_entity is None:
+            diff.entities.append(EntityChange("added", path, kind, name, new=new_entity))
+        elif new_entity is None:
+            diff.entities.append(EntityChange("removed", path, kind, name, old=old_entity))
+        elif kind != "file" and before.digests.get(key) != after.digests.get(key):
+            diff.entities.append(
+                EntityChange("changed", path, kind, name, old=old_entity, new=new_entity),
+            )
+    # Edges of relocated entities are compared as if they had always been there.
+    moved_edges: set[tuple[str, EntityKey, EntityKey]] = {
+        (kind, relocated.get(source, source), relocated.get(target, target))
+        for kind, source, target in before.edges
+    }
+    for kind, source, target in moved_edges - after.edges:
+        diff.edges.append(EdgeChange("removed", kind, source, target))
+    for kind, source, target in after.edges - moved_edges:
+        diff.edges.append(EdgeChange("added", kind, source, target))
+    diff.edges.sort(key=lambda c: (c.source, c.target, c.kind, c.status))
+    return diff
+
+
+def diff_trees(old_spec: str, new_spec: str, options: Options | None = None) -> Diff:
+    """Analyze two directories or git revisions and compare them."""
+    options = options or Options()
+    with materialize(old_spec) as old_root, materialize(new_spec) as new_root:
+        old: Result = analyze(old_root, options)
+        new: Result = analyze(new_root, options)
+        # Sources are re-read for digests, so compare before the exports vanish.
+        return diff_results(old, old_root, new, new_root)
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+_SIGILS: dict[str, str] = {
+    "added": "+", "removed": "-", "changed": "~", "renamed": ">", "moved": ">",
+}
+
+
+def _key_label(key: EntityKey) -> str:
+    return f"{key[2]} ({key[0]})"
+
+
+def render_text(diff: Diff) -> str:
+    """One line per change, ``+``/``-``/``~`` prefixed like a patch."""
+    lines: list[str] = []
+    for change in diff.entities:
+        line: str = f"{_SIGILS[change.status]} {change.kind} {change.name}  {change.path}"
+        if change.was is not None:
+            line += f"  (was {change.was[1]} in {change.was[0]})"
+        lines.append(line)
+    for edge in diff.edges:
+        lines.append(
+            f"{_SIGILS[edge.status]} {edge.kind} "
+            f"{_key_label(edge.source)} -> {_key_label(edge.target)}",
+        )
+    counts: dict[str, int] = {s: 0 for s in _SIGILS}
+    for change in diff.entities:
+        counts[change.status] += 1
+    lines.append(
+        f"{counts['added']} added, {counts['removed']} removed, "
+        f"{counts['changed']} changed, {counts['renamed'] + counts['moved']} renamed or moved "
+        f"entities; {len(diff.edges)} edge change(s).",
+    )
+    return "\n".join(lines) + "\n"
+
+
+def render_markdown(diff: Diff) -> str:
+    """A summary suitable for posting as a pull request comment."""
+    if not diff:
+        return "No API surface changes.\n"
+    out: list[str] = ["### API surface changes", ""]
+    for status in ("added", "removed", "changed", "renamed", "moved"):
+        changes: list[EntityChange] = [c for c in diff.entities if c.status == status]
+        if not changes:
+            continue
+        out.append(f"**{status.capitalize()}** ({len(changes)})")
+        out.append("")
+        for c in changes:
+            line: str = f"- `{c.kind} {c.name}` in `{c.path}`"
+            if c.was is not None:
+                line += f", was `{c.was[1]}` in `{c.was[0]}`"
+            out.append(line)
+        out.append("")
+    if diff.edges:
+        out.append(f"**Edges** ({len(diff.edges)})")
+        out.append("")
+        out.extend(
+            f"- {e.status} `{e.kind}`: `{e.source[2]}` → `{e.target[2]}`" for e in diff.edges
+        )
+        out.append("")
+    return "\n".join(out)
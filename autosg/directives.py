@@ -0,0 +1,133 @@
+"""Magic comments: ``autosg:`` directives that annotate entities from source.
+
+A comment holding ``autosg:`` followed by space- or comma-separated
+settings annotates an entity with them: ``// autosg:layer=domain
+owner=payments`` above a function, or ``# autosg:ignore`` after a
+``def``.  ``key=value`` sets the attr ``key`` to the string ``value``, and a bare
+``key`` sets it to true, overriding what extraction recorded.  ``ignore``
+drops the entity, with everything inside it and the references made
+there, from the analysis; on a file, it skips the file.
+
+A directive after code on its line annotates the outermost entity
+starting on that line.  One on a line of its own annotates the entity
+starting on the next line that is not a comment or an annotation
+(``@Override``, ``#[derive]``).  When no entity starts there, either
+annotates the innermost entity around the comment: at the top of a
+file, the file.
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass
+from typing import Any
+
+from .extracting import Edge, Entity
+
+# A directive in a comment: after a comment opener that starts the line or
+# follows a space, or after a ``*`` continuing a block comment.
+_DIRECTIVE_RE: re.Pattern[str] = re.compile(
+    r"(?:^|\s)(?://+|#+|--|/\*+|<!--|;+|\*)\s*autosg:(?P<settings>[^\n]*)",
+)
+
+_SETTING_RE: re.Pattern[str] = re.compile(r"([\w.-]+)(?:=(\S*))?")
+
+# Lines between a directive and its declaration: comments and annotations.
+_PASSED_OVER: tuple[str, ...] = ("//", "#", "--", "/*", "*", ";", "<!--", "@", "[")
+
+
+@dataclass(frozen=True)
+class Directive:
+    row: int  # 1-indexed
+    trailing: bool  # after code on its line
+    settings: dict[str, Any]
+
+
+def _settings(text: str) -> dict[str, Any]:
+    text = re.split(r"\*/|-->", text, maxsplit=1)[0]
+    return {
+        key: value if value is not None else True
+        for key, value in (
+            (m.group(1), m.group(2)) for m in _SETTING_RE.finditer(text.replace(",", " "))
+        )
+    }
+
+
+def directives(source_utf8: bytes) -> list[Directive]:
+    """The ``autosg:`` directives in the comments of a file, in order."""
+    if b"autosg:" not in source_utf8:
+        return []
+    found: list[Directive] = []
+    for row, line in enumerate(source_utf8.decode("utf-8", errors="replace").split("\n"), 1):
+        match: re.Match[str] | None = _DIRECTIVE_RE.search(line)
+        if match is None:
+            continue
+        settings: dict[str, Any] = _settings(match.group("settings"))
+        if settings:
+            found.append(Directive(row, bool(line[: match.start()].strip()), settings))
+    return found
+
+
+def _target(directive: Directive, entities: list[Entity], lines: list[str]) -> Entity:
+    """The entity *directive* annotates."""
+    row: int = directive.row
+    if not directive.trailing:
+        while row < len(lines) and lines[row].strip().startswith(_PASSED_OVER):
+            row += 1
+        row += 1  # the line after the comment and what it passes over
+    starting: Entity | None = next(
+        (e for e in entities if e.row == row and e.kind != "file"), None,
+    )
+    if starting is not None:
+        return starting
+    # Entities come in pre-order, so the last one around the comment is the innermost.
+    around: list[Entity] = [
+        e for e in entities if e.row <= directive.row <= e.end_row
+    ]
+    return around[-1] if around else entities[0]
+
+
+def annotate(
+    entities: list[Entity], references: list[Edge], source_utf8: bytes,
+) -> tuple[list[Entity], list[Edge]] | None:
+    """One file's entities and references with its directives applied; None to skip it.
+
+    Entities left after ``ignore`` are renumbered to stay consecutive.
+    """
+    found: list[Directive] = directives(source_utf8)
+    if not found or not entities:
+        return entities, references
+    lines: list[str] = source_utf8.decode("utf-8", errors="replace").split("\n")
+    ignored: set[int] = set()
+    for directive in found:
+        target: Entity = _target(directive, entities, lines)
+        settings: dict[str, Any] = dict(directive.settings)
+        if settings.pop("ignore", None):
+            ignored.add(target.id)
+        target.attrs.update(settings)
+    if entities[0].id in ignored:
+        return None
+    if not ignored:
+        return entities, references
+    first: int = entities[0].id
+    renumbered: dict[int, int] = {}
+    kept: list[Entity] = []
+    for entity in entities:  # parents come before their children
+        if entity.id in ignored or entity.parent in ignored:
+            ignored.add(entity.id)
+            continue
+        renumbered[entity.id] = first + len(kept)
+        kept.append(entity)
+    for entity in kept:
+        entity.id = renumbered[entity.id]
+        if entity.parent is not None:
+            entity.parent = renumbered[entity.parent]
+    kept_references: list[Edge] = []
+    for ref in references:
+        if ref.source in ignored or ref.target in ignored:
+            continue
+        ref.source = renumbered[ref.source]
+        if ref.target is not None:
+            ref.target = renumbered[ref.target]
+        kept_references.append(ref)
+    return kept, kept_references
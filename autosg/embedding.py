@@ -0,0 +1,391 @@
+"""Languages embedded in other files, extracted in place.
+
+A region of a host file written in another language (a ``<script>`` in
+HTML, the shell of a CI step) is parsed with everything around it blanked
+out, keeping line breaks, so the entities found in it have their rows,
+columns, and byte offsets in the host file.  Each region becomes a
+``script`` entity, whose ``language`` is the embedded one, enclosing the
+declarations in it:
+
+- HTML: inline ``<script>`` blocks, as JavaScript or TypeScript by their
+  ``type`` or ``lang``; ``type="module"`` is marked ``"module": true``.
+- GitHub Actions workflows and composite actions: the ``run`` of each
+  step, named after the step and recording its ``job``; steps with a
+  ``shell`` other than bash or sh are skipped.
+- GitLab CI (``.gitlab-ci.yml``): each line of a job's ``script``,
+  ``before_script``, and ``after_script``, named after the job and
+  recording its ``key``.
+
+Shell regions list the ``commands`` they run.
+
+Go ``text/template`` and ``html/template`` files (``.gohtml``,
+``.gotmpl``, ``.tmpl``, ``.tpl``) are read here too.  ``{{define}}`` and
+``{{block}}`` give ``template`` entities, and the templates one invokes
+with ``{{template "name"}}`` are listed in its ``templates`` attr (the
+file's, outside any).  Their ``<script>`` blocks are extracted as in
+HTML, with actions blanked out and without syntax errors, which the
+actions would cause.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import re
+from collections.abc import Callable, Iterator
+from dataclasses import dataclass, field
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from tree_sitter import Node, Tree
+
+from .extracting import (
+    Edge, Entity, ParseError, assign_uids, extract_entities, file_entity, shell_commands,
+    syntax_errors,
+)
+from .parsing import byte_col_to_char_col, parse_tree
+
+TEMPLATE_EXTENSIONS: dict[str, str] = {
+    ".gohtml": "gotemplate", ".gotmpl": "gotemplate", ".tmpl": "gotemplate", ".tpl": "gotemplate",
+}
+
+
+def template_language(path: Path) -> str | None:
+    return TEMPLATE_EXTENSIONS.get(path.suffix)
+
+
+@dataclass(frozen=True)
+class Region:
+    """Bytes *start* to *end* of a host file, written in *language*."""
+
+    language: str
+    start: int
+    end: int
+    name: str
+    attrs: dict[str, Any] = field(default_factory=dict)
+
+
+def position(source_utf8: bytes, offset: int) -> tuple[int, int]:
+    """The 1-indexed row and character column of byte *offset*."""
+    line: bytes = source_utf8[source_utf8.rfind(b"\n", 0, offset) + 1 : offset]
+    return source_utf8.count(b"\n", 0, offset) + 1, byte_col_to_char_col(line, len(line) + 1)
+
+
+def extract_region(
+    source_utf8: bytes, language: str, start: int, end: int, path: str, first: int,
+    parent: int,
+) -> tuple[list[Entity], list[Edge], list[ParseError], Tree]:
+    """Extract bytes *start* to *end* of *source_utf8* as *language*, where they stand.
+
+    Ids count up after *first*.  Declarations at the top of the region get
+    *parent*, the entity enclosing it; the region's own file entity is left
+    out.
+    """
+    blanked: bytes = b"".join([
+        re.sub(rb"[^\n]", b" ", source_utf8[:start]),
+        source_utf8[start:end],
+        re.sub(rb"[^\n]", b" ", source_utf8[end:]),
+    ])
+    tree: Tree = parse_tree(blanked, language)
+    entities, references, _next_id = extract_entities(blanked, language, path, first, tree)
+    for entity in entities[1:]:
+        if entity.parent == first:
+            entity.parent = parent
+    return entities[1:], references, syntax_errors(tree, blanked, path), tree
+
+
+# ---------------------------------------------------------------------------
+# Regions
+# ---------------------------------------------------------------------------
+
+_SCRIPT_RE: re.Pattern[bytes] = re.compile(
+    rb"<!--.*?(?:-->|\Z)|<script\b((?:[^>\"']|\"[^\"]*\"|'[^']*')*)>(.*?)</script\s*>",
+    re.DOTALL | re.IGNORECASE,
+)
+
+_ATTR_RE: re.Pattern[str] = re.compile(r"""([\w:-]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|(\S+)))?""")
+
+# Script languages by ``type`` or ``lang``; scripts of other types hold data or templates.
+SCRIPT_LANGUAGES: dict[str, str] = {
+    "": "javascript", "application/javascript": "javascript", "javascript": "javascript",
+    "js": "javascript", "jsx": "javascript", "module": "javascript", "text/babel": "javascript",
+    "text/javascript": "javascript", "text/typescript": "typescript", "ts": "typescript",
+    "tsx": "tsx", "typescript": "typescript",
+}
+
+
+def attributes(text: str) -> dict[str, str]:
+    """The attributes of an HTML start tag, by lowercased name."""
+    return {
+        m.group(1).lower(): next((g for g in m.groups()[1:] if g is not None), "")
+        for m in _ATTR_RE.finditer(text)
+    }
+
+
+def _html_regions(source_utf8: bytes, path: str) -> list[Region]:
+    regions: list[Region] = []
+    for match in _SCRIPT_RE.finditer(source_utf8):
+        if match.group(1) is None or not match.group(2).strip():
+            continue  # a comment, or <script src="...">
+        attrs: dict[str, str] = attributes(match.group(1).decode("utf-8", errors="replace"))
+        kind: str = attrs.get("lang") or attrs.get("type", "")
+        language: str | None = SCRIPT_LANGUAGES.get(kind.lower())
+        if language is None:
+            continue
+        regions.append(Region(
+            language, match.start(2), match.end(2), attrs.get("id") or "script",
+            {"module": True} if kind == "module" else {},
+        ))
+    return regions
+
+
+_SHELLS: frozenset[str] = frozenset({"bash", "sh"})
+
+
+def _yaml_get(node: Any, key: str) -> Any:
+    """The value node of *key* in a composed YAML mapping, else None."""
+    import yaml
+
+    if not isinstance(node, yaml.MappingNode):
+        return None
+    return next((v for k, v in node.value if k.value == key), None)
+
+
+def _yaml_items(node: Any) -> Iterator[tuple[str, Any]]:
+    import yaml
+
+    if isinstance(node, yaml.MappingNode):
+        for key, value in node.value:
+            if isinstance(key, yaml.ScalarNode):
+                yield str(key.value), value
+
+
+class _Offsets:
+    """Byte offsets of the character offsets YAML marks carry."""
+
+    def __init__(self, text: str) -> None:
+        self.text: str = text
+
+    def byte(self, index: int) -> int:
+        return len(self.text[:index].encode("utf-8"))
+
+    def region(self, node: Any, name: str, attrs: dict[str, Any]) -> Region | None:
+        """The shell in a scalar *node*: a ``|`` block, or a plain line."""
+        import yaml
+
+        if not isinstance(node, yaml.ScalarNode) or node.style not in (None, "|"):
+            return None  # quoted and folded scalars are not the text the shell runs
+        start: int = node.start_mark.index
+        if node.style == "|":
+            start = self.text.find("\n", start) + 1 or node.end_mark.index
+        return Region("bash", self.byte(start), self.byte(node.end_mark.index), name, attrs)
+
+
+def _step_regions(offsets: _Offsets, steps: Any, job: str | None) -> list[Region]:
+    import yaml
+
+    regions: list[Region] = []
+    for step in steps.value if isinstance(steps, yaml.SequenceNode) else []:
+        shell: Any = _yaml_get(step, "shell")
+        if isinstance(shell, yaml.ScalarNode) and shell.value.split()[0] not in _SHELLS:
+            continue
+        name: Any = _yaml_get(step, "name")
+        label: str = name.value if isinstance(name, yaml.ScalarNode) else job or "run"
+        region: Region | None = offsets.region(
+            _yaml_get(step, "run"), str(label), {"job": job} if job is not None else {},
+        )
+        if region is not None:
+            regions.append(region)
+    return regions
+
+
+def _gitlab_regions(offsets: _Offsets, root: Any) -> list[Region]:
+    import yaml
+
+    regions: list[Region] = []
+    for job, spec in _yaml_items(root):
+        for key in ("before_script", "script", "after_script"):
+            value: Any = _yaml_get(spec, key)
+            lines: list[Any] = [value]
+            while any(isinstance(n, yaml.SequenceNode) for n in lines):  # nested anchors
+                lines = [
+                    item for n in lines
+                    for item in (n.value if isinstance(n, yaml.SequenceNode) else [n])
+                ]
+            for line in lines:
+                region: Region | None = offsets.region(line, job, {"job": job, "key": key})
+                if region is not None:
+                    regions.append(region)
+    return regions
+
+
+def _pipeline(path: str) -> str | None:
+    """``"github"`` or ``"gitlab"`` if *path* is a CI file of that kind, or None."""
+    pure: PurePosixPath = PurePosixPath(path)
+    folders: tuple[str, ...] = pure.parent.parts
+    if pure.name in ("action.yaml", "action.yml") or any(
+        folders[i:i + 2] == (".github", "workflows") for i in range(len(folders))
+    ):
+        return "github"
+    return "gitlab" if pure.name == ".gitlab-ci.yml" else None
+
+
+def region_digest(digest: str, language: str, path: str) -> str:
+    """The cache key for content with *digest*, which must change with what is embedded.
+
+    Only where YAML sits decides whether it holds shell, so pipelines are
+    keyed apart from the same YAML elsewhere.
+    """
+    pipeline: str | None = _pipeline(path) if language == "yaml" else None
+    if pipeline is None:
+        return digest
+    return hashlib.sha256(f"{digest}\x00{pipeline}".encode()).hexdigest()
+
+
+def _pipeline_regions(source_utf8: bytes, path: str) -> list[Region]:
+    pipeline: str | None = _pipeline(path)
+    if pipeline is None:
+        return []
+    # Import lazily, as for config files.
+    import yaml
+
+    text: str = source_utf8.decode("utf-8", errors="replace")
+    try:
+        root: Any = yaml.compose(text, Loader=yaml.SafeLoader)
+    except yaml.YAMLError:
+        return []
+    offsets: _Offsets = _Offsets(text)
+    if pipeline == "gitlab":
+        return _gitlab_regions(offsets, root)
+    action: Any = _yaml_get(_yaml_get(root, "runs"), "steps")
+    regions: list[Region] = _step_regions(offsets, action, None)
+    for job, spec in _yaml_items(_yaml_get(root, "jobs")):
+        regions.extend(_step_regions(offsets, _yaml_get(spec, "steps"), job))
+    return regions
+
+
+# Region finders by host language.
+_REGION_FINDERS: dict[str, Callable[[bytes, str], list[Region]]] = {
+    "html": _html_regions,
+    "yaml": _pipeline_regions,
+}
+
+
+# Attrs of a region entity from its syntax tree, by embedded language.
+_REGION_ATTRS: dict[str, Callable[[Node], dict[str, Any]]] = {
+    "bash": lambda root: {"commands": shell_commands(root)} if shell_commands(root) else {},
+}
+
+
+def embedded_entities(
+    source_utf8: bytes, host_language: str, path: str, start_id: int, parent: int,
+    regions: list[Region] | None = None, errors: bool = True,
+) -> tuple[list[Entity], list[Edge], list[ParseError]]:
+    """The ``script`` entities of the regions embedded in a host file, with their contents.
+
+    Ids start at *start_id*; region entities get *parent*.  Pass *regions*
+    to extract those instead of the ones found for *host_language*, and
+    ``errors=False`` to leave out their syntax errors.
+    """
+    if regions is None:
+        finder: Callable[[bytes, str], list[Region]] | None = _REGION_FINDERS.get(host_language)
+        regions = finder(source_utf8, path) if finder is not None else []
+    entities: list[Entity] = []
+    references: list[Edge] = []
+    found_errors: list[ParseError] = []
+    for region in regions:
+        row, col = position(source_utf8, region.start)
+        end_row, end_col = position(source_utf8, region.end)
+        entity: Entity = Entity(
+            id=start_id + len(entities), kind="script", name=region.name, path=path,
+            language=region.language, row=row, col=col, end_row=end_row, end_col=end_col,
+            parent=parent, attrs=dict(region.attrs), start_byte=region.start,
+            end_byte=region.end,
+        )
+        contents, region_references, region_errors, tree = extract_region(
+            source_utf8, region.language, region.start, region.end, path, entity.id, entity.id,
+        )
+        hook: Callable[[Node], dict[str, Any]] | None = _REGION_ATTRS.get(region.language)
+        if hook is not None:
+            entity.attrs.update(hook(tree.root_node))
+        entities.append(entity)
+        entities.extend(contents)
+        references.extend(region_references)
+        if errors:
+            found_errors.extend(region_errors)
+    return entities, references, found_errors
+
+
+# ---------------------------------------------------------------------------
+# Go templates
+# ---------------------------------------------------------------------------
+
+_ACTION_RE: re.Pattern[bytes] = re.compile(rb"\{\{-?\s*(.*?)\s*-?\}\}", re.DOTALL)
+
+_ACTION_WORD_RE: re.Pattern[bytes] = re.compile(rb'(\w+)\s*(?:"((?:[^"\\]|\\.)*)"|`([^`]*)`)?')
+
+# Actions closed by ``{{end}}``.
+_BLOCK_ACTIONS: frozenset[bytes] = frozenset({b"block", b"define", b"if", b"range", b"with"})
+
+
+def template_entities(
+    source_utf8: bytes, path: str,
+) -> tuple[list[Entity], list[Edge], list[ParseError]]:
+    """The templates a Go template file defines, its scripts, and errors."""
+    entities: list[Entity] = [file_entity(source_utf8, "gotemplate", path, 0)]
+    errors: list[ParseError] = []
+    # Open actions: (the action's first word, its template entity or None).
+    stack: list[tuple[bytes, Entity | None]] = []
+    blanked: bytearray = bytearray(source_utf8)
+    for match in _ACTION_RE.finditer(source_utf8):
+        blanked[match.start() : match.end()] = re.sub(rb"[^\n]", b" ", match.group())
+        word: re.Match[bytes] | None = _ACTION_WORD_RE.match(match.group(1))
+        if word is None:
+            continue  # a comment, a pipeline, or a variable
+        keyword: bytes = word.group(1)
+        quoted: bytes | None = word.group(2) if word.group(2) is not None else word.group(3)
+        enclosing: Entity = next(
+            (e for _kw, e in reversed(stack) if e is not None), entities[0],
+        )
+        if keyword in (b"define", b"block") and quoted is not None:
+            row, col = position(source_utf8, match.start())
+            template: Entity = Entity(
+                id=len(entities), kind="template", name=quoted.decode("utf-8", errors="replace"),
+                path=path, language="gotemplate", row=row, col=col, end_row=row, end_col=col,
+                parent=enclosing.id, attrs={}, start_byte=match.start(),
+                end_byte=match.end(),
+            )
+            entities.append(template)
+            stack.append((keyword, template))
+            if keyword == b"block":  # a definition invoked where it stands
+                enclosing.attrs.setdefault("templates", []).append(template.name)
+        elif keyword in _BLOCK_ACTIONS:
+            stack.append((keyword, None))
+        elif keyword == b"end" and stack:
+            _keyword, closed = stack.pop()
+            if closed is not None:
+                closed.end_row, closed.end_col = position(source_utf8, match.end())
+                closed.end_byte = match.end()
+        elif keyword == b"template" and quoted is not None:
+            invoked: list[str] = enclosing.attrs.setdefault("templates", [])
+            name: str = quoted.decode("utf-8", errors="replace")
+            if name not in invoked:
+                invoked.append(name)
+    for keyword, _entity in stack:
+        row, col = position(source_utf8, len(source_utf8))
+        errors.append(ParseError(
+            path, "syntax", f"unclosed {{{{{keyword.decode()}}}}}", row, col, row, col,
+        ))
+    templates: list[Entity] = entities[1:]
+    scripts: list[Region] = _html_regions(bytes(blanked), path)
+    for region in scripts:
+        # The innermost template holding the script encloses it.
+        holder: Entity = min(
+            (t for t in templates if t.start_byte <= region.start and region.end <= t.end_byte),
+            key=lambda t: t.end_byte - t.start_byte, default=entities[0],
+        )
+        found, references, _errors = embedded_entities(
+            bytes(blanked), "html", path, len(entities), holder.id, [region], errors=False,
+        )
+        entities.extend(found)
+    assign_uids(entities)
+    return entities, [], errors
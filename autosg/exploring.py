@@ -0,0 +1,622 @@
+"""Interactive graph explorer: ``GET /`` of ``serve``, and ``--format html``.
+
+The explorer is one self-contained page: a searchable entity list beside a
+dependency graph that starts with one node per package (directory, as for
+``--cluster directory``).  Double-clicking a node expands it into its files,
+a file into its top-level entities, and so on; right-clicking collapses a
+node back into its parent.  Edges are drawn between whatever nodes are
+visible, so an edge between two functions shows as an edge between their
+packages until both are expanded.
+
+Served, the page reads analyses from the JSON API and can start new ones.
+Exported, it carries its analysis inline and works offline, for sharing.
+"""
+
+from __future__ import annotations
+
+import html
+import json
+from typing import Any
+
+# Entity fields the page uses.
+ENTITY_FIELDS: tuple[str, ...] = ("id", "kind", "name", "path", "row", "parent")
+
+_STYLE: str = """
+* { box-sizing: border-box; }
+body { margin: 0; font: 13px sans-serif; color: #222; display: flex; height: 100vh; }
+aside { width: 22em; display: flex; flex-direction: column; border-right: 1px solid #ccc; }
+aside section { padding: 0.5em 0.75em; border-bottom: 1px solid #eee; }
+aside h1 { font-size: 1.2em; margin: 0.2em 0; }
+aside h2 { font-size: 1em; margin: 0.2em 0; color: #555; }
+aside input[type=search], aside input[type=text], aside select { width: 100%; margin: 0.15em 0; }
+#entities { flex: 1; overflow-y: auto; }
+#entities ul, #packages, #detail ul { list-style: none; margin: 0; padding: 0; }
+#entities li { padding: 0.15em 0; cursor: pointer; white-space: nowrap; overflow: hidden;
+  text-overflow: ellipsis; }
+#entities li:hover { background: #eef3fa; }
+#packages { max-height: 9em; overflow-y: auto; }
+#packages label, #kinds label { display: block; white-space: nowrap; }
+#detail { max-height: 14em; overflow-y: auto; }
+.muted { color: #888; }
+.kind { color: #4a7ab5; margin-right: 0.4em; }
+main { flex: 1; position: relative; }
+canvas { position: absolute; top: 0; left: 0; width: 100%; height: 100%; cursor: grab; }
+#hint { position: absolute; bottom: 0.5em; left: 0.75em; color: #888; pointer-events: none; }
+#analyze { display: flex; gap: 0.3em; }
+#analyze input { flex: 1; }
+"""
+
+_BODY: str = """
+<aside>
+<section>
+<h1>{title}</h1>
+<div id="server" hidden>
+<select id="analysis" title="Analysis"></select>
+<form id="analyze">
+<input type="text" id="analyze-path" placeholder="Path under the server root">
+<input type="text" id="analyze-edges" value="calls,imports" title="Edge kinds" size="8">
+<button>Analyze</button>
+</form>
+</div>
+<div id="status" class="muted"></div>
+</section>
+<section>
+<input type="search" id="search" placeholder="Search entities by name or path">
+<select id="kind"><option value="">All kinds</option></select>
+</section>
+<section id="entities"><ul></ul></section>
+<section>
+<h2>Packages</h2>
+<input type="search" id="package-filter" placeholder="Filter packages">
+<button id="packages-all">All</button> <button id="packages-none">None</button>
+<ul id="packages"></ul>
+</section>
+<section><h2>Edges</h2><div id="kinds"></div></section>
+<section id="detail"><span class="muted">Click a node for details.</span></section>
+</aside>
+<main>
+<canvas id="graph"></canvas>
+<div id="hint">Scroll to zoom, drag to pan. Double-click a node to expand it,
+right-click to collapse it into its parent.</div>
+</main>
+"""
+
+_SCRIPT: str = r"""
+(function () {
+"use strict";
+const LIST_LIMIT = 200;
+const $ = (id) => document.getElementById(id);
+
+let entities = [];
+let edges = [];
+let byId = new Map();
+let children = new Map();       // entity id -> child count
+let packageSize = new Map();    // package -> entity count
+const expanded = new Set();     // node keys: "p:<package>" or "e:<entity id>"
+const hiddenPackages = new Set();
+const hiddenKinds = new Set();
+let nodes = new Map();          // key -> {key, label, title, kind, size, x, y, vx, vy}
+let links = [];                 // {source, target, count, kinds}
+let selected = null;
+let alpha = 0;
+const view = {x: 0, y: 0, k: 1};
+
+function packageOf(path) {
+  const i = path.lastIndexOf("/");
+  return i < 0 ? "." : path.slice(0, i);
+}
+
+function element(tag, text, cls) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (cls) node.className = cls;
+  return node;
+}
+
+// -- data ------------------------------------------------------------------
+
+function load(data) {
+  entities = data.entities;
+  edges = data.edges.filter((e) => e.target !== null && e.target !== undefined);
+  byId = new Map(entities.map((e) => [e.id, e]));
+  children = new Map();
+  packageSize = new Map();
+  for (const e of entities) {
+    if (e.parent !== null && e.parent !== undefined) {
+      children.set(e.parent, (children.get(e.parent) || 0) + 1);
+    }
+    const p = packageOf(e.path);
+    packageSize.set(p, (packageSize.get(p) || 0) + 1);
+  }
+  expanded.clear();
+  hiddenPackages.clear();
+  hiddenKinds.clear();
+  nodes = new Map();
+  selected = null;
+  renderKinds();
+  renderPackages();
+  renderEntities();
+  renderDetail();
+  rebuild();
+  $("status").textContent = `${entities.length} entities, ${edges.length} edges`;
+}
+
+// The node keys from outermost to innermost that an entity sits in.
+function chain(entity) {
+  const keys = [];
+  for (let e = entity; e; e = e.parent !== null ? byId.get(e.parent) : undefined) {
+    keys.push("e:" + e.id);
+  }
+  keys.push("p:" + packageOf(entity.path));
+  return keys.reverse();
+}
+
+function chainOf(key) {
+  return key.startsWith("p:") ? [key] : chain(byId.get(Number(key.slice(2))));
+}
+
+// The visible node an entity is drawn as: its outermost collapsed container.
+function visible(entity) {
+  const keys = chain(entity);
+  for (const key of keys) {
+    if (!expanded.has(key)) return key;
+  }
+  return keys[keys.length - 1];
+}
+
+function expandable(key) {
+  return key.startsWith("p:") || (children.get(Number(key.slice(2))) || 0) > 0;
+}
+
+function describe(key) {
+  if (key.startsWith("p:")) {
+    const p = key.slice(2);
+    return {label: p, title: `package ${p}`, kind: "package", size: packageSize.get(p) || 1};
+  }
+  const e = byId.get(Number(key.slice(2)));
+  const label = e.kind === "file" ? e.name.split("/").pop() : e.name;
+  return {label, title: `${e.kind} ${e.name} (${e.path}:${e.row})`, kind: e.kind,
+    size: 1 + (children.get(e.id) || 0)};
+}
+
+// Recompute visible nodes and links, keeping the positions of nodes that stay.
+function rebuild() {
+  const old = nodes;
+  nodes = new Map();
+  for (const e of entities) {
+    if (hiddenPackages.has(packageOf(e.path))) continue;
+    const key = visible(e);
+    if (nodes.has(key)) continue;
+    const node = Object.assign({key, vx: 0, vy: 0}, describe(key));
+    // New nodes appear where the node they were expanded from was.
+    const from = chainOf(key).reverse().map((k) => old.get(k)).find((n) => n);
+    node.x = (from ? from.x : 0) + (Math.random() - 0.5) * 40;
+    node.y = (from ? from.y : 0) + (Math.random() - 0.5) * 40;
+    if (old.has(key)) Object.assign(node, {x: old.get(key).x, y: old.get(key).y});
+    nodes.set(key, node);
+  }
+  const merged = new Map();
+  for (const edge of edges) {
+    if (hiddenKinds.has(edge.kind)) continue;
+    const s = byId.get(edge.source);
+    const t = byId.get(edge.target);
+    if (!s || !t) continue;
+    const a = visible(s);
+    const b = visible(t);
+    if (a === b || !nodes.has(a) || !nodes.has(b)) continue;
+    const id = a + "\n" + b;
+    if (!merged.has(id)) {
+      merged.set(id, {source: nodes.get(a), target: nodes.get(b), count: 0, kinds: new Set()});
+    }
+    merged.get(id).count += 1;
+    merged.get(id).kinds.add(edge.kind);
+  }
+  links = [...merged.values()];
+  if (selected && !nodes.has(selected)) selected = null;
+  renderDetail();
+  alpha = 1;
+  animate();
+}
+
+// -- layout ----------------------------------------------------------------
+
+function step() {
+  const list = [...nodes.values()];
+  for (let i = 0; i < list.length; i++) {
+    const a = list[i];
+    for (let j = i + 1; j < list.length; j++) {
+      const b = list[j];
+      let dx = a.x - b.x;
+      let dy = a.y - b.y;
+      const d2 = Math.max(dx * dx + dy * dy, 25);
+      const f = (1200 / d2) * alpha;
+      dx *= f / Math.sqrt(d2);
+      dy *= f / Math.sqrt(d2);
+      a.vx += dx; a.vy += dy;
+      b.vx -= dx; b.vy -= dy;
+    }
+  }
+  for (const link of links) {
+    const a = link.source;
+    const b = link.target;
+    const dx = b.x - a.x;
+    const dy = b.y - a.y;
+    const d = Math.max(Math.sqrt(dx * dx + dy * dy), 1);
+    const f = ((d - 90) / d) * 0.04 * alpha;
+    a.vx += dx * f; a.vy += dy * f;
+    b.vx -= dx * f; b.vy -= dy * f;
+  }
+  for (const n of list) {
+    if (n.fixed) { n.vx = n.vy = 0; continue; }
+    n.vx = (n.vx - n.x * 0.004 * alpha) * 0.8;
+    n.vy = (n.vy - n.y * 0.004 * alpha) * 0.8;
+    n.x += n.vx;
+    n.y += n.vy;
+  }
+  alpha *= 0.985;
+}
+
+let frame = null;
+function animate() {
+  if (frame !== null) return;
+  const tick = () => {
+    step();
+    draw();
+    frame = alpha > 0.02 ? requestAnimationFrame(tick) : null;
+  };
+  frame = requestAnimationFrame(tick);
+}
+
+// -- drawing ---------------------------------------------------------------
+
+const canvas = $("graph");
+const ctx = canvas.getContext("2d");
+
+function color(kind) {
+  if (kind === "package") return "#4a7ab5";
+  if (kind === "file") return "#6a9f4f";
+  let h = 0;
+  for (const c of kind) h = (h * 31 + c.charCodeAt(0)) % 360;
+  return `hsl(${h}, 55%, 52%)`;
+}
+
+function radius(node) {
+  return 4 + Math.min(18, Math.sqrt(node.size) * 1.5);
+}
+
+function draw() {
+  const ratio = window.devicePixelRatio || 1;
+  const w = canvas.clientWidth;
+  const h = canvas.clientHeight;
+  if (canvas.width !== w * ratio || canvas.height !== h * ratio) {
+    canvas.width = w * ratio;
+    canvas.height = h * ratio;
+  }
+  ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+  ctx.clearRect(0, 0, w, h);
+  ctx.setTransform(ratio * view.k, 0, 0, ratio * view.k,
+    ratio * (w / 2 + view.x), ratio * (h / 2 + view.y));
+  for (const link of links) {
+    const a = link.source;
+    const b = link.target;
+    const near = selected && (a.key === selected || b.key === selected);
+    ctx.strokeStyle = near ? "#d0542c" : "rgba(120, 120, 120, 0.45)";
+    ctx.fillStyle = ctx.strokeStyle;
+    ctx.lineWidth = (1 + Math.log2(link.count)) / Math.sqrt(view.k);
+    const angle = Math.atan2(b.y - a.y, b.x - a.x);
+    const tx = b.x - Math.cos(angle) * radius(b);
+    const ty = b.y - Math.sin(angle) * radius(b);
+    ctx.beginPath();
+    ctx.moveTo(a.x, a.y);
+    ctx.lineTo(tx, ty);
+    ctx.stroke();
+    const head = 7;
+    ctx.beginPath();
+    ctx.moveTo(tx, ty);
+    ctx.lineTo(tx - head * Math.cos(angle - 0.4), ty - head * Math.sin(angle - 0.4));
+    ctx.lineTo(tx - head * Math.cos(angle + 0.4), ty - head * Math.sin(angle + 0.4));
+    ctx.fill();
+  }
+  ctx.font = `${12 / view.k}px sans-serif`;
+  for (const node of nodes.values()) {
+    const r = radius(node);
+    ctx.beginPath();
+    ctx.arc(node.x, node.y, r, 0, 2 * Math.PI);
+    ctx.fillStyle = color(node.kind);
+    ctx.fill();
+    ctx.lineWidth = 2 / view.k;
+    ctx.strokeStyle = node.key === selected ? "#d0542c" : expandable(node.key) ? "#333" : "#fff";
+    ctx.stroke();
+    if (view.k > 0.5 || node.kind === "package" || node.key === selected) {
+      ctx.fillStyle = "#222";
+      ctx.fillText(node.label, node.x + r + 3 / view.k, node.y + 4 / view.k);
+    }
+  }
+}
+
+// -- interaction -----------------------------------------------------------
+
+function toGraph(event) {
+  const rect = canvas.getBoundingClientRect();
+  return {
+    x: (event.clientX - rect.left - rect.width / 2 - view.x) / view.k,
+    y: (event.clientY - rect.top - rect.height / 2 - view.y) / view.k,
+  };
+}
+
+function nodeAt(event) {
+  const p = toGraph(event);
+  let best = null;
+  for (const node of nodes.values()) {
+    const d = Math.hypot(node.x - p.x, node.y - p.y);
+    if (d <= radius(node) + 2 && (!best || d < best.d)) best = {node, d};
+  }
+  return best ? best.node : null;
+}
+
+let drag = null;
+canvas.addEventListener("mousedown", (event) => {
+  const node = nodeAt(event);
+  drag = {node, x: event.clientX, y: event.clientY, moved: false};
+  if (node) node.fixed = true;
+});
+window.addEventListener("mousemove", (event) => {
+  if (!drag) return;
+  const dx = event.clientX - drag.x;
+  const dy = event.clientY - drag.y;
+  if (Math.abs(dx) + Math.abs(dy) > 2) drag.moved = true;
+  if (drag.node) {
+    const p = toGraph(event);
+    drag.node.x = p.x;
+    drag.node.y = p.y;
+    alpha = Math.max(alpha, 0.3);
+    animate();
+  } else {
+    view.x += dx;
+    view.y += dy;
+    draw();
+  }
+  drag.x = event.clientX;
+  drag.y = event.clientY;
+});
+window.addEventListener("mouseup", () => {
+  if (!drag) return;
+  if (drag.node) drag.node.fixed = false;
+  if (!drag.moved) select(drag.node ? drag.node.key : null);
+  drag = null;
+});
+canvas.addEventListener("dblclick", (event) => {
+  const node = nodeAt(event);
+  if (node && expandable(node.key)) {
+    expanded.add(node.key);
+    rebuild();
+  }
+});
+canvas.addEventListener("contextmenu", (event) => {
+  const node = nodeAt(event);
+  if (!node) return;
+  event.preventDefault();
+  const keys = chainOf(node.key);
+  if (keys.length > 1) {
+    expanded.delete(keys[keys.length - 2]);
+    rebuild();
+    select(keys[keys.length - 2]);
+  }
+});
+canvas.addEventListener("wheel", (event) => {
+  event.preventDefault();
+  const before = toGraph(event);
+  view.k = Math.min(8, Math.max(0.05, view.k * Math.exp(-event.deltaY * 0.0015)));
+  const after = toGraph(event);
+  view.x += (after.x - before.x) * view.k;
+  view.y += (after.y - before.y) * view.k;
+  draw();
+}, {passive: false});
+window.addEventListener("resize", draw);
+
+function select(key) {
+  selected = key;
+  renderDetail();
+  draw();
+}
+
+// Expand everything an entity sits in, then select and center its node.
+function reveal(entity) {
+  const keys = chain(entity);
+  hiddenPackages.delete(packageOf(entity.path));
+  keys.slice(0, -1).forEach((k) => expanded.add(k));
+  renderPackages();
+  rebuild();
+  const node = nodes.get(keys[keys.length - 1]);
+  view.x = -node.x * view.k;
+  view.y = -node.y * view.k;
+  select(node.key);
+}
+
+// -- sidebar ---------------------------------------------------------------
+
+function renderEntities() {
+  const query = $("search").value.toLowerCase();
+  const kind = $("kind").value;
+  const list = $("entities").querySelector("ul");
+  list.replaceChildren();
+  let shown = 0;
+  let matched = 0;
+  for (const e of entities) {
+    if (kind && e.kind !== kind) continue;
+    if (query && !e.name.toLowerCase().includes(query)
+        && !e.path.toLowerCase().includes(query)) continue;
+    matched += 1;
+    if (shown >= LIST_LIMIT) continue;
+    shown += 1;
+    const item = element("li");
+    item.append(element("span", e.kind, "kind"), element("span", e.name),
+      element("span", ` ${e.path}:${e.row}`, "muted"));
+    item.title = `${e.path}:${e.row}`;
+    item.addEventListener("click", () => reveal(e));
+    list.append(item);
+  }
+  if (matched > shown) list.append(element("li", `${matched - shown} more; refine the search`,
+    "muted"));
+}
+
+function renderKinds() {
+  const kinds = [...new Set(entities.map((e) => e.kind))].sort();
+  const choice = $("kind");
+  choice.replaceChildren(element("option", "All kinds"));
+  choice.firstChild.value = "";
+  for (const kind of kinds) choice.append(element("option", kind));
+  const box = $("kinds");
+  box.replaceChildren();
+  for (const kind of [...new Set(edges.map((e) => e.kind))].sort()) {
+    const label = element("label");
+    const input = element("input");
+    input.type = "checkbox";
+    input.checked = !hiddenKinds.has(kind);
+    input.addEventListener("change", () => {
+      if (input.checked) hiddenKinds.delete(kind); else hiddenKinds.add(kind);
+      rebuild();
+    });
+    const count = edges.filter((e) => e.kind === kind).length;
+    label.append(input, ` ${kind} `, element("span", String(count), "muted"));
+    box.append(label);
+  }
+  if (!box.childNodes.length) box.append(element("span", "No edges were resolved.", "muted"));
+}
+
+function renderPackages() {
+  const query = $("package-filter").value.toLowerCase();
+  const list = $("packages");
+  list.replaceChildren();
+  for (const p of [...packageSize.keys()].sort()) {
+    if (query && !p.toLowerCase().includes(query)) continue;
+    const label = element("label");
+    const input = element("input");
+    input.type = "checkbox";
+    input.checked = !hiddenPackages.has(p);
+    input.addEventListener("change", () => {
+      if (input.checked) hiddenPackages.delete(p); else hiddenPackages.add(p);
+      rebuild();
+    });
+    label.append(input, ` ${p} `, element("span", String(packageSize.get(p)), "muted"));
+    const item = element("li");
+    item.append(label);
+    list.append(item);
+  }
+}
+
+function setPackages(show) {
+  const query = $("package-filter").value.toLowerCase();
+  for (const p of packageSize.keys()) {
+    if (query && !p.toLowerCase().includes(query)) continue;
+    if (show) hiddenPackages.delete(p); else hiddenPackages.add(p);
+  }
+  renderPackages();
+  rebuild();
+}
+
+function renderDetail() {
+  const box = $("detail");
+  box.replaceChildren();
+  if (!selected || !nodes.has(selected)) {
+    box.append(element("span", "Click a node for details.", "muted"));
+    return;
+  }
+  const node = nodes.get(selected);
+  box.append(element("h2", node.title));
+  const sides = [["Depends on", (l) => l.source === node, (l) => l.target],
+    ["Depended on by", (l) => l.target === node, (l) => l.source]];
+  for (const [heading, matches, other] of sides) {
+    const related = links.filter(matches).sort((a, b) => b.count - a.count);
+    if (!related.length) continue;
+    box.append(element("div", heading, "muted"));
+    const list = element("ul");
+    for (const link of related) {
+      const item = element("li", `${other(link).label} `);
+      item.append(element("span", `${link.count} ${[...link.kinds].join(", ")}`, "muted"));
+      item.title = other(link).title;
+      list.append(item);
+    }
+    box.append(list);
+  }
+}
+
+$("search").addEventListener("input", renderEntities);
+$("kind").addEventListener("change", renderEntities);
+$("package-filter").addEventListener("input", renderPackages);
+$("packages-all").addEventListener("click", () => setPackages(true));
+$("packages-none").addEventListener("click", () => setPackages(false));
+
+// -- data sources ----------------------------------------------------------
+
+async function getJson(url, init) {
+  const response = await fetch(url, init);
+  const body = await response.json();
+  if (!response.ok) throw new Error(body.error || response.statusText);
+  return body;
+}
+
+async function loadAnalysis(id) {
+  $("status").textContent = "Loading...";
+  const [e, g] = await Promise.all([
+    getJson(`entities?analysis=${id}`), getJson(`edges?analysis=${id}`),
+  ]);
+  load({entities: e.entities, edges: g.edges});
+}
+
+async function refresh(pick) {
+  const {analyses} = await getJson("analyses");
+  const choice = $("analysis");
+  choice.replaceChildren();
+  for (const a of analyses.slice().reverse()) {
+    const option = element("option", `#${a.id} ${a.source} (${a.files} files)`);
+    option.value = a.id;
+    choice.append(option);
+  }
+  if (!analyses.length) {
+    $("status").textContent = "No analyses yet; analyze a path above.";
+    return;
+  }
+  choice.value = pick !== undefined ? pick : analyses[analyses.length - 1].id;
+  await loadAnalysis(choice.value);
+}
+
+function report(error) {
+  $("status").textContent = error.message;
+}
+
+const embedded = $("autosg-data");
+if (embedded) {
+  load(JSON.parse(embedded.textContent));
+} else {
+  $("server").hidden = false;
+  $("analysis").addEventListener("change", () => loadAnalysis($("analysis").value).catch(report));
+  $("analyze").addEventListener("submit", (event) => {
+    event.preventDefault();
+    $("status").textContent = "Analyzing...";
+    const body = {path: $("analyze-path").value || ".",
+      edges: $("analyze-edges").value.split(",").map((k) => k.trim()).filter((k) => k)};
+    getJson("analyze", {method: "POST", headers: {"Content-Type": "application/json"},
+      body: JSON.stringify(body)})
+      .then((result) => refresh(result.id)).catch(report);
+  });
+  refresh().catch(report);
+}
+})();
+"""
+
+
+def render_page(title: str, data: dict[str, Any] | None = None) -> str:
+    """The explorer page; with *data*, the analysis it shows, else it reads the API."""
+    parts: list[str] = [
+        '<!DOCTYPE html>\n<html lang="en">\n<head>\n<meta charset="utf-8">\n',
+        f"<title>{html.escape(title)}</title>\n<style>{_STYLE}</style>\n</head>\n<body>",
+        _BODY.format(title=html.escape(title)),
+    ]
+    if data is not None:
+        # "</" would end the script element early wherever it appears in a string.
+        payload: str = json.dumps(data, separators=(",", ":")).replace("</", "<\\/")
+        parts.append(f'<script type="application/json" id="autosg-data">{payload}</script>\n')
+    parts.append(f"<script>{_SCRIPT}</script>\n</body>\n</html>\n")
+    return "".join(parts)
+
@@ -0,0 +1,1901 @@
+"""Output formats for analysis results."""
+
+from __future__ import annotations
+
+import csv
+import dataclasses
+import itertools
+import json
+import os
+import re
+import shutil
+import sqlite3
+import tempfile
+from collections import defaultdict
+from collections.abc import Callable, Iterable, Iterator
+from dataclasses import dataclass
+from pathlib import Path
+from typing import IO, Any, TextIO
+from xml.sax.saxutils import escape as xml_escape
+
+from .analysis import Analysis, FileResult
+from .annotating import FileEncoding, read_source_utf8
+from .exploring import ENTITY_FIELDS, render_page
+from .extracting import Edge, Entity, is_entry_point, is_exported, is_test_path, qualified_names
+from .licensing import HEADERLESS_LANGUAGES
+from .manifests import RUNTIME_SCOPES, is_manifest
+from .ownership import UNOWNED
+from .positioning import column
+from .schema import SCHEMA_VERSION
+
+
+@dataclass
+class ExportOptions:
+    """Format-specific output settings; each writer reads what it needs."""
+
+    cluster: str = "directory"  # dot, dsm, mermaid: group nodes by "directory", "file", or "none"
+    dsm_order: str = "name"  # dsm: "name", or "partition" to block out cycles
+    positions: str = "both"  # json, jsonl: "lines" (row/col), "bytes" (offsets), or "both"
+    adjacency: bool = False  # csv: also write the dsm matrix as adjacency.csv
+
+
+POSITION_MODES: tuple[str, ...] = ("both", "bytes", "lines")
+
+_LINE_FIELDS: tuple[str, ...] = ("row", "col", "end_row", "end_col")
+_BYTE_FIELDS: tuple[str, ...] = ("start_byte", "end_byte")
+
+
+def _entity_record(entity: Entity, options: ExportOptions) -> dict[str, Any]:
+    """An entity as a JSON object, with the span fields ``options.positions`` asks for."""
+    record: dict[str, Any] = dataclasses.asdict(entity)
+    dropped: tuple[str, ...] = {"bytes": _LINE_FIELDS, "lines": _BYTE_FIELDS}.get(
+        options.positions, (),
+    )
+    for name in dropped:
+        del record[name]
+    return record
+
+
+# Characters of entity and error records write_json holds in memory before
+# spilling them to a temporary file.
+_JSON_BUFFER: int = 1 << 24
+
+
+class _JsonArray:
+    """Elements of one top-level array of write_json's document, written one by one."""
+
+    def __init__(self, out: IO[str]) -> None:
+        self.out: IO[str] = out
+        self.empty: bool = True
+
+    def append(self, value: Any) -> None:
+        # Indented as json.dump(..., indent=2) indents a value two levels deep.
+        self.out.write("\n    " if self.empty else ",\n    ")
+        self.out.write(json.dumps(value, indent=2).replace("\n", "\n    "))
+        self.empty = False
+
+    def close(self) -> None:
+        self.out.write("]" if self.empty else "\n  ]")
+
+
+def write_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write the whole result as a single JSON document.
+
+    Files are written as they are analyzed; their entities and errors,
+    which come later in the document, wait in temporary files meanwhile.
+    """
+    with (
+        tempfile.SpooledTemporaryFile(_JSON_BUFFER, "w+", encoding="utf-8") as entity_text,
+        tempfile.SpooledTemporaryFile(_JSON_BUFFER, "w+", encoding="utf-8") as error_text,
+    ):
+        files: _JsonArray = _JsonArray(out)
+        entities: _JsonArray = _JsonArray(entity_text)
+        errors: _JsonArray = _JsonArray(error_text)
+        out.write(f'{{\n  "schema_version": {SCHEMA_VERSION},\n  "files": [')
+        for file_result in analysis:
+            files.append(file_result.to_dict())
+            for entity in file_result.entities:
+                entities.append(_entity_record(entity, options))
+            for error in file_result.errors:
+                errors.append(dataclasses.asdict(error))
+        files.close()
+        entities.close()
+        errors.close()
+        out.write(',\n  "entities": [')
+        entity_text.seek(0)
+        shutil.copyfileobj(entity_text, out)
+        out.write(',\n  "edges": [')
+        edges: _JsonArray = _JsonArray(out)
+        for edge in analysis.edges:
+            edges.append(dataclasses.asdict(edge))
+        edges.close()
+        out.write(',\n  "errors": [')
+        error_text.seek(0)
+        shutil.copyfileobj(error_text, out)
+        out.write("\n}\n")
+
+
+def write_jsonl(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Stream one JSON record per line as each file is analyzed.
+
+    Every record has a ``type`` field.  A ``header`` record with the
+    ``schema_version`` comes first; then each ``file`` record is followed by
+    the ``entity`` records extracted from it, then its parse ``error``
+    records.  Output is flushed per file so downstream consumers see
+    results while the run is in progress.
+    ``edge`` records follow once every file has been processed.
+    """
+    out.write(json.dumps({"type": "header", "schema_version": SCHEMA_VERSION}) + "\n")
+    for file_result in analysis:
+        out.write(json.dumps({"type": "file", **file_result.to_dict()}) + "\n")
+        for entity in file_result.entities:
+            out.write(json.dumps({"type": "entity", **_entity_record(entity, options)}) + "\n")
+        for error in file_result.errors:
+            out.write(json.dumps({"type": "error", **dataclasses.asdict(error)}) + "\n")
+        out.flush()
+    for edge in analysis.edges:
+        out.write(json.dumps({"type": "edge", **dataclasses.asdict(edge)}) + "\n")
+
+
+# ---------------------------------------------------------------------------
+# Graphviz DOT
+# ---------------------------------------------------------------------------
+
+CLUSTER_MODES: tuple[str, ...] = ("directory", "file", "none", "owner")
+
+# Imports say little about structure on their own and swamp the graph.
+_DOT_HIDDEN_KINDS: frozenset[str] = frozenset({"import", "use"})
+
+_DOT_SHAPES: dict[str, str] = {
+    "file": "note",
+    "function": "ellipse",
+    "method": "ellipse",
+}
+
+
+def edge_weight(edge: Edge) -> int:
+    """How much *edge* counts for: its ``weight`` attr from ``--granularity``, else 1."""
+    weight: Any = edge.attrs.get("weight", 1)
+    return weight if isinstance(weight, int) else 1
+
+
+def _dot_quote(text: str) -> str:
+    """Quote a string as a DOT ID."""
+    return '"' + text.replace("\\", "\\\\").replace('"', '\\"') + '"'
+
+
+def write_dot(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Render files, declarations, and edges as a Graphviz digraph.
+
+    Containment (file → type → member) is drawn as dotted lines; resolved
+    edges are labelled with their kind.  Pipe the output to ``dot -Tsvg``.
+    """
+    clusters: dict[str, list[Entity]] = defaultdict(list)
+    shown: set[int] = set()
+    for file_result in analysis:
+        for entity in file_result.entities:
+            if entity.kind in _DOT_HIDDEN_KINDS:
+                continue
+            key: str = _group(entity, options.cluster) if options.cluster != "none" else ""
+            clusters[key].append(entity)
+            shown.add(entity.id)
+
+    out.write("digraph autosg {\n")
+    out.write("  rankdir=LR;\n")
+    out.write('  node [shape=box, fontname="Helvetica", fontsize=10];\n')
+    containment: list[tuple[int, int]] = []
+    for index, (key, entities) in enumerate(sorted(clusters.items())):
+        indent: str = "  "
+        if key:
+            out.write(f"  subgraph cluster_{index} {{\n")
+            out.write(f"    label={_dot_quote(key)};\n")
+            indent = "    "
+        for entity in entities:
+            label: str = entity.name if entity.kind == "file" else f"{entity.kind} {entity.name}"
+            shape: str = _DOT_SHAPES.get(entity.kind, "box")
+            out.write(f"{indent}n{entity.id} [label={_dot_quote(label)}, shape={shape}];\n")
+            if entity.parent is not None and entity.parent in shown:
+                containment.append((entity.parent, entity.id))
+        if key:
+            out.write("  }\n")
+    for parent, child in containment:
+        out.write(f"  n{parent} -> n{child} [style=dotted, arrowhead=none];\n")
+    seen: set[tuple[str, int, int]] = set()
+    for edge in analysis.edges:
+        if edge.target is None or edge.source not in shown or edge.target not in shown:
+            continue
+        if (edge.kind, edge.source, edge.target) in seen:
+            continue
+        seen.add((edge.kind, edge.source, edge.target))
+        edge_label: str = edge.kind
+        if "weight" in edge.attrs:  # rolled up by --granularity
+            edge_label += f" ({edge_weight(edge)})"
+        out.write(f"  n{edge.source} -> n{edge.target} [label={_dot_quote(edge_label)}];\n")
+    out.write("}\n")
+
+
+# ---------------------------------------------------------------------------
+# GraphML and GEXF
+# ---------------------------------------------------------------------------
+
+# Node attributes written by the graph formats: (name, GraphML type, GEXF type).
+_GRAPH_NODE_ATTRS: tuple[tuple[str, str, str], ...] = (
+    ("uid", "string", "string"),
+    ("kind", "string", "string"),
+    ("name", "string", "string"),
+    ("path", "string", "string"),
+    ("language", "string", "string"),
+    ("row", "int", "integer"),
+    ("col", "int", "integer"),
+    ("end_row", "int", "integer"),
+    ("end_col", "int", "integer"),
+)
+
+
+def _graph_edges(
+    analysis: Analysis, parents: list[tuple[int, int]],
+) -> list[tuple[str, int, int, int]]:
+    """Containment edges followed by resolved edges, as (kind, source, target, weight)."""
+    edges: list[tuple[str, int, int, int]] = [("contains", p, c, 1) for p, c in parents]
+    edges.extend(
+        (e.kind, e.source, e.target, edge_weight(e)) for e in analysis.edges if e.target is not None
+    )
+    return edges
+
+
+def write_graphml(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a GraphML document, loadable by Gephi, Cytoscape, and yEd.
+
+    Every entity is a node; file→declaration containment becomes
+    ``contains`` edges alongside the resolved edges.
+    """
+    out.write('<?xml version="1.0" encoding="UTF-8"?>\n')
+    out.write('<graphml xmlns="http://graphml.graphdrawing.org/xmlns">\n')
+    for name, graphml_type, _gexf_type in _GRAPH_NODE_ATTRS:
+        out.write(
+            f'  <key id="{name}" for="node" attr.name="{name}" attr.type="{graphml_type}"/>\n',
+        )
+    out.write('  <key id="edge_kind" for="edge" attr.name="kind" attr.type="string"/>\n')
+    out.write('  <key id="edge_weight" for="edge" attr.name="weight" attr.type="int">\n')
+    out.write("    <default>1</default>\n  </key>\n")
+    out.write('  <graph id="autosg" edgedefault="directed">\n')
+    parents: list[tuple[int, int]] = []
+    for file_result in analysis:
+        for entity in file_result.entities:
+            out.write(f'    <node id="n{entity.id}">\n')
+            for name, _graphml_type, _gexf_type in _GRAPH_NODE_ATTRS:
+                value: str = xml_escape(str(getattr(entity, name)))
+                out.write(f'      <data key="{name}">{value}</data>\n')
+            out.write("    </node>\n")
+            if entity.parent is not None:
+                parents.append((entity.parent, entity.id))
+    for index, (kind, source, target, weight) in enumerate(_graph_edges(analysis, parents)):
+        out.write(f'    <edge id="e{index}" source="n{source}" target="n{target}">\n')
+        out.write(f'      <data key="edge_kind">{xml_escape(kind)}</data>\n')
+        if weight != 1:
+            out.write(f'      <data key="edge_weight">{weight}</data>\n')
+        out.write("    </edge>\n")
+    out.write("  </graph>\n")
+    out.write("</graphml>\n")
+
+
+def write_gexf(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a GEXF 1.3 document, Gephi's native format.
+
+    Nodes and edges are the same as for GraphML; edge kinds are used as
+    edge labels so Gephi can filter and color by them.
+    """
+    out.write('<?xml version="1.0" encoding="UTF-8"?>\n')
+    out.write('<gexf xmlns="http://gexf.net/1.3" version="1.3">\n')
+    out.write('  <graph mode="static" defaultedgetype="directed">\n')
+    out.write('    <attributes class="node">\n')
+    for index, (name, _graphml_type, gexf_type) in enumerate(_GRAPH_NODE_ATTRS):
+        out.write(f'      <attribute id="{index}" title="{name}" type="{gexf_type}"/>\n')
+    out.write("    </attributes>\n")
+    out.write('    <attributes class="edge">\n')
+    out.write('      <attribute id="0" title="kind" type="string"/>\n')
+    out.write("    </attributes>\n")
+    out.write("    <nodes>\n")
+    parents: list[tuple[int, int]] = []
+    for file_result in analysis:
+        for entity in file_result.entities:
+            label: str = xml_escape(entity.name, {'"': "&quot;"})
+            out.write(f'      <node id="n{entity.id}" label="{label}">\n')
+            out.write("        <attvalues>\n")
+            for index, (name, _graphml_type, _gexf_type) in enumerate(_GRAPH_NODE_ATTRS):
+                value: str = xml_escape(str(getattr(entity, name)), {'"': "&quot;"})
+                out.write(f'          <attvalue for="{index}" value="{value}"/>\n')
+            out.write("        </attvalues>\n")
+            out.write("      </node>\n")
+            if entity.parent is not None:
+                parents.append((entity.parent, entity.id))
+    out.write("    </nodes>\n")
+    out.write("    <edges>\n")
+    for index, (kind, source, target, weight) in enumerate(_graph_edges(analysis, parents)):
+        kind_attr: str = xml_escape(kind, {'"': "&quot;"})
+        weight_attr: str = f' weight="{weight}"' if weight != 1 else ""
+        out.write(
+            f'      <edge id="e{index}" source="n{source}" target="n{target}" label="{kind_attr}"'
+            f'{weight_attr}><attvalues><attvalue for="0" value="{kind_attr}"/></attvalues>'
+            "</edge>\n",
+        )
+    out.write("    </edges>\n")
+    out.write("  </graph>\n")
+    out.write("</gexf>\n")
+
+
+# ---------------------------------------------------------------------------
+# Design Structure Matrix
+# ---------------------------------------------------------------------------
+
+DSM_ORDERS: tuple[str, ...] = ("name", "partition")
+
+
+@dataclass
+class _Dsm:
+    """A square dependency matrix: ``cells[i][j]`` edges from row i to column j."""
+
+    labels: list[str]
+    cells: list[list[int]]
+    cycles: list[list[int]]  # strongly connected groups of two or more rows
+
+
+def strongly_connected_components(count: int, successors: list[set[int]]) -> list[list[int]]:
+    """Tarjan's strongly connected components, dependencies before dependents."""
+    index: list[int] = [-1] * count
+    low: list[int] = [0] * count
+    on_stack: list[bool] = [False] * count
+    stack: list[int] = []
+    components: list[list[int]] = []
+    counter: int = 0
+    for start in range(count):
+        if index[start] != -1:
+            continue
+        work: list[tuple[int, list[int]]] = [(start, sorted(successors[start]))]
+        index[start] = low[start] = counter
+        counter += 1
+        stack.append(start)
+        on_stack[start] = True
+        while work:
+            node, pending = work[-1]
+            if pending:
+                nxt: int = pending.pop(0)
+                if index[nxt] == -1:
+                    index[nxt] = low[nxt] = counter
+                    counter += 1
+                    stack.append(nxt)
+                    on_stack[nxt] = True
+                    work.append((nxt, sorted(successors[nxt])))
+                elif on_stack[nxt]:
+                    low[node] = min(low[node], index[nxt])
+                continue
+            work.pop()
+            if work:
+                low[work[-1][0]] = min(low[work[-1][0]], low[node])
+            if low[node] == index[node]:
+                component: list[int] = []
+                while True:
+                    member: int = stack.pop()
+                    on_stack[member] = False
+                    component.append(member)
+                    if member == node:
+                        break
+                components.append(sorted(component))
+    # Tarjan emits a component only after everything it reaches.
+    return components
+
+
+def layer_rows(nodes: list[str], dependencies: Iterable[tuple[str, str]]) -> list[list[str]]:
+    """Arrange *nodes* in layers so each depends only on those below it.
+
+    Nodes in a cycle share a layer.  Layer 0 holds the nodes that depend
+    on no other; *dependencies* on nodes not listed are ignored.
+    """
+    index: dict[str, int] = {name: i for i, name in enumerate(nodes)}
+    successors: list[set[int]] = [set() for _ in nodes]
+    for source, target in dependencies:
+        if source in index and target in index and source != target:
+            successors[index[source]].add(index[target])
+    layer: dict[int, int] = {}
+    # Components come dependencies first, so each one's layer is final when reached.
+    for component in strongly_connected_components(len(nodes), successors):
+        members: set[int] = set(component)
+        below: list[int] = [
+            layer[t] for m in component for t in successors[m] if t not in members
+        ]
+        depth: int = max(below, default=-1) + 1
+        for member in component:
+            layer[member] = depth
+    rows: list[list[str]] = [[] for _ in range(max(layer.values(), default=-1) + 1)]
+    for i, name in enumerate(nodes):
+        rows[layer[i]].append(name)
+    return rows
+
+
+def _group(entity: Entity, cluster: str) -> str:
+    """The DSM row, diagram node, or cycle member *entity* belongs to."""
+    if cluster == "directory":
+        return os.path.dirname(entity.path) or "."
+    if cluster == "file":
+        return entity.path
+    if cluster == "owner":
+        return entity.attrs.get("owner", UNOWNED)
+    return f"{entity.path}:{entity.name}"
+
+
+def _build_dsm(analysis: Analysis, options: ExportOptions) -> _Dsm:
+    """Group entities into rows per ``options.cluster`` and count edges between them."""
+    groups: dict[int, str] = {}
+    labels: set[str] = set()
+    for file_result in analysis:
+        _add_dsm_groups(file_result.entities, options, groups, labels)
+    return _dsm_cells(groups, labels, analysis.edges, options)
+
+
+def _add_dsm_groups(
+    entities: list[Entity], options: ExportOptions, groups: dict[int, str], labels: set[str],
+) -> None:
+    for entity in entities:
+        groups[entity.id] = _group(entity, options.cluster)
+        if options.cluster != "none":  # entity rows only appear if they have edges
+            labels.add(groups[entity.id])
+
+
+def _dsm_cells(
+    groups: dict[int, str], labels: set[str], edges: Iterable[Edge], options: ExportOptions,
+) -> _Dsm:
+    """The matrix of edges between the rows *groups* puts entities in."""
+    counts: dict[tuple[str, str], int] = defaultdict(int)
+    for edge in edges:
+        if edge.target is None or edge.source not in groups or edge.target not in groups:
+            continue
+        source, target = groups[edge.source], groups[edge.target]
+        counts[(source, target)] += edge_weight(edge)
+        labels.update((source, target))
+    names: list[str] = sorted(labels)
+    index: dict[str, int] = {label: i for i, label in enumerate(names)}
+    successors: list[set[int]] = [set() for _ in names]
+    for source, target in counts:
+        if source != target:
+            successors[index[source]].add(index[target])
+    components: list[list[str]] = [
+        [names[i] for i in c]
+        for c in strongly_connected_components(len(names), successors)
+    ]
+    ordered: list[str] = names
+    if options.dsm_order == "partition":
+        # Dependencies first: every edge outside a cycle lands below the diagonal.
+        ordered = [label for component in components for label in component]
+    position: dict[str, int] = {label: i for i, label in enumerate(ordered)}
+    cells: list[list[int]] = [[0] * len(ordered) for _ in ordered]
+    for (source, target), count in counts.items():
+        cells[position[source]][position[target]] = count
+    cycles: list[list[int]] = sorted(
+        sorted(position[label] for label in component)
+        for component in components
+        if len(component) > 1
+    )
+    return _Dsm(ordered, cells, cycles)
+
+
+def write_dsm(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a dependency matrix as CSV: row depends on column; zeros left blank."""
+    _write_dsm_rows(_build_dsm(analysis, options), out)
+
+
+def _write_dsm_rows(dsm: _Dsm, out: TextIO) -> None:
+    writer = csv.writer(out, lineterminator="\n")
+    writer.writerow(["", *dsm.labels])
+    for label, row in zip(dsm.labels, dsm.cells):
+        writer.writerow([label, *(count or "" for count in row)])
+
+
+def write_dsm_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a dependency matrix as JSON, with cycles as lists of row indexes."""
+    dsm: _Dsm = _build_dsm(analysis, options)
+    json.dump(
+        {
+            "labels": dsm.labels,
+            "matrix": dsm.cells,
+            "cycles": dsm.cycles,
+            "order": options.dsm_order,
+        },
+        out,
+        indent=2,
+    )
+    out.write("\n")
+
+# ---------------------------------------------------------------------------
+# Cycle reports
+# ---------------------------------------------------------------------------
+
+@dataclass
+class Cycle:
+    """A strongly connected group of directories, files, or entities."""
+
+    members: list[str]
+    # (source group, target group) -> the entity edges between them.
+    links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]]
+    cut: tuple[str, str]  # the suggested link to remove
+
+    def edge_count(self) -> int:
+        return sum(len(edges) for edges in self.links.values())
+
+
+def _still_cyclic(members: list[str], links: set[tuple[str, str]]) -> bool:
+    """Whether *members* stay strongly connected through *links*."""
+    index: dict[str, int] = {m: i for i, m in enumerate(members)}
+    successors: list[set[int]] = [set() for _ in members]
+    for source, target in links:
+        successors[index[source]].add(index[target])
+    return len(strongly_connected_components(len(members), successors)) == 1
+
+
+def _suggest_cut(
+    members: list[str], links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]],
+) -> tuple[str, str]:
+    """The link with the fewest edges whose removal splits the cycle.
+
+    Removing one link may leave other cycles among the members, so the
+    fewest-edges link overall is the fallback.
+    """
+    ranked: list[tuple[str, str]] = sorted(links, key=lambda link: (len(links[link]), link))
+    for link in ranked:
+        if not _still_cyclic(members, set(links) - {link}):
+            return link
+    return ranked[0]
+
+
+def _group_links(
+    analysis: Analysis, cluster: str,
+) -> dict[tuple[str, str], list[tuple[Entity, Entity, str]]]:
+    """The entity edges between distinct *cluster* groups, by (source, target) group."""
+    entities: dict[int, Entity] = {}
+    for file_result in analysis:
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+    links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = defaultdict(list)
+    for edge in analysis.edges:
+        source: Entity | None = entities.get(edge.source)
+        target: Entity | None = entities.get(edge.target) if edge.target is not None else None
+        if source is None or target is None:
+            continue
+        pair: tuple[str, str] = (_group(source, cluster), _group(target, cluster))
+        if pair[0] != pair[1]:
+            links[pair].append((source, target, edge.kind))
+    return links
+
+
+def find_cycles(analysis: Analysis, options: ExportOptions) -> list[Cycle]:
+    """Dependency cycles among groups per ``options.cluster``, largest first."""
+    return _cycles(_group_links(analysis, options.cluster))
+
+
+def _cycles(links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]]) -> list[Cycle]:
+    names: list[str] = sorted({label for pair in links for label in pair})
+    index: dict[str, int] = {label: i for i, label in enumerate(names)}
+    successors: list[set[int]] = [set() for _ in names]
+    for source_label, target_label in links:
+        successors[index[source_label]].add(index[target_label])
+    cycles: list[Cycle] = []
+    for component in strongly_connected_components(len(names), successors):
+        if len(component) < 2:
+            continue
+        members: list[str] = [names[i] for i in component]
+        member_set: set[str] = set(members)
+        internal: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = {
+            pair: sorted(edges, key=lambda e: (e[0].path, e[0].row, e[1].path, e[1].row))
+            for pair, edges in sorted(links.items())
+            if pair[0] in member_set and pair[1] in member_set
+        }
+        cycles.append(Cycle(members, internal, _suggest_cut(members, internal)))
+    cycles.sort(key=lambda c: (-len(c.members), -c.edge_count(), c.members))
+    return cycles
+
+
+def _entity_label(entity: Entity) -> str:
+    return f"{entity.path}:{entity.row} {entity.name}"
+
+
+def write_cycles(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Print each cycle's members, the edges linking them, and a suggested cut."""
+    cycles: list[Cycle] = find_cycles(analysis, options)
+    noun: str = {"directory": "directories", "file": "files", "owner": "owners"}.get(
+        options.cluster, "entities",
+    )
+    if not cycles:
+        out.write(f"No dependency cycles among {noun}.\n")
+        return
+    for number, cycle in enumerate(cycles, 1):
+        out.write(
+            f"Cycle {number}: {len(cycle.members)} {noun}, {cycle.edge_count()} edges\n",
+        )
+        for member in cycle.members:
+            out.write(f"  {member}\n")
+        for (source, target), edges in cycle.links.items():
+            out.write(f"  {source} -> {target} ({len(edges)})\n")
+            for source_entity, target_entity, kind in edges:
+                out.write(
+                    f"    {_entity_label(source_entity)} --{kind}--> "
+                    f"{_entity_label(target_entity)}\n",
+                )
+        cut_edges: int = len(cycle.links[cycle.cut])
+        out.write(
+            f"  Suggested break: {cycle.cut[0]} -> {cycle.cut[1]} "
+            f"({cut_edges} edge{'' if cut_edges == 1 else 's'})\n\n",
+        )
+
+
+def write_cycles_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write cycles as JSON: members, links with their edges, and the suggested cut."""
+
+    def endpoint(entity: Entity) -> dict[str, Any]:
+        return {"id": entity.id, "path": entity.path, "row": entity.row, "name": entity.name}
+
+    json.dump(
+        [
+            {
+                "members": cycle.members,
+                "links": [
+                    {
+                        "source": source,
+                        "target": target,
+                        "edges": [
+                            {"kind": kind, "source": endpoint(s), "target": endpoint(t)}
+                            for s, t, kind in edges
+                        ],
+                    }
+                    for (source, target), edges in cycle.links.items()
+                ],
+                "cut": {"source": cycle.cut[0], "target": cycle.cut[1]},
+            }
+            for cycle in find_cycles(analysis, options)
+        ],
+        out,
+        indent=2,
+    )
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Layer reports
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class Layering:
+    """Groups in layers, each depending only on the layers below it."""
+
+    layers: list[list[str]]  # the bottom layer, which depends on no other, first
+    cycles: list[list[str]]  # groups that share a layer because they depend on each other
+    # The links that point back up in each cycle, with the entity edges behind them.
+    upward: dict[tuple[str, str], list[tuple[Entity, Entity, str]]]
+
+
+def _upward_links(
+    members: list[str], links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]],
+) -> list[tuple[str, str]]:
+    """Links among *members* to remove, a suggested break at a time, until no cycle is left."""
+    remaining: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = dict(links)
+    removed: list[tuple[str, str]] = []
+    while True:
+        index: dict[str, int] = {m: i for i, m in enumerate(members)}
+        successors: list[set[int]] = [set() for _ in members]
+        for source, target in remaining:
+            successors[index[source]].add(index[target])
+        tangled: list[list[int]] = [
+            c for c in strongly_connected_components(len(members), successors) if len(c) > 1
+        ]
+        if not tangled:
+            return removed
+        for component in tangled:
+            group: set[str] = {members[i] for i in component}
+            inner: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = {
+                pair: edges for pair, edges in remaining.items()
+                if pair[0] in group and pair[1] in group
+            }
+            cut: tuple[str, str] = _suggest_cut(sorted(group), inner)
+            del remaining[cut]
+            removed.append(cut)
+
+
+def find_layers(analysis: Analysis, options: ExportOptions) -> Layering:
+    """Layer groups per ``options.cluster`` by their dependencies, collapsing cycles."""
+    links: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = _group_links(
+        analysis, options.cluster,
+    )
+    layers: list[list[str]] = layer_rows(
+        sorted({label for pair in links for label in pair}), links,
+    )
+    cycles: list[Cycle] = _cycles(links)
+    upward: dict[tuple[str, str], list[tuple[Entity, Entity, str]]] = {}
+    for cycle in cycles:
+        for pair in _upward_links(cycle.members, cycle.links):
+            upward[pair] = cycle.links[pair]
+    return Layering(layers, [c.members for c in cycles], dict(sorted(upward.items())))
+
+
+def write_layers(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Print the layers top down, marking cycles, then the upward dependencies."""
+    layering: Layering = find_layers(analysis, options)
+    noun: str = {"directory": "directories", "file": "files", "owner": "owners"}.get(
+        options.cluster, "entities",
+    )
+    if not layering.layers:
+        out.write(f"No dependencies among {noun}.\n")
+        return
+    cycle_of: dict[str, int] = {
+        member: number for number, members in enumerate(layering.cycles, 1) for member in members
+    }
+    out.write(
+        f"{len(layering.layers)} layers of {noun}, top first; "
+        f"{len(layering.upward)} upward dependenc{'y' if len(layering.upward) == 1 else 'ies'}\n",
+    )
+    for depth in range(len(layering.layers) - 1, -1, -1):
+        out.write(f"Layer {depth}\n")
+        for member in layering.layers[depth]:
+            mark: str = f" (cycle {cycle_of[member]})" if member in cycle_of else ""
+            out.write(f"  {member}{mark}\n")
+    if not layering.upward:
+        return
+    out.write("\nUpward dependencies\n")
+    for (source, target), edges in layering.upward.items():
+        out.write(f"  {source} -> {target} ({len(edges)})\n")
+        for source_entity, target_entity, kind in edges:
+            out.write(
+                f"    {_entity_label(source_entity)} --{kind}--> "
+                f"{_entity_label(target_entity)}\n",
+            )
+
+
+def write_layers_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write the layers, bottom first, the cycles, and the upward dependencies as JSON."""
+
+    def endpoint(entity: Entity) -> dict[str, Any]:
+        return {"id": entity.id, "path": entity.path, "row": entity.row, "name": entity.name}
+
+    layering: Layering = find_layers(analysis, options)
+    json.dump(
+        {
+            "layers": layering.layers,
+            "cycles": layering.cycles,
+            "upward": [
+                {
+                    "source": source,
+                    "target": target,
+                    "edges": [
+                        {"kind": kind, "source": endpoint(s), "target": endpoint(t)}
+                        for s, t, kind in edges
+                    ],
+                }
+                for (source, target), edges in layering.upward.items()
+            ],
+        },
+        out,
+        indent=2,
+    )
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Ownership boundaries
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class Boundary:
+    """The dependencies of one owner's code on another's."""
+
+    source: str  # owners, as in CODEOWNERS, or UNOWNED
+    target: str
+    edges: list[tuple[Entity, Entity, str]]  # (source, target, edge kind)
+    internal: list[tuple[Entity, Entity, str]]  # those on entities the target does not export
+
+
+def find_boundaries(analysis: Analysis) -> list[Boundary]:
+    """Dependencies across owners, those reaching into internals first."""
+    entities: dict[int, Entity] = {}
+    for file_result in analysis:
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+    boundaries: dict[tuple[str, str], Boundary] = {}
+    for edge in analysis.edges:
+        source: Entity | None = entities.get(edge.source)
+        target: Entity | None = entities.get(edge.target) if edge.target is not None else None
+        if source is None or target is None:
+            continue
+        pair: tuple[str, str] = (_group(source, "owner"), _group(target, "owner"))
+        if pair[0] == pair[1]:
+            continue
+        boundary: Boundary = boundaries.setdefault(pair, Boundary(*pair, [], []))
+        boundary.edges.append((source, target, edge.kind))
+        parent: Entity | None = entities.get(target.parent) if target.parent is not None else None
+        if not is_exported(target, parent):
+            boundary.internal.append((source, target, edge.kind))
+    return sorted(
+        boundaries.values(),
+        key=lambda b: (-len(b.internal), -len(b.edges), b.source, b.target),
+    )
+
+
+def write_boundaries(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Print each owner's dependencies on another's code, listing uses of internals."""
+    boundaries: list[Boundary] = find_boundaries(analysis)
+    if not boundaries:
+        out.write("No dependencies between owners.\n")
+        return
+    for boundary in boundaries:
+        out.write(
+            f"{boundary.source} -> {boundary.target}: {len(boundary.edges)} edge"
+            f"{'' if len(boundary.edges) == 1 else 's'}, {len(boundary.internal)} into internals\n",
+        )
+        for source, target, kind in boundary.internal:
+            out.write(f"  {_entity_label(source)} --{kind}--> {_entity_label(target)}\n")
+
+
+def write_boundaries_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write owner-to-owner dependencies as JSON, with the edges into internals."""
+
+    def endpoint(entity: Entity) -> dict[str, Any]:
+        return {"id": entity.id, "path": entity.path, "row": entity.row, "name": entity.name}
+
+    json.dump(
+        [
+            {
+                "source": boundary.source,
+                "target": boundary.target,
+                "edges": len(boundary.edges),
+                "internal": [
+                    {"kind": kind, "source": endpoint(s), "target": endpoint(t)}
+                    for s, t, kind in boundary.internal
+                ],
+            }
+            for boundary in find_boundaries(analysis)
+        ],
+        out,
+        indent=2,
+    )
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Unused entities
+# ---------------------------------------------------------------------------
+
+# Entity kinds the unused report looks at: those resolved edges lead to.
+_UNUSED_KINDS: frozenset[str] = frozenset({"function", "method"})
+
+# Attrs of code called from elsewhere than a visible call site: frameworks
+# find annotated and decorated code by reflection, and overrides and
+# constructors are called through their base class or type.
+_CALLED_INDIRECTLY_ATTRS: tuple[str, ...] = (
+    "annotations", "attributes", "constructor", "decorators", "override",
+)
+
+# Edges that join several entities into one declaration: a reference to any
+# of them counts for all.
+_JOINING_EDGES: frozenset[str] = frozenset({"defines", "partial"})
+
+
+def find_unused(analysis: Analysis) -> tuple[list[Entity], dict[int, str]]:
+    """Exported functions and methods nothing in the analysis refers to.
+
+    Entry points (``main``, tests), test files, and code called indirectly
+    (see ``_CALLED_INDIRECTLY_ATTRS``) are left out, as are interface
+    members and the methods implementing them.  Returns the entities, by
+    language and position, and the qualified names of all entities.
+    """
+    entities: dict[int, Entity] = {}
+    names: dict[int, str] = {}
+    for file_result in analysis:
+        names.update(qualified_names(file_result.entities))
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+    members: dict[int, set[str]] = defaultdict(set)
+    for entity in entities.values():
+        if entity.parent is not None:
+            members[entity.parent].add(entity.name)
+    referenced: set[int] = set()
+    joined: list[tuple[int, int]] = []
+    # Types, and the names of the interface methods each one implements.
+    implemented: dict[int, set[str]] = defaultdict(set)
+    for edge in analysis.edges:
+        if edge.target is None or edge.source == edge.target:
+            continue
+        if edge.kind in _JOINING_EDGES:
+            joined.append((edge.source, edge.target))
+        elif edge.kind == "implements":
+            implemented[edge.source].update(members.get(edge.target, ()))
+        else:
+            referenced.add(edge.target)
+    for source, target in joined:
+        if source in referenced or target in referenced:
+            referenced.update((source, target))
+    go_types: dict[tuple[str, str], int] = {
+        (os.path.dirname(e.path), e.name): e.id
+        for e in entities.values() if e.language == "go" and e.kind in ("struct", "type")
+    }
+    unused: list[Entity] = []
+    for entity in entities.values():
+        if entity.kind not in _UNUSED_KINDS or entity.id in referenced:
+            continue
+        parent: Entity | None = entities.get(entity.parent) if entity.parent is not None else None
+        owner: int | None = parent.id if parent is not None and parent.kind != "file" else None
+        if entity.language == "go" and "receiver" in entity.attrs:
+            owner = go_types.get((os.path.dirname(entity.path), entity.attrs["receiver"]))
+        if (
+            not is_exported(entity, parent)
+            or is_entry_point(entity)
+            or is_test_path(entity.path)
+            or entity.language == "sql"  # routines are called from queries, which are not seen
+            or any(entity.attrs.get(a) for a in _CALLED_INDIRECTLY_ATTRS)
+            or (entity.name.startswith("__") and entity.name.endswith("__"))
+            or (parent is not None and parent.kind in ("interface", "trait"))
+            or (owner is not None and entity.name in implemented.get(owner, ()))
+        ):
+            continue
+        unused.append(entity)
+    unused.sort(key=lambda e: (e.language, e.path, e.row, e.col))
+    return unused, names
+
+
+def write_unused(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """List unused exported functions and methods, per language."""
+    unused, names = find_unused(analysis)
+    if not unused:
+        out.write("No unused exported functions or methods.\n")
+        return
+    for language, group in itertools.groupby(unused, key=lambda e: e.language):
+        entities: list[Entity] = list(group)
+        out.write(f"{language}: {len(entities)} unused\n")
+        for entity in entities:
+            out.write(f"  {entity.path}:{entity.row} {entity.kind} {names[entity.id]}\n")
+
+
+def write_unused_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write unused exported entities as JSON, keyed by language."""
+    unused, names = find_unused(analysis)
+    data: dict[str, list[dict[str, Any]]] = defaultdict(list)
+    for entity in unused:
+        data[entity.language].append({
+            "id": entity.id, "uid": entity.uid, "kind": entity.kind, "name": entity.name,
+            "qualified": names[entity.id], "path": entity.path, "row": entity.row,
+        })
+    json.dump(data, out, indent=2)
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Untested entities
+# ---------------------------------------------------------------------------
+
+
+def find_untested(analysis: Analysis) -> tuple[list[Entity], dict[str, int], dict[int, str]]:
+    """Exported functions and methods outside test files that no ``tests`` edge reaches.
+
+    Where a language's calls are not resolved, a test importing a file
+    covers the functions in it.  Returns the untested entities, by language
+    and position; the number of functions and methods considered per
+    language; and the qualified names of all entities.
+    """
+    entities: dict[int, Entity] = {}
+    names: dict[int, str] = {}
+    for file_result in analysis:
+        names.update(qualified_names(file_result.entities))
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+    tested: set[int] = {
+        e.target for e in analysis.edges if e.kind == "tests" and e.target is not None
+    }
+    # Languages whose tests reach functions, not only files.
+    precise: set[str] = {
+        entities[t].language for t in tested if t in entities and entities[t].kind != "file"
+    }
+    files: dict[str, int] = {e.path: e.id for e in entities.values() if e.kind == "file"}
+    totals: dict[str, int] = defaultdict(int)
+    untested: list[Entity] = []
+    for entity in entities.values():
+        parent: Entity | None = entities.get(entity.parent) if entity.parent is not None else None
+        if (
+            entity.kind not in _UNUSED_KINDS
+            or is_test_path(entity.path)
+            or is_entry_point(entity)
+            or not is_exported(entity, parent)
+            or (parent is not None and parent.kind in ("interface", "trait"))
+        ):
+            continue
+        totals[entity.language] += 1
+        if entity.id in tested or (
+            entity.language not in precise and files.get(entity.path) in tested
+        ):
+            continue
+        untested.append(entity)
+    untested.sort(key=lambda e: (e.language, e.path, e.row, e.col))
+    return untested, totals, names
+
+
+def write_untested(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """List untested exported functions and methods, per language."""
+    untested, totals, names = find_untested(analysis)
+    if not totals:
+        out.write("No exported functions or methods outside tests.\n")
+        return
+    by_language: dict[str, list[Entity]] = defaultdict(list)
+    for entity in untested:
+        by_language[entity.language].append(entity)
+    for language, total in sorted(totals.items()):
+        entities: list[Entity] = by_language.get(language, [])
+        out.write(f"{language}: {len(entities)} of {total} functions and methods untested\n")
+        for entity in entities:
+            out.write(f"  {entity.path}:{entity.row} {entity.kind} {names[entity.id]}\n")
+
+
+def write_untested_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write untested exported entities as JSON, keyed by language, with totals."""
+    untested, totals, names = find_untested(analysis)
+    data: dict[str, dict[str, Any]] = {
+        language: {"total": total, "untested": []} for language, total in sorted(totals.items())
+    }
+    for entity in untested:
+        data[entity.language]["untested"].append({
+            "id": entity.id, "uid": entity.uid, "kind": entity.kind, "name": entity.name,
+            "qualified": names[entity.id], "path": entity.path, "row": entity.row,
+        })
+    json.dump(data, out, indent=2)
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Declared and used dependencies
+# ---------------------------------------------------------------------------
+
+
+def find_dependency_problems(analysis: Analysis) -> list[dict[str, Any]]:
+    """Per package manifest: dependencies never imported, and imports never declared.
+
+    Only dependencies the code should import are checked for use: go
+    requirements not marked indirect, npm and cargo ``dependencies``, and
+    maven ``compile`` and ``runtime`` scopes.  Undeclared imports are the
+    third-party imports the linker found no dependency for.
+    """
+    manifests: dict[str, dict[str, Any]] = {}
+    dependencies: list[Entity] = []
+    undeclared: list[Entity] = []
+    for file_result in analysis:
+        for entity in file_result.entities:
+            if entity.kind == "module" and "ecosystem" in entity.attrs:
+                manifests[entity.path] = {
+                    "path": entity.path, "module": entity.name,
+                    "ecosystem": entity.attrs["ecosystem"], "unused": [], "undeclared": [],
+                }
+            elif entity.kind == "dependency":
+                dependencies.append(entity)
+            elif "undeclared" in entity.attrs:
+                undeclared.append(entity)
+    used: set[int] = {
+        e.target for e in analysis.edges if e.kind == "uses" and e.target is not None
+    }
+    for entity in dependencies:
+        if entity.id not in used and entity.attrs.get("scope") in RUNTIME_SCOPES:
+            manifests[entity.path]["unused"].append({
+                "name": entity.name, "version": entity.attrs.get("version"),
+                "scope": entity.attrs["scope"], "row": entity.row,
+            })
+    for entity in undeclared:
+        if entity.attrs["undeclared"] in manifests:
+            manifests[entity.attrs["undeclared"]]["undeclared"].append({
+                "import": entity.name, "path": entity.path, "row": entity.row,
+            })
+    return [manifests[path] for path in sorted(manifests)]
+
+
+def write_dependencies(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """List unused and undeclared dependencies, per package manifest."""
+    problems: list[dict[str, Any]] = find_dependency_problems(analysis)
+    if not problems:
+        out.write("No package manifests.\n")
+        return
+    for manifest in problems:
+        out.write(
+            f"{manifest['path']} ({manifest['ecosystem']} {manifest['module']}): "
+            f"{len(manifest['unused'])} unused, {len(manifest['undeclared'])} undeclared\n",
+        )
+        for dependency in manifest["unused"]:
+            version: str = f" {dependency['version']}" if dependency["version"] else ""
+            out.write(f"  unused: {dependency['name']}{version} (line {dependency['row']})\n")
+        for usage in manifest["undeclared"]:
+            out.write(f"  undeclared: {usage['import']} ({usage['path']}:{usage['row']})\n")
+
+
+def write_dependencies_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write unused and undeclared dependencies as JSON, one object per manifest."""
+    json.dump(find_dependency_problems(analysis), out, indent=2)
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# Tech-debt markers
+# ---------------------------------------------------------------------------
+
+# Order of the todos report's groups; the worst first.
+_MARKERS: tuple[str, ...] = ("FIXME", "HACK", "XXX", "TODO")
+
+
+def find_markers(analysis: Analysis) -> list[dict[str, Any]]:
+    """The TODO, FIXME, HACK, and XXX comments, by marker and position.
+
+    Each names the entity the comment is in, by qualified name, or its
+    file when it is in no other.
+    """
+    markers: list[dict[str, Any]] = []
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        names[file_result.entities[0].id] = file_result.path
+        for entity in file_result.entities:
+            if entity.kind != "comment" or "marker" not in entity.attrs:
+                continue
+            markers.append({
+                "marker": entity.attrs["marker"],
+                "ticket": entity.attrs.get("ticket"),
+                "author": entity.attrs.get("author"),
+                "text": entity.attrs["text"],
+                "path": entity.path, "row": entity.row, "col": entity.col,
+                "in": names.get(entity.parent, file_result.path),
+                "owner": entity.attrs.get("owner"),
+                "uid": entity.uid,
+            })
+    markers.sort(key=lambda m: (_MARKERS.index(m["marker"]), m["path"], m["row"], m["col"]))
+    return markers
+
+
+def write_markers(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """List tech-debt marker comments, grouped by marker."""
+    markers: list[dict[str, Any]] = find_markers(analysis)
+    if not markers:
+        out.write("No TODO, FIXME, HACK, or XXX comments.\n")
+        return
+    for marker, group in itertools.groupby(markers, key=lambda m: m["marker"]):
+        found: list[dict[str, Any]] = list(group)
+        out.write(f"{marker}: {len(found)}\n")
+        for m in found:
+            ticket: str = f" [{m['ticket']}]" if m["ticket"] else ""
+            owner: str = f" {m['owner']}" if m["owner"] else ""
+            line: str = m["text"].split("\n", 1)[0]
+            out.write(f"  {m['path']}:{m['row']}{ticket} {line} (in {m['in']}){owner}\n")
+
+
+def write_markers_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write tech-debt marker comments as a JSON list."""
+    json.dump(find_markers(analysis), out, indent=2)
+    out.write("\n")
+
+
+# ---------------------------------------------------------------------------
+# License headers
+# ---------------------------------------------------------------------------
+
+
+def find_license_problems(analysis: Analysis) -> dict[str, Any]:
+    """Files without a license header, and files whose licenses conflict.
+
+    A file conflicts when it names several licenses, or another one than
+    most files under the same analyzed path.  Data files, docs, and
+    manifests need no header.
+    """
+    files: list[tuple[str, str, list[str]]] = []
+    counts: dict[str, dict[str, int]] = defaultdict(lambda: defaultdict(int))
+    for file_result in analysis:
+        if file_result.language in HEADERLESS_LANGUAGES or is_manifest(Path(file_result.path)):
+            continue
+        root: str = file_result.root or ""
+        licenses: list[str] = file_result.entities[0].attrs.get("licenses", [])
+        files.append((file_result.path, root, licenses))
+        if licenses:
+            counts[root][licenses[0]] += 1
+    prevailing: dict[str, str] = {
+        root: max(sorted(found), key=lambda name: found[name]) for root, found in counts.items()
+    }
+    totals: dict[str, int] = defaultdict(int)
+    for found in counts.values():
+        for name, count in found.items():
+            totals[name] += count
+    missing: list[str] = []
+    conflicting: list[dict[str, Any]] = []
+    for path, root, licenses in files:
+        if not licenses:
+            missing.append(path)
+        elif len(licenses) > 1 or licenses[0] != prevailing[root]:
+            conflicting.append({"path": path, "licenses": licenses, "prevailing": prevailing[root]})
+    return {
+        "licenses": dict(sorted(totals.items(), key=lambda item: (-item[1], item[0]))),
+        "files": len(files),
+        "missing": sorted(missing),
+        "conflicting": sorted(conflicting, key=lambda c: c["path"]),
+    }
+
+
+def write_licenses(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Summarize license headers: the licenses found, and files missing or at odds."""
+    problems: dict[str, Any] = find_license_problems(analysis)
+    if not problems["licenses"]:
+        out.write(f"No license headers in {problems['files']} files.\n")
+        return
+    out.write("Licenses:\n")
+    for name, count in problems["licenses"].items():
+        out.write(f"  {name}: {count}\n")
+    if problems["missing"]:
+        out.write(f"\nMissing a license header: {len(problems['missing'])}\n")
+        for path in problems["missing"]:
+            out.write(f"  {path}\n")
+    if problems["conflicting"]:
+        out.write(f"\nConflicting licenses: {len(problems['conflicting'])}\n")
+        for c in problems["conflicting"]:
+            out.write(f"  {c['path']}: {', '.join(c['licenses'])} (most are {c['prevailing']})\n")
+    if not problems["missing"] and not problems["conflicting"]:
+        out.write(f"\nAll {problems['files']} files have a license header, and none conflict.\n")
+
+
+def write_licenses_json(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write the license header summary as a JSON object."""
+    json.dump(find_license_problems(analysis), out, indent=2)
+    out.write("\n")
+
+
+# Reports for ``analyze --report``, by output format.
+REPORTS: dict[str, dict[str, Callable[[Analysis, TextIO, ExportOptions], None]]] = {
+    "cycles": {"json": write_cycles_json, "text": write_cycles},
+    "dependencies": {"json": write_dependencies_json, "text": write_dependencies},
+    "layers": {"json": write_layers_json, "text": write_layers},
+    "licenses": {"json": write_licenses_json, "text": write_licenses},
+    "owners": {"json": write_boundaries_json, "text": write_boundaries},
+    "todos": {"json": write_markers_json, "text": write_markers},
+    "untested": {"json": write_untested_json, "text": write_untested},
+    "unused": {"json": write_unused_json, "text": write_unused},
+}
+
+# Edge kinds each report resolves unless --edges picks others.
+REPORT_EDGES: dict[str, tuple[str, ...]] = {
+    "cycles": ("calls", "imports"),
+    "dependencies": ("depends", "uses"),
+    "layers": ("calls", "imports"),
+    "licenses": (),
+    "owners": ("calls", "imports"),
+    "todos": (),
+    "untested": ("tests",),
+    "unused": ("calls", "defines", "handles", "implements", "partial"),
+}
+
+
+# ---------------------------------------------------------------------------
+# Mermaid
+# ---------------------------------------------------------------------------
+
+# Entity kinds drawn as classes in a class diagram, and their members.
+_MERMAID_CLASS_KINDS: frozenset[str] = frozenset(
+    {"class", "enum", "interface", "object", "struct", "trait"},
+)
+_MERMAID_METHOD_KINDS: frozenset[str] = frozenset({"function", "method"})
+_MERMAID_FIELD_KINDS: frozenset[str] = frozenset({"event", "field", "property"})
+
+
+def _mermaid_label(text: str) -> str:
+    """Quote a node or class label; Mermaid has entity codes rather than escapes."""
+    return '"' + text.replace("&", "#amp;").replace('"', "#quot;") + '"'
+
+
+def write_mermaid(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a ``graph TD`` dependency diagram, grouped like the DSM.
+
+    Nodes are directories, files, or entities per ``options.cluster``;
+    edges are labelled with how many resolved edges they stand for, and
+    nodes in a cycle are highlighted.
+    """
+    dsm: _Dsm = _build_dsm(analysis, options)
+    out.write("graph TD\n")
+    for i, label in enumerate(dsm.labels):
+        out.write(f"    g{i}[{_mermaid_label(label)}]\n")
+    for i, row in enumerate(dsm.cells):
+        for j, count in enumerate(row):
+            if count and i != j:
+                out.write(f"    g{i} -->|{count}| g{j}\n")
+    cyclic: list[int] = sorted(i for cycle in dsm.cycles for i in cycle)
+    if cyclic:
+        out.write("    classDef cycle fill:#fdd,stroke:#c0392b\n")
+        out.write(f"    class {','.join(f'g{i}' for i in cyclic)} cycle\n")
+
+
+def write_mermaid_class(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write a ``classDiagram`` of types, their members, and the edges between them.
+
+    Methods of a Rust ``impl`` and Go methods are listed under their type
+    when that type is analyzed.  A resolved edge from or to a member counts
+    for the type declaring it; each pair of types is drawn once per edge
+    kind, and ``implements`` edges as realizations.
+    """
+    classes: dict[int, Entity] = {}
+    members: dict[int, list[Entity]] = defaultdict(list)
+    owner: dict[int, int] = {}  # entity id -> id of the class it belongs to
+    impls: list[tuple[str, list[Entity]]] = []
+    receivers: dict[tuple[str, str], list[Entity]] = defaultdict(list)  # (package, type)
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        impl_members: dict[int, list[Entity]] = defaultdict(list)
+        for entity in file_result.entities:
+            parent: int | None = entity.parent
+            if entity.kind in _MERMAID_CLASS_KINDS:
+                classes[entity.id] = dataclasses.replace(entity, name=names[entity.id])
+                owner[entity.id] = entity.id
+            elif entity.kind == "impl":
+                impls.append((names[entity.id], impl_members[entity.id]))
+            elif entity.language == "go" and "receiver" in entity.attrs:
+                receivers[(os.path.dirname(entity.path), entity.attrs["receiver"])].append(entity)
+            elif parent is not None and parent in owner:
+                owner[entity.id] = owner[parent]
+                if parent in classes:
+                    members[parent].append(entity)
+            elif parent is not None and parent in impl_members:
+                impl_members[parent].append(entity)
+    by_name: dict[str, list[int]] = defaultdict(list)
+    for entity in classes.values():
+        by_name[entity.name].append(entity.id)
+    for name, methods in impls:
+        targets: list[int] = by_name.get(name, [])
+        if len(targets) == 1:
+            members[targets[0]].extend(methods)
+            owner.update((m.id, targets[0]) for m in methods)
+    for entity in classes.values():
+        if entity.language == "go":
+            methods = receivers.get((os.path.dirname(entity.path), entity.name), [])
+            members[entity.id].extend(methods)
+            owner.update((m.id, entity.id) for m in methods)
+
+    out.write("classDiagram\n")
+    for entity in sorted(classes.values(), key=lambda e: (e.path, e.row, e.col)):
+        out.write(f"    class c{entity.id}[{_mermaid_label(entity.name)}] {{\n")
+        if entity.kind != "class":
+            out.write(f"        <<{entity.kind}>>\n")
+        for member in members[entity.id]:
+            if member.kind in _MERMAID_FIELD_KINDS:
+                out.write(f"        {member.name}\n")
+            elif member.kind in _MERMAID_METHOD_KINDS:
+                out.write(f"        {member.name}()\n")
+        out.write("    }\n")
+    seen: set[tuple[str, int, int]] = set()
+    for edge in analysis.edges:
+        if edge.target is None or edge.source not in owner or edge.target not in owner:
+            continue
+        key: tuple[str, int, int] = (edge.kind, owner[edge.source], owner[edge.target])
+        if key[1] == key[2] or key in seen:
+            continue
+        seen.add(key)
+        if edge.kind == "implements":
+            out.write(f"    c{key[2]} <|.. c{key[1]}\n")
+        else:
+            out.write(f"    c{key[1]} ..> c{key[2]} : {edge.kind}\n")
+
+
+# ---------------------------------------------------------------------------
+# LSIF
+# ---------------------------------------------------------------------------
+
+LSIF_VERSION: str = "0.4.3"
+
+
+def name_position(entity: Entity, lines: list[str]) -> tuple[int, int]:
+    """Where *entity*'s name is spelled in its declaration, else where it starts.
+
+    Definition ranges cover just the name, like those of language servers,
+    so they do not enclose the references inside the declaration.
+    """
+    for row in range(entity.row, min(entity.end_row, len(lines)) + 1):
+        start: int = entity.col - 1 if row == entity.row else 0
+        match: re.Match[str] | None = re.search(
+            rf"(?<![\w$]){re.escape(entity.name)}(?![\w$])", lines[row - 1][start:],
+        )
+        if match is not None:
+            return row, start + match.start() + 1
+        if row - entity.row >= 2:
+            break  # the name is on the first lines of a declaration, or not at all
+    return entity.row, entity.col
+
+
+def write_lsif(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write an LSIF index (one JSON vertex or edge per line) for code navigation.
+
+    Every declaration gets a definition result, and a hover if it has a
+    doc comment.  Resolved edges that record where they occur (call sites)
+    become references, so "find references" and "go to definition" work
+    across files.  Columns are converted from characters to LSIF's UTF-16
+    code units, from the lines of each file.
+    """
+    files: list[FileResult] = list(analysis)  # references must land in their document
+    ids: Iterator[int] = itertools.count(1)
+
+    def emit(element_type: str, label: str, **fields: Any) -> int:
+        element_id: int = next(ids)
+        record: dict[str, Any] = {"id": element_id, "type": element_type, "label": label}
+        out.write(json.dumps({**record, **fields}) + "\n")
+        return element_id
+
+    def span(
+        lines: list[str], start_row: int, start_col: int, end_row: int, end_col: int,
+    ) -> dict[str, Any]:
+        def character(row: int, col: int) -> int:
+            return column(lines[row - 1], col, "utf-16") - 1 if row <= len(lines) else col - 1
+
+        return {
+            "start": {"line": start_row - 1, "character": character(start_row, start_col)},
+            "end": {"line": end_row - 1, "character": character(end_row, end_col)},
+        }
+
+    emit(
+        "vertex", "metaData", version=LSIF_VERSION, projectRoot=Path.cwd().as_uri(),
+        positionEncoding="utf-16", toolInfo={"name": "autosg"},
+    )
+    project: int = emit("vertex", "project", kind=files[0].language if files else "")
+    entities: dict[int, Entity] = {
+        e.id: e for f in files for e in f.entities
+        if e.kind != "file" and e.kind not in _DOT_HIDDEN_KINDS
+    }
+    result_sets: dict[int, int] = {}
+    for entity in entities.values():
+        result_sets[entity.id] = emit("vertex", "resultSet")
+        if "doc" in entity.attrs:
+            hover: int = emit("vertex", "hoverResult", result={"contents": [
+                {"language": entity.language, "value": f"{entity.kind} {entity.name}"},
+                entity.attrs["doc"],
+            ]})
+            emit("edge", "textDocument/hover", outV=result_sets[entity.id], inV=hover)
+
+    # Reference sites, by the path of the file they occur in.
+    sites: dict[str, list[tuple[int, int, int]]] = defaultdict(list)  # (target, row, col)
+    for edge in analysis.edges:
+        if edge.target in entities and edge.source in entities and "col" in edge.attrs:
+            sites[entities[edge.source].path].append(
+                (edge.target, edge.attrs["row"], edge.attrs["col"]),
+            )
+
+    definitions: dict[int, tuple[int, int]] = {}  # entity id -> (document, range)
+    references: dict[int, list[tuple[int, int]]] = defaultdict(list)
+    for file_result in files:
+        document: int = emit(
+            "vertex", "document", uri=Path(file_result.path).resolve().as_uri(),
+            languageId=file_result.language,
+        )
+        emit("edge", "contains", outV=project, inVs=[document])
+        source: tuple[bytes, FileEncoding] | None = read_source_utf8(Path(file_result.path))
+        lines: list[str] = source[0].decode("utf-8", errors="replace").split("\n") if source else []
+        ranges: list[int] = []
+        for entity in file_result.entities:
+            if entity.id not in entities:
+                continue
+            row, col = name_position(entity, lines)
+            definition: int = emit(
+                "vertex", "range", **span(lines, row, col, row, col + len(entity.name)),
+            )
+            ranges.append(definition)
+            definitions[entity.id] = (document, definition)
+            emit("edge", "next", outV=definition, inV=result_sets[entity.id])
+            result: int = emit("vertex", "definitionResult")
+            emit("edge", "textDocument/definition", outV=result_sets[entity.id], inV=result)
+            emit("edge", "item", outV=result, inVs=[definition], document=document)
+        for target, row, col in sorted(set(sites.get(file_result.path, []))):
+            end: int = col + len(entities[target].name)
+            reference: int = emit("vertex", "range", **span(lines, row, col, row, end))
+            ranges.append(reference)
+            references[target].append((document, reference))
+            emit("edge", "next", outV=reference, inV=result_sets[target])
+        if ranges:
+            emit("edge", "contains", outV=document, inVs=ranges)
+
+    for target, uses in references.items():
+        result = emit("vertex", "referenceResult")
+        emit("edge", "textDocument/references", outV=result_sets[target], inV=result)
+        definition_document, definition = definitions[target]
+        emit(
+            "edge", "item", outV=result, inVs=[definition], document=definition_document,
+            property="definitions",
+        )
+        for document, group in itertools.groupby(uses, key=lambda use: use[0]):
+            emit(
+                "edge", "item", outV=result, inVs=[r for _d, r in group], document=document,
+                property="references",
+            )
+
+
+# ---------------------------------------------------------------------------
+# Cypher
+# ---------------------------------------------------------------------------
+
+# Entity fields stored as node properties; attrs are stored as one JSON string.
+_CYPHER_NODE_FIELDS: tuple[str, ...] = (
+    "uid", "kind", "name", "path", "language",
+    "row", "col", "end_row", "end_col", "start_byte", "end_byte",
+)
+
+
+def _cypher_name(name: str) -> str:
+    """*name* as a Cypher label or relationship type, quoted when needed."""
+    if re.fullmatch(r"[A-Za-z_][A-Za-z0-9_]*", name):
+        return name
+    return "`" + name.replace("`", "``") + "`"
+
+
+def _cypher_label(kind: str) -> str:
+    """The label for entities of *kind*: ``type_alias`` is ``TypeAlias``."""
+    return _cypher_name("".join(part.capitalize() for part in kind.split("_")) or "Entity")
+
+
+def _cypher_value(value: Any) -> str:
+    """*value* as a Cypher literal; JSON string escapes are valid Cypher."""
+    if value is None:
+        return "null"
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if isinstance(value, (int, float)):
+        return repr(value)
+    if isinstance(value, (list, tuple)):
+        return "[" + ", ".join(_cypher_value(v) for v in value) + "]"
+    if isinstance(value, dict):
+        pairs: list[str] = [f"{_cypher_name(k)}: {_cypher_value(v)}" for k, v in value.items()]
+        return "{" + ", ".join(pairs) + "}"
+    return json.dumps(str(value), ensure_ascii=False)
+
+
+def write_cypher(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """Write Cypher statements that load the structure into Neo4j.
+
+    Every entity is an ``Entity`` node, also labelled by its kind
+    (``Function``, ``Struct``), and merged on its ``uid``, so loading
+    a later run updates nodes rather than duplicating them.  Containment
+    becomes ``CONTAINS`` relationships and resolved edges relationships
+    named by their kind (``CALLS``), with a ``count`` of the edges merged
+    into each.  Statements end with ``;`` for ``cypher-shell``.
+    """
+    out.write(
+        "CREATE CONSTRAINT autosg_entity_uid IF NOT EXISTS"
+        " FOR (e:Entity) REQUIRE e.uid IS UNIQUE;\n",
+    )
+    uids: dict[int, str] = {}
+    parents: list[tuple[int, int]] = []
+    for file_result in analysis:
+        by_kind: dict[str, list[Entity]] = defaultdict(list)
+        for entity in file_result.entities:
+            uids[entity.id] = entity.uid
+            by_kind[entity.kind].append(entity)
+            if entity.parent is not None:
+                parents.append((entity.parent, entity.id))
+        for kind, entities in by_kind.items():
+            rows: list[dict[str, Any]] = [
+                {
+                    **{name: getattr(e, name) for name in _CYPHER_NODE_FIELDS},
+                    "attrs": json.dumps(e.attrs),
+                }
+                for e in entities
+            ]
+            out.write(
+                f"UNWIND {_cypher_value(rows)} AS row\n"
+                f"MERGE (e:Entity {{uid: row.uid}}) SET e:{_cypher_label(kind)}, e += row;\n",
+            )
+    counts: dict[tuple[str, str, str], int] = defaultdict(int)
+    for kind, source, target in _graph_edges(analysis, parents):
+        if source in uids and target in uids:
+            counts[(kind, uids[source], uids[target])] += 1
+    by_type: dict[str, list[dict[str, Any]]] = defaultdict(list)
+    for (kind, source_uid, target_uid), count in counts.items():
+        by_type[kind].append({"source": source_uid, "target": target_uid, "count": count})
+    for kind, rows in by_type.items():
+        for start in range(0, len(rows), 1000):
+            out.write(
+                f"UNWIND {_cypher_value(rows[start : start + 1000])} AS row\n"
+                "MATCH (a:Entity {uid: row.source}), (b:Entity {uid: row.target})\n"
+                f"MERGE (a)-[r:{_cypher_name(kind.upper())}]->(b) SET r.count = row.count;\n",
+            )
+
+
+# ---------------------------------------------------------------------------
+# SQLite
+# ---------------------------------------------------------------------------
+
+_SQLITE_SCHEMA: str = """
+CREATE TABLE files (
+    path      TEXT PRIMARY KEY,
+    language  TEXT NOT NULL
+);
+CREATE TABLE entities (
+    id        INTEGER PRIMARY KEY,
+    uid       TEXT    NOT NULL UNIQUE,  -- stable across runs
+    kind      TEXT    NOT NULL,
+    name      TEXT    NOT NULL,
+    path      TEXT    NOT NULL REFERENCES files (path),
+    language  TEXT    NOT NULL,
+    parent    INTEGER REFERENCES entities (id),
+    attrs     TEXT    NOT NULL  -- JSON object
+);
+CREATE TABLE locations (
+    entity_id INTEGER PRIMARY KEY REFERENCES entities (id),
+    path      TEXT    NOT NULL,
+    row       INTEGER NOT NULL,
+    col       INTEGER NOT NULL,
+    end_row   INTEGER NOT NULL,
+    end_col   INTEGER NOT NULL,
+    start_byte INTEGER,  -- offsets into the UTF-8 text; NULL from some plugins and notebooks
+    end_byte  INTEGER
+);
+CREATE TABLE edges (
+    kind      TEXT    NOT NULL,
+    source    INTEGER NOT NULL REFERENCES entities (id),
+    target    INTEGER REFERENCES entities (id),
+    attrs     TEXT    NOT NULL  -- JSON object
+);
+CREATE TABLE errors (
+    path      TEXT    NOT NULL REFERENCES files (path),
+    kind      TEXT    NOT NULL,  -- syntax, missing, or extraction
+    message   TEXT    NOT NULL,
+    row       INTEGER NOT NULL,
+    col       INTEGER NOT NULL,
+    end_row   INTEGER NOT NULL,
+    end_col   INTEGER NOT NULL
+);
+CREATE INDEX entities_name ON entities (name);
+CREATE INDEX entities_kind ON entities (kind);
+CREATE INDEX edges_source ON edges (source);
+CREATE INDEX edges_target ON edges (target);
+"""
+
+
+def write_sqlite(analysis: Analysis, path: Path, options: ExportOptions) -> None:
+    """Write files, entities, locations, edges, and parse errors to a new SQLite database.
+
+    An existing database at *path* is replaced.  ``PRAGMA user_version``
+    holds the schema version.
+    """
+    path.unlink(missing_ok=True)
+    conn: sqlite3.Connection = sqlite3.connect(path)
+    try:
+        conn.executescript(_SQLITE_SCHEMA)
+        conn.execute(f"PRAGMA user_version = {SCHEMA_VERSION}")
+        for file_result in analysis:
+            conn.execute(
+                "INSERT INTO files (path, language) VALUES (?, ?)",
+                (file_result.path, file_result.language),
+            )
+            conn.executemany(
+                "INSERT INTO entities (id, uid, kind, name, path, language, parent, attrs)"
+                " VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+                [
+                    (
+                        e.id, e.uid, e.kind, e.name, e.path, e.language, e.parent,
+                        json.dumps(e.attrs),
+                    )
+                    for e in file_result.entities
+                ],
+            )
+            conn.executemany(
+                "INSERT INTO locations"
+                " (entity_id, path, row, col, end_row, end_col, start_byte, end_byte)"
+                " VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+                [
+                    (e.id, e.path, e.row, e.col, e.end_row, e.end_col, e.start_byte, e.end_byte)
+                    for e in file_result.entities
+                ],
+            )
+            conn.executemany(
+                "INSERT INTO errors (path, kind, message, row, col, end_row, end_col)"
+                " VALUES (?, ?, ?, ?, ?, ?, ?)",
+                [
+                    (e.path, e.kind, e.message, e.row, e.col, e.end_row, e.end_col)
+                    for e in file_result.errors
+                ],
+            )
+        conn.executemany(
+            "INSERT INTO edges (kind, source, target, attrs) VALUES (?, ?, ?, ?)",
+            ((e.kind, e.source, e.target, json.dumps(e.attrs)) for e in analysis.edges),
+        )
+        conn.commit()
+    finally:
+        conn.close()
+
+
+# ---------------------------------------------------------------------------
+# Parquet and Arrow
+# ---------------------------------------------------------------------------
+
+# Columns of each table; a trailing ? marks a nullable one.  Attrs are JSON
+# objects as text, as in SQLite output.
+_COLUMNAR_TABLES: dict[str, tuple[tuple[str, str], ...]] = {
+    "files": (("path", "string"), ("language", "string"), ("root", "string?")),
+    "entities": (
+        ("id", "int64"), ("uid", "string"), ("kind", "string"), ("name", "string"),
+        ("path", "string"), ("language", "string"), ("parent", "int64?"),
+        ("row", "int64"), ("col", "int64"), ("end_row", "int64"), ("end_col", "int64"),
+        ("start_byte", "int64?"), ("end_byte", "int64?"), ("attrs", "string"),
+    ),
+    "edges": (("kind", "string"), ("source", "int64"), ("target", "int64?"), ("attrs", "string")),
+    "errors": (
+        ("path", "string"), ("kind", "string"), ("message", "string"),
+        ("row", "int64"), ("col", "int64"), ("end_row", "int64"), ("end_col", "int64"),
+    ),
+}
+
+# Rows of a table held in memory before they are written as a record batch.
+_COLUMNAR_BATCH: int = 65536
+
+
+class _ColumnarTable:
+    """Rows of one table, written out in record batches as they accumulate."""
+
+    def __init__(self, pa: Any, writer: Any, schema: Any) -> None:
+        self.pa: Any = pa
+        self.writer: Any = writer
+        self.schema: Any = schema
+        self.rows: list[dict[str, Any]] = []
+
+    def append(self, row: dict[str, Any]) -> None:
+        self.rows.append(row)
+        if len(self.rows) >= _COLUMNAR_BATCH:
+            self.flush()
+
+    def flush(self) -> None:
+        if self.rows:
+            self.writer.write_batch(self.pa.RecordBatch.from_pylist(self.rows, schema=self.schema))
+            self.rows = []
+
+    def close(self) -> None:
+        self.flush()
+        self.writer.close()
+
+
+def _write_columnar(
+    analysis: Analysis, directory: Path, suffix: str, open_writer: Callable[[Path, Any], Any],
+) -> None:
+    """Write one file per table of _COLUMNAR_TABLES into *directory*.
+
+    Each table's schema metadata has the schema version as ``autosg.schema_version``.
+    """
+    # Import lazily, as for config files.
+    import pyarrow as pa
+
+    directory.mkdir(parents=True, exist_ok=True)
+    tables: dict[str, _ColumnarTable] = {}
+    try:
+        for name, columns in _COLUMNAR_TABLES.items():
+            schema: Any = pa.schema(
+                [
+                    pa.field(column, getattr(pa, kind.rstrip("?"))(), nullable=kind.endswith("?"))
+                    for column, kind in columns
+                ],
+                metadata={"autosg.schema_version": str(SCHEMA_VERSION)},
+            )
+            writer: Any = open_writer(directory / f"{name}{suffix}", schema)
+            tables[name] = _ColumnarTable(pa, writer, schema)
+        for file_result in analysis:
+            tables["files"].append({
+                "path": file_result.path, "language": file_result.language,
+                "root": file_result.root,
+            })
+            for entity in file_result.entities:
+                record: dict[str, Any] = dataclasses.asdict(entity)
+                record["attrs"] = json.dumps(entity.attrs)
+                tables["entities"].append(record)
+            for error in file_result.errors:
+                tables["errors"].append(dataclasses.asdict(error))
+        for edge in analysis.edges:
+            tables["edges"].append({
+                "kind": edge.kind, "source": edge.source, "target": edge.target,
+                "attrs": json.dumps(edge.attrs),
+            })
+    finally:
+        for table in tables.values():
+            table.close()
+
+
+def write_parquet(analysis: Analysis, path: Path, options: ExportOptions) -> None:
+    """Write files, entities, edges, and parse errors as Parquet tables in directory *path*.
+
+    Each table is streamed in row groups, so results larger than memory can be written.
+    """
+    import pyarrow.parquet as pq
+
+    def open_writer(table_path: Path, schema: Any) -> Any:
+        return pq.ParquetWriter(str(table_path), schema, compression="zstd")
+
+    _write_columnar(analysis, path, ".parquet", open_writer)
+
+
+def write_arrow(analysis: Analysis, path: Path, options: ExportOptions) -> None:
+    """Write the tables of write_parquet as Arrow IPC files in directory *path*."""
+    import pyarrow as pa
+
+    def open_writer(table_path: Path, schema: Any) -> Any:
+        return pa.ipc.new_file(str(table_path), schema)
+
+    _write_columnar(analysis, path, ".arrow", open_writer)
+
+
+# ---------------------------------------------------------------------------
+# CSV
+# ---------------------------------------------------------------------------
+
+
+def write_csv(analysis: Analysis, path: Path, options: ExportOptions) -> None:
+    """Write entities and edges as ``entities.csv`` and ``edges.csv`` in directory *path*.
+
+    Columns are those of the Parquet tables, with missing values left empty.
+    With ``options.adjacency``, ``adjacency.csv`` holds the matrix of dsm
+    output too, built as the entities stream past.
+    """
+    path.mkdir(parents=True, exist_ok=True)
+    entity_columns: list[str] = [column for column, _kind in _COLUMNAR_TABLES["entities"]]
+    groups: dict[int, str] = {}
+    labels: set[str] = set()
+    with open(path / "entities.csv", "w", encoding="utf-8", newline="") as out:
+        writer = csv.writer(out, lineterminator="\n")
+        writer.writerow(entity_columns)
+        for file_result in analysis:
+            for entity in file_result.entities:
+                record: dict[str, Any] = dataclasses.asdict(entity)
+                record["attrs"] = json.dumps(entity.attrs)
+                writer.writerow(["" if record[c] is None else record[c] for c in entity_columns])
+            if options.adjacency:
+                _add_dsm_groups(file_result.entities, options, groups, labels)
+    with open(path / "edges.csv", "w", encoding="utf-8", newline="") as out:
+        writer = csv.writer(out, lineterminator="\n")
+        writer.writerow([column for column, _kind in _COLUMNAR_TABLES["edges"]])
+        for edge in analysis.edges:
+            writer.writerow([
+                edge.kind, edge.source, "" if edge.target is None else edge.target,
+                json.dumps(edge.attrs),
+            ])
+    if options.adjacency:
+        with open(path / "adjacency.csv", "w", encoding="utf-8", newline="") as out:
+            _write_dsm_rows(_dsm_cells(groups, labels, analysis.edges, options), out)
+
+
+# ---------------------------------------------------------------------------
+# Interactive explorer
+# ---------------------------------------------------------------------------
+
+
+def write_html(analysis: Analysis, out: TextIO, options: ExportOptions) -> None:
+    """The graph explorer page of ``serve``, with the analysis embedded for offline use."""
+    entities: list[dict[str, Any]] = [
+        {name: getattr(entity, name) for name in ENTITY_FIELDS}
+        for file_result in analysis
+        for entity in file_result.entities
+    ]
+    edges: list[dict[str, Any]] = [
+        {"source": e.source, "target": e.target, "kind": e.kind}
+        for e in analysis.edges if e.target is not None
+    ]
+    title: str = ", ".join(str(root) for root in analysis.roots)
+    out.write(render_page(title, {"entities": entities, "edges": edges}))
+
+
+# ---------------------------------------------------------------------------
+# Registry
+# ---------------------------------------------------------------------------
+
+# Formats written to a text stream (stdout or -o).
+FORMATS: dict[str, Callable[[Analysis, TextIO, ExportOptions], None]] = {
+    "cypher": write_cypher,
+    "dot": write_dot,
+    "dsm": write_dsm,
+    "dsm-json": write_dsm_json,
+    "gexf": write_gexf,
+    "graphml": write_graphml,
+    "html": write_html,
+    "json": write_json,
+    "jsonl": write_jsonl,
+    "lsif": write_lsif,
+    "mermaid": write_mermaid,
+    "mermaid-class": write_mermaid_class,
+}
+
+# Formats that need a real output path.
+FILE_FORMATS: dict[str, Callable[[Analysis, Path, ExportOptions], None]] = {
+    "arrow": write_arrow,
+    "csv": write_csv,
+    "parquet": write_parquet,
+    "sqlite": write_sqlite,
+}
@@ -0,0 +1,2670 @@
+"""Language-uniform entity extraction on top of tree-sitter.
+
+An *entity* is a named declaration — a function, a type, an import — with
+its source span and a link to the entity that encloses it.  Every language
+maps its own node types onto the same small set of kinds so downstream
+output looks the same whether the input was Go or Rust.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import inspect
+import os
+import re
+from collections.abc import Callable, Iterator
+from dataclasses import dataclass, field
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from tree_sitter import Node, Tree
+
+from .cloning import clone_signature
+from .credentials import SECRET_RULES, find_secrets
+from .features import disabled_features
+from .fingerprinting import FINGERPRINTED_KINDS, fingerprint
+from .measuring import function_metrics
+from .overriding import Definition, NodeKey, node_key, replaces_builtin, run_queries
+from .parsing import (
+    LANGUAGE_IDENTIFIER_TYPES, byte_col_to_char_col, parse_tree, source_lines,
+)
+from .sqltext import looks_like_sql, table_accesses
+
+# ---------------------------------------------------------------------------
+# Entity model
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class Entity:
+    """A named declaration extracted from a source file.
+
+    Rows and columns are 1-indexed; columns count characters, like
+    ``dump-identifiers``.  The end position is exclusive.  ``start_byte``
+    and ``end_byte`` give the same span as 0-indexed offsets into the
+    file's UTF-8 text (None when a plugin does not report them, and in
+    notebooks).  ``id`` numbers entities within one run; ``uid`` is stable
+    across runs (see assign_uids).
+    """
+
+    id: int
+    kind: str  # e.g. "file", "function", "struct", "trait"
+    name: str
+    path: str
+    language: str
+    row: int
+    col: int
+    end_row: int
+    end_col: int
+    parent: int | None = None  # id of the enclosing entity
+    attrs: dict[str, Any] = field(default_factory=dict)
+    uid: str = ""
+    start_byte: int | None = None
+    end_byte: int | None = None
+
+
+@dataclass
+class Edge:
+    """A directed relationship between two entities.
+
+    Extraction produces edges with ``target=None`` that only name what
+    they point at (``attrs["name"]``); linking resolves them to entity ids.
+    """
+
+    kind: str  # e.g. "calls"
+    source: int
+    target: int | None = None
+    attrs: dict[str, Any] = field(default_factory=dict)
+
+
+@dataclass
+class ParseError:
+    """A part of a file that did not parse, or a file whose extraction failed.
+
+    Extraction carries on past syntax errors, so the file's other entities
+    are still there; after an ``extraction`` error only the file entity is.
+    """
+
+    path: str
+    kind: str  # "syntax", "missing" (a token the parser had to assume), or "extraction"
+    message: str
+    row: int
+    col: int
+    end_row: int
+    end_col: int
+
+
+# ---------------------------------------------------------------------------
+# Per-language entity node types
+# ---------------------------------------------------------------------------
+
+# TypeScript, TSX, and JavaScript share most of their declaration syntax.
+# ``variable_declarator`` only counts when it binds a function at module
+# level (``export const Foo = () => ...``); see _js_declarator_kind.
+_JS_ENTITY_TYPES: dict[str, str] = {
+    "abstract_class_declaration": "class",
+    "class_declaration": "class",
+    "enum_declaration": "enum",
+    "function_declaration": "function",
+    "function_signature": "function",
+    "generator_function_declaration": "function",
+    "import_statement": "import",
+    "interface_declaration": "interface",
+    "internal_module": "module",
+    "method_definition": "method",
+    "module": "module",
+    "type_alias_declaration": "type",
+    "variable_declarator": "function",
+}
+
+# C and C++ share declarator syntax.  ``declaration`` and ``field_declaration``
+# only count when they declare a function (a prototype); see _c_function_name.
+_C_ENTITY_TYPES: dict[str, str] = {
+    "declaration": "function",
+    "enum_specifier": "enum",
+    "function_definition": "function",
+    "preproc_include": "import",
+    "struct_specifier": "struct",
+    "type_definition": "type",
+    "union_specifier": "struct",
+}
+
+LANGUAGE_ENTITY_TYPES: dict[str, dict[str, str]] = {
+    # ``command`` only counts for ``source`` and ``.``; see _bash_sourced_name.
+    "bash": {"command": "import", "function_definition": "function"},
+    "c": _C_ENTITY_TYPES,
+    "c_sharp": {
+        "class_declaration": "class",
+        "constructor_declaration": "method",
+        "delegate_declaration": "type",
+        "destructor_declaration": "method",
+        "enum_declaration": "enum",
+        "event_declaration": "event",
+        "event_field_declaration": "event",
+        "field_declaration": "field",
+        "file_scoped_namespace_declaration": "module",
+        "interface_declaration": "interface",
+        "local_function_statement": "function",
+        "method_declaration": "method",
+        "namespace_declaration": "module",
+        "property_declaration": "property",
+        "record_declaration": "class",
+        "record_struct_declaration": "struct",
+        "struct_declaration": "struct",
+        "using_directive": "import",
+    },
+    "cpp": {
+        **_C_ENTITY_TYPES,
+        "alias_declaration": "type",
+        "class_specifier": "class",
+        "field_declaration": "function",
+        "namespace_definition": "module",
+    },
+    "go": {
+        "function_declaration": "function",
+        "import_spec": "import",
+        "method_declaration": "method",
+        "type_alias": "type",
+        "type_spec": "type",
+    },
+    # ``val`` and ``var`` only count in templates; see _scala_member_kind.
+    "scala": {
+        "class_definition": "class",
+        "enum_definition": "enum",
+        "function_declaration": "function",
+        "function_definition": "function",
+        "import_declaration": "import",
+        "object_definition": "object",
+        "package_clause": "package",
+        "trait_definition": "trait",
+        "type_definition": "type",
+        "val_declaration": "property",
+        "val_definition": "property",
+        "var_declaration": "property",
+        "var_definition": "property",
+    },
+    "rust": {
+        "enum_item": "enum",
+        "function_item": "function",
+        "function_signature_item": "function",
+        "impl_item": "impl",
+        "mod_item": "module",
+        "struct_item": "struct",
+        "trait_item": "trait",
+        "type_item": "type",
+        "use_declaration": "use",
+    },
+    "java": {
+        "annotation_type_declaration": "interface",
+        "class_declaration": "class",
+        "constant_declaration": "field",
+        "constructor_declaration": "method",
+        "enum_declaration": "enum",
+        "field_declaration": "field",
+        "import_declaration": "import",
+        "interface_declaration": "interface",
+        "method_declaration": "method",
+        "package_declaration": "package",
+        "record_declaration": "class",
+    },
+    "javascript": _JS_ENTITY_TYPES,
+    "kotlin": {
+        "class_declaration": "class",
+        "companion_object": "object",
+        "function_declaration": "function",
+        "import_header": "import",
+        "object_declaration": "object",
+        "package_header": "package",
+        "property_declaration": "property",
+        "type_alias": "type",
+    },
+    "php": {
+        "class_declaration": "class",
+        "enum_declaration": "enum",
+        "function_definition": "function",
+        "interface_declaration": "interface",
+        "method_declaration": "method",
+        "namespace_definition": "module",
+        "namespace_use_declaration": "import",
+        "trait_declaration": "trait",
+    },
+    "python": {
+        "class_definition": "class",
+        "function_definition": "function",
+        "import_from_statement": "import",
+        "import_statement": "import",
+    },
+    # ``call`` only counts for ``require``; see _ruby_required_name.
+    "ruby": {
+        "call": "import",
+        "class": "class",
+        "method": "function",
+        "module": "module",
+        "singleton_method": "method",
+    },
+    "tsx": _JS_ENTITY_TYPES,
+    "typescript": _JS_ENTITY_TYPES,
+}
+
+# Field holding the entity name, where it is not the usual "name".
+_NAME_FIELDS: dict[tuple[str, str], str] = {
+    ("c", "preproc_include"): "path",
+    ("cpp", "preproc_include"): "path",
+    ("go", "import_spec"): "path",
+    ("python", "import_from_statement"): "module_name",
+    ("rust", "impl_item"): "type",
+    ("rust", "use_declaration"): "argument",
+    ("scala", "val_definition"): "pattern",
+    ("scala", "var_definition"): "pattern",
+    **{(lang, "import_statement"): "source" for lang in ("javascript", "tsx", "typescript")},
+}
+
+def _java_qualified_name(node: Node) -> Node | None:
+    """The dotted name of a ``package`` or ``import`` declaration."""
+    for child in node.named_children:
+        if child.type in ("identifier", "scoped_identifier"):
+            return child
+    return None
+
+
+def _java_field_name(node: Node) -> Node | None:
+    """Name of the first variable in ``int a, b;``."""
+    declarator: Node | None = node.child_by_field_name("declarator")
+    return declarator.child_by_field_name("name") if declarator is not None else None
+
+
+def _python_imported_module(node: Node) -> Node | None:
+    """First module of ``import a.b`` or ``import a.b as c``."""
+    name: Node | None = node.child_by_field_name("name")
+    if name is not None and name.type == "aliased_import":
+        return name.child_by_field_name("name")
+    return name
+
+
+def _c_function_declarator(node: Node) -> Node | None:
+    """The ``function_declarator`` inside pointer and reference declarators."""
+    declarator: Node | None = node.child_by_field_name("declarator")
+    while declarator is not None and declarator.type != "function_declarator":
+        inner: Node | None = declarator.child_by_field_name("declarator")
+        if inner is None and declarator.type == "reference_declarator":
+            inner = declarator.named_children[-1] if declarator.named_children else None
+        declarator = inner
+    return declarator
+
+
+def _c_function_name(node: Node) -> Node | None:
+    """Name of a function definition or prototype (``Foo::bar`` out of class)."""
+    declarator: Node | None = _c_function_declarator(node)
+    if declarator is None:
+        return None
+    name: Node | None = declarator.child_by_field_name("declarator")
+    if name is None or name.type == "parenthesized_declarator":
+        return None  # a function pointer variable: int (*handler)(int);
+    return name
+
+
+def _c_defined_name(node: Node) -> Node | None:
+    """Name of a struct, union, or enum *definition*; forward declarations have none."""
+    if node.child_by_field_name("body") is None:
+        return None
+    return node.child_by_field_name("name")
+
+
+def _c_typedef_name(node: Node) -> Node | None:
+    """The new name of ``typedef struct {...} *Handle;``."""
+    declarator: Node | None = node.child_by_field_name("declarator")
+    while declarator is not None and declarator.type != "type_identifier":
+        declarator = declarator.child_by_field_name("declarator")
+    return declarator
+
+
+def _csharp_variable_name(node: Node) -> Node | None:
+    """Name of the first variable in ``private int a, b;`` or ``event Handler A, B;``."""
+    declaration: Node | None = next(
+        (c for c in node.named_children if c.type == "variable_declaration"), None,
+    )
+    if declaration is None:
+        return None
+    for declarator in declaration.named_children:
+        if declarator.type == "variable_declarator":
+            return declarator.child_by_field_name("name") or next(
+                (c for c in declarator.named_children if c.type == "identifier"), None,
+            )
+    return None
+
+
+def _csharp_using_name(node: Node) -> Node | None:
+    """The namespace or type of ``using [static] [Alias =] X.Y;``."""
+    names: list[Node] = [
+        c for c in node.named_children
+        if c.type in ("identifier", "qualified_name", "generic_name", "alias_qualified_name")
+    ]
+    return names[-1] if names else None
+
+
+def _kotlin_name(node: Node) -> Node | None:
+    """The declared name; the grammar has no ``name`` fields.
+
+    A function's name is its direct ``simple_identifier`` child, which
+    skips the receiver of an extension (``fun String.slug()``).
+    """
+    if node.type in ("import_header", "package_header"):
+        return next((c for c in node.named_children if c.type == "identifier"), None)
+    if node.type == "property_declaration":
+        declaration: Node | None = next(
+            (c for c in node.named_children if c.type == "variable_declaration"), None,
+        )
+        node = declaration if declaration is not None else node
+    for child in node.named_children:
+        if child.type in ("simple_identifier", "type_identifier"):
+            return child
+    return None
+
+
+# Ruby calls that load a file, and whether it is named relative to the caller.
+_RUBY_REQUIRES: dict[str, bool] = {"load": False, "require": False, "require_relative": True}
+
+
+def _ruby_call_method(node: Node) -> str | None:
+    """The method of a receiverless call (``include Comparable``), else None."""
+    if node.child_by_field_name("receiver") is not None:
+        return None
+    method: Node | None = node.child_by_field_name("method")
+    return _node_text(method) if method is not None else None
+
+
+def _ruby_required_name(node: Node) -> Node | None:
+    """The string literal of ``require "json"``; other calls are not entities."""
+    if _ruby_call_method(node) not in _RUBY_REQUIRES:
+        return None
+    arguments: Node | None = node.child_by_field_name("arguments")
+    args: list[Node] = arguments.named_children if arguments is not None else []
+    if len(args) != 1 or _string_value(args[0]) is None:
+        return None
+    return args[0]
+
+
+# Commands that read a file into the running shell.
+_BASH_SOURCING: frozenset[str] = frozenset({".", "source"})
+
+# A leading expansion naming a directory of the tree, dropped from the paths
+# scripts name: ``$(dirname "$0")/``, ``${BASH_SOURCE%/*}/``, ``$ROOT/``.
+_SHELL_DIR_PREFIX_RE: re.Pattern[str] = re.compile(
+    r"^(?:\$\((?:[^()]|\([^()]*\))*\)|`[^`]*`"
+    r"|\$\{(?!(?:HOME|TMPDIR)\b)[^}]*\}|\$(?!(?:HOME|TMPDIR)\b)\w+)/+",
+)
+
+
+def shell_word(node: Node) -> str:
+    """A shell word as the shell reads it, quotes removed and expansions kept."""
+    return node.text.decode("utf-8", errors="replace").replace('"', "").replace("'", "")
+
+
+def shell_path(word: str) -> str:
+    """The path *word* names, without a directory expansion in front."""
+    return _SHELL_DIR_PREFIX_RE.sub("", word, count=1)
+
+
+# Commands the shell runs itself, left out of the ``commands`` a script runs.
+_SHELL_BUILTINS: frozenset[str] = frozenset({
+    ".", ":", "[", "[[", "alias", "bg", "break", "builtin", "cd", "command", "continue",
+    "declare", "dirs", "echo", "eval", "exec", "exit", "export", "false", "fg", "getopts",
+    "hash", "jobs", "kill", "let", "local", "mapfile", "popd", "printf", "pushd", "pwd",
+    "read", "readarray", "readonly", "return", "set", "shift", "shopt", "source", "test",
+    "trap", "true", "type", "typeset", "ulimit", "umask", "unalias", "unset", "wait",
+})
+
+
+def shell_commands(root: Node) -> list[str]:
+    """The programs a shell script runs, in order of first use."""
+    commands: dict[str, None] = {}
+    stack: list[Node] = [root]
+    while stack:
+        node: Node = stack.pop()
+        if node.type == "command":
+            name: Node | None = node.child_by_field_name("name")
+            if name is not None and not name.text.startswith(b"$"):
+                commands.setdefault(shell_word(name))
+        stack.extend(reversed(node.children))
+    return list(commands)
+
+
+def _bash_command_name(node: Node) -> str | None:
+    name: Node | None = node.child_by_field_name("name")
+    return shell_word(name) if name is not None else None
+
+
+def _bash_sourced_name(node: Node) -> str | None:
+    """The path of ``source lib.sh`` or ``. "$DIR/lib.sh"``; other commands are not entities."""
+    if _bash_command_name(node) not in _BASH_SOURCING:
+        return None
+    arguments: list[Node] = node.children_by_field_name("argument")
+    return shell_path(shell_word(arguments[0])) if arguments else None
+
+
+def _php_use_name(node: Node) -> Node | None:
+    """The first name of ``use A\\B;``, ``use function A\\f;``, or ``use A\\{B, C};``."""
+    for child in node.named_children:
+        if child.type == "namespace_name":  # the prefix of a group use
+            return child
+        if child.type == "namespace_use_clause":
+            return next(
+                (c for c in child.named_children if c.type in ("name", "qualified_name")), None,
+            )
+    return None
+
+
+def _scala_import_name(node: Node) -> Node | str | None:
+    """The path of ``import a.b.{C, D}``, ``a.b``.
+
+    Older grammars wrap it in a ``stable_identifier``; newer ones leave its
+    identifiers as children of the import.
+    """
+    path: list[str] = []
+    for child in node.children:
+        if child.type == "stable_identifier":
+            return child
+        if child.type == "identifier":
+            path.append(_node_text(child))
+        elif child.type not in ("import", "."):
+            break  # selectors, a wildcard, or the next import after ","
+    return ".".join(path) or None
+
+
+# Name lookups that are not a single field of the entity node.
+_NAME_GETTERS: dict[tuple[str, str], Callable[[Node], Node | str | None]] = {
+    ("bash", "command"): _bash_sourced_name,
+    ("c_sharp", "event_field_declaration"): _csharp_variable_name,
+    ("c_sharp", "field_declaration"): _csharp_variable_name,
+    ("c_sharp", "using_directive"): _csharp_using_name,
+    **{
+        ("kotlin", node_type): _kotlin_name
+        for node_type in LANGUAGE_ENTITY_TYPES["kotlin"]
+    },
+    ("java", "constant_declaration"): _java_field_name,
+    ("java", "field_declaration"): _java_field_name,
+    ("java", "import_declaration"): _java_qualified_name,
+    ("java", "package_declaration"): _java_qualified_name,
+    ("php", "namespace_use_declaration"): _php_use_name,
+    ("python", "import_statement"): _python_imported_module,
+    ("ruby", "call"): _ruby_required_name,
+    ("scala", "import_declaration"): _scala_import_name,
+    **{
+        (lang, node_type): getter
+        for lang in ("c", "cpp")
+        for node_type, getter in (
+            ("class_specifier", _c_defined_name),
+            ("declaration", _c_function_name),
+            ("enum_specifier", _c_defined_name),
+            ("field_declaration", _c_function_name),
+            ("function_definition", _c_function_name),
+            ("struct_specifier", _c_defined_name),
+            ("type_definition", _c_typedef_name),
+            ("union_specifier", _c_defined_name),
+        )
+    },
+}
+
+# Names of declarations that may leave theirs out.
+_DEFAULT_NAMES: dict[tuple[str, str], str] = {
+    ("kotlin", "companion_object"): "Companion",
+}
+
+# Literal node types whose surrounding quotes are dropped from names.
+_STRING_NAME_TYPES: frozenset[str] = frozenset(
+    {"interpreted_string_literal", "raw_string_literal", "string", "string_literal"},
+)
+
+# Functions declared directly inside one of these become methods.
+_MEMBER_CONTAINERS: frozenset[str] = frozenset(
+    {"class", "enum", "impl", "interface", "object", "struct", "trait"},
+)
+
+
+def _go_type_kind(node: Node) -> str:
+    """Refine a Go ``type_spec`` into struct / interface / type."""
+    type_node: Node | None = node.child_by_field_name("type")
+    if type_node is not None and type_node.type == "struct_type":
+        return "struct"
+    if type_node is not None and type_node.type == "interface_type":
+        return "interface"
+    return "type"
+
+
+# Values that make ``const name = ...`` a function declaration.
+_JS_FUNCTION_VALUES: frozenset[str] = frozenset(
+    {"arrow_function", "function", "function_expression", "generator_function"},
+)
+
+_JSX_NODE_TYPES: frozenset[str] = frozenset(
+    {"jsx_element", "jsx_fragment", "jsx_self_closing_element"},
+)
+
+_REACT_CLASS_RE: re.Pattern[str] = re.compile(r"\bextends\s+(?:[\w$]+\.)?(?:Pure)?Component\b")
+
+
+def _renders_jsx(node: Node) -> bool:
+    return any(n.type in _JSX_NODE_TYPES for n, _depth in _walk(node))
+
+
+def _jsx_function_kind(node: Node) -> str:
+    """A capitalized function that renders JSX is a component."""
+    name: Node | None = node.child_by_field_name("name")
+    if name is not None and _node_text(name)[:1].isupper() and _renders_jsx(node):
+        return "component"
+    return "function"
+
+
+def _kotlin_modifiers(node: Node) -> list[str]:
+    """Keyword modifiers (``data``, ``suspend``, ``enum``), without annotations."""
+    return [
+        _node_text(modifier)
+        for child in node.children
+        if child.type == "modifiers"
+        for modifier in child.named_children
+        if modifier.type.endswith("_modifier")
+    ]
+
+
+def _kotlin_class_kind(node: Node) -> str:
+    """``interface`` and ``enum class`` share the class declaration node."""
+    if any(child.type == "interface" for child in node.children):
+        return "interface"
+    if "enum" in _kotlin_modifiers(node):
+        return "enum"
+    return "class"
+
+
+def _scala_member_kind(node: Node) -> str | None:
+    """``val`` and ``var`` are properties of a template or file, not locals."""
+    if node.parent is None or node.parent.type not in ("compilation_unit", "template_body"):
+        return None
+    return "property"
+
+
+def _ruby_method_kind(node: Node) -> str:
+    """A ``def`` anywhere inside a class or module body defines a method."""
+    parent: Node | None = node.parent
+    while parent is not None:
+        if parent.type in ("class", "module", "singleton_class"):
+            return "method"
+        parent = parent.parent
+    return "function"
+
+
+def _jsx_class_kind(node: Node) -> str:
+    """``class Foo extends React.Component`` is a component."""
+    for child in node.children:
+        if child.type == "class_heritage" and _REACT_CLASS_RE.search(_node_text(child)):
+            return "component"
+    return "class"
+
+
+def _js_declarator_kind(node: Node) -> str | None:
+    """Module-level ``const f = () => ...`` is a function; other bindings are skipped."""
+    value: Node | None = node.child_by_field_name("value")
+    if value is None or value.type not in _JS_FUNCTION_VALUES:
+        return None
+    declaration: Node | None = node.parent
+    if declaration is None or declaration.parent is None:
+        return None
+    if declaration.parent.type not in ("program", "export_statement"):
+        return None
+    return "function"
+
+
+def _jsx_declarator_kind(node: Node) -> str | None:
+    """Like _js_declarator_kind, but recognizes function components."""
+    if _js_declarator_kind(node) is None:
+        return None
+    return _jsx_function_kind(node)
+
+
+def _js_method_kind(node: Node) -> str | None:
+    """Only class members are methods; object-literal methods are skipped."""
+    if node.parent is None or node.parent.type != "class_body":
+        return None
+    return "method"
+
+
+_KIND_REFINERS: dict[tuple[str, str], Callable[[Node], str | None]] = {
+    ("go", "type_spec"): _go_type_kind,
+    ("kotlin", "class_declaration"): _kotlin_class_kind,
+    ("ruby", "method"): _ruby_method_kind,
+    **{
+        ("scala", node_type): _scala_member_kind
+        for node_type in ("val_declaration", "val_definition", "var_declaration", "var_definition")
+    },
+    ("javascript", "class_declaration"): _jsx_class_kind,
+    ("javascript", "function_declaration"): _jsx_function_kind,
+    ("javascript", "method_definition"): _js_method_kind,
+    ("javascript", "variable_declarator"): _jsx_declarator_kind,
+    ("tsx", "class_declaration"): _jsx_class_kind,
+    ("tsx", "function_declaration"): _jsx_function_kind,
+    ("tsx", "method_definition"): _js_method_kind,
+    ("tsx", "variable_declarator"): _jsx_declarator_kind,
+    ("typescript", "method_definition"): _js_method_kind,
+    ("typescript", "variable_declarator"): _js_declarator_kind,
+}
+
+
+def _rust_impl_attrs(node: Node) -> dict[str, Any]:
+    """Record the implemented trait of ``impl Trait for Type`` blocks."""
+    trait: Node | None = node.child_by_field_name("trait")
+    if trait is None:
+        return {}
+    return {"trait": _node_text(trait)}
+
+
+def _go_import_attrs(node: Node) -> dict[str, Any]:
+    """Record explicit package aliases (``import f "fmt"``)."""
+    alias: Node | None = node.child_by_field_name("name")
+    if alias is None:
+        return {}
+    return {"alias": _node_text(alias)}
+
+
+def _go_type_name(node: Node) -> str:
+    """``Server`` for ``Server``, ``*Server``, ``Box[T]``, or ``pkg.Server``."""
+    while node.type in ("generic_type", "pointer_type", "parenthesized_type"):
+        inner: Node | None = node.child_by_field_name("type") or (
+            node.named_children[0] if node.named_children else None
+        )
+        if inner is None:
+            break
+        node = inner
+    return _node_text(node)
+
+
+def _go_parameter_types(node: Node | None) -> list[str]:
+    """One type per parameter of a ``parameter_list``: ``a, b int`` gives two."""
+    types: list[str] = []
+    for param in node.named_children if node is not None else []:
+        type_node: Node | None = param.child_by_field_name("type")
+        if type_node is None:
+            continue
+        text: str = " ".join(_node_text(type_node).split())
+        if param.type == "variadic_parameter_declaration":
+            text = "..." + text
+        types.extend([text] * max(1, len(param.children_by_field_name("name"))))
+    return types
+
+
+def _go_signature(node: Node) -> str:
+    """Parameter and result types of a method, names dropped: ``(string, int) error``."""
+    signature: str = f"({', '.join(_go_parameter_types(node.child_by_field_name('parameters')))})"
+    result: Node | None = node.child_by_field_name("result")
+    if result is not None and result.type == "parameter_list":
+        results: list[str] = _go_parameter_types(result)
+        if len(results) == 1:
+            signature += f" {results[0]}"
+        elif results:
+            signature += f" ({', '.join(results)})"
+    elif result is not None:
+        signature += " " + " ".join(_node_text(result).split())
+    return signature
+
+
+def _go_function_attrs(node: Node) -> dict[str, Any]:
+    return {**_go_body_attrs(node), **_type_parameter_attrs(node)}
+
+
+def _go_method_attrs(node: Node) -> dict[str, Any]:
+    """Record the receiver type, the signature used to match interfaces, and responses."""
+    attrs: dict[str, Any] = {"signature": _go_signature(node), **_go_body_attrs(node)}
+    receiver: Node | None = node.child_by_field_name("receiver")
+    param: Node | None = (
+        next((c for c in receiver.named_children if c.type == "parameter_declaration"), None)
+        if receiver is not None else None
+    )
+    type_node: Node | None = param.child_by_field_name("type") if param is not None else None
+    if type_node is not None:
+        attrs["receiver"] = _go_type_name(type_node)
+        if type_node.type == "pointer_type":
+            attrs["pointer_receiver"] = True
+    return attrs
+
+
+def _go_type_attrs(node: Node) -> dict[str, Any]:
+    """Record interface method sets, struct fields, embedded types, and type parameters."""
+    type_node: Node | None = node.child_by_field_name("type")
+    attrs: dict[str, Any] = {}
+    embeds: list[str] = []
+    if type_node is not None and type_node.type == "interface_type":
+        methods: dict[str, str] = {}
+        for child in type_node.named_children:
+            if child.type in ("method_elem", "method_spec"):
+                name: Node | None = child.child_by_field_name("name")
+                if name is not None:
+                    methods[_node_text(name)] = _go_signature(child)
+            elif child.type in ("type_elem", "constraint_elem", "interface_type_name"):
+                # A single type embeds an interface; unions and ~T make a constraint.
+                types: list[Node] = child.named_children or [child]
+                if len(types) == 1 and types[0].type in (
+                    "interface_type_name", "qualified_type", "type_identifier",
+                ):
+                    embeds.append(_node_text(types[0]))
+                else:
+                    attrs["constraint"] = True
+            elif child.type in ("qualified_type", "type_identifier"):
+                embeds.append(_node_text(child))
+        attrs["methods"] = methods
+    elif type_node is not None and type_node.type == "struct_type":
+        field_list: Node | None = next(
+            (c for c in type_node.named_children if c.type == "field_declaration_list"), None,
+        )
+        fields: list[dict[str, Any]] = []
+        for field_node in field_list.named_children if field_list is not None else []:
+            field_type: Node | None = field_node.child_by_field_name("type")
+            if field_node.type != "field_declaration" or field_type is None:
+                continue
+            names: list[Node] = field_node.children_by_field_name("name")
+            if not names:
+                embeds.append(_go_type_name(field_type))
+                continue
+            tag: Node | None = field_node.child_by_field_name("tag")
+            tags: dict[str, str] = _go_struct_tags(_string_value(tag) or "") if tag else {}
+            for field_name in names:
+                fields.append({
+                    "name": _node_text(field_name),
+                    "type": " ".join(_node_text(field_type).split()),
+                    **({"tags": tags} if tags else {}),
+                })
+        attrs["fields"] = fields
+    if embeds:
+        attrs["embeds"] = embeds
+    attrs.update(_type_parameter_attrs(node))
+    return attrs
+
+
+_GO_TAG_RE: re.Pattern[str] = re.compile(r'(\w+):"((?:[^"\\]|\\.)*)"')
+
+
+def _go_struct_tags(text: str) -> dict[str, str]:
+    """``json:"status,omitempty" db:"status"`` as a dict, per reflect.StructTag."""
+    return {key: value for key, value in _GO_TAG_RE.findall(text)}
+
+
+# Calls whose arguments are serialized as a response body: encoding/json,
+# gin and echo (c.JSON(http.StatusOK, resp)), and chi's render.JSON.
+_GO_ENCODERS: frozenset[str] = frozenset({
+    "Encode", "IndentedJSON", "JSON", "JSONP", "JSONPretty", "Marshal", "MarshalIndent",
+    "PureJSON", "SecureJSON",
+})
+
+# Query parameter accessors: r.URL.Query().Get("q"), c.Query("q"), c.QueryParam("q").
+_GO_QUERY_GETTERS: frozenset[str] = frozenset({"DefaultQuery", "Query", "QueryParam"})
+
+
+def _go_literal_type(node: Node) -> str | None:
+    """``T`` for ``T{...}`` and ``&T{...}``."""
+    if node.type == "unary_expression" and node.named_children:
+        node = node.named_children[0]
+    if node.type != "composite_literal":
+        return None
+    type_node: Node | None = node.child_by_field_name("type")
+    return " ".join(_node_text(type_node).split()) if type_node is not None else None
+
+
+def _go_body_attrs(node: Node) -> dict[str, Any]:
+    """Record what a handler body encodes as JSON and which query parameters it reads."""
+    body: Node | None = node.child_by_field_name("body")
+    if body is None:
+        return {}
+    local_types: dict[str, str] = {}  # resp := HealthResponse{...}
+    responses: list[str] = []
+    query: list[str] = []
+    for current, _depth in _walk(body):
+        if current.type == "short_var_declaration":
+            left: Node | None = current.child_by_field_name("left")
+            right: Node | None = current.child_by_field_name("right")
+            if left is not None and right is not None:
+                for name, value in zip(left.named_children, right.named_children):
+                    literal: str | None = _go_literal_type(value)
+                    if name.type == "identifier" and literal is not None:
+                        local_types[_node_text(name)] = literal
+        elif current.type == "var_spec":
+            var_type: Node | None = current.child_by_field_name("type")
+            if var_type is not None:
+                for name in current.children_by_field_name("name"):
+                    local_types[_node_text(name)] = " ".join(_node_text(var_type).split())
+        if current.type != "call_expression":
+            continue
+        func: Node | None = current.child_by_field_name("function")
+        arguments: Node | None = current.child_by_field_name("arguments")
+        member: Node | None = func.child_by_field_name("field") if func is not None else None
+        if member is None or arguments is None:
+            continue
+        method: str = _node_text(member)
+        args: list[Node] = arguments.named_children
+        if method in _GO_ENCODERS:
+            for arg in args:
+                found: str | None = _go_literal_type(arg)
+                if found is None and arg.type == "identifier":
+                    found = local_types.get(_node_text(arg))
+                if found is not None and found not in responses:
+                    responses.append(found)
+        elif method in _GO_QUERY_GETTERS or (
+            method == "Get" and _node_text(current).split("(")[0].endswith(".Query")
+        ):
+            param: str | None = _string_value(args[0]) if args else None
+            if param and param not in query:
+                query.append(param)
+    attrs: dict[str, Any] = {}
+    if responses:
+        attrs["responses"] = responses
+    if query:
+        attrs["query_params"] = query
+    return attrs
+
+
+def _compact_text(node: Node | None) -> str:
+    """Source text with runs of whitespace collapsed, e.g. for type expressions."""
+    return " ".join(_node_text(node).split()) if node is not None else ""
+
+
+_RUST_ATTRIBUTE_SKIP: tuple[str, ...] = ("attribute_item", "block_comment", "line_comment")
+
+
+def _rust_attributes(node: Node) -> list[str]:
+    """The ``#[...]`` attributes directly above *node*, as written inside the brackets."""
+    attributes: list[str] = []
+    sibling: Node | None = node.prev_named_sibling
+    while sibling is not None and sibling.type in _RUST_ATTRIBUTE_SKIP:
+        if sibling.type == "attribute_item":
+            attributes.append(_node_text(sibling).removeprefix("#").strip("[] "))
+        sibling = sibling.prev_named_sibling
+    return attributes[::-1]
+
+
+def _rust_struct_attrs(node: Node) -> dict[str, Any]:
+    """Record attributes (``derive(Serialize)``) and named fields with theirs."""
+    attrs: dict[str, Any] = {}
+    attributes: list[str] = _rust_attributes(node)
+    if attributes:
+        attrs["attributes"] = attributes
+    body: Node | None = node.child_by_field_name("body")
+    if body is not None and body.type == "field_declaration_list":
+        fields: list[dict[str, Any]] = []
+        for field_node in body.named_children:
+            name: Node | None = field_node.child_by_field_name("name")
+            if field_node.type != "field_declaration" or name is None:
+                continue
+            field: dict[str, Any] = {
+                "name": _node_text(name),
+                "type": _compact_text(field_node.child_by_field_name("type")),
+            }
+            field_attributes: list[str] = _rust_attributes(field_node)
+            if field_attributes:
+                field["attributes"] = field_attributes
+            fields.append(field)
+        attrs["fields"] = fields
+    return attrs
+
+
+def _python_class_attrs(node: Node) -> dict[str, Any]:
+    """Record decorators, base classes, and annotated class attributes as fields."""
+    attrs: dict[str, Any] = _python_def_attrs(node)
+    superclasses: Node | None = node.child_by_field_name("superclasses")
+    if superclasses is not None and superclasses.named_children:
+        attrs["bases"] = [
+            _node_text(base) for base in superclasses.named_children
+            if base.type != "keyword_argument"  # metaclass=...
+        ]
+    body: Node | None = node.child_by_field_name("body")
+    fields: list[dict[str, Any]] = []
+    for statement in body.named_children if body is not None else []:
+        assignment: Node | None = statement.named_children[0] if (
+            statement.type == "expression_statement" and statement.named_children
+        ) else None
+        if assignment is None or assignment.type != "assignment":
+            continue
+        left: Node | None = assignment.child_by_field_name("left")
+        annotation: Node | None = assignment.child_by_field_name("type")
+        if left is None or left.type != "identifier" or annotation is None:
+            continue  # only annotated names declare fields
+        field: dict[str, Any] = {"name": _node_text(left), "type": _compact_text(annotation)}
+        default: Node | None = assignment.child_by_field_name("right")
+        if default is not None:
+            field["default"] = _compact_text(default)
+        fields.append(field)
+    if fields:
+        attrs["fields"] = fields
+    return attrs
+
+
+def _js_export_attrs(node: Node) -> dict[str, Any]:
+    """Mark declarations made inside ``export ...`` / ``export default ...``."""
+    statement: Node | None = node.parent
+    if node.type == "variable_declarator" and statement is not None:
+        statement = statement.parent  # export_statement > lexical_declaration > declarator
+    if statement is None or statement.type != "export_statement":
+        return {}
+    if any(child.type == "default" for child in statement.children):
+        return {"exported": True, "default": True}
+    return {"exported": True}
+
+
+def _ts_attrs(node: Node) -> dict[str, Any]:
+    return {**_js_export_attrs(node), **_type_parameter_attrs(node)}
+
+
+def _python_def_attrs(node: Node) -> dict[str, Any]:
+    """Record decorators (``@app.route("/")``) and ``async def``."""
+    attrs: dict[str, Any] = {}
+    if node.parent is not None and node.parent.type == "decorated_definition":
+        attrs["decorators"] = [
+            _node_text(child).removeprefix("@").strip()
+            for child in node.parent.children
+            if child.type == "decorator"
+        ]
+    if any(child.type == "async" for child in node.children):
+        attrs["async"] = True
+    return attrs
+
+
+def _java_annotations(node: Node) -> list[str]:
+    return [
+        _node_text(annotation).removeprefix("@").strip()
+        for child in node.children
+        if child.type == "modifiers"
+        for annotation in child.children
+        if annotation.type in ("annotation", "marker_annotation")
+    ]
+
+
+# Java field modifiers recorded as boolean attrs; serializers skip both.
+_JAVA_FLAG_MODIFIERS: frozenset[str] = frozenset({"static", "transient"})
+
+
+def _java_annotation_attrs(node: Node) -> dict[str, Any]:
+    """Record annotations (``@RestController``), constructor-ness, and field types.
+
+    A record's components are recorded as its ``fields``.
+    """
+    attrs: dict[str, Any] = {}
+    annotations: list[str] = _java_annotations(node)
+    if annotations:
+        attrs["annotations"] = annotations
+    if node.type == "constructor_declaration":
+        attrs["constructor"] = True
+    if node.type in ("constant_declaration", "field_declaration"):
+        attrs["type"] = _compact_text(node.child_by_field_name("type"))
+        for child in node.children:
+            if child.type == "modifiers":
+                for modifier in child.children:
+                    if modifier.type in _JAVA_FLAG_MODIFIERS:
+                        attrs[modifier.type] = True
+    if node.type == "record_declaration":
+        parameters: Node | None = node.child_by_field_name("parameters")
+        fields: list[dict[str, Any]] = []
+        for parameter in parameters.named_children if parameters is not None else []:
+            name: Node | None = parameter.child_by_field_name("name")
+            if parameter.type != "formal_parameter" or name is None:
+                continue
+            field: dict[str, Any] = {
+                "name": _node_text(name),
+                "type": _compact_text(parameter.child_by_field_name("type")),
+            }
+            parameter_annotations: list[str] = _java_annotations(parameter)
+            if parameter_annotations:
+                field["annotations"] = parameter_annotations
+            fields.append(field)
+        attrs["fields"] = fields
+    return attrs
+
+
+# C# modifiers recorded as boolean attrs.
+_CSHARP_FLAG_MODIFIERS: frozenset[str] = frozenset(
+    {"abstract", "async", "override", "partial", "static", "virtual"},
+)
+
+
+def _csharp_attrs(node: Node) -> dict[str, Any]:
+    """Record attributes (``[HttpGet("/health")]``), flag modifiers, and accessors."""
+    attrs: dict[str, Any] = {}
+    attributes: list[str] = [
+        _node_text(attribute)
+        for child in node.children
+        if child.type == "attribute_list"
+        for attribute in child.named_children
+        if attribute.type == "attribute"
+    ]
+    if attributes:
+        attrs["attributes"] = attributes
+    for child in node.children:
+        if child.type == "modifier" and child.text.decode() in _CSHARP_FLAG_MODIFIERS:
+            attrs[child.text.decode()] = True
+    if node.type == "constructor_declaration":
+        attrs["constructor"] = True
+    if node.type == "property_declaration":
+        attrs["type"] = _compact_text(node.child_by_field_name("type"))
+    elif node.type == "field_declaration":
+        declaration: Node | None = next(
+            (c for c in node.named_children if c.type == "variable_declaration"), None,
+        )
+        if declaration is not None:
+            attrs["type"] = _compact_text(declaration.child_by_field_name("type"))
+    accessors: Node | None = node.child_by_field_name("accessors") or next(
+        (c for c in node.children if c.type == "accessor_list"), None,
+    )
+    if accessors is not None:
+        attrs["accessors"] = [
+            keyword.type
+            for accessor in accessors.named_children
+            if accessor.type == "accessor_declaration"
+            for keyword in accessor.children
+            if keyword.type in ("add", "get", "init", "remove", "set")
+        ]
+    elif node.type == "property_declaration":
+        attrs["accessors"] = ["get"]  # int Count => items.Count;
+    return attrs
+
+
+def _csharp_using_attrs(node: Node) -> dict[str, Any]:
+    """Mark ``using static`` and record ``using Alias = X;`` aliases."""
+    attrs: dict[str, Any] = {}
+    if any(child.type == "static" for child in node.children):
+        attrs["static"] = True
+    alias: Node | None = next((c for c in node.named_children if c.type == "name_equals"), None)
+    if alias is not None and alias.named_children:
+        attrs["alias"] = _node_text(alias.named_children[0])
+    return attrs
+
+
+# Kotlin modifiers recorded as boolean attrs.
+_KOTLIN_FLAG_MODIFIERS: frozenset[str] = frozenset(
+    {"abstract", "data", "inline", "open", "override", "sealed", "suspend", "value"},
+)
+
+
+def _kotlin_annotations(node: Node) -> list[str]:
+    return [
+        _node_text(annotation).removeprefix("@").strip()
+        for child in node.children
+        if child.type == "modifiers"
+        for annotation in child.named_children
+        if annotation.type == "annotation"
+    ]
+
+
+def _kotlin_declared_type(node: Node) -> str | None:
+    """The type after ``name:`` in a variable declaration or class parameter."""
+    names: list[Node] = [c for c in node.named_children if c.type == "simple_identifier"]
+    sibling: Node | None = names[0].next_named_sibling if names else None
+    if sibling is not None and sibling.type.endswith("type"):
+        return _compact_text(sibling)
+    return None
+
+
+def _kotlin_constructor_fields(node: Node) -> list[dict[str, Any]]:
+    """The ``val``/``var`` parameters of a primary constructor, which are properties."""
+    constructor: Node | None = next(
+        (c for c in node.named_children if c.type == "primary_constructor"), None,
+    )
+    fields: list[dict[str, Any]] = []
+    parameters: list[Node] = []
+    for child in constructor.named_children if constructor is not None else []:
+        # tree-sitter-kotlin versions differ on a class_parameters wrapper.
+        parameters.extend(child.named_children if child.type == "class_parameters" else [child])
+    for parameter in parameters:
+        if parameter.type != "class_parameter":
+            continue
+        if not any(c.type in ("val", "var") for c in parameter.children):
+            continue  # a plain constructor argument
+        name: Node | None = next(
+            (c for c in parameter.named_children if c.type == "simple_identifier"), None,
+        )
+        if name is None:
+            continue
+        field: dict[str, Any] = {"name": _node_text(name)}
+        declared: str | None = _kotlin_declared_type(parameter)
+        if declared is not None:
+            field["type"] = declared
+        annotations: list[str] = _kotlin_annotations(parameter)
+        if annotations:
+            field["annotations"] = annotations
+        fields.append(field)
+    return fields
+
+
+def _kotlin_attrs(node: Node) -> dict[str, Any]:
+    """Record annotations, flag modifiers, extension receivers, and companions.
+
+    Properties get their declared ``type``; classes get the properties of
+    their primary constructor as ``fields``.
+    """
+    attrs: dict[str, Any] = {}
+    annotations: list[str] = _kotlin_annotations(node)
+    if annotations:
+        attrs["annotations"] = annotations
+    for modifier in _kotlin_modifiers(node):
+        if modifier in _KOTLIN_FLAG_MODIFIERS:
+            attrs[modifier] = True
+    if node.type in ("function_declaration", "property_declaration"):
+        # fun String.slug(): the receiver type comes before a "." child.
+        for child in node.children:
+            if child.type == "." and child.prev_named_sibling is not None:
+                attrs["receiver"] = _node_text(child.prev_named_sibling)
+                break
+    if node.type == "property_declaration":
+        declaration: Node | None = next(
+            (c for c in node.named_children if c.type == "variable_declaration"), None,
+        )
+        declared: str | None = _kotlin_declared_type(declaration) if declaration else None
+        if declared is not None:
+            attrs["type"] = declared
+    if node.type == "class_declaration":
+        fields: list[dict[str, Any]] = _kotlin_constructor_fields(node)
+        if fields:
+            attrs["fields"] = fields
+    if node.type == "companion_object":
+        attrs["companion"] = True
+    return attrs
+
+
+def _kotlin_import_attrs(node: Node) -> dict[str, Any]:
+    """Mark ``import a.b.*`` and record ``import a.B as C`` aliases."""
+    attrs: dict[str, Any] = {}
+    if any(child.type in ("*", "wildcard_import") for child in node.children):
+        attrs["wildcard"] = True
+    alias: Node | None = next((c for c in node.named_children if c.type == "import_alias"), None)
+    if alias is not None and alias.named_children:
+        attrs["alias"] = _node_text(alias.named_children[-1])
+    return attrs
+
+
+# Scala modifiers recorded as boolean attrs, with ``case`` (not a modifier
+# in the grammar) from ``case class`` and ``case object``.
+_SCALA_FLAG_MODIFIERS: frozenset[str] = frozenset(
+    {"abstract", "final", "implicit", "inline", "lazy", "override", "sealed"},
+)
+
+
+def _scala_implicits(node: Node) -> list[str]:
+    """Types of the ``(implicit ...)`` and ``(using ...)`` parameters of a definition."""
+    types: list[str] = []
+    for clause in node.named_children:
+        if clause.type not in ("class_parameters", "parameters"):
+            continue
+        if not any(c.type in ("implicit", "using") for c in clause.children):
+            continue
+        for parameter in clause.named_children:
+            declared: Node | None = parameter.child_by_field_name("type")
+            if declared is not None:
+                types.append(_compact_text(declared))
+    return types
+
+
+def _scala_class_fields(node: Node, case: bool) -> list[dict[str, Any]]:
+    """Constructor parameters that are fields: all of a case class's, else ``val``/``var`` ones."""
+    fields: list[dict[str, Any]] = []
+    for clause in node.named_children:
+        if clause.type != "class_parameters":
+            continue
+        if any(c.type in ("implicit", "using") for c in clause.children):
+            continue
+        for parameter in clause.named_children:
+            name: Node | None = parameter.child_by_field_name("name")
+            if parameter.type != "class_parameter" or name is None:
+                continue
+            if not case and not any(c.type in ("val", "var") for c in parameter.children):
+                continue  # a plain constructor argument
+            field: dict[str, Any] = {"name": _node_text(name)}
+            declared: Node | None = parameter.child_by_field_name("type")
+            if declared is not None:
+                field["type"] = _compact_text(declared)
+            fields.append(field)
+        if case:
+            break  # only the first parameter list of a case class is its fields
+    return fields
+
+
+def _scala_attrs(node: Node) -> dict[str, Any]:
+    """Record annotations, flag modifiers, bases, implicit parameters, and case classes.
+
+    Classes list their constructor ``fields``; vals and vars record their
+    declared ``type``.
+    """
+    attrs: dict[str, Any] = {}
+    annotations: list[str] = [
+        _node_text(c).removeprefix("@").strip() for c in node.named_children
+        if c.type == "annotation"
+    ]
+    if annotations:
+        attrs["annotations"] = annotations
+    for child in node.children:
+        if child.type == "case":
+            attrs["case"] = True
+        for modifier in child.children if child.type == "modifiers" else []:
+            if _node_text(modifier) in _SCALA_FLAG_MODIFIERS:
+                attrs[_node_text(modifier)] = True
+    extends: Node | None = node.child_by_field_name("extend")
+    if extends is not None:
+        bases: list[str] = []
+        for base in extends.named_children:
+            if base.type == "compound_type":  # older grammars: extends A with B
+                bases.extend(_compact_text(t) for t in base.named_children)
+            elif base.type != "arguments":
+                bases.append(_compact_text(base))
+        if bases:
+            attrs["bases"] = bases
+    implicits: list[str] = _scala_implicits(node)
+    if implicits:
+        attrs["implicits"] = implicits
+    if node.type == "class_definition":
+        fields: list[dict[str, Any]] = _scala_class_fields(node, bool(attrs.get("case")))
+        if fields:
+            attrs["fields"] = fields
+    if node.type in ("val_declaration", "val_definition", "var_declaration", "var_definition"):
+        declared: Node | None = node.child_by_field_name("type")
+        if declared is not None:
+            attrs["type"] = _compact_text(declared)
+    if node.type == "function_declaration":
+        attrs["declaration"] = True  # abstract: no body
+    return attrs
+
+
+def _scala_import_attrs(node: Node) -> dict[str, Any]:
+    """List the names brought in by ``import a.{B, C => D}``, and mark ``import a._``."""
+    attrs: dict[str, Any] = {}
+    for child in node.named_children:
+        if child.type in ("namespace_wildcard", "wildcard"):
+            attrs["wildcard"] = True
+        elif child.type in ("import_selectors", "namespace_selectors"):
+            attrs["names"] = [
+                _node_text(c) for c in child.named_children
+                if c.type in ("identifier", "arrow_renamed_identifier", "renamed_identifier")
+            ]
+    return attrs
+
+
+# Ruby calls that mix a module into the enclosing class or module.
+_RUBY_MIXINS: tuple[str, ...] = ("extend", "include", "prepend")
+
+
+def _ruby_body(node: Node) -> list[Node]:
+    """Statements of a class or module body, with or without a body_statement wrapper."""
+    body: Node | None = node.child_by_field_name("body")
+    if body is not None:
+        return body.named_children
+    statements: list[Node] = []
+    for child in node.named_children:
+        statements.extend(child.named_children if child.type == "body_statement" else [child])
+    return statements
+
+
+def _ruby_module_attrs(node: Node) -> dict[str, Any]:
+    """Record the superclass and mixins (``include Comparable``) under their keyword."""
+    attrs: dict[str, Any] = {}
+    superclass: Node | None = node.child_by_field_name("superclass")
+    if superclass is not None and superclass.named_children:
+        attrs["bases"] = [_node_text(superclass.named_children[0])]
+    for statement in _ruby_body(node):
+        if statement.type not in ("call", "method_call"):
+            continue
+        method: str | None = _ruby_call_method(statement)
+        arguments: Node | None = statement.child_by_field_name("arguments")
+        if method not in _RUBY_MIXINS or arguments is None:
+            continue
+        attrs.setdefault(method, []).extend(
+            _node_text(a) for a in arguments.named_children
+            if a.type in ("constant", "scope_resolution")
+        )
+    return attrs
+
+
+def _ruby_method_attrs(node: Node) -> dict[str, Any]:
+    """Mark class methods: ``def self.build`` and ``def`` inside ``class << self``."""
+    if node.type == "singleton_method":
+        return {"static": True}
+    parent: Node | None = node.parent
+    if parent is not None and parent.type == "body_statement":
+        parent = parent.parent
+    return {"static": True} if parent is not None and parent.type == "singleton_class" else {}
+
+
+def _ruby_require_attrs(node: Node) -> dict[str, Any]:
+    """Mark ``require_relative``, whose path is relative to the requiring file."""
+    method: str | None = _ruby_call_method(node)
+    return {"relative": True} if method is not None and _RUBY_REQUIRES.get(method) else {}
+
+
+# PHP modifiers recorded as boolean attrs.
+_PHP_FLAG_MODIFIERS: frozenset[str] = frozenset(
+    {"abstract_modifier", "final_modifier", "readonly_modifier", "static_modifier"},
+)
+
+
+def _php_names(node: Node | None) -> list[str]:
+    """The class names listed by an ``extends``, ``implements``, or trait ``use`` clause."""
+    if node is None:
+        return []
+    return [_node_text(c) for c in node.named_children if c.type in ("name", "qualified_name")]
+
+
+def _php_attrs(node: Node) -> dict[str, Any]:
+    """Record attributes (``#[Route("/health")]``), flag modifiers, and visibility.
+
+    Classes also record their ``bases``, ``implements``, and ``traits``.
+    """
+    attrs: dict[str, Any] = {}
+    attributes: list[str] = [
+        _node_text(attribute)
+        for child in node.children
+        if child.type == "attribute_list"
+        for group in child.named_children
+        for attribute in group.named_children
+        if attribute.type == "attribute"
+    ]
+    if attributes:
+        attrs["attributes"] = attributes
+    for child in node.children:
+        if child.type in _PHP_FLAG_MODIFIERS:
+            attrs[child.type.removesuffix("_modifier")] = True
+        elif child.type == "visibility_modifier":
+            attrs["visibility"] = _node_text(child)
+    bases: list[str] = _php_names(next((c for c in node.children if c.type == "base_clause"), None))
+    if bases:
+        attrs["bases"] = bases
+    implements: list[str] = _php_names(
+        next((c for c in node.children if c.type == "class_interface_clause"), None),
+    )
+    if implements:
+        attrs["implements"] = implements
+    body: Node | None = node.child_by_field_name("body")
+    traits: list[str] = [
+        name
+        for member in (body.named_children if body is not None else [])
+        if member.type == "use_declaration"
+        for name in _php_names(member)
+    ]
+    if traits:
+        attrs["traits"] = traits
+    return attrs
+
+
+def _php_use_attrs(node: Node) -> dict[str, Any]:
+    """Record ``use function``/``use const`` and ``use A\\B as C`` aliases."""
+    attrs: dict[str, Any] = {}
+    for child in node.children:
+        if child.type in ("function", "const"):
+            attrs["use"] = child.type
+        elif child.type == "namespace_use_clause" and "alias" not in attrs:
+            alias: Node | None = child.child_by_field_name("alias") or next(
+                (c for c in child.named_children if c.type == "namespace_aliasing_clause"), None,
+            )
+            if alias is not None:
+                attrs["alias"] = _node_text(alias).removeprefix("as").strip()
+    return attrs
+
+
+def _java_import_attrs(node: Node) -> dict[str, Any]:
+    """Mark ``import static`` and on-demand (``.*``) imports."""
+    attrs: dict[str, Any] = {}
+    if any(child.type == "static" for child in node.children):
+        attrs["static"] = True
+    if any(child.type == "asterisk" for child in node.children):
+        attrs["wildcard"] = True
+    return attrs
+
+
+def _python_import_names(node: Node) -> list[str]:
+    """Dotted names listed by an import, without their ``as`` aliases."""
+    names: list[str] = []
+    for child in node.children_by_field_name("name"):
+        if child.type == "aliased_import":
+            child = child.child_by_field_name("name") or child
+        names.append(_node_text(child))
+    return names
+
+
+def _python_import_attrs(node: Node) -> dict[str, Any]:
+    """Record what ``from x import a, b`` imports, or every module of ``import a, b``."""
+    names: list[str] = _python_import_names(node)
+    if node.type == "import_from_statement":
+        if any(child.type == "wildcard_import" for child in node.children):
+            return {"wildcard": True}
+        return {"names": names}
+    return {"modules": names} if len(names) > 1 else {}
+
+
+def _c_parameter_types(declarator: Node) -> list[str]:
+    """Parameter types of a function declarator, without parameter names.
+
+    ``(const char *name, int)`` gives ``["const char *", "int"]`` so a
+    prototype and its definition compare equal whatever they name things.
+    """
+    parameters: Node | None = declarator.child_by_field_name("parameters")
+    if parameters is None:
+        return []
+    types: list[str] = []
+    for param in parameters.named_children:
+        if param.type == "variadic_parameter" or param.text == b"...":
+            types.append("...")
+            continue
+        if not param.type.endswith("parameter_declaration"):
+            continue
+        inner: Node | None = param.child_by_field_name("declarator")
+        default: Node | None = param.child_by_field_name("default_value")
+        base: str = " ".join(
+            _node_text(c) for c in param.named_children if c != inner and c != default
+        )
+        suffix: str = ""
+        while inner is not None:
+            if inner.type == "pointer_declarator":
+                suffix += "*"
+            elif inner.type in ("reference_declarator", "abstract_reference_declarator"):
+                suffix += "&&" if inner.text.startswith(b"&&") else "&"
+            elif inner.type in ("array_declarator", "abstract_array_declarator"):
+                suffix += "[]"
+            elif inner.type == "abstract_pointer_declarator":
+                suffix += "*"
+            child: Node | None = inner.child_by_field_name("declarator")
+            if child is None and inner.type == "reference_declarator" and inner.named_children:
+                child = inner.named_children[-1]
+            inner = child
+        types.append(f"{base} {suffix}".strip())
+    if types == ["void"]:
+        return []  # f(void) takes nothing
+    return types
+
+
+def _c_function_attrs(node: Node) -> dict[str, Any]:
+    """Parameter types, prototype-ness, and template parameters."""
+    attrs: dict[str, Any] = {}
+    declarator: Node | None = _c_function_declarator(node)
+    if declarator is not None:
+        attrs["parameters"] = _c_parameter_types(declarator)
+    if node.type in ("declaration", "field_declaration"):
+        attrs["declaration"] = True
+    attrs.update(_cpp_template_attrs(node))
+    return attrs
+
+
+def _cpp_template_attrs(node: Node) -> dict[str, Any]:
+    """Record ``template <typename T>`` parameters of a templated declaration."""
+    parent: Node | None = node.parent
+    if parent is None or parent.type != "template_declaration":
+        return {}
+    parameters: Node | None = parent.child_by_field_name("parameters")
+    return {"template": _node_text(parameters)} if parameters is not None else {}
+
+
+def _type_parameter_attrs(node: Node) -> dict[str, Any]:
+    """Record the type parameters of a generic Go or TypeScript declaration.
+
+    Each has a ``name`` and, when declared, a ``constraint`` (``comparable``
+    in Go, ``extends keyof T`` without the ``extends`` in TypeScript) and a
+    TypeScript ``default``.
+    """
+    if node.type == "variable_declarator":  # const f = <T,>(x: T) => x
+        value: Node | None = node.child_by_field_name("value")
+        node = value if value is not None else node
+    parameters: Node | None = node.child_by_field_name("type_parameters")
+    found: list[dict[str, str]] = []
+    for param in parameters.named_children if parameters is not None else []:
+        if param.type == "type_parameter_declaration":  # Go: K comparable, V any
+            constraint: Node | None = param.child_by_field_name("type")
+            found.extend(
+                {"name": _node_text(name)}
+                | ({"constraint": " ".join(_node_text(constraint).split())} if constraint else {})
+                for name in param.children_by_field_name("name")
+            )
+        elif param.type == "type_parameter":
+            name: Node | None = param.child_by_field_name("name")
+            if name is None:
+                continue
+            entry: dict[str, str] = {"name": _node_text(name)}
+            for field_name, key in (("constraint", "constraint"), ("value", "default")):
+                clause: Node | None = param.child_by_field_name(field_name)
+                if clause is not None and clause.named_children:  # drop "extends" and "="
+                    entry[key] = " ".join(_node_text(clause.named_children[0]).split())
+            found.append(entry)
+    return {"type_parameters": found} if found else {}
+
+
+def _c_include_attrs(node: Node) -> dict[str, Any]:
+    """Mark ``#include <...>`` (searched on the system include path)."""
+    path: Node | None = node.child_by_field_name("path")
+    if path is not None and path.type == "system_lib_string":
+        return {"system": True}
+    return {}
+
+
+_ATTR_HOOKS: dict[tuple[str, str], Callable[[Node], dict[str, Any]]] = {
+    **{
+        ("c_sharp", node_type): _csharp_attrs
+        for node_type in (
+            "class_declaration",
+            "constructor_declaration",
+            "delegate_declaration",
+            "enum_declaration",
+            "event_declaration",
+            "event_field_declaration",
+            "field_declaration",
+            "interface_declaration",
+            "method_declaration",
+            "property_declaration",
+            "record_declaration",
+            "record_struct_declaration",
+            "struct_declaration",
+        )
+    },
+    ("c_sharp", "using_directive"): _csharp_using_attrs,
+    **{
+        (lang, node_type): hook
+        for lang in ("c", "cpp")
+        for node_type, hook in (
+            ("alias_declaration", _cpp_template_attrs),
+            ("class_specifier", _cpp_template_attrs),
+            ("declaration", _c_function_attrs),
+            ("field_declaration", _c_function_attrs),
+            ("function_definition", _c_function_attrs),
+            ("preproc_include", _c_include_attrs),
+            ("struct_specifier", _cpp_template_attrs),
+        )
+    },
+    ("go", "function_declaration"): _go_function_attrs,
+    ("go", "import_spec"): _go_import_attrs,
+    ("go", "method_declaration"): _go_method_attrs,
+    ("go", "type_spec"): _go_type_attrs,
+    ("java", "import_declaration"): _java_import_attrs,
+    **{
+        ("kotlin", node_type): _kotlin_attrs
+        for node_type in (
+            "class_declaration",
+            "companion_object",
+            "function_declaration",
+            "object_declaration",
+            "property_declaration",
+            "type_alias",
+        )
+    },
+    ("kotlin", "import_header"): _kotlin_import_attrs,
+    **{
+        ("java", node_type): _java_annotation_attrs
+        for node_type in (
+            "annotation_type_declaration",
+            "class_declaration",
+            "constant_declaration",
+            "constructor_declaration",
+            "enum_declaration",
+            "field_declaration",
+            "interface_declaration",
+            "method_declaration",
+            "record_declaration",
+        )
+    },
+    **{
+        ("php", node_type): _php_attrs
+        for node_type in (
+            "class_declaration",
+            "enum_declaration",
+            "function_definition",
+            "interface_declaration",
+            "method_declaration",
+            "trait_declaration",
+        )
+    },
+    ("php", "namespace_use_declaration"): _php_use_attrs,
+    ("python", "class_definition"): _python_class_attrs,
+    ("python", "function_definition"): _python_def_attrs,
+    ("python", "import_from_statement"): _python_import_attrs,
+    ("python", "import_statement"): _python_import_attrs,
+    ("ruby", "call"): _ruby_require_attrs,
+    ("ruby", "class"): _ruby_module_attrs,
+    ("ruby", "method"): _ruby_method_attrs,
+    ("ruby", "module"): _ruby_module_attrs,
+    ("ruby", "singleton_method"): _ruby_method_attrs,
+    ("rust", "impl_item"): _rust_impl_attrs,
+    ("rust", "struct_item"): _rust_struct_attrs,
+    **{
+        ("scala", node_type): _scala_attrs
+        for node_type in LANGUAGE_ENTITY_TYPES["scala"]
+        if node_type not in ("import_declaration", "package_clause")
+    },
+    ("scala", "import_declaration"): _scala_import_attrs,
+    **{
+        (lang, node_type): _js_export_attrs if lang == "javascript" else _ts_attrs
+        for lang in ("javascript", "tsx", "typescript")
+        for node_type in _JS_ENTITY_TYPES
+        if node_type != "import_statement"
+    },
+}
+
+
+def _python_module_attrs(path: str) -> dict[str, Any]:
+    """Dotted module name, following ``__init__.py`` files up the tree."""
+    file_path: PurePosixPath = PurePosixPath(path)
+    parts: list[str] = [] if file_path.stem == "__init__" else [file_path.stem]
+    directory: Path = Path(path).parent
+    while (directory / "__init__.py").is_file() and directory.name not in ("", ".", ".."):
+        parts.append(directory.name)
+        directory = directory.parent
+    if not parts:
+        return {}
+    return {"module": ".".join(reversed(parts))}
+
+
+# Languages whose declarations record their access modifiers as ``visibility``.
+_VISIBILITY_LANGUAGES: frozenset[str] = frozenset(
+    {"c_sharp", "java", "kotlin", "php", "rust", "scala", "tsx", "typescript"},
+)
+
+_VISIBILITY_KEYWORDS: frozenset[str] = frozenset({"internal", "private", "protected", "public"})
+
+
+def _declared_visibility(node: Node) -> str | None:
+    """The access modifiers written on a declaration: ``private``, ``pub(crate)``."""
+    found: list[str] = []
+    for child in node.children:
+        for modifier in child.children if child.type == "modifiers" else [child]:
+            if modifier.type in (
+                "access_modifier", "accessibility_modifier", "visibility_modifier",
+            ) or (
+                modifier.type in ("modifier", *_VISIBILITY_KEYWORDS)
+                and _node_text(modifier) in _VISIBILITY_KEYWORDS
+            ):
+                found.append(_node_text(modifier))
+    return " ".join(found) or None
+
+
+# Attributes of the file entity that depend on where the file lives rather
+# than on its content, so they are recomputed when a cached result is reused.
+_FILE_ATTR_HOOKS: dict[str, Callable[[str], dict[str, Any]]] = {
+    "python": _python_module_attrs,
+}
+
+
+def file_attrs(language: str, path: str) -> dict[str, Any]:
+    """Location-dependent attrs for the file entity of *path*."""
+    hook: Callable[[str], dict[str, Any]] | None = _FILE_ATTR_HOOKS.get(language)
+    return hook(path) if hook is not None else {}
+
+
+# ---------------------------------------------------------------------------
+# Doc comments
+# ---------------------------------------------------------------------------
+
+# Statements that wrap a declaration; a doc comment above the wrapper
+# belongs to its first declaration (``export const``, ``type ( ... )``).
+_DOC_WRAPPERS: frozenset[str] = frozenset({
+    "export_statement",
+    "lexical_declaration",
+    "template_declaration",
+    "type_declaration",
+    "variable_declaration",
+})
+
+_COMMENT_TYPES: frozenset[str] = frozenset(
+    {"block_comment", "comment", "line_comment", "multiline_comment"},
+)
+
+# Comment openers that mark documentation, per language.
+_DOC_PREFIXES: dict[str, tuple[str, ...]] = {
+    "c": ("//", "/*"),
+    "c_sharp": ("///",),
+    "cpp": ("//", "/*"),
+    "go": ("//", "/*"),
+    "java": ("/**",),
+    "javascript": ("/**",),
+    "kotlin": ("/**",),
+    "php": ("/**",),
+    "ruby": ("#",),
+    "rust": ("///", "/**"),
+    "scala": ("/**",),
+    "tsx": ("/**",),
+    "typescript": ("/**",),
+}
+
+
+def _clean_comment(text: str) -> str:
+    """Strip comment markers, keeping the text's own line structure."""
+    text = text.replace("\r\n", "\n")
+    if text.startswith("/*"):
+        body: str = text[2:].removesuffix("*/").lstrip("*")
+        lines: list[str] = [re.sub(r"^\s*\* ?", "", line) for line in body.split("\n")]
+        return "\n".join(lines).strip()
+    return re.sub(r"^(?://[/!]?|#) ?", "", text).rstrip()
+
+
+def _leading_doc(node: Node, prefixes: tuple[str, ...]) -> str | None:
+    """Contiguous doc comments directly above *node* (or its wrapper)."""
+    anchor: Node = node
+    while True:
+        comments: list[str] = []
+        below: Node = anchor
+        sibling: Node | None = anchor.prev_sibling
+        while sibling is not None:
+            if sibling.type == "attribute_item":  # Rust #[derive(...)] between doc and item
+                below, sibling = sibling, sibling.prev_sibling
+                continue
+            if sibling.type not in _COMMENT_TYPES:
+                break
+            if below.start_point[0] - sibling.end_point[0] > 1:
+                break  # separated by a blank line
+            before: Node | None = sibling.prev_sibling
+            if before is not None and before.end_point[0] == sibling.start_point[0]:
+                break  # trailing comment of the previous statement
+            text: str = sibling.text.decode(errors="replace")
+            if not text.startswith(prefixes) or text.startswith("/**/"):
+                break
+            comments.append(_clean_comment(text))
+            below, sibling = sibling, sibling.prev_sibling
+        if comments:
+            return "\n".join(reversed(comments)).strip() or None
+        parent: Node | None = anchor.parent
+        if parent is None or parent.type not in _DOC_WRAPPERS:
+            return None
+        # Only the wrapper's first declaration inherits comments above it.
+        first: Node = parent.named_children[0]
+        if (first.start_byte, first.end_byte) != (anchor.start_byte, anchor.end_byte):
+            return None
+        anchor = parent
+
+
+def _python_docstring(node: Node) -> str | None:
+    """The string literal opening a def or class body."""
+    body: Node | None = node.child_by_field_name("body")
+    if body is None or not body.named_children:
+        return None
+    first: Node = body.named_children[0]
+    if first.type != "expression_statement" or not first.named_children:
+        return None
+    literal: Node = first.named_children[0]
+    if literal.type != "string":
+        return None
+    text: str = literal.text.decode(errors="replace").replace("\r\n", "\n")
+    text = re.sub(r"^[rRuUbBfF]*", "", text)
+    for quote in ('"""', "'''", '"', "'"):
+        if text.startswith(quote) and text.endswith(quote) and len(text) >= 2 * len(quote):
+            text = text[len(quote) : -len(quote)]
+            break
+    return inspect.cleandoc(text) or None
+
+
+def _entity_doc(node: Node, language: str) -> str | None:
+    """Documentation attached to an entity node, without comment markers."""
+    if language == "python":
+        return _python_docstring(node)
+    prefixes: tuple[str, ...] | None = _DOC_PREFIXES.get(language)
+    if prefixes is None:
+        return None
+    return _leading_doc(node, prefixes)
+
+
+# ---------------------------------------------------------------------------
+# Comments
+# ---------------------------------------------------------------------------
+
+# Tech-debt markers, with an optional ticket or author in parentheses.
+_MARKER_RE: re.Pattern[str] = re.compile(r"\b(TODO|FIXME|HACK|XXX)\b(?:\(([^)]*)\))?:?\s*(.*)")
+_TICKET_RE: re.Pattern[str] = re.compile(r"\b[A-Z][A-Z0-9]+-\d+\b|#\d+\b")
+
+# Characters of a comment's first line kept as its entity name.
+_COMMENT_NAME_LENGTH: int = 80
+
+
+def _comment_category(
+    node: Node, language: str, lines: list[bytes], node_types: dict[str, str],
+) -> str:
+    """``inline`` after code, ``doc`` right above a declaration, or ``standalone``."""
+    row, byte_col = node.start_point
+    if row < len(lines) and lines[row][:byte_col].strip():
+        return "inline"
+    prefixes: tuple[str, ...] | None = _DOC_PREFIXES.get(language)
+    text: str = node.text.decode(errors="replace")
+    if prefixes is None or not text.startswith(prefixes) or text.startswith("/**/"):
+        return "standalone"
+    # The declaration may be below more comments, as _leading_doc reads them.
+    end: int = node.end_point[0]
+    below: Node | None = node.next_sibling
+    while below is not None and below.type in (*_COMMENT_TYPES, "attribute_item"):
+        if below.start_point[0] - end > 1:
+            return "standalone"
+        end, below = below.end_point[0], below.next_sibling
+    if below is None or below.start_point[0] - end > 1:
+        return "standalone"
+    documented: bool = below.type in node_types or below.type in _DOC_WRAPPERS
+    return "doc" if documented else "standalone"
+
+
+def _comment_attrs(text: str, category: str) -> dict[str, Any]:
+    """A comment's attrs: its text and category, and any marker with its ticket or author."""
+    attrs: dict[str, Any] = {"category": category, "text": text}
+    match: re.Match[str] | None = _MARKER_RE.search(text)
+    if match is None:
+        return attrs
+    attrs["marker"] = match.group(1)
+    between: str = (match.group(2) or "").strip()
+    if between and _TICKET_RE.fullmatch(between):
+        attrs["ticket"] = between
+    else:
+        if between:
+            attrs["author"] = between
+        ticket: re.Match[str] | None = _TICKET_RE.search(match.group(3))
+        if ticket is not None:
+            attrs["ticket"] = ticket.group(0)
+    return attrs
+
+
+# ---------------------------------------------------------------------------
+# Per-language references
+# ---------------------------------------------------------------------------
+
+# A reference found in a function body: (edge kind, attrs, node to locate it).
+_Reference = tuple[str, dict[str, Any], Node]
+
+# References are only collected inside entities of these kinds, and
+# instantiations also inside the types whose fields and bases name them.
+_CALLER_KINDS: frozenset[str] = frozenset({"function", "method"})
+_INSTANTIATING_KINDS: frozenset[str] = _CALLER_KINDS | {
+    "class", "interface", "struct", "type",
+}
+# Languages whose files run code from the top, so the file itself calls too.
+_SCRIPT_LANGUAGES: frozenset[str] = frozenset({"bash"})
+
+# Declarations that scope the rest of their parent when they have no body
+# of their own: C# and PHP ``namespace Foo;`` enclose every declaration after it.
+_SCOPES_TO_END: frozenset[tuple[str, str]] = frozenset({
+    ("c_sharp", "file_scoped_namespace_declaration"),
+    ("php", "namespace_definition"),
+})
+
+# Entities that get size and complexity metrics (see measuring.py).
+_MEASURED_KINDS: frozenset[str] = frozenset({"component", "function", "method"})
+# Kinds the imports feature covers.
+_IMPORT_KINDS: frozenset[str] = frozenset({"import", "use"})
+
+# String literals searched for embedded SQL (see sqltext).
+_SQL_STRING_TYPES: frozenset[str] = _STRING_NAME_TYPES | {"template_string"}
+
+
+def _type_arguments(node: Node) -> dict[str, Any]:
+    """``{"type_arguments": [...]}`` for the ``type_arguments`` of *node*, as written."""
+    arguments: Node | None = node.child_by_field_name("type_arguments") or next(
+        (c for c in node.named_children if c.type == "type_arguments"), None,
+    )
+    if arguments is None:
+        return {}
+    return {"type_arguments": [" ".join(_node_text(a).split()) for a in arguments.named_children]}
+
+
+def _go_references(node: Node) -> Iterator[_Reference]:
+    """Call sites, function values passed as arguments, and generic instantiations."""
+    if node.type == "call_expression":
+        func: Node | None = node.child_by_field_name("function")
+        if func is None:
+            return
+        instantiated: dict[str, Any] = _type_arguments(node)  # Map[int, string](xs)
+        if func.type == "identifier":
+            yield "calls", {"name": _node_text(func)}, func
+            if instantiated:
+                yield "instantiates", {"name": _node_text(func), **instantiated}, func
+        elif func.type == "selector_expression":
+            operand: Node | None = func.child_by_field_name("operand")
+            member: Node | None = func.child_by_field_name("field")
+            if operand is not None and operand.type == "identifier" and member is not None:
+                target: dict[str, Any] = {
+                    "name": _node_text(member), "qualifier": _node_text(operand),
+                }
+                yield "calls", target, member
+                if instantiated:
+                    yield "instantiates", {**target, **instantiated}, member
+    elif node.type == "generic_type":  # Box[int]{}, var s Set[string]
+        type_node: Node | None = node.child_by_field_name("type")
+        arguments: dict[str, Any] = _type_arguments(node)
+        if type_node is not None and type_node.type == "type_identifier":
+            yield "instantiates", {"name": _node_text(type_node), **arguments}, type_node
+        elif type_node is not None and type_node.type == "qualified_type":
+            package: Node | None = type_node.child_by_field_name("package")
+            name: Node | None = type_node.child_by_field_name("name")
+            if package is not None and name is not None:
+                yield "instantiates", {
+                    "name": _node_text(name), "qualifier": _node_text(package), **arguments,
+                }, name
+    elif node.type == "argument_list":
+        # e.g. http.HandleFunc("/health", healthHandler)
+        for arg in node.named_children:
+            if arg.type == "identifier":
+                yield "calls", {"name": _node_text(arg), "indirect": True}, arg
+
+
+def _ts_references(node: Node) -> Iterator[_Reference]:
+    """Generic instantiations: ``new Box<number>()``, ``parse<User>(s)``, ``Map<K, V>``."""
+    target: Node | None = None
+    if node.type == "call_expression":
+        target = node.child_by_field_name("function")
+    elif node.type == "new_expression":
+        target = node.child_by_field_name("constructor")
+    elif node.type == "generic_type":
+        target = node.child_by_field_name("name")
+    arguments: dict[str, Any] = _type_arguments(node)
+    if target is not None and arguments and target.type in ("identifier", "type_identifier"):
+        yield "instantiates", {"name": _node_text(target), **arguments}, target
+
+
+# Programs that run the script named by their first operand.
+_SCRIPT_INTERPRETERS: frozenset[str] = frozenset({
+    "ash", "bash", "dash", "ksh", "node", "perl", "php", "python", "python3", "ruby", "sh",
+    "zsh",
+})
+# Interpreter options after which the operand is code or a module, not a script.
+_INLINE_OPTIONS: frozenset[str] = frozenset({"-c", "-e", "-m"})
+# Programs that run the command after them, and may take options or settings first.
+_COMMAND_WRAPPERS: frozenset[str] = frozenset({
+    "builtin", "command", "env", "exec", "nice", "nohup", "sudo", "time", "xargs",
+})
+
+
+def _bash_references(node: Node) -> Iterator[_Reference]:
+    """Commands run: calls by name, and ``runs`` of the scripts and programs named by path."""
+    if node.type != "command":
+        return
+    name: Node | None = node.child_by_field_name("name")
+    if name is None or shell_word(name) in _BASH_SOURCING:
+        return  # an import
+    words: list[Node] = [name, *node.children_by_field_name("argument")]
+    while words and shell_word(words[0]) in _COMMAND_WRAPPERS:
+        words = words[1:]
+        while words and (shell_word(words[0]).startswith("-") or "=" in shell_word(words[0])):
+            words = words[1:]  # nohup -- cmd, env FOO=1 cmd
+    if not words:
+        return
+    program: str = shell_word(words[0])
+    if program in _SCRIPT_INTERPRETERS:
+        for word in words[1:]:
+            operand: str = shell_word(word)
+            if operand in _INLINE_OPTIONS:
+                return
+            if not operand.startswith("-"):
+                yield "runs", {"name": shell_path(operand), "interpreter": program}, word
+                return
+    elif "/" in program:
+        yield "runs", {"name": shell_path(program)}, words[0]
+    elif "$" not in program and "`" not in program:
+        yield "calls", {"name": program}, words[0]
+
+
+_REFERENCE_COLLECTORS: dict[str, Callable[[Node], Iterator[_Reference]]] = {
+    "bash": _bash_references,
+    "go": _go_references,
+    "tsx": _ts_references,
+    "typescript": _ts_references,
+}
+
+# Identifiers that only name members or packages, which ``references`` leave
+# to calls and imports: a declaration cannot be found by their name alone.
+_MEMBER_IDENTIFIER_TYPES: frozenset[str] = frozenset({
+    "field_identifier", "namespace_identifier", "package_identifier", "property_identifier",
+})
+
+# Identifiers recorded as ``references`` uses, by language.
+_USE_TYPES: dict[str, frozenset[str]] = {
+    language: types - _MEMBER_IDENTIFIER_TYPES
+    for language, types in LANGUAGE_IDENTIFIER_TYPES.items()
+}
+
+# Fields holding the member in ``obj.name``.
+_MEMBER_FIELDS: tuple[str, ...] = ("attribute", "field", "property")
+
+
+def _is_field(parent: Node, name: str, node: Node) -> bool:
+    child: Node | None = parent.child_by_field_name(name)
+    return child is not None and (child.start_byte, child.end_byte) == (
+        node.start_byte, node.end_byte,
+    )
+
+
+def _is_use(node: Node, node_types: dict[str, str]) -> bool:
+    """Whether identifier *node* uses a name, rather than declaring one or naming a member."""
+    parent: Node | None = node.parent
+    if parent is None:
+        return True
+    if any(_is_field(parent, name, node) for name in _MEMBER_FIELDS):
+        return False
+    if _is_field(parent, "name", node):
+        # A declaration's own name, or a method called on an object (Java).
+        return parent.type not in node_types and parent.child_by_field_name("object") is None
+    return True
+
+
+# ---------------------------------------------------------------------------
+# Web routes
+# ---------------------------------------------------------------------------
+
+# A route registration: (HTTP method, path, handler reference attrs or None).
+# The handler is None when it is written inline (a closure or lambda).
+_Endpoint = tuple[str, str, dict[str, Any] | None]
+
+# Router methods named after the HTTP method: gin and echo (GET), chi (Get),
+# Express (get), Flask and FastAPI (get).  "any"/"all" match every method.
+_HTTP_METHODS: frozenset[str] = frozenset(
+    {"all", "any", "delete", "get", "head", "options", "patch", "post", "put"},
+)
+
+# net/http-style registrations of a handler for any method.
+_HANDLE_FUNCS: frozenset[str] = frozenset({"Handle", "HandleFunc"})
+
+# Go 1.22 patterns: "GET /users/{id}".
+_GO_ROUTE_METHOD_RE: re.Pattern[str] = re.compile(r"^([A-Z]+)\s+(\S+)$")
+
+_STRING_QUOTES: tuple[str, ...] = ('"""', "'''", '"', "'", "`")
+
+
+def _string_value(node: Node) -> str | None:
+    """The contents of a string literal without interpolation, else None."""
+    if node.type not in _STRING_NAME_TYPES and node.type != "template_string":
+        return None
+    if any(c.type in ("interpolation", "template_substitution") for c in node.named_children):
+        return None
+    text: str = _node_text(node).lstrip("bBrRuU")
+    for quote in _STRING_QUOTES:
+        if len(text) >= 2 * len(quote) and text.startswith(quote) and text.endswith(quote):
+            return text[len(quote) : -len(quote)]
+    return None
+
+
+def _route_method(name: str) -> str:
+    return "ANY" if name.lower() in ("all", "any") else name.upper()
+
+
+def _go_handler(node: Node) -> dict[str, Any] | None:
+    """``health``, ``api.Health``, or the ``health`` in ``http.HandlerFunc(health)``."""
+    if node.type == "call_expression":
+        arguments: Node | None = node.child_by_field_name("arguments")
+        if arguments is None or len(arguments.named_children) != 1:
+            return None
+        node = arguments.named_children[0]
+    if node.type == "identifier":
+        return {"name": _node_text(node)}
+    if node.type == "selector_expression":
+        operand: Node | None = node.child_by_field_name("operand")
+        member: Node | None = node.child_by_field_name("field")
+        if operand is not None and operand.type == "identifier" and member is not None:
+            return {"name": _node_text(member), "qualifier": _node_text(operand)}
+    return None
+
+
+def _go_endpoints(node: Node) -> Iterator[_Endpoint]:
+    """net/http, gin, echo, and chi registrations: ``r.GET("/users", list)``."""
+    if node.type != "call_expression":
+        return
+    func: Node | None = node.child_by_field_name("function")
+    arguments: Node | None = node.child_by_field_name("arguments")
+    if func is None or func.type != "selector_expression" or arguments is None:
+        return
+    member: Node | None = func.child_by_field_name("field")
+    args: list[Node] = arguments.named_children
+    if member is None or len(args) < 2:
+        return
+    name: str = _node_text(member)
+    path: str | None = _string_value(args[0])
+    if path is None:
+        return
+    if name in _HANDLE_FUNCS:
+        method: str = "ANY"
+        match: re.Match[str] | None = _GO_ROUTE_METHOD_RE.match(path)
+        if match is not None:
+            method, path = match.groups()
+    elif name.lower() in _HTTP_METHODS and name[:1].isupper():
+        method = _route_method(name)
+    else:
+        return
+    if path.startswith("/"):
+        yield method, path, _go_handler(args[-1])  # middleware comes before the handler
+
+
+def _js_endpoints(node: Node) -> Iterator[_Endpoint]:
+    """Express-style registrations: ``app.get("/users", list)``."""
+    if node.type != "call_expression":
+        return
+    func: Node | None = node.child_by_field_name("function")
+    arguments: Node | None = node.child_by_field_name("arguments")
+    if func is None or func.type != "member_expression" or arguments is None:
+        return
+    prop: Node | None = func.child_by_field_name("property")
+    args: list[Node] = arguments.named_children
+    if prop is None or _node_text(prop) not in _HTTP_METHODS or len(args) < 2:
+        return
+    path: str | None = _string_value(args[0])
+    if path is None or not path.startswith("/"):
+        return
+    handler: Node = args[-1]
+    reference: dict[str, Any] | None = None
+    if handler.type == "identifier":
+        reference = {"name": _node_text(handler)}
+    elif handler.type == "member_expression":  # users.list
+        handler_prop: Node | None = handler.child_by_field_name("property")
+        if handler_prop is not None:
+            reference = {"name": _node_text(handler_prop)}
+    yield _route_method(_node_text(prop)), path, reference
+
+
+def _python_endpoints(node: Node) -> Iterator[_Endpoint]:
+    """Flask and FastAPI decorators: ``@app.route("/users", methods=["POST"])``."""
+    if node.type != "decorator" or node.parent is None:
+        return
+    call: Node | None = next((c for c in node.named_children if c.type == "call"), None)
+    func: Node | None = call.child_by_field_name("function") if call is not None else None
+    arguments: Node | None = call.child_by_field_name("arguments") if call is not None else None
+    if func is None or func.type != "attribute" or arguments is None:
+        return
+    attribute: Node | None = func.child_by_field_name("attribute")
+    name: str = _node_text(attribute) if attribute is not None else ""
+    positional: list[Node] = [a for a in arguments.named_children if a.type != "keyword_argument"]
+    path: str | None = _string_value(positional[0]) if positional else None
+    if path is None or not path.startswith("/"):
+        return
+    methods: list[str] = []
+    if name in ("api_route", "route"):
+        for keyword in arguments.named_children:
+            key: Node | None = keyword.child_by_field_name("name")
+            value: Node | None = keyword.child_by_field_name("value")
+            if key is not None and value is not None and _node_text(key) == "methods":
+                methods = [m.upper() for c in value.named_children if (m := _string_value(c))]
+        methods = methods or ["GET"]
+    elif name in _HTTP_METHODS:
+        methods = [_route_method(name)]
+    else:
+        return
+    definition: Node | None = node.parent.child_by_field_name("definition")
+    handler: Node | None = definition.child_by_field_name("name") if definition else None
+    for method in methods:
+        yield method, path, {"name": _node_text(handler)} if handler is not None else None
+
+
+_ENDPOINT_DETECTORS: dict[str, Callable[[Node], Iterator[_Endpoint]]] = {
+    "go": _go_endpoints,
+    "javascript": _js_endpoints,
+    "python": _python_endpoints,
+    "tsx": _js_endpoints,
+    "typescript": _js_endpoints,
+}
+
+
+# ---------------------------------------------------------------------------
+# Extraction
+# ---------------------------------------------------------------------------
+
+
+def _node_text(node: Node) -> str:
+    """Node text with runs of whitespace collapsed to a single space."""
+    return re.sub(r"\s+", " ", node.text.decode()).strip()
+
+
+def _entity_name(node: Node, language: str) -> str | None:
+    """Return the display name of an entity node, or *None* if it has none."""
+    name_node: Node | str | None
+    getter: Callable[[Node], Node | str | None] | None = _NAME_GETTERS.get((language, node.type))
+    if getter is not None:
+        name_node = getter(node)
+    else:
+        name_node = node.child_by_field_name(_NAME_FIELDS.get((language, node.type), "name"))
+    if name_node is None:
+        return _DEFAULT_NAMES.get((language, node.type))
+    if isinstance(name_node, str):  # put together from several nodes
+        return name_node
+    name: str = _node_text(name_node)
+    if name_node.type in _STRING_NAME_TYPES:
+        name = name.strip("\"'`")
+    elif name_node.type == "system_lib_string":
+        name = name.strip("<>")
+    return name
+
+
+def qualified_names(entities: list[Entity]) -> dict[int, str]:
+    """Dotted names through enclosing declarations (``Server.Start``), by id.
+
+    Go methods are named after their receiver type.  The file entity is not
+    part of the name; its own qualified name is its path.
+    """
+    by_id: dict[int, Entity] = {e.id: e for e in entities}
+    names: dict[int, str] = {}
+    for entity in entities:
+        parts: list[str] = []
+        current: Entity | None = entity
+        while current is not None and current.kind != "file":
+            parts.append(current.name)
+            if current.language == "go" and "receiver" in current.attrs:
+                parts.append(current.attrs["receiver"])  # func (s *Server) Start()
+            current = by_id.get(current.parent) if current.parent is not None else None
+        names[entity.id] = ".".join(reversed(parts)) if parts else entity.path
+    return names
+
+
+def is_exported(entity: Entity, parent: Entity | None) -> bool:
+    """Whether *entity* is visible outside its file or package, as its syntax says.
+
+    Go exports capitalized names, Python hides names with a leading
+    underscore, and a top-level JavaScript or TypeScript declaration is
+    only visible when exported.  Rust items need ``pub`` and C# members
+    an access modifier; explicitly private or protected members are
+    hidden.  Anything else counts as exported, rather than guessing.
+    """
+    visibility: str | None = entity.attrs.get("visibility")
+    if visibility == "protected" or "private" in (visibility or "").split():
+        return False
+    if entity.language == "rust":
+        # Trait items and the items of trait impls are as visible as the trait.
+        in_trait: bool = parent is not None and (
+            parent.kind == "trait" or (parent.kind == "impl" and "trait" in parent.attrs)
+        )
+        return in_trait or (visibility or "").startswith("pub")
+    if entity.language == "c_sharp" and visibility is None:
+        # Class and struct members are private unless declared otherwise.
+        return parent is None or parent.kind not in ("class", "struct")
+    if entity.language == "go":
+        return entity.name[:1].isupper()
+    if entity.language == "python":
+        return not entity.name.startswith("_") or (
+            entity.name.startswith("__") and entity.name.endswith("__")
+        )
+    if entity.language in ("javascript", "typescript", "tsx"):
+        if entity.name.startswith("#"):
+            return False
+        if parent is None or parent.kind == "file":
+            return bool(entity.attrs.get("exported"))
+    return True
+
+
+# Test files by name, across languages: foo_test.go, test_foo.py, foo.spec.ts,
+# FooTest.java, FooTests.cs, and anything under a tests/ or __tests__/ directory.
+_TEST_PATH_RE: re.Pattern[str] = re.compile(
+    r"(?:^|/)(?:tests?|__tests__|spec)/"
+    r"|(?:^|/)test_[^/]*\.py$"
+    r"|_test\.(?:go|py|rs|c|cc|cpp)$"
+    r"|\.(?:spec|test)\.[cm]?[jt]sx?$"
+    r"|[a-z0-9](?:Test|Tests|Spec)\.(?:java|kt|cs|scala|php)$"
+    r"|_spec\.rb$",
+)
+
+# Functions a runtime or test runner calls by name.
+_ENTRY_POINT_NAMES: frozenset[str] = frozenset({"main", "Main", "init"})
+_GO_TEST_PREFIXES: tuple[str, ...] = ("Test", "Benchmark", "Example", "Fuzz")
+
+# Annotations and attributes of test methods: JUnit, xUnit, NUnit, and MSTest.
+_TEST_ANNOTATIONS: frozenset[str] = frozenset({
+    "Fact", "ParameterizedTest", "RepeatedTest", "Test", "TestCase", "TestFactory",
+    "TestMethod", "Theory",
+})
+
+
+def is_test_path(path: str) -> bool:
+    """Whether *path* names a test file, by the usual conventions of its language."""
+    return _TEST_PATH_RE.search(path.replace(os.sep, "/")) is not None
+
+
+def is_entry_point(entity: Entity) -> bool:
+    """Whether *entity* is called from outside the code: ``main`` or a test."""
+    if entity.name in _ENTRY_POINT_NAMES:
+        return True
+    annotations: list[str] = entity.attrs.get("annotations", []) + entity.attrs.get(
+        "attributes", [],
+    )
+    if any(a.split("(", 1)[0].rsplit(".", 1)[-1] in _TEST_ANNOTATIONS for a in annotations):
+        return True
+    if entity.language == "go" and entity.path.endswith("_test.go"):
+        return entity.name.startswith(_GO_TEST_PREFIXES)
+    if entity.language == "python" and entity.name.startswith("test"):
+        return is_test_path(entity.path)
+    return False
+
+
+def assign_uids(entities: list[Entity]) -> None:
+    """Give one file's entities ids derived from what they are, not where.
+
+    A uid hashes the path, kind, and qualified name, so it survives edits
+    elsewhere in the file and re-runs on other machines (paths are relative
+    to the working directory).  Same-named entities of one kind, such as
+    overloads, are told apart by their order in the file.
+    """
+    names: dict[int, str] = qualified_names(entities)
+    seen: dict[tuple[str, str], int] = {}
+    for entity in entities:
+        key: tuple[str, str] = (entity.kind, names[entity.id])
+        ordinal: int = seen.get(key, 0)
+        seen[key] = ordinal + 1
+        text: str = "\x00".join([entity.path, *key, str(ordinal)])
+        entity.uid = hashlib.sha256(text.encode()).hexdigest()[:16]
+
+
+def _walk(node: Node) -> Iterator[tuple[Node, int]]:
+    """Yield (node, depth) pairs in document order (pre-order)."""
+    stack: list[tuple[Node, int]] = [(node, 0)]
+    while stack:
+        current, depth = stack.pop()
+        yield current, depth
+        stack.extend((child, depth + 1) for child in reversed(current.children))
+
+
+# Most syntax errors reported per file; past this, one more says how many were left out.
+MAX_SYNTAX_ERRORS: int = 20
+
+
+def syntax_errors(tree: Tree, source_utf8: bytes, path: str) -> list[ParseError]:
+    """The outermost ``ERROR`` and missing nodes in *tree*, in document order."""
+    if not tree.root_node.has_error:
+        return []
+    lines: list[bytes] = source_lines(source_utf8)
+
+    def position(point: tuple[int, int]) -> tuple[int, int]:
+        row, byte_col = point
+        line: bytes = lines[row] if row < len(lines) else b""
+        return row + 1, byte_col_to_char_col(line, byte_col + 1)
+
+    errors: list[ParseError] = []
+    found: int = 0
+    stack: list[Node] = [tree.root_node]
+    while stack:
+        node: Node = stack.pop()
+        if node.type == "ERROR" or node.is_missing:
+            found += 1
+            if found <= MAX_SYNTAX_ERRORS:
+                row, col = position(node.start_point)
+                end_row, end_col = position(node.end_point)
+                errors.append(ParseError(
+                    path,
+                    "missing" if node.is_missing else "syntax",
+                    f"missing {node.type}" if node.is_missing else "syntax error",
+                    row, col, end_row, end_col,
+                ))
+            continue
+        stack.extend(child for child in reversed(node.children) if child.has_error)
+    if found > MAX_SYNTAX_ERRORS:
+        last: ParseError = errors[-1]
+        errors.append(ParseError(
+            path, "syntax", f"{found - MAX_SYNTAX_ERRORS} more syntax error(s) not listed",
+            last.end_row, last.end_col, last.end_row, last.end_col,
+        ))
+    return errors
+
+
+def file_entity(
+    source_utf8: bytes, language: str, path: str, start_id: int,
+    end_point: tuple[int, int] | None = None,
+) -> Entity:
+    """The entity for a whole file, ending at *end_point* (default: the last byte)."""
+    if end_point is None:
+        newline: int = source_utf8.rfind(b"\n")
+        end_point = (source_utf8.count(b"\n"), len(source_utf8) - newline - 1)
+    lines: list[bytes] = source_lines(source_utf8)
+    row, byte_col = end_point
+    line: bytes = lines[row] if row < len(lines) else b""
+    return Entity(
+        id=start_id,
+        kind="file",
+        name=PurePosixPath(path).name,
+        path=path,
+        language=language,
+        row=1,
+        col=1,
+        end_row=row + 1,
+        end_col=byte_col_to_char_col(line, byte_col + 1),
+        attrs=file_attrs(language, path),
+        start_byte=0,
+        end_byte=len(source_utf8),
+    )
+
+
+def extract_entities(
+    source_utf8: bytes,
+    language: str,
+    path: str,
+    start_id: int,
+    tree: Tree | None = None,
+) -> tuple[list[Entity], list[Edge], int]:
+    """Extract entities and unresolved references from UTF-8 source bytes.
+
+    The first entity is always the file itself; every other entity's
+    ``parent`` points at its nearest enclosing entity.  References are
+    edges whose ``target`` is still *None*.  Returns (entities, references,
+    next_available_id).  Pass *tree* to reuse an existing parse.
+
+    Query files registered for the language (see overriding.py) add
+    entities and references, or replace the built-in ones.  Features
+    switched off for the language (see features.py) are left out.
+    """
+    if tree is None:
+        tree = parse_tree(source_utf8, language)
+    lines: list[bytes] = source_lines(source_utf8)
+    node_types: dict[str, str] = LANGUAGE_ENTITY_TYPES.get(language, {})
+    collect: Callable[[Node], Iterator[_Reference]] | None = _REFERENCE_COLLECTORS.get(language)
+    use_types: frozenset[str] = _USE_TYPES.get(language, frozenset())
+    detect: Callable[[Node], Iterator[_Endpoint]] | None = _ENDPOINT_DETECTORS.get(language)
+    # Tables read and written by SQL in string literals, in any language.
+    embedded_sql: bool = not replaces_builtin(language)
+    if replaces_builtin(language):
+        node_types, collect, detect, use_types = {}, None, None, frozenset()
+    off: frozenset[str] = disabled_features(language)
+    if "calls" in off:
+        collect = None
+    if "endpoints" in off:
+        detect = None
+    if "references" in off:
+        use_types = frozenset()
+    embedded_sql = embedded_sql and "sql" not in off
+    comments: bool = "comments" not in off
+    secrets: bool = "secrets" not in off
+    root: Node = tree.root_node
+    definitions: dict[NodeKey, Definition]
+    query_references: dict[NodeKey, list[tuple[str, str]]]
+    definitions, query_references = run_queries(root, language)
+    # Declarations measured separately from the function around them.  Plain
+    # declarators are left out: most of them bind values, not functions.
+    function_types: frozenset[str] = frozenset(
+        t for t, k in node_types.items() if k in _MEASURED_KINDS and t != "variable_declarator"
+    )
+    callers: frozenset[str] = (
+        _CALLER_KINDS | {"file"} if language in _SCRIPT_LANGUAGES else _CALLER_KINDS
+    )
+
+    def position(point: tuple[int, int]) -> tuple[int, int]:
+        row, byte_col = point
+        line: bytes = lines[row] if row < len(lines) else b""
+        return row + 1, byte_col_to_char_col(line, byte_col + 1)
+
+    root_entity: Entity = file_entity(source_utf8, language, path, start_id, root.end_point)
+    entities: list[Entity] = [root_entity]
+    references: list[Edge] = []
+    current_id: int = start_id + 1
+    used: set[tuple[int, str]] = set()  # (scope id, name) of references recorded
+
+    # Stack of (depth, entity) for the chain of enclosing entities.
+    enclosing: list[tuple[int, Entity]] = [(-1, root_entity)]
+    for node, depth in _walk(root):
+        while enclosing[-1][0] >= depth:
+            enclosing.pop()
+        scope: Entity = enclosing[-1][1]
+        if comments and node.type in _COMMENT_TYPES:
+            text: str = _clean_comment(node.text.decode(errors="replace"))
+            row, col = position(node.start_point)
+            end_row, end_col = position(node.end_point)
+            entities.append(Entity(
+                id=current_id,
+                kind="comment",
+                name=text.split("\n", 1)[0][:_COMMENT_NAME_LENGTH] or "comment",
+                path=path,
+                language=language,
+                row=row,
+                col=col,
+                end_row=end_row,
+                end_col=end_col,
+                parent=scope.id,
+                attrs=_comment_attrs(text, _comment_category(node, language, lines, node_types)),
+                start_byte=node.start_byte,
+                end_byte=node.end_byte,
+            ))
+            current_id += 1
+            continue
+        key: NodeKey | None = node_key(node) if definitions or query_references else None
+        collected: int = len(references)
+        if collect is not None and (scope.kind in _INSTANTIATING_KINDS or scope.kind in callers):
+            for edge_kind, attrs, ref_node in collect(node):
+                if edge_kind != "instantiates" and scope.kind not in callers:
+                    continue
+                attrs["row"], attrs["col"] = position(ref_node.start_point)
+                references.append(Edge(edge_kind, scope.id, None, attrs))
+        if node.type in use_types and node.child_count == 0 and _is_use(node, node_types):
+            # One per name and scope, at its first use; the linker resolves it.
+            used_name: str = node.text.decode()
+            if (scope.id, used_name) not in used:
+                used.add((scope.id, used_name))
+                row, col = position(node.start_point)
+                references.append(
+                    Edge("references", scope.id, None, {"name": used_name, "row": row, "col": col}),
+                )
+        if embedded_sql and scope.kind in _CALLER_KINDS and node.type in _SQL_STRING_TYPES:
+            value: str | None = _string_value(node)
+            if value is not None and looks_like_sql(value):
+                row, col = position(node.start_point)
+                for access in table_accesses(value):
+                    attrs = {"name": access.table, "row": row, "col": col}
+                    references.append(Edge(access.kind, scope.id, None, attrs))
+        if secrets and node.type in _SQL_STRING_TYPES:
+            literal: str = _string_value(node) or ""
+            # The line around the literal tells AWS secret keys from other tokens.
+            context: bytes = lines[node.start_point[0]] if node.start_point[0] < len(lines) else b""
+            for secret in find_secrets(literal, context.decode(errors="replace")):
+                row, col = position(node.start_point)
+                end_row, end_col = position(node.end_point)
+                attrs = {"rule": secret.rule}
+                if secret.entropy is not None:
+                    attrs["entropy"] = secret.entropy
+                entities.append(Entity(
+                    id=current_id,
+                    kind="secret",
+                    name=SECRET_RULES[secret.rule],
+                    path=path,
+                    language=language,
+                    row=row,
+                    col=col,
+                    end_row=end_row,
+                    end_col=end_col,
+                    parent=scope.id,
+                    attrs=attrs,
+                    start_byte=node.start_byte,
+                    end_byte=node.end_byte,
+                ))
+                current_id += 1
+        if key in query_references and scope.kind in _CALLER_KINDS and "calls" not in off:
+            # Skip what built-in collection already found on this node.
+            found: set[tuple[str, Any]] = {
+                (r.kind, r.attrs.get("name")) for r in references[collected:]
+            }
+            row, col = position(node.start_point)
+            for edge_kind, ref_name in query_references[key]:
+                if (edge_kind, ref_name) in found:
+                    continue
+                references.append(
+                    Edge(edge_kind, scope.id, None, {"name": ref_name, "row": row, "col": col}),
+                )
+        for method, route, handler in detect(node) if detect is not None else ():
+            row, col = position(node.start_point)
+            end_row, end_col = position(node.end_point)
+            entities.append(Entity(
+                id=current_id,
+                kind="endpoint",
+                name=f"{method} {route}",
+                path=path,
+                language=language,
+                row=row,
+                col=col,
+                end_row=end_row,
+                end_col=end_col,
+                parent=scope.id,
+                attrs={
+                    "method": method,
+                    "path": route,
+                    "handler": handler["name"] if handler is not None else None,
+                },
+                start_byte=node.start_byte,
+                end_byte=node.end_byte,
+            ))
+            if handler is not None:
+                references.append(Edge("handles", current_id, None, {**handler, "row": row}))
+            current_id += 1
+        definition: Definition | None = definitions.get(key) if key is not None else None
+        kind: str | None = node_types.get(node.type)
+        if definition is not None:
+            kind = definition.kind
+        if kind is None:
+            continue
+        name: str | None = _entity_name(node, language)
+        if definition is not None and definition.name is not None:
+            name = definition.name
+        if name is None:
+            continue
+        refine: Callable[[Node], str | None] | None = _KIND_REFINERS.get((language, node.type))
+        if refine is not None and definition is None:
+            kind = refine(node)
+            if kind is None:
+                continue
+        if kind in _IMPORT_KINDS and "imports" in off:
+            continue
+        if kind == "function" and scope.kind in _MEMBER_CONTAINERS:
+            kind = "method"
+        row, col = position(node.start_point)
+        end_row, end_col = position(node.end_point)
+        end_byte: int = node.end_byte
+        scope_depth: int = depth
+        if (
+            (language, node.type) in _SCOPES_TO_END and node.parent is not None
+            and node.child_by_field_name("body") is None
+        ):
+            end_row, end_col = position(node.parent.end_point)
+            end_byte = node.parent.end_byte
+            scope_depth = depth - 1  # following siblings nest inside it
+        hook: Callable[[Node], dict[str, Any]] | None = _ATTR_HOOKS.get((language, node.type))
+        entity_attrs: dict[str, Any] = hook(node) if hook is not None else {}
+        if language in _VISIBILITY_LANGUAGES and "visibility" not in entity_attrs:
+            visibility: str | None = _declared_visibility(node)
+            if visibility is not None:
+                entity_attrs["visibility"] = visibility
+        doc: str | None = _entity_doc(node, language) if "docs" not in off else None
+        if definition is not None:
+            entity_attrs.update(definition.attrs)
+            if definition.doc is not None and "docs" not in off:
+                doc = _clean_comment(definition.doc)
+        if doc is not None:
+            entity_attrs["doc"] = doc
+        if kind in FINGERPRINTED_KINDS and "fingerprints" not in off:
+            structure: str | None = fingerprint(node, name)
+            if structure is not None:
+                entity_attrs["fingerprint"] = structure
+        if kind in _MEASURED_KINDS and not entity_attrs.get("declaration"):
+            if "metrics" not in off:
+                entity_attrs["metrics"] = function_metrics(node, language, function_types)
+            minhash: list[int] | None = (
+                clone_signature(node, function_types) if "clones" not in off else None
+            )
+            if minhash is not None:
+                references.append(Edge("clone-of", current_id, None, {"signature": minhash}))
+        entity: Entity = Entity(
+            id=current_id,
+            kind=kind,
+            name=name,
+            path=path,
+            language=language,
+            row=row,
+            col=col,
+            end_row=end_row,
+            end_col=end_col,
+            parent=scope.id,
+            attrs=entity_attrs,
+            start_byte=node.start_byte,
+            end_byte=end_byte,
+        )
+        entities.append(entity)
+        enclosing.append((scope_depth, entity))
+        current_id += 1
+    if language == "bash" and collect is not None:
+        functions: set[str] = {e.name for e in entities if e.kind == "function"}
+        programs: list[str] = [
+            c for c in shell_commands(root) if c not in _SHELL_BUILTINS and c not in functions
+        ]
+        if programs:
+            root_entity.attrs["commands"] = programs
+    assign_uids(entities)
+    return entities, references, current_id
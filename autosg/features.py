@@ -0,0 +1,102 @@
+"""Per-language extraction features, switched off in the config file.
+
+Extraction records everything it can by default, except comments and
+secrets.  A ``features`` table in the config file turns parts of it on
+or off per language, or for every language under ``"*"``, when they are
+not needed and cost time or output::
+
+    features:
+      "*": {docs: false}
+      go: {metrics: false, clones: false}
+      python: {docs: true, references: false, comments: true}
+
+A language's own settings win over ``"*"``.  Features switched off are
+neither computed nor stored in the extraction cache, which keys results
+by how the features of their language differ from the defaults.
+"""
+
+from __future__ import annotations
+
+import hashlib
+from typing import Any
+
+from .parsing import EXTENSION_TO_LANGUAGE, FILENAME_TO_LANGUAGE
+
+# Every feature, with what turning it off leaves out.
+FEATURES: dict[str, str] = {
+    "calls": "calls, instantiates, and runs references, so no calls, instantiates, or runs edges",
+    "clones": "clone signatures, so no clone-of edges",
+    "comments": "comment entities, with TODO and FIXME markers; off by default",
+    "docs": "the doc attr of entities",
+    "endpoints": "HTTP endpoint entities and their handles references",
+    "fingerprints": "the fingerprint attr used by diff to find renames",
+    "imports": "import and use entities, so no imports edges",
+    "metrics": "the metrics attr of functions, methods, and components",
+    "references": "identifier uses, so no references edges",
+    "secrets": "secret entities for likely hard-coded credentials; off by default",
+    "sql": "table reads and writes of SQL in string literals",
+}
+
+ALL_LANGUAGES: str = "*"
+
+# Features switched off unless switched on: comments would crowd the
+# output, and the secrets scan is for ``lint --secrets``.
+DEFAULT_OFF: frozenset[str] = frozenset({"comments", "secrets"})
+
+# language (or ALL_LANGUAGES) -> feature -> on
+_registered: dict[str, dict[str, bool]] = {}
+
+
+def parse_features(spec: Any, where: str) -> dict[str, dict[str, bool]]:
+    """Validate the ``features`` table of a config file; *where* prefixes errors."""
+    if not isinstance(spec, dict):
+        raise ValueError(f"{where}: 'features' must map languages to tables of features")
+    known: set[str] = {*EXTENSION_TO_LANGUAGE.values(), *FILENAME_TO_LANGUAGE.values()}
+    toggles: dict[str, dict[str, bool]] = {}
+    for language, settings in spec.items():
+        if language != ALL_LANGUAGES and language not in known:
+            raise ValueError(f"{where}: unknown language {language!r} in features")
+        if not isinstance(settings, dict):
+            raise ValueError(f"{where}: features.{language} must be a table of features")
+        for name, on in settings.items():
+            if name not in FEATURES:
+                raise ValueError(
+                    f"{where}: unknown feature {name!r} in features.{language}; "
+                    f"choose from {', '.join(FEATURES)}",
+                )
+            if not isinstance(on, bool):
+                raise ValueError(f"{where}: features.{language}.{name} must be true or false")
+        toggles[str(language)] = dict(settings)
+    return toggles
+
+
+def register_features(toggles: dict[str, dict[str, bool]]) -> None:
+    """Switch features on and off, as parse_features returns them."""
+    for language, settings in toggles.items():
+        _registered.setdefault(language, {}).update(settings)
+
+
+def clear_features() -> None:
+    """Switch every feature back on."""
+    _registered.clear()
+
+
+def registered_features() -> dict[str, dict[str, bool]]:
+    return {language: dict(settings) for language, settings in _registered.items()}
+
+
+def disabled_features(language: str) -> frozenset[str]:
+    """The features switched off for *language*."""
+    settings: dict[str, bool] = {
+        **{name: False for name in DEFAULT_OFF},
+        **_registered.get(ALL_LANGUAGES, {}), **_registered.get(language, {}),
+    }
+    return frozenset(name for name, on in settings.items() if not on)
+
+
+def feature_digest(digest: str, language: str) -> str:
+    """The cache key for content with *digest*, which must change with the features."""
+    changed: frozenset[str] = disabled_features(language) ^ DEFAULT_OFF
+    if not changed:
+        return digest
+    return hashlib.sha256(f"{digest}\x00{','.join(sorted(changed))}".encode()).hexdigest()
@@ -0,0 +1,179 @@
+"""Inputs that are not a file or directory on disk: archives, git URLs, and stdin.
+
+``analyze`` accepts a tarball or zip file in place of a directory, a git
+repository URL with an optional ``@ref``, and ``-`` for one file read
+from stdin::
+
+    autosg analyze service.tar.gz
+    autosg analyze https://github.com/org/repo@v1.2.3
+    cat main.go | autosg analyze --lang go -
+
+Each is unpacked, shallow-cloned, or written into a temporary directory
+for the length of the run.  Output names their files after the input
+rather than the temporary copy: ``service.tar.gz/src/main.go``,
+``github.com/org/repo@v1.2.3/main.go``, and ``<stdin>`` for stdin.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import os
+import re
+import subprocess
+import sys
+import tarfile
+import tempfile
+import zipfile
+from collections.abc import Iterable, Iterator
+from pathlib import Path
+from typing import BinaryIO
+
+from .components import COMPONENT_EXTENSIONS
+from .embedding import TEMPLATE_EXTENSIONS
+from .idl import IDL_EXTENSIONS
+from .notebooks import NOTEBOOK_EXTENSIONS
+from .parsing import EXTENSION_TO_LANGUAGE, FILENAME_TO_LANGUAGE
+from .zig import ZIG_EXTENSIONS
+
+STDIN: str = "-"
+
+# How a file read from stdin is named in output.
+STDIN_LABEL: str = "<stdin>"
+
+ARCHIVE_SUFFIXES: tuple[str, ...] = (
+    ".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz", ".zip",
+)
+
+# URLs git can clone from: a scheme, or scp-like ``user@host:path``.
+_GIT_URL_RE: re.Pattern[str] = re.compile(r"^(?:(?:https?|ssh|git|file)://|[\w.-]+@[\w.-]+:)")
+
+
+class FetchError(Exception):
+    """Raised when an input cannot be read, unpacked, or cloned."""
+
+
+def is_archive(path: Path) -> bool:
+    return path.is_file() and path.name.lower().endswith(ARCHIVE_SUFFIXES)
+
+
+def is_git_url(spec: str) -> bool:
+    return _GIT_URL_RE.match(spec) is not None
+
+
+def split_git_url(spec: str) -> tuple[str, str | None]:
+    """*spec* as a repository URL and the ref after its last ``@``, if any.
+
+    A ref cannot contain ``/`` or ``:``, which tells it from the user in
+    ``git@host:org/repo``.
+    """
+    url, at, ref = spec.rpartition("@")
+    if not at or not url or "/" in ref or ":" in ref or not is_git_url(url):
+        return spec, None
+    return url, ref
+
+
+def _git_label(url: str, ref: str | None) -> str:
+    """``github.com/org/repo@ref`` for the URL's host and path, without a user or ``.git``."""
+    location: str = re.sub(r"^[a-z]+://", "", url)
+    if location == url:  # scp-like: user@host:path
+        location = location.split("@", 1)[1].replace(":", "/", 1)
+    else:
+        location = re.sub(r"^[^@/]+@", "", location)
+    location = location.strip("/").removesuffix(".git")
+    return f"{location}@{ref}" if ref is not None else location
+
+
+def _git(args: list[str], cwd: Path) -> None:
+    try:
+        subprocess.run(["git", *args], cwd=cwd, capture_output=True, check=True)
+    except FileNotFoundError:
+        raise FetchError("git is not installed") from None
+    except subprocess.CalledProcessError as exc:
+        message: str = exc.stderr.decode(errors="replace").strip()
+        raise FetchError(message or f"git {' '.join(args)} failed") from None
+
+
+def clone(url: str, ref: str | None, directory: Path) -> None:
+    """Check out *ref* (default: the remote's HEAD) of *url* into *directory*.
+
+    Only that commit is fetched.  Credentials come from git's own helpers.
+    *ref* can be a branch, a tag, or a commit hash the server lets clients
+    fetch directly (GitHub and GitLab do).
+    """
+    if ref is not None and ref.startswith("-"):
+        raise FetchError(f"cannot clone {url}@{ref}: a ref cannot start with '-'")
+    directory.mkdir(parents=True)
+    try:
+        _git(["init", "--quiet"], directory)
+        _git(["remote", "add", "--", "origin", url], directory)
+        _git(["fetch", "--quiet", "--depth", "1", "--", "origin", ref or "HEAD"], directory)
+        _git(["checkout", "--quiet", "FETCH_HEAD"], directory)
+    except FetchError as exc:
+        raise FetchError(f"cannot clone {url}{f'@{ref}' if ref else ''}: {exc}") from None
+
+
+def _stdin_name(language: str) -> str:
+    """A file name *language* is detected from."""
+    for suffix, candidate in [
+        *EXTENSION_TO_LANGUAGE.items(), *IDL_EXTENSIONS.items(), *ZIG_EXTENSIONS.items(),
+        *COMPONENT_EXTENSIONS.items(), *TEMPLATE_EXTENSIONS.items(), *NOTEBOOK_EXTENSIONS.items(),
+    ]:
+        if candidate == language:
+            return "stdin" + suffix
+    for name, candidate in FILENAME_TO_LANGUAGE.items():
+        if candidate == language:
+            return name
+    raise FetchError(f"no file name is detected as {language}")
+
+
+def _unpack(archive: Path, directory: Path) -> None:
+    try:
+        if archive.name.lower().endswith(".zip"):
+            with zipfile.ZipFile(archive) as zip_file:
+                zip_file.extractall(directory)  # drops absolute and ".." parts
+        else:
+            with tarfile.open(archive) as tar:
+                tar.extractall(directory, filter="data")
+    except (OSError, tarfile.TarError, zipfile.BadZipFile) as exc:
+        raise FetchError(f"cannot unpack {archive}: {exc}") from None
+
+
+@contextlib.contextmanager
+def fetch_inputs(
+    inputs: Iterable[str | os.PathLike[str]], stdin_language: str | None = None,
+    stdin: BinaryIO | None = None,
+) -> Iterator[tuple[list[Path], dict[Path, str]]]:
+    """Yield the paths to analyze for *inputs*, and labels for the stand-ins.
+
+    Files and directories are yielded as they are.  An archive is unpacked,
+    a git URL cloned, and ``-`` read from *stdin* (default: the process's),
+    into a temporary directory that is removed on exit.  The labels map
+    each stand-in, resolved, to the name its files are given in output;
+    pass them as ``Options.labels``.  Raises ``FetchError`` for an input
+    that cannot be fetched or ``-`` without *stdin_language*.
+    """
+    paths: list[Path] = []
+    labels: dict[Path, str] = {}
+    with tempfile.TemporaryDirectory(prefix="autosg-input-") as tmp:
+        for i, spec in enumerate(inputs):
+            target: Path = Path(tmp) / str(i)
+            if isinstance(spec, str) and is_git_url(spec):
+                url, ref = split_git_url(spec)
+                clone(url, ref, target)
+                labels[target.resolve()] = _git_label(url, ref)
+            elif str(spec) == STDIN:
+                if stdin_language is None:
+                    raise FetchError("reading from stdin (-) needs a language; use --lang")
+                if STDIN_LABEL in labels.values():
+                    raise FetchError("stdin (-) can only be read once")
+                target.mkdir()
+                target = target / _stdin_name(stdin_language)
+                target.write_bytes((stdin or sys.stdin.buffer).read())
+                labels[target.resolve()] = STDIN_LABEL
+            elif is_archive(Path(spec)):
+                _unpack(Path(spec), target)
+                labels[target.resolve()] = Path(os.path.relpath(spec)).as_posix()
+            else:
+                target = Path(spec)
+            paths.append(target)
+        yield paths, labels
@@ -0,0 +1,46 @@
+"""Structural fingerprints of entities, for rename and move detection in ``diff``.
+
+A fingerprint hashes an entity's syntax tree: the type of every node and
+the text of every leaf, so whitespace, comments, and formatting do not
+count but any change to the code does.  The entity's own name is
+normalized wherever it appears, including recursive calls, so a function
+keeps its fingerprint when it is renamed, or moved to another file or
+class.  Nested declarations are part of the fingerprint of the one around
+them.
+
+Unlike clone signatures (see cloning), identifiers are kept: two getters
+of different fields must not look like one renamed function.
+"""
+
+from __future__ import annotations
+
+import hashlib
+
+from tree_sitter import Node
+
+# Kinds of entities fingerprinted: those a refactoring moves or renames.
+FINGERPRINTED_KINDS: frozenset[str] = frozenset({
+    "class", "component", "enum", "function", "interface", "method", "struct", "trait", "type",
+})
+
+# Entities of fewer nodes are not fingerprinted: ``return x`` is everywhere.
+MIN_NODES: int = 8
+
+
+def fingerprint(node: Node, name: str) -> str | None:
+    """The fingerprint of the entity named *name* declared by *node*, or None if too small."""
+    digest = hashlib.sha256()
+    count: int = 0
+    stack: list[Node] = [node]
+    while stack:
+        current: Node = stack.pop()
+        if "comment" in current.type:
+            continue
+        count += 1
+        digest.update(current.type.encode())
+        if not current.children:
+            text: bytes = current.text
+            digest.update(b"\x00$name" if text == name.encode() else b"\x00" + text)
+        digest.update(b"\x01%d" % len(current.children))
+        stack.extend(reversed(current.children))
+    return digest.hexdigest()[:16] if count >= MIN_NODES else None
@@ -0,0 +1,166 @@
+"""Threshold expressions for ``analyze --fail-on``, which fail CI builds.
+
+An expression compares a metric of the analysis with a number::
+
+    --fail-on 'cycles>0, max-complexity>25, entities-without-owner>0'
+
+Expressions are separated by commas, and the option can be repeated.
+Once the output is written, autosg exits with status 1 if any of them
+holds, naming each with the metric's value.  Metrics are measured on the
+analysis before --hierarchy, --granularity, and --redact change it, so
+``max-complexity`` still sees functions when only files are written.
+Files, lines, and entities are counted as ``report`` and ``snapshot``
+count them (see counting.py).
+"""
+
+from __future__ import annotations
+
+import operator
+import re
+from collections.abc import Callable, Iterator
+from dataclasses import dataclass
+
+from .analysis import Analysis, FileResult
+from .counting import Totals, counted, cycles
+from .extracting import Edge
+
+# Metric -> what it measures, as --help and the README list them.
+METRICS: dict[str, str] = {
+    "files": "files analyzed",
+    "lines": "lines in them",
+    "entities": "entities, other than files, imports, uses, and comments",
+    "edges": "resolved edges",
+    "errors": "parse errors",
+    "cycles": "dependency cycles among files, over the resolved edges",
+    "cyclic-files": "files in a dependency cycle",
+    "max-loc": "most lines of code in one function",
+    "max-complexity": "highest cyclomatic complexity of one function",
+    "max-params": "most parameters of one function",
+    "max-depth": "deepest nesting in one function",
+    "entities-without-owner": "entities of files no CODEOWNERS rule owns",
+    "secrets": "string literals that look like hard-coded credentials",
+}
+
+# Metrics that need edges resolved; without --edges, calls and imports are
+# resolved for them alone, and left out of the output.
+EDGE_METRICS: frozenset[str] = frozenset({"cycles", "cyclic-files"})
+
+# What EDGE_METRICS are measured over when --edges is not given.
+GATE_EDGES: tuple[str, ...] = ("calls", "imports")
+
+_OPERATORS: dict[str, Callable[[float, float], bool]] = {
+    ">=": operator.ge, "<=": operator.le, "==": operator.eq, "!=": operator.ne,
+    ">": operator.gt, "<": operator.lt,
+}
+
+_THRESHOLD_RE: re.Pattern[str] = re.compile(
+    r"\s*([a-z][a-z-]*)\s*(>=|<=|==|!=|>|<)\s*(-?\d+(?:\.\d+)?)\s*",
+)
+
+
+@dataclass(frozen=True)
+class Threshold:
+    metric: str  # a key of METRICS
+    op: str  # a key of _OPERATORS
+    value: float
+
+    def __str__(self) -> str:
+        return f"{self.metric}{self.op}{self.value:g}"
+
+    def holds(self, metrics: dict[str, int]) -> bool:
+        return _OPERATORS[self.op](metrics[self.metric], self.value)
+
+
+def parse_thresholds(text: str) -> list[Threshold]:
+    """The comma-separated expressions in *text*; raises ValueError on a bad one."""
+    thresholds: list[Threshold] = []
+    for part in text.split(","):
+        if not part.strip():
+            continue
+        match: re.Match[str] | None = _THRESHOLD_RE.fullmatch(part)
+        if match is None:
+            raise ValueError(f"{part.strip()!r} is not METRIC OP NUMBER, e.g. 'cycles>0'")
+        if match.group(1) not in METRICS:
+            raise ValueError(
+                f"unknown metric {match.group(1)!r}; choose from {', '.join(METRICS)}",
+            )
+        thresholds.append(Threshold(match.group(1), match.group(2), float(match.group(3))))
+    return thresholds
+
+
+class GatedAnalysis(Analysis):
+    """*analysis*, measuring the results and edges it passes on for :meth:`failures`.
+
+    Without *pass_edges*, edges are measured but not passed on: they were
+    resolved for the gate, not asked for.
+    """
+
+    def __init__(self, analysis: Analysis, pass_edges: bool = True) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.pass_edges: bool = pass_edges
+        self.metrics: dict[str, int] = dict.fromkeys(METRICS, 0)
+        self._totals: Totals = Totals()
+        self._file_of: dict[int, str] = {}
+        self._edges_measured: bool = False
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            self._measure_file(file_result)
+            yield file_result
+
+    @property
+    def edges(self) -> Iterator[Edge]:
+        return self._measured_edges() if self.pass_edges else self._withheld_edges()
+
+    def _measured_edges(self) -> Iterator[Edge]:
+        count: int = 0
+        dependencies: set[tuple[str, str]] = set()
+        for edge in self.analysis.edges:
+            count += 1
+            source: str | None = self._file_of.get(edge.source)
+            target: str | None = self._file_of.get(edge.target) if edge.target is not None else None
+            if source is not None and target is not None and source != target:
+                dependencies.add((source, target))
+            yield edge
+        if not self._edges_measured:
+            self._measure_edges(count, dependencies)
+
+    def _measure_all_edges(self) -> None:
+        if not self._edges_measured:
+            for _edge in self._measured_edges():
+                pass
+
+    def _withheld_edges(self) -> Iterator[Edge]:
+        self._measure_all_edges()
+        yield from ()
+
+    def _measure_file(self, file_result: FileResult) -> None:
+        metrics: dict[str, int] = self.metrics
+        self._totals.add(file_result)
+        metrics.update(
+            files=self._totals.files, lines=self._totals.lines, errors=self._totals.errors,
+            entities=self._totals.entities,
+        )
+        for entity in file_result.entities:
+            self._file_of[entity.id] = file_result.path
+        for entity in counted(file_result.entities):
+            if "owner" not in entity.attrs:
+                metrics["entities-without-owner"] += 1
+            if entity.kind == "secret":
+                metrics["secrets"] += 1
+            for name, value in entity.attrs.get("metrics", {}).items():
+                if f"max-{name}" in metrics and isinstance(value, int):
+                    metrics[f"max-{name}"] = max(metrics[f"max-{name}"], value)
+
+    def _measure_edges(self, count: int, dependencies: set[tuple[str, str]]) -> None:
+        self._edges_measured = True
+        self.metrics["edges"] = count
+        cyclic: list[list[str]] = cycles(dependencies)
+        self.metrics["cycles"] = len(cyclic)
+        self.metrics["cyclic-files"] = sum(len(c) for c in cyclic)
+
+    def failures(self, thresholds: list[Threshold]) -> list[Threshold]:
+        """The *thresholds* that hold, once the output is written."""
+        self._measure_all_edges()  # in case the output format had no use for them
+        return [t for t in thresholds if t.holds(self.metrics)]
@@ -0,0 +1,331 @@
+"""gRPC front end of the analysis service, for ``serve --grpc-addr``.
+
+Implements the ``autosg.v1.Analyzer`` service of autosg.proto over the
+same ``ServiceState`` as the HTTP API, so analyses are stored in one
+place and count against the same concurrency limit.  Messages are
+encoded with protowire.py from the field tables below, which must match
+autosg.proto; clients generate their stubs from that file.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import functools
+import json
+import logging
+import time
+from collections.abc import Callable, Iterator
+from concurrent.futures import ThreadPoolExecutor
+from http import HTTPStatus
+from pathlib import Path
+from typing import Any
+
+from .analysis import Analysis, Result, iter_analyze
+from .extracting import Edge, Entity, ParseError
+from .protowire import Field, decode, encode
+from .schema import SCHEMA_VERSION
+from .serving import RequestError, ServiceState, relocate, request_options, resolve_under
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+SERVICE: str = "autosg.v1.Analyzer"
+
+# Threads serving calls; streams hold one for as long as the client reads.
+GRPC_WORKERS: int = 16
+
+# ---------------------------------------------------------------------------
+# Messages
+# ---------------------------------------------------------------------------
+
+_ANALYZE_REQUEST: tuple[Field, ...] = (
+    Field(1, "path", "string"),
+    Field(2, "upload", "bytes"),
+    Field(3, "content_type", "string"),
+    Field(4, "filename", "string"),
+    Field(5, "edges", "string", repeated=True),
+    Field(6, "include", "string", repeated=True),
+    Field(7, "exclude", "string", repeated=True),
+    Field(8, "languages", "string", repeated=True),
+    Field(9, "recursive", "bool", optional=True),
+    Field(10, "gitignore", "bool", optional=True),
+)
+
+_ANALYZE_RESPONSE: tuple[Field, ...] = (
+    Field(1, "id", "int64"),
+    Field(2, "files", "int64"),
+    Field(3, "entities", "int64"),
+    Field(4, "edges", "int64"),
+    Field(5, "errors", "int64"),
+    Field(6, "schema_version", "int64"),
+)
+
+_ENTITIES_REQUEST: tuple[Field, ...] = (
+    Field(1, "analysis", "int64"),
+    Field(2, "kind", "string", repeated=True),
+    Field(3, "name", "string", repeated=True),
+    Field(4, "path", "string"),
+)
+
+_EDGES_REQUEST: tuple[Field, ...] = (
+    Field(1, "analysis", "int64"),
+    Field(2, "kind", "string", repeated=True),
+)
+
+_LIST_ANALYSES_REQUEST: tuple[Field, ...] = ()
+
+_LIST_ANALYSES_RESPONSE: tuple[Field, ...] = (
+    Field(1, "analyses", "message", repeated=True, message=(
+        Field(1, "id", "int64"),
+        Field(2, "source", "string"),
+        Field(3, "files", "int64"),
+    )),
+)
+
+_FILE: tuple[Field, ...] = (
+    Field(1, "path", "string"),
+    Field(2, "language", "string"),
+    Field(3, "root", "string"),
+)
+
+_ENTITY: tuple[Field, ...] = (
+    Field(1, "id", "int64"),
+    Field(2, "kind", "string"),
+    Field(3, "name", "string"),
+    Field(4, "path", "string"),
+    Field(5, "language", "string"),
+    Field(6, "row", "int64"),
+    Field(7, "col", "int64"),
+    Field(8, "end_row", "int64"),
+    Field(9, "end_col", "int64"),
+    Field(10, "parent", "int64", optional=True),
+    Field(11, "attrs", "string"),
+    Field(12, "uid", "string"),
+    Field(13, "start_byte", "int64", optional=True),
+    Field(14, "end_byte", "int64", optional=True),
+)
+
+_EDGE: tuple[Field, ...] = (
+    Field(1, "kind", "string"),
+    Field(2, "source", "int64"),
+    Field(3, "target", "int64", optional=True),
+    Field(4, "attrs", "string"),
+)
+
+_PARSE_ERROR: tuple[Field, ...] = (
+    Field(1, "path", "string"),
+    Field(2, "kind", "string"),
+    Field(3, "message", "string"),
+    Field(4, "row", "int64"),
+    Field(5, "col", "int64"),
+    Field(6, "end_row", "int64"),
+    Field(7, "end_col", "int64"),
+)
+
+_RECORD: tuple[Field, ...] = (
+    Field(1, "file", "message", message=_FILE),
+    Field(2, "entity", "message", message=_ENTITY),
+    Field(3, "edge", "message", message=_EDGE),
+    Field(4, "error", "message", message=_PARSE_ERROR),
+)
+
+
+def _entity(entity: Entity) -> dict[str, Any]:
+    return {
+        "id": entity.id, "kind": entity.kind, "name": entity.name, "path": entity.path,
+        "language": entity.language, "row": entity.row, "col": entity.col,
+        "end_row": entity.end_row, "end_col": entity.end_col, "parent": entity.parent,
+        "attrs": json.dumps(entity.attrs), "uid": entity.uid,
+        "start_byte": entity.start_byte, "end_byte": entity.end_byte,
+    }
+
+
+def _edge(edge: Edge) -> dict[str, Any]:
+    return {
+        "kind": edge.kind, "source": edge.source, "target": edge.target,
+        "attrs": json.dumps(edge.attrs),
+    }
+
+
+def _error(error: ParseError) -> dict[str, Any]:
+    return {
+        "path": error.path, "kind": error.kind, "message": error.message, "row": error.row,
+        "col": error.col, "end_row": error.end_row, "end_col": error.end_col,
+    }
+
+
+# ---------------------------------------------------------------------------
+# Service
+# ---------------------------------------------------------------------------
+
+
+def _params(request: dict[str, Any]) -> dict[str, Any]:
+    """An AnalyzeRequest as the parameters the HTTP API takes."""
+    return {
+        key: request[key]
+        for key in ("edges", "include", "exclude", "languages", "recursive", "gitignore")
+    }
+
+
+class _Analyzer:
+    """The methods of the Analyzer service, on decoded requests."""
+
+    def __init__(self, state: ServiceState) -> None:
+        self.state: ServiceState = state
+
+    def analyze(self, request: dict[str, Any]) -> dict[str, Any]:
+        source: str
+        result: Result
+        if request["path"]:
+            source = request["path"]
+            result = self.state.analyze_path(source, _params(request))
+        elif request["upload"]:
+            filename: str | None = request["filename"] or None
+            result = self.state.analyze_upload(
+                request["upload"], request["content_type"], filename, _params(request),
+            )
+            source = f"upload:{filename or request['content_type']}"
+        else:
+            raise RequestError(HTTPStatus.BAD_REQUEST, "expected a path or an upload")
+        return {
+            "id": self.state.store.add(source, result),
+            "files": len(result.files),
+            "entities": len(result.entities),
+            "edges": len(result.edges),
+            "errors": len(result.errors),
+            "schema_version": SCHEMA_VERSION,
+        }
+
+    def stream_analysis(self, request: dict[str, Any]) -> Iterator[dict[str, Any]]:
+        base: contextlib.AbstractContextManager[Path]
+        target: Path | None = None  # the upload's directory when None
+        if request["path"]:
+            target = resolve_under(self.state.root, request["path"])
+            base = contextlib.nullcontext(self.state.root)
+        elif request["upload"]:
+            base = self.state.unpacked(
+                request["upload"], request["content_type"], request["filename"] or None,
+            )
+        else:
+            raise RequestError(HTTPStatus.BAD_REQUEST, "expected a path or an upload")
+        with base as root, self.state.slot():
+            started: float = time.perf_counter()
+            analysis: Analysis = iter_analyze(
+                [target or root],
+                request_options(_params(request), self.state.cache),
+            )
+            files: int = 0
+            try:
+                for file_result in analysis:
+                    relocate(file_result, root)
+                    files += 1
+                    yield {"file": file_result.to_dict()}
+                    for entity in file_result.entities:
+                        yield {"entity": _entity(entity)}
+                    for error in file_result.errors:
+                        yield {"error": _error(error)}
+                for edge in analysis.edges:
+                    yield {"edge": _edge(edge)}
+            except Exception:
+                self.state.metrics.failed()
+                raise
+            self.state.metrics.finished(analysis, files, time.perf_counter() - started)
+
+    def _stored(self, request: dict[str, Any]) -> Result:
+        return self.state.store.get(request["analysis"] or None)[1]
+
+    def entities(self, request: dict[str, Any]) -> Iterator[dict[str, Any]]:
+        kinds: list[str] = request["kind"]
+        names: list[str] = request["name"]
+        for entity in self._stored(request).entities:
+            if (
+                (not kinds or entity.kind in kinds)
+                and (not names or entity.name in names)
+                and entity.path.startswith(request["path"])
+            ):
+                yield _entity(entity)
+
+    def edges(self, request: dict[str, Any]) -> Iterator[dict[str, Any]]:
+        kinds: list[str] = request["kind"]
+        for edge in self._stored(request).edges:
+            if not kinds or edge.kind in kinds:
+                yield _edge(edge)
+
+    def list_analyses(self, _request: dict[str, Any]) -> dict[str, Any]:
+        return {"analyses": self.state.store.summary()}
+
+
+def _status_code(grpc: Any, status: HTTPStatus) -> Any:
+    """The gRPC status code for an error the HTTP API would send with *status*."""
+    return {
+        HTTPStatus.BAD_REQUEST: grpc.StatusCode.INVALID_ARGUMENT,
+        HTTPStatus.FORBIDDEN: grpc.StatusCode.PERMISSION_DENIED,
+        HTTPStatus.NOT_FOUND: grpc.StatusCode.NOT_FOUND,
+        HTTPStatus.REQUEST_ENTITY_TOO_LARGE: grpc.StatusCode.RESOURCE_EXHAUSTED,
+    }.get(status, grpc.StatusCode.INTERNAL)
+
+
+def _unary(grpc: Any, method: Callable[[dict[str, Any]], dict[str, Any]]) -> Callable[..., Any]:
+    def call(request: dict[str, Any], context: Any) -> dict[str, Any]:
+        try:
+            return method(request)
+        except RequestError as exc:
+            context.abort(_status_code(grpc, exc.status), str(exc))
+        except Exception:
+            logger.exception("error handling %s", method.__name__)
+            context.abort(grpc.StatusCode.INTERNAL, "internal server error")
+        raise AssertionError("context.abort raises")
+
+    return call
+
+
+def _streaming(
+    grpc: Any, method: Callable[[dict[str, Any]], Iterator[dict[str, Any]]],
+) -> Callable[..., Iterator[dict[str, Any]]]:
+    def call(request: dict[str, Any], context: Any) -> Iterator[dict[str, Any]]:
+        try:
+            yield from method(request)
+        except RequestError as exc:
+            context.abort(_status_code(grpc, exc.status), str(exc))
+        except Exception:
+            logger.exception("error handling %s", method.__name__)
+            context.abort(grpc.StatusCode.INTERNAL, "internal server error")
+
+    return call
+
+
+def start_grpc(addr: tuple[str, int], state: ServiceState) -> Any:
+    """Start serving the Analyzer service at *addr*; returns the running ``grpc.Server``."""
+    # Import lazily, so HTTP-only use does not need grpcio.
+    import grpc
+
+    service: _Analyzer = _Analyzer(state)
+    methods: dict[str, Any] = {}
+    for name, call, request, response in (
+        ("Analyze", service.analyze, _ANALYZE_REQUEST, _ANALYZE_RESPONSE),
+        ("ListAnalyses", service.list_analyses, _LIST_ANALYSES_REQUEST, _LIST_ANALYSES_RESPONSE),
+    ):
+        methods[name] = grpc.unary_unary_rpc_method_handler(
+            _unary(grpc, call),
+            request_deserializer=functools.partial(decode, request),
+            response_serializer=functools.partial(encode, response),
+        )
+    for name, stream, request, response in (
+        ("StreamAnalysis", service.stream_analysis, _ANALYZE_REQUEST, _RECORD),
+        ("Entities", service.entities, _ENTITIES_REQUEST, _ENTITY),
+        ("Edges", service.edges, _EDGES_REQUEST, _EDGE),
+    ):
+        methods[name] = grpc.unary_stream_rpc_method_handler(
+            _streaming(grpc, stream),
+            request_deserializer=functools.partial(decode, request),
+            response_serializer=functools.partial(encode, response),
+        )
+    server: Any = grpc.server(
+        ThreadPoolExecutor(max_workers=GRPC_WORKERS),
+        # Room for an upload of max_upload bytes and the rest of its request.
+        options=[("grpc.max_receive_message_length", state.max_upload + (1 << 16))],
+    )
+    server.add_generic_rpc_handlers((grpc.method_handlers_generic_handler(SERVICE, methods),))
+    host, port = addr
+    server.add_insecure_port(f"{host or '[::]'}:{port}")
+    server.start()
+    return server
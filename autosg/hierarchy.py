@@ -0,0 +1,226 @@
+"""The containment hierarchy above files, and edges rolled up along it.
+
+Extraction nests entities within their file: a method's parent is its
+type and a top-level function's is the file entity.  ``--hierarchy``
+continues the chain upwards with entities that stand for no declaration:
+
+    repository           one per analyzed path
+    └── module           a directory with a build manifest (go.mod, package.json, ...)
+        └── package      a directory, as for ``--cluster directory``
+            └── file     its parent is the package of its directory
+
+Containers are named by their path and have no language, which tells them
+from ``package`` and ``module`` declarations extracted from files.  Each
+comes just before the first file under it, so parents are still numbered
+before their children.  A package's parent is the package
+of the directory above, or the module that directory is; the packages and
+modules at the top of an analyzed path belong to its repository.
+
+``--granularity file`` or ``package`` rolls edges up to the file or package
+of their endpoints, keeps only the entities at that level and above, and
+merges parallel edges into one.  Each merged edge has a ``count`` attr,
+the number of edges it stands for, and a ``weight`` attr per ``--aggregate``:
+
+    count                the same as ``count``
+    distinct-callers     how many different entities the edges come from
+    binary               1, for an unweighted graph
+
+Edges within one file or package, and unresolved edges, are dropped.
+"""
+
+from __future__ import annotations
+
+import bisect
+import dataclasses
+import hashlib
+import os
+import posixpath
+from collections import Counter, defaultdict
+from collections.abc import Iterable, Iterator
+from pathlib import Path
+from typing import Any
+
+from .analysis import Analysis, FileResult
+from .extracting import Edge, Entity
+from .manifests import MANIFESTS
+
+GRANULARITIES: tuple[str, ...] = ("entity", "file", "package")
+
+AGGREGATIONS: tuple[str, ...] = ("count", "distinct-callers", "binary")
+
+# Files that make their directory a module: a unit built and versioned on its own.
+MODULE_MANIFESTS: tuple[str, ...] = (*MANIFESTS, "pyproject.toml", "setup.py")
+
+
+def _directory(path: str) -> str:
+    return posixpath.dirname(path) or "."
+
+
+def _manifest(directory: str) -> str | None:
+    """The module manifest in *directory*, if it has one."""
+    for name in MODULE_MANIFESTS:
+        if (Path(directory) / name).is_file():
+            return name
+    return None
+
+
+class HierarchicalAnalysis(Analysis):
+    """*analysis* with containers above its files, its edges rolled up to *granularity*.
+
+    Without *containers*, no entities are added; ``granularity="file"``
+    still rolls edges up to files.  Rolled-up edges are weighted per
+    *aggregate*.  Entities are copied before they are renumbered, as for
+    ``--canonical``.
+    """
+
+    def __init__(
+        self, analysis: Analysis, granularity: str = "entity", containers: bool = True,
+        aggregate: str = "count",
+    ) -> None:
+        if granularity not in GRANULARITIES:
+            raise ValueError(f"unknown granularity {granularity!r}")
+        if aggregate not in AGGREGATIONS:
+            raise ValueError(f"unknown aggregation {aggregate!r}")
+        if granularity == "package" and not containers:
+            raise ValueError("package granularity needs the package entities")
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.granularity: str = granularity
+        self.containers: bool = containers
+        self.aggregate: str = aggregate
+        self._ids: dict[tuple[str, str], int] = {}  # (kind, path) -> container id
+        self._manifests: dict[str, str | None] = {}
+        self._shift: int = 0  # containers added so far
+        # Per file, in order: its first id in the wrapped analysis, and the
+        # shift of its ids, its file entity's id, and its package's id here.
+        self._firsts: list[int] = []
+        self._files: list[tuple[int, int, int | None]] = []
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            yield self.file_result(file_result)
+
+    def _root(self, file_result: FileResult) -> str:
+        """The analyzed path *file_result* was found under, as output names it."""
+        if file_result.root is not None:
+            return file_result.root
+        root: Path = self.roots[0]
+        return self.options.labels.get(root.resolve()) or Path(os.path.relpath(root)).as_posix()
+
+    def _container(
+        self, kind: str, path: str, parent: int | None, added: list[Entity], first: int,
+        attrs: dict[str, Any] | None = None,
+    ) -> int:
+        entity: Entity = Entity(
+            id=first + self._shift, kind=kind, name=path, path=path, language="",
+            row=1, col=1, end_row=1, end_col=1, parent=parent, attrs=attrs or {},
+            uid=hashlib.sha256("\x00".join([path, kind, path, "0"]).encode()).hexdigest()[:16],
+        )
+        self._shift += 1
+        self._ids[(kind, path)] = entity.id
+        added.append(entity)
+        return entity.id
+
+    def _package(self, directory: str, root: str, added: list[Entity], first: int) -> int:
+        """The id of *directory*'s package, adding it and any missing ancestors to *added*."""
+        known: int | None = self._ids.get(("package", directory))
+        if known is not None:
+            return known
+        above: str = _directory(directory)
+        parent: int
+        if directory == root or above == directory:
+            repository: int | None = self._ids.get(("repository", root))
+            parent = repository if repository is not None else self._container(
+                "repository", root, None, added, first,
+            )
+        else:
+            parent = self._package(above, root, added, first)
+        if directory not in self._manifests:
+            self._manifests[directory] = _manifest(directory)
+        manifest: str | None = self._manifests[directory]
+        if manifest is not None:
+            parent = self._container(
+                "module", directory, parent, added, first, {"manifest": manifest},
+            )
+        return self._container("package", directory, parent, added, first)
+
+    def file_result(self, file_result: FileResult) -> FileResult:
+        """*file_result* renumbered after the containers it is the first file under."""
+        if not file_result.entities:
+            return file_result
+        first: int = file_result.entities[0].id
+        added: list[Entity] = []
+        package: int | None = None
+        if self.containers:
+            root: str = self._root(file_result)
+            top: str = root if file_result.path != root else _directory(root)
+            package = self._package(_directory(file_result.path), top, added, first)
+        shift: int = self._shift
+        self._firsts.append(first)
+        self._files.append((shift, first + shift, package))
+        entities: list[Entity] = [
+            dataclasses.replace(
+                e, id=e.id + shift,
+                parent=e.parent + shift if e.parent is not None else package,
+            )
+            for e in file_result.entities
+        ]
+        if self.granularity == "file":
+            entities = entities[:1]
+        elif self.granularity == "package":
+            entities = []
+        return dataclasses.replace(file_result, entities=[*added, *entities])
+
+    def _rolled(self, entity_id: int) -> int:
+        """The id *entity_id* of the wrapped analysis has here, at this granularity."""
+        shift, file_id, package = self._files[bisect.bisect_right(self._firsts, entity_id) - 1]
+        if self.granularity == "file":
+            return file_id
+        if self.granularity == "package" and package is not None:
+            return package
+        return entity_id + shift
+
+    @property
+    def edges(self) -> Iterable[Edge]:
+        if self.granularity == "entity":
+            return (
+                dataclasses.replace(
+                    e, source=self._rolled(e.source),
+                    target=self._rolled(e.target) if e.target is not None else None,
+                )
+                for e in self.analysis.edges
+            )
+        counts: Counter[tuple[int, int, str]] = Counter()
+        callers: dict[tuple[int, int, str], set[int]] = defaultdict(set)
+        # The most certain of the edges merged, which a group edge is as certain as.
+        best: dict[tuple[int, int, str], tuple[float, str]] = {}
+        for edge in self.analysis.edges:
+            if edge.target is None:
+                continue
+            key: tuple[int, int, str] = (
+                self._rolled(edge.source), self._rolled(edge.target), edge.kind,
+            )
+            if key[0] == key[1]:
+                continue
+            counts[key] += 1
+            evidence: tuple[float, str] = (
+                edge.attrs.get("confidence", 1.0), edge.attrs.get("provenance", "exact"),
+            )
+            best[key] = max(best.get(key, evidence), evidence)
+            if self.aggregate == "distinct-callers":
+                callers[key].add(edge.source)
+        return [
+            Edge(kind, source, target, {
+                "count": count, "weight": self._weight(count, callers[(source, target, kind)]),
+                "provenance": best[(source, target, kind)][1],
+                "confidence": best[(source, target, kind)][0],
+            })
+            for (source, target, kind), count in sorted(counts.items())
+        ]
+
+    def _weight(self, count: int, callers: set[int]) -> int:
+        if self.aggregate == "distinct-callers":
+            return len(callers)
+        if self.aggregate == "binary":
+            return 1
+        return count
@@ -0,0 +1,544 @@
+"""Co-change (evolutionary coupling) analysis over git history.
+
+Each commit's diff is mapped onto the entities of the files it touched,
+as they were at that commit: every changed line is attributed to the
+innermost declaration containing it.  Two units — files, or entities —
+are coupled when they keep changing in the same commits::
+
+    coupling(a, b) = shared commits / mean(commits touching a, commits touching b)
+
+Very large commits (mass renames, reformatting) say little about coupling
+and are skipped, as are merges.  Comparing the result with the structural
+graph finds units that change together without depending on each other.
+"""
+
+from __future__ import annotations
+
+import csv
+import dataclasses
+import logging
+import os
+import re
+import sqlite3
+import subprocess
+from collections import Counter
+from collections.abc import Iterable, Iterator
+from dataclasses import dataclass, field
+from datetime import datetime, timezone
+from itertools import combinations
+from pathlib import Path
+from typing import Any, TextIO
+
+from tree_sitter import Tree
+
+from .analysis import Analysis, FileResult, Options, iter_analyze
+from .annotating import FileEncoding, source_to_utf8
+from .caching import cache_get, cache_put, content_hash
+from .extracting import Edge, Entity, extract_entities, qualified_names
+from .features import feature_digest
+from .overriding import cache_digest
+from .parsing import detect_language, parse_tree
+from .spilling import Spool
+from .walking import glob_to_regex
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+GRANULARITIES: tuple[str, ...] = ("file", "entity")
+
+# Declarations that changed lines are never attributed to.
+_UNIT_SKIPPED_KINDS: frozenset[str] = frozenset({"file", "import", "package", "use"})
+
+# (path, kind, qualified name), as in diffing
+UnitKey = tuple[str, str, str]
+
+
+class HistoryError(Exception):
+    """Raised when git history cannot be read."""
+
+
+# ---------------------------------------------------------------------------
+# Reading history
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class Commit:
+    """One commit and the lines it changed, per file."""
+
+    sha: str
+    timestamp: int
+    # path relative to the repository root -> changed line numbers in the new version
+    changes: dict[str, set[int]] = field(default_factory=dict)
+
+
+_HUNK_RE: re.Pattern[str] = re.compile(r"^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@")
+
+
+def _toplevel(cwd: Path) -> Path:
+    try:
+        proc: subprocess.CompletedProcess[str] = subprocess.run(
+            ["git", "rev-parse", "--show-toplevel"],
+            cwd=cwd, capture_output=True, text=True, check=True,
+        )
+    except FileNotFoundError:
+        raise HistoryError("git is not installed") from None
+    except subprocess.CalledProcessError as exc:
+        raise HistoryError(exc.stderr.strip() or "not a git repository") from None
+    return Path(proc.stdout.strip())
+
+
+def iter_commits(
+    paths: Iterable[str], since: str | None = None, max_commits: int | None = None,
+) -> Iterator[Commit]:
+    """Yield non-merge commits touching *paths*, newest first."""
+    args: list[str] = [
+        "git", "-c", "core.quotePath=false", "log", "--no-merges", "--format=%x00%H %at",
+        "--unified=0", "--no-color", "--no-ext-diff", "--find-renames", "--diff-filter=AMR",
+    ]
+    if since is not None:
+        args.append(f"--since={since}")
+    if max_commits is not None:
+        args.append(f"--max-count={max_commits}")
+    args.extend(["--", *paths])
+    try:
+        proc: subprocess.Popen[bytes] = subprocess.Popen(
+            args, stdout=subprocess.PIPE, stderr=subprocess.PIPE,
+        )
+    except FileNotFoundError:
+        raise HistoryError("git is not installed") from None
+    assert proc.stdout is not None
+    commit: Commit | None = None
+    current: set[int] | None = None
+    # Lines still to come in the current hunk; headers only appear between hunks.
+    old_left: int = 0
+    new_left: int = 0
+    for raw in proc.stdout:
+        line: str = raw.decode("utf-8", errors="replace").rstrip("\n")
+        if old_left or new_left:
+            if line.startswith("-"):
+                old_left -= 1
+            elif line.startswith("+"):
+                new_left -= 1
+            continue
+        if line.startswith("\0"):
+            if commit is not None:
+                yield commit
+            sha, timestamp = line[1:].split(" ", 1)
+            commit, current = Commit(sha, int(timestamp)), None
+        elif commit is None:
+            continue
+        elif line.startswith("+++ "):
+            target: str = line[4:]
+            current = None
+            if target.startswith("b/"):
+                current = commit.changes.setdefault(target[2:], set())
+        elif match := _HUNK_RE.match(line):
+            old_left = int(match.group(2)) if match.group(2) is not None else 1
+            start: int = int(match.group(3))
+            new_left = int(match.group(4)) if match.group(4) is not None else 1
+            if current is not None:
+                # A pure deletion (+n,0) touches the line it left behind.
+                current.update(range(start, start + new_left) if new_left else [max(start, 1)])
+    if commit is not None:
+        yield commit
+    stderr: bytes = proc.stderr.read() if proc.stderr is not None else b""
+    if proc.wait() != 0:
+        raise HistoryError(stderr.decode(errors="replace").strip() or "git log failed")
+
+
+class _BlobReader:
+    """File contents at any commit, through one long-lived ``git cat-file``."""
+
+    def __init__(self, toplevel: Path) -> None:
+        self._proc: subprocess.Popen[bytes] = subprocess.Popen(
+            ["git", "cat-file", "--batch"], cwd=toplevel,
+            stdin=subprocess.PIPE, stdout=subprocess.PIPE,
+        )
+
+    def read(self, sha: str, path: str) -> bytes | None:
+        assert self._proc.stdin is not None and self._proc.stdout is not None
+        self._proc.stdin.write(f"{sha}:{path}\n".encode())
+        self._proc.stdin.flush()
+        header: list[bytes] = self._proc.stdout.readline().split()
+        if len(header) != 3 or header[1] != b"blob":
+            return None  # "<object> missing", or a submodule
+        data: bytes = self._proc.stdout.read(int(header[2]))
+        self._proc.stdout.read(1)  # trailing newline
+        return data
+
+    def close(self) -> None:
+        if self._proc.stdin is not None:
+            self._proc.stdin.close()
+        self._proc.wait()
+
+
+# ---------------------------------------------------------------------------
+# Co-change
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class HistoryOptions:
+    """Settings for :func:`cochange`."""
+
+    granularity: str = "file"  # "file" or "entity"
+    since: str | None = None  # anything ``git log --since`` accepts
+    max_commits: int | None = 1000
+    max_changeset: int = 30  # skip commits touching more units than this
+    min_support: int = 2  # minimum shared commits for a pair to be reported
+    include: tuple[str, ...] = ()
+    exclude: tuple[str, ...] = ()
+    languages: frozenset[str] = frozenset()
+
+
+@dataclass
+class CoChange:
+    """Co-change edges and the commit counts behind them."""
+
+    commits: int  # commits that contributed
+    revisions: dict[UnitKey, int]  # commits touching each unit
+    edges: list[tuple[UnitKey, UnitKey, int]]  # (a, b, shared commits), a < b
+
+    def coupling(self, a: UnitKey, b: UnitKey, support: int) -> float:
+        return support / ((self.revisions[a] + self.revisions[b]) / 2)
+
+    def edge_dicts(self) -> list[dict[str, Any]]:
+        def unit(key: UnitKey) -> dict[str, str]:
+            return {"path": key[0], "kind": key[1], "name": key[2]}
+
+        return [
+            {
+                "kind": "cochanges",
+                "source": unit(a),
+                "target": unit(b),
+                "attrs": {
+                    "support": support,
+                    "coupling": round(self.coupling(a, b, support), 3),
+                    "revisions": [self.revisions[a], self.revisions[b]],
+                },
+            }
+            for a, b, support in self.edges
+        ]
+
+
+def _entities_at(
+    blobs: _BlobReader, sha: str, path: str, language: str, cache: sqlite3.Connection | None,
+) -> list[Entity] | None:
+    raw: bytes | None = blobs.read(sha, path)
+    if raw is None:
+        return None
+    source: tuple[bytes, FileEncoding] | None = source_to_utf8(raw)
+    if source is None:
+        return None
+    # Entries hold only entities, without the directives and embedded languages
+    # analysis adds, so they are keyed apart from analysis results; like them,
+    # they change with the query and the features.
+    digest: str = feature_digest(
+        cache_digest(f"history:{content_hash(source[0])}", language), language,
+    )
+    if cache is not None:
+        cached: dict[str, Any] | None = cache_get(cache, digest, language)
+        if cached is not None:
+            return [Entity(**e) for e in cached["entities"]]
+    tree: Tree = parse_tree(source[0], language)
+    entities, _references, _next_id = extract_entities(source[0], language, path, 0, tree)
+    if cache is not None:
+        cache_put(cache, digest, language, {"entities": [dataclasses.asdict(e) for e in entities]})
+    return entities
+
+
+def _attribute(entities: list[Entity], lines: set[int]) -> set[int]:
+    """Ids of the innermost declarations containing each changed line."""
+    candidates: list[Entity] = [e for e in entities if e.kind not in _UNIT_SKIPPED_KINDS]
+    touched: set[int] = set()
+    for line in lines:
+        best: Entity | None = None
+        for entity in candidates:
+            last_row: int = entity.end_row if entity.end_col > 1 else entity.end_row - 1
+            if entity.row <= line <= last_row and (best is None or entity.row >= best.row):
+                best = entity
+        if best is not None:
+            touched.add(best.id)
+    return touched
+
+
+def _commit_units(
+    paths: Iterable[str], options: HistoryOptions, cache: sqlite3.Connection | None,
+    enclosing: bool = False,
+) -> Iterator[set[UnitKey]]:
+    """The units each commit touching *paths* changed, newest first.
+
+    With *enclosing*, a changed line counts for every entity containing it,
+    the file included, not only the innermost declaration.
+    """
+    paths = list(paths) or ["."]
+    cwd: Path = Path.cwd()
+    toplevel: Path = _toplevel(cwd)
+    include = [glob_to_regex(p) for p in options.include]
+    exclude = [glob_to_regex(p) for p in options.exclude]
+    blobs: _BlobReader | None = (
+        _BlobReader(toplevel) if options.granularity == "entity" else None
+    )
+    try:
+        for commit in iter_commits(paths, options.since, options.max_commits):
+            units: set[UnitKey] = set()
+            for path, lines in commit.changes.items():
+                rel_path: str = Path(os.path.relpath(toplevel / path, cwd)).as_posix()
+                language: str | None = detect_language(Path(path))
+                if language is None or (options.languages and language not in options.languages):
+                    continue
+                if include and not any(p.match(rel_path) for p in include):
+                    continue
+                if any(p.match(rel_path) for p in exclude):
+                    continue
+                if blobs is None:
+                    units.add((rel_path, "file", rel_path))
+                    continue
+                entities: list[Entity] | None = _entities_at(
+                    blobs, commit.sha, path, language, cache,
+                )
+                if entities is None:
+                    continue
+                names: dict[int, str] = qualified_names(entities)
+                by_id: dict[int, Entity] = {e.id: e for e in entities}
+                for entity_id in _attribute(entities, lines):
+                    current: int | None = entity_id
+                    while current is not None and by_id[current].kind != "file":
+                        units.add((rel_path, by_id[current].kind, names[current]))
+                        current = by_id[current].parent if enclosing else None
+                if enclosing and lines:
+                    units.add((rel_path, "file", rel_path))
+            yield units
+    finally:
+        if blobs is not None:
+            blobs.close()
+
+
+def cochange(
+    paths: Iterable[str], options: HistoryOptions, cache: sqlite3.Connection | None = None,
+) -> CoChange:
+    """Mine co-changing units from the history of *paths*.
+
+    Unit paths are relative to the working directory, like analysis paths.
+    """
+    revisions: Counter[UnitKey] = Counter()
+    pairs: Counter[tuple[UnitKey, UnitKey]] = Counter()
+    commits: int = 0
+    for units in _commit_units(paths, options, cache):
+        if not units or len(units) > options.max_changeset:
+            continue
+        commits += 1
+        revisions.update(units)
+        pairs.update(combinations(sorted(units), 2))
+    edges: list[tuple[UnitKey, UnitKey, int]] = [
+        (a, b, support) for (a, b), support in pairs.items() if support >= options.min_support
+    ]
+    result: CoChange = CoChange(commits, dict(revisions), edges)
+    result.edges.sort(key=lambda e: (-e[2], -result.coupling(e[0], e[1], e[2]), e[0], e[1]))
+    return result
+
+
+# ---------------------------------------------------------------------------
+# Blame
+# ---------------------------------------------------------------------------
+
+# The blame attrs, in the order CSV output lists them.
+BLAME_ATTRS: tuple[str, ...] = (
+    "last_modified", "last_author", "last_commit", "authors", "changes", "uncommitted",
+)
+
+# What git blame reports for lines not committed yet.
+_UNCOMMITTED_SHA: str = "0" * 40
+
+
+@dataclass(frozen=True)
+class Revision:
+    """The commit a line last changed in, as ``git blame`` reports it."""
+
+    sha: str
+    author: str
+    email: str
+    timestamp: int
+
+
+def blame_lines(path: str) -> list[Revision] | None:
+    """The revision of each line of *path* in the working tree, or None if git has no history.
+
+    Lines not committed yet are attributed to a revision with an all-zero sha.
+    """
+    try:
+        proc: subprocess.CompletedProcess[bytes] = subprocess.run(
+            ["git", "blame", "--porcelain", "--", os.path.basename(path)],
+            cwd=os.path.dirname(path) or ".", capture_output=True, check=True,
+        )
+    except FileNotFoundError:
+        raise HistoryError("git is not installed") from None
+    except subprocess.CalledProcessError:
+        return None  # untracked, or outside a repository
+    revisions: list[Revision] = []
+    # Porcelain output gives a commit's details only the first time it appears.
+    details: dict[str, dict[str, str]] = {}
+    sha: str = ""
+    for raw in proc.stdout.splitlines():
+        if raw.startswith(b"\t"):
+            info: dict[str, str] = details[sha]
+            revisions.append(Revision(
+                sha, info.get("author", ""), info.get("author-mail", "").strip("<>"),
+                int(info.get("author-time", "0")),
+            ))
+            continue
+        line: str = raw.decode("utf-8", errors="replace")
+        key, _, value = line.partition(" ")
+        if len(key) == 40 and all(c in "0123456789abcdef" for c in key):
+            sha = key
+            details.setdefault(sha, {})
+        else:
+            details[sha][key] = value
+    return revisions
+
+
+def change_counts(
+    paths: Iterable[str], options: HistoryOptions, cache: sqlite3.Connection | None = None,
+) -> Counter[UnitKey]:
+    """How many commits changed any line of each entity of *paths*, the file included.
+
+    Unlike co-change, large commits count.
+    """
+    counts: Counter[UnitKey] = Counter()
+    entity_options: HistoryOptions = dataclasses.replace(options, granularity="entity")
+    for units in _commit_units(paths, entity_options, cache, enclosing=True):
+        counts.update(units)
+    return counts
+
+
+def blame_attrs(
+    entity: Entity, lines: list[Revision], changes: int | None = None,
+) -> dict[str, Any]:
+    """The blame attrs of *entity*, from the revisions of its file's lines.
+
+    ``last_modified`` (ISO 8601, UTC), ``last_author``, and ``last_commit``
+    come from the newest committed line in the entity, and ``authors`` counts
+    the people behind its committed lines, by email.  ``uncommitted`` is set
+    when some of its lines are not committed yet, and ``changes`` is *changes*.
+    """
+    last_row: int = entity.end_row if entity.end_col > 1 else entity.end_row - 1
+    spanned: list[Revision] = lines[entity.row - 1 : max(last_row, entity.row)]
+    committed: list[Revision] = [r for r in spanned if r.sha != _UNCOMMITTED_SHA]
+    attrs: dict[str, Any] = {}
+    if committed:
+        newest: Revision = max(committed, key=lambda r: r.timestamp)
+        attrs["last_modified"] = datetime.fromtimestamp(
+            newest.timestamp, timezone.utc,
+        ).strftime("%Y-%m-%dT%H:%M:%SZ")
+        attrs["last_author"] = newest.author
+        attrs["last_commit"] = newest.sha
+        attrs["authors"] = len({r.email for r in committed})
+    if len(committed) < len(spanned):
+        attrs["uncommitted"] = True
+    if changes is not None:
+        attrs["changes"] = changes
+    return attrs
+
+
+class BlamedAnalysis(Analysis):
+    """*analysis*, with the blame attrs of every entity set as files are read.
+
+    *changes* are commit counts from change_counts; without them, entities
+    get no ``changes`` attr.  Files git has no history for are passed
+    through unchanged.
+    """
+
+    def __init__(self, analysis: Analysis, changes: Counter[UnitKey] | None = None) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.changes: Counter[UnitKey] | None = changes
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            lines: list[Revision] | None = blame_lines(file_result.path)
+            if lines is None:
+                logger.warning("%s has no git history, skipping its blame.", file_result.path)
+                yield file_result
+                continue
+            rel_path: str = Path(file_result.path).as_posix()
+            names: dict[int, str] = qualified_names(file_result.entities)
+            names[file_result.entities[0].id] = rel_path
+            for entity in file_result.entities:
+                changes: int | None = None
+                if self.changes is not None:
+                    changes = self.changes.get((rel_path, entity.kind, names[entity.id]), 0)
+                entity.attrs.update(blame_attrs(entity, lines, changes))
+            yield file_result
+
+    @property
+    def edges(self) -> Spool[Edge]:
+        return self.analysis.edges
+
+
+def structural_pairs(
+    paths: Iterable[str], granularity: str, options: Options | None = None,
+) -> set[frozenset[UnitKey]]:
+    """Unit pairs joined by a call or import edge in the current tree."""
+    options = dataclasses.replace(
+        options or Options(), edges=frozenset({"calls", "imports"}),
+    )
+    analysis: Analysis = iter_analyze(list(paths) or ["."], options)
+    keys: dict[int, UnitKey] = {}
+    for file_result in analysis:
+        rel_path: str = Path(file_result.path).as_posix()
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            if granularity == "file":
+                keys[entity.id] = (rel_path, "file", rel_path)
+            else:
+                keys[entity.id] = (rel_path, entity.kind, names[entity.id])
+    return {
+        frozenset((keys[e.source], keys[e.target]))
+        for e in analysis.edges
+        if e.target is not None and e.source in keys and e.target in keys
+    }
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+
+def write_csv(result: CoChange, out: TextIO) -> None:
+    """One row per co-changing pair, strongest first."""
+    writer = csv.writer(out, lineterminator="\n")
+    writer.writerow([
+        "source_path", "source_kind", "source_name", "target_path", "target_kind",
+        "target_name", "support", "coupling",
+    ])
+    for a, b, support in result.edges:
+        writer.writerow([*a, *b, support, f"{result.coupling(a, b, support):.3f}"])
+
+
+
+def write_blame_csv(analysis: Analysis, out: TextIO) -> None:
+    """One row per entity with its blame attrs, and how many entities depend on it.
+
+    ``dependents`` counts the distinct sources of resolved edges into the
+    entity, so it is 0 unless edges were requested.
+    """
+    rows: list[list[Any]] = []
+    ids: list[int] = []
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            if entity.kind in _UNIT_SKIPPED_KINDS - {"file"}:
+                continue
+            ids.append(entity.id)
+            rows.append([
+                Path(entity.path).as_posix(), entity.kind, names[entity.id], entity.row,
+                *(entity.attrs.get(a, "") for a in BLAME_ATTRS),
+            ])
+    dependents: dict[int, set[int]] = {}
+    for edge in analysis.edges:
+        if edge.target is not None and edge.source != edge.target:
+            dependents.setdefault(edge.target, set()).add(edge.source)
+    writer = csv.writer(out, lineterminator="\n")
+    writer.writerow(["path", "kind", "name", "row", *BLAME_ATTRS, "dependents"])
+    for entity_id, row in zip(ids, rows):
+        writer.writerow([*row, len(dependents.get(entity_id, ()))])
@@ -0,0 +1,753 @@
+"""Interface definition files: Protocol Buffers, Thrift, and GraphQL schemas.
+
+No tree-sitter grammar ships for these, so they are read by a small
+parser of their own.  Each definition becomes an entity:
+
+- protobuf: ``package``, ``import``, ``message``, ``enum``, ``service``,
+  and ``rpc`` (with ``request`` and ``response`` types, and
+  ``client_streaming`` or ``server_streaming`` when set)
+- thrift: ``import`` (``include``), ``struct``, ``union``, ``exception``,
+  ``enum``, ``type`` (``typedef``), ``service`` (with ``extends``), and
+  ``rpc`` (with ``parameters``, ``response``, and ``oneway``)
+- graphql: ``type``, ``interface``, ``input``, ``enum``, ``union``,
+  ``scalar``, ``operation`` (fields of the query, mutation, and subscription
+  types, and named operations), and ``fragment``
+
+Messages, structs, and types record their ``fields``; enums their
+``values``.  Definitions are linked to the code generated from them by
+``generates`` edges (see generated_names).
+"""
+
+from __future__ import annotations
+
+import bisect
+import re
+from dataclasses import dataclass, field
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from .extracting import Entity, ParseError, assign_uids, file_entity
+from .parsing import byte_col_to_char_col
+
+IDL_EXTENSIONS: dict[str, str] = {
+    ".gql": "graphql",
+    ".graphql": "graphql",
+    ".graphqls": "graphql",
+    ".proto": "protobuf",
+    ".thrift": "thrift",
+}
+
+IDL_LANGUAGES: frozenset[str] = frozenset(IDL_EXTENSIONS.values())
+
+def idl_language(path: Path) -> str | None:
+    return IDL_EXTENSIONS.get(path.suffix)
+
+
+# ---------------------------------------------------------------------------
+# Tokens
+# ---------------------------------------------------------------------------
+
+# A stray non-ASCII character is one punct token, not one per UTF-8 byte.
+_TOKEN_RE: re.Pattern[bytes] = re.compile(rb"""
+    (?P<space>\s+)
+  | (?P<comment>//[^\n]*|\#[^\n]*|/\*.*?(?:\*/|\Z))
+  | (?P<block>\"\"\"(?:[^"\\]|\\.|"(?!""))*(?:\"\"\"|\Z))
+  | (?P<string>"(?:[^"\\\n]|\\.)*"?|'(?:[^'\\\n]|\\.)*'?)
+  | (?P<word>[A-Za-z_][\w.]*)
+  | (?P<number>[-+]?\d[\w.+-]*)
+  | (?P<punct>\.\.\.|[\xc0-\xf7][\x80-\xbf]*|.)
+""", re.VERBOSE | re.DOTALL)
+
+
+@dataclass(frozen=True)
+class _Token:
+    kind: str  # "word", "string", "block", "number", or "punct"
+    text: str
+    start: int  # byte offsets into the file
+    end: int
+
+
+def _tokens(source_utf8: bytes) -> list[_Token]:
+    tokens: list[_Token] = []
+    for match in _TOKEN_RE.finditer(source_utf8):
+        kind: str = match.lastgroup or "punct"
+        if kind not in ("space", "comment"):
+            tokens.append(_Token(
+                kind, match.group().decode("utf-8", errors="replace"), match.start(), match.end(),
+            ))
+    return tokens
+
+
+class _SyntaxError(Exception):
+    def __init__(self, message: str, token: _Token | None) -> None:
+        super().__init__(message)
+        self.token: _Token | None = token
+
+
+# ---------------------------------------------------------------------------
+# Parser
+# ---------------------------------------------------------------------------
+
+
+class _Parser:
+    """Shared token handling and entity building for the three languages."""
+
+    def __init__(self, source_utf8: bytes, language: str, path: str) -> None:
+        self.source: bytes = source_utf8
+        self.language: str = language
+        self.path: str = path
+        self.tokens: list[_Token] = _tokens(source_utf8)
+        self.i: int = 0
+        self.line_starts: list[int] = [0] + [
+            m.end() for m in re.finditer(rb"\n", source_utf8)
+        ]
+        self.entities: list[Entity] = [file_entity(source_utf8, language, path, 0)]
+
+    # -- tokens --------------------------------------------------------------
+
+    def peek(self, ahead: int = 0) -> _Token | None:
+        index: int = self.i + ahead
+        return self.tokens[index] if index < len(self.tokens) else None
+
+    def at(self, *texts: str) -> bool:
+        token: _Token | None = self.peek()
+        return token is not None and token.text in texts
+
+    def at_kind(self, kind: str) -> bool:
+        token: _Token | None = self.peek()
+        return token is not None and token.kind == kind
+
+    def next(self) -> _Token:
+        token: _Token | None = self.peek()
+        if token is None:
+            last: _Token | None = self.tokens[-1] if self.tokens else None
+            raise _SyntaxError("unexpected end of file", last)
+        self.i += 1
+        return token
+
+    def accept(self, *texts: str) -> _Token | None:
+        return self.next() if self.at(*texts) else None
+
+    def expect(self, text: str) -> _Token:
+        token: _Token = self.next()
+        if token.text != text:
+            raise _SyntaxError(f"expected {text!r}, found {token.text!r}", token)
+        return token
+
+    def name(self) -> _Token:
+        token: _Token = self.next()
+        if token.kind != "word":
+            raise _SyntaxError(f"expected a name, found {token.text!r}", token)
+        return token
+
+    def skip_balanced(self) -> _Token:
+        """Skip a bracketed group starting at the current token; returns its last token."""
+        pairs: dict[str, str] = {"{": "}", "(": ")", "[": "]", "<": ">"}
+        stack: list[str] = [pairs[self.next().text]]
+        while True:
+            token: _Token = self.next()
+            if token.text in pairs:
+                stack.append(pairs[token.text])
+            elif token.text == stack[-1]:
+                stack.pop()
+                if not stack:
+                    return token
+
+    def skip_statement(self) -> _Token:
+        """Skip to the end of a ``;``-terminated statement, over bracketed groups."""
+        while True:
+            if self.at("{", "(", "["):
+                last: _Token = self.skip_balanced()
+                if not self.at(";"):
+                    if self.peek() is None or self.at("}"):
+                        return last
+                    continue
+            token: _Token = self.next()
+            if token.text == ";":
+                return token
+
+    def type_text(self) -> str:
+        """A type name, with generic arguments (``map<string, Foo>``) and list brackets."""
+        if self.at("["):  # GraphQL [Type!]
+            start: int = self.peek().start  # type: ignore[union-attr]
+            end: int = self.skip_balanced().end
+        else:
+            first: _Token = self.name()
+            start, end = first.start, first.end
+            if self.at("<"):
+                end = self.skip_balanced().end
+        if self.at("!"):
+            end = self.next().end
+        return " ".join(self.source[start:end].decode("utf-8", errors="replace").split())
+
+    # -- entities ------------------------------------------------------------
+
+    def position(self, offset: int) -> tuple[int, int]:
+        row: int = bisect.bisect_right(self.line_starts, offset) - 1
+        line: bytes = self.source[self.line_starts[row] : offset]
+        return row + 1, byte_col_to_char_col(line, len(line) + 1)
+
+    def entity(
+        self, kind: str, name: str, start: _Token, end: _Token, parent: int,
+        attrs: dict[str, Any] | None = None,
+    ) -> Entity:
+        row, col = self.position(start.start)
+        end_row, end_col = self.position(end.end)
+        entity: Entity = Entity(
+            id=len(self.entities), kind=kind, name=name, path=self.path, language=self.language,
+            row=row, col=col, end_row=end_row, end_col=end_col, parent=parent,
+            attrs=attrs if attrs is not None else {}, start_byte=start.start, end_byte=end.end,
+        )
+        self.entities.append(entity)
+        return entity
+
+    def placeholder(self, kind: str, name: str, start: _Token, parent: int) -> Entity:
+        """An entity whose end is set once its body is read (see close)."""
+        return self.entity(kind, name, start, start, parent)
+
+    def close(self, entity: Entity, end: _Token) -> None:
+        entity.end_row, entity.end_col = self.position(end.end)
+        entity.end_byte = end.end
+
+
+def _unquote(text: str) -> str:
+    return text[1:-1] if len(text) >= 2 and text[0] == text[-1] and text[0] in "\"'" else text
+
+
+# ---------------------------------------------------------------------------
+# Protocol Buffers
+# ---------------------------------------------------------------------------
+
+
+def _proto_file(p: _Parser) -> None:
+    while p.peek() is not None:
+        token: _Token = p.peek()  # type: ignore[assignment]
+        if token.text == "package":
+            p.next()
+            name: _Token = p.name()
+            p.entity("package", name.text, token, p.expect(";"), 0)
+        elif token.text == "import":
+            p.next()
+            p.accept("public", "weak")
+            target: _Token = p.next()
+            p.entity("import", _unquote(target.text), token, p.expect(";"), 0)
+        elif token.text in ("message", "enum", "service"):
+            _proto_definition(p, 0)
+        elif token.text == "extend":
+            p.next()
+            p.type_text()
+            p.skip_balanced()
+        elif token.text == ";":
+            p.next()
+        else:  # syntax, edition, option
+            p.skip_statement()
+
+
+def _proto_definition(p: _Parser, parent: int) -> None:
+    keyword: _Token = p.next()
+    name: str = p.name().text
+    if keyword.text == "message":
+        message: Entity = p.placeholder("message", name, keyword, parent)
+        fields: list[dict[str, Any]] = []
+        p.expect("{")
+        _proto_body(p, message.id, fields)
+        p.close(message, p.expect("}"))
+        message.attrs["fields"] = fields
+    elif keyword.text == "enum":
+        enum: Entity = p.placeholder("enum", name, keyword, parent)
+        values: list[str] = []
+        p.expect("{")
+        while not p.at("}"):
+            if p.at("option", "reserved"):
+                p.skip_statement()
+                continue
+            value: _Token = p.name()
+            values.append(value.text)
+            p.skip_statement()
+        p.close(enum, p.expect("}"))
+        enum.attrs["values"] = values
+    else:
+        service: Entity = p.placeholder("service", name, keyword, parent)
+        p.expect("{")
+        while not p.at("}"):
+            if not p.at("rpc"):
+                p.skip_statement()
+                continue
+            rpc_start: _Token = p.next()
+            rpc_name: str = p.name().text
+            attrs: dict[str, Any] = {}
+            p.expect("(")
+            if p.accept("stream"):
+                attrs["client_streaming"] = True
+            attrs["request"] = p.type_text()
+            p.expect(")")
+            p.expect("returns")
+            p.expect("(")
+            if p.accept("stream"):
+                attrs["server_streaming"] = True
+            attrs["response"] = p.type_text()
+            end: _Token = p.expect(")")
+            if p.at("{"):
+                end = p.skip_balanced()
+            if p.at(";"):
+                end = p.next()
+            p.entity("rpc", rpc_name, rpc_start, end, service.id, attrs)
+        p.close(service, p.expect("}"))
+
+
+def _proto_body(
+    p: _Parser, parent: int, fields: list[dict[str, Any]], oneof: str | None = None,
+) -> None:
+    """The fields and nested definitions of a message, up to its closing brace."""
+    while not p.at("}"):
+        if p.at("message", "enum"):
+            _proto_definition(p, parent)
+        elif p.at("oneof"):
+            p.next()
+            group: str = p.name().text
+            p.expect("{")
+            _proto_body(p, parent, fields, group)
+            p.expect("}")
+        elif p.at("option", "reserved", "extensions", ";"):
+            p.skip_statement()
+        elif p.at("extend"):
+            p.next()
+            p.type_text()
+            p.skip_balanced()
+        else:
+            label: _Token | None = p.accept("repeated", "optional", "required")
+            field_type: str = p.type_text()
+            field_name: str = p.name().text
+            p.expect("=")
+            number: _Token = p.next()
+            if number.kind != "number":
+                raise _SyntaxError(f"expected a field number, found {number.text!r}", number)
+            entry: dict[str, Any] = {"name": field_name, "type": field_type}
+            if number.text.isdigit():
+                entry["number"] = int(number.text)
+            if label is not None and label.text != "optional":
+                entry["label"] = label.text
+            if oneof is not None:
+                entry["oneof"] = oneof
+            fields.append(entry)
+            p.skip_statement()
+
+
+# ---------------------------------------------------------------------------
+# Thrift
+# ---------------------------------------------------------------------------
+
+
+def _thrift_separator(p: _Parser) -> _Token | None:
+    return p.accept(",", ";")
+
+
+def _thrift_annotations(p: _Parser) -> None:
+    if p.at("("):
+        p.skip_balanced()
+
+
+def _thrift_value(p: _Parser) -> _Token:
+    return p.skip_balanced() if p.at("{", "[") else p.next()
+
+
+def _thrift_fields(p: _Parser, close: str) -> list[dict[str, Any]]:
+    """Fields up to *close* (``}`` or ``)``), which is left unread."""
+    fields: list[dict[str, Any]] = []
+    while not p.at(close):
+        entry: dict[str, Any] = {}
+        if p.at_kind("number"):
+            number: str = p.next().text
+            p.expect(":")
+            if number.lstrip("-").isdigit():
+                entry["number"] = int(number)
+        requiredness: _Token | None = p.accept("required", "optional")
+        entry["type"] = p.type_text()
+        entry = {"name": p.name().text, **entry}
+        if requiredness is not None and requiredness.text == "required":
+            entry["label"] = "required"
+        if p.accept("="):
+            _thrift_value(p)
+        _thrift_annotations(p)
+        _thrift_separator(p)
+        fields.append(entry)
+    return fields
+
+
+def _thrift_file(p: _Parser) -> None:
+    namespaces: dict[str, str] = {}
+    while p.peek() is not None:
+        token: _Token = p.next()
+        if token.text in ("include", "cpp_include"):
+            target: _Token = p.next()
+            if token.text == "include":
+                p.entity("import", _unquote(target.text), token, target, 0)
+        elif token.text == "namespace":
+            scope: str = p.next().text
+            namespaces[scope] = p.name().text
+        elif token.text == "typedef":
+            aliased: str = p.type_text()
+            name: _Token = p.name()
+            _thrift_annotations(p)
+            p.entity("type", name.text, token, name, 0, {"aliased": aliased})
+        elif token.text == "const":
+            p.type_text()
+            p.name()
+            p.expect("=")
+            _thrift_value(p)
+        elif token.text in ("struct", "union", "exception"):
+            name = p.name()
+            entity: Entity = p.placeholder(token.text, name.text, token, 0)
+            p.expect("{")
+            entity.attrs["fields"] = _thrift_fields(p, "}")
+            p.close(entity, p.expect("}"))
+            _thrift_annotations(p)
+        elif token.text in ("enum", "senum"):
+            name = p.name()
+            enum: Entity = p.placeholder("enum", name.text, token, 0)
+            p.expect("{")
+            values: list[str] = []
+            while not p.at("}"):
+                value: _Token = p.next()
+                values.append(_unquote(value.text))
+                if p.accept("="):
+                    p.next()
+                _thrift_annotations(p)
+                _thrift_separator(p)
+            p.close(enum, p.expect("}"))
+            enum.attrs["values"] = values
+            _thrift_annotations(p)
+        elif token.text == "service":
+            _thrift_service(p, token)
+        elif token.kind != "punct":
+            raise _SyntaxError(f"unexpected {token.text!r}", token)
+    if namespaces:
+        p.entities[0].attrs["namespaces"] = namespaces
+
+
+def _thrift_service(p: _Parser, keyword: _Token) -> None:
+    name: _Token = p.name()
+    service: Entity = p.placeholder("service", name.text, keyword, 0)
+    if p.accept("extends"):
+        service.attrs["extends"] = p.name().text
+    p.expect("{")
+    while not p.at("}"):
+        start: _Token = p.peek()  # type: ignore[assignment]
+        attrs: dict[str, Any] = {}
+        if p.accept("oneway"):
+            attrs["oneway"] = True
+        response: str = p.type_text()
+        rpc_name: str = p.name().text
+        p.expect("(")
+        attrs["parameters"] = _thrift_fields(p, ")")
+        end: _Token = p.expect(")")
+        attrs["response"] = response
+        if p.accept("throws"):
+            p.expect("(")
+            attrs["throws"] = [f["type"] for f in _thrift_fields(p, ")")]
+            end = p.expect(")")
+        _thrift_annotations(p)
+        end = _thrift_separator(p) or end
+        p.entity("rpc", rpc_name, start, end, service.id, attrs)
+    p.close(service, p.expect("}"))
+
+
+# ---------------------------------------------------------------------------
+# GraphQL
+# ---------------------------------------------------------------------------
+
+_GRAPHQL_TYPE_KINDS: dict[str, str] = {
+    "type": "type", "interface": "interface", "input": "input", "enum": "enum",
+    "union": "union", "scalar": "scalar",
+}
+
+# Operation types and the root type names they have unless a schema says otherwise.
+_GRAPHQL_ROOTS: dict[str, str] = {
+    "Query": "query", "Mutation": "mutation", "Subscription": "subscription",
+}
+
+
+def _graphql_description(p: _Parser) -> None:
+    while p.at_kind("string") or p.at_kind("block"):
+        p.next()
+
+
+def _graphql_directives(p: _Parser) -> None:
+    while p.accept("@"):
+        p.name()
+        if p.at("("):
+            p.skip_balanced()
+
+
+def _graphql_file(p: _Parser) -> None:
+    roots: dict[str, str] = dict(_GRAPHQL_ROOTS)
+    deferred: list[tuple[Entity, list[tuple[_Token, str, str, list[str], _Token]]]] = []
+    while p.peek() is not None:
+        _graphql_description(p)
+        if p.peek() is None:
+            break
+        start: _Token = p.next()
+        extension: bool = start.text == "extend"
+        keyword: _Token = p.next() if extension else start
+        if keyword.text == "schema":
+            _graphql_directives(p)
+            p.expect("{")
+            roots = {}
+            while not p.at("}"):
+                operation: str = p.name().text
+                p.expect(":")
+                roots[p.name().text] = operation
+            p.expect("}")
+        elif keyword.text in _GRAPHQL_TYPE_KINDS:
+            name: _Token = p.name()
+            entity: Entity = p.placeholder(_GRAPHQL_TYPE_KINDS[keyword.text], name.text, start, 0)
+            if extension:
+                entity.attrs["extension"] = True
+            end: _Token = name
+            if p.accept("implements"):
+                p.accept("&")
+                interfaces: list[str] = [p.name().text]
+                # Older schemas separate interfaces with spaces.
+                while p.accept("&") or p.at_kind("word"):
+                    interfaces.append(p.name().text)
+                entity.attrs["implements"] = interfaces
+            _graphql_directives(p)
+            if keyword.text == "union" and p.accept("="):
+                p.accept("|")
+                members: list[str] = [p.name().text]
+                while p.accept("|"):
+                    members.append(p.name().text)
+                entity.attrs["members"] = members
+                end = p.tokens[p.i - 1]
+            elif p.at("{"):
+                p.next()
+                if keyword.text == "enum":
+                    values: list[str] = []
+                    while not p.at("}"):
+                        _graphql_description(p)
+                        values.append(p.name().text)
+                        _graphql_directives(p)
+                    entity.attrs["values"] = values
+                else:
+                    fields: list[tuple[_Token, str, str, list[str], _Token]] = _graphql_fields(p)
+                    entity.attrs["fields"] = [{"name": f[1], "type": f[2]} for f in fields]
+                    deferred.append((entity, fields))
+                end = p.expect("}")
+            p.close(entity, end)
+        elif keyword.text == "directive":
+            p.expect("@")
+            p.name()
+            if p.at("("):
+                p.skip_balanced()
+            p.accept("repeatable")
+            p.expect("on")
+            p.accept("|")
+            p.name()
+            while p.accept("|"):
+                p.name()
+        elif keyword.text in ("query", "mutation", "subscription", "fragment"):
+            _graphql_executable(p, keyword)
+        elif keyword.text == "{":  # an anonymous query
+            p.i -= 1
+            p.skip_balanced()
+        else:
+            raise _SyntaxError(f"unexpected {keyword.text!r}", keyword)
+    # Fields of the root types are the operations a client can call.
+    for entity, fields in deferred:
+        operation_type: str | None = roots.get(entity.name)
+        if entity.kind != "type" or operation_type is None:
+            continue
+        for field_start, field_name, field_type, arguments, field_end in fields:
+            attrs: dict[str, Any] = {"operation": operation_type, "response": field_type}
+            if arguments:
+                attrs["arguments"] = arguments
+            p.entity("operation", field_name, field_start, field_end, entity.id, attrs)
+
+
+def _graphql_fields(p: _Parser) -> list[tuple[_Token, str, str, list[str], _Token]]:
+    """(first token, name, type, argument names, last token) of each field up to ``}``."""
+    fields: list[tuple[_Token, str, str, list[str], _Token]] = []
+    while not p.at("}"):
+        _graphql_description(p)
+        name: _Token = p.name()
+        arguments: list[str] = []
+        if p.accept("("):
+            while not p.at(")"):
+                _graphql_description(p)
+                arguments.append(p.name().text)
+                p.expect(":")
+                p.type_text()
+                if p.accept("="):
+                    p.skip_balanced() if p.at("{", "[") else p.next()
+                _graphql_directives(p)
+                p.accept(",")
+            p.expect(")")
+        p.expect(":")
+        field_type: str = p.type_text()
+        end: _Token = p.tokens[p.i - 1]
+        if p.accept("="):  # input field default
+            end = p.skip_balanced() if p.at("{", "[") else p.next()
+        _graphql_directives(p)
+        p.accept(",")
+        fields.append((name, name.text, field_type, arguments, end))
+    return fields
+
+
+def _graphql_executable(p: _Parser, keyword: _Token) -> None:
+    """A named operation or fragment in a client document; anonymous ones are skipped."""
+    name: _Token | None = p.name() if p.at_kind("word") else None
+    attrs: dict[str, Any] = {}
+    if keyword.text == "fragment":
+        p.expect("on")
+        attrs["on"] = p.name().text
+    else:
+        attrs["operation"] = keyword.text
+    if p.at("("):
+        p.skip_balanced()
+    _graphql_directives(p)
+    end: _Token = p.skip_balanced()
+    if name is not None:
+        kind: str = "fragment" if keyword.text == "fragment" else "operation"
+        p.entity(kind, name.text, keyword, end, 0, attrs)
+
+
+_FILE_PARSERS: dict[str, Any] = {
+    "graphql": _graphql_file,
+    "protobuf": _proto_file,
+    "thrift": _thrift_file,
+}
+
+
+def idl_entities(
+    source_utf8: bytes, language: str, path: str,
+) -> tuple[list[Entity], list[ParseError]]:
+    """The entities of an IDL file, and where it stopped making sense, if it did.
+
+    A syntax error ends the file: what was read before it is kept, as with
+    files tree-sitter parses with errors.
+    """
+    parser: _Parser = _Parser(source_utf8, language, path)
+    errors: list[ParseError] = []
+    try:
+        _FILE_PARSERS[language](parser)
+    except _SyntaxError as exc:
+        offset: int = exc.token.start if exc.token is not None else 0
+        end: int = exc.token.end if exc.token is not None else 0
+        row, col = parser.position(offset)
+        end_row, end_col = parser.position(end)
+        errors.append(ParseError(path, "syntax", str(exc), row, col, end_row, end_col))
+    assign_uids(parser.entities)
+    return parser.entities, errors
+
+
+# ---------------------------------------------------------------------------
+# Generated code
+# ---------------------------------------------------------------------------
+
+# Files protoc, thrift, and GraphQL code generators write, for Go and TypeScript.
+_GENERATED_RE: re.Pattern[str] = re.compile(
+    r"(?:\.pb(?:\.gw)?\.go|_grpc\.pb\.go|\.twirp\.go|_(?:grpc_)?pb(?:\.d)?\.[jt]s|_connect\.[jt]s"
+    r"|\.pb\.ts|_gen\.go|(?:^|/)generated\.go|\.generated\.tsx?|(?:^|/)graphql\.tsx?)$"
+    r"|(?:^|/)(?:__generated__|gen-go|gen-js)/",
+)
+
+# Suffixes generators add to the name of the IDL file a file was generated from.
+_GENERATED_STEM_RE: re.Pattern[str] = re.compile(r"(?:_grpc_pb|_grpc|_pb|_connect|_gen)$")
+
+
+def is_generated_path(path: str) -> bool:
+    return _GENERATED_RE.search(path.replace("\\", "/")) is not None
+
+
+def source_stem(path: str) -> str:
+    """What an IDL file and the files generated from it share: ``user`` for
+    ``user.proto``, ``user.pb.go``, ``user_grpc.pb.go``, and ``user_pb.d.ts``."""
+    stem: str = PurePosixPath(path.replace("\\", "/")).name.split(".", 1)[0]
+    return _GENERATED_STEM_RE.sub("", stem)
+
+
+def lower_first(name: str) -> str:
+    return name[:1].lower() + name[1:]
+
+
+def upper_first(name: str) -> str:
+    return name[:1].upper() + name[1:]
+
+
+def generated_names(entity: Entity, qualified: str) -> list[str]:
+    """The type and function names generated code gives *entity*, a definition.
+
+    Nested protobuf messages are joined with ``_`` (``Outer_Inner``), as
+    protoc-gen-go and ts-proto do.  A service becomes client and server
+    types (``FooClient``, ``FooServer``, ``UnimplementedFooServer``), and a
+    named GraphQL operation its result type, document, and hook
+    (``GetUserQuery``, ``GetUserDocument``, ``useGetUserQuery``), as
+    graphql-codegen writes them.
+    """
+    if entity.kind == "service":
+        return [
+            *(entity.name + suffix for suffix in ("Client", "Server", "ServiceClient", "Handler")),
+            f"Unimplemented{entity.name}Server", f"New{entity.name}Client",
+            f"Register{entity.name}Server", entity.name, entity.name + "Iface",
+        ]
+    if entity.kind == "operation" and "response" not in entity.attrs:
+        typed: str = entity.name + upper_first(entity.attrs["operation"])
+        return [typed, f"use{typed}", entity.name + "Document"]
+    if entity.kind == "fragment":
+        return [entity.name + "Fragment", entity.name + "FragmentDoc"]
+    if entity.kind in ("rpc", "operation", "package", "import"):
+        return []
+    return [qualified.replace(".", "_")]
+
+
+def member_owners(entity: Entity, parent: Entity) -> list[str]:
+    """The generated types whose methods implement *entity*, an rpc or root field.
+
+    Server and client types of the service, exported or not (Go's
+    ``greeterClient``), or gqlgen's ``queryResolver`` for a field of
+    ``Query``.
+    """
+    if entity.kind == "rpc":
+        owners: list[str] = generated_names(parent, parent.name)
+    elif entity.kind == "operation" and "response" in entity.attrs:
+        owners = [parent.name + "Resolver"]
+    else:
+        return []
+    return [*owners, *(lower_first(o) for o in owners)]
+
+
+@dataclass
+class GeneratedIndex:
+    """IDL definitions by the names generated code gives them, for ``generates`` edges."""
+
+    # generated name -> (definition id, source stem)
+    types: dict[str, list[tuple[int, str]]] = field(default_factory=dict)
+    # (generated owner type, method name) -> (definition id, source stem)
+    methods: dict[tuple[str, str], list[tuple[int, str]]] = field(default_factory=dict)
+
+    def add(self, entities: list[Entity], names: dict[int, str]) -> None:
+        stem: str = source_stem(entities[0].path)
+        by_id: dict[int, Entity] = {e.id: e for e in entities}
+        for entity in entities:
+            for name in generated_names(entity, names[entity.id]):
+                self.types.setdefault(name, []).append((entity.id, stem))
+            parent: Entity | None = by_id.get(entity.parent) if entity.parent is not None else None
+            if parent is None:
+                continue
+            for owner in member_owners(entity, parent):
+                for method in {entity.name, upper_first(entity.name), lower_first(entity.name)}:
+                    self.methods.setdefault((owner, method), []).append((entity.id, stem))
+
+    def sources(self, entity: Entity, owner: str | None) -> list[int]:
+        """The definitions *entity*, in a generated file and a member of *owner*, comes from.
+
+        Generated files are usually named after their schema, so a
+        definition in a schema of the same name is preferred.
+        """
+        candidates: list[tuple[int, str]] = (
+            self.methods.get((owner, entity.name), []) if owner is not None
+            else self.types.get(entity.name, [])
+        )
+        stem: str = source_stem(entity.path)
+        same_file: list[tuple[int, str]] = [c for c in candidates if c[1] == stem]
+        return sorted({c[0] for c in same_file or candidates})
@@ -0,0 +1,337 @@
+"""Infrastructure files: Dockerfiles, Kubernetes manifests, and Terraform.
+
+- Dockerfiles (``Dockerfile``, ``Containerfile``, ``Dockerfile.api``,
+  ``api.Dockerfile``) give an ``image`` entity per ``FROM`` stage, with the
+  ``image`` and ``tag`` it starts from and its ``alias``, and a ``port``
+  entity per ``EXPOSE``d port.
+- Kubernetes manifests, YAML files whose documents have an ``apiVersion``
+  and a ``kind``, give an entity per object: its kind lowercased
+  (``deployment``, ``service``), named after ``metadata.name``, with its
+  ``namespace`` and ``labels``.  Workloads record their container
+  ``images``, ``ports``, and ``pod_labels``; services their ``selector`` and
+  ``ports``; ingresses the services they route to (``backends``).
+- Terraform files give ``resource``, ``data``, ``module``, ``variable``,
+  ``output``, and ``provider`` entities.  Resources and data sources are
+  named ``type.name``, and record the container ``images`` they run;
+  modules their ``source``.
+
+Linking joins workloads to the Dockerfiles that build their images (see
+image_names), services to the workloads they select, and ingresses to the
+services they route to.
+"""
+
+from __future__ import annotations
+
+import bisect
+import re
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from .extracting import Entity, assign_uids, file_entity
+
+# Kubernetes kinds whose pods run containers, and where their pod template is.
+_POD_TEMPLATES: dict[str, tuple[str, ...]] = {
+    "CronJob": ("spec", "jobTemplate", "spec", "template"),
+    "DaemonSet": ("spec", "template"),
+    "Deployment": ("spec", "template"),
+    "Job": ("spec", "template"),
+    "Pod": (),
+    "ReplicaSet": ("spec", "template"),
+    "StatefulSet": ("spec", "template"),
+}
+
+WORKLOAD_KINDS: frozenset[str] = frozenset(k.lower() for k in _POD_TEMPLATES)
+
+# Terraform top-level blocks, by how many labels they take.
+_TERRAFORM_BLOCKS: dict[str, int] = {
+    "data": 2, "module": 1, "output": 1, "provider": 1, "resource": 2, "variable": 1,
+}
+
+
+def is_dockerfile(path: Path | PurePosixPath) -> bool:
+    name: str = path.name
+    return (
+        name in ("Containerfile", "Dockerfile") or name.startswith("Dockerfile.")
+        or name.endswith(".Dockerfile")
+    )
+
+
+def is_terraform(path: Path | PurePosixPath) -> bool:
+    return path.suffix == ".tf"
+
+
+def infrastructure_language(path: Path) -> str | None:
+    """The language of a Dockerfile or Terraform file at *path*, else None."""
+    if is_dockerfile(path):
+        return "dockerfile"
+    return "hcl" if is_terraform(path) else None
+
+
+def _line_starts(text: str) -> list[int]:
+    return [0] + [m.end() for m in re.finditer(r"\n", text)]
+
+
+class _Builder:
+    """Entities of one file, positioned by character offsets into its text."""
+
+    def __init__(self, source_utf8: bytes, language: str, path: str) -> None:
+        self.text: str = source_utf8.decode("utf-8", errors="replace")
+        self.path: str = path
+        self.language: str = language
+        self.line_starts: list[int] = _line_starts(self.text)
+        self.entities: list[Entity] = [file_entity(source_utf8, language, path, 0)]
+
+    def position(self, offset: int) -> tuple[int, int]:
+        row: int = bisect.bisect_right(self.line_starts, offset) - 1
+        return row + 1, offset - self.line_starts[row] + 1
+
+    def add(
+        self, kind: str, name: str, start: int, end: int, attrs: dict[str, Any],
+        parent: int = 0,
+    ) -> Entity:
+        row, col = self.position(start)
+        end_row, end_col = self.position(end)
+        entity: Entity = Entity(
+            id=len(self.entities), kind=kind, name=name, path=self.path, language=self.language,
+            row=row, col=col, end_row=end_row, end_col=end_col, parent=parent, attrs=attrs,
+            start_byte=len(self.text[:start].encode("utf-8")),
+            end_byte=len(self.text[:end].encode("utf-8")),
+        )
+        self.entities.append(entity)
+        return entity
+
+    def done(self) -> list[Entity]:
+        assign_uids(self.entities)
+        return self.entities
+
+
+# ---------------------------------------------------------------------------
+# Images
+# ---------------------------------------------------------------------------
+
+
+def split_image(reference: str) -> tuple[str, str | None]:
+    """``(repository, tag)`` of an image reference: ``ghcr.io/acme/api:1.2@sha256:...``
+    is ``("ghcr.io/acme/api", "1.2")``.  A registry port is not a tag."""
+    reference = reference.split("@", 1)[0]
+    repository, colon, tag = reference.rpartition(":")
+    if not colon or "/" in tag:
+        return reference, None
+    return repository, tag
+
+
+def image_names(path: str) -> list[str]:
+    """Image names a Dockerfile at *path* is taken to build: its directory's
+    name, or the ``api`` of ``Dockerfile.api`` and ``api.Dockerfile``."""
+    pure: PurePosixPath = PurePosixPath(path.replace("\\", "/"))
+    if pure.name.startswith("Dockerfile."):
+        return [pure.name.removeprefix("Dockerfile.")]
+    if pure.name.endswith(".Dockerfile"):
+        return [pure.name.removesuffix(".Dockerfile")]
+    return [pure.parent.name] if pure.parent.name not in ("", ".", "..") else []
+
+
+def image_key(reference: str) -> str:
+    """The part of an image reference matched against image_names: the
+    repository's last segment, lowercased."""
+    return split_image(reference)[0].rsplit("/", 1)[-1].lower()
+
+
+# ---------------------------------------------------------------------------
+# Dockerfiles
+# ---------------------------------------------------------------------------
+
+_INSTRUCTION_RE: re.Pattern[str] = re.compile(
+    r"^[ \t]*(FROM|EXPOSE)[ \t]+((?:[^\n\\]|\\\r?\n|\\.)*)", re.IGNORECASE | re.MULTILINE,
+)
+
+
+def dockerfile_entities(source_utf8: bytes, path: str) -> list[Entity]:
+    """The file, stage images, and exposed ports of the Dockerfile at *path*."""
+    builder: _Builder = _Builder(source_utf8, "dockerfile", path)
+    stage: int = 0
+    for match in _INSTRUCTION_RE.finditer(builder.text):
+        words: list[str] = re.sub(r"\\\r?\n", " ", match.group(2)).split()
+        words = [w for w in words if not w.startswith("--")]  # --platform=...
+        if not words:
+            continue
+        if match.group(1).upper() == "FROM":
+            repository, tag = split_image(words[0])
+            attrs: dict[str, Any] = {"image": repository}
+            if tag is not None:
+                attrs["tag"] = tag
+            if len(words) >= 3 and words[1].upper() == "AS":
+                attrs["alias"] = words[2]
+            stage = builder.add(
+                "image", words[0], match.start(1), match.end(), attrs,
+            ).id
+            continue
+        for word in words:
+            port, _, protocol = word.partition("/")
+            if port.isdigit():
+                builder.add(
+                    "port", word, match.start(1), match.end(),
+                    {"port": int(port), "protocol": protocol or "tcp"}, stage,
+                )
+    return builder.done()
+
+
+# ---------------------------------------------------------------------------
+# Kubernetes
+# ---------------------------------------------------------------------------
+
+
+def _dig(data: Any, keys: tuple[str, ...]) -> Any:
+    for key in keys:
+        data = data.get(key) if isinstance(data, dict) else None
+    return data
+
+
+def _mapping(value: Any) -> dict[str, Any]:
+    return value if isinstance(value, dict) else {}
+
+
+def _objects(data: Any) -> list[dict[str, Any]]:
+    """The Kubernetes objects in a YAML document, looking into ``kind: List``."""
+    if not isinstance(data, dict) or "apiVersion" not in data or "kind" not in data:
+        return []
+    if data["kind"] == "List" or str(data["kind"]).endswith("List"):
+        return [o for item in data.get("items") or [] for o in _objects(item)]
+    return [data]
+
+
+def _object_attrs(data: dict[str, Any]) -> dict[str, Any]:
+    kind: str = str(data["kind"])
+    metadata: dict[str, Any] = _mapping(data.get("metadata"))
+    spec: dict[str, Any] = _mapping(data.get("spec"))
+    attrs: dict[str, Any] = {"api_version": str(data["apiVersion"])}
+    if metadata.get("namespace"):
+        attrs["namespace"] = str(metadata["namespace"])
+    if isinstance(metadata.get("labels"), dict):
+        attrs["labels"] = {str(k): str(v) for k, v in metadata["labels"].items()}
+    if kind in _POD_TEMPLATES:
+        template: dict[str, Any] = _mapping(_dig(data, _POD_TEMPLATES[kind]))
+        pod: dict[str, Any] = _mapping(template.get("spec"))
+        containers: list[Any] = [
+            c for key in ("initContainers", "containers") for c in pod.get(key) or []
+            if isinstance(c, dict)
+        ]
+        attrs["images"] = [str(c["image"]) for c in containers if c.get("image")]
+        attrs["ports"] = [
+            p["containerPort"] for c in containers for p in c.get("ports") or []
+            if isinstance(p, dict) and "containerPort" in p
+        ]
+        labels: Any = _dig(template, ("metadata", "labels"))
+        if kind == "Pod":
+            labels = metadata.get("labels")
+        if isinstance(labels, dict):
+            attrs["pod_labels"] = {str(k): str(v) for k, v in labels.items()}
+    elif kind == "Service":
+        if isinstance(spec.get("selector"), dict):
+            attrs["selector"] = {str(k): str(v) for k, v in spec["selector"].items()}
+        attrs["ports"] = [
+            p["port"] for p in spec.get("ports") or [] if isinstance(p, dict) and "port" in p
+        ]
+    elif kind == "Ingress":
+        backends: list[Any] = [spec.get("defaultBackend"), spec.get("backend")]
+        for rule in spec.get("rules") or []:
+            for route in _mapping(_dig(rule, ("http",))).get("paths") or []:
+                backends.append(_mapping(route).get("backend"))
+        names: list[str] = []
+        for backend in backends:
+            backend = _mapping(backend)
+            # networking.k8s.io/v1 nests the service; v1beta1 names it directly.
+            name: Any = _dig(backend, ("service", "name")) or backend.get("serviceName")
+            if name and str(name) not in names:
+                names.append(str(name))
+        attrs["backends"] = names
+    return attrs
+
+
+def kubernetes_entities(source_utf8: bytes, path: str) -> list[Entity] | None:
+    """The objects of the Kubernetes manifest at *path*, or None if it is not one.
+
+    A YAML file counts as a manifest when a document in it is an object
+    with an ``apiVersion`` and a ``kind``; other YAML, and YAML that does
+    not parse (Helm templates, for one), is left for the YAML grammar.
+    """
+    if b"apiVersion" not in source_utf8 or b"kind" not in source_utf8:
+        return None  # most YAML is not a manifest; skip loading it
+    # Import lazily, as for config files.
+    import yaml
+
+    builder: _Builder = _Builder(source_utf8, "yaml", path)
+    found: bool = False
+    try:
+        for node in yaml.compose_all(builder.text, Loader=yaml.SafeLoader):
+            if node is None:
+                continue
+            data: Any = yaml.SafeLoader("").construct_document(node)
+            for obj in _objects(data):
+                found = True
+                metadata: dict[str, Any] = _mapping(obj.get("metadata"))
+                name: str = str(metadata.get("name") or metadata.get("generateName") or obj["kind"])
+                builder.add(
+                    str(obj["kind"]).lower(), name, node.start_mark.index, node.end_mark.index,
+                    _object_attrs(obj),
+                )
+    except yaml.YAMLError:
+        return None
+    return builder.done() if found else None
+
+
+# ---------------------------------------------------------------------------
+# Terraform
+# ---------------------------------------------------------------------------
+
+_HCL_TOKEN_RE: re.Pattern[str] = re.compile(r"""
+    (?P<comment>\#[^\n]*|//[^\n]*|/\*.*?(?:\*/|\Z))
+  | (?P<heredoc><<-?[ \t]*(?P<tag>\w+)[^\n]*\n.*?^[ \t]*(?P=tag)[ \t]*$)
+  | (?P<string>"(?:[^"\\\n]|\\.)*"?)
+  | (?P<punct>[{}])
+""", re.VERBOSE | re.DOTALL | re.MULTILINE)
+
+_BLOCK_RE: re.Pattern[str] = re.compile(r'([A-Za-z_][\w-]*)((?:[ \t]+"[^"\n]*")*)[ \t]*$')
+
+_IMAGE_RE: re.Pattern[str] = re.compile(r'\bimage"?\s*[=:]\s*"([^"$\n]+)"')
+
+_SOURCE_RE: re.Pattern[str] = re.compile(r'^[ \t]*source[ \t]*=[ \t]*"([^"\n]*)"', re.MULTILINE)
+
+
+def terraform_entities(source_utf8: bytes, path: str) -> list[Entity]:
+    """The file and top-level blocks of the Terraform file at *path*."""
+    builder: _Builder = _Builder(source_utf8, "hcl", path)
+    text: str = builder.text
+    depth: int = 0
+    opened: tuple[str, str, int, int] | None = None  # (block type, name, start, body start)
+    for match in _HCL_TOKEN_RE.finditer(text):
+        if match.lastgroup != "punct":
+            continue
+        if match.group() == "}":
+            depth = max(depth - 1, 0)
+            if depth == 0 and opened is not None:
+                block, name, start, body = opened
+                attrs: dict[str, Any] = {}
+                contents: str = text[body : match.start()]
+                if block in ("resource", "data"):
+                    attrs["type"] = name.split(".", 1)[0]
+                    images: list[str] = list(dict.fromkeys(_IMAGE_RE.findall(contents)))
+                    if images:
+                        attrs["images"] = images
+                elif block == "module":
+                    source: re.Match[str] | None = _SOURCE_RE.search(contents)
+                    if source is not None:
+                        attrs["source"] = source.group(1)
+                builder.add(block, name, start, match.end(), attrs)
+                opened = None
+            continue
+        if depth == 0:
+            line_start: int = text.rfind("\n", 0, match.start()) + 1
+            header: re.Match[str] | None = _BLOCK_RE.search(text[line_start : match.start()])
+            labels: list[str] = re.findall(r'"([^"\n]*)"', header.group(2)) if header else []
+            if header is not None and _TERRAFORM_BLOCKS.get(header.group(1)) == len(labels):
+                opened = (
+                    header.group(1), ".".join(labels), line_start + header.start(), match.end(),
+                )
+        depth += 1
+    return builder.done()
@@ -0,0 +1,308 @@
+"""A minimal language server, for browsing the structure graph in an editor.
+
+The server speaks LSP over stdin and stdout and answers from an analysis
+of the workspace folder, which it repeats when a file is saved:
+
+- ``textDocument/documentSymbol``: the outline of a file, nested like
+  its entities.
+- ``workspace/symbol``: entities whose name contains the query.
+- ``textDocument/codeLens``: one lens at the top of each file counting
+  the files it depends on and the files that depend on it, through the
+  resolved edges.  Running its ``autosg.dependencies`` command shows
+  both lists.
+
+Positions are sent in LSP's UTF-16 code units, converted from the
+characters entity columns count by the lines of each file.
+"""
+
+from __future__ import annotations
+
+import json
+import logging
+from collections import defaultdict
+from collections.abc import Callable
+from pathlib import Path
+from typing import Any, BinaryIO
+from urllib.parse import unquote, urlsplit
+
+from .analysis import Options, Result, analyze
+from .annotating import FileEncoding, read_source_utf8
+from .exporting import name_position
+from .extracting import Entity
+from .parsing import source_lines
+from .positioning import column
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+DEPENDENCIES_COMMAND: str = "autosg.dependencies"
+
+# Most workspace/symbol results a client is sent per query.
+MAX_WORKSPACE_SYMBOLS: int = 500
+
+# LSP SymbolKind by entity kind; other kinds (e.g. from plugins) are Object.
+_SYMBOL_KINDS: dict[str, int] = {
+    "file": 1, "module": 2, "package": 4,
+    "class": 5, "method": 6, "property": 7, "field": 8, "enum": 10,
+    "interface": 11, "function": 12, "type": 26, "struct": 23, "event": 24,
+    "trait": 11, "impl": 5, "object": 19,
+}
+_DEFAULT_SYMBOL_KIND: int = 19
+
+# Entities left out of outlines and symbol searches.
+_HIDDEN_KINDS: frozenset[str] = frozenset({"file", "import", "use"})
+
+# JSON-RPC error codes.
+_METHOD_NOT_FOUND: int = -32601
+_INVALID_PARAMS: int = -32602
+_INTERNAL_ERROR: int = -32603
+
+
+def uri_to_path(uri: str) -> Path:
+    return Path(unquote(urlsplit(uri).path))
+
+
+def _lines(path: Path) -> list[str]:
+    """The lines of the file at *path* as tree-sitter counts rows; none if unreadable."""
+    source: tuple[bytes, FileEncoding] | None = read_source_utf8(path)
+    if source is None:
+        return []
+    return [line.decode("utf-8", errors="replace") for line in source_lines(source[0])]
+
+
+def _character(lines: list[str], row: int, col: int) -> int:
+    return column(lines[row - 1], col, "utf-16") - 1 if row <= len(lines) else col - 1
+
+
+def _range(
+    lines: list[str], start_row: int, start_col: int, end_row: int, end_col: int,
+) -> dict[str, Any]:
+    return {
+        "start": {"line": start_row - 1, "character": _character(lines, start_row, start_col)},
+        "end": {"line": end_row - 1, "character": _character(lines, end_row, end_col)},
+    }
+
+
+class _Index:
+    """An analysis result arranged for the requests the server answers."""
+
+    def __init__(self, result: Result) -> None:
+        self.files: dict[Path, list[Entity]] = {
+            Path(f.path).resolve(): f.entities for f in result.files
+        }
+        entities: dict[int, Entity] = {e.id: e for e in result.entities}
+        self.depends_on: dict[Path, set[Path]] = defaultdict(set)
+        self.used_by: dict[Path, set[Path]] = defaultdict(set)
+        for edge in result.edges:
+            if edge.target not in entities or edge.source not in entities:
+                continue
+            source: Path = Path(entities[edge.source].path).resolve()
+            target: Path = Path(entities[edge.target].path).resolve()
+            if source != target:
+                self.depends_on[source].add(target)
+                self.used_by[target].add(source)
+
+
+class LanguageServer:
+    """Answers LSP requests read from *reader*, writing to *writer*."""
+
+    def __init__(self, reader: BinaryIO, writer: BinaryIO, options: Options) -> None:
+        self.reader: BinaryIO = reader
+        self.writer: BinaryIO = writer
+        self.options: Options = options
+        self.root: Path | None = None
+        self.index: _Index = _Index(Result())
+        self._shutdown: bool = False
+        self._handlers: dict[str, Callable[[dict[str, Any]], Any]] = {
+            "initialize": self.initialize,
+            "initialized": lambda _params: self.refresh(),
+            "shutdown": self.shutdown,
+            "textDocument/didSave": lambda _params: self.refresh(),
+            "textDocument/documentSymbol": self.document_symbol,
+            "textDocument/codeLens": self.code_lens,
+            "workspace/symbol": self.workspace_symbol,
+            "workspace/executeCommand": self.execute_command,
+        }
+
+    def _read(self) -> dict[str, Any] | None:
+        """The next message, or None at end of input."""
+        length: int | None = None
+        while True:
+            line: bytes = self.reader.readline()
+            if not line:
+                return None
+            line = line.strip()
+            if not line:
+                break
+            name, _, value = line.decode("ascii").partition(":")
+            if name.strip().lower() == "content-length":
+                length = int(value)
+        if length is None:
+            raise ValueError("message without a Content-Length header")
+        return json.loads(self.reader.read(length))
+
+    def _send(self, message: dict[str, Any]) -> None:
+        body: bytes = json.dumps({"jsonrpc": "2.0", **message}).encode()
+        self.writer.write(f"Content-Length: {len(body)}\r\n\r\n".encode("ascii") + body)
+        self.writer.flush()
+
+    def notify(self, method: str, params: dict[str, Any]) -> None:
+        self._send({"method": method, "params": params})
+
+    def run(self) -> int:
+        """Serve until ``exit``; returns the exit code the protocol asks for."""
+        while True:
+            message: dict[str, Any] | None = self._read()
+            if message is None or message.get("method") == "exit":
+                return 0 if self._shutdown else 1
+            method: str = message.get("method", "")
+            handler: Callable[[dict[str, Any]], Any] | None = self._handlers.get(method)
+            if "id" not in message:  # a notification: never answered
+                if handler is not None:
+                    handler(message.get("params") or {})
+                continue
+            if handler is None:
+                self._send({"id": message["id"], "error": {
+                    "code": _METHOD_NOT_FOUND, "message": f"unsupported method {method}",
+                }})
+                continue
+            try:
+                result: Any = handler(message.get("params") or {})
+            except (KeyError, TypeError, ValueError) as exc:
+                self._send({"id": message["id"], "error": {
+                    "code": _INVALID_PARAMS, "message": str(exc),
+                }})
+            except Exception as exc:
+                logger.exception("error handling %s", method)
+                self._send({"id": message["id"], "error": {
+                    "code": _INTERNAL_ERROR, "message": str(exc),
+                }})
+            else:
+                self._send({"id": message["id"], "result": result})
+
+    def initialize(self, params: dict[str, Any]) -> dict[str, Any]:
+        folders: list[dict[str, Any]] = params.get("workspaceFolders") or []
+        uri: str | None = folders[0]["uri"] if folders else params.get("rootUri")
+        if uri is not None:
+            self.root = uri_to_path(uri)
+        elif params.get("rootPath"):
+            self.root = Path(params["rootPath"])
+        return {
+            "capabilities": {
+                "textDocumentSync": {"openClose": False, "change": 0, "save": True},
+                "documentSymbolProvider": True,
+                "workspaceSymbolProvider": True,
+                "codeLensProvider": {"resolveProvider": False},
+                "executeCommandProvider": {"commands": [DEPENDENCIES_COMMAND]},
+            },
+            "serverInfo": {"name": "autosg"},
+        }
+
+    def shutdown(self, _params: dict[str, Any]) -> None:
+        self._shutdown = True
+
+    def refresh(self) -> None:
+        """Analyze the workspace again; unchanged files come from the cache."""
+        if self.root is None or not self.root.exists():
+            self.notify("window/showMessage", {
+                "type": 2, "message": "autosg: no workspace folder to analyze",
+            })
+            return
+        self.index = _Index(analyze(self.root, self.options))
+
+    def _symbol(self, entity: Entity, lines: list[str]) -> dict[str, Any]:
+        row, col = name_position(entity, lines)
+        return {
+            "name": entity.name,
+            "kind": _SYMBOL_KINDS.get(entity.kind, _DEFAULT_SYMBOL_KIND),
+            "detail": entity.kind,
+            "range": _range(lines, entity.row, entity.col, entity.end_row, entity.end_col),
+            "selectionRange": _range(lines, row, col, row, col + len(entity.name)),
+            "children": [],
+        }
+
+    def document_symbol(self, params: dict[str, Any]) -> list[dict[str, Any]]:
+        path: Path = uri_to_path(params["textDocument"]["uri"]).resolve()
+        entities: list[Entity] = self.index.files.get(path, [])
+        lines: list[str] = _lines(path) if entities else []
+        symbols: dict[int, dict[str, Any]] = {}
+        top: list[dict[str, Any]] = []
+        for entity in entities:
+            if entity.kind in _HIDDEN_KINDS:
+                continue
+            symbols[entity.id] = self._symbol(entity, lines)
+            parent: dict[str, Any] | None = symbols.get(entity.parent)  # type: ignore[arg-type]
+            (parent["children"] if parent is not None else top).append(symbols[entity.id])
+        return top
+
+    def workspace_symbol(self, params: dict[str, Any]) -> list[dict[str, Any]]:
+        query: str = params.get("query", "").lower()
+        symbols: list[dict[str, Any]] = []
+        for path, entities in self.index.files.items():
+            names: dict[int, str] = {e.id: e.name for e in entities}
+            lines: list[str] | None = None  # read once something in the file matches
+            for entity in entities:
+                if entity.kind in _HIDDEN_KINDS or query not in entity.name.lower():
+                    continue
+                if lines is None:
+                    lines = _lines(path)
+                symbol: dict[str, Any] = {
+                    "name": entity.name,
+                    "kind": _SYMBOL_KINDS.get(entity.kind, _DEFAULT_SYMBOL_KIND),
+                    "location": {
+                        "uri": path.as_uri(),
+                        "range": _range(
+                            lines, entity.row, entity.col, entity.end_row, entity.end_col,
+                        ),
+                    },
+                }
+                if entity.parent is not None:
+                    symbol["containerName"] = names[entity.parent]
+                symbols.append(symbol)
+                if len(symbols) >= MAX_WORKSPACE_SYMBOLS:
+                    return symbols
+        return symbols
+
+    def _relative(self, paths: set[Path]) -> list[str]:
+        root: Path | None = self.root.resolve() if self.root is not None else None
+        return sorted(
+            str(p.relative_to(root)) if root is not None and p.is_relative_to(root) else str(p)
+            for p in paths
+        )
+
+    def code_lens(self, params: dict[str, Any]) -> list[dict[str, Any]]:
+        uri: str = params["textDocument"]["uri"]
+        path: Path = uri_to_path(uri).resolve()
+        if path not in self.index.files:
+            return []
+        depends_on: int = len(self.index.depends_on.get(path, ()))
+        used_by: int = len(self.index.used_by.get(path, ()))
+        return [{
+            "range": _range([], 1, 1, 1, 1),
+            "command": {
+                "title": f"depends on {depends_on} file(s) · used by {used_by} file(s)",
+                "command": DEPENDENCIES_COMMAND,
+                "arguments": [uri],
+            },
+        }]
+
+    def execute_command(self, params: dict[str, Any]) -> dict[str, list[str]] | None:
+        if params["command"] != DEPENDENCIES_COMMAND:
+            raise ValueError(f"unknown command {params['command']}")
+        path: Path = uri_to_path(params["arguments"][0]).resolve()
+        dependencies: dict[str, list[str]] = {
+            "dependsOn": self._relative(self.index.depends_on.get(path, set())),
+            "usedBy": self._relative(self.index.used_by.get(path, set())),
+        }
+        self.notify("window/showMessage", {
+            "type": 3,
+            "message": (
+                f"{path.name} depends on: {', '.join(dependencies['dependsOn']) or 'nothing'}\n"
+                f"Used by: {', '.join(dependencies['usedBy']) or 'nothing'}"
+            ),
+        })
+        return dependencies
+
+
+def serve_stdio(reader: BinaryIO, writer: BinaryIO, options: Options) -> int:
+    """Run a language server on *reader* and *writer*; returns its exit code."""
+    return LanguageServer(reader, writer, options).run()
@@ -0,0 +1,111 @@
+"""License and copyright headers, attached to file entities.
+
+The top of every analyzed file is searched for an SPDX tag::
+
+    // SPDX-License-Identifier: Apache-2.0 OR MIT
+
+and for the opening phrases of common license notices ("Licensed under
+the Apache License, Version 2.0", "Permission is hereby granted, free of
+charge", ...), which are named by their SPDX identifiers too.  The file
+entity gets the ``licenses`` found, the first of them (a tag before a
+notice) as ``license``, and its ``copyright`` lines.
+"""
+
+from __future__ import annotations
+
+import re
+from pathlib import Path
+from typing import Any
+
+from .annotating import FileEncoding, detect_encoding, long_path
+
+# How much of a file is searched: license headers come first.
+HEADER_BYTES: int = 8192
+HEADER_LINES: int = 60
+
+# Languages of data and docs, which are not expected to carry a header.
+HEADERLESS_LANGUAGES: frozenset[str] = frozenset(
+    {"gomod", "json", "markdown", "rst", "toml", "yaml"},
+)
+
+_SPDX_RE: re.Pattern[str] = re.compile(r"SPDX-License-Identifier:\s*(.+?)\s*(?:\*/|-->)?\s*$")
+_COPYRIGHT_RE: re.Pattern[str] = re.compile(
+    r"\bcopyright\s+(?:\(c\)\s*|©\s*)?((?:19|20)\d\d\b.*?)"
+    r"(?:[.,]?\s*all rights reserved\.?)?\s*(?:\*/|-->)?\s*$",
+    re.IGNORECASE,
+)
+# Comment markers at the start of a line, stripped before notices are matched.
+_MARKER_RE: re.Pattern[str] = re.compile(r"^\s*(?:/\*+|\*+/?|//+|#+|--+|;+|<!--|!)?\s*")
+
+# Opening phrases of license notices, and the licenses they name.  A
+# version after a GNU license's name picks the identifier.
+_NOTICES: tuple[tuple[re.Pattern[str], str], ...] = (
+    (re.compile(r"Licensed under the Apache License,? Version 2\.0", re.I), "Apache-2.0"),
+    (re.compile(r"Permission is hereby granted, free of charge", re.I), "MIT"),
+    (re.compile(r"GNU Affero General Public License", re.I), "AGPL-3.0"),
+    (re.compile(r"GNU Lesser General Public License.{0,80}?version (2\.1|3)", re.I), "LGPL-{}"),
+    (re.compile(r"GNU General Public License.{0,80}?version ([23])", re.I), "GPL-{}.0"),
+    (re.compile(r"Mozilla Public License,? v(?:ersion|\.) ?2\.0", re.I), "MPL-2.0"),
+    (re.compile(r"Eclipse Public License.{0,20}?(?:v|version) ?2\.0", re.I), "EPL-2.0"),
+    (re.compile(r"governed by a BSD-style license", re.I), "BSD-3-Clause"),
+    (re.compile(r"Redistribution and use in source and binary forms", re.I), "BSD-2-Clause"),
+    (re.compile(r"released into the public domain", re.I), "Unlicense"),
+)
+
+# The clause that makes a BSD notice the three-clause license.
+_BSD_ENDORSEMENT_RE: re.Pattern[str] = re.compile(r"Neither the name", re.I)
+
+
+def _named(identifier: str, licenses: list[str]) -> bool:
+    """Whether *identifier* is, or is a variant of, a license in *licenses*' expressions."""
+    return any(
+        token == identifier or token.startswith(f"{identifier}-")
+        for expression in licenses
+        for token in re.findall(r"[\w.+-]+", expression)
+    )
+
+
+def read_header(path: Path) -> bytes:
+    """The first HEADER_BYTES of *path* in UTF-8, or nothing when it cannot be read."""
+    try:
+        with open(long_path(path), "rb") as f:
+            header: bytes = f.read(HEADER_BYTES)
+    except OSError:
+        return b""
+    encoding: FileEncoding | None = detect_encoding(header)
+    if encoding is None or encoding.encoding == "utf-8":
+        return header  # or cut in the middle of a character
+    text: str = header[len(encoding.bom) :].decode(encoding.encoding, errors="replace")
+    return text.encode("utf-8")
+
+
+def license_attrs(header: bytes) -> dict[str, Any]:
+    """The ``license``, ``licenses``, and ``copyright`` attrs of a file starting with *header*."""
+    lines: list[str] = header.decode("utf-8", errors="replace").splitlines()[:HEADER_LINES]
+    licenses: list[str] = []
+    copyrights: list[str] = []
+    for line in lines:
+        tag: re.Match[str] | None = _SPDX_RE.search(line)
+        if tag is not None and tag.group(1) not in licenses:
+            licenses.append(tag.group(1))
+        holder: re.Match[str] | None = _COPYRIGHT_RE.search(line)
+        if holder is not None:
+            copyrights.append(holder.group(1))
+    text: str = " ".join(_MARKER_RE.sub("", line, count=1) for line in lines)
+    for pattern, identifier in _NOTICES:
+        notice: re.Match[str] | None = pattern.search(text)
+        if notice is None:
+            continue
+        if notice.groups():
+            identifier = identifier.format(notice.group(1))
+        if identifier == "BSD-2-Clause" and _BSD_ENDORSEMENT_RE.search(text):
+            identifier = "BSD-3-Clause"
+        if not _named(identifier, licenses):  # a tag already says so
+            licenses.append(identifier)
+    attrs: dict[str, Any] = {}
+    if licenses:
+        attrs["license"] = licenses[0]
+        attrs["licenses"] = licenses
+    if copyrights:
+        attrs["copyright"] = copyrights
+    return attrs
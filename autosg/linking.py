@@ -0,0 +1,1171 @@
+"""Cross-file resolution of the references recorded during extraction.
+
+Extraction sees one file at a time, so a call to ``healthHandler`` is only
+recorded by name.  The linker indexes declarations from every analyzed file
+and turns those names into edges between entity ids.
+
+Go scoping: a package is a directory, so unqualified calls resolve to
+functions in the caller's directory.  Qualified calls (``util.Parse``)
+resolve when ``util`` is imported from the same module, as declared by the
+nearest ``go.mod``, or from another module some analyzed file belongs to
+(a monorepo analyzed as several roots).
+
+Route handlers: ``handles`` edges lead from endpoint entities to the
+functions serving them, resolved like calls in Go and within the
+registering file elsewhere.
+
+Imports: each import entity is classified as ``stdlib``, ``third-party``,
+or ``internal`` (its ``origin`` attr), and internal imports become
+file-to-file ``imports`` edges when the imported file was analyzed.
+
+C and C++: a function is often declared in a header and defined in a
+source file.  ``defines`` edges join each definition to the prototypes with
+the same qualified name and parameter types, so the two read as one entity.
+C# partial types are joined the same way: ``partial`` edges lead from every
+part of a ``partial class`` to the first one seen.
+
+Tests: ``tests`` edges lead from each test (a test function, or a test file)
+to the code outside test files it calls or imports, directly or through
+helpers in test files.
+
+Dependencies: ``depends`` edges lead from the module of each package
+manifest (see manifests) to what it declares: another analyzed module by
+that name, or else the dependency entity.  ``uses`` edges lead from each
+file to the dependencies of its manifest it imports.  A third-party import
+no dependency matches gets an ``undeclared`` attr, the manifest's path.
+
+Schemas: Protobuf and Thrift imports resolve like ``#include``.
+``generates`` edges lead from each definition in a schema (see idl) to
+what code generators made of it in generated Go, JavaScript, and
+TypeScript files: a message to its struct or class, a service to its
+client and server types, and an rpc to their methods.
+
+Databases: ``reads`` and ``writes`` edges lead from functions, and from
+SQL views and routines, to the tables and views of analyzed SQL files
+their statements use (see sqltext).  Names match case-insensitively, and
+``public.users`` and ``users`` match each other when only one is qualified.
+
+Infrastructure: ``deploys`` edges lead from Kubernetes workloads and
+Terraform resources to the Dockerfiles building the images they run (see
+infrastructure.image_names), ``selects`` edges from Kubernetes services to
+the workloads in their namespace whose pods carry the labels they select,
+and ``routes`` edges from ingresses to the services they send traffic to.
+A Terraform ``module`` with a local ``source`` imports the files there.
+
+Shell scripts: files read with ``source`` are imports, and ``runs`` edges
+lead from scripts and their functions to the analyzed files they run, by
+path (``./build.sh``) or through an interpreter (``python tools/gen.py``).
+Both paths are looked up from the script's directory, then from each one
+above it, as a script may be meant to run from the top of the repository.
+
+Generics: ``instantiates`` edges lead from the functions and types using a
+generic function or type with type arguments (``Map[int, string](xs)``,
+``Box[int]{}``, ``new Box<number>()``) to its declaration, resolved like
+calls in Go and within the file in TypeScript.
+
+Clones: ``clone-of`` edges lead from each function or method to the
+first one of its language it nearly duplicates, with their ``similarity``
+(see cloning).
+
+References: ``references`` edges lead from each entity to the declarations
+the identifiers it uses name.  A name declared at the top of the using
+file resolves exactly, as does one declared in a file it imports, or
+elsewhere in its package for languages whose packages share one scope
+(Go, Java, Kotlin, Scala, C#, Swift), when only one declaration has it.
+Several, or a name declared by just one other file of the directory in
+other languages, are heuristic matches.  Local variables that shadow a
+declaration are not told apart from uses of it.
+
+Provenance: every edge says how it was derived in its ``provenance`` attr,
+``exact`` when by the language's rules or by declarations, ``heuristic``
+when names merely match, ``dispatch`` for functions passed as values that
+may be called, and ``plugin`` when a plugin gave it, with a ``confidence``
+from 0 to 1.  Edges below ``min_confidence`` are dropped.
+
+Go interfaces are satisfied implicitly.  ``implements`` edges lead from each
+analyzed type to each analyzed interface whose methods it has, counting
+methods declared on the type in any file of its package and methods
+promoted from embedded types.
+"""
+
+from __future__ import annotations
+
+import itertools
+import os
+import re
+import sys
+from collections import defaultdict
+from collections.abc import Iterable
+from dataclasses import dataclass
+from functools import lru_cache
+from pathlib import Path
+from typing import Any
+
+from .cloning import DEFAULT_THRESHOLD, clones
+from .extracting import Edge, Entity, is_entry_point, is_test_path, qualified_names
+from .idl import IDL_LANGUAGES, GeneratedIndex, is_generated_path
+from .infrastructure import WORKLOAD_KINDS, image_key, image_names
+from .manifests import LANGUAGE_ECOSYSTEMS, MANIFESTS, dependency_for, governing
+from .spilling import Spool
+
+EDGE_KINDS: tuple[str, ...] = (
+    "calls", "clone-of", "defines", "depends", "deploys", "generates", "handles", "implements",
+    "imports", "instantiates", "partial", "reads", "references", "routes", "runs", "selects",
+    "tests", "uses", "writes",
+)
+
+# The edges ``tests`` edges are derived from; resolved for them even when not requested.
+_TESTED_THROUGH: frozenset[str] = frozenset({"calls", "imports"})
+
+# Edge kinds resolved for another kind even when not requested, by that kind.
+# ``uses`` needs imports classified by origin, ``references`` the files imported,
+# and ``runs`` the paths of analyzed files.
+_DERIVED_FROM: dict[str, frozenset[str]] = {
+    "references": frozenset({"imports"}),
+    "runs": frozenset({"imports"}),
+    "tests": _TESTED_THROUGH,
+    "uses": frozenset({"imports"}),
+}
+
+# Languages whose packages are one scope: a name declared in one file is
+# visible unqualified in the others.
+_PACKAGE_SCOPED: frozenset[str] = frozenset({"c_sharp", "go", "java", "kotlin", "scala", "swift"})
+
+# Containers whose members are declared at the top of a file.
+_TOP_LEVEL_CONTAINERS: frozenset[str] = frozenset({"module", "namespace", "package"})
+
+# Entities ``references`` edges never lead to.
+_UNREFERENCED_KINDS: frozenset[str] = frozenset({
+    "endpoint", "file", "import", "method", "package", "use",
+})
+
+# How each kind of edge is derived, and how sure that is, unless the edge
+# says otherwise (see _tagged).
+_PROVENANCE: dict[str, tuple[str, float]] = {
+    "deploys": ("heuristic", 0.8),  # image names, without registries resolved
+    "generates": ("heuristic", 0.9),  # code generators' naming conventions
+    "handles": ("exact", 1.0),
+    "instantiates": ("exact", 1.0),
+    "reads": ("heuristic", 0.9),  # table names, with schemas dropped to match
+    "runs": ("heuristic", 0.9),  # paths looked up from the script's directory upwards
+    "writes": ("heuristic", 0.9),
+}
+
+# Confidence of heuristic ``references`` edges: a name several declarations
+# have, and a name only declared by a file that is not imported.
+_AMBIGUOUS: float = 0.5
+_UNIMPORTED: float = 0.25
+
+# Function values passed as arguments: maybe called, maybe only stored.
+_DISPATCH: float = 0.6
+
+
+def _tagged(edge: Edge) -> Edge:
+    """*edge* with its ``provenance`` and ``confidence`` attrs filled in."""
+    provenance, confidence = _PROVENANCE.get(edge.kind, ("exact", 1.0))
+    if edge.kind == "calls" and edge.attrs.get("indirect"):
+        provenance, confidence = "dispatch", _DISPATCH
+    edge.attrs.setdefault("provenance", provenance)
+    edge.attrs.setdefault("confidence", confidence)
+    return edge
+
+
+_GO_MODULE_RE: re.Pattern[str] = re.compile(r"^\s*module\s+(\S+)", re.MULTILINE)
+
+
+@lru_cache(maxsize=None)
+def _go_module(directory: str) -> tuple[str, str] | None:
+    """Return (module_dir, module_path) of the go.mod governing *directory*."""
+    current: Path = Path(directory or ".").resolve()
+    for candidate in (current, *current.parents):
+        go_mod: Path = candidate / "go.mod"
+        if go_mod.is_file():
+            match: re.Match[str] | None = _GO_MODULE_RE.search(
+                go_mod.read_text(errors="replace"),
+            )
+            if match is None:
+                return None
+            return os.path.relpath(candidate), match.group(1)
+    return None
+
+
+def _go_package_dir(directory: str, import_path: str) -> str | None:
+    """Map an import path to a directory if it belongs to the same module."""
+    module: tuple[str, str] | None = _go_module(directory)
+    if module is None:
+        return None
+    module_dir, module_path = module
+    if import_path != module_path and not import_path.startswith(module_path + "/"):
+        return None
+    return os.path.normpath(os.path.join(module_dir, import_path[len(module_path) :].lstrip("/")))
+
+
+# ---------------------------------------------------------------------------
+# Imports
+# ---------------------------------------------------------------------------
+
+# Vue and Svelte components import like the scripts in them.
+_JS_LANGUAGES: frozenset[str] = frozenset({"javascript", "svelte", "tsx", "typescript", "vue"})
+
+# Node.js core modules, importable with or without the ``node:`` scheme.
+_NODE_BUILTINS: frozenset[str] = frozenset({
+    "assert", "async_hooks", "buffer", "child_process", "cluster", "console", "crypto",
+    "dgram", "diagnostics_channel", "dns", "events", "fs", "http", "http2", "https",
+    "inspector", "module", "net", "os", "path", "perf_hooks", "process", "querystring",
+    "readline", "stream", "string_decoder", "timers", "tls", "tty", "url", "util", "v8",
+    "vm", "worker_threads", "zlib",
+})
+
+# Tried in order when resolving an extensionless relative import.
+_JS_EXTENSIONS: tuple[str, ...] = (".ts", ".tsx", ".d.ts", ".js", ".jsx", ".mjs", ".cjs")
+
+_RUST_STDLIB_CRATES: frozenset[str] = frozenset({"alloc", "core", "proc_macro", "std", "test"})
+
+# Libraries shipped with Ruby (default gems included), by top-level feature.
+_RUBY_STDLIB: frozenset[str] = frozenset({
+    "abbrev", "base64", "benchmark", "bigdecimal", "cgi", "coverage", "csv", "date", "delegate",
+    "digest", "English", "erb", "etc", "fcntl", "fiddle", "fileutils", "find", "forwardable",
+    "getoptlong", "io", "ipaddr", "json", "logger", "monitor", "net", "objspace", "observer",
+    "open-uri", "open3", "openssl", "optparse", "ostruct", "pathname", "pp", "prettyprint",
+    "pstore", "psych", "racc", "rbconfig", "readline", "reline", "resolv", "ripper",
+    "securerandom", "set", "shellwords", "singleton", "socket", "stringio", "strscan",
+    "syslog", "tempfile", "time", "timeout", "tmpdir", "tsort", "un", "uri", "weakref",
+    "yaml", "zlib",
+})
+
+_JAVA_STDLIB_PREFIXES: tuple[str, ...] = ("java.", "javax.", "jdk.", "sun.", "com.sun.")
+
+_C_LANGUAGES: frozenset[str] = frozenset({"c", "cpp"})
+
+# Languages whose imports name files, resolved like C includes.
+_INCLUDING_LANGUAGES: frozenset[str] = _C_LANGUAGES | {"protobuf", "thrift"}
+
+# Languages of generated code ``generates`` edges lead to.
+_GENERATED_LANGUAGES: frozenset[str] = _JS_LANGUAGES | {"go"}
+
+# Headers of the C and C++ standard libraries, plus common POSIX ones.
+_C_STDLIB_HEADERS: frozenset[str] = frozenset({
+    "assert.h", "complex.h", "ctype.h", "errno.h", "fenv.h", "float.h", "inttypes.h",
+    "iso646.h", "limits.h", "locale.h", "math.h", "setjmp.h", "signal.h", "stdalign.h",
+    "stdarg.h", "stdatomic.h", "stdbool.h", "stddef.h", "stdint.h", "stdio.h", "stdlib.h",
+    "stdnoreturn.h", "string.h", "tgmath.h", "threads.h", "time.h", "uchar.h", "wchar.h",
+    "wctype.h",
+    "dirent.h", "dlfcn.h", "fcntl.h", "poll.h", "pthread.h", "sched.h", "semaphore.h",
+    "strings.h", "termios.h", "unistd.h",
+    "algorithm", "any", "array", "atomic", "bit", "bitset", "cassert", "cctype", "cerrno",
+    "cfloat", "charconv", "chrono", "cinttypes", "climits", "clocale", "cmath", "compare",
+    "complex", "concepts", "condition_variable", "coroutine", "csetjmp", "csignal",
+    "cstdarg", "cstddef", "cstdint", "cstdio", "cstdlib", "cstring", "ctime", "cwchar",
+    "cwctype", "deque", "exception", "execution", "expected", "filesystem", "format",
+    "forward_list", "fstream", "functional", "future", "initializer_list", "iomanip", "ios",
+    "iosfwd", "iostream", "istream", "iterator", "limits", "list", "locale", "map", "memory",
+    "memory_resource", "mutex", "new", "numbers", "numeric", "optional", "ostream", "queue",
+    "random", "ranges", "ratio", "regex", "scoped_allocator", "set", "shared_mutex", "span",
+    "sstream", "stack", "stdexcept", "string", "string_view", "system_error", "thread",
+    "tuple", "type_traits", "typeindex", "typeinfo", "unordered_map", "unordered_set",
+    "utility", "valarray", "variant", "vector", "version",
+})
+
+
+def _python_root(path: str) -> str:
+    """Directory from which the top-level package containing *path* is imported."""
+    directory: str = os.path.dirname(path)
+    while os.path.basename(directory) not in ("", ".", "..") and os.path.isfile(
+        os.path.join(directory, "__init__.py"),
+    ):
+        directory = os.path.dirname(directory)
+    return directory
+
+
+def _rust_segments(name: str) -> list[str]:
+    """Leading path of a ``use`` argument: ``crate::a::{b, c}`` is [crate, a]."""
+    match: re.Match[str] | None = re.match(r"(?:::)?([\w:]*)", name)
+    return [s for s in match.group(1).split("::") if s] if match is not None else []
+
+
+def import_origin(
+    language: str, path: str, name: str, package: str | None = None, system: bool = False,
+    relative: bool = False,
+) -> str | None:
+    """Classify an import of *name* from the file at *path*.
+
+    Returns ``"stdlib"``, ``"third-party"``, or ``"internal"``, or *None*
+    for languages whose imports are not classified.  *package* is the
+    importing file's Java package, if any; *system* marks ``#include <...>``
+    and *relative* Ruby's ``require_relative``.
+    """
+    if language == "go":
+        if _go_package_dir(os.path.dirname(path), name) is not None:
+            return "internal"
+        return "third-party" if "." in name.split("/")[0] else "stdlib"
+    if language == "python":
+        if name.startswith("."):
+            return "internal"
+        top: str = name.split(".")[0]
+        root: str = _python_root(path)
+        # A local module shadows a standard one of the same name.
+        if os.path.isdir(os.path.join(root, top)) or os.path.isfile(
+            os.path.join(root, top + ".py"),
+        ):
+            return "internal"
+        return "stdlib" if top in sys.stdlib_module_names else "third-party"
+    if language in _JS_LANGUAGES:
+        if name.startswith((".", "/")):
+            return "internal"
+        if name.startswith("node:") or name.split("/")[0] in _NODE_BUILTINS:
+            return "stdlib"
+        return "third-party"
+    if language == "rust":
+        segments: list[str] = _rust_segments(name)
+        if not segments:
+            return None
+        if segments[0] in ("crate", "self", "super"):
+            return "internal"
+        return "stdlib" if segments[0] in _RUST_STDLIB_CRATES else "third-party"
+    if language in _C_LANGUAGES:
+        if name in _C_STDLIB_HEADERS or name.startswith(("sys/", "arpa/", "netinet/")):
+            return "stdlib"
+        # "quoted" includes are searched next to the includer first.
+        return "third-party" if system else "internal"
+    if language == "java":
+        if name.startswith(_JAVA_STDLIB_PREFIXES):
+            return "stdlib"
+        # Without a build file, a shared organization prefix (com.example) marks
+        # code from the same project.
+        if package is not None and name.split(".")[:2] == package.split(".")[:2]:
+            return "internal"
+        return "third-party"
+    if language in ("protobuf", "thrift"):
+        return "stdlib" if name.startswith("google/protobuf/") else "internal"
+    if language == "ruby":
+        if relative:
+            return "internal"
+        return "stdlib" if name.split("/")[0] in _RUBY_STDLIB else "third-party"
+    if language == "bash":
+        # Paths still holding expansions, and files outside the tree, are not classified.
+        return None if "$" in name or name.startswith(("/", "~")) else "internal"
+    return None
+
+
+@dataclass
+class _GoType:
+    """What the linker keeps of a Go type declaration."""
+
+    id: int
+    methods: dict[str, str] | None  # interfaces only: name -> unqualified signature
+    embeds: list[tuple[str, str] | None]  # (package dir, name); None if not analyzable
+    constraint: bool = False  # a type set (~int | float64), not a method set
+
+
+_GO_QUALIFIER_RE: re.Pattern[str] = re.compile(r"\b[^\W\d]\w*\.(?=[^\W\d])")
+
+
+def _go_unqualified(signature: str) -> str:
+    """Drop package qualifiers, which differ between the declaring packages."""
+    return _GO_QUALIFIER_RE.sub("", signature)
+
+
+class Linker:
+    """Accumulates declarations and references, then resolves them.
+
+    Only small per-file indexes are kept, so files can be streamed through
+    :meth:`add` without holding every entity in memory.  References and
+    edges are held in spools sharing *max_memory* bytes, if given (see
+    spilling).
+    """
+
+    def __init__(
+        self, kinds: Iterable[str], max_memory: int | None = None,
+        clone_threshold: float = DEFAULT_THRESHOLD, min_confidence: float = 0.0,
+    ) -> None:
+        self.kinds: frozenset[str] = frozenset(kinds)
+        self.clone_threshold: float = clone_threshold
+        self.min_confidence: float = min_confidence
+        # Pending references, resolved references, table references, identifier
+        # uses, and edges.
+        self._spool_memory: int | None = max_memory // 5 if max_memory is not None else None
+        # (language, package dir, name) -> function ids
+        self._functions: dict[tuple[str, str, str], list[int]] = defaultdict(list)
+        # (language, package dir, name) -> ids of generic functions and types
+        self._generics: dict[tuple[str, str, str], list[int]] = defaultdict(list)
+        # (unresolved reference, language, package dir, {alias: import path})
+        self._pending: Spool[tuple[Edge, str, str, dict[str, str]]] = Spool(self._spool_memory)
+        # Plugin edges, and handlers resolved per file
+        self._resolved: Spool[Edge] = Spool(self._spool_memory)
+        # Indexes of analyzed files for resolving imports.
+        self._paths: dict[str, int] = {}  # normalized path -> file id
+        self._package_files: dict[tuple[str, str], list[int]] = defaultdict(list)
+        self._python_modules: dict[str, int] = {}  # dotted module -> file id
+        self._java_types: dict[str, int] = {}  # qualified top-level type -> file id
+        self._java_packages: dict[str, list[int]] = defaultdict(list)
+        self._header_paths: dict[str, list[str]] = defaultdict(list)  # basename -> paths
+        # (import entity, importing file entity), for internal imports only
+        self._imports: list[tuple[Entity, Entity]] = []
+        # (``runs`` reference, script directory)
+        self._runs: list[tuple[Edge, str]] = []
+        # (qualified name, parameter types) -> prototype ids, and definitions to match
+        self._prototypes: dict[tuple[str, tuple[str, ...]], list[int]] = defaultdict(list)
+        self._definitions: list[tuple[tuple[str, tuple[str, ...]], int]] = []
+        self._partials: dict[str, list[int]] = defaultdict(list)  # qualified name -> parts
+        # Go types by (package dir, name), and methods by (package dir, receiver type)
+        self._go_types: dict[tuple[str, str], _GoType] = {}
+        self._go_methods: dict[tuple[str, str], dict[str, tuple[str, bool]]] = defaultdict(dict)
+        # Modules of analyzed Go files (module path -> module dir), and imports
+        # that may turn out to name one of them once every file is seen.
+        self._go_modules: dict[str, str] = {}
+        self._go_foreign_imports: list[tuple[Entity, Entity]] = []
+        # Entities in test files, and the tests among them (test functions and files).
+        self._test_entities: set[int] = set()
+        self._tests: list[int] = []
+        # Manifests: (ecosystem, dir) -> (file entity, {dependency name: id}); the
+        # modules they declare, by (ecosystem, name); and each (module id,
+        # ecosystem, dependency entity).  Imports are checked against them.
+        self._manifests: dict[tuple[str, str], tuple[Entity, dict[str, int]]] = {}
+        self._declared_modules: dict[tuple[str, str], int] = {}
+        self._declarations: list[tuple[int, str, Entity]] = []
+        self._dependency_imports: list[tuple[Entity, Entity]] = []
+        # SQL tables and views by lowercased name, and the references to them.
+        self._tables: dict[str, list[int]] = defaultdict(list)
+        self._table_refs: Spool[Edge] = Spool(self._spool_memory)
+        # Schema definitions by generated name, and (entity, owner type) in generated files.
+        self._generated_index: GeneratedIndex = GeneratedIndex()
+        self._generated: list[tuple[Entity, str | None]] = []
+        # Dockerfiles by the image name they build; what runs images; Kubernetes
+        # workloads and services by namespace; ingresses; and Terraform modules
+        # with local sources, with their files.
+        self._dockerfiles: dict[str, list[int]] = defaultdict(list)
+        self._deployers: list[Entity] = []
+        self._workloads: dict[str, list[Entity]] = defaultdict(list)
+        self._services: dict[str, list[Entity]] = defaultdict(list)
+        self._ingresses: list[Entity] = []
+        self._terraform_modules: list[tuple[Entity, Entity]] = []
+        # Top-level declarations by file and name, files by (language, directory),
+        # and each (identifier use, using file, language, directory).
+        self._symbols: dict[int, dict[str, list[int]]] = {}
+        self._units: dict[tuple[str, str], list[int]] = defaultdict(list)
+        self._uses: Spool[tuple[Edge, int, str, str]] = Spool(self._spool_memory)
+        # Function signatures for clone detection (see cloning), by language.
+        self._signatures: dict[str, list[tuple[int, list[int]]]] = defaultdict(list)
+        self._linked: frozenset[str] = self.kinds.union(
+            *(_DERIVED_FROM[k] for k in self.kinds if k in _DERIVED_FROM),
+        )
+
+    def add(self, entities: list[Entity], references: list[Edge]) -> None:
+        """Index one file's declarations and queue its references."""
+        if not entities:
+            return
+        file_entity: Entity = entities[0]
+        language: str = file_entity.language
+        package: str = os.path.normpath(os.path.dirname(file_entity.path))
+        imports: dict[str, str] = {}
+        if language == "go":
+            module: tuple[str, str] | None = _go_module(package)
+            if module is not None:
+                self._go_modules.setdefault(module[1], module[0])
+        for entity in entities:
+            if "type_parameters" in entity.attrs:
+                self._generics[(language, package, entity.name)].append(entity.id)
+            if entity.kind == "function":
+                self._functions[(language, package, entity.name)].append(entity.id)
+            elif entity.kind == "import" and language == "go":
+                alias: str = entity.attrs.get("alias") or entity.name.rsplit("/", 1)[-1]
+                imports[alias] = entity.name
+        local: dict[str, list[int]] = defaultdict(list)
+        if "handles" in self.kinds and language != "go":
+            for entity in entities:
+                if entity.kind in ("function", "method"):
+                    local[entity.name].append(entity.id)
+        generics: dict[str, list[int]] = defaultdict(list)
+        if "instantiates" in self.kinds and language != "go":
+            for entity in entities:
+                if "type_parameters" in entity.attrs:
+                    generics[entity.name].append(entity.id)
+        for ref in references:
+            if ref.kind == "clone-of" and ref.target is None:
+                if "clone-of" in self.kinds:
+                    self._signatures[language].append((ref.source, ref.attrs["signature"]))
+            elif ref.target is not None:
+                ref.attrs.setdefault("provenance", "plugin")
+                self._resolved.append(ref)
+            elif ref.kind == "handles" and language != "go":
+                # Handlers outside Go are resolved in the registering file only, by
+                # name; *local* stays empty unless handles edges were requested.
+                attrs: dict[str, Any] = {k: v for k, v in ref.attrs.items() if k != "name"}
+                attrs.update(provenance="heuristic", confidence=0.8)
+                self._resolved.extend(
+                    Edge(ref.kind, ref.source, target, dict(attrs))
+                    for target in local.get(ref.attrs["name"], [])
+                )
+            elif ref.kind == "instantiates" and language != "go":
+                # Outside Go, instantiations are resolved in their own file only.
+                attrs = {k: v for k, v in ref.attrs.items() if k != "name"}
+                attrs.update(provenance="heuristic", confidence=0.9)
+                self._resolved.extend(
+                    Edge(ref.kind, ref.source, target, dict(attrs))
+                    for target in generics.get(ref.attrs["name"], [])
+                )
+            elif ref.kind in ("reads", "writes"):
+                if ref.kind in self.kinds:
+                    self._table_refs.append(ref)
+            elif ref.kind == "runs":
+                if ref.kind in self.kinds:
+                    self._runs.append((ref, package))
+            elif ref.kind == "references":
+                if ref.kind in self.kinds:
+                    self._uses.append((ref, file_entity.id, language, package))
+            elif ref.kind in self._linked:
+                self._pending.append((ref, language, package, imports))
+        if "references" in self.kinds:
+            self._add_symbols(entities, package)
+        if "imports" in self._linked:
+            self._add_imports(entities, package)
+        if {"depends", "uses"} & self.kinds and os.path.basename(file_entity.path) in MANIFESTS:
+            self._add_manifest(entities, package)
+        if "uses" in self.kinds and language in LANGUAGE_ECOSYSTEMS:
+            self._dependency_imports.extend(
+                (e, file_entity) for e in entities if e.kind in ("import", "use")
+            )
+        if {"reads", "writes"} & self.kinds and language == "sql":
+            for entity in entities:
+                if entity.kind in ("table", "view"):
+                    name: str = entity.name.lower()
+                    self._tables[name].append(entity.id)
+                    if "." in name:  # public.users is also users
+                        self._tables[name.rsplit(".", 1)[-1]].append(entity.id)
+        if {"deploys", "imports", "routes", "selects"} & self.kinds and language in (
+            "dockerfile", "hcl", "yaml",
+        ):
+            self._add_infrastructure(entities)
+        if "generates" in self.kinds and language in IDL_LANGUAGES:
+            self._generated_index.add(entities, qualified_names(entities))
+        elif (
+            "generates" in self.kinds and language in _GENERATED_LANGUAGES
+            and is_generated_path(file_entity.path)
+        ):
+            self._add_generated(entities)
+        if "tests" in self.kinds and is_test_path(file_entity.path):
+            self._test_entities.update(e.id for e in entities)
+            self._tests.extend(
+                e.id for e in entities if e.kind == "file" or is_entry_point(e)
+            )
+        if "defines" in self.kinds and language in _C_LANGUAGES:
+            self._add_declarations(entities)
+        if "implements" in self.kinds and language == "go":
+            self._add_go_types(entities, package, imports)
+        if "partial" in self.kinds and language == "c_sharp":
+            names: dict[int, str] = qualified_names(entities)
+            for entity in entities:
+                if entity.attrs.get("partial") and entity.kind not in ("function", "method"):
+                    self._partials[names[entity.id]].append(entity.id)
+
+    def _add_symbols(self, entities: list[Entity], package: str) -> None:
+        """Index a file's top-level declarations for ``references`` edges."""
+        file_entity: Entity = entities[0]
+        containers: set[int] = {file_entity.id}
+        symbols: dict[str, list[int]] = defaultdict(list)
+        for entity in entities[1:]:
+            if entity.parent not in containers:
+                continue
+            if entity.kind in _TOP_LEVEL_CONTAINERS:
+                containers.add(entity.id)
+            if entity.kind not in _UNREFERENCED_KINDS:
+                symbols[entity.name].append(entity.id)
+        self._symbols[file_entity.id] = dict(symbols)
+        self._units[(file_entity.language, package)].append(file_entity.id)
+
+    def _add_declarations(self, entities: list[Entity]) -> None:
+        """Index C/C++ prototypes and the definitions that may implement them."""
+        names: dict[int, str] = qualified_names(entities)
+        for entity in entities:
+            if entity.kind not in ("function", "method") or "parameters" not in entity.attrs:
+                continue
+            # Foo::bar defined out of class matches bar declared in class Foo.
+            key: tuple[str, tuple[str, ...]] = (
+                names[entity.id].replace("::", "."), tuple(entity.attrs["parameters"]),
+            )
+            if entity.attrs.get("declaration"):
+                self._prototypes[key].append(entity.id)
+            else:
+                self._definitions.append((key, entity.id))
+
+    def _add_manifest(self, entities: list[Entity], package: str) -> None:
+        """Index a package manifest's module and the dependencies it declares."""
+        if len(entities) < 2 or entities[1].kind != "module":
+            return  # malformed: only its file entity was kept
+        module: Entity = entities[1]
+        ecosystem: str = module.attrs["ecosystem"]
+        dependencies: list[Entity] = [e for e in entities if e.kind == "dependency"]
+        self._manifests[(ecosystem, package)] = (
+            entities[0], {e.name: e.id for e in dependencies},
+        )
+        self._declared_modules.setdefault((ecosystem, module.name), module.id)
+        self._declarations.extend((module.id, ecosystem, e) for e in dependencies)
+
+    def _add_generated(self, entities: list[Entity]) -> None:
+        """Queue a generated file's top-level declarations and methods, by owner type."""
+        file_entity: Entity = entities[0]
+        by_id: dict[int, Entity] = {e.id: e for e in entities}
+        for entity in entities:
+            if entity.kind in ("file", "import"):
+                continue
+            owner: str | None = entity.attrs.get("receiver")
+            if owner is None and entity.parent != file_entity.id:
+                parent: Entity | None = by_id.get(entity.parent)  # type: ignore[arg-type]
+                if parent is None or parent.parent != file_entity.id:
+                    continue  # only members of top-level types
+                owner = parent.name
+            self._generated.append((entity, owner))
+
+    def _add_infrastructure(self, entities: list[Entity]) -> None:
+        """Index a Dockerfile, Kubernetes manifest, or Terraform file."""
+        file_entity: Entity = entities[0]
+        if file_entity.language == "dockerfile":
+            for name in image_names(file_entity.path):
+                self._dockerfiles[name.lower()].append(file_entity.id)
+            return
+        for entity in entities:
+            if "images" in entity.attrs:
+                self._deployers.append(entity)
+            namespace: str = entity.attrs.get("namespace", "default")
+            if file_entity.language == "hcl":
+                source: str = entity.attrs.get("source", "")
+                if entity.kind == "module" and source.startswith(("./", "../")):
+                    self._terraform_modules.append((entity, file_entity))
+            elif entity.kind in WORKLOAD_KINDS and "pod_labels" in entity.attrs:
+                self._workloads[namespace].append(entity)
+            elif entity.kind == "service":
+                self._services[namespace].append(entity)
+            elif entity.kind == "ingress":
+                self._ingresses.append(entity)
+
+    def _add_go_types(
+        self, entities: list[Entity], package: str, imports: dict[str, str],
+    ) -> None:
+        """Index Go type declarations and methods for interface satisfaction."""
+        for entity in entities:
+            if entity.kind == "method" and "receiver" in entity.attrs:
+                self._go_methods[(package, entity.attrs["receiver"])][entity.name] = (
+                    _go_unqualified(entity.attrs.get("signature", "")),
+                    bool(entity.attrs.get("pointer_receiver")),
+                )
+            elif entity.kind in ("interface", "struct", "type") and entity.parent == entities[0].id:
+                # Only package-level types can have methods.
+                embeds: list[tuple[str, str] | None] = []
+                for name in entity.attrs.get("embeds", []):
+                    qualifier, _, base = name.rpartition(".")
+                    scope: str | None = package
+                    if qualifier:
+                        import_path: str | None = imports.get(qualifier)
+                        scope = _go_package_dir(package, import_path) if import_path else None
+                    embeds.append((scope, base) if scope is not None else None)
+                methods: dict[str, str] | None = None
+                if entity.kind == "interface":
+                    methods = {
+                        name: _go_unqualified(signature)
+                        for name, signature in entity.attrs.get("methods", {}).items()
+                    }
+                self._go_types[(package, entity.name)] = _GoType(
+                    entity.id, methods, embeds, bool(entity.attrs.get("constraint")),
+                )
+
+    def _add_imports(self, entities: list[Entity], package: str) -> None:
+        """Index a file for import resolution and classify its imports."""
+        file_entity: Entity = entities[0]
+        language: str = file_entity.language
+        self._paths[os.path.normpath(file_entity.path)] = file_entity.id
+        if language in _INCLUDING_LANGUAGES:
+            self._header_paths[os.path.basename(file_entity.path)].append(
+                os.path.normpath(file_entity.path),
+            )
+        self._package_files[(language, package)].append(file_entity.id)
+        if "module" in file_entity.attrs:
+            self._python_modules[file_entity.attrs["module"]] = file_entity.id
+        java_package: str | None = next(
+            (e.name for e in entities if e.kind == "package"), None,
+        )
+        if language == "java":
+            self._java_packages[java_package or ""].append(file_entity.id)
+        for entity in entities:
+            if language == "java" and entity.parent == file_entity.id and entity.kind in (
+                "class", "enum", "interface",
+            ):
+                qualified: str = f"{java_package}.{entity.name}" if java_package else entity.name
+                self._java_types[qualified] = file_entity.id
+            if entity.kind not in ("import", "use"):
+                continue
+            origin: str | None = import_origin(
+                language, file_entity.path, entity.name, java_package,
+                bool(entity.attrs.get("system")), bool(entity.attrs.get("relative")),
+            )
+            if origin is None:
+                continue
+            entity.attrs["origin"] = origin
+            if origin == "internal":
+                self._imports.append((entity, file_entity))
+            elif language == "go":
+                self._go_foreign_imports.append((entity, file_entity))
+
+    def resolve(self) -> Spool[Edge]:
+        """Return an edge for every reference that names a known entity."""
+        edges: Spool[Edge] = Spool(self._spool_memory)
+        edges.extend(self._resolved)
+        for ref, language, package, imports in self._pending:
+            name: str = ref.attrs["name"]
+            qualifier: str | None = ref.attrs.get("qualifier")
+            scope: str | None = package
+            if qualifier is not None:
+                import_path: str | None = imports.get(qualifier)
+                if import_path is None:
+                    continue  # method call on a value, or an unknown package
+                scope = self._go_scope(package, import_path)
+                if scope is None:
+                    continue  # stdlib or third-party
+            attrs: dict[str, Any] = {
+                k: v for k, v in ref.attrs.items() if k not in ("name", "qualifier")
+            }
+            targets: dict[tuple[str, str, str], list[int]] = (
+                self._generics if ref.kind == "instantiates" else self._functions
+            )
+            for target in targets.get((language, scope, name), []):
+                edges.append(Edge(ref.kind, ref.source, target, dict(attrs)))
+        for entity, file_entity in self._go_foreign_imports:
+            if self._go_scope(os.path.dirname(file_entity.path), entity.name) is not None:
+                entity.attrs["origin"] = "internal"
+                self._imports.append((entity, file_entity))
+        seen: set[tuple[int, int]] = set()
+        for entity, file_entity in self._imports:
+            for target in self._import_targets(entity, file_entity):
+                if target == file_entity.id or (file_entity.id, target) in seen:
+                    continue
+                seen.add((file_entity.id, target))
+                edges.append(Edge(
+                    "imports", file_entity.id, target, {"import": entity.name, "row": entity.row},
+                ))
+        for ref, directory in self._runs:
+            attrs = {k: v for k, v in ref.attrs.items() if k != "name"}
+            attrs["command"] = ref.attrs["name"]
+            edges.extend(
+                Edge("runs", ref.source, target, dict(attrs))
+                for target in self._script_targets(ref.attrs["name"], directory)
+            )
+        edges.extend(self._dependency_edges())
+        edges.extend(self._table_edges())
+        if "references" in self.kinds:
+            edges.extend(self._reference_edges(seen))
+        edges.extend(self._infrastructure_edges())
+        for key, definition in self._definitions:
+            for prototype in self._prototypes.get(key, []):
+                edges.append(Edge("defines", definition, prototype, {}))
+        for first, *rest in self._partials.values():
+            edges.extend(Edge("partial", part, first, {}) for part in rest)
+        edges.extend(self._implements())
+        for signatures in self._signatures.values():
+            edges.extend(
+                Edge("clone-of", clone, original, {
+                    "similarity": round(score, 2), "provenance": "heuristic",
+                    "confidence": round(score, 2),
+                })
+                for clone, original, score in clones(signatures, self.clone_threshold)
+            )
+        for generated, owner in self._generated:
+            edges.extend(
+                Edge("generates", source, generated.id, {})
+                for source in self._generated_index.sources(generated, owner)
+            )
+        if "tests" in self.kinds:
+            edges.extend(self._test_edges(edges))
+        # Edges only resolved to derive others are dropped again; edges given
+        # by plugins are kept.
+        unrequested: frozenset[str] = self._linked - self.kinds
+        kept: Spool[Edge] = Spool(self._spool_memory)
+        kept.extend(
+            e for e in itertools.chain(
+                self._resolved,
+                (
+                    e for e in itertools.islice(edges, len(self._resolved), None)
+                    if e.kind not in unrequested
+                ),
+            )
+            if _tagged(e).attrs["confidence"] >= self.min_confidence
+        )
+        return kept
+
+    def _dependency_edges(self) -> list[Edge]:
+        """``depends`` edges from manifests, and ``uses`` edges from the imports they govern."""
+        edges: list[Edge] = []
+        if "depends" in self.kinds:
+            for module, dependency_ecosystem, dependency in self._declarations:
+                target: int = self._declared_modules.get(
+                    (dependency_ecosystem, dependency.name), dependency.id,
+                )
+                edges.append(Edge("depends", module, target, {
+                    "dependency": dependency.name, "scope": dependency.attrs["scope"],
+                }))
+        seen: set[tuple[int, int]] = set()
+        for entity, file_entity in self._dependency_imports:
+            if entity.attrs.get("origin") == "stdlib":
+                continue
+            ecosystem: str = LANGUAGE_ECOSYSTEMS[file_entity.language]
+            manifest: tuple[Entity, dict[str, int]] | None = governing(
+                os.path.dirname(file_entity.path), ecosystem, self._manifests,
+            )
+            if manifest is None:
+                continue
+            used: int | None = dependency_for(ecosystem, entity.name, manifest[1])
+            if used is None:
+                if entity.attrs.get("origin") == "third-party":
+                    entity.attrs["undeclared"] = manifest[0].path
+            elif (file_entity.id, used) not in seen:
+                seen.add((file_entity.id, used))
+                edges.append(Edge(
+                    "uses", file_entity.id, used, {"import": entity.name, "row": entity.row},
+                ))
+        return edges
+
+    def _declared(self, files: Iterable[int], name: str) -> list[int]:
+        return [d for f in files for d in self._symbols.get(f, {}).get(name, [])]
+
+    def _reference_edges(self, imported: set[tuple[int, int]]) -> list[Edge]:
+        """``references`` edges from identifier uses to the declarations they name."""
+        imports: dict[int, list[int]] = defaultdict(list)
+        for importer, target in sorted(imported):
+            imports[importer].append(target)
+        edges: list[Edge] = []
+        seen: set[tuple[int, int]] = set()
+        for ref, file_id, language, package in self._uses:
+            name: str = ref.attrs["name"]
+            confidence: float = 1.0
+            targets: list[int] = self._declared([file_id], name)
+            if not targets:
+                others: list[int] = [f for f in self._units[(language, package)] if f != file_id]
+                shared: bool = language in _PACKAGE_SCOPED
+                # Package-scoped names are visible without an import, others only through one.
+                for files in ([others, imports[file_id]] if shared else [imports[file_id]]):
+                    targets = self._declared(files, name)
+                    if targets:
+                        break
+                if not targets and not shared:
+                    targets = self._declared(others, name)
+                    if len(targets) > 1:
+                        continue  # too common a name to guess
+                    confidence = _UNIMPORTED
+                elif len(targets) > 1:
+                    confidence = _AMBIGUOUS
+            for target in targets:
+                if target == ref.source or (ref.source, target) in seen:
+                    continue
+                seen.add((ref.source, target))
+                edges.append(Edge("references", ref.source, target, {
+                    "row": ref.attrs["row"], "col": ref.attrs["col"],
+                    "provenance": "exact" if confidence == 1.0 else "heuristic",
+                    "confidence": confidence,
+                }))
+        return edges
+
+    def _table_edges(self) -> list[Edge]:
+        """``reads`` and ``writes`` edges to the tables and views references name."""
+        edges: list[Edge] = []
+        for ref in self._table_refs:
+            name: str = ref.attrs["name"].lower()
+            tables: list[int] = self._tables.get(name) or self._tables.get(
+                name.rsplit(".", 1)[-1], [],
+            )
+            attrs: dict[str, Any] = {k: v for k, v in ref.attrs.items() if k != "name"}
+            edges.extend(
+                Edge(ref.kind, ref.source, table, {"table": ref.attrs["name"], **attrs})
+                for table in tables
+            )
+        return edges
+
+    def _infrastructure_edges(self) -> list[Edge]:
+        """``deploys``, ``selects``, and ``routes`` edges, and Terraform module imports."""
+        edges: list[Edge] = []
+        if "deploys" in self.kinds:
+            for entity in self._deployers:
+                for image in entity.attrs["images"]:
+                    edges.extend(
+                        Edge("deploys", entity.id, dockerfile, {"image": image})
+                        for dockerfile in self._dockerfiles.get(image_key(image), [])
+                    )
+        if "selects" in self.kinds:
+            for namespace, services in self._services.items():
+                for service in services:
+                    selector: dict[str, str] = service.attrs.get("selector", {})
+                    edges.extend(
+                        Edge("selects", service.id, workload.id, {})
+                        for workload in self._workloads.get(namespace, [])
+                        if selector and selector.items() <= workload.attrs["pod_labels"].items()
+                    )
+        if "routes" in self.kinds:
+            for ingress in self._ingresses:
+                namespace = ingress.attrs.get("namespace", "default")
+                by_name: dict[str, int] = {s.name: s.id for s in self._services.get(namespace, [])}
+                edges.extend(
+                    Edge("routes", ingress.id, by_name[backend], {})
+                    for backend in ingress.attrs.get("backends", []) if backend in by_name
+                )
+        if "imports" in self.kinds:
+            for module, file_entity in self._terraform_modules:
+                directory: str = os.path.normpath(os.path.join(
+                    os.path.dirname(file_entity.path), module.attrs["source"],
+                ))
+                edges.extend(
+                    Edge("imports", file_entity.id, target, {
+                        "import": module.attrs["source"], "row": module.row,
+                    })
+                    for target in self._package_files.get(("hcl", directory), [])
+                )
+        return edges
+
+    def _test_edges(self, edges: Iterable[Edge]) -> list[Edge]:
+        """A ``tests`` edge from each test to the code outside tests it reaches."""
+        successors: dict[int, set[int]] = defaultdict(set)
+        for edge in edges:
+            if (
+                edge.kind in _TESTED_THROUGH and edge.target is not None
+                and edge.source in self._test_entities
+            ):
+                successors[edge.source].add(edge.target)
+        tests: list[Edge] = []
+        for test in self._tests:
+            seen: set[int] = {test}
+            stack: list[int] = [test]
+            tested: set[int] = set()
+            while stack:
+                for target in successors.get(stack.pop(), ()):
+                    if target in seen:
+                        continue
+                    seen.add(target)
+                    if target in self._test_entities:
+                        stack.append(target)  # a helper; follow what it uses
+                    else:
+                        tested.add(target)
+            tests.extend(Edge("tests", test, target, {}) for target in sorted(tested))
+        return tests
+
+    def _go_scope(self, directory: str, import_path: str) -> str | None:
+        """The package directory of *import_path*, in the importer's module or an analyzed one."""
+        scope: str | None = _go_package_dir(directory, import_path)
+        if scope is not None:
+            return scope
+        # The longest module path wins, for modules nested in other modules.
+        for module_path in sorted(self._go_modules, key=len, reverse=True):
+            if import_path == module_path or import_path.startswith(module_path + "/"):
+                return os.path.normpath(os.path.join(
+                    self._go_modules[module_path], import_path[len(module_path) :].lstrip("/"),
+                ))
+        return None
+
+    # -- Go interface satisfaction ------------------------------------------
+
+    def _interface_methods(
+        self, key: tuple[str, str], seen: frozenset[tuple[str, str]] = frozenset(),
+    ) -> dict[str, str] | None:
+        """An interface's full method set; *None* if part of it is not analyzed."""
+        declared: _GoType | None = self._go_types.get(key)
+        if declared is None or declared.methods is None or declared.constraint or key in seen:
+            return None
+        methods: dict[str, str] = dict(declared.methods)
+        for embed in declared.embeds:
+            inherited: dict[str, str] | None = (
+                self._interface_methods(embed, seen | {key}) if embed is not None else None
+            )
+            if inherited is None:
+                return None
+            methods.update(inherited)
+        return methods
+
+    def _type_methods(
+        self, key: tuple[str, str], seen: frozenset[tuple[str, str]] = frozenset(),
+    ) -> dict[str, tuple[str, bool]]:
+        """A concrete type's methods, own and promoted: name -> (signature, pointer only)."""
+        if key in seen:
+            return {}
+        methods: dict[str, tuple[str, bool]] = {}
+        declared: _GoType | None = self._go_types.get(key)
+        for embed in declared.embeds if declared is not None else []:
+            if embed is None:
+                continue
+            interface: dict[str, str] | None = self._interface_methods(embed)
+            if interface is not None:
+                methods.update((name, (sig, False)) for name, sig in interface.items())
+            else:
+                methods.update(self._type_methods(embed, seen | {key}))
+        methods.update(self._go_methods.get(key, {}))  # own methods shadow promoted ones
+        return methods
+
+    def _implements(self) -> list[Edge]:
+        """``implements`` edges from Go types to the interfaces they satisfy."""
+        interfaces: list[tuple[tuple[str, str], int, dict[str, str]]] = []
+        for key, declared in self._go_types.items():
+            methods: dict[str, str] | None = self._interface_methods(key)
+            if methods:  # the empty interface says nothing
+                interfaces.append((key, declared.id, methods))
+        edges: list[Edge] = []
+        for key, declared in sorted(self._go_types.items(), key=lambda item: item[1].id):
+            if declared.methods is not None:
+                continue
+            available: dict[str, tuple[str, bool]] = self._type_methods(key)
+            for interface_key, interface_id, wanted in interfaces:
+                pointer: bool = False
+                for name, signature in wanted.items():
+                    found: tuple[str, bool] | None = available.get(name)
+                    # Unexported methods can only be satisfied inside their package.
+                    if found is None or found[0] != signature or (
+                        not name[:1].isupper() and interface_key[0] != key[0]
+                    ):
+                        break
+                    pointer = pointer or found[1]
+                else:
+                    attrs: dict[str, Any] = {"pointer": True} if pointer else {}
+                    edges.append(Edge("implements", declared.id, interface_id, attrs))
+        return edges
+
+    # -- import resolution --------------------------------------------------
+
+    def _import_targets(self, entity: Entity, file_entity: Entity) -> list[int]:
+        """File ids an internal import refers to; empty if none were analyzed."""
+        language: str = file_entity.language
+        directory: str = os.path.normpath(os.path.dirname(file_entity.path))
+        if language == "go":
+            scope: str | None = self._go_scope(directory, entity.name)
+            return list(self._package_files.get(("go", scope), [])) if scope is not None else []
+        if language == "python":
+            return self._python_targets(entity, file_entity)
+        if language in _JS_LANGUAGES:
+            base: str = os.path.normpath(os.path.join(directory, entity.name))
+            stems: list[str] = [base]
+            if base.endswith(".js"):
+                stems.append(base[:-3])  # ESM-style "./util.js" naming util.ts
+            for stem in stems:
+                for candidate in (
+                    stem,
+                    *(stem + ext for ext in _JS_EXTENSIONS),
+                    *(os.path.join(stem, "index" + ext) for ext in _JS_EXTENSIONS),
+                ):
+                    if candidate in self._paths:
+                        return [self._paths[candidate]]
+            return []
+        if language == "rust":
+            return self._rust_targets(entity, file_entity)
+        if language in _INCLUDING_LANGUAGES:
+            return self._include_targets(entity.name, directory)
+        if language == "bash":
+            return self._script_targets(entity.name, directory)
+        if language == "ruby":
+            required: str = os.path.normpath(os.path.join(directory, entity.name))
+            for candidate in (required, required + ".rb"):
+                if candidate in self._paths:
+                    return [self._paths[candidate]]
+            return []
+        if language == "java":
+            if entity.attrs.get("wildcard"):
+                if entity.name in self._java_packages:
+                    return list(self._java_packages[entity.name])
+                target: int | None = self._java_types.get(entity.name)  # import static T.*
+                return [target] if target is not None else []
+            parts: list[str] = entity.name.split(".")
+            for cut in range(len(parts), 0, -1):  # nested types and static members
+                found: int | None = self._java_types.get(".".join(parts[:cut]))
+                if found is not None:
+                    return [found]
+        return []
+
+    def _script_targets(self, name: str, directory: str) -> list[int]:
+        """Resolve a path a shell script names, from its directory or the nearest above.
+
+        Scripts are run from where they are as often as from the top of the
+        repository, and which is not known.
+        """
+        if "$" in name or name.startswith(("/", "~")):
+            return []
+        while True:
+            candidate: str = os.path.normpath(os.path.join(directory, name))
+            if candidate in self._paths:
+                return [self._paths[candidate]]
+            parent: str = os.path.dirname(directory)
+            if directory in ("", ".") or parent == directory:
+                return []
+            directory = parent
+
+    def _include_targets(self, name: str, directory: str) -> list[int]:
+        """Resolve ``#include "name"`` next to the includer, else by unique suffix."""
+        local: str = os.path.normpath(os.path.join(directory, name))
+        if local in self._paths:
+            return [self._paths[local]]
+        # Include directories (-I) are not known, so match the path's tail.
+        suffix: str = os.path.normpath(name)
+        matches: list[str] = [
+            p for p in self._header_paths.get(os.path.basename(suffix), [])
+            if p == suffix or p.endswith(os.sep + suffix)
+        ]
+        return [self._paths[matches[0]]] if len(matches) == 1 else []
+
+    def _python_targets(self, entity: Entity, file_entity: Entity) -> list[int]:
+        module: str = entity.name
+        if module.startswith("."):
+            level: int = len(module) - len(module.lstrip("."))
+            current: str | None = file_entity.attrs.get("module")
+            package: list[str] = current.split(".") if current else []
+            if Path(file_entity.path).name != "__init__.py":
+                package = package[:-1]
+            if level - 1 > len(package):
+                return []
+            module = ".".join(
+                [*package[: len(package) - level + 1], *[p for p in [module.lstrip(".")] if p]],
+            )
+        if "names" in entity.attrs:
+            # from pkg import sub: prefer submodules, else the module itself.
+            submodules: list[int] = [
+                self._python_modules[qualified]
+                for name in entity.attrs["names"]
+                if (qualified := ".".join(p for p in (module, name) if p)) in self._python_modules
+            ]
+            if submodules:
+                return submodules
+        targets: list[int] = []
+        for imported in entity.attrs.get("modules", [module]):
+            parts: list[str] = imported.split(".")
+            for cut in range(len(parts), 0, -1):
+                found: int | None = self._python_modules.get(".".join(parts[:cut]))
+                if found is not None:
+                    targets.append(found)
+                    break
+        return targets
+
+    def _rust_targets(self, entity: Entity, file_entity: Entity) -> list[int]:
+        segments: list[str] = _rust_segments(entity.name)
+        parts: list[str] = os.path.normpath(file_entity.path).split(os.sep)
+        directories: list[str] = parts[:-1]
+        # The crate root is the innermost src/ directory, else the file's own.
+        root: list[str] = directories
+        if "src" in directories:
+            root = directories[: len(directories) - directories[::-1].index("src")]
+        stem: str = Path(parts[-1]).stem
+        current: list[str] = directories[len(root) :]
+        if stem != "mod" and not (stem in ("lib", "main") and not current):
+            current = [*current, stem]
+        head, rest = segments[0], segments[1:]
+        module: list[str]
+        if head == "crate":
+            module = []
+        elif head == "self":
+            module = current
+        elif head == "super":
+            module = current[:-1]
+            while rest and rest[0] == "super":
+                module, rest = module[:-1], rest[1:]
+        else:
+            return []
+        for cut in range(len(rest), -1, -1):
+            path: list[str] = [*root, *module, *rest[:cut]]
+            if not path[len(root) :]:
+                candidates: list[str] = [
+                    os.path.join(*root, "lib.rs"), os.path.join(*root, "main.rs"),
+                ]
+            else:
+                candidates = [os.path.join(*path) + ".rs", os.path.join(*path, "mod.rs")]
+            for candidate in candidates:
+                if os.path.normpath(candidate) in self._paths:
+                    return [self._paths[os.path.normpath(candidate)]]
+        return []
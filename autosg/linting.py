@@ -0,0 +1,285 @@
+"""Findings about the code and their output formats, for the ``lint`` command.
+
+A finding points at a span of a file: a function over a size or
+complexity limit, a file in a dependency cycle, or a string literal that
+looks like a hard-coded secret.  Findings are written
+as text (``path:row:col: level: message [rule]``), JSON, or SARIF 2.1.0
+for GitHub code scanning and other CI annotation tools.
+"""
+
+from __future__ import annotations
+
+import json
+import os
+from dataclasses import asdict, dataclass, field
+from pathlib import Path
+from typing import Any, TextIO
+
+from .analysis import Analysis
+from .exporting import strongly_connected_components
+from .extracting import Edge, Entity, qualified_names
+
+LINT_FORMATS: tuple[str, ...] = ("json", "sarif", "text")
+
+SARIF_VERSION: str = "2.1.0"
+_SARIF_SCHEMA: str = "https://json.schemastore.org/sarif-2.1.0.json"
+
+
+@dataclass
+class Rule:
+    id: str
+    description: str
+    level: str = "warning"  # SARIF levels: "error", "warning", "note"
+
+
+RULES: dict[str, Rule] = {
+    rule.id: rule
+    for rule in (
+        Rule("function-too-long", "Function has more lines of code than allowed."),
+        Rule("function-too-complex", "Function's cyclomatic complexity exceeds the limit."),
+        Rule("too-many-parameters", "Function declares more parameters than allowed."),
+        Rule("too-deeply-nested", "Function nests control structures too deeply."),
+        Rule("dependency-cycle", "Files depend on each other in a cycle of calls or imports."),
+        Rule("hard-coded-secret", "String literal looks like a credential.", "error"),
+    )
+}
+
+# Rule id -> the metric it limits (see measuring.py; the limit is
+# LintOptions.max_<metric>) and how messages describe it.
+_METRIC_RULES: dict[str, tuple[str, str]] = {
+    "function-too-long": ("loc", "lines of code"),
+    "function-too-complex": ("complexity", "cyclomatic complexity"),
+    "too-many-parameters": ("params", "parameters"),
+    "too-deeply-nested": ("depth", "nesting depth"),
+}
+
+
+@dataclass
+class Location:
+    """A span of a file; 1-indexed, character columns, exclusive end.
+
+    Without an end, the location is a point (e.g. a call site).
+    """
+
+    path: str
+    row: int
+    col: int
+    end_row: int | None = None
+    end_col: int | None = None
+
+    @classmethod
+    def of(cls, entity: Entity) -> Location:
+        return cls(entity.path, entity.row, entity.col, entity.end_row, entity.end_col)
+
+
+@dataclass
+class Finding:
+    rule: str  # a key of RULES
+    message: str
+    location: Location
+    level: str = "warning"
+    related: list[Location] = field(default_factory=list)
+
+
+@dataclass
+class LintOptions:
+    """Limits per function, named ``max_<metric>``; None turns a check off."""
+
+    max_loc: int | None = 100
+    max_complexity: int | None = 15
+    max_params: int | None = 6
+    max_depth: int | None = 5
+    cycles: bool = True
+    secrets: bool = False  # needs the secrets feature switched on
+
+
+# ---------------------------------------------------------------------------
+# Checks
+# ---------------------------------------------------------------------------
+
+
+def _metric_findings(entity: Entity, name: str, options: LintOptions) -> list[Finding]:
+    metrics: dict[str, int] = entity.attrs.get("metrics", {})
+    findings: list[Finding] = []
+    for rule, (metric, description) in _METRIC_RULES.items():
+        limit: int | None = getattr(options, f"max_{metric}")
+        value: int | None = metrics.get(metric)
+        if limit is None or value is None or value <= limit:
+            continue
+        findings.append(Finding(
+            rule=rule,
+            message=f"{name}: {description} {value} exceeds the limit of {limit}",
+            location=Location.of(entity),
+            level=RULES[rule].level,
+        ))
+    return findings
+
+
+def edge_location(edge: Edge, source: Entity) -> Location:
+    """Where *edge* is written: the call or import itself, else its source entity."""
+    if "row" in edge.attrs:
+        return Location(source.path, edge.attrs["row"], edge.attrs.get("col", 1))
+    return Location.of(source)
+
+
+def cycle_findings(
+    rule: str, level: str, edges: list[tuple[str, str, Location]],
+) -> list[Finding]:
+    """One finding per cycle among groups (files, packages), at the first dependency.
+
+    *edges* are (source group, target group, where the dependency is).  The
+    dependencies closing the cycle from the other groups are related locations.
+    """
+    labels: list[str] = sorted({e[0] for e in edges} | {e[1] for e in edges})
+    index: dict[str, int] = {label: i for i, label in enumerate(labels)}
+    successors: list[set[int]] = [set() for _ in labels]
+    first_edge: dict[tuple[int, int], Location] = {}
+    for source, target, location in edges:
+        pair: tuple[int, int] = (index[source], index[target])
+        if pair[0] == pair[1]:
+            continue
+        successors[pair[0]].add(pair[1])
+        if pair not in first_edge or (location.path, location.row, location.col) < (
+            first_edge[pair].path, first_edge[pair].row, first_edge[pair].col,
+        ):
+            first_edge[pair] = location
+    findings: list[Finding] = []
+    for component in strongly_connected_components(len(labels), successors):
+        if len(component) < 2:
+            continue
+        members: set[int] = set(component)
+        # Each member's first dependency on another member of the cycle.
+        closing: dict[int, int] = {
+            m: min(t for t in successors[m] if t in members) for m in component
+        }
+        start: int = component[0]
+        findings.append(Finding(
+            rule=rule,
+            message=(
+                f"Dependency cycle between {', '.join(labels[i] for i in component)}; "
+                f"{labels[start]} depends on {labels[closing[start]]} here"
+            ),
+            location=first_edge[(start, closing[start])],
+            level=level,
+            related=[first_edge[(m, closing[m])] for m in component[1:]],
+        ))
+    return findings
+
+
+def lint(analysis: Analysis, options: LintOptions) -> list[Finding]:
+    """Findings for *analysis*, ordered by location.
+
+    Cycles need resolved ``calls`` or ``imports`` edges.
+    """
+    findings: list[Finding] = []
+    entities: dict[int, Entity] = {}
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            entities[entity.id] = entity
+            findings.extend(_metric_findings(entity, names[entity.id], options))
+            if options.secrets and entity.kind == "secret":
+                findings.append(Finding(
+                    rule="hard-coded-secret",
+                    message=(
+                        f"{names.get(entity.parent, entity.path)}: possible {entity.name} "
+                        "in a string literal"
+                    ),
+                    location=Location.of(entity),
+                    level=RULES["hard-coded-secret"].level,
+                ))
+    if options.cycles:
+        file_edges: list[tuple[str, str, Location]] = []
+        for edge in analysis.edges:
+            source: Entity | None = entities.get(edge.source)
+            target: Entity | None = entities.get(edge.target) if edge.target is not None else None
+            if source is not None and target is not None and source.path != target.path:
+                file_edges.append((source.path, target.path, edge_location(edge, source)))
+        findings.extend(cycle_findings(
+            "dependency-cycle", RULES["dependency-cycle"].level, file_edges,
+        ))
+    findings.sort(key=lambda f: (f.location.path, f.location.row, f.location.col, f.rule))
+    return findings
+
+
+# ---------------------------------------------------------------------------
+# Output
+# ---------------------------------------------------------------------------
+
+
+def write_text(findings: list[Finding], out: TextIO) -> None:
+    """One ``path:row:col: level: message [rule]`` line per finding."""
+    for f in findings:
+        out.write(
+            f"{f.location.path}:{f.location.row}:{f.location.col}: "
+            f"{f.level}: {f.message} [{f.rule}]\n",
+        )
+
+
+def write_json(findings: list[Finding], out: TextIO) -> None:
+    json.dump([asdict(f) for f in findings], out, indent=2)
+    out.write("\n")
+
+
+def _sarif_location(location: Location) -> dict[str, Any]:
+    artifact: dict[str, Any] = {"uri": Path(location.path).as_posix()}
+    if os.path.isabs(location.path):
+        artifact["uri"] = Path(location.path).as_uri()
+    else:
+        artifact["uriBaseId"] = "%SRCROOT%"
+    region: dict[str, Any] = {"startLine": location.row, "startColumn": location.col}
+    if location.end_row is not None and location.end_col is not None:
+        region["endLine"] = location.end_row
+        region["endColumn"] = location.end_col
+    return {"physicalLocation": {"artifactLocation": artifact, "region": region}}
+
+
+def write_sarif(
+    findings: list[Finding], out: TextIO, rules: dict[str, Rule] | None = None,
+) -> None:
+    """A SARIF 2.1.0 log with one run; paths are relative to %SRCROOT%.
+
+    *rules* describes the rules findings refer to (default: ``RULES``).
+
+    Run autosg from the repository root so GitHub can match the paths.
+    """
+    rules = RULES if rules is None else rules
+    rule_ids: list[str] = sorted({f.rule for f in findings})
+    results: list[dict[str, Any]] = []
+    for f in findings:
+        result: dict[str, Any] = {
+            "ruleId": f.rule,
+            "ruleIndex": rule_ids.index(f.rule),
+            "level": f.level,
+            "message": {"text": f.message},
+            "locations": [_sarif_location(f.location)],
+        }
+        if f.related:
+            result["relatedLocations"] = [
+                {"id": i, **_sarif_location(loc)} for i, loc in enumerate(f.related)
+            ]
+        results.append(result)
+    log: dict[str, Any] = {
+        "$schema": _SARIF_SCHEMA,
+        "version": SARIF_VERSION,
+        "runs": [{
+            "tool": {
+                "driver": {
+                    "name": "autosg",
+                    "rules": [
+                        {
+                            "id": rule_id,
+                            "shortDescription": {"text": rules[rule_id].description},
+                            "defaultConfiguration": {"level": rules[rule_id].level},
+                        }
+                        for rule_id in rule_ids
+                    ],
+                },
+            },
+            # Entity columns count characters, not UTF-16 code units.
+            "columnKind": "unicodeCodePoints",
+            "results": results,
+        }],
+    }
+    json.dump(log, out, indent=2)
+    out.write("\n")
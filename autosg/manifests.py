@@ -0,0 +1,318 @@
+"""Package manifests: the modules a project declares and what they depend on.
+
+``go.mod``, ``package.json``, ``Cargo.toml``, and ``pom.xml`` files are
+read as manifests rather than parsed as code.  Each gives a ``module``
+entity (with its ``ecosystem``: go, npm, cargo, or maven) and one
+``dependency`` entity per declared dependency, with its ``version`` and
+``scope``:
+
+- go: ``runtime``, or ``indirect`` for ``// indirect`` requirements
+- npm: ``runtime``, ``dev``, ``peer``, or ``optional``
+- cargo: ``runtime``, ``dev``, or ``build``
+- maven: the ``<scope>``, ``compile`` by default
+
+A source file belongs to the nearest manifest of its language's
+ecosystem in its directory or above; linking matches its third-party
+imports against that manifest's dependencies (see dependency_for).
+"""
+
+from __future__ import annotations
+
+import json
+import os
+import re
+import tomllib
+import xml.etree.ElementTree as ElementTree
+from dataclasses import dataclass
+from pathlib import Path, PurePosixPath
+from typing import Any
+
+from .extracting import Entity, assign_uids, file_entity
+
+# Manifest file name -> (ecosystem, language of the file entity).
+MANIFESTS: dict[str, tuple[str, str]] = {
+    "Cargo.toml": ("cargo", "toml"),
+    "go.mod": ("go", "gomod"),
+    "package.json": ("npm", "json"),
+    "pom.xml": ("maven", "xml"),
+}
+
+# The ecosystem whose manifests a language's imports are checked against.
+LANGUAGE_ECOSYSTEMS: dict[str, str] = {
+    "go": "go", "java": "maven", "javascript": "npm", "rust": "cargo", "svelte": "npm",
+    "tsx": "npm", "typescript": "npm", "vue": "npm",
+}
+
+# Scopes whose dependencies the code itself should import.
+RUNTIME_SCOPES: frozenset[str] = frozenset({"compile", "runtime"})
+
+
+@dataclass(frozen=True)
+class Dependency:
+    name: str
+    version: str | None
+    scope: str
+    row: int  # 1-indexed line of the declaration
+
+
+@dataclass(frozen=True)
+class Manifest:
+    ecosystem: str
+    name: str
+    row: int
+    dependencies: list[Dependency]
+
+
+def is_manifest(path: Path) -> bool:
+    return path.name in MANIFESTS
+
+
+def manifest_languages(path: Path) -> frozenset[str]:
+    """The languages whose imports a manifest at *path* declares, for --languages."""
+    if path.name not in MANIFESTS:
+        return frozenset()
+    ecosystem: str = MANIFESTS[path.name][0]
+    return frozenset(lang for lang, eco in LANGUAGE_ECOSYSTEMS.items() if eco == ecosystem)
+
+
+def _row_of(lines: list[str], needle: str, start: int = 0) -> int:
+    """The 1-indexed row of the first line from *start* containing *needle*, or *start* + 1."""
+    for i in range(start, len(lines)):
+        if needle in lines[i]:
+            return i + 1
+    return start + 1
+
+
+# ---------------------------------------------------------------------------
+# Parsers; each raises ValueError for a malformed manifest
+# ---------------------------------------------------------------------------
+
+_GO_REQUIRE_RE: re.Pattern[str] = re.compile(r"^(\S+)\s+(\S+)(.*)$")
+
+
+def _parse_go_mod(text: str, default_name: str) -> Manifest:
+    lines: list[str] = text.splitlines()
+    name: str = default_name
+    row: int = 1
+    dependencies: list[Dependency] = []
+    in_block: bool = False
+    for number, raw in enumerate(lines, 1):
+        line: str = raw.strip()
+        if in_block:
+            if line.startswith(")"):
+                in_block = False
+                continue
+            requirement: str = line
+        elif line.startswith("module "):
+            name, row = line.split(None, 1)[1].split("//")[0].strip().strip('"'), number
+            continue
+        elif line.startswith("require ("):
+            in_block = True
+            continue
+        elif line.startswith("require "):
+            requirement = line.removeprefix("require ").strip()
+        else:
+            continue
+        match: re.Match[str] | None = _GO_REQUIRE_RE.match(requirement)
+        if match is None or requirement.startswith("//"):
+            continue
+        indirect: bool = "// indirect" in match.group(3)
+        dependencies.append(Dependency(
+            match.group(1), match.group(2), "indirect" if indirect else "runtime", number,
+        ))
+    return Manifest("go", name, row, dependencies)
+
+
+_NPM_SCOPES: dict[str, str] = {
+    "dependencies": "runtime", "devDependencies": "dev", "peerDependencies": "peer",
+    "optionalDependencies": "optional",
+}
+
+
+def _parse_package_json(text: str, default_name: str) -> Manifest:
+    try:
+        data: Any = json.loads(text)
+    except json.JSONDecodeError as exc:
+        raise ValueError(f"invalid JSON: {exc}") from None
+    if not isinstance(data, dict):
+        raise ValueError("expected a JSON object")
+    lines: list[str] = text.splitlines()
+    dependencies: list[Dependency] = []
+    for section, scope in _NPM_SCOPES.items():
+        declared: Any = data.get(section) or {}
+        if not isinstance(declared, dict):
+            raise ValueError(f"{section!r} must be an object")
+        start: int = _row_of(lines, f'"{section}"') - 1
+        for dep, version in declared.items():
+            dependencies.append(Dependency(
+                dep, version if isinstance(version, str) else None, scope,
+                _row_of(lines, f'"{dep}"', start),
+            ))
+    name: Any = data.get("name")
+    return Manifest(
+        "npm", name if isinstance(name, str) else default_name, _row_of(lines, '"name"'),
+        dependencies,
+    )
+
+
+_CARGO_SCOPES: dict[str, str] = {
+    "dependencies": "runtime", "dev-dependencies": "dev", "build-dependencies": "build",
+}
+
+
+def _parse_cargo_toml(text: str, default_name: str) -> Manifest:
+    try:
+        data: dict[str, Any] = tomllib.loads(text)
+    except tomllib.TOMLDecodeError as exc:
+        raise ValueError(f"invalid TOML: {exc}") from None
+    lines: list[str] = text.splitlines()
+    tables: list[dict[str, Any]] = [data, *data.get("target", {}).values()]
+    dependencies: list[Dependency] = []
+    for table in tables:
+        for section, scope in _CARGO_SCOPES.items():
+            declared: Any = table.get(section) or {}
+            if not isinstance(declared, dict):
+                raise ValueError(f"[{section}] must be a table")
+            for dep, spec in declared.items():
+                version: Any = spec.get("version") if isinstance(spec, dict) else spec
+                dependencies.append(Dependency(
+                    dep, version if isinstance(version, str) else None, scope,
+                    _row_of(lines, dep),
+                ))
+    package: Any = data.get("package") or {}
+    name: Any = package.get("name") if isinstance(package, dict) else None
+    return Manifest(
+        "cargo", name if isinstance(name, str) else default_name, _row_of(lines, "[package]"),
+        dependencies,
+    )
+
+
+def _strip_namespaces(element: ElementTree.Element) -> None:
+    for node in element.iter():
+        node.tag = node.tag.rsplit("}", 1)[-1]
+
+
+def _parse_pom(text: str, default_name: str) -> Manifest:
+    try:
+        project: ElementTree.Element = ElementTree.fromstring(text)
+    except ElementTree.ParseError as exc:
+        raise ValueError(f"invalid XML: {exc}") from None
+    _strip_namespaces(project)
+    lines: list[str] = text.splitlines()
+    group: str | None = project.findtext("groupId") or project.findtext("parent/groupId")
+    artifact: str | None = project.findtext("artifactId")
+    dependencies: list[Dependency] = []
+    start: int = 0
+    # Only direct dependencies; dependencyManagement only pins versions.
+    for dependency in project.findall("dependencies/dependency"):
+        dep_group: str = (dependency.findtext("groupId") or "").strip()
+        dep_artifact: str = (dependency.findtext("artifactId") or "").strip()
+        row: int = _row_of(lines, f"<artifactId>{dep_artifact}</artifactId>", start)
+        start = row
+        dependencies.append(Dependency(
+            f"{dep_group}:{dep_artifact}", dependency.findtext("version"),
+            (dependency.findtext("scope") or "compile").strip(), row,
+        ))
+    name: str = f"{group}:{artifact}" if group and artifact else artifact or default_name
+    return Manifest("maven", name, _row_of(lines, "<artifactId>"), dependencies)
+
+
+_PARSERS: dict[str, Any] = {
+    "Cargo.toml": _parse_cargo_toml,
+    "go.mod": _parse_go_mod,
+    "package.json": _parse_package_json,
+    "pom.xml": _parse_pom,
+}
+
+
+def parse_manifest(text: str, path: str) -> Manifest:
+    """The manifest in *text*, read from *path*; raises ``ValueError`` if malformed."""
+    directory: str = PurePosixPath(path.replace(os.sep, "/")).parent.name or "."
+    return _PARSERS[PurePosixPath(path).name](text, directory)
+
+
+def manifest_entities(source_utf8: bytes, path: str) -> list[Entity]:
+    """The file, module, and dependency entities of the manifest at *path*.
+
+    Raises ``ValueError`` if the manifest is malformed.
+    """
+    language: str = MANIFESTS[PurePosixPath(path).name][1]
+    text: str = source_utf8.decode("utf-8", errors="replace")
+    manifest: Manifest = parse_manifest(text, path)
+    lines: list[bytes] = source_utf8.splitlines(keepends=True)
+    offsets: list[int] = [0]
+    for line in lines:
+        offsets.append(offsets[-1] + len(line))
+
+    def line_entity(
+        id: int, kind: str, name: str, row: int, parent: int, attrs: dict[str, Any],
+    ) -> Entity:
+        index: int = min(row, len(lines)) - 1
+        content: bytes = lines[index].rstrip(b"\r\n") if lines else b""
+        return Entity(
+            id=id, kind=kind, name=name, path=path, language=language,
+            row=row, col=1, end_row=row, end_col=len(content.decode("utf-8", "replace")) + 1,
+            parent=parent, attrs=attrs,
+            start_byte=offsets[index] if lines else 0,
+            end_byte=(offsets[index] + len(content)) if lines else 0,
+        )
+
+    entities: list[Entity] = [file_entity(source_utf8, language, path, 0)]
+    entities.append(line_entity(
+        1, "module", manifest.name, manifest.row, 0, {"ecosystem": manifest.ecosystem},
+    ))
+    for dependency in manifest.dependencies:
+        attrs: dict[str, Any] = {"scope": dependency.scope}
+        if dependency.version is not None:
+            attrs["version"] = dependency.version
+        entities.append(line_entity(
+            len(entities), "dependency", dependency.name, dependency.row, 1, attrs,
+        ))
+    assign_uids(entities)
+    return entities
+
+
+# ---------------------------------------------------------------------------
+# Matching imports to dependencies
+# ---------------------------------------------------------------------------
+
+
+def dependency_for(ecosystem: str, import_name: str, declared: dict[str, int]) -> int | None:
+    """The id of the dependency in *declared* (name -> id) that *import_name* comes from.
+
+    Go imports match the longest module path they start with, npm imports
+    their package (``@scope/name`` or the first segment), and Rust ``use``
+    paths their crate, with ``-`` read as ``_``.  Java imports match a
+    dependency whose group id they start with, the usual package naming.
+    """
+    if ecosystem == "go":
+        matches: list[str] = [
+            d for d in declared if import_name == d or import_name.startswith(d + "/")
+        ]
+        return declared[max(matches, key=len)] if matches else None
+    if ecosystem == "npm":
+        parts: list[str] = import_name.split("/")
+        package: str = "/".join(parts[:2]) if import_name.startswith("@") else parts[0]
+        return declared.get(package)
+    if ecosystem == "cargo":
+        crate: str = re.split(r"::|[{\s;]", import_name.lstrip(":"), maxsplit=1)[0]
+        return next((i for d, i in declared.items() if d.replace("-", "_") == crate), None)
+    if ecosystem == "maven":
+        groups: list[str] = [
+            d for d in declared if import_name.startswith(d.split(":")[0] + ".")
+        ]
+        return declared[max(groups, key=len)] if groups else None
+    return None
+
+
+def governing(directory: str, ecosystem: str, manifests: dict[tuple[str, str], Any]) -> Any:
+    """The value in *manifests* (keyed by ecosystem and directory) for *directory* or above."""
+    current: str = os.path.normpath(directory or ".")
+    while True:
+        found: Any = manifests.get((ecosystem, current))
+        if found is not None:
+            return found
+        parent: str = os.path.normpath(os.path.dirname(current) or ".")
+        if parent == current or os.path.basename(current) == "..":
+            return None
+        current = parent
@@ -0,0 +1,248 @@
+"""Size and complexity metrics for function-like entities.
+
+Metrics are computed from the syntax tree alone, with the same tables
+for every language so they can be compared across a polyglot codebase:
+
+- ``lines``: lines spanned by the declaration.
+- ``loc``: lines holding code, i.e. not blank and not only comments.
+- ``complexity``: cyclomatic complexity, 1 plus one per decision point
+  (branches, loops, cases, catch clauses, ``&&``/``||``, ternaries).
+- ``params``: declared parameters, not counting receivers or ``self``.
+- ``depth``: deepest nesting of control structures; ``else if`` chains
+  count as one level.
+
+Nested closures are measured as part of the function containing them;
+nested named functions are entities of their own and are not.
+"""
+
+from __future__ import annotations
+
+from typing import Any
+
+from tree_sitter import Node
+
+_JS_DECISIONS: frozenset[str] = frozenset({
+    "catch_clause",
+    "do_statement",
+    "for_in_statement",
+    "for_statement",
+    "if_statement",
+    "switch_case",
+    "ternary_expression",
+    "while_statement",
+})
+
+_JS_NESTING: frozenset[str] = frozenset({
+    "do_statement",
+    "for_in_statement",
+    "for_statement",
+    "if_statement",
+    "switch_statement",
+    "try_statement",
+    "while_statement",
+})
+
+_C_DECISIONS: frozenset[str] = frozenset({
+    "case_statement",
+    "conditional_expression",
+    "do_statement",
+    "for_statement",
+    "if_statement",
+    "while_statement",
+})
+
+_C_NESTING: frozenset[str] = frozenset({
+    "do_statement",
+    "for_statement",
+    "if_statement",
+    "switch_statement",
+    "while_statement",
+})
+
+# Node types that add a path through the function.  Binary expressions
+# only count for the operators in _SHORT_CIRCUIT.
+_DECISIONS: dict[str, frozenset[str]] = {
+    "c": _C_DECISIONS,
+    "c_sharp": frozenset({
+        "catch_clause", "conditional_expression", "do_statement", "for_each_statement",
+        "for_statement", "if_statement", "switch_section", "while_statement",
+    }),
+    "cpp": _C_DECISIONS | {"catch_clause", "for_range_loop"},
+    "go": frozenset({
+        "communication_case", "expression_case", "for_statement", "if_statement", "type_case",
+    }),
+    "java": frozenset({
+        "catch_clause", "do_statement", "enhanced_for_statement", "for_statement",
+        "if_statement", "switch_label", "ternary_expression", "while_statement",
+    }),
+    "javascript": _JS_DECISIONS,
+    "kotlin": frozenset({
+        "catch_block", "conjunction_expression", "disjunction_expression", "do_while_statement",
+        "elvis_expression", "for_statement", "if_expression", "when_entry", "while_statement",
+    }),
+    "php": frozenset({
+        "case_statement", "catch_clause", "conditional_expression", "do_statement",
+        "else_if_clause", "for_statement", "foreach_statement", "if_statement",
+        "match_conditional_expression", "while_statement",
+    }),
+    "python": frozenset({
+        "boolean_operator", "case_clause", "conditional_expression", "elif_clause",
+        "except_clause", "for_statement", "if_clause", "if_statement", "while_statement",
+    }),
+    "ruby": frozenset({
+        "conditional", "elsif", "for", "if", "if_modifier", "rescue", "rescue_modifier",
+        "unless", "unless_modifier", "until", "until_modifier", "when", "while",
+        "while_modifier",
+    }),
+    "rust": frozenset({"for_expression", "if_expression", "match_arm", "while_expression"}),
+    # A catch block's handlers are case clauses.
+    "scala": frozenset({
+        "case_clause", "do_while_expression", "for_expression", "if_expression",
+        "while_expression",
+    }),
+    "tsx": _JS_DECISIONS,
+    "typescript": _JS_DECISIONS,
+}
+
+# Control structures whose bodies are one level deeper.
+_NESTING: dict[str, frozenset[str]] = {
+    "c": _C_NESTING,
+    "c_sharp": _C_NESTING | {"for_each_statement", "try_statement"},
+    "cpp": _C_NESTING | {"for_range_loop", "try_statement"},
+    "go": frozenset({
+        "expression_switch_statement", "for_statement", "if_statement", "select_statement",
+        "type_switch_statement",
+    }),
+    "java": _JS_NESTING | {"enhanced_for_statement", "switch_expression"},
+    "javascript": _JS_NESTING,
+    "kotlin": frozenset({
+        "do_while_statement", "for_statement", "if_expression", "try_expression",
+        "when_expression", "while_statement",
+    }),
+    "php": frozenset({
+        "do_statement", "for_statement", "foreach_statement", "if_statement", "match_expression",
+        "switch_statement", "try_statement", "while_statement",
+    }),
+    "python": frozenset({
+        "for_statement", "if_statement", "match_statement", "try_statement", "while_statement",
+        "with_statement",
+    }),
+    "ruby": frozenset({
+        "begin", "case", "for", "if", "unless", "until", "while",
+    }),
+    "rust": frozenset({
+        "for_expression", "if_expression", "loop_expression", "match_expression",
+        "while_expression",
+    }),
+    "scala": frozenset({
+        "do_while_expression", "for_expression", "if_expression", "match_expression",
+        "try_expression", "while_expression",
+    }),
+    "tsx": _JS_NESTING,
+    "typescript": _JS_NESTING,
+}
+
+_SHORT_CIRCUIT: frozenset[str] = frozenset({"&&", "||", "??", "and", "or"})
+
+_COMMENT_TYPES: frozenset[str] = frozenset(
+    {"block_comment", "comment", "line_comment", "multiline_comment"},
+)
+
+# Parameter list children that are punctuation-like rather than parameters.
+_NON_PARAMETERS: frozenset[str] = frozenset({
+    "keyword_separator", "parameter_modifiers", "positional_separator", "receiver_parameter",
+    "self_parameter",
+}) | _COMMENT_TYPES
+
+
+def _is_decision(node: Node, decisions: frozenset[str]) -> bool:
+    if node.type in ("binary", "binary_expression", "infix_expression"):  # Ruby, Scala
+        operator: Node | None = node.child_by_field_name("operator")
+        # Scala operators are identifiers, so their type is not the operator.
+        return operator is not None and (
+            operator.type in _SHORT_CIRCUIT or operator.text.decode() in _SHORT_CIRCUIT
+        )
+    if node.type == "switch_label":
+        # Java: "default:" is not a decision of its own.
+        return bool(node.children) and node.children[0].type != "default"
+    if node.type == "case_statement":
+        # C: likewise for "default:", the case without a value.
+        return node.child_by_field_name("value") is not None
+    return node.type in decisions
+
+
+def _continues_chain(node: Node) -> bool:
+    """Whether *node* is the ``if`` of an ``else if``."""
+    parent: Node | None = node.parent
+    if parent is not None and parent.type == "control_structure_body":  # Kotlin
+        before: Node | None = parent.prev_sibling
+        return before is not None and before.type == "else"
+    return parent is not None and (parent.type == "else_clause" or parent.type == node.type)
+
+
+def _parameter_count(node: Node, language: str) -> int:
+    if node.type == "variable_declarator":  # const f = (a, b) => ...
+        node = node.child_by_field_name("value") or node
+    parameters: Node | None = node.child_by_field_name("parameters")
+    declarator: Node | None = node.child_by_field_name("declarator")
+    while parameters is None and declarator is not None:
+        # C and C++: int *f(int a) nests the parameters in declarators.
+        parameters = declarator.child_by_field_name("parameters")
+        declarator = declarator.child_by_field_name("declarator")
+    if parameters is None:
+        # Kotlin: the parameter list is an unnamed child.
+        parameters = next(
+            (c for c in node.children if c.type == "function_value_parameters"), None,
+        )
+    if parameters is None:
+        # Single-parameter arrows: x => x + 1
+        return 1 if node.child_by_field_name("parameter") is not None else 0
+    count: int = 0
+    for child in parameters.named_children:
+        if child.type in _NON_PARAMETERS:
+            continue
+        if language == "go" and child.type == "parameter_declaration":
+            count += max(1, len(child.children_by_field_name("name")))  # a, b int
+            continue
+        if language == "python" and count == 0 and child.text in (b"self", b"cls"):
+            continue
+        count += 1
+    return count
+
+
+def function_metrics(
+    node: Node, language: str, function_types: frozenset[str] = frozenset(),
+) -> dict[str, Any]:
+    """Measure the function whose declaration is *node*.
+
+    Descendants whose type is in *function_types* are nested functions
+    measured on their own, so they are skipped.
+    """
+    decisions: frozenset[str] = _DECISIONS.get(language, frozenset())
+    nesting: frozenset[str] = _NESTING.get(language, frozenset())
+    complexity: int = 1
+    depth: int = 0
+    code_rows: set[int] = set()
+    stack: list[tuple[Node, int]] = [(node, 0)]
+    while stack:
+        current, level = stack.pop()
+        if current is not node and current.type in function_types:
+            continue
+        if current.type in _COMMENT_TYPES:
+            continue
+        if not current.children:
+            code_rows.update(range(current.start_point[0], current.end_point[0] + 1))
+            continue
+        if _is_decision(current, decisions):
+            complexity += 1
+        if current.type in nesting and not _continues_chain(current):
+            level += 1
+            depth = max(depth, level)
+        stack.extend((child, level) for child in current.children)
+    return {
+        "lines": node.end_point[0] - node.start_point[0] + 1,
+        "loc": len(code_rows),
+        "complexity": complexity,
+        "params": _parameter_count(node, language),
+        "depth": depth,
+    }
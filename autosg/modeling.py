@@ -0,0 +1,370 @@
+"""Serialized data models, for the ``datamodel`` command.
+
+A type is part of the data model when its declaration says how it goes
+over the wire: Go struct tags (``json:"status,omitempty"``), serde
+derives and attributes in Rust, Jackson, Gson, and ``System.Text.Json``
+annotations in Java, C#, and Kotlin, kotlinx.serialization, and pydantic
+models or ``dataclass_json`` classes in Python.  Each field is listed
+under its wire name with its declared type; fields the serializer skips
+are left out, and fields that may be absent are marked optional.
+
+The rules are the serializers' defaults read from syntax alone, so a
+custom naming policy configured at runtime is not seen.
+"""
+
+from __future__ import annotations
+
+import csv
+import json
+import re
+from collections import defaultdict
+from dataclasses import asdict, dataclass, field
+from typing import Any, TextIO
+
+from .analysis import Analysis
+from .extracting import Entity, qualified_names
+
+DATAMODEL_FORMATS: tuple[str, ...] = ("csv", "json", "markdown")
+
+
+@dataclass
+class ModelField:
+    name: str  # as declared
+    wire: str  # as serialized
+    type: str
+    optional: bool = False
+
+
+@dataclass
+class ModelType:
+    """A serialized type and the fields it puts on the wire."""
+
+    name: str  # qualified, e.g. Outer.Inner
+    language: str
+    path: str
+    row: int
+    formats: list[str]  # e.g. ["json", "yaml"]; serde types list "serde"
+    fields: list[ModelField] = field(default_factory=list)
+
+
+# ---------------------------------------------------------------------------
+# Annotation arguments
+# ---------------------------------------------------------------------------
+
+# "name", name = "name", Name: "name" (Python and C# named arguments too).
+_STRING_ARG_RE: re.Pattern[str] = re.compile(
+    r"""(?:(\w+)\s*[:=]\s*)?(?:"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)')""",
+)
+
+
+def _annotation(annotations: list[str], names: tuple[str, ...]) -> str | None:
+    """The arguments of the first annotation named one of *names*; "" when bare."""
+    for annotation in annotations:
+        head, _, rest = annotation.partition("(")
+        # Drop the package and any Kotlin use-site target (@field:Json).
+        if head.strip().rpartition(".")[2].rpartition(":")[2] in names:
+            return rest.rpartition(")")[0]
+    return None
+
+
+def _string_argument(arguments: str, keys: tuple[str, ...] = ()) -> str | None:
+    """The first positional string argument, or the string passed as one of *keys*."""
+    for match in _STRING_ARG_RE.finditer(arguments):
+        key, double, single = match.groups()
+        if key is None or key in keys:
+            return double if double is not None else single
+    return None
+
+
+# ---------------------------------------------------------------------------
+# Go
+# ---------------------------------------------------------------------------
+
+# Struct tag keys of the common encoders; the first present names the field.
+_GO_WIRE_TAGS: tuple[str, ...] = ("json", "yaml", "xml", "bson", "toml", "msgpack")
+
+
+def _go_model(struct: Entity) -> tuple[list[str], list[ModelField]]:
+    fields: list[dict[str, Any]] = struct.attrs.get("fields", [])
+    formats: list[str] = [
+        key for key in _GO_WIRE_TAGS if any(key in f.get("tags", {}) for f in fields)
+    ]
+    model: list[ModelField] = []
+    for declared in fields:
+        name: str = declared["name"]
+        if not name[:1].isupper():
+            continue  # the encoders skip unexported fields
+        tags: dict[str, str] = declared.get("tags", {})
+        tag: list[str] = next((tags[k] for k in formats if k in tags), "").split(",")
+        if tag[0] == "-" and len(tag) == 1:
+            continue
+        model.append(ModelField(
+            name=name,
+            wire=tag[0] or name,
+            type=declared["type"],
+            optional="omitempty" in tag[1:] or declared["type"].startswith("*"),
+        ))
+    return formats, model
+
+
+# ---------------------------------------------------------------------------
+# Rust
+# ---------------------------------------------------------------------------
+
+_SERDE_DERIVES: frozenset[str] = frozenset({"Deserialize", "Serialize"})
+
+_RUST_OPTION_RE: re.Pattern[str] = re.compile(r"^(?:(?:std|core)::option::)?Option\s*<")
+
+
+def _rename(name: str, rule: str) -> str:
+    """Apply a serde ``rename_all`` rule to a snake_case field name."""
+    words: list[str] = [w for w in name.split("_") if w]
+    if rule == "lowercase":
+        return name.lower()
+    if rule == "UPPERCASE":
+        return name.upper()
+    if rule == "camelCase":
+        return words[0].lower() + "".join(w.capitalize() for w in words[1:]) if words else name
+    if rule == "PascalCase":
+        return "".join(w.capitalize() for w in words)
+    if rule == "SCREAMING_SNAKE_CASE":
+        return name.upper()
+    if rule == "kebab-case":
+        return name.replace("_", "-")
+    if rule == "SCREAMING-KEBAB-CASE":
+        return name.replace("_", "-").upper()
+    return name  # snake_case, or a rule this does not know
+
+
+def _serde_options(attributes: list[str]) -> str:
+    """The contents of every ``serde(...)`` attribute, comma-joined."""
+    return ", ".join(
+        a.partition("(")[2].rpartition(")")[0]
+        for a in attributes if a.partition("(")[0].strip() == "serde"
+    )
+
+
+def _rust_model(struct: Entity) -> tuple[list[str], list[ModelField]]:
+    attributes: list[str] = struct.attrs.get("attributes", [])
+    derives: set[str] = {
+        name.strip().rpartition("::")[2]
+        for a in attributes if a.partition("(")[0].strip() == "derive"
+        for name in a.partition("(")[2].rpartition(")")[0].split(",")
+    }
+    if not derives & _SERDE_DERIVES or "fields" not in struct.attrs:
+        return [], []
+    container: str = _serde_options(attributes)
+    rule: str = _string_argument(container, ("rename_all",)) or ""
+    model: list[ModelField] = []
+    for declared in struct.attrs["fields"]:
+        options: str = _serde_options(declared.get("attributes", []))
+        flags: set[str] = {o.strip() for o in options.split(",")}
+        if flags & {"skip", "skip_serializing"}:
+            continue
+        name: str = declared["name"].removeprefix("r#")
+        model.append(ModelField(
+            name=name,
+            wire=_string_argument(options, ("rename",)) or _rename(name, rule),
+            type=declared["type"],
+            optional=bool(_RUST_OPTION_RE.match(declared["type"]))
+            or bool({f.partition("=")[0].strip() for f in flags} & {"default"}),
+        ))
+    return ["serde"], model
+
+
+# ---------------------------------------------------------------------------
+# Java, C#, and Kotlin
+# ---------------------------------------------------------------------------
+
+# Annotation names, by role.  The JVM languages share Jackson and Gson.
+_JVM_NAMES: tuple[str, ...] = ("JsonProperty", "SerializedName", "SerialName", "Json")
+_JVM_IGNORES: tuple[str, ...] = ("JsonIgnore", "Transient")
+_JVM_CLASSES: tuple[str, ...] = (
+    "JsonClass", "JsonIgnoreProperties", "JsonInclude", "JsonPropertyOrder", "JsonSerialize",
+    "Serializable",
+)
+_CSHARP_NAMES: tuple[str, ...] = ("DataMember", "JsonProperty", "JsonPropertyName")
+_CSHARP_IGNORES: tuple[str, ...] = ("IgnoreDataMember", "JsonIgnore", "NonSerialized")
+_CSHARP_CLASSES: tuple[str, ...] = ("DataContract", "JsonObject", "Serializable")
+
+# Named arguments that carry the wire name (@Json(name = "x"), [DataMember(Name = "x")]).
+_NAME_KEYS: tuple[str, ...] = ("Name", "PropertyName", "name", "value")
+
+
+def _member_model(
+    annotations: list[str], ignores: tuple[str, ...], names: tuple[str, ...],
+    name: str, declared_type: str,
+) -> ModelField | None:
+    if _annotation(annotations, ignores) is not None:
+        return None
+    arguments: str | None = _annotation(annotations, names)
+    wire: str | None = _string_argument(arguments, _NAME_KEYS) if arguments else None
+    return ModelField(
+        name=name, wire=wire or name, type=declared_type,
+        optional=declared_type.endswith("?") or declared_type.startswith("Optional<"),
+    )
+
+
+def _annotated_model(
+    entity: Entity, members: list[Entity],
+) -> tuple[list[str], list[ModelField]]:
+    """Classes with serialization annotations on themselves or any member."""
+    csharp: bool = entity.language == "c_sharp"
+    key: str = "attributes" if csharp else "annotations"
+    ignores: tuple[str, ...] = _CSHARP_IGNORES if csharp else _JVM_IGNORES
+    names: tuple[str, ...] = _CSHARP_NAMES if csharp else _JVM_NAMES
+    classes: tuple[str, ...] = _CSHARP_CLASSES if csharp else _JVM_CLASSES
+    declared: list[tuple[str, str, list[str]]] = [
+        (f["name"], f.get("type", ""), f.get("annotations", []))
+        for f in entity.attrs.get("fields", [])  # Java records, Kotlin constructors
+    ]
+    declared.extend(
+        (m.name, m.attrs.get("type", ""), m.attrs.get(key, []))
+        for m in members
+        if m.kind in ("field", "property") and not m.attrs.get("static")
+        and not m.attrs.get("transient")
+    )
+    marked: bool = _annotation(entity.attrs.get(key, []), classes) is not None or any(
+        _annotation(annotations, names + ignores) is not None
+        for _name, _type, annotations in declared
+    )
+    if not marked:
+        return [], []
+    model: list[ModelField] = [
+        m for name, declared_type, annotations in declared
+        if (m := _member_model(annotations, ignores, names, name, declared_type)) is not None
+    ]
+    return ["json"], model
+
+
+# ---------------------------------------------------------------------------
+# Python
+# ---------------------------------------------------------------------------
+
+_PYTHON_MODEL_BASES: frozenset[str] = frozenset({"BaseModel", "BaseSettings", "RootModel"})
+_PYTHON_MODEL_DECORATORS: frozenset[str] = frozenset({"dataclass_json"})
+_PYTHON_OPTIONAL_RE: re.Pattern[str] = re.compile(
+    r"^(?:typing\.)?Optional\[|\|\s*None\s*$|^None\s*\|",
+)
+_PYTHON_FIELD_RE: re.Pattern[str] = re.compile(r"^(?:\w+\.)?Field\((.*)\)$", re.DOTALL)
+
+
+def _python_has_default(default: str) -> bool:
+    """Whether a class attribute's value makes the field optional.
+
+    ``Field(...)`` and ``Field(alias="x")`` still declare a required field.
+    """
+    match: re.Match[str] | None = _PYTHON_FIELD_RE.match(default)
+    if match is None:
+        return bool(default)
+    arguments: str = match.group(1).strip()
+    if re.search(r"\bdefault(?:_factory)?\s*=", arguments):
+        return True
+    first: str = arguments.split(",", 1)[0].strip()
+    return bool(first) and first != "..." and "=" not in first
+
+
+def _python_model(cls: Entity) -> tuple[list[str], list[ModelField]]:
+    bases: set[str] = {b.rpartition(".")[2] for b in cls.attrs.get("bases", [])}
+    decorators: set[str] = {
+        d.partition("(")[0].rpartition(".")[2] for d in cls.attrs.get("decorators", [])
+    }
+    if not bases & _PYTHON_MODEL_BASES and not decorators & _PYTHON_MODEL_DECORATORS:
+        return [], []
+    model: list[ModelField] = []
+    for declared in cls.attrs.get("fields", []):
+        name: str = declared["name"]
+        annotation: str = declared["type"]
+        if annotation.startswith(("ClassVar", "typing.ClassVar")) or name.startswith("_"):
+            continue  # class variables and private attributes are not fields
+        default: str = declared.get("default", "")
+        field_call: re.Match[str] | None = _PYTHON_FIELD_RE.match(default)
+        wire: str | None = _string_argument(
+            field_call.group(1), ("alias", "serialization_alias"),
+        ) if field_call is not None else None
+        model.append(ModelField(
+            name=name,
+            wire=wire or name,
+            type=annotation,
+            optional=bool(_PYTHON_OPTIONAL_RE.search(annotation)) or _python_has_default(default),
+        ))
+    return ["json"], model
+
+
+# ---------------------------------------------------------------------------
+# Building and writing
+# ---------------------------------------------------------------------------
+
+_CLASS_KINDS: frozenset[str] = frozenset({"class", "struct"})
+
+
+def build_data_model(analysis: Analysis) -> list[ModelType]:
+    """Serialized types in *analysis*, ordered by path and position."""
+    types: list[ModelType] = []
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        members: dict[int, list[Entity]] = defaultdict(list)
+        for entity in file_result.entities:
+            if entity.parent is not None:
+                members[entity.parent].append(entity)
+        for entity in file_result.entities:
+            formats: list[str] = []
+            fields: list[ModelField] = []
+            if entity.language == "go" and entity.kind == "struct":
+                formats, fields = _go_model(entity)
+            elif entity.language == "rust" and entity.kind == "struct":
+                formats, fields = _rust_model(entity)
+            elif entity.language == "python" and entity.kind == "class":
+                formats, fields = _python_model(entity)
+            elif entity.language in ("c_sharp", "java", "kotlin") and entity.kind in _CLASS_KINDS:
+                formats, fields = _annotated_model(entity, members[entity.id])
+            if formats:
+                types.append(ModelType(
+                    name=names[entity.id], language=entity.language, path=entity.path,
+                    row=entity.row, formats=formats, fields=fields,
+                ))
+    types.sort(key=lambda t: (t.path, t.row))
+    return types
+
+
+def write_json(types: list[ModelType], out: TextIO) -> None:
+    json.dump([asdict(t) for t in types], out, indent=2)
+    out.write("\n")
+
+
+def write_csv(types: list[ModelType], out: TextIO) -> None:
+    """One row per field: the type, its location and formats, then the field."""
+    writer = csv.writer(out, lineterminator="\n")
+    writer.writerow(["type", "path", "row", "formats", "field", "wire", "field_type", "optional"])
+    for model in types:
+        for f in model.fields:
+            writer.writerow([
+                model.name, model.path, model.row, " ".join(model.formats),
+                f.name, f.wire, f.type, str(f.optional).lower(),
+            ])
+
+
+def _md_cell(text: str) -> str:
+    return text.replace("|", "\\|")
+
+
+def write_markdown(types: list[ModelType], out: TextIO) -> None:
+    """A section per type with a table of its wire fields."""
+    out.write("# Data model\n\n")
+    if not types:
+        out.write("No serialized types found.\n")
+        return
+    for model in types:
+        out.write(f"## {model.name}\n\n")
+        out.write(f"`{model.path}:{model.row}` ({model.language}, {', '.join(model.formats)})\n\n")
+        if not model.fields:
+            out.write("No fields.\n\n")
+            continue
+        out.write("| Wire name | Type | Optional | Field |\n|---|---|---|---|\n")
+        for f in model.fields:
+            optional: str = "yes" if f.optional else ""
+            out.write(
+                f"| `{_md_cell(f.wire)}` | `{_md_cell(f.type)}` | {optional} "
+                f"| {_md_cell(f.name)} |\n",
+            )
+        out.write("\n")
@@ -0,0 +1,159 @@
+"""Jupyter notebooks (``.ipynb``): code cells extracted as Python.
+
+A notebook is JSON, with the source of each cell kept in a string.  Its
+code cells are read in order and each is extracted as a file of its own,
+so rows and columns count from the top of the cell; every entity and
+reference records which cell it is in as ``cell``, counted from 1 among
+all cells, markdown included (as Jupyter front ends and nbqa number
+them).  Declarations in a cell are declarations of the notebook, whose
+``file`` entity encloses them, so a function defined in one cell is
+found when a later cell calls it.
+
+IPython syntax is not Python: lines running magics (``%timeit f()``) or
+shell commands (``!pip install x``, ``files = !ls``) are read as ``pass``
+or as an assignment of ``None``, and cells run by another interpreter
+(``%%bash``, ``%%sql``, ...) are left out.  Notebooks with a kernel for
+another language keep their file entity only.  ``autosg:`` directives
+in a cell work as in a file of their own, where one that no declaration
+follows is about the cell: ``autosg:ignore`` there leaves the cell out.
+
+The file entity records the notebook's ``kernel`` language and how many
+``cells`` were extracted.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import json
+import re
+from pathlib import Path
+from typing import Any
+
+from tree_sitter import Tree
+
+from .directives import annotate
+from .extracting import (
+    Edge, Entity, ParseError, assign_uids, extract_entities, file_entity, syntax_errors,
+)
+from .parsing import parse_tree
+
+NOTEBOOK_EXTENSIONS: dict[str, str] = {".ipynb": "jupyter"}
+
+
+def notebook_language(path: Path) -> str | None:
+    return NOTEBOOK_EXTENSIONS.get(path.suffix)
+
+
+# Cell magics whose body is still Python; other cells are left out.
+_PYTHON_CELL_MAGICS: frozenset[str] = frozenset({
+    "capture", "debug", "prun", "python", "python3", "time", "timeit",
+})
+
+# A line magic or shell command, with the names its output is assigned to.
+_MAGIC_RE: re.Pattern[str] = re.compile(
+    r"^([ \t]*)(?:([\w.]+(?:[ \t]*,[ \t]*[\w.]+)*)[ \t]*=[ \t]*)?[!%].*$", re.MULTILINE,
+)
+_CELL_MAGIC_RE: re.Pattern[str] = re.compile(r"\s*%%(\w+)")
+
+
+def _cell_source(cell: dict[str, Any]) -> str:
+    source: Any = cell.get("source", "")
+    return "".join(source) if isinstance(source, list) else str(source)
+
+
+def python_source(source: str) -> str | None:
+    """The Python in a code cell's *source*, row for row; None for another interpreter's."""
+    cell_magic: re.Match[str] | None = _CELL_MAGIC_RE.match(source)
+    if cell_magic is not None:
+        if cell_magic.group(1) not in _PYTHON_CELL_MAGICS:
+            return None
+        first, newline, rest = source.partition("\n")
+        source = " " * len(first) + newline + rest
+    return _MAGIC_RE.sub(
+        lambda m: f"{m.group(1)}{m.group(2)} = None" if m.group(2) else f"{m.group(1)}pass",
+        source,
+    )
+
+
+def _kernel(notebook: dict[str, Any]) -> str:
+    """The language of *notebook*'s kernel, Python unless the metadata says otherwise."""
+    metadata: Any = notebook.get("metadata")
+    if not isinstance(metadata, dict):
+        return "python"
+    for key in ("language_info", "kernelspec"):
+        info: Any = metadata.get(key)
+        if isinstance(info, dict):
+            name: Any = info.get("name" if key == "language_info" else "language")
+            if isinstance(name, str) and name:
+                return name.lower()
+    return "python"
+
+
+def _cell_entities(
+    source_utf8: bytes, path: str, first: int, cell: int,
+) -> tuple[list[Entity], list[Edge], list[ParseError]] | None:
+    """The declarations of one cell, ids counting up after *first*; None to leave it out."""
+    tree: Tree = parse_tree(source_utf8, "python")
+    entities, references, _next_id = extract_entities(source_utf8, "python", path, first, tree)
+    annotated: tuple[list[Entity], list[Edge]] | None = annotate(
+        entities, references, source_utf8,
+    )
+    if annotated is None:
+        return None
+    entities, references = annotated
+    for entity in entities[1:]:
+        entity.attrs["cell"] = cell
+        entity.start_byte = entity.end_byte = None  # offsets into the cell, not the file
+        if entity.parent == first:
+            entity.parent = 0
+    for ref in references:
+        ref.attrs["cell"] = cell
+        if ref.source == first:
+            ref.source = 0
+    errors: list[ParseError] = [
+        dataclasses.replace(error, message=f"cell {cell}: {error.message}")
+        for error in syntax_errors(tree, source_utf8, path)
+    ]
+    return entities[1:], references, errors
+
+
+def notebook_entities(
+    source_utf8: bytes, path: str,
+) -> tuple[list[Entity], list[Edge], list[ParseError]]:
+    """The entities of a notebook, the references of its code cells, and errors."""
+    file: Entity = file_entity(source_utf8, "jupyter", path, 0)
+    entities: list[Entity] = [file]
+    references: list[Edge] = []
+    errors: list[ParseError] = []
+    try:
+        notebook: Any = json.loads(source_utf8)
+        if not isinstance(notebook, dict) or not isinstance(notebook.get("cells"), list):
+            raise ValueError("no cells; only nbformat 4 notebooks are read")
+    except ValueError as exc:
+        assign_uids(entities)
+        errors.append(ParseError(
+            path, "syntax", f"malformed notebook: {exc}", 1, 1, file.end_row, file.end_col,
+        ))
+        return entities, references, errors
+    file.attrs["kernel"] = _kernel(notebook)
+    file.attrs["cells"] = 0
+    if file.attrs["kernel"] != "python":
+        assign_uids(entities)
+        return entities, references, errors
+    for number, cell in enumerate(notebook["cells"], 1):
+        if not isinstance(cell, dict) or cell.get("cell_type") != "code":
+            continue
+        source: str | None = python_source(_cell_source(cell))
+        if source is None or not source.strip():
+            continue
+        found: tuple[list[Entity], list[Edge], list[ParseError]] | None = _cell_entities(
+            source.encode("utf-8"), path, len(entities) - 1, number,
+        )
+        if found is None:
+            continue
+        entities.extend(found[0])
+        references.extend(found[1])
+        errors.extend(found[2])
+        file.attrs["cells"] += 1
+    assign_uids(entities)
+    return entities, references, errors
@@ -0,0 +1,208 @@
+"""OpenAPI skeletons built from extracted endpoints, for the ``openapi`` command.
+
+Every ``endpoint`` entity becomes an operation under its path, with the
+handler it is linked to by a ``handles`` edge recorded in
+``x-handler``.  Path parameters are read from the route pattern in any of
+the usual spellings (``/users/{id}``, ``/users/:id``, ``/users/<int:id>``).
+
+Go handlers also give responses and query parameters: a struct passed to
+``json.NewEncoder(w).Encode``, ``c.JSON``, and similar is the ``200``
+response body, described in ``components/schemas`` from its fields and
+``json`` tags.  Anything not inferred is left for a human to fill in, so
+the result is a starting point rather than a finished spec.
+"""
+
+from __future__ import annotations
+
+import os
+import re
+from collections import defaultdict
+from typing import Any
+
+from .analysis import Analysis
+from .extracting import Entity, qualified_names
+
+OPENAPI_VERSION: str = "3.0.3"
+
+# OpenAPI operations, in the order the specification lists them.
+_OPERATIONS: tuple[str, ...] = ("get", "put", "post", "delete", "options", "head", "patch")
+
+# /users/{id}, /users/{path...} (Go 1.22), /users/:id, /users/<int:id> (Flask)
+_PATH_PARAM_RE: re.Pattern[str] = re.compile(
+    r"\{(\w+)(?:\.\.\.)?(?::[^}]*)?\}|:(\w+)|<(?:(\w+):)?(\w+)>",
+)
+
+_FLASK_CONVERTERS: dict[str, str] = {"float": "number", "int": "integer"}
+
+_GO_SCALARS: dict[str, dict[str, Any]] = {
+    "any": {},
+    "bool": {"type": "boolean"},
+    "byte": {"type": "integer"},
+    "float32": {"type": "number"},
+    "float64": {"type": "number"},
+    "interface{}": {},
+    "json.RawMessage": {},
+    "rune": {"type": "integer"},
+    "string": {"type": "string"},
+    "time.Duration": {"type": "integer"},
+    "time.Time": {"type": "string", "format": "date-time"},
+    **{
+        f"{sign}int{bits}": {"type": "integer"}
+        for sign in ("", "u")
+        for bits in ("", "8", "16", "32", "64")
+    },
+}
+
+
+def _path_template(path: str) -> tuple[str, list[dict[str, Any]]]:
+    """The OpenAPI path for a route pattern, and its path parameters."""
+    parameters: list[dict[str, Any]] = []
+
+    def replace(match: re.Match[str]) -> str:
+        brace, colon, converter, angle = match.groups()
+        name: str = brace or colon or angle
+        parameters.append({
+            "name": name,
+            "in": "path",
+            "required": True,
+            "schema": {"type": _FLASK_CONVERTERS.get(converter or "", "string")},
+        })
+        return "{" + name + "}"
+
+    return _PATH_PARAM_RE.sub(replace, path), parameters
+
+
+class _Schemas:
+    """``components/schemas``, filled in as Go types are referenced."""
+
+    def __init__(self, structs: dict[tuple[str, str], Entity]) -> None:
+        self.structs: dict[tuple[str, str], Entity] = structs  # (package dir, name)
+        self.by_name: dict[str, list[Entity]] = defaultdict(list)
+        for entity in structs.values():
+            self.by_name[entity.name].append(entity)
+        self.components: dict[str, dict[str, Any]] = {}
+
+    def _find(self, name: str, package: str) -> Entity | None:
+        qualifier, _, base = name.rpartition(".")
+        if not qualifier and (package, base) in self.structs:
+            return self.structs[(package, base)]
+        candidates: list[Entity] = [
+            e for e in self.by_name.get(base, [])
+            if not qualifier or os.path.basename(os.path.dirname(e.path)) == qualifier
+        ]
+        return candidates[0] if len(candidates) == 1 else None
+
+    def schema(self, go_type: str, package: str) -> dict[str, Any]:
+        """A schema for a Go type as written in *package*; {} when unknown."""
+        go_type = go_type.strip()
+        if go_type in _GO_SCALARS:
+            return dict(_GO_SCALARS[go_type])
+        if go_type.startswith("*"):
+            return {**self.schema(go_type[1:], package), "nullable": True}
+        if go_type == "[]byte":
+            return {"type": "string", "format": "byte"}
+        if go_type.startswith("[]"):
+            return {"type": "array", "items": self.schema(go_type[2:], package)}
+        if go_type.startswith("map["):
+            value: str = go_type[go_type.index("]") + 1 :]
+            return {"type": "object", "additionalProperties": self.schema(value, package)}
+        struct: Entity | None = self._find(go_type, package)
+        if struct is None:
+            return {}
+        name: str = struct.name
+        if name not in self.components:
+            self.components[name] = {}  # placeholder; breaks cycles
+            self.components[name] = self._object(struct)
+        return {"$ref": f"#/components/schemas/{name}"}
+
+    def _object(self, struct: Entity) -> dict[str, Any]:
+        package: str = os.path.dirname(struct.path)
+        properties: dict[str, Any] = {}
+        required: list[str] = []
+        for field in struct.attrs.get("fields", []):
+            name: str = field["name"]
+            if not name[:1].isupper():
+                continue  # encoding/json skips unexported fields
+            tag: list[str] = field.get("tags", {}).get("json", "").split(",")
+            if tag[0] == "-" and len(tag) == 1:
+                continue
+            wire: str = tag[0] or name
+            properties[wire] = self.schema(field["type"], package)
+            if "omitempty" not in tag[1:] and not field["type"].startswith("*"):
+                required.append(wire)
+        schema: dict[str, Any] = {"type": "object", "properties": properties}
+        if required:
+            schema["required"] = required
+        if "doc" in struct.attrs:
+            schema["description"] = struct.attrs["doc"]
+        return schema
+
+
+def build_openapi(analysis: Analysis, title: str, version: str) -> dict[str, Any]:
+    """An OpenAPI document for the endpoints in *analysis*.
+
+    *analysis* should resolve ``handles`` edges.
+    """
+    endpoints: list[Entity] = []
+    functions: dict[int, tuple[Entity, str]] = {}  # id -> (function, qualified name)
+    structs: dict[tuple[str, str], Entity] = {}
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            if entity.kind == "endpoint":
+                endpoints.append(entity)
+            elif entity.kind in ("function", "method"):
+                functions[entity.id] = (entity, names[entity.id])
+            elif entity.kind == "struct" and entity.language == "go":
+                structs[(os.path.dirname(entity.path), entity.name)] = entity
+    handlers: dict[int, int] = {
+        e.source: e.target for e in analysis.edges if e.kind == "handles" and e.target is not None
+    }
+    schemas: _Schemas = _Schemas(structs)
+    paths: dict[str, dict[str, Any]] = defaultdict(dict)
+    for endpoint in sorted(endpoints, key=lambda e: (e.attrs["path"], e.path, e.row)):
+        template, parameters = _path_template(endpoint.attrs["path"])
+        method: str = endpoint.attrs["method"].lower()
+        operation: dict[str, Any] = {}
+        if method not in _OPERATIONS:
+            # OpenAPI has no catch-all operation, so ANY is listed as GET.
+            operation["description"] = "Registered for any HTTP method."
+            method = "get"
+        response: dict[str, Any] = {"description": "OK"}
+        handler: tuple[Entity, str] | None = functions.get(handlers.get(endpoint.id, -1))
+        if handler is not None:
+            function, qualified = handler
+            operation["operationId"] = qualified
+            doc: str | None = function.attrs.get("doc")
+            if doc:
+                operation["summary"] = doc.split("\n", 1)[0]
+            operation["x-handler"] = {"name": qualified, "path": function.path, "row": function.row}
+            parameters.extend(
+                {"name": name, "in": "query", "schema": {"type": "string"}}
+                for name in function.attrs.get("query_params", [])
+            )
+            package: str = os.path.dirname(function.path)
+            body: list[dict[str, Any]] = [
+                schemas.schema(t, package) for t in function.attrs.get("responses", [])
+            ]
+            if body:
+                response["content"] = {
+                    "application/json": {"schema": body[0] if len(body) == 1 else {"oneOf": body}},
+                }
+        elif endpoint.attrs.get("handler"):
+            operation["x-handler"] = {"name": endpoint.attrs["handler"]}
+        if parameters:
+            operation["parameters"] = parameters
+        operation["responses"] = {"200": response}
+        paths[template].setdefault(method, operation)
+    document: dict[str, Any] = {
+        "openapi": OPENAPI_VERSION,
+        "info": {"title": title, "version": version},
+        "paths": {
+            path: dict(sorted(operations.items(), key=lambda item: _OPERATIONS.index(item[0])))
+            for path, operations in sorted(paths.items())
+        },
+    }
+    if schemas.components:
+        document["components"] = {"schemas": dict(sorted(schemas.components.items()))}
+    return document
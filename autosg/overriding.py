@@ -0,0 +1,182 @@
+"""Tree-sitter query files that extend or override entity extraction.
+
+A project can keep one ``<language>.scm`` file per language in a query
+directory (``.autosg/queries`` by default, or ``queries`` in the config
+file).  Patterns use the capture names of tree-sitter tag queries::
+
+    ; go.scm: functions declared through a code-generation macro
+    (call_expression
+      function: (identifier) @_macro (#eq? @_macro "DefineHandler")
+      arguments: (argument_list (interpreted_string_literal) @name)) @definition.function
+
+- ``@definition.<kind>`` marks a node as an entity of that kind, named
+  by the ``@name`` capture (or as built-in extraction would name it).
+- ``@reference.call`` marks a call, named by ``@name``, made from the
+  enclosing function; it is resolved like built-in ``calls`` references.
+- ``@doc`` gives the entity's ``doc`` and ``@attr.<key>`` the text of
+  ``attrs[key]``.  Captures starting with ``_`` are only for predicates.
+
+A query entity takes the place of a built-in one on the same node.  A
+file whose first line is ``; autosg: replace`` turns built-in entities
+and references off for its language, so only its own patterns apply.
+"""
+
+from __future__ import annotations
+
+import hashlib
+import warnings
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Any
+
+from tree_sitter import Node, Query
+
+from .parsing import EXTENSION_TO_LANGUAGE, FILENAME_TO_LANGUAGE
+
+DEFAULT_QUERY_DIR: Path = Path(".autosg") / "queries"
+
+_REPLACE_DIRECTIVE: str = "; autosg: replace"
+
+# Reference captures and the edge kinds they become.
+_REFERENCE_KINDS: dict[str, str] = {"reference.call": "calls"}
+
+
+@dataclass(frozen=True)
+class QueryFile:
+    language: str
+    source: str
+    path: str  # for messages
+
+    @property
+    def replaces(self) -> bool:
+        """Whether built-in extraction is off for the language."""
+        return self.source.lstrip().startswith(_REPLACE_DIRECTIVE)
+
+
+@dataclass
+class Definition:
+    """An entity found by a query, before it is placed in the entity tree."""
+
+    kind: str
+    name: str | None  # None: name it like built-in extraction would
+    doc: str | None
+    attrs: dict[str, Any]
+
+
+def _compile(query_file: QueryFile) -> Query:
+    with warnings.catch_warnings():
+        warnings.simplefilter("ignore", FutureWarning)
+        from tree_sitter_languages import get_language  # type: ignore
+
+        return get_language(query_file.language).query(query_file.source)
+
+
+def load_queries(directory: Path) -> list[QueryFile]:
+    """Read and compile the ``.scm`` files in *directory*.
+
+    Raises ``ValueError`` for a file named after no known language or a
+    query that does not compile.
+    """
+    languages: set[str] = {*EXTENSION_TO_LANGUAGE.values(), *FILENAME_TO_LANGUAGE.values()}
+    files: list[QueryFile] = []
+    for path in sorted(directory.glob("*.scm")):
+        if path.stem not in languages:
+            raise ValueError(f"{path}: no language named {path.stem!r}")
+        query_file: QueryFile = QueryFile(path.stem, path.read_text(encoding="utf-8"), str(path))
+        try:
+            _compile(query_file)
+        except Exception as exc:  # the bindings raise plain errors for bad queries
+            raise ValueError(f"{path}: {exc}") from None
+        files.append(query_file)
+    return files
+
+
+# ---------------------------------------------------------------------------
+# Registry
+# ---------------------------------------------------------------------------
+
+_registered: dict[str, QueryFile] = {}
+_compiled: dict[str, Query] = {}
+
+
+def register_queries(query_file: QueryFile) -> None:
+    """Apply *query_file* to its language in every later extraction."""
+    _registered[query_file.language] = query_file
+    _compiled.pop(query_file.language, None)
+
+
+def clear_queries() -> None:
+    """Forget every registered query file, as between a daemon's commands."""
+    _registered.clear()
+    _compiled.clear()
+
+
+def registered_queries() -> tuple[QueryFile, ...]:
+    return tuple(_registered.values())
+
+
+def replaces_builtin(language: str) -> bool:
+    query_file: QueryFile | None = _registered.get(language)
+    return query_file is not None and query_file.replaces
+
+
+def cache_digest(digest: str, language: str) -> str:
+    """The cache key for content with *digest*, which must change with the query."""
+    query_file: QueryFile | None = _registered.get(language)
+    if query_file is None:
+        return digest
+    return hashlib.sha256(f"{digest}\x00{query_file.source}".encode()).hexdigest()
+
+
+# ---------------------------------------------------------------------------
+# Matching
+# ---------------------------------------------------------------------------
+
+
+# Nodes are matched up with the extraction walk by position and type.
+NodeKey = tuple[int, int, str]
+
+
+def node_key(node: Node) -> NodeKey:
+    return node.start_byte, node.end_byte, node.type
+
+
+def _captured(value: Node | list[Node]) -> Node:
+    return value[0] if isinstance(value, list) else value
+
+
+def run_queries(
+    root: Node, language: str,
+) -> tuple[dict[NodeKey, Definition], dict[NodeKey, list[tuple[str, str]]]]:
+    """Definitions and references the language's query finds under *root*.
+
+    Both are keyed by node; references are (edge kind, name) pairs.
+    """
+    definitions: dict[NodeKey, Definition] = {}
+    references: dict[NodeKey, list[tuple[str, str]]] = {}
+    query_file: QueryFile | None = _registered.get(language)
+    if query_file is None:
+        return definitions, references
+    if language not in _compiled:
+        _compiled[language] = _compile(query_file)
+    for _pattern, captures in _compiled[language].matches(root):
+        name: Node | None = _captured(captures["name"]) if "name" in captures else None
+        name_text: str | None = name.text.decode() if name is not None else None
+        for capture, value in captures.items():
+            node: Node = _captured(value)
+            if capture.startswith("definition."):
+                doc: Node | None = _captured(captures["doc"]) if "doc" in captures else None
+                definitions[node_key(node)] = Definition(
+                    kind=capture.removeprefix("definition."),
+                    name=name_text.strip("\"'`") if name_text is not None else None,
+                    doc=doc.text.decode() if doc is not None else None,
+                    attrs={
+                        key.removeprefix("attr."): _captured(v).text.decode()
+                        for key, v in captures.items() if key.startswith("attr.")
+                    },
+                )
+            elif capture in _REFERENCE_KINDS and name_text is not None:
+                references.setdefault(node_key(node), []).append(
+                    (_REFERENCE_KINDS[capture], name_text),
+                )
+    return definitions, references
@@ -0,0 +1,100 @@
+"""Code owners from a ``CODEOWNERS`` file, attached to analyzed files.
+
+Each line of a CODEOWNERS file is a gitignore-style pattern followed by
+its owners::
+
+    *                 @org/platform
+    /services/api/    @org/api @alice
+    *.sql             @org/data
+
+The last matching line wins, and a pattern without owners leaves files
+unowned.  A pattern also matches everything under a matching directory,
+except that ``docs/*`` only matches the files directly in ``docs``.
+GitLab section headers (``[Section]``) are skipped, so their rules apply
+as if the file had no sections.  A custom mapping file uses the same
+syntax, with paths relative to its own directory.
+"""
+
+from __future__ import annotations
+
+import os
+import re
+from dataclasses import dataclass
+from pathlib import Path
+
+from . import walking
+
+# Where GitHub and GitLab look for the file, relative to the repository root.
+CODEOWNERS_LOCATIONS: tuple[str, ...] = (
+    ".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS",
+)
+
+# The group of files no rule owns, in ownership views.
+UNOWNED: str = "(unowned)"
+
+
+@dataclass(frozen=True)
+class _OwnerRule:
+    regex: re.Pattern[str]
+    directory_only: bool  # the pattern ended in "/"
+    direct_only: bool  # the pattern ended in "/*"
+    owner: str | None  # owners as written, space-separated; None disowns
+
+
+class Owners:
+    """The owner of each path, per the rules of one CODEOWNERS file."""
+
+    def __init__(self, rules: list[_OwnerRule], base: Path) -> None:
+        self._rules: list[_OwnerRule] = rules
+        self.base: Path = base.resolve()  # the directory patterns are relative to
+
+    @classmethod
+    def load(cls, path: Path, base: Path | None = None) -> Owners:
+        """Parse *path*; raises ``ValueError`` for a line with a bad pattern."""
+        rules: list[_OwnerRule] = []
+        for number, line in enumerate(path.read_text(encoding="utf-8").splitlines(), 1):
+            line = line.split(" #", 1)[0].strip()
+            if not line or line.startswith(("#", "[", "^[")):
+                continue
+            pattern, *owners = line.split()
+            if pattern.startswith("!"):
+                raise ValueError(f"{path}:{number}: negated patterns are not supported")
+            try:
+                regex: re.Pattern[str] = walking.glob_to_regex(pattern.rstrip("/"))
+            except re.error as exc:
+                raise ValueError(f"{path}:{number}: bad pattern {pattern!r}: {exc}") from None
+            rules.append(_OwnerRule(
+                regex, pattern.endswith("/"), pattern.endswith("/*"), " ".join(owners) or None,
+            ))
+        return cls(rules, base if base is not None else path.parent)
+
+    def owner(self, path: str) -> str | None:
+        """Who owns *path* (relative to the working directory), or None."""
+        relative: str = os.path.relpath(os.path.abspath(path), self.base).replace(os.sep, "/")
+        if relative.startswith("../"):
+            return None
+        parts: list[str] = relative.split("/")
+        for rule in reversed(self._rules):
+            for i in range(len(parts), 0, -1):
+                if rule.directory_only and i == len(parts):
+                    continue
+                if rule.direct_only and i < len(parts):
+                    break
+                if rule.regex.match("/".join(parts[:i])):
+                    return rule.owner
+        return None
+
+
+def find_codeowners(start: Path = Path(".")) -> tuple[Path, Path] | None:
+    """The CODEOWNERS file of the repository holding *start*, and that root.
+
+    The repository root is the nearest directory with ``.git``; without
+    one, *start* itself is searched.
+    """
+    current: Path = start.resolve()
+    root: Path = next((d for d in (current, *current.parents) if (d / ".git").exists()), current)
+    for location in CODEOWNERS_LOCATIONS:
+        candidate: Path = root / location
+        if candidate.is_file():
+            return candidate, root
+    return None
@@ -2,10 +2,12 @@
 
 from __future__ import annotations
 
+import os
+import re
 import warnings
 from collections.abc import Iterator
 from pathlib import Path
-from typing import cast
+from typing import Any, cast
 
 from tree_sitter import Node, Parser, Tree
 
@@ -20,7 +22,9 @@ with warnings.catch_warnings():
 FILENAME_TO_LANGUAGE: dict[str, str] = {
     "Dockerfile": "dockerfile",
     "GNUmakefile": "make",
+    "Gemfile": "ruby",
     "Makefile": "make",
+    "Rakefile": "ruby",
     "go.mod": "gomod",
     "makefile": "make",
 }
@@ -88,6 +92,7 @@ EXTENSION_TO_LANGUAGE: dict[str, str] = {
     # javascript
     ".cjs": "javascript",
     ".js": "javascript",
+    ".jsx": "javascript",
     ".mjs": "javascript",
     # json
     ".json": "json",
@@ -111,6 +116,7 @@ EXTENSION_TO_LANGUAGE: dict[str, str] = {
     ".pm": "perl",
     # php
     ".php": "php",
+    ".phtml": "php",
     # python
     ".py": "python",
     ".pyi": "python",
@@ -123,6 +129,8 @@ EXTENSION_TO_LANGUAGE: dict[str, str] = {
     # rst
     ".rst": "rst",
     # ruby
+    ".gemspec": "ruby",
+    ".rake": "ruby",
     ".rb": "ruby",
     # rust
     ".rs": "rust",
@@ -143,9 +151,148 @@ EXTENSION_TO_LANGUAGE: dict[str, str] = {
 }
 
 
+# Bytes read from each end of an extensionless file to tell its language.
+_SNIFF_BYTES: int = 1024
+
+# Interpreters ``#!`` lines name, without version suffixes (``python3.12``).
+_INTERPRETERS: dict[str, str] = {
+    "ash": "bash", "bash": "bash", "dash": "bash", "ksh": "bash", "sh": "bash", "zsh": "bash",
+    "bun": "javascript", "node": "javascript", "nodejs": "javascript",
+    "deno": "typescript", "ts-node": "typescript", "tsx": "typescript",
+    "elixir": "elixir", "escript": "erlang", "julia": "julia", "lua": "lua", "luajit": "lua",
+    "make": "make", "ocaml": "ocaml", "perl": "perl", "php": "php", "pypy": "python",
+    "python": "python", "Rscript": "r", "ruby": "ruby", "runghc": "haskell",
+    "runhaskell": "haskell", "sbcl": "commonlisp", "scala": "scala",
+}
+
+# Vim filetypes and Emacs modes that are not named like the language.
+_MODE_NAMES: dict[str, str] = {
+    "c++": "cpp", "cperl": "perl", "cs": "c_sharp", "csharp": "c_sharp",
+    "emacs-lisp": "elisp", "js": "javascript", "js2": "javascript", "lisp": "commonlisp",
+    "makefile": "make", "sh": "bash", "shell-script": "bash", "terraform": "hcl",
+    "ts": "typescript", "zsh": "bash",
+}
+
+_SHEBANG_RE: re.Pattern[bytes] = re.compile(rb"#!\s*(\S+)[ \t]*([^\r\n]*)")
+_VERSION_RE: re.Pattern[str] = re.compile(r"[\d.]+$")
+# ``vim: set ft=python:``, ``vi: syntax=sh``, ``-*- mode: ruby -*-``, ``-*- python -*-``.
+_VIM_MODELINE_RE: re.Pattern[str] = re.compile(
+    r"(?:^|\s)(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w+-]+)",
+)
+_EMACS_MODELINE_RE: re.Pattern[str] = re.compile(
+    r"-\*-\s*(?:[^\n]*?\bmode:\s*([\w+-]+)[^\n]*?|([\w+-]+)\s*)-\*-", re.IGNORECASE,
+)
+# Rule lines followed by a tab-indented recipe, as makefiles have.
+_MAKE_RULE_RE: re.Pattern[bytes] = re.compile(rb"^[\w./%$() -]+:(?!=)[^\n]*\n\t\S", re.MULTILINE)
+
+# Paths matched before detection: file names and extensions, from the config file.
+_filetypes: dict[str, str] = {}
+
+
+def parse_filetypes(spec: Any, where: str) -> dict[str, str]:
+    """Validate a ``filetypes`` table mapping extensions or file names to languages."""
+    if not isinstance(spec, dict):
+        raise ValueError(f"{where}: 'filetypes' must map extensions or file names to languages")
+    known: set[str] = {*EXTENSION_TO_LANGUAGE.values(), *FILENAME_TO_LANGUAGE.values()}
+    for pattern, language in spec.items():
+        if not isinstance(language, str) or language not in known:
+            raise ValueError(f"{where}: unknown language {language!r} for {pattern!r} in filetypes")
+        if not pattern or "/" in pattern:
+            raise ValueError(f"{where}: {pattern!r} in filetypes is not an extension or file name")
+    return {str(pattern): language for pattern, language in spec.items()}
+
+
+def register_filetypes(filetypes: dict[str, str]) -> None:
+    """Detect files by *filetypes*, as parse_filetypes returns them, before anything else."""
+    _filetypes.update(filetypes)
+
+
+def clear_filetypes() -> None:
+    _filetypes.clear()
+
+
+def registered_filetypes() -> dict[str, str]:
+    return dict(_filetypes)
+
+
+def _mode_language(name: str) -> str | None:
+    """The language a Vim filetype, Emacs mode, or interpreter names."""
+    known: set[str] = {*EXTENSION_TO_LANGUAGE.values(), *FILENAME_TO_LANGUAGE.values()}
+    lowered: str = name.lower()
+    found: str | None = _MODE_NAMES.get(lowered) or _INTERPRETERS.get(name)
+    return found or (lowered if lowered in known else None)
+
+
+def _shebang_language(line: bytes) -> str | None:
+    """The language of the interpreter a ``#!`` line runs, through ``env`` too."""
+    match: re.Match[bytes] | None = _SHEBANG_RE.match(line)
+    if match is None:
+        return None
+    words: list[str] = [match.group(1).decode(errors="replace").rsplit("/", 1)[-1]]
+    words += match.group(2).decode(errors="replace").split()
+    if words[0] == "env":  # #!/usr/bin/env -S VAR=1 python3 -u
+        words = [w for w in words[1:] if not w.startswith("-") and "=" not in w] or [""]
+    interpreter: str = words[0]
+    return _INTERPRETERS.get(interpreter) or _INTERPRETERS.get(_VERSION_RE.sub("", interpreter))
+
+
+def sniff_language(head: bytes, tail: bytes = b"") -> str | None:
+    """The language of a file starting with *head* and ending with *tail*, from its content.
+
+    A ``#!`` line decides, then a Vim or Emacs modeline in either, then
+    the opening of PHP and HTML files and the rules of makefiles.
+    """
+    if head.startswith(b"#!"):
+        return _shebang_language(head)
+    for text in (head, tail):
+        decoded: str = text.decode(errors="replace")
+        vim: re.Match[str] | None = _VIM_MODELINE_RE.search(decoded)
+        emacs: re.Match[str] | None = _EMACS_MODELINE_RE.search(decoded)
+        for mode in (vim and vim.group(1), emacs and (emacs.group(1) or emacs.group(2))):
+            language: str | None = _mode_language(mode) if mode else None
+            if language is not None:
+                return language
+    opening: bytes = head.lstrip()
+    if opening.startswith(b"<?php"):
+        return "php"
+    if opening[:15].lower().startswith((b"<!doctype html", b"<html")):
+        return "html"
+    if _MAKE_RULE_RE.search(head):
+        return "make"
+    return None
+
+
+def _read_ends(path: Path) -> tuple[bytes, bytes]:
+    """The first and last _SNIFF_BYTES of *path*; nothing when it cannot be read."""
+    try:
+        with open(path, "rb") as f:
+            head: bytes = f.read(_SNIFF_BYTES)
+            if len(head) < _SNIFF_BYTES:
+                return head, b""
+            f.seek(-_SNIFF_BYTES, os.SEEK_END)
+            return head, f.read(_SNIFF_BYTES)
+    except OSError:
+        return b"", b""
+
+
 def detect_language(path: Path) -> str | None:
-    """Detect tree-sitter language name from a file path."""
-    return FILENAME_TO_LANGUAGE.get(path.name) or EXTENSION_TO_LANGUAGE.get(path.suffix)
+    """Detect tree-sitter language name from a file path.
+
+    Names and extensions registered with register_filetypes come first.
+    A file without an extension is read: ``bin/deploy`` starting with
+    ``#!/usr/bin/env python3`` is Python.
+    """
+    registered: str | None = _filetypes.get(path.name) or (
+        _filetypes.get(path.suffix) if path.suffix else None
+    )
+    if registered is not None:
+        return registered
+    known: str | None = FILENAME_TO_LANGUAGE.get(path.name) or EXTENSION_TO_LANGUAGE.get(
+        path.suffix,
+    )
+    if known is not None or path.suffix:
+        return known
+    return sniff_language(*_read_ends(path))
 
 
 # ---------------------------------------------------------------------------
@@ -183,7 +330,7 @@ LANGUAGE_IDENTIFIER_TYPES: dict[str, frozenset[str]] = {
     "python": _DEFAULT_IDENT,
     "ql": frozenset({"simpleId", "predicateName", "className"}),
     "r": _DEFAULT_IDENT,
-    "ruby": _DEFAULT_IDENT,
+    "ruby": frozenset({"identifier", "constant"}),
     "rust": frozenset({"identifier", "field_identifier", "type_identifier"}),
     "scala": frozenset({"identifier", "type_identifier", "operator_identifier"}),
     "sql": _DEFAULT_IDENT,
@@ -206,6 +353,14 @@ def collect_identifiers(node: Node, ident_types: frozenset[str]) -> Iterator[Nod
         yield from collect_identifiers(child, ident_types)
 
 
+def parse_tree(source_utf8: bytes, language: str) -> Tree:
+    """Parse UTF-8 source bytes into a tree-sitter syntax tree."""
+    with warnings.catch_warnings():
+        warnings.simplefilter("ignore", FutureWarning)
+        parser: Parser = cast(Parser, get_parser(language))
+    return parser.parse(source_utf8)
+
+
 def parse_identifiers(source_utf8: bytes, language: str) -> list[tuple[int, int, str]]:
     """Parse UTF-8 source bytes and return identifiers as (row, byte_col, text).
 
@@ -213,11 +368,8 @@ def parse_identifiers(source_utf8: bytes, language: str) -> list[tuple[int, int,
     (relative to the BOM-stripped UTF-8 content). Use ``byte_col_to_char_col``
     to convert to a character column for display.
     """
-    with warnings.catch_warnings():
-        warnings.simplefilter("ignore", FutureWarning)
-        parser: Parser = cast(Parser, get_parser(language))
     ident_types: frozenset[str] = LANGUAGE_IDENTIFIER_TYPES.get(language, _DEFAULT_IDENT)
-    tree: Tree = parser.parse(source_utf8)
+    tree: Tree = parse_tree(source_utf8, language)
     identifiers: list[tuple[int, int, str]] = []
     for node in collect_identifiers(tree.root_node, ident_types):
         row: int = node.start_point[0] + 1  # 1-indexed
@@ -227,6 +379,15 @@ def parse_identifiers(source_utf8: bytes, language: str) -> list[tuple[int, int,
     return identifiers
 
 
+def source_lines(source_utf8: bytes) -> list[bytes]:
+    """The lines of *source_utf8* as tree-sitter counts rows, without line endings.
+
+    Only ``\\n`` ends a line.  bytes.splitlines also breaks at a lone
+    ``\\r``, which shifts the rows of everything after it.
+    """
+    return [line.removesuffix(b"\r") for line in source_utf8.split(b"\n")]
+
+
 def byte_col_to_char_col(line_bytes: bytes, byte_col_1: int) -> int:
     """Convert a 1-indexed byte offset to a 1-indexed character column."""
     return len(line_bytes[: byte_col_1 - 1].decode("utf-8", errors="replace")) + 1
@@ -0,0 +1,296 @@
+"""External extractors for file formats autosg has no grammar for.
+
+A plugin is a program that autosg starts once per process and talks to
+over stdin and stdout, one JSON object per line.  For every file matching
+the plugin's globs it is sent::
+
+    {"path": "conf/app.routes", "language": "routes", "content": "GET /health health\\n"}
+
+and must answer with exactly one line, either ``{"error": "..."}`` (the
+file is skipped with a warning) or the file's entities and edges::
+
+    {"entities": [{"id": 1, "kind": "route", "name": "GET /health",
+                   "row": 1, "col": 1, "end_row": 1, "end_col": 19,
+                   "parent": null, "attrs": {"method": "GET"}}],
+     "edges": [{"kind": "calls", "source": 1, "target": null,
+                "attrs": {"name": "health"}}]}
+
+Entity fields are those of :class:`~autosg.extracting.Entity`; ``kind``,
+``name``, ``row``, and ``col`` are required.  Ids only need to be unique
+within the reply: autosg adds the file entity and renumbers the rest in
+order, and a ``null`` parent means the file.  An edge with a ``target`` is
+kept as is; one without a target names what it points at in
+``attrs.name`` and is resolved like a built-in reference when its kind is
+requested with ``--edges``.
+
+Plugins are declared in the config file::
+
+    plugins:
+      - name: routes
+        command: python tools/routes_plugin.py
+        files: ["*.routes"]
+
+``name`` becomes the ``language`` of the files the plugin handles, so it
+also works with ``--languages``.  A plugin is consulted before the
+built-in languages, so it can take over an extension autosg parses too.
+"""
+
+from __future__ import annotations
+
+import atexit
+import json
+import os
+import shlex
+import subprocess
+import threading
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import IO, Any
+
+from . import walking
+from .extracting import Edge, Entity, assign_uids
+
+# Entity fields a plugin may set, with the types they must have.
+_ENTITY_FIELDS: dict[str, type] = {
+    "kind": str,
+    "name": str,
+    "row": int,
+    "col": int,
+    "end_row": int,
+    "end_col": int,
+    "start_byte": int,
+    "end_byte": int,
+    "attrs": dict,
+}
+
+
+class PluginError(Exception):
+    """Raised when a plugin cannot be started or sends an invalid reply."""
+
+
+@dataclass(frozen=True)
+class Plugin:
+    """An external extractor and the files it handles."""
+
+    name: str  # language name given to matching files
+    command: tuple[str, ...]
+    files: tuple[str, ...]  # globs, as for --include
+    cwd: str | None = None  # working directory of the plugin process
+
+    def matches(self, path: Path) -> bool:
+        rel: str = Path(os.path.relpath(path)).as_posix()
+        return any(walking.glob_to_regex(g).match(rel) for g in self.files)
+
+
+def parse_plugin(spec: Any, where: str, cwd: str | None = None) -> Plugin:
+    """Build a plugin from a config entry; raises ``ValueError`` if malformed."""
+    if not isinstance(spec, dict):
+        raise ValueError(f"{where}: expected a table with name, command, and files")
+    unknown: list[str] = sorted(set(spec) - {"name", "command", "files"})
+    if unknown:
+        raise ValueError(f"{where}: unknown key(s) {', '.join(map(repr, unknown))}")
+    name: Any = spec.get("name")
+    command: Any = spec.get("command")
+    files: Any = spec.get("files")
+    if not isinstance(name, str) or not name:
+        raise ValueError(f"{where}: 'name' must be a non-empty string")
+    if isinstance(command, str):
+        command = shlex.split(command)
+    if not isinstance(command, list) or not command or not all(
+        isinstance(c, str) for c in command
+    ):
+        raise ValueError(f"{where}: 'command' must be a string or a list of strings")
+    if isinstance(files, str):
+        files = [files]
+    if not isinstance(files, list) or not files or not all(isinstance(f, str) for f in files):
+        raise ValueError(f"{where}: 'files' must be a glob or a list of globs")
+    return Plugin(name, tuple(command), tuple(files), cwd)
+
+
+# ---------------------------------------------------------------------------
+# Registry
+# ---------------------------------------------------------------------------
+
+_registered: list[Plugin] = []
+
+
+def register_plugin(plugin: Plugin) -> None:
+    """Make *plugin* handle its files in every later analysis."""
+    _registered[:] = [p for p in _registered if p.name != plugin.name]
+    _registered.append(plugin)
+
+
+def clear_plugins() -> None:
+    """Forget every registered plugin and stop its process, as between a daemon's commands."""
+    _registered.clear()
+    _stop_all()
+
+
+def registered_plugins() -> tuple[Plugin, ...]:
+    return tuple(_registered)
+
+
+def plugin_for(path: Path) -> Plugin | None:
+    """The first registered plugin whose globs match *path*."""
+    return next((p for p in _registered if p.matches(path)), None)
+
+
+# ---------------------------------------------------------------------------
+# Protocol
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class _Process:
+    popen: subprocess.Popen[str]
+    pid: int = field(default_factory=os.getpid)  # the autosg process that started it
+    lock: threading.Lock = field(default_factory=threading.Lock)
+
+    def request(self, message: dict[str, Any]) -> str:
+        stdin: IO[str] | None = self.popen.stdin
+        stdout: IO[str] | None = self.popen.stdout
+        assert stdin is not None and stdout is not None
+        with self.lock:
+            try:
+                stdin.write(json.dumps(message) + "\n")
+                stdin.flush()
+            except BrokenPipeError:
+                raise PluginError("plugin exited") from None
+            line: str = stdout.readline()
+        if not line:
+            raise PluginError(f"plugin exited with status {self.popen.wait()}")
+        return line
+
+
+# One process per plugin, started on first use.
+_processes: dict[str, _Process] = {}
+
+
+def _process(plugin: Plugin) -> _Process:
+    process: _Process | None = _processes.get(plugin.name)
+    # Forked workers must not share their parent's pipes.
+    if process is not None and process.pid == os.getpid() and process.popen.poll() is None:
+        return process
+    try:
+        popen: subprocess.Popen[str] = subprocess.Popen(
+            plugin.command,
+            stdin=subprocess.PIPE,
+            stdout=subprocess.PIPE,
+            cwd=plugin.cwd,
+            text=True,
+            encoding="utf-8",
+        )
+    except OSError as exc:
+        raise PluginError(f"cannot start {shlex.join(plugin.command)}: {exc.strerror}") from None
+    process = _Process(popen)
+    _processes[plugin.name] = process
+    return process
+
+
+@atexit.register
+def _stop_all() -> None:
+    for process in _processes.values():
+        if process.pid != os.getpid():
+            continue
+        if process.popen.stdin is not None:
+            process.popen.stdin.close()  # EOF asks the plugin to exit
+        try:
+            process.popen.wait(timeout=5)
+        except subprocess.TimeoutExpired:
+            process.popen.kill()
+    _processes.clear()
+
+
+def _entity(data: Any, index: int) -> dict[str, Any]:
+    """Check one reply entity and return its fields."""
+    if not isinstance(data, dict):
+        raise PluginError(f"entity {index} is not an object")
+    for key in ("kind", "name", "row", "col"):
+        if key not in data:
+            raise PluginError(f"entity {index} has no {key!r}")
+    for key, expected in _ENTITY_FIELDS.items():
+        value: Any = data.get(key)
+        if value is not None and (not isinstance(value, expected) or isinstance(value, bool)):
+            raise PluginError(f"entity {index}: {key!r} has the wrong type")
+    return data
+
+
+def run_plugin(plugin: Plugin, path: str, source_utf8: bytes) -> tuple[list[Entity], list[Edge]]:
+    """Extract the file at *path* with *plugin*, numbering entities from 0.
+
+    Returns (entities, references) like
+    :func:`~autosg.extracting.extract_entities`.
+    """
+    text: str = source_utf8.decode("utf-8")
+    line: str = _process(plugin).request(
+        {"path": path, "language": plugin.name, "content": text},
+    )
+    try:
+        reply: Any = json.loads(line)
+    except json.JSONDecodeError as exc:
+        raise PluginError(f"invalid JSON reply: {exc}") from None
+    if not isinstance(reply, dict):
+        raise PluginError("reply is not an object")
+    if "error" in reply:
+        raise PluginError(str(reply["error"]))
+    raw_entities: Any = reply.get("entities", [])
+    raw_edges: Any = reply.get("edges", [])
+    if not isinstance(raw_entities, list) or not isinstance(raw_edges, list):
+        raise PluginError("'entities' and 'edges' must be lists")
+
+    lines: list[str] = text.split("\n")
+    entities: list[Entity] = [Entity(
+        id=0,
+        kind="file",
+        name=Path(path).name,
+        path=path,
+        language=plugin.name,
+        row=1,
+        col=1,
+        end_row=len(lines),
+        end_col=len(lines[-1]) + 1,
+        start_byte=0,
+        end_byte=len(source_utf8),
+    )]
+    checked: list[dict[str, Any]] = [_entity(e, i) for i, e in enumerate(raw_entities)]
+    ids: dict[Any, int] = {e.get("id", i): i + 1 for i, e in enumerate(checked)}
+    for data in checked:
+        parent: Any = data.get("parent")
+        if parent is not None and parent not in ids:
+            raise PluginError(f"entity {data.get('id')!r} has unknown parent {parent!r}")
+        entities.append(Entity(
+            id=len(entities),
+            kind=data["kind"],
+            name=data["name"],
+            path=path,
+            language=plugin.name,
+            row=data["row"],
+            col=data["col"],
+            end_row=data.get("end_row") or data["row"],
+            end_col=data.get("end_col") or data["col"],
+            parent=ids[parent] if parent is not None else 0,
+            attrs=data.get("attrs") or {},
+            start_byte=data.get("start_byte"),
+            end_byte=data.get("end_byte"),
+        ))
+    references: list[Edge] = []
+    for i, data in enumerate(raw_edges):
+        if not isinstance(data, dict) or not isinstance(data.get("kind"), str):
+            raise PluginError(f"edge {i} has no 'kind'")
+        source: Any = data.get("source")
+        target: Any = data.get("target")
+        attrs: Any = data.get("attrs") or {}
+        if source not in ids or (target is not None and target not in ids):
+            raise PluginError(f"edge {i} refers to an unknown entity")
+        if not isinstance(attrs, dict) or (target is None and "name" not in attrs):
+            raise PluginError(f"edge {i} needs a target or attrs.name")
+        confidence: Any = attrs.get("confidence", 1)
+        if isinstance(confidence, bool) or not isinstance(confidence, (int, float)) or not (
+            0 <= confidence <= 1
+        ):
+            raise PluginError(f"edge {i} has a confidence outside 0 to 1")
+        references.append(Edge(
+            data["kind"], ids[source], ids[target] if target is not None else None, attrs,
+        ))
+    assign_uids(entities)
+    return entities, references
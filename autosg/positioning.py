@@ -0,0 +1,126 @@
+"""Column units, for ``analyze --columns``.
+
+Extraction counts columns in characters: Unicode code points, Go's
+runes, whatever the text's script.  Consumers count otherwise:
+
+- ``chars``: code points, the default.
+- ``utf-16``: UTF-16 code units, as LSP, JavaScript, Java, and C# do.  A
+  character outside the Basic Multilingual Plane, such as most emoji,
+  counts two.
+- ``bytes``: bytes of the UTF-8 text, as tree-sitter, Go's go/token, and
+  Rust do.  A CJK character counts three.
+
+Columns are converted as results are written, from each file's lines
+read again, so the cache and every extractor keep counting characters.
+ASCII lines count the same in every unit and are left as they are, as
+are notebooks, whose cells are not lines of the file.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+from collections.abc import Iterator
+from pathlib import Path
+
+from .analysis import Analysis, FileResult
+from .annotating import FileEncoding, read_source_utf8
+from .extracting import Edge, Entity, ParseError
+from .parsing import source_lines
+
+COLUMN_UNITS: tuple[str, ...] = ("chars", "utf-16", "bytes")
+
+
+def column(line: str, col: int, unit: str) -> int:
+    """The 1-indexed character column *col* of *line*, counted in *unit*."""
+    if unit == "chars" or line.isascii():
+        return col
+    prefix: str = line[: col - 1]
+    if unit == "bytes":
+        return len(prefix.encode("utf-8")) + 1
+    return len(prefix.encode("utf-16-le")) // 2 + 1
+
+
+class ColumnAnalysis(Analysis):
+    """*analysis* with its columns counted in *unit* rather than characters.
+
+    Entities and errors are copied before they change, so the wrapped
+    analysis keeps its own.  Edges that record where they occur (call
+    sites) are converted too, from the non-ASCII lines of each file,
+    which are kept until the edges are read.
+    """
+
+    def __init__(self, analysis: Analysis, unit: str) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.unit: str = unit
+        self._file_of: dict[int, str] = {}
+        self._lines: dict[str, dict[int, str]] = {}  # path -> row -> non-ASCII line
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            yield self.file_result(file_result)
+
+    def _source(self, path: str) -> Path:
+        """Where the file output names *path* is read from."""
+        for root, label in self.options.labels.items():
+            if path == label:
+                return root
+            if path.startswith(label + "/"):
+                return root / path[len(label) + 1 :]
+        return Path(path)
+
+    def _read(self, path: str) -> dict[int, str]:
+        """The non-ASCII lines of *path* by 1-indexed row; none if it cannot be read."""
+        try:
+            source: tuple[bytes, FileEncoding] | None = read_source_utf8(self._source(path))
+        except OSError:
+            return {}  # e.g. a package of --granularity package
+        if source is None:
+            return {}
+        return {
+            row: line.decode("utf-8", errors="replace")
+            for row, line in enumerate(source_lines(source[0]), 1)
+            if not line.isascii()
+        }
+
+    def _col(self, lines: dict[int, str], row: int, col: int) -> int:
+        line: str | None = lines.get(row)
+        return col if line is None else column(line, col, self.unit)
+
+    def file_result(self, file_result: FileResult) -> FileResult:
+        """*file_result* with the columns of its entities and errors in :attr:`unit`."""
+        for entity in file_result.entities:
+            self._file_of[entity.id] = file_result.path
+        if any("cell" in e.attrs for e in file_result.entities):
+            return file_result  # rows count from the top of each notebook cell
+        lines: dict[int, str] = self._read(file_result.path)
+        if not lines:
+            return file_result
+        if self.options.edges:
+            self._lines[file_result.path] = lines
+        entities: list[Entity] = [
+            dataclasses.replace(
+                e, col=self._col(lines, e.row, e.col),
+                end_col=self._col(lines, e.end_row, e.end_col),
+            )
+            for e in file_result.entities
+        ]
+        errors: list[ParseError] = [
+            dataclasses.replace(
+                e, col=self._col(lines, e.row, e.col),
+                end_col=self._col(lines, e.end_row, e.end_col),
+            )
+            for e in file_result.errors
+        ]
+        return dataclasses.replace(file_result, entities=entities, errors=errors)
+
+    @property
+    def edges(self) -> Iterator[Edge]:
+        for edge in self.analysis.edges:
+            path: str | None = self._file_of.get(edge.source)
+            lines: dict[int, str] | None = self._lines.get(path) if path is not None else None
+            if lines and "row" in edge.attrs and "col" in edge.attrs:
+                col: int = self._col(lines, edge.attrs["row"], edge.attrs["col"])
+                if col != edge.attrs["col"]:
+                    edge = dataclasses.replace(edge, attrs={**edge.attrs, "col": col})
+            yield edge
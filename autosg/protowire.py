@@ -0,0 +1,137 @@
+"""Protocol Buffers wire format, for the gRPC API without generated code.
+
+Messages are described by tuples of ``Field`` and read and written as
+dicts, so grpcserving.py can mirror autosg.proto without protoc.  Only what
+that file uses is supported: int64, bool, string, bytes, and message
+fields, repeated or proto3 ``optional``.  Unknown fields are skipped when
+reading, as protobuf requires.
+"""
+
+from __future__ import annotations
+
+from dataclasses import dataclass
+from typing import Any
+
+_VARINT: int = 0
+_FIXED64: int = 1
+_LENGTH: int = 2
+_FIXED32: int = 5
+
+_DEFAULTS: dict[str, Any] = {"int64": 0, "bool": False, "string": "", "bytes": b""}
+
+
+class WireError(Exception):
+    """Raised when a message cannot be decoded."""
+
+
+@dataclass(frozen=True)
+class Field:
+    number: int
+    name: str
+    type: str  # "int64", "bool", "string", "bytes", or "message"
+    repeated: bool = False
+    optional: bool = False  # proto3 optional: presence is kept, None when absent
+    message: tuple[Field, ...] = ()  # the fields of a message-typed field
+
+
+def _varint(value: int) -> bytes:
+    value &= (1 << 64) - 1  # negative int64 values take ten bytes
+    out: bytearray = bytearray()
+    while value > 0x7F:
+        out.append(value & 0x7F | 0x80)
+        value >>= 7
+    out.append(value)
+    return bytes(out)
+
+
+def _encode_value(field: Field, value: Any) -> bytes:
+    if field.type in ("int64", "bool"):
+        return _varint(field.number << 3 | _VARINT) + _varint(int(value))
+    payload: bytes
+    if field.type == "string":
+        payload = value.encode()
+    elif field.type == "bytes":
+        payload = bytes(value)
+    else:
+        payload = encode(field.message, value)
+    return _varint(field.number << 3 | _LENGTH) + _varint(len(payload)) + payload
+
+
+def encode(fields: tuple[Field, ...], values: dict[str, Any]) -> bytes:
+    """*values* as a message of *fields*; absent and default values are left out."""
+    out: list[bytes] = []
+    for field in fields:
+        value: Any = values.get(field.name)
+        if value is None:
+            continue
+        if field.repeated:
+            out.extend(_encode_value(field, item) for item in value)
+        elif field.optional or field.type == "message" or value != _DEFAULTS[field.type]:
+            out.append(_encode_value(field, value))
+    return b"".join(out)
+
+
+def _read_varint(data: bytes, pos: int) -> tuple[int, int]:
+    result: int = 0
+    shift: int = 0
+    while True:
+        if pos >= len(data) or shift > 63:
+            raise WireError("truncated or overlong varint")
+        byte: int = data[pos]
+        pos += 1
+        result |= (byte & 0x7F) << shift
+        if not byte & 0x80:
+            return result, pos
+        shift += 7
+
+
+def decode(fields: tuple[Field, ...], data: bytes) -> dict[str, Any]:
+    """A message of *fields* as a dict, with defaults for absent fields."""
+    by_number: dict[int, Field] = {f.number: f for f in fields}
+    values: dict[str, Any] = {
+        f.name: [] if f.repeated else None if f.optional or f.type == "message"
+        else _DEFAULTS[f.type]
+        for f in fields
+    }
+    pos: int = 0
+    while pos < len(data):
+        key, pos = _read_varint(data, pos)
+        number, wire = key >> 3, key & 7
+        raw: Any
+        if wire == _VARINT:
+            raw, pos = _read_varint(data, pos)
+        elif wire == _LENGTH:
+            length, pos = _read_varint(data, pos)
+            if pos + length > len(data):
+                raise WireError("truncated length-delimited field")
+            raw, pos = data[pos : pos + length], pos + length
+        elif wire in (_FIXED64, _FIXED32):
+            pos += 8 if wire == _FIXED64 else 4
+            continue
+        else:
+            raise WireError(f"unsupported wire type {wire}")
+        field: Field | None = by_number.get(number)
+        if field is None:
+            continue
+        value: Any
+        if field.type in ("int64", "bool"):
+            if wire != _VARINT:
+                raise WireError(f"field {field.name}: expected a varint")
+            value = raw - (1 << 64) if raw >= 1 << 63 else raw
+            value = bool(value) if field.type == "bool" else value
+        elif wire != _LENGTH:
+            raise WireError(f"field {field.name}: expected a length-delimited value")
+        elif field.type == "string":
+            try:
+                value = raw.decode()
+            except UnicodeDecodeError:
+                raise WireError(f"field {field.name}: invalid UTF-8") from None
+        elif field.type == "bytes":
+            value = raw
+        else:
+            value = decode(field.message, raw)
+        if field.repeated:
+            values[field.name].append(value)
+        else:
+            values[field.name] = value
+    return values
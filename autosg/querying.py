@@ -0,0 +1,108 @@
+"""Entity filters for the ``query`` command.
+
+A query is a conjunction of simple tests on each entity::
+
+    --kind function --name 'Handler$' --file 'examples/**' --attr 'metrics.complexity>=10'
+
+``--name`` is a regular expression searched in the qualified name
+(``Server.Start``), ``--file`` globs match the entity's path, and
+``--attr`` tests an attribute: ``KEY`` (present and truthy), ``KEY=VALUE``,
+``KEY!=VALUE``, or a numeric comparison with ``<``, ``<=``, ``>``, ``>=``.
+Dotted keys reach into nested attributes.  A list attribute such as
+``annotations`` or ``decorators`` matches ``=`` if any element does, where
+``RequestMapping`` also matches ``RequestMapping("/api")``.
+"""
+
+from __future__ import annotations
+
+import json
+import operator
+import re
+from collections.abc import Callable
+from dataclasses import dataclass, field
+from typing import Any
+
+from .extracting import Entity
+from .walking import glob_to_regex
+
+_ATTR_FILTER_RE: re.Pattern[str] = re.compile(r"^([\w.-]+)\s*(?:(!=|<=|>=|=|<|>)\s*(.*))?$")
+
+_NUMERIC_OPERATORS: dict[str, Callable[[float, float], bool]] = {
+    "<": operator.lt,
+    "<=": operator.le,
+    ">": operator.gt,
+    ">=": operator.ge,
+}
+
+_MISSING: object = object()
+
+
+@dataclass(frozen=True)
+class AttrFilter:
+    """One ``--attr`` test."""
+
+    key: str
+    op: str | None = None  # None: the attribute is present and truthy
+    value: str = ""
+
+    def matches(self, attrs: dict[str, Any]) -> bool:
+        actual: Any = attrs
+        for part in self.key.split("."):
+            if not isinstance(actual, dict) or part not in actual:
+                return self.op == "!="
+            actual = actual[part]
+        if self.op is None:
+            return bool(actual)
+        if self.op in _NUMERIC_OPERATORS:
+            try:
+                return _NUMERIC_OPERATORS[self.op](float(actual), float(self.value))
+            except (TypeError, ValueError):
+                return False
+        equal: bool = _equals(actual, self.value)
+        return equal if self.op == "=" else not equal
+
+
+def _equals(actual: Any, expected: str) -> bool:
+    if isinstance(actual, list):
+        return any(_equals(item, expected) for item in actual)
+    if isinstance(actual, str):
+        # Annotations and decorators with arguments match by their name.
+        return actual == expected or actual.startswith(expected + "(")
+    return json.dumps(actual) == expected or str(actual) == expected
+
+
+def parse_attr_filter(text: str) -> AttrFilter:
+    """Parse ``KEY``, ``KEY=VALUE``, ``KEY>=N``, ...; raises ``ValueError``."""
+    match: re.Match[str] | None = _ATTR_FILTER_RE.match(text.strip())
+    if match is None:
+        raise ValueError(f"expected KEY, KEY=VALUE, or KEY>=N, got {text!r}")
+    key, op, value = match.groups()
+    if op in _NUMERIC_OPERATORS:
+        try:
+            float(value)
+        except ValueError:
+            raise ValueError(f"{op} needs a number, got {value!r}") from None
+    return AttrFilter(key, op, value or "")
+
+
+@dataclass
+class Query:
+    """Tests an entity must pass to match; empty fields match everything."""
+
+    kinds: frozenset[str] = frozenset()
+    name: re.Pattern[str] | None = None
+    files: tuple[str, ...] = ()
+    attrs: tuple[AttrFilter, ...] = ()
+    _file_patterns: list[re.Pattern[str]] = field(init=False, repr=False)
+
+    def __post_init__(self) -> None:
+        self._file_patterns = [glob_to_regex(p) for p in self.files]
+
+    def matches(self, entity: Entity, qualified_name: str) -> bool:
+        if self.kinds and entity.kind not in self.kinds:
+            return False
+        if self.name is not None and not self.name.search(qualified_name):
+            return False
+        if self._file_patterns and not any(p.match(entity.path) for p in self._file_patterns):
+            return False
+        return all(f.matches(entity.attrs) for f in self.attrs)
@@ -0,0 +1,124 @@
+"""Redacted output, for sharing the structure of a codebase but not its names.
+
+Names, paths, and string values are replaced by keyed hashes, so the same
+identifier always gets the same token and the graph keeps its shape:
+``handlers/user.go`` becomes ``p3b1f0c9e2a/p91d4e7a0c5.go`` and every
+``UserStore`` becomes the same ``n5c2e8f1a07``.  File extensions, entity
+kinds, positions, metrics, and boolean attrs are kept; other attrs (docs,
+types, decorators) are dropped.  Without the key, tokens cannot be
+turned back into names by hashing guesses.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import hashlib
+import hmac
+import os
+import secrets
+from collections.abc import Iterator
+from pathlib import PurePosixPath
+from typing import Any
+
+from .analysis import Analysis, FileResult
+from .extracting import Edge, Entity, ParseError
+
+# Attrs kept as they are: they describe shape, not names.
+_KEPT_ATTRS: frozenset[str] = frozenset({"metrics", "origin", "visibility"})
+
+# Messages of the parse errors that can quote the source, by kind.
+_GENERIC_MESSAGES: dict[str, str] = {"extraction": "extraction failed", "syntax": "syntax error"}
+
+
+def new_key() -> bytes:
+    """A random key, for tokens that only match within one run."""
+    return secrets.token_bytes(32)
+
+
+class Redactor:
+    """Maps names and paths to stable tokens under one key."""
+
+    def __init__(self, key: bytes) -> None:
+        self._key: bytes = key
+
+    def _digest(self, text: str) -> str:
+        return hmac.new(self._key, text.encode(), hashlib.sha256).hexdigest()
+
+    def token(self, text: str, prefix: str = "n") -> str:
+        """*prefix* and a hash of *text*; names and paths hash apart (``n``, ``p``)."""
+        return prefix + self._digest(f"{prefix}\x00{text}")[:10]
+
+    def path(self, path: str) -> str:
+        """Each directory and file name hashed, keeping the extension and ``..``."""
+        parts: list[str] = []
+        for part in PurePosixPath(path.replace(os.sep, "/")).parts:
+            if part in ("/", ".", ".."):
+                parts.append(part)
+                continue
+            stem, dot, suffix = part.rpartition(".")
+            if not stem:  # no extension, or a dotfile
+                stem, dot, suffix = part, "", ""
+            parts.append(self.token(stem, "p") + dot + suffix)
+        return str(PurePosixPath(*parts)) if parts else path
+
+    def attrs(self, attrs: dict[str, Any]) -> dict[str, Any]:
+        kept: dict[str, Any] = {
+            k: v for k, v in attrs.items()
+            if k in _KEPT_ATTRS or isinstance(v, (bool, int, float))
+        }
+        if "root" in attrs:
+            kept["root"] = self.path(attrs["root"])
+        return kept
+
+    def entity(self, entity: Entity) -> Entity:
+        path: str = self.path(entity.path)
+        return dataclasses.replace(
+            entity,
+            name=(
+                PurePosixPath(path).name if entity.kind == "file"
+                else path if not entity.language  # a --hierarchy container, named by its path
+                else self.token(entity.name)
+            ),
+            path=path,
+            attrs=self.attrs(entity.attrs),
+            uid=self._digest(entity.uid)[:16] if entity.uid else entity.uid,
+        )
+
+    def edge(self, edge: Edge) -> Edge:
+        return dataclasses.replace(edge, attrs=self.attrs(edge.attrs))
+
+    def error(self, error: ParseError) -> ParseError:
+        """Syntax errors and extraction failures can quote the source: only their kind is kept."""
+        message: str = _GENERIC_MESSAGES.get(error.kind, error.message)
+        return dataclasses.replace(error, path=self.path(error.path), message=message)
+
+    def file_result(self, file_result: FileResult) -> FileResult:
+        return FileResult(
+            path=self.path(file_result.path),
+            language=file_result.language,
+            entities=[self.entity(e) for e in file_result.entities],
+            references=[self.edge(r) for r in file_result.references],
+            root=self.path(file_result.root) if file_result.root is not None else None,
+            errors=[self.error(e) for e in file_result.errors],
+        )
+
+
+class RedactedAnalysis(Analysis):
+    """*analysis* with its results redacted as they are read.
+
+    Entities are copied, so the wrapped analysis keeps resolving edges
+    from the real names.
+    """
+
+    def __init__(self, analysis: Analysis, key: bytes) -> None:
+        super().__init__(analysis.roots, analysis.options)
+        self.analysis: Analysis = analysis
+        self.redactor: Redactor = Redactor(key)
+
+    def __iter__(self) -> Iterator[FileResult]:
+        for file_result in self.analysis:
+            yield self.redactor.file_result(file_result)
+
+    @property
+    def edges(self) -> Iterator[Edge]:
+        return (self.redactor.edge(e) for e in self.analysis.edges)
@@ -0,0 +1,254 @@
+"""Architecture reports for the ``report`` command.
+
+A report summarizes one analysis for a design review: entity counts per
+package, the package dependency diagram, the largest files, and the most
+depended-on packages.  A package is a directory, as for ``--cluster
+directory``.  HTML reports are a single file with the diagram embedded as
+SVG; Markdown reports carry the same tables, for wikis and pull requests.
+"""
+
+from __future__ import annotations
+
+import html
+import math
+from collections import Counter, defaultdict
+from dataclasses import dataclass
+from typing import TextIO
+
+from .analysis import Analysis
+from .counting import Totals, lines, package
+from .exporting import layer_rows
+
+REPORT_FORMATS: tuple[str, ...] = ("html", "markdown")
+
+
+@dataclass
+class Report:
+    """What a report shows, independent of its format."""
+
+    title: str
+    packages: dict[str, Totals]
+    files: list[tuple[str, int, int]]  # (path, lines, entities), largest first
+    dependencies: dict[tuple[str, str], int]  # (package, dependency) -> edge count
+    edge_kinds: list[str]
+
+    def dependents(self) -> list[tuple[str, int, int]]:
+        """(package, depending packages, edges in), most depended-on first."""
+        packages: dict[str, set[str]] = defaultdict(set)
+        edges: Counter[str] = Counter()
+        for (source, target), count in self.dependencies.items():
+            packages[target].add(source)
+            edges[target] += count
+        return sorted(
+            ((p, len(packages[p]), edges[p]) for p in packages),
+            key=lambda row: (-row[1], -row[2], row[0]),
+        )
+
+    def kinds(self) -> list[str]:
+        """Entity kinds present, most common first."""
+        totals: Counter[str] = Counter()
+        for stats in self.packages.values():
+            totals.update(stats.kinds)
+        return [kind for kind, _count in totals.most_common()]
+
+
+def build_report(analysis: Analysis, title: str) -> Report:
+    """Collect report data; iterates *analysis*, which should resolve its edges."""
+    packages: dict[str, Totals] = defaultdict(Totals)
+    files: list[tuple[str, int, int]] = []
+    package_of: dict[int, str] = {}
+    for file_result in analysis:
+        where: str = package(file_result.path)
+        packages[where].add(file_result)
+        for entity in file_result.entities:
+            package_of[entity.id] = where
+        files.append((
+            file_result.path, lines(file_result.entities[0]), len(file_result.entities) - 1,
+        ))
+    dependencies: dict[tuple[str, str], int] = defaultdict(int)
+    edge_kinds: set[str] = set()
+    for edge in analysis.edges:
+        if edge.target is None or edge.source not in package_of or edge.target not in package_of:
+            continue
+        source, target = package_of[edge.source], package_of[edge.target]
+        if source != target:
+            dependencies[(source, target)] += 1
+            edge_kinds.add(edge.kind)
+    files.sort(key=lambda row: (-row[1], row[0]))
+    return Report(title, dict(packages), files, dict(dependencies), sorted(edge_kinds))
+
+
+# ---------------------------------------------------------------------------
+# Dependency diagram
+# ---------------------------------------------------------------------------
+
+_CHAR_WIDTH: int = 7  # approximate width of a 12px sans-serif character
+_BOX_HEIGHT: int = 28
+_LAYER_GAP: int = 70
+_BOX_GAP: int = 24
+_MARGIN: int = 20
+
+
+def dependency_svg(report: Report, limit: int = 40) -> str:
+    """The package dependency graph as a standalone SVG document.
+
+    Only the *limit* packages with the most dependency edges are drawn.
+    """
+    degree: Counter[str] = Counter()
+    for (source, target), count in report.dependencies.items():
+        degree[source] += count
+        degree[target] += count
+    nodes: list[str] = sorted(name for name, _count in degree.most_common(limit))
+    # Packages in a cycle share a row; row 0 depends on nothing shown.
+    rows: list[list[str]] = layer_rows(nodes, report.dependencies)
+    widths: dict[str, int] = {n: len(n) * _CHAR_WIDTH + 16 for n in nodes}
+    width: int = max(
+        (sum(widths[n] for n in row) + _BOX_GAP * (len(row) - 1) for row in rows), default=0,
+    ) + 2 * _MARGIN
+    height: int = len(rows) * (_BOX_HEIGHT + _LAYER_GAP) - _LAYER_GAP + 2 * _MARGIN
+    boxes: dict[str, tuple[int, int]] = {}  # name -> (x, y) of the top-left corner
+    for depth, row in enumerate(rows):
+        y: int = height - _MARGIN - _BOX_HEIGHT - depth * (_BOX_HEIGHT + _LAYER_GAP)
+        row_width: int = sum(widths[n] for n in row) + _BOX_GAP * (len(row) - 1)
+        x: int = (width - row_width) // 2
+        for name in row:
+            boxes[name] = (x, y)
+            x += widths[name] + _BOX_GAP
+    parts: list[str] = [
+        f'<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="{max(height, 0)}" '
+        f'viewBox="0 0 {width} {max(height, 0)}" font-family="sans-serif" font-size="12">',
+        '<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" '
+        'markerHeight="6" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" '
+        'fill="#888"/></marker></defs>',
+    ]
+    for (source, target), count in sorted(report.dependencies.items()):
+        if source not in boxes or target not in boxes:
+            continue
+        (sx, sy), (tx, ty) = boxes[source], boxes[target]
+        x1: float = sx + widths[source] / 2
+        x2: float = tx + widths[target] / 2
+        stroke: float = 1 + math.log2(count)
+        title: str = html.escape(f"{source} → {target}: {count}")
+        if sy == ty:  # same row: a cycle; rightward arcs above the boxes, leftward below
+            if x1 < x2:
+                path: str = f"M {x1} {sy} Q {(x1 + x2) / 2} {sy - _LAYER_GAP / 2} {x2} {ty}"
+            else:
+                bottom: int = sy + _BOX_HEIGHT
+                path = f"M {x1} {bottom} Q {(x1 + x2) / 2} {bottom + _LAYER_GAP / 2} {x2} {bottom}"
+        elif sy < ty:
+            path = f"M {x1} {sy + _BOX_HEIGHT} L {x2} {ty}"
+        else:  # an edge against the layering, only possible inside cycles
+            path = f"M {x1} {sy} L {x2} {ty + _BOX_HEIGHT}"
+        colour: str = "#c0392b" if sy >= ty else "#888"
+        parts.append(
+            f'<path d="{path}" fill="none" stroke="{colour}" stroke-width="{stroke:.1f}" '
+            f'marker-end="url(#arrow)"><title>{title}</title></path>',
+        )
+    for name, (x, y) in boxes.items():
+        label: str = html.escape(name)
+        parts.append(
+            f'<g><title>{label}</title><rect x="{x}" y="{y}" width="{widths[name]}" '
+            f'height="{_BOX_HEIGHT}" rx="4" fill="#eef3fb" stroke="#4a6fa5"/>'
+            f'<text x="{x + widths[name] / 2}" y="{y + _BOX_HEIGHT / 2 + 4}" '
+            f'text-anchor="middle">{label}</text></g>',
+        )
+    parts.append("</svg>")
+    return "\n".join(parts)
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+
+def _tables(report: Report, top: int) -> list[tuple[str, list[str], list[list[str]]]]:
+    """(heading, columns, rows) for every table, shared by both formats."""
+    kinds: list[str] = report.kinds()
+    packages: list[list[str]] = [
+        [name, str(stats.files), str(stats.lines), *(str(stats.kinds[k]) for k in kinds)]
+        for name, stats in sorted(report.packages.items())
+    ]
+    files: list[list[str]] = [
+        [path, str(lines), str(entities)] for path, lines, entities in report.files[:top]
+    ]
+    dependents: list[list[str]] = [
+        [name, str(packages_in), str(edges_in)]
+        for name, packages_in, edges_in in report.dependents()[:top]
+    ]
+    return [
+        ("Packages", ["Package", "Files", "Lines", *kinds], packages),
+        ("Largest files", ["File", "Lines", "Entities"], files),
+        ("Most depended-on packages", ["Package", "Dependents", "Edges in"], dependents),
+    ]
+
+
+def _summary(report: Report) -> str:
+    files: int = sum(s.files for s in report.packages.values())
+    lines: int = sum(s.lines for s in report.packages.values())
+    via: str = f" via {', '.join(report.edge_kinds)} edges" if report.edge_kinds else ""
+    return (
+        f"{files} files, {lines} lines in {len(report.packages)} packages; "
+        f"{len(report.dependencies)} package dependencies{via}."
+    )
+
+
+_HTML_STYLE: str = """
+body { font-family: sans-serif; margin: 2em auto; max-width: 72em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.6em; }
+th { background: #f4f4f4; text-align: left; }
+td:not(:first-child) { text-align: right; }
+.diagram { overflow-x: auto; margin-bottom: 2em; }
+"""
+
+
+def write_html(report: Report, out: TextIO, top: int = 20) -> None:
+    """Write a self-contained HTML page: inline styles, diagram as inline SVG."""
+    out.write("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+    out.write(f"<title>{html.escape(report.title)}</title>\n<style>{_HTML_STYLE}</style>\n")
+    out.write("</head>\n<body>\n")
+    out.write(f"<h1>{html.escape(report.title)}</h1>\n<p>{html.escape(_summary(report))}</p>\n")
+    out.write("<h2>Package dependencies</h2>\n")
+    if report.dependencies:
+        out.write(
+            "<p>Each package sits above the packages it depends on; red arrows "
+            "are dependencies within a cycle.</p>\n",
+        )
+        out.write(f'<div class="diagram">\n{dependency_svg(report)}\n</div>\n')
+    else:
+        out.write("<p>No dependencies between packages were found.</p>\n")
+    for heading, columns, rows in _tables(report, top):
+        out.write(f"<h2>{html.escape(heading)}</h2>\n<table>\n<tr>")
+        out.write("".join(f"<th>{html.escape(c)}</th>" for c in columns))
+        out.write("</tr>\n")
+        for row in rows:
+            out.write("<tr>" + "".join(f"<td>{html.escape(v)}</td>" for v in row) + "</tr>\n")
+        out.write("</table>\n")
+    out.write("</body>\n</html>\n")
+
+
+def _md_cell(text: str) -> str:
+    return text.replace("|", "\\|")
+
+
+def write_markdown(report: Report, out: TextIO, top: int = 20) -> None:
+    """Write the report's tables as Markdown, dependencies as a table too."""
+    out.write(f"# {report.title}\n\n{_summary(report)}\n\n")
+    tables: list[tuple[str, list[str], list[list[str]]]] = _tables(report, top)
+    dependencies: list[list[str]] = [
+        [source, target, str(count)]
+        for (source, target), count in sorted(
+            report.dependencies.items(), key=lambda item: (-item[1], item[0]),
+        )[:top]
+    ]
+    tables.insert(1, ("Package dependencies", ["Package", "Depends on", "Edges"], dependencies))
+    for heading, columns, rows in tables:
+        out.write(f"## {heading}\n\n")
+        if not rows:
+            out.write("None.\n\n")
+            continue
+        out.write("| " + " | ".join(map(_md_cell, columns)) + " |\n")
+        out.write("|" + "|".join("---" for _ in columns) + "|\n")
+        for row in rows:
+            out.write("| " + " | ".join(map(_md_cell, row)) + " |\n")
+        out.write("\n")
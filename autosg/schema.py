@@ -0,0 +1,140 @@
+"""The layout of ``analyze`` output, versioned, for the ``schema`` command.
+
+``SCHEMA_VERSION`` is recorded in every json, jsonl, sqlite, parquet, and
+arrow output.  It goes up when a field is removed or renamed or changes
+meaning; new fields, attrs, entity kinds, and edge kinds may appear
+without a change, so consumers should ignore what they do not know.
+"""
+
+from __future__ import annotations
+
+from typing import Any
+
+SCHEMA_VERSION: int = 1
+
+DOCUMENTS: tuple[str, ...] = ("json", "jsonl")
+
+_DIALECT: str = "https://json-schema.org/draft/2020-12/schema"
+
+
+def _integer(description: str, nullable: bool = False) -> dict[str, Any]:
+    return {"type": ["integer", "null"] if nullable else "integer", "description": description}
+
+
+def _string(description: str) -> dict[str, Any]:
+    return {"type": "string", "description": description}
+
+
+_ATTRS: dict[str, Any] = {
+    "type": "object",
+    "description": "Kind-specific details, e.g. a function's metrics or an edge's call site.",
+}
+
+_DEFINITIONS: dict[str, dict[str, Any]] = {
+    "file": {
+        "type": "object",
+        "required": ["path", "language"],
+        "properties": {
+            "path": _string("Path of the file as analyzed."),
+            "language": _string("Language the file was parsed as."),
+            "root": _string("The analyzed path the file was found under, if several."),
+        },
+    },
+    "entity": {
+        "type": "object",
+        "description": (
+            "A named declaration.  Rows and columns are 1-indexed and columns count "
+            "characters, or what --columns names; byte offsets are 0-indexed into the UTF-8 "
+            "text.  Ends are exclusive.  --positions drops the line or the byte fields."
+        ),
+        "required": ["id", "kind", "name", "path", "language", "parent", "attrs", "uid"],
+        "properties": {
+            "id": _integer("Number of the entity within this output."),
+            "kind": _string('E.g. "file", "function", "struct".'),
+            "name": _string("Name as declared."),
+            "path": _string("Path of the file declaring it."),
+            "language": _string("Language of that file."),
+            "row": _integer("First line."),
+            "col": _integer("First column."),
+            "end_row": _integer("Last line."),
+            "end_col": _integer("Column after the last character."),
+            "parent": _integer("Id of the enclosing entity; null for a file.", nullable=True),
+            "attrs": _ATTRS,
+            "uid": _string("Identifier stable across runs."),
+            "start_byte": _integer("Offset of the first byte.", nullable=True),
+            "end_byte": _integer("Offset after the last byte.", nullable=True),
+        },
+    },
+    "edge": {
+        "type": "object",
+        "required": ["kind", "source", "target", "attrs"],
+        "properties": {
+            "kind": _string('E.g. "calls", "imports".'),
+            "source": _integer("Id of the entity the edge starts at."),
+            "target": _integer("Id of the entity it points at.", nullable=True),
+            "attrs": _ATTRS,
+        },
+    },
+    "error": {
+        "type": "object",
+        "required": ["path", "kind", "message", "row", "col", "end_row", "end_col"],
+        "properties": {
+            "path": _string("Path of the file."),
+            "kind": {"enum": ["syntax", "missing", "extraction"]},
+            "message": _string("What went wrong."),
+            "row": _integer("First line."),
+            "col": _integer("First column."),
+            "end_row": _integer("Last line."),
+            "end_col": _integer("Column after the last character."),
+        },
+    },
+}
+
+
+def _ref(name: str) -> dict[str, str]:
+    return {"$ref": f"#/$defs/{name}"}
+
+
+def _record(name: str) -> dict[str, Any]:
+    """A jsonl record: one of _DEFINITIONS with its ``type``."""
+    return {
+        "allOf": [
+            {"properties": {"type": {"const": name}}, "required": ["type"]},
+            _ref(name),
+        ],
+    }
+
+
+def json_schema(document: str = "json") -> dict[str, Any]:
+    """The JSON Schema of ``analyze -f json`` output, or of each line of ``-f jsonl``."""
+    defs: dict[str, Any] = {**_DEFINITIONS, "schema_version": {"const": SCHEMA_VERSION}}
+    if document == "jsonl":
+        header: dict[str, Any] = {
+            "type": "object",
+            "required": ["type", "schema_version"],
+            "properties": {"type": {"const": "header"}, "schema_version": _ref("schema_version")},
+        }
+        return {
+            "$schema": _DIALECT,
+            "title": f"autosg analyze -f jsonl record, schema version {SCHEMA_VERSION}",
+            "description": (
+                "Each line is one record.  A header comes first, then each file followed "
+                "by its entities and errors, then the edges."
+            ),
+            "oneOf": [header, *(_record(name) for name in ("file", "entity", "error", "edge"))],
+            "$defs": defs,
+        }
+    return {
+        "$schema": _DIALECT,
+        "title": f"autosg analyze -f json output, schema version {SCHEMA_VERSION}",
+        "type": "object",
+        "required": ["schema_version", "files", "entities", "edges", "errors"],
+        "properties": {
+            "schema_version": _ref("schema_version"),
+            "files": {"type": "array", "items": _ref("file")},
+            "entities": {"type": "array", "items": _ref("entity")},
+            "edges": {"type": "array", "items": _ref("edge")},
+            "errors": {"type": "array", "items": _ref("error")},
+        },
+        "$defs": defs,
+    }
@@ -0,0 +1,671 @@
+"""HTTP server exposing the analysis pipeline as a small JSON API.
+
+Endpoints::
+
+    POST /analyze            analyze a path under the server root, or an upload
+    GET  /entities           entities of an analysis, filterable by kind/path/name
+    GET  /edges              edges of an analysis, filterable by kind
+    GET  /                   the graph explorer page (see exploring.py)
+    GET  /analyses           ids and inputs of the analyses held in memory
+    GET  /health             liveness, for load balancers and orchestrators
+    GET  /metrics            Prometheus metrics: durations, cache hit rate, queue depth
+    GET  /debug/pprof/profile  a pprof profile of the next ?seconds= (default 30)
+
+``POST /analyze`` accepts either a JSON body naming a path relative to the
+server root (``{"path": "src/", "edges": ["calls"]}``) or an upload: a tar
+(optionally gzipped) or zip archive, or a single source file whose name is
+given by the ``filename`` query parameter.  Archives are unpacked member
+by member, and refused once what they unpack to exceeds ``max_unpacked``
+bytes, so a small compressed upload cannot fill the disk.  Each analysis
+gets an id; the GET endpoints read the most recent one unless
+``?analysis=<id>`` is given.
+
+The profile samples the threads running analyses, by phase and language
+(see tracing.py), so ``go tool pprof -http=: http://HOST/debug/pprof/profile``
+shows where a slow server spends its time.
+
+At most ``max_concurrent`` analyses run at once; further requests wait
+their turn, and ``/metrics`` reports how many are waiting.  The gRPC API
+(see grpcserving.py) shares the stored analyses and the limit.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import dataclasses
+import io
+import json
+import logging
+import os
+import tarfile
+import tempfile
+import threading
+import time
+import zipfile
+import zlib
+from collections import OrderedDict
+from collections.abc import Callable, Iterator
+from dataclasses import dataclass
+from http import HTTPStatus
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from pathlib import Path
+from typing import Any
+from urllib.parse import SplitResult, parse_qs, urlsplit
+
+from .analysis import Analysis, FileResult, Options, Result, iter_analyze
+from .caching import EXTRACTOR_VERSION
+from .exploring import render_page
+from .linking import EDGE_KINDS
+from .tracing import MAX_PROFILE_SECONDS, phase, sample_for
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+DEFAULT_MAX_UPLOAD: int = 100 * 1024 * 1024
+
+# Most bytes an uploaded archive may unpack to.
+DEFAULT_MAX_UNPACKED: int = 1024 * 1024 * 1024
+
+# What a tar member's header takes, counted against the unpacked size.
+_TAR_BLOCK: int = 512
+
+# Analyses kept in memory; the oldest are dropped first.
+MAX_ANALYSES: int = 16
+
+# Analyses run at once.  One by default, since analyses share the cache.
+DEFAULT_MAX_CONCURRENT: int = 1
+
+PROMETHEUS_CONTENT_TYPE: str = "text/plain; version=0.0.4; charset=utf-8"
+
+# Upper bounds, in seconds, of the analysis duration histogram's buckets.
+DURATION_BUCKETS: tuple[float, ...] = (0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300)
+
+
+class RequestError(Exception):
+    """An error reported to the client with an HTTP status."""
+
+    def __init__(self, status: HTTPStatus, message: str) -> None:
+        super().__init__(message)
+        self.status: HTTPStatus = status
+
+
+def parse_addr(addr: str) -> tuple[str, int]:
+    """Parse ``host:port`` or Go-style ``:port`` (all interfaces)."""
+    host, sep, port = addr.rpartition(":")
+    if not sep or not port.isdigit():
+        raise ValueError(f"expected HOST:PORT or :PORT, got {addr!r}")
+    return host.strip("[]"), int(port)
+
+
+@dataclass
+class _Text:
+    """A non-JSON response body."""
+
+    content_type: str
+    body: str | bytes
+
+
+@dataclass
+class _Stored:
+    source: str  # what was analyzed, for GET /analyses
+    result: Result
+
+
+class AnalysisStore:
+    """Thread-safe, bounded collection of finished analyses."""
+
+    def __init__(self, limit: int = MAX_ANALYSES) -> None:
+        self._lock: threading.Lock = threading.Lock()
+        self._items: OrderedDict[int, _Stored] = OrderedDict()
+        self._next_id: int = 1
+        self.limit: int = limit
+
+    def add(self, source: str, result: Result) -> int:
+        with self._lock:
+            analysis_id: int = self._next_id
+            self._next_id += 1
+            self._items[analysis_id] = _Stored(source, result)
+            while len(self._items) > self.limit:
+                self._items.popitem(last=False)
+            return analysis_id
+
+    def get(self, analysis_id: int | None) -> tuple[int, Result]:
+        with self._lock:
+            if not self._items:
+                raise RequestError(HTTPStatus.NOT_FOUND, "no analysis yet; POST /analyze first")
+            if analysis_id is None:
+                analysis_id = next(reversed(self._items))
+            stored: _Stored | None = self._items.get(analysis_id)
+            if stored is None:
+                raise RequestError(HTTPStatus.NOT_FOUND, f"no analysis with id {analysis_id}")
+            return analysis_id, stored.result
+
+    def summary(self) -> list[dict[str, Any]]:
+        with self._lock:
+            return [
+                {"id": i, "source": s.source, "files": len(s.result.files)}
+                for i, s in self._items.items()
+            ]
+
+    def __len__(self) -> int:
+        with self._lock:
+            return len(self._items)
+
+
+# ---------------------------------------------------------------------------
+# Metrics
+# ---------------------------------------------------------------------------
+
+
+def _labels(labels: dict[str, str]) -> str:
+    """Prometheus label set, e.g. ``{method="GET",status="200"}``."""
+    if not labels:
+        return ""
+    escaped: dict[str, str] = {
+        k: v.replace("\\", "\\\\").replace('"', '\\"').replace("\n", "\\n")
+        for k, v in labels.items()
+    }
+    return "{" + ",".join(f'{k}="{v}"' for k, v in escaped.items()) + "}"
+
+
+def _number(value: float) -> str:
+    return str(int(value)) if float(value).is_integer() else repr(value)
+
+
+class ServerMetrics:
+    """Thread-safe counters for ``GET /metrics``, in Prometheus text format."""
+
+    def __init__(self) -> None:
+        self._lock: threading.Lock = threading.Lock()
+        self.started: float = time.time()
+        self._requests: dict[tuple[str, str, int], int] = {}
+        self._analyses: dict[str, int] = {"ok": 0, "error": 0}
+        self._buckets: list[int] = [0] * len(DURATION_BUCKETS)
+        self._duration_sum: float = 0.0
+        self.files: int = 0
+        self.cache_hits: int = 0
+        self.cache_misses: int = 0
+        self.in_progress: int = 0
+        self.queued: int = 0
+
+    def request(self, method: str, endpoint: str, status: int) -> None:
+        with self._lock:
+            key: tuple[str, str, int] = (method, endpoint, status)
+            self._requests[key] = self._requests.get(key, 0) + 1
+
+    def waiting(self, delta: int) -> None:
+        with self._lock:
+            self.queued += delta
+
+    def running(self, delta: int) -> None:
+        with self._lock:
+            self.in_progress += delta
+
+    def finished(self, analysis: Analysis, files: int, seconds: float) -> None:
+        with self._lock:
+            self._analyses["ok"] += 1
+            self._duration_sum += seconds
+            for i, bound in enumerate(DURATION_BUCKETS):
+                if seconds <= bound:
+                    self._buckets[i] += 1
+            self.files += files
+            self.cache_hits += analysis.cache_hits
+            self.cache_misses += analysis.cache_misses
+
+    def failed(self) -> None:
+        with self._lock:
+            self._analyses["error"] += 1
+
+    def render(self, stored: int) -> str:
+        """The metrics in Prometheus text exposition format (version 0.0.4)."""
+        lines: list[str] = []
+
+        def metric(
+            name: str, kind: str, doc: str, samples: list[tuple[str, dict[str, str], float]],
+        ) -> None:
+            lines.append(f"# HELP {name} {doc}")
+            lines.append(f"# TYPE {name} {kind}")
+            for suffix, labels, value in samples:
+                lines.append(f"{name}{suffix}{_labels(labels)} {_number(value)}")
+
+        with self._lock:
+            metric(
+                "autosg_http_requests_total", "counter", "HTTP requests by endpoint and status.",
+                [
+                    ("", {"method": m, "endpoint": e, "status": str(s)}, n)
+                    for (m, e, s), n in sorted(self._requests.items())
+                ],
+            )
+            metric(
+                "autosg_analyses_total", "counter", "Analyses run, by outcome.",
+                [("", {"outcome": k}, n) for k, n in self._analyses.items()],
+            )
+            count: int = self._analyses["ok"]
+            metric(
+                "autosg_analysis_duration_seconds", "histogram",
+                "Time taken by successful analyses.",
+                [
+                    *(("_bucket", {"le": _number(b)}, n)
+                      for b, n in zip(DURATION_BUCKETS, self._buckets)),
+                    ("_bucket", {"le": "+Inf"}, count),
+                    ("_sum", {}, round(self._duration_sum, 6)),
+                    ("_count", {}, count),
+                ],
+            )
+            metric(
+                "autosg_analyzed_files_total", "counter", "Files analyzed.",
+                [("", {}, self.files)],
+            )
+            metric(
+                "autosg_cache_hits_total", "counter", "Files read from the extraction cache.",
+                [("", {}, self.cache_hits)],
+            )
+            metric(
+                "autosg_cache_misses_total", "counter",
+                "Files extracted afresh and added to the cache.",
+                [("", {}, self.cache_misses)],
+            )
+            lookups: int = self.cache_hits + self.cache_misses
+            metric(
+                "autosg_cache_hit_ratio", "gauge",
+                "Cache hits over cache lookups since the server started.",
+                [("", {}, round(self.cache_hits / lookups, 6) if lookups else 0)],
+            )
+            metric(
+                "autosg_analyses_in_progress", "gauge", "Analyses running now.",
+                [("", {}, self.in_progress)],
+            )
+            metric(
+                "autosg_analysis_queue_depth", "gauge",
+                "Analysis requests waiting for a free slot.",
+                [("", {}, self.queued)],
+            )
+            metric(
+                "autosg_stored_analyses", "gauge", "Analyses held in memory.",
+                [("", {}, stored)],
+            )
+            metric(
+                "autosg_start_time_seconds", "gauge", "When the server started, in Unix time.",
+                [("", {}, round(self.started, 3))],
+            )
+        return "\n".join(lines) + "\n"
+
+
+# ---------------------------------------------------------------------------
+# Running analyses
+# ---------------------------------------------------------------------------
+
+
+def _flag(value: Any, default: bool) -> bool:
+    """Interpret a JSON boolean or a query-string flag (``false``, ``0``, ``no``)."""
+    if value is None:
+        return default
+    if isinstance(value, str):
+        return value.lower() not in ("0", "false", "no", "off", "")
+    return bool(value)
+
+
+def _list(value: Any) -> tuple[str, ...]:
+    """Interpret a JSON list or repeated/comma-separated query values."""
+    if value is None:
+        return ()
+    if isinstance(value, str):
+        value = [value]
+    return tuple(v.strip() for item in value for v in str(item).split(",") if v.strip())
+
+
+def request_options(params: dict[str, Any], cache: bool) -> Options:
+    """Build analysis options from request parameters."""
+    edges: tuple[str, ...] = _list(params.get("edges"))
+    unknown: list[str] = [e for e in edges if e not in EDGE_KINDS]
+    if unknown:
+        raise RequestError(HTTPStatus.BAD_REQUEST, f"unknown edge kind(s): {', '.join(unknown)}")
+    return Options(
+        recursive=_flag(params.get("recursive"), True),
+        gitignore=_flag(params.get("gitignore"), True),
+        include=_list(params.get("include")),
+        exclude=_list(params.get("exclude")),
+        languages=frozenset(_list(params.get("languages"))),
+        edges=frozenset(edges),
+        cache=cache,
+    )
+
+
+def relocate(file_result: FileResult, base: Path) -> FileResult:
+    """Make paths in *file_result* relative to *base* (e.g. an upload's temp dir)."""
+    file_result.path = Path(os.path.relpath(file_result.path, base)).as_posix()
+    for entity in file_result.entities:
+        entity.path = file_result.path
+    return file_result
+
+
+def _relocate(result: Result, base: Path) -> Result:
+    for file_result in result.files:
+        relocate(file_result, base)
+    return result
+
+
+def _too_large(limit: int) -> RequestError:
+    return RequestError(
+        HTTPStatus.REQUEST_ENTITY_TOO_LARGE, f"upload unpacks to more than {limit} bytes",
+    )
+
+
+def _extract_upload(
+    body: bytes, content_type: str, filename: str | None, dest: Path, limit: int,
+) -> None:
+    """Unpack an uploaded archive, or write a single uploaded file, into *dest*.
+
+    Archives may unpack to at most *limit* bytes.
+    """
+    if content_type in ("application/zip", "application/x-zip-compressed"):
+        try:
+            with zipfile.ZipFile(io.BytesIO(body)) as archive:
+                # Members are read no further than the sizes they declare.
+                if sum(info.file_size for info in archive.infolist()) > limit:
+                    raise _too_large(limit)
+                archive.extractall(dest)
+        except (
+            zipfile.BadZipFile, zlib.error, EOFError, NotImplementedError, RuntimeError,
+            ValueError, OSError,
+        ) as exc:  # corrupt data, unsupported compression, and encrypted members included
+            raise RequestError(HTTPStatus.BAD_REQUEST, f"invalid zip archive: {exc}") from None
+        return
+    if content_type in ("application/x-tar", "application/gzip", "application/x-gzip"):
+        try:
+            with tarfile.open(fileobj=io.BytesIO(body)) as archive:
+                unpacked: int = 0
+                # Members are decompressed as they are reached, headers included.
+                for member in archive:
+                    unpacked += _TAR_BLOCK + member.size
+                    if unpacked > limit:
+                        raise _too_large(limit)
+                    archive.extract(member, dest, filter="data")
+        except (tarfile.TarError, OSError) as exc:
+            raise RequestError(HTTPStatus.BAD_REQUEST, f"invalid tar archive: {exc}") from None
+        return
+    if not filename:
+        raise RequestError(
+            HTTPStatus.BAD_REQUEST,
+            "single-file uploads need a ?filename= query parameter",
+        )
+    name: str = Path(filename).name
+    if name in ("", ".", ".."):
+        raise RequestError(HTTPStatus.BAD_REQUEST, f"invalid filename {filename!r}")
+    (dest / name).write_bytes(body)
+
+
+def resolve_under(root: Path, path: str) -> Path:
+    """Resolve a client-supplied path, refusing anything outside *root*."""
+    resolved: Path = (root / path).resolve()
+    if resolved != root and root not in resolved.parents:
+        raise RequestError(HTTPStatus.FORBIDDEN, f"{path!r} is outside the server root")
+    if not resolved.exists():
+        raise RequestError(HTTPStatus.NOT_FOUND, f"no such file or directory: {path}")
+    return resolved
+
+
+class ServiceState:
+    """What the HTTP and gRPC front ends share: settings, analyses, and metrics."""
+
+    def __init__(
+        self, root: Path, max_upload: int = DEFAULT_MAX_UPLOAD,
+        max_concurrent: int = DEFAULT_MAX_CONCURRENT, cache: bool = True,
+        max_unpacked: int = DEFAULT_MAX_UNPACKED,
+    ) -> None:
+        self.root: Path = root.resolve()
+        self.max_upload: int = max_upload
+        self.max_unpacked: int = max_unpacked
+        self.cache: bool = cache
+        self.store: AnalysisStore = AnalysisStore()
+        self.slots: threading.Semaphore = threading.Semaphore(max_concurrent)
+        self.metrics: ServerMetrics = ServerMetrics()
+
+    @contextlib.contextmanager
+    def slot(self) -> Iterator[None]:
+        """Hold one of the analysis slots, waiting in the queue for it if need be."""
+        self.metrics.waiting(1)
+        try:
+            self.slots.acquire()
+        finally:
+            self.metrics.waiting(-1)
+        self.metrics.running(1)
+        try:
+            yield
+        finally:
+            self.metrics.running(-1)
+            self.slots.release()
+
+    def analyze(self, path: Path | str, options: Options) -> Result:
+        """Analyze *path* once one of the slots is free."""
+        with self.slot():
+            try:
+                started: float = time.perf_counter()
+                analysis: Analysis = iter_analyze([path], options)
+                with phase("serve"):
+                    files: list[FileResult] = list(analysis)
+                    result: Result = Result(files, list(analysis.edges))
+                self.metrics.finished(analysis, len(files), time.perf_counter() - started)
+                return result
+            except Exception:
+                self.metrics.failed()
+                raise
+
+    def analyze_path(self, path: str, params: dict[str, Any]) -> Result:
+        """Analyze *path* under the root, with paths in the result relative to it."""
+        target: Path = resolve_under(self.root, path)
+        return _relocate(self.analyze(target, request_options(params, self.cache)), self.root)
+
+    @contextlib.contextmanager
+    def unpacked(self, body: bytes, content_type: str, filename: str | None) -> Iterator[Path]:
+        """A temporary directory holding an uploaded archive's contents, or the file."""
+        if len(body) > self.max_upload:
+            raise RequestError(
+                HTTPStatus.REQUEST_ENTITY_TOO_LARGE, f"upload exceeds {self.max_upload} bytes",
+            )
+        with tempfile.TemporaryDirectory(prefix="autosg-upload-") as tmp:
+            _extract_upload(body, content_type, filename, Path(tmp), self.max_unpacked)
+            yield Path(tmp)
+
+    def analyze_upload(
+        self, body: bytes, content_type: str, filename: str | None, params: dict[str, Any],
+    ) -> Result:
+        """Analyze an uploaded archive or file, with paths relative to its top."""
+        with self.unpacked(body, content_type, filename) as tmp:
+            return _relocate(self.analyze(tmp, request_options(params, self.cache)), tmp)
+
+
+# ---------------------------------------------------------------------------
+# HTTP
+# ---------------------------------------------------------------------------
+
+
+class _Handler(BaseHTTPRequestHandler):
+    server: AutosgServer
+
+    def _send(self, status: HTTPStatus, content_type: str, body: bytes) -> None:
+        self.send_response(status)
+        self.send_header("Content-Type", content_type)
+        self.send_header("Content-Length", str(len(body)))
+        self.end_headers()
+        self.wfile.write(body)
+
+    def _send_json(self, status: HTTPStatus, data: Any) -> None:
+        self._send(status, "application/json", json.dumps(data).encode())
+
+    def _handle(self, method: str) -> None:
+        url: SplitResult = urlsplit(self.path)
+        query: dict[str, list[str]] = parse_qs(url.query)
+        known: bool = any(path == url.path for _m, path in _ROUTES)
+        status: HTTPStatus = HTTPStatus.OK
+        try:
+            route: _Route | None = _ROUTES.get((method, url.path))
+            if route is None:
+                if known:
+                    raise RequestError(HTTPStatus.METHOD_NOT_ALLOWED, f"{method} not allowed")
+                raise RequestError(HTTPStatus.NOT_FOUND, f"no such endpoint: {url.path}")
+            response: dict[str, Any] | _Text = route(self, query)
+            if isinstance(response, _Text):
+                body: str | bytes = response.body
+                self._send(
+                    status, response.content_type, body.encode() if isinstance(body, str) else body,
+                )
+            else:
+                self._send_json(status, response)
+        except RequestError as exc:
+            status = exc.status
+            self._send_json(status, {"error": str(exc)})
+        except Exception:
+            logger.exception("error handling %s %s", method, self.path)
+            status = HTTPStatus.INTERNAL_SERVER_ERROR
+            self._send_json(status, {"error": "internal server error"})
+        # Unknown paths share one label, so scanners cannot blow up the series count.
+        self.server.state.metrics.request(method, url.path if known else "other", status)
+
+    def do_GET(self) -> None:
+        self._handle("GET")
+
+    def do_POST(self) -> None:
+        self._handle("POST")
+
+    def _read_body(self) -> bytes:
+        length: int = int(self.headers.get("Content-Length") or 0)
+        if length > self.server.state.max_upload:
+            raise RequestError(
+                HTTPStatus.REQUEST_ENTITY_TOO_LARGE,
+                f"request body exceeds {self.server.state.max_upload} bytes",
+            )
+        return self.rfile.read(length)
+
+    # -- endpoints ----------------------------------------------------------
+
+    def post_analyze(self, query: dict[str, list[str]]) -> dict[str, Any]:
+        content_type: str = (self.headers.get("Content-Type") or "").split(";")[0].strip()
+        body: bytes = self._read_body()
+        if content_type == "application/json":
+            try:
+                params: Any = json.loads(body or b"{}")
+            except json.JSONDecodeError as exc:
+                raise RequestError(HTTPStatus.BAD_REQUEST, f"invalid JSON: {exc}") from None
+            if not isinstance(params, dict) or not isinstance(params.get("path"), str):
+                raise RequestError(HTTPStatus.BAD_REQUEST, 'expected {"path": "..."}')
+            source: str = params["path"]
+            result: Result = self.server.state.analyze_path(source, params)
+        else:
+            params = {
+                k: v if k in ("edges", "include", "exclude", "languages") else v[0]
+                for k, v in query.items()
+            }
+            filename: str | None = params.pop("filename", None)
+            result = self.server.state.analyze_upload(body, content_type, filename, params)
+            source = f"upload:{filename or content_type}"
+        analysis_id: int = self.server.state.store.add(source, result)
+        return {"id": analysis_id, **result.to_dict()}
+
+    def _analysis(self, query: dict[str, list[str]]) -> tuple[int, Result]:
+        raw: str | None = query.get("analysis", [None])[0]
+        if raw is not None and not raw.isdigit():
+            raise RequestError(HTTPStatus.BAD_REQUEST, "analysis must be an integer id")
+        return self.server.state.store.get(int(raw) if raw is not None else None)
+
+    def get_entities(self, query: dict[str, list[str]]) -> dict[str, Any]:
+        analysis_id, result = self._analysis(query)
+        kinds: list[str] = query.get("kind", [])
+        names: list[str] = query.get("name", [])
+        path_prefix: str = query.get("path", [""])[0]
+        entities: list[dict[str, Any]] = [
+            dataclasses.asdict(e)
+            for e in result.entities
+            if (not kinds or e.kind in kinds)
+            and (not names or e.name in names)
+            and e.path.startswith(path_prefix)
+        ]
+        return {"analysis": analysis_id, "entities": entities}
+
+    def get_edges(self, query: dict[str, list[str]]) -> dict[str, Any]:
+        analysis_id, result = self._analysis(query)
+        kinds: list[str] = query.get("kind", [])
+        edges: list[dict[str, Any]] = [
+            dataclasses.asdict(e) for e in result.edges if not kinds or e.kind in kinds
+        ]
+        return {"analysis": analysis_id, "edges": edges}
+
+    def get_analyses(self, _query: dict[str, list[str]]) -> dict[str, Any]:
+        return {"analyses": self.server.state.store.summary()}
+
+    def get_health(self, _query: dict[str, list[str]]) -> dict[str, Any]:
+        return {
+            "status": "ok",
+            "extractor_version": EXTRACTOR_VERSION,
+            "uptime_seconds": round(time.time() - self.server.state.metrics.started, 3),
+        }
+
+    def get_metrics(self, _query: dict[str, list[str]]) -> _Text:
+        state: ServiceState = self.server.state
+        return _Text(PROMETHEUS_CONTENT_TYPE, state.metrics.render(len(state.store)))
+
+    def get_profile(self, query: dict[str, list[str]]) -> _Text:
+        raw: str = query.get("seconds", ["30"])[0]
+        if not raw.isdigit() or not 1 <= int(raw) <= MAX_PROFILE_SECONDS:
+            raise RequestError(
+                HTTPStatus.BAD_REQUEST, f"seconds must be from 1 to {MAX_PROFILE_SECONDS}",
+            )
+        return _Text("application/octet-stream", sample_for(int(raw)))
+
+    def get_explorer(self, _query: dict[str, list[str]]) -> _Text:
+        title: str = f"autosg: {self.server.state.root.name}"
+        return _Text("text/html; charset=utf-8", render_page(title))
+
+
+# Routes return JSON-serializable data, or a page or other text as-is.
+_Route = Callable[[_Handler, dict[str, list[str]]], dict[str, Any] | _Text]
+
+_ROUTES: dict[tuple[str, str], _Route] = {
+    ("GET", "/"): _Handler.get_explorer,
+    ("POST", "/analyze"): _Handler.post_analyze,
+    ("GET", "/entities"): _Handler.get_entities,
+    ("GET", "/edges"): _Handler.get_edges,
+    ("GET", "/analyses"): _Handler.get_analyses,
+    ("GET", "/health"): _Handler.get_health,
+    ("GET", "/metrics"): _Handler.get_metrics,
+    ("GET", "/debug/pprof/profile"): _Handler.get_profile,
+}
+
+
+class AutosgServer(ThreadingHTTPServer):
+    """HTTP server holding analyses for the request handlers."""
+
+    daemon_threads = True
+
+    def __init__(self, addr: tuple[str, int], state: ServiceState) -> None:
+        super().__init__(addr, _Handler)
+        self.state: ServiceState = state
+
+
+def serve(
+    addr: tuple[str, int] | None, root: Path, max_upload: int = DEFAULT_MAX_UPLOAD,
+    max_concurrent: int = DEFAULT_MAX_CONCURRENT, cache: bool = True,
+    grpc_addr: tuple[str, int] | None = None, max_unpacked: int = DEFAULT_MAX_UNPACKED,
+) -> None:
+    """Serve over HTTP at *addr*, gRPC at *grpc_addr*, or both, until interrupted.
+
+    Both front ends share one store, so an analysis run over one can be
+    read over the other.
+    """
+    state: ServiceState = ServiceState(root, max_upload, max_concurrent, cache, max_unpacked)
+    grpc_server: Any = None
+    if grpc_addr is not None:
+        # Import only when asked for, so HTTP-only servers do not need grpcio.
+        from .grpcserving import start_grpc
+
+        grpc_server = start_grpc(grpc_addr, state)
+    try:
+        if addr is None:
+            grpc_server.wait_for_termination()
+            return
+        with AutosgServer(addr, state) as server:
+            server.serve_forever()
+    except KeyboardInterrupt:
+        pass
+    finally:
+        if grpc_server is not None:
+            grpc_server.stop(grace=None)
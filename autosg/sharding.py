@@ -0,0 +1,180 @@
+"""Split an analysis across parallel jobs, for ``analyze --shard`` and ``merge``.
+
+``analyze --shard i/n`` walks the whole tree like every other job but
+parses only every n-th file, from the i-th, and writes a partial result:
+a JSON line describing the run, then one line per file with its
+entities, errors, and unresolved references, ids counted from 0 in each
+file.  Edges are not resolved there, since most references lead into
+other shards.
+
+``merge`` reads the partial results of all n shards, puts the files back
+in the order one job would have analyzed them, renumbers their entities,
+and resolves the references across all of them, so its output is that of
+a single ``analyze`` run with the same options.  Like that run, it reads
+go.mod and other build files, so it runs in the same checkout.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import heapq
+import json
+import os
+from collections.abc import Iterator
+from pathlib import Path
+from typing import Any, TextIO
+
+from .analysis import Analysis, FileResult, Options, rebase
+from .extracting import Edge, Entity, ParseError
+from .linking import Linker
+from .schema import SCHEMA_VERSION
+
+# Goes up when the partial result layout changes; merge rejects others.
+SHARD_VERSION: int = 1
+
+# The settings every shard of one run records alike.
+_SETTINGS: tuple[str, ...] = (
+    "schema_version", "count", "roots", "edges", "clone_threshold", "min_confidence",
+)
+
+
+class ShardError(Exception):
+    """Raised when partial results cannot be read or do not make up one run."""
+
+
+def parse_shard(text: str) -> tuple[int, int]:
+    """``i/n`` as (i, n), with 1 <= i <= n; raises ValueError otherwise."""
+    index, sep, count = text.partition("/")
+    if not sep or not index.strip().isdigit() or not count.strip().isdigit():
+        raise ValueError(f"expected i/n, e.g. 1/4, not {text!r}")
+    shard: tuple[int, int] = (int(index), int(count))
+    if not 1 <= shard[0] <= shard[1]:
+        raise ValueError(f"shard {text} is not between 1/{shard[1]} and {shard[1]}/{shard[1]}")
+    return shard
+
+
+def write_shard(analysis: Analysis, out: TextIO) -> None:
+    """Write the partial result of *analysis*, run with ``options.shard``, to *out*."""
+    options: Options = analysis.options
+    if options.shard is None:
+        raise ValueError("write_shard needs an analysis of one shard")
+    header: dict[str, Any] = {
+        "shard_version": SHARD_VERSION,
+        "schema_version": SCHEMA_VERSION,
+        "index": options.shard[0],
+        "count": options.shard[1],
+        # As output names them: a clone of a git URL is in another temp dir per job.
+        "roots": [
+            options.labels.get(root.resolve()) or Path(os.path.relpath(root)).as_posix()
+            for root in analysis.roots
+        ],
+        "edges": sorted(options.edges),
+        "clone_threshold": options.clone_threshold,
+        "min_confidence": options.min_confidence,
+    }
+    out.write(json.dumps(header) + "\n")
+    for file_result in analysis:
+        rebase(file_result, -file_result.entities[0].id)
+        record: dict[str, Any] = {
+            "position": analysis.positions[file_result.path],
+            **file_result.to_dict(),
+            "entities": [dataclasses.asdict(e) for e in file_result.entities],
+            "references": [dataclasses.asdict(r) for r in file_result.references],
+            "errors": [dataclasses.asdict(e) for e in file_result.errors],
+        }
+        out.write(json.dumps(record) + "\n")
+
+
+def _header(path: Path) -> dict[str, Any]:
+    try:
+        with open(path, encoding="utf-8") as f:
+            header: Any = json.loads(f.readline())
+    except (OSError, ValueError) as exc:
+        raise ShardError(f"cannot read {path}: {exc}") from None
+    if not isinstance(header, dict) or "shard_version" not in header:
+        raise ShardError(f"{path} is not a partial result of analyze --shard")
+    if header["shard_version"] != SHARD_VERSION:
+        raise ShardError(
+            f"{path} was written by another autosg version (shard version "
+            f"{header['shard_version']}, expected {SHARD_VERSION})",
+        )
+    return header
+
+
+def _records(path: Path) -> Iterator[tuple[int, dict[str, Any]]]:
+    """(position, record) of every file in the partial result at *path*."""
+    with open(path, encoding="utf-8") as f:
+        f.readline()
+        for number, line in enumerate(f, 2):
+            try:
+                record: dict[str, Any] = json.loads(line)
+            except ValueError as exc:
+                raise ShardError(f"{path}:{number}: {exc}") from None
+            yield record["position"], record
+
+
+def _file_result(record: dict[str, Any]) -> FileResult:
+    return FileResult(
+        record["path"], record["language"],
+        [Entity(**e) for e in record["entities"]],
+        [Edge(**r) for r in record["references"]],
+        root=record.get("root"),
+        errors=[ParseError(**e) for e in record["errors"]],
+    )
+
+
+class MergedAnalysis(Analysis):
+    """The analysis the partial results at *parts* are shards of.
+
+    Raises :class:`ShardError` unless *parts* are every shard of one run,
+    each once.  Iterating reads them all in step, yielding their files in
+    the order of the original walk; :attr:`edges` are resolved across them.
+    """
+
+    def __init__(self, parts: list[Path], max_memory: int | None = None) -> None:
+        headers: list[dict[str, Any]] = [_header(path) for path in parts]
+        if not headers:
+            raise ShardError("no partial results to merge")
+        first: dict[str, Any] = headers[0]
+        seen: dict[int, Path] = {}
+        for path, header in zip(parts, headers):
+            for setting in _SETTINGS:
+                if header[setting] != first[setting]:
+                    raise ShardError(
+                        f"{path} and {parts[0]} are shards of different runs "
+                        f"({setting} differs)",
+                    )
+            if header["index"] in seen:
+                raise ShardError(
+                    f"{seen[header['index']]} and {path} are both shard "
+                    f"{header['index']}/{header['count']}",
+                )
+            seen[header["index"]] = path
+        missing: list[str] = [
+            f"{i}/{first['count']}" for i in range(1, first["count"] + 1) if i not in seen
+        ]
+        if missing:
+            raise ShardError(f"missing shard(s) {', '.join(missing)}")
+        super().__init__([], Options(
+            edges=frozenset(first["edges"]), max_memory=max_memory,
+            clone_threshold=first["clone_threshold"], min_confidence=first["min_confidence"],
+        ))
+        # Wrapping analyses check their roots exist; fetched inputs are gone by now.
+        self.roots = [Path(root) for root in first["roots"] if Path(root).exists()]
+        self.parts: list[Path] = parts
+
+    def __iter__(self) -> Iterator[FileResult]:
+        linker: Linker = Linker(
+            self.options.edges, self.options.max_memory, self.options.clone_threshold,
+            self.options.min_confidence,
+        )
+        next_id: int = 0
+        records: Iterator[tuple[int, dict[str, Any]]] = heapq.merge(
+            *(_records(path) for path in self.parts), key=lambda item: item[0],
+        )
+        for _position, record in records:
+            file_result: FileResult = rebase(_file_result(record), next_id)
+            next_id += len(file_result.entities)
+            linker.add(file_result.entities, file_result.references)
+            yield file_result
+        self._edges = linker.resolve()
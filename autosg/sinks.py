@@ -0,0 +1,278 @@
+"""Result sinks: where ``analyze --sink`` sends its output.
+
+A sink takes an analysis and writes it in the ``-f`` format somewhere
+other than stdout.  Sinks are named by URL, and the scheme picks the
+sink:
+
+- ``file:PATH`` (or a plain path) writes the output to *PATH*, as ``-o``.
+- ``sqlite:PATH`` writes the SQLite database to *PATH*, whatever ``-f`` is.
+- ``http://...`` and ``https://...`` POST the output to the URL, with a
+  bearer token from ``AUTOSG_SINK_TOKEN`` when it is set; the token is
+  only sent over https, and redirects are refused rather than followed
+  where it might not be.
+- ``s3://BUCKET/KEY`` uploads it to S3 with boto3's usual credentials.
+
+Formats that write a directory (arrow, csv, parquet) upload each of its
+files under the URL, as ``URL/NAME``.
+
+Other schemes come from adapters: a :class:`ResultSink` subclass (or any
+callable taking the URL and returning a sink), registered in Python with
+:func:`register_sink` or in the config file by import path::
+
+    sinks:
+      lake: mycompany.autosg_lake:LakeSink
+
+after which ``--sink lake://raw/autosg`` sends results to ``LakeSink``.
+An adapter is imported only when a ``--sink`` URL uses its scheme, so
+commands that send nothing run no code from the config; modules next to
+the config file are found too.
+"""
+
+from __future__ import annotations
+
+import importlib
+import os
+import sys
+import tempfile
+import urllib.error
+import urllib.request
+from abc import ABC, abstractmethod
+from collections.abc import Callable
+from pathlib import Path
+from typing import Any
+from urllib.parse import unquote, urlsplit
+
+from .analysis import Analysis
+from .exporting import FILE_FORMATS, FORMATS, ExportOptions
+
+# Content types of uploaded output, by format; others are sent as bytes.
+_CONTENT_TYPES: dict[str, str] = {
+    "csv": "text/csv",
+    "dot": "text/vnd.graphviz",
+    "gexf": "application/xml",
+    "graphml": "application/xml",
+    "html": "text/html",
+    "json": "application/json",
+    "jsonl": "application/x-ndjson",
+    "lsif": "application/x-ndjson",
+    "parquet": "application/vnd.apache.parquet",
+    "sqlite": "application/vnd.sqlite3",
+}
+
+_TOKEN_ENV: str = "AUTOSG_SINK_TOKEN"
+
+
+class SinkError(Exception):
+    """Raised when a sink cannot be opened or its results cannot be delivered."""
+
+
+class ResultSink(ABC):
+    """Where results go.  Subclasses take the sink's URL in their constructor."""
+
+    def __init__(self, url: str) -> None:
+        self.url: str = url
+
+    @abstractmethod
+    def write(self, analysis: Analysis, fmt: str, options: ExportOptions) -> None:
+        """Write *analysis* in format *fmt*, iterating it once."""
+
+
+def render(analysis: Analysis, fmt: str, options: ExportOptions, path: Path) -> None:
+    """Write *analysis* in *fmt* to *path*: a file, or a directory for some FILE_FORMATS."""
+    if fmt in FILE_FORMATS:
+        FILE_FORMATS[fmt](analysis, path, options)
+        return
+    with open(path, "w", newline="", encoding="utf-8") as out:
+        FORMATS[fmt](analysis, out, options)
+
+
+class FileSink(ResultSink):
+    """``file:PATH``: the output written to a local path."""
+
+    def __init__(self, url: str) -> None:
+        super().__init__(url)
+        self.path: Path = Path(
+            unquote(urlsplit(url).path) if url.startswith("file://") else url.partition(":")[2],
+        )
+
+    def write(self, analysis: Analysis, fmt: str, options: ExportOptions) -> None:
+        render(analysis, fmt, options, self.path)
+
+
+class SqliteSink(FileSink):
+    """``sqlite:PATH``: the SQLite database, whatever the format asked for."""
+
+    def write(self, analysis: Analysis, fmt: str, options: ExportOptions) -> None:
+        render(analysis, "sqlite", options, self.path)
+
+
+class UploadSink(ResultSink):
+    """A sink that writes the output to a temporary file, then uploads it."""
+
+    def write(self, analysis: Analysis, fmt: str, options: ExportOptions) -> None:
+        with tempfile.TemporaryDirectory(prefix="autosg-sink-") as tmp:
+            path: Path = Path(tmp) / f"output.{fmt}"
+            render(analysis, fmt, options, path)
+            content_type: str = _CONTENT_TYPES.get(fmt, "application/octet-stream")
+            if not path.is_dir():
+                self.upload(self.url, path, content_type)
+                return
+            for part in sorted(p for p in path.rglob("*") if p.is_file()):
+                name: str = part.relative_to(path).as_posix()
+                self.upload(f"{self.url.rstrip('/')}/{name}", part, _content_type(part, fmt))
+
+    @abstractmethod
+    def upload(self, url: str, path: Path, content_type: str) -> None:
+        """Send the file at *path* to *url*."""
+
+
+def _content_type(part: Path, fmt: str) -> str:
+    """The content type of one file of a directory format."""
+    if part.suffix == ".csv":
+        return _CONTENT_TYPES["csv"]
+    return _CONTENT_TYPES.get(fmt, "application/octet-stream")
+
+
+class _NoRedirects(urllib.request.HTTPRedirectHandler):
+    """Leaves 3xx responses as errors, so a redirect cannot carry the token elsewhere."""
+
+    def redirect_request(self, *args: Any) -> None:
+        return None
+
+
+_OPENER: urllib.request.OpenerDirector = urllib.request.build_opener(_NoRedirects)
+
+
+class HttpSink(UploadSink):
+    """``http(s)://...``: the output POSTed to the URL."""
+
+    def __init__(self, url: str) -> None:
+        super().__init__(url)
+        if os.environ.get(_TOKEN_ENV) and urlsplit(url).scheme.lower() != "https":
+            raise SinkError(f"{_TOKEN_ENV} is only sent over https, not to {url}")
+
+    def upload(self, url: str, path: Path, content_type: str) -> None:
+        headers: dict[str, str] = {
+            "Content-Type": content_type, "Content-Length": str(path.stat().st_size),
+        }
+        token: str | None = os.environ.get(_TOKEN_ENV)
+        if token:
+            headers["Authorization"] = f"Bearer {token}"
+        with open(path, "rb") as body:
+            request: urllib.request.Request = urllib.request.Request(
+                url, data=body, headers=headers, method="POST",
+            )
+            try:
+                with _OPENER.open(request) as response:
+                    response.read()
+            except urllib.error.HTTPError as exc:
+                if 300 <= exc.code < 400:
+                    raise SinkError(
+                        f"{url}: HTTP {exc.code} {exc.reason} to {exc.headers.get('Location')};"
+                        " sinks do not follow redirects",
+                    ) from None
+                raise SinkError(f"{url}: HTTP {exc.code} {exc.reason}") from None
+            except urllib.error.URLError as exc:
+                raise SinkError(f"{url}: {exc.reason}") from None
+
+
+class S3Sink(UploadSink):
+    """``s3://BUCKET/KEY``: the output uploaded to S3."""
+
+    def upload(self, url: str, path: Path, content_type: str) -> None:
+        try:
+            # Import lazily, as for pyarrow: only S3 sinks need it.
+            import boto3
+        except ImportError:
+            raise SinkError("s3 sinks need boto3: pip install boto3") from None
+        split = urlsplit(url)
+        key: str = unquote(split.path.lstrip("/"))
+        if not split.netloc or not key:
+            raise SinkError(f"{url}: expected s3://BUCKET/KEY")
+        try:
+            boto3.client("s3").upload_file(
+                str(path), split.netloc, key, ExtraArgs={"ContentType": content_type},
+            )
+        except Exception as exc:  # botocore's errors, without importing it
+            raise SinkError(f"{url}: {exc}") from None
+
+
+# ---------------------------------------------------------------------------
+# Registry
+# ---------------------------------------------------------------------------
+
+SinkFactory = Callable[[str], ResultSink]
+
+_BUILTIN_SINKS: dict[str, SinkFactory] = {
+    "file": FileSink,
+    "http": HttpSink,
+    "https": HttpSink,
+    "s3": S3Sink,
+    "sqlite": SqliteSink,
+}
+
+_registered: dict[str, SinkFactory] = {}
+
+
+def register_sink(scheme: str, factory: SinkFactory) -> None:
+    """Make ``--sink SCHEME:...`` URLs open a sink with *factory*, which is given the URL."""
+    _registered[scheme.lower()] = factory
+
+
+def clear_sinks() -> None:
+    """Forget every registered sink, as between a daemon's commands."""
+    _registered.clear()
+
+
+def open_sink(url: str) -> ResultSink:
+    """The sink *url* names; a URL without a scheme is a file path."""
+    scheme: str = urlsplit(url).scheme.lower()
+    if len(scheme) <= 1:  # none, or a Windows drive letter
+        return FileSink(f"file:{url}")
+    factory: SinkFactory | None = _registered.get(scheme, _BUILTIN_SINKS.get(scheme))
+    if factory is None:
+        known: list[str] = sorted({*_BUILTIN_SINKS, *_registered})
+        raise SinkError(f"unknown sink {scheme!r} in {url}; choose from {', '.join(known)}")
+    return factory(url)
+
+
+def parse_sinks(spec: Any, where: str, base: str) -> dict[str, SinkFactory]:
+    """Read the ``sinks`` table of a config file; *where* prefixes errors.
+
+    Nothing is imported yet: each scheme gets a factory importing its
+    adapter when a sink is opened, with *base*, the config file's
+    directory, on ``sys.path`` only meanwhile.
+    """
+    if not isinstance(spec, dict):
+        raise ValueError(f"{where}: 'sinks' must map URL schemes to module:name import paths")
+    factories: dict[str, SinkFactory] = {}
+    for scheme, target in spec.items():
+        if not isinstance(target, str) or ":" not in target:
+            raise ValueError(f"{where}: sinks.{scheme} must be a module:name import path")
+        factories[str(scheme).lower()] = _ImportedSink(target, f"{where}: sinks.{scheme}", base)
+    return factories
+
+
+class _ImportedSink:
+    """The factory of a config file's sink adapter, imported when first called."""
+
+    def __init__(self, target: str, where: str, base: str) -> None:
+        self.target: str = target
+        self.where: str = where
+        self.base: str = base
+
+    def __call__(self, url: str) -> ResultSink:
+        module_name, _colon, name = self.target.partition(":")
+        added: bool = self.base not in sys.path
+        if added:
+            sys.path.append(self.base)
+        try:
+            factory: Any = getattr(importlib.import_module(module_name), name)
+        except (ImportError, AttributeError) as exc:
+            raise SinkError(f"{self.where}: cannot import {self.target}: {exc}") from None
+        finally:
+            if added and self.base in sys.path:
+                sys.path.remove(self.base)
+        if not callable(factory):
+            raise SinkError(f"{self.where}: {self.target} is not callable")
+        return factory(url)
@@ -0,0 +1,361 @@
+"""Stored analysis snapshots, and how their metrics trend between them.
+
+``snapshot save`` analyzes a tree and stores the result in a snapshot
+directory (``.autosg/snapshots`` by default): ``<id>.json`` holds when it
+was taken, the git commit checked out, an optional label, and its metrics;
+``<id>.result.json.gz`` holds the full result, as ``analyze`` writes it.
+Ids are UTC timestamps, so listing the directory sorts snapshots by time.
+
+Metrics describe the package (directory) graph, as ``report`` does:
+how many packages depend on each other, the mean number of packages each
+one depends on (``coupling``), and the dependency cycles among them.
+"""
+
+from __future__ import annotations
+
+import dataclasses
+import datetime
+import gzip
+import json
+import os
+import re
+import subprocess
+from collections import Counter, defaultdict
+from collections.abc import Iterable
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Any
+
+from .analysis import Analysis, FileResult, Options, Result, iter_analyze
+from .counting import Totals, cycles, package
+from .diffing import Diff, diff_results
+from .extracting import Edge, Entity, ParseError
+
+DEFAULT_SNAPSHOT_DIR: Path = Path(".autosg") / "snapshots"
+
+# Edges resolved when none are asked for: without them, coupling and cycles are 0.
+DEFAULT_SNAPSHOT_EDGES: frozenset[str] = frozenset({"calls", "imports"})
+
+SNAPSHOT_VERSION: int = 1
+
+# The metrics compared between snapshots, in the order they are shown.
+METRICS: tuple[str, ...] = (
+    "files", "lines", "entities", "edges", "errors", "packages", "dependencies", "coupling",
+    "cycles", "cyclic_packages",
+)
+
+_ID_FORMAT: str = "%Y%m%dT%H%M%SZ"
+
+_RELATIVE_RE: re.Pattern[str] = re.compile(r"latest(?:~(\d+))?")
+
+
+class SnapshotError(Exception):
+    """Raised when a snapshot cannot be found, read, or written."""
+
+
+@dataclass
+class Snapshot:
+    """A stored snapshot's metadata and metrics; the result is loaded on demand."""
+
+    id: str
+    created: str  # ISO 8601, UTC
+    paths: list[str]
+    edge_kinds: list[str]
+    metrics: dict[str, Any]
+    label: str | None = None
+    commit: str | None = None
+    directory: Path = field(default=DEFAULT_SNAPSHOT_DIR, compare=False)
+
+    def to_dict(self) -> dict[str, Any]:
+        data: dict[str, Any] = dataclasses.asdict(self)
+        del data["directory"]
+        return {"version": SNAPSHOT_VERSION, **data}
+
+    @property
+    def result_path(self) -> Path:
+        return self.directory / f"{self.id}.result.json.gz"
+
+    def result(self) -> Result:
+        """The stored analysis result."""
+        try:
+            with gzip.open(self.result_path, "rt", encoding="utf-8") as f:
+                data: dict[str, Any] = json.load(f)
+        except (OSError, ValueError) as exc:
+            raise SnapshotError(f"cannot read snapshot {self.id}: {exc}") from None
+        entities: dict[str, list[Entity]] = defaultdict(list)
+        for record in data["entities"]:
+            entities[record["path"]].append(Entity(**record))
+        errors: dict[str, list[ParseError]] = defaultdict(list)
+        for record in data["errors"]:
+            errors[record["path"]].append(ParseError(**record))
+        files: list[FileResult] = [
+            FileResult(
+                f["path"], f["language"], entities[f["path"]], root=f.get("root"),
+                errors=errors[f["path"]],
+            )
+            for f in data["files"]
+        ]
+        return Result(files, [Edge(**record) for record in data["edges"]])
+
+
+# ---------------------------------------------------------------------------
+# Metrics
+# ---------------------------------------------------------------------------
+
+
+def snapshot_metrics(files: Iterable[FileResult], edges: Iterable[Edge]) -> dict[str, Any]:
+    """The metrics of one result: sizes, and its package graph's coupling and cycles."""
+    totals: Totals = Totals()
+    package_of: dict[int, str] = {}
+    for file_result in files:
+        totals.add(file_result)
+        where: str = package(file_result.path)
+        for entity in file_result.entities:
+            package_of[entity.id] = where
+    edge_kinds: Counter[str] = Counter()
+    dependencies: set[tuple[str, str]] = set()
+    for edge in edges:
+        edge_kinds[edge.kind] += 1
+        if edge.target is None or edge.source not in package_of or edge.target not in package_of:
+            continue
+        pair: tuple[str, str] = (package_of[edge.source], package_of[edge.target])
+        if pair[0] != pair[1]:
+            dependencies.add(pair)
+    packages: int = len(set(package_of.values()))
+    cyclic: list[list[str]] = cycles(dependencies)
+    metrics: dict[str, Any] = dict.fromkeys(METRICS, 0)
+    metrics.update(
+        files=totals.files, lines=totals.lines, entities=totals.entities,
+        edges=sum(edge_kinds.values()), errors=totals.errors, packages=packages,
+        dependencies=len(dependencies),
+        coupling=round(len(dependencies) / packages, 2) if packages else 0,
+        cycles=len(cyclic), cyclic_packages=sum(len(c) for c in cyclic),
+        entity_kinds=dict(sorted(totals.kinds.items())),
+        edge_kinds=dict(sorted(edge_kinds.items())),
+    )
+    return metrics
+
+
+# ---------------------------------------------------------------------------
+# Storage
+# ---------------------------------------------------------------------------
+
+
+def _git_commit() -> str | None:
+    """The commit checked out in the working directory, if it is in a git repository."""
+    try:
+        proc: subprocess.CompletedProcess[str] = subprocess.run(
+            ["git", "rev-parse", "--verify", "--quiet", "HEAD"],
+            capture_output=True, text=True, check=True,
+        )
+    except (FileNotFoundError, subprocess.CalledProcessError):
+        return None
+    return proc.stdout.strip() or None
+
+
+def _new_id(directory: Path, now: datetime.datetime) -> str:
+    """A timestamp id no snapshot in *directory* has yet."""
+    base: str = now.strftime(_ID_FORMAT)
+    candidate: str = base
+    ordinal: int = 2
+    while (directory / f"{candidate}.json").exists():
+        candidate = f"{base}-{ordinal}"
+        ordinal += 1
+    return candidate
+
+
+def save_snapshot(
+    paths: Iterable[str | os.PathLike[str]], options: Options,
+    directory: Path = DEFAULT_SNAPSHOT_DIR, label: str | None = None,
+) -> Snapshot:
+    """Analyze *paths* and store the result and its metrics as a new snapshot."""
+    roots: list[str] = [str(p) for p in paths]
+    if not options.edges:
+        options = dataclasses.replace(options, edges=DEFAULT_SNAPSHOT_EDGES)
+    now: datetime.datetime = datetime.datetime.now(datetime.timezone.utc)
+    analysis: Analysis = iter_analyze(roots, options)
+    result: Result = Result(list(analysis), list(analysis.edges))
+    try:
+        directory.mkdir(parents=True, exist_ok=True)
+        snapshot: Snapshot = Snapshot(
+            _new_id(directory, now), now.isoformat(timespec="seconds"), roots,
+            sorted(options.edges), snapshot_metrics(result.files, result.edges), label,
+            _git_commit(), directory,
+        )
+        with gzip.open(snapshot.result_path, "wt", encoding="utf-8") as out:
+            json.dump(result.to_dict(), out)
+        # Written last: a snapshot is listed once its result is complete.
+        (directory / f"{snapshot.id}.json").write_text(
+            json.dumps(snapshot.to_dict(), indent=2) + "\n", encoding="utf-8",
+        )
+    except OSError as exc:
+        raise SnapshotError(f"cannot write snapshot to {directory}: {exc}") from None
+    return snapshot
+
+
+def list_snapshots(directory: Path = DEFAULT_SNAPSHOT_DIR) -> list[Snapshot]:
+    """Every snapshot stored in *directory*, oldest first."""
+    if not directory.is_dir():
+        return []
+    snapshots: list[Snapshot] = []
+    for path in sorted(directory.glob("*.json")):
+        try:
+            data: dict[str, Any] = json.loads(path.read_text(encoding="utf-8"))
+        except (OSError, ValueError) as exc:
+            raise SnapshotError(f"cannot read snapshot {path}: {exc}") from None
+        if data.pop("version", None) != SNAPSHOT_VERSION:
+            raise SnapshotError(f"{path} was written by an incompatible version of autosg")
+        snapshots.append(Snapshot(**data, directory=directory))
+    return snapshots
+
+
+def find_snapshot(snapshots: list[Snapshot], ref: str) -> Snapshot:
+    """The snapshot *ref* names: ``latest``, ``latest~N`` (N before the latest),
+    an id or unique id prefix, or a label (the latest snapshot with it)."""
+    relative: re.Match[str] | None = _RELATIVE_RE.fullmatch(ref)
+    if relative is not None:
+        back: int = int(relative.group(1) or 0)
+        if back >= len(snapshots):
+            raise SnapshotError(f"{ref} is before the first of {len(snapshots)} snapshot(s)")
+        return snapshots[-1 - back]
+    exact: list[Snapshot] = [s for s in snapshots if s.id == ref]
+    prefixed: list[Snapshot] = exact or [s for s in snapshots if s.id.startswith(ref)]
+    if len(prefixed) == 1:
+        return prefixed[0]
+    if len(prefixed) > 1:
+        raise SnapshotError(
+            f"{ref} is ambiguous: {', '.join(s.id for s in prefixed)}",
+        )
+    labeled: list[Snapshot] = [s for s in snapshots if s.label == ref]
+    if labeled:
+        return labeled[-1]
+    raise SnapshotError(f"no snapshot {ref!r}")
+
+
+# ---------------------------------------------------------------------------
+# Comparison
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class Comparison:
+    """Two snapshots' metrics side by side, and the entities and edges between them."""
+
+    old: Snapshot
+    new: Snapshot
+    diff: Diff
+
+    def deltas(self) -> list[tuple[str, Any, Any, Any]]:
+        """(metric, old value, new value, change) for each of METRICS."""
+        rows: list[tuple[str, Any, Any, Any]] = []
+        for metric in METRICS:
+            before: Any = self.old.metrics.get(metric, 0)
+            after: Any = self.new.metrics.get(metric, 0)
+            change: Any = after - before
+            if isinstance(change, float):
+                change = round(change, 2)  # coupling
+            rows.append((metric, before, after, change))
+        return rows
+
+    def counts(self) -> dict[str, int]:
+        """How many entities were added, removed, and renamed or moved, and edges changed."""
+        counts: Counter[str] = Counter(c.status for c in self.diff.entities)
+        return {
+            "added": counts["added"], "removed": counts["removed"],
+            "renamed": counts["renamed"] + counts["moved"],
+            "edges_added": sum(1 for c in self.diff.edges if c.status == "added"),
+            "edges_removed": sum(1 for c in self.diff.edges if c.status == "removed"),
+        }
+
+    def to_dict(self) -> dict[str, Any]:
+        return {
+            "old": self.old.to_dict(), "new": self.new.to_dict(),
+            "metrics": {
+                metric: {"old": before, "new": after, "change": change}
+                for metric, before, after, change in self.deltas()
+            },
+            "changes": self.counts(),
+            **self.diff.to_dict(),
+        }
+
+
+def compare_snapshots(old: Snapshot, new: Snapshot) -> Comparison:
+    """Compare two snapshots' metrics and their entities and edges by key."""
+    here: Path = Path(".")
+    return Comparison(
+        old, new, diff_results(old.result(), here, new.result(), here, sources=False),
+    )
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+
+def _snapshot_label(snapshot: Snapshot) -> str:
+    details: list[str] = [d for d in (snapshot.label, (snapshot.commit or "")[:12]) if d]
+    return f"{snapshot.id} ({', '.join(details)})" if details else snapshot.id
+
+
+def _signed(value: Any) -> str:
+    return f"+{value}" if value > 0 else str(value)
+
+
+def render_list(snapshots: list[Snapshot]) -> str:
+    """One row per snapshot, oldest first, with its headline metrics."""
+    shown: tuple[str, ...] = ("files", "entities", "edges", "coupling", "cycles")
+    header: list[str] = ["id", "label", "commit", *shown]
+    rows: list[list[str]] = [header]
+    for snapshot in snapshots:
+        rows.append([
+            snapshot.id, snapshot.label or "-", (snapshot.commit or "-")[:12],
+            *(str(snapshot.metrics.get(metric, 0)) for metric in shown),
+        ])
+    widths: list[int] = [max(len(row[i]) for row in rows) for i in range(len(header))]
+    return "".join(
+        "  ".join(cell.ljust(w) for cell, w in zip(row, widths)).rstrip() + "\n" for row in rows
+    )
+
+
+def render_text(comparison: Comparison) -> str:
+    """A metric table with old and new values and the change, then the change counts."""
+    lines: list[str] = [
+        f"{_snapshot_label(comparison.old)} -> {_snapshot_label(comparison.new)}", "",
+    ]
+    rows: list[tuple[str, str, str, str]] = [("metric", "old", "new", "change")] + [
+        (metric, str(before), str(after), _signed(change))
+        for metric, before, after, change in comparison.deltas()
+    ]
+    widths: list[int] = [max(len(row[i]) for row in rows) for i in range(4)]
+    for row in rows:
+        lines.append("  ".join(
+            [row[0].ljust(widths[0]), *(cell.rjust(w) for cell, w in zip(row[1:], widths[1:]))],
+        ))
+    counts: dict[str, int] = comparison.counts()
+    lines.append("")
+    lines.append(
+        f"{counts['added']} added, {counts['removed']} removed, "
+        f"{counts['renamed']} renamed or moved entities; "
+        f"{counts['edges_added']} added, {counts['edges_removed']} removed edges.",
+    )
+    return "\n".join(lines) + "\n"
+
+
+def render_markdown(comparison: Comparison) -> str:
+    """The metric table as Markdown, for wikis and pull requests."""
+    out: list[str] = [
+        f"### {_snapshot_label(comparison.old)} → {_snapshot_label(comparison.new)}", "",
+        "| Metric | Old | New | Change |", "|---|---:|---:|---:|",
+    ]
+    out.extend(
+        f"| {metric} | {before} | {after} | {_signed(change)} |"
+        for metric, before, after, change in comparison.deltas()
+    )
+    counts: dict[str, int] = comparison.counts()
+    out.append("")
+    out.append(
+        f"{counts['added']} added, {counts['removed']} removed, "
+        f"{counts['renamed']} renamed or moved entities; "
+        f"{counts['edges_added']} added, {counts['edges_removed']} removed edges.",
+    )
+    return "\n".join(out) + "\n"
@@ -0,0 +1,82 @@
+"""Append-only buffers that spill to temporary files past a memory budget.
+
+Edges are only resolved once every file has been seen, so the references
+and edges of a large repository pile up between extraction and output.
+A :class:`Spool` holds them as a list until given a budget, and then
+pickles them into a ``SpooledTemporaryFile``, which stays in memory up to
+the budget and moves to disk beyond it.
+"""
+
+from __future__ import annotations
+
+import itertools
+import pickle
+import re
+import tempfile
+from collections.abc import Iterable, Iterator
+from typing import IO, Generic, TypeVar
+
+T = TypeVar("T")
+
+_SIZE_RE: re.Pattern[str] = re.compile(r"(\d+(?:\.\d+)?)\s*([KMGT]?)(i?B)?", re.IGNORECASE)
+
+_SIZE_UNITS: dict[str, int] = {"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+
+
+def parse_size(text: str) -> int:
+    """Bytes in a size like ``512M``, ``2G``, ``1.5GiB``, or ``65536``.
+
+    Units are binary (``1K`` is 1024 bytes).  Raises ``ValueError`` for
+    anything else.
+    """
+    match: re.Match[str] | None = _SIZE_RE.fullmatch(text.strip())
+    if match is None:
+        raise ValueError(f"not a size: {text!r} (expected e.g. 512M or 2G)")
+    size: int = int(float(match.group(1)) * _SIZE_UNITS[match.group(2).lower()])
+    if size <= 0:
+        raise ValueError(f"size must be positive: {text!r}")
+    return size
+
+
+class Spool(Generic[T]):
+    """An append-only sequence of picklable items, iterable any number of times.
+
+    Without *max_memory* items are kept in a list.  With it, they are
+    pickled as they arrive and held in memory up to *max_memory* bytes,
+    then in a temporary file deleted when the spool is.  An iteration
+    yields the items there were when it started.
+    """
+
+    def __init__(self, max_memory: int | None = None) -> None:
+        self.max_memory: int | None = max_memory
+        self._items: list[T] = []
+        self._file: IO[bytes] | None = None
+        self._count: int = 0
+        if max_memory is not None:
+            self._file = tempfile.SpooledTemporaryFile(max_size=max_memory)
+
+    def append(self, item: T) -> None:
+        if self._file is None:
+            self._items.append(item)
+        else:
+            self._file.seek(0, 2)  # an iteration may have moved it
+            pickle.dump(item, self._file, pickle.HIGHEST_PROTOCOL)
+            self._count += 1
+
+    def extend(self, items: Iterable[T]) -> None:
+        for item in items:
+            self.append(item)
+
+    def __len__(self) -> int:
+        return len(self._items) if self._file is None else self._count
+
+    def __iter__(self) -> Iterator[T]:
+        if self._file is None:
+            yield from itertools.islice(self._items, len(self._items))
+            return
+        position: int = 0
+        for _ in range(self._count):
+            self._file.seek(position)
+            item: T = pickle.load(self._file)
+            position = self._file.tell()
+            yield item
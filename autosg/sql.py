@@ -0,0 +1,330 @@
+"""SQL schema files: tables, views, functions, and procedures.
+
+``.sql`` files are read statement by statement rather than with the
+bundled tree-sitter grammar, which only covers a sliver of any one
+dialect.  ``CREATE TABLE``, ``CREATE VIEW`` (and materialized views), and
+``CREATE FUNCTION`` or ``PROCEDURE`` become ``table``, ``view``,
+``function``, and ``procedure`` entities; other statements are skipped.
+Tables record their ``columns``, ``primary_key``, and the tables their
+foreign keys ``references``.  Views and routines get ``reads`` and
+``writes`` references to the tables their queries use (see sqltext).
+"""
+
+from __future__ import annotations
+
+import bisect
+import re
+from typing import Any
+
+from .extracting import Edge, Entity, ParseError, assign_uids, file_entity
+from .sqltext import (
+    Access, Token, dotted_name, group_end, identifier, table_accesses, token_accesses, tokenize,
+)
+
+# ---------------------------------------------------------------------------
+# Schema files
+# ---------------------------------------------------------------------------
+
+_CREATED_KINDS: dict[str, str] = {
+    "FUNCTION": "function", "PROCEDURE": "procedure", "TABLE": "table", "VIEW": "view",
+}
+
+# Kinds CREATE is followed by that are not extracted, which end the search for one.
+_SKIPPED_KINDS: frozenset[str] = frozenset({
+    "DATABASE", "DOMAIN", "EXTENSION", "INDEX", "ROLE", "RULE", "SCHEMA", "SEQUENCE",
+    "TRIGGER", "TYPE", "USER",
+})
+
+# Column constraints; the column's type is what comes before the first one.
+_COLUMN_CONSTRAINTS: frozenset[str] = frozenset({
+    "AUTO_INCREMENT", "AUTOINCREMENT", "CHECK", "COLLATE", "COMMENT", "CONSTRAINT", "DEFAULT",
+    "GENERATED", "IDENTITY", "NOT", "NULL", "PRIMARY", "REFERENCES", "UNIQUE",
+})
+
+_TABLE_CONSTRAINTS: frozenset[str] = frozenset({
+    "CHECK", "CONSTRAINT", "EXCLUDE", "FOREIGN", "FULLTEXT", "INDEX", "KEY", "LIKE", "PERIOD",
+    "PRIMARY", "SPATIAL", "UNIQUE",
+})
+
+# Routine bodies delimited by keywords, whose semicolons do not end the statement.
+_BLOCK_OPENERS: frozenset[str] = frozenset({"BEGIN", "CASE"})
+
+
+def _statements(tokens: list[Token]) -> list[list[Token]]:
+    """Split at semicolons, keeping ``BEGIN ... END`` routine bodies whole."""
+    statements: list[list[Token]] = []
+    current: list[Token] = []
+    depth: int = 0
+    routine: bool = False
+    for token in tokens:
+        word: str = token.upper
+        if not current and token.text == ";":
+            continue
+        current.append(token)
+        if word in ("FUNCTION", "PROCEDURE", "TRIGGER") and current[0].upper == "CREATE":
+            routine = True
+        if routine and word in _BLOCK_OPENERS and (len(current) < 2 or current[-2].upper != "END"):
+            depth += 1  # not END CASE
+        elif routine and word == "END" and depth > 0:
+            depth -= 1
+            if depth == 0:
+                statements.append(current)
+                current, routine = [], False
+        elif token.text == ";" and depth == 0:
+            statements.append(current[:-1])
+            current, routine = [], False
+    if current:
+        statements.append(current)
+    return statements
+
+
+_DELIMITER_RE: re.Pattern[str] = re.compile(r"^[ \t]*DELIMITER[ \t]+(\S+)[ \t]*$", re.I | re.M)
+
+
+def _normalize_delimiters(text: str) -> str:
+    """Read MySQL ``DELIMITER //`` scripts as if ``;`` ended their statements.
+
+    The directives are blanked and custom delimiters at line ends replaced,
+    keeping every offset where it was.
+    """
+    if _DELIMITER_RE.search(text) is None:
+        return text
+    lines: list[str] = []
+    delimiter: str = ";"
+    for line in text.splitlines(keepends=True):
+        directive: re.Match[str] | None = _DELIMITER_RE.match(line.rstrip("\r\n"))
+        if directive is not None:
+            delimiter = directive.group(1)
+            lines.append(re.sub(r"[^\r\n]", " ", line))
+            continue
+        content: str = line.rstrip("\r\n")
+        if delimiter != ";" and content.rstrip().endswith(delimiter):
+            cut: int = len(content.rstrip()) - len(delimiter)
+            content = content[:cut] + ";" + " " * (len(content) - cut - 1)
+        lines.append(content + line[len(line.rstrip("\r\n")) :])
+    return "".join(lines)
+
+
+def _table_columns(
+    tokens: list[Token], start: int, end: int, text: str,
+) -> tuple[list[dict[str, Any]], list[str], list[str]]:
+    """Columns, the primary key, and the tables referenced in ``( ... )`` from *start* to *end*."""
+    columns: list[dict[str, Any]] = []
+    primary_key: list[str] = []
+    references: list[str] = []
+    elements: list[tuple[int, int]] = []
+    depth: int = 0
+    first: int = start + 1
+    for j in range(start + 1, end):
+        if tokens[j].text == "(":
+            depth += 1
+        elif tokens[j].text == ")":
+            depth -= 1
+        elif tokens[j].text == "," and depth == 0:
+            elements.append((first, j))
+            first = j + 1
+    elements.append((first, end))
+    for lo, hi in elements:
+        if lo >= hi:
+            continue
+        for j in range(lo, hi):
+            if tokens[j].upper == "REFERENCES":
+                found: tuple[str, int] | None = dotted_name(tokens, j + 1)
+                if found is not None and found[0] not in references:
+                    references.append(found[0])
+        head: str = tokens[lo].upper
+        if tokens[lo].kind == "word" and head in _TABLE_CONSTRAINTS:
+            key: int = next((j for j in range(lo, hi - 1) if tokens[j].upper == "PRIMARY"), -1)
+            if key >= 0 and key + 2 < hi and tokens[key + 2].text == "(":
+                close: int = group_end(tokens, key + 2)
+                primary_key.extend(
+                    identifier(t) for t in tokens[key + 3 : close] if t.kind in ("word", "quoted")
+                )
+            continue
+        name: str = identifier(tokens[lo])
+        type_end: int = next(
+            (j for j in range(lo + 1, hi) if tokens[j].upper in _COLUMN_CONSTRAINTS), hi,
+        )
+        column: dict[str, Any] = {"name": name}
+        if type_end > lo + 1:
+            column["type"] = " ".join(text[tokens[lo + 1].start : tokens[type_end - 1].end].split())
+        upper: list[str] = [t.upper for t in tokens[lo:hi]]
+        if "PRIMARY" in upper:
+            primary_key.append(name)
+        if any(a == "NOT" and b == "NULL" for a, b in zip(upper, upper[1:])):
+            column["not_null"] = True
+        columns.append(column)
+    return columns, primary_key, references
+
+
+def _routine_body(tokens: list[Token], start: int) -> tuple[str, int] | int | None:
+    """Where the body of a function or procedure is, looking from *start*.
+
+    A quoted body (``AS $$ ... $$`` or ``AS '...'``) is returned with the
+    offset of its text; a body written out (``BEGIN ... END``, ``AS
+    SELECT ...``) as the index of its first token.
+    """
+    for j in range(start, len(tokens)):
+        token: Token = tokens[j]
+        if token.kind == "dollar":
+            tag: int = token.text.index("$", 1) + 1
+            return token.text[tag:-tag], token.start + tag
+        if token.kind == "string" and tokens[j - 1].upper == "AS":
+            return token.text[1:-1].replace("''", "'"), token.start + 1
+        if token.upper in ("BEGIN", "RETURN") or (
+            token.upper == "AS" and j + 1 < len(tokens) and tokens[j + 1].kind == "word"
+        ):
+            return j
+    return None
+
+
+class _Schema:
+    """Entities and references of one SQL file, built statement by statement."""
+
+    def __init__(self, source_utf8: bytes, path: str) -> None:
+        self.source: bytes = source_utf8
+        self.text: str = source_utf8.decode("utf-8", errors="replace")
+        self.path: str = path
+        self.line_starts: list[int] = [0] + [m.end() for m in re.finditer(r"\n", self.text)]
+        self.entities: list[Entity] = [file_entity(source_utf8, "sql", path, 0)]
+        self.references: list[Edge] = []
+        self.byte_offset: int = 0
+        self.char_offset: int = 0
+
+    def position(self, offset: int) -> tuple[int, int]:
+        row: int = bisect.bisect_right(self.line_starts, offset) - 1
+        return row + 1, offset - self.line_starts[row] + 1
+
+    def byte(self, offset: int) -> int:
+        # Entities come in order, so each conversion starts where the last one ended.
+        if offset < self.char_offset:
+            self.byte_offset, self.char_offset = 0, 0
+        self.byte_offset += len(self.text[self.char_offset : offset].encode("utf-8"))
+        self.char_offset = offset
+        return self.byte_offset
+
+    def add(self, kind: str, name: str, statement: list[Token], attrs: dict[str, Any]) -> Entity:
+        start: int = statement[0].start
+        end: int = statement[-1].end
+        row, col = self.position(start)
+        end_row, end_col = self.position(end)
+        entity: Entity = Entity(
+            id=len(self.entities), kind=kind, name=name, path=self.path, language="sql",
+            row=row, col=col, end_row=end_row, end_col=end_col, parent=0, attrs=attrs,
+            start_byte=self.byte(start), end_byte=self.byte(end),
+        )
+        self.entities.append(entity)
+        return entity
+
+    def refer(self, entity: Entity, accesses: list[Access], base: int) -> None:
+        """Add reads and writes references from *entity*; *base* offsets the accesses."""
+        for access in accesses:
+            row, col = self.position(base + access.offset)
+            self.references.append(Edge(
+                access.kind, entity.id, None, {"name": access.table, "row": row, "col": col},
+            ))
+
+    def statement(self, tokens: list[Token]) -> None:
+        if not tokens or tokens[0].upper != "CREATE":
+            return
+        kind: str | None = None
+        i: int = 1
+        materialized: bool = False
+        while i < len(tokens) and kind is None:
+            word: str = tokens[i].upper
+            if word in _SKIPPED_KINDS or tokens[i].text == "(":
+                return
+            if word in _CREATED_KINDS:
+                kind = _CREATED_KINDS[word]
+            materialized = materialized or word == "MATERIALIZED"
+            i += 1
+        while i < len(tokens) and tokens[i].upper in ("IF", "NOT", "EXISTS"):
+            i += 1
+        found: tuple[str, int] | None = dotted_name(tokens, i)
+        if kind is None or found is None:
+            return
+        name, i = found
+        attrs: dict[str, Any] = {}
+        if kind == "table":
+            if i < len(tokens) and tokens[i].text == "(":
+                close: int = group_end(tokens, i)
+                columns, primary_key, references = _table_columns(tokens, i, close, self.text)
+                attrs["columns"] = columns
+                if primary_key:
+                    attrs["primary_key"] = primary_key
+                if references:
+                    attrs["references"] = references
+            entity: Entity = self.add(kind, name, tokens, attrs)
+            if i < len(tokens) and tokens[i].upper == "AS":  # CREATE TABLE t AS SELECT ...
+                self.refer(entity, token_accesses(tokens[i + 1 :]), 0)
+        elif kind == "view":
+            if materialized:
+                attrs["materialized"] = True
+            entity = self.add(kind, name, tokens, attrs)
+            query: int = next((j for j in range(i, len(tokens)) if tokens[j].upper == "AS"), -1)
+            if query >= 0:
+                self.refer(entity, token_accesses(tokens[query + 1 :]), 0)
+        else:
+            if i < len(tokens) and tokens[i].text == "(":
+                close = group_end(tokens, i)
+                attrs["parameters"] = [
+                    " ".join(part.split()) for part in
+                    _split_commas(self.text[tokens[i].end : tokens[close].start]) if part.strip()
+                ]
+                i = close + 1
+            returns: int = next(
+                (j for j in range(i, len(tokens)) if tokens[j].upper == "RETURNS"), -1,
+            )
+            if returns >= 0 and returns + 1 < len(tokens):
+                attrs["returns"] = identifier(tokens[returns + 1])
+            language: int = next(
+                (j for j in range(i, len(tokens)) if tokens[j].upper == "LANGUAGE"), -1,
+            )
+            if language >= 0 and language + 1 < len(tokens):
+                attrs["body_language"] = identifier(tokens[language + 1]).strip("'").lower()
+            entity = self.add(kind, name, tokens, attrs)
+            body: tuple[str, int] | int | None = _routine_body(tokens, i)
+            if isinstance(body, tuple):
+                self.refer(entity, table_accesses(body[0]), body[1])
+            elif body is not None:
+                self.refer(entity, token_accesses(tokens[body:]), 0)
+
+
+def _split_commas(text: str) -> list[str]:
+    """*text* split at commas outside parentheses."""
+    parts: list[str] = []
+    depth: int = 0
+    start: int = 0
+    for i, char in enumerate(text):
+        if char == "(":
+            depth += 1
+        elif char == ")":
+            depth -= 1
+        elif char == "," and depth == 0:
+            parts.append(text[start:i])
+            start = i + 1
+    parts.append(text[start:])
+    return parts
+
+
+def sql_entities(
+    source_utf8: bytes, path: str,
+) -> tuple[list[Entity], list[Edge], list[ParseError]]:
+    """The entities of a SQL file, their ``reads`` and ``writes`` references, and errors.
+
+    The only error is a string, quoted name, or comment left open at the
+    end of the file, which swallows whatever follows it.
+    """
+    schema: _Schema = _Schema(source_utf8, path)
+    tokens, unterminated = tokenize(_normalize_delimiters(schema.text))
+    for statement in _statements(tokens):
+        schema.statement(statement)
+    errors: list[ParseError] = []
+    if unterminated is not None:
+        row, col = schema.position(unterminated.start)
+        end_row, end_col = schema.position(unterminated.end)
+        errors.append(ParseError(
+            path, "syntax", f"unterminated {unterminated.kind}", row, col, end_row, end_col,
+        ))
+    assign_uids(schema.entities)
+    return schema.entities, schema.references, errors
@@ -0,0 +1,220 @@
+"""Tokens of SQL text, and the tables the statements in it read and write.
+
+table_accesses finds the tables a statement reads (``FROM``, ``JOIN``,
+``USING``) and writes (``INSERT INTO``, ``UPDATE``, ``DELETE FROM``,
+``MERGE INTO``, ``TRUNCATE``), leaving out common table expressions and
+table functions.  Extraction looks for them in SQL schema files (see sql)
+and in the string literals of functions that looks_like_sql accepts.
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass
+
+# ---------------------------------------------------------------------------
+# Tokens
+# ---------------------------------------------------------------------------
+
+_TOKEN_RE: re.Pattern[str] = re.compile(r"""
+    (?P<space>\s+)
+  | (?P<comment>--[^\n]*|/\*.*?(?:\*/|\Z))
+  | (?P<dollar>\$(?P<tag>[A-Za-z_]\w*)?\$.*?(?:\$(?P=tag)?\$|\Z))
+  | (?P<string>[EeNnXxBb]?'(?:[^']|'')*(?:'|\Z))
+  | (?P<quoted>"(?:[^"]|"")*(?:"|\Z)|`[^`]*(?:`|\Z)|\[[^\W\d][^\]\n]*\])
+  | (?P<word>(?:[^\W\d]|[@#])[\w$@#]*)
+  | (?P<number>\d[\w.]*)
+  | (?P<punct>.)
+""", re.VERBOSE | re.DOTALL)
+
+# What a token that reaches the end of the text must look like to be closed.
+_COMPLETE: dict[str, re.Pattern[str]] = {
+    "comment": re.compile(r"--.*|/\*.*\*/", re.DOTALL),
+    "dollar": re.compile(r"(\$\w*\$).*\1", re.DOTALL),
+    "quoted": re.compile(r'".*"|`.*`|\[.*\]', re.DOTALL),
+    "string": re.compile(r"[EeNnXxBb]?'(?:[^']|'')*'", re.DOTALL),
+}
+
+
+@dataclass(frozen=True)
+class Token:
+    kind: str  # "word", "quoted", "string", "dollar", "number", or "punct"
+    text: str
+    start: int  # character offsets into the text
+    end: int
+
+    @property
+    def upper(self) -> str:
+        return self.text.upper() if self.kind == "word" else self.text
+
+
+def tokenize(text: str) -> tuple[list[Token], Token | None]:
+    """The tokens of *text*, and the string or comment left open at its end, if any."""
+    tokens: list[Token] = []
+    unterminated: Token | None = None
+    for match in _TOKEN_RE.finditer(text):
+        kind: str = match.lastgroup or "punct"
+        token: Token = Token(kind, match.group(), match.start(), match.end())
+        if (
+            match.end() == len(text) and kind in _COMPLETE
+            and _COMPLETE[kind].fullmatch(token.text) is None
+        ):
+            unterminated = token
+        if kind not in ("space", "comment"):
+            tokens.append(token)
+    return tokens, unterminated
+
+
+def identifier(token: Token) -> str:
+    """A name as the database sees it: without ``"quotes"``, backticks, or brackets."""
+    if token.kind == "quoted":
+        return token.text[1:-1].replace('""', '"')
+    return token.text
+
+
+def dotted_name(tokens: list[Token], i: int) -> tuple[str, int] | None:
+    """The possibly qualified name (``public.users``) at *i*, and the index after it."""
+    parts: list[str] = []
+    while i < len(tokens) and tokens[i].kind in ("word", "quoted"):
+        parts.append(identifier(tokens[i]))
+        if i + 1 < len(tokens) and tokens[i + 1].text == ".":
+            i += 2
+            continue
+        return ".".join(parts), i + 1
+    return None
+
+
+def group_end(tokens: list[Token], i: int) -> int:
+    """The index of the ``)`` closing the ``(`` at *i*, or the last token."""
+    depth: int = 0
+    for j in range(i, len(tokens)):
+        if tokens[j].text == "(":
+            depth += 1
+        elif tokens[j].text == ")":
+            depth -= 1
+            if depth == 0:
+                return j
+    return len(tokens) - 1
+
+
+# ---------------------------------------------------------------------------
+# Table accesses
+# ---------------------------------------------------------------------------
+
+_SQL_RE: re.Pattern[str] = re.compile(
+    r"^[\s(]*(?:select\b[\s\S]*\bfrom\b|insert\s+(?:\w+\s+)*?into\b|replace\s+into\b"
+    r"|update\s+\S+\s+set\b|delete\s+from\b|merge\s+into\b|truncate\s+(?:table\s+)?\w"
+    r"|with\s+(?:recursive\s+)?\w+\s*(?:\([^)]*\)\s*)?as\s*\()",
+    re.IGNORECASE,
+)
+
+
+def looks_like_sql(text: str) -> bool:
+    """Whether a string literal holds a query or data-changing statement."""
+    return _SQL_RE.match(text) is not None
+
+
+# Words that follow a table name rather than alias it.
+_CLAUSE_WORDS: frozenset[str] = frozenset({
+    "CROSS", "DEFAULT", "EXCEPT", "FETCH", "FOR", "FULL", "GROUP", "HAVING", "INNER",
+    "INTERSECT", "JOIN", "LEFT", "LIMIT", "NATURAL", "OFFSET", "ON", "ORDER", "OUTER",
+    "OUTPUT", "RETURNING", "RIGHT", "SELECT", "SET", "STRAIGHT_JOIN", "UNION", "USING",
+    "VALUES", "WHERE", "WINDOW", "WITH",
+})
+
+# Functions whose arguments use FROM without naming a table: EXTRACT(YEAR FROM d).
+_FROM_ARGUMENT_FUNCTIONS: frozenset[str] = frozenset(
+    {"EXTRACT", "OVERLAY", "POSITION", "SUBSTRING", "TRIM"},
+)
+
+# Words before UPDATE and DELETE when they are not statements: ON DELETE CASCADE,
+# SELECT ... FOR UPDATE, ON CONFLICT DO UPDATE, ON DUPLICATE KEY UPDATE.
+_NOT_STATEMENT_BEFORE: frozenset[str] = frozenset({"DO", "FOR", "KEY", "ON"})
+
+# Words between a statement's verb and its table.
+_MODIFIERS: frozenset[str] = frozenset(
+    {"DELAYED", "HIGH_PRIORITY", "IGNORE", "LATERAL", "LOW_PRIORITY", "ONLY", "QUICK", "TABLE"},
+)
+
+
+@dataclass(frozen=True)
+class Access:
+    kind: str  # "reads" or "writes"
+    table: str
+    offset: int  # character offset of the name in the statement's text
+
+
+def token_accesses(tokens: list[Token]) -> list[Access]:
+    """The tables the statements in *tokens* read and write, in order."""
+    accesses: list[Access] = []
+    # Common table expressions are named like tables but are not.
+    ctes: set[str] = {
+        tokens[i].text.lower() for i in range(1, len(tokens) - 2)
+        if tokens[i].kind in ("word", "quoted") and tokens[i + 1].upper == "AS"
+        and tokens[i + 2].text == "(" and tokens[i - 1].upper in ("WITH", "RECURSIVE", ",")
+    }
+    verb: str | None = None  # the statement the current clause belongs to
+    calls: list[str] = []  # the function or keyword before each open parenthesis
+
+    def names(i: int, kind: str, many: bool) -> None:
+        """Record the table at *i*, and the ones after it if *many* (FROM a, b)."""
+        while i < len(tokens):
+            while i < len(tokens) and tokens[i].upper in _MODIFIERS:
+                i += 1
+            found: tuple[str, int] | None = dotted_name(tokens, i)
+            if found is None or found[0].upper() in _CLAUSE_WORDS:
+                return
+            name, after = found
+            if kind == "reads" and after < len(tokens) and tokens[after].text == "(":
+                return  # a table function, e.g. generate_series(1, 10)
+            if name.lower() not in ctes:
+                accesses.append(Access(kind, name, tokens[i].start))
+            if not many:
+                return
+            if after < len(tokens) and tokens[after].upper == "AS":
+                after += 1
+            if (
+                after < len(tokens) and tokens[after].kind in ("word", "quoted")
+                and tokens[after].upper not in _CLAUSE_WORDS
+            ):
+                after += 1  # an alias
+            if after >= len(tokens) or tokens[after].text != ",":
+                return
+            i = after + 1
+
+    for i, token in enumerate(tokens):
+        word: str = token.upper
+        previous: str = tokens[i - 1].upper if i > 0 else ""
+        if token.text == "(":
+            calls.append(previous)
+        elif token.text == ")":
+            if calls:
+                calls.pop()
+        elif token.kind != "word":
+            continue
+        elif word in ("SELECT", "INSERT", "MERGE", "REPLACE") and previous != "OR" and not (
+            i + 1 < len(tokens) and tokens[i + 1].text == "("  # the REPLACE() function
+        ):
+            verb = word
+        elif word in ("UPDATE", "DELETE") and previous not in _NOT_STATEMENT_BEFORE:
+            verb = word
+            if word == "UPDATE":
+                names(i + 1, "writes", False)
+        elif word == "FROM":
+            if (calls and calls[-1] in _FROM_ARGUMENT_FUNCTIONS) or previous == "DISTINCT":
+                continue
+            names(i + 1, "writes" if verb == "DELETE" else "reads", True)
+            if verb == "DELETE":
+                verb = None  # DELETE FROM t USING u: u is read
+        elif word == "INTO" and verb in ("INSERT", "MERGE", "REPLACE"):
+            names(i + 1, "writes", False)
+        elif word == "TRUNCATE":
+            names(i + 1, "writes", True)
+        elif word in ("JOIN", "USING"):  # JOIN t USING (id) names no table
+            names(i + 1, "reads", False)
+    return accesses
+
+
+def table_accesses(text: str) -> list[Access]:
+    """The tables the statements in *text* read and write, in order."""
+    return token_accesses(tokenize(text)[0])
@@ -0,0 +1,271 @@
+"""Skeleton generation: source files with function bodies stubbed out.
+
+Signatures, types, imports, and comments outside function bodies are kept
+byte-for-byte; each outermost function body is replaced by a placeholder
+that keeps the file syntactically valid (``panic("stub")`` in Go, ``...``
+in Python).  Python docstrings are kept, since they document the
+signature rather than implement it.  Go imports that were only used inside
+bodies become blank imports (``_ "fmt"``) so stubs still compile.
+
+Stubs can be validated after generation: every stub is re-parsed, and Go
+modules are type-checked with ``go vet`` when a Go toolchain is installed.
+"""
+
+from __future__ import annotations
+
+import re
+import shutil
+import subprocess
+from collections import defaultdict
+from collections.abc import Iterator
+from dataclasses import dataclass
+from pathlib import Path
+
+from tree_sitter import Node, Tree
+
+from .parsing import parse_tree
+
+# Build manifests copied verbatim into a stub tree so it can be type-checked.
+COPIED_FILES: frozenset[str] = frozenset({"go.mod", "go.sum"})
+
+# Statement used in place of a body, per language.
+DEFAULT_PLACEHOLDERS: dict[str, str] = {
+    "go": 'panic("stub")',
+    "javascript": 'throw new Error("stub");',
+    "python": "...",
+    "rust": "todo!()",
+    "tsx": 'throw new Error("stub");',
+    "typescript": 'throw new Error("stub");',
+}
+
+_JS_FUNCTION_TYPES: frozenset[str] = frozenset({
+    "arrow_function",
+    "function",
+    "function_declaration",
+    "function_expression",
+    "generator_function",
+    "generator_function_declaration",
+    "method_definition",
+})
+
+# Node types whose "body" field is a function body.
+_FUNCTION_TYPES: dict[str, frozenset[str]] = {
+    "go": frozenset({"func_literal", "function_declaration", "method_declaration"}),
+    "javascript": _JS_FUNCTION_TYPES,
+    "python": frozenset({"function_definition"}),
+    "rust": frozenset({"closure_expression", "function_item"}),
+    "tsx": _JS_FUNCTION_TYPES,
+    "typescript": _JS_FUNCTION_TYPES,
+}
+
+
+def supports(language: str) -> bool:
+    """Whether stubs can be generated for *language*."""
+    return language in _FUNCTION_TYPES
+
+
+def _bodies(root: Node, function_types: frozenset[str]) -> Iterator[tuple[Node, Node]]:
+    """Yield (function, body) for outermost function bodies in document order."""
+    stack: list[Node] = [root]
+    while stack:
+        node: Node = stack.pop()
+        if node.type in function_types:
+            body: Node | None = node.child_by_field_name("body")
+            if body is not None:
+                yield node, body
+                continue  # nested functions go with the body
+        stack.extend(reversed(node.children))
+
+
+def _python_body(body: Node, placeholder: str, source: bytes) -> bytes:
+    """Keep a leading docstring, then the placeholder at the same indentation."""
+    first: Node | None = body.named_children[0] if body.named_children else None
+    if (
+        first is None
+        or first.type != "expression_statement"
+        or not first.named_children
+        or first.named_children[0].type != "string"
+    ):
+        return placeholder.encode()
+    docstring: bytes = source[first.start_byte : first.end_byte]
+    line_start: int = source.rfind(b"\n", 0, body.start_byte) + 1
+    indent: bytes = source[line_start : body.start_byte]
+    if indent.strip():
+        return docstring + b"; " + placeholder.encode()  # def f(): "doc"; ...
+    return docstring + b"\n" + indent + placeholder.encode()
+
+
+_GO_MAJOR_VERSION_RE: re.Pattern[str] = re.compile(r"^v\d+$")
+
+
+def _go_package_names(import_path: str) -> set[str]:
+    """Names a package imported from *import_path* is likely declared as.
+
+    The real name is only known from the package source, so this covers
+    the usual conventions: ``.../chi/v5`` is ``chi``, ``gopkg.in/yaml.v3``
+    is ``yaml``, and ``go-isatty`` is ``isatty``.
+    """
+    parts: list[str] = import_path.split("/")
+    last: str = parts[-1]
+    if _GO_MAJOR_VERSION_RE.match(last) and len(parts) > 1:
+        last = parts[-2]
+    last = re.sub(r"\.v\d+$", "", last)
+    names: set[str] = {last, last.replace("-", "_"), last.replace("-", "")}
+    for prefix in ("go-", "go"):
+        if last.startswith(prefix) and len(last) > len(prefix):
+            names.add(last[len(prefix) :].replace("-", "_"))
+            break
+    return names
+
+
+def _blank_unused_go_imports(source: bytes) -> bytes:
+    """Turn imports that no longer appear outside import blocks into ``_`` imports."""
+    root: Node = parse_tree(source, "go").root_node
+    used: set[str] = set()
+    specs: list[Node] = []
+    stack: list[Node] = [root]
+    while stack:
+        node: Node = stack.pop()
+        if node.type == "import_spec":
+            specs.append(node)
+            continue
+        if node.type in ("identifier", "package_identifier"):
+            used.add(node.text.decode())
+        stack.extend(node.children)
+    edits: list[tuple[int, int, bytes]] = []
+    for spec in specs:
+        path: Node | None = spec.child_by_field_name("path")
+        alias: Node | None = spec.child_by_field_name("name")
+        if path is None:
+            continue
+        if alias is not None:
+            names: set[str] = {alias.text.decode()}
+            if names & {"_", "."}:
+                continue
+        else:
+            names = _go_package_names(path.text.decode().strip("\"`"))
+        if names & used:
+            continue
+        if alias is not None:
+            edits.append((alias.start_byte, alias.end_byte, b"_"))
+        else:
+            edits.append((path.start_byte, path.start_byte, b"_ "))
+    for start, end, text in sorted(edits, reverse=True):
+        source = source[:start] + text + source[end:]
+    return source
+
+
+def stub_source(
+    source_utf8: bytes,
+    language: str,
+    placeholder: str | None = None,
+    tree: Tree | None = None,
+) -> tuple[bytes, int]:
+    """Replace function bodies in *source_utf8*.
+
+    Returns (stubbed source, number of bodies replaced).  Raises
+    ``ValueError`` for languages without stub support.
+    """
+    function_types: frozenset[str] | None = _FUNCTION_TYPES.get(language)
+    if function_types is None:
+        raise ValueError(f"stubs are not supported for {language}")
+    if placeholder is None:
+        placeholder = DEFAULT_PLACEHOLDERS[language]
+    if tree is None:
+        tree = parse_tree(source_utf8, language)
+    out: list[bytes] = []
+    pos: int = 0
+    count: int = 0
+    for _function, body in _bodies(tree.root_node, function_types):
+        replacement: bytes
+        if language == "python":
+            replacement = _python_body(body, placeholder, source_utf8)
+        else:
+            # Expression-bodied arrows (x => x + 1) become block bodies too.
+            replacement = b"{ " + placeholder.encode() + b" }"
+        out.append(source_utf8[pos : body.start_byte])
+        out.append(replacement)
+        pos = body.end_byte
+        count += 1
+    out.append(source_utf8[pos:])
+    stubbed: bytes = b"".join(out)
+    if language == "go" and count:
+        stubbed = _blank_unused_go_imports(stubbed)
+    return stubbed, count
+
+
+# ---------------------------------------------------------------------------
+# Validation
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class StubProblem:
+    """Why a generated stub failed validation."""
+
+    path: str
+    message: str
+
+
+def syntax_errors(source_utf8: bytes, language: str) -> list[str]:
+    """Return ``row:col: ...`` messages for ERROR and MISSING nodes."""
+    messages: list[str] = []
+    stack: list[Node] = [parse_tree(source_utf8, language).root_node]
+    while stack:
+        node: Node = stack.pop()
+        if not node.has_error and not node.is_missing:
+            continue
+        row, col = node.start_point
+        if node.is_missing:
+            messages.append(f"{row + 1}:{col + 1}: missing {node.type}")
+        elif node.type == "ERROR":
+            messages.append(f"{row + 1}:{col + 1}: syntax error")
+            continue
+        stack.extend(reversed(node.children))
+    return messages
+
+
+_GO_VET_LINE_RE: re.Pattern[str] = re.compile(
+    r"^(?:vet: )?(?:\./)?(\S+\.go):(\d+):(\d+): (.*)$",
+)
+
+
+def go_type_check(stub_root: Path) -> tuple[list[StubProblem], list[str]]:
+    """Run ``go vet`` in every Go module under *stub_root*.
+
+    Returns (problems attributed to stub files, notes about modules that
+    could not be checked).  Without a Go toolchain nothing is checked.
+    """
+    go: str | None = shutil.which("go")
+    if go is None:
+        return [], ["go is not installed; Go stubs were only checked for syntax."]
+    problems: list[StubProblem] = []
+    notes: list[str] = []
+    for go_mod in sorted(stub_root.rglob("go.mod")):
+        module_dir: Path = go_mod.parent
+        proc: subprocess.CompletedProcess[str] = subprocess.run(
+            [go, "vet", "./..."], cwd=module_dir, capture_output=True, text=True,
+        )
+        if proc.returncode == 0:
+            continue
+        by_file: dict[str, list[str]] = defaultdict(list)
+        unattributed: list[str] = []
+        for line in proc.stderr.splitlines():
+            match: re.Match[str] | None = _GO_VET_LINE_RE.match(line.strip())
+            if match is not None:
+                file_path: Path = module_dir / match.group(1)
+                by_file[file_path.relative_to(stub_root).as_posix()].append(
+                    f"{match.group(2)}:{match.group(3)}: {match.group(4)}",
+                )
+            elif line.strip() and not line.startswith("#"):
+                unattributed.append(line.strip())
+        for path, messages in sorted(by_file.items()):
+            problems.extend(StubProblem(path, m) for m in messages)
+        if not by_file:
+            # Typically missing dependencies: the module cannot be loaded at all.
+            detail: str = unattributed[0] if unattributed else f"exit status {proc.returncode}"
+            notes.append(
+                f"could not type-check {module_dir.relative_to(stub_root).as_posix() or '.'}: "
+                f"{detail}",
+            )
+    return problems, notes
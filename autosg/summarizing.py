@@ -0,0 +1,186 @@
+"""Terminal overviews of a codebase for the ``summary`` command.
+
+A summary is a first look before exporting anything: the languages of
+the files, the largest entities, the most depended-on modules (files,
+counted by the files that call or import them), the functions calling
+the most others, and the dependency cycles among files.  It is plain
+text for a terminal, colored when writing to one.
+"""
+
+from __future__ import annotations
+
+from collections import Counter, defaultdict
+from dataclasses import dataclass, field
+from typing import TextIO
+
+import click
+
+from .analysis import Analysis
+from .counting import Totals, counted, cycles, lines
+from .extracting import qualified_names
+
+
+@dataclass
+class Summary:
+    """What a summary shows, ranked and cut to its top rows."""
+
+    title: str
+    files: int = 0
+    lines: int = 0
+    entities: int = 0
+    edges: Counter[str] = field(default_factory=Counter)
+    languages: dict[str, Totals] = field(default_factory=dict)
+    # (lines, kind, qualified name, path:row), largest first
+    largest: list[tuple[int, str, str, str]] = field(default_factory=list)
+    # (dependent files, edges in, path), most depended-on first
+    depended_on: list[tuple[int, int, str]] = field(default_factory=list)
+    # (distinct callees, calls, kind, qualified name, path:row), most first
+    fan_out: list[tuple[int, int, str, str, str]] = field(default_factory=list)
+    cycles: list[list[str]] = field(default_factory=list)  # files in each, largest first
+
+
+def build_summary(analysis: Analysis, title: str, top: int = 10) -> Summary:
+    """Collect summary data; iterates *analysis*, which should resolve calls and imports."""
+    summary: Summary = Summary(title)
+    languages: dict[str, Totals] = defaultdict(Totals)
+    largest: list[tuple[int, str, str, str]] = []
+    file_of: dict[int, str] = {}
+    callers: dict[int, tuple[str, str, str]] = {}  # id -> (kind, qualified name, path:row)
+    for file_result in analysis:
+        languages[file_result.language].add(file_result)
+        names: dict[int, str] = qualified_names(file_result.entities)
+        for entity in file_result.entities:
+            file_of[entity.id] = file_result.path
+        for entity in counted(file_result.entities):
+            where: str = f"{entity.path}:{entity.row}"
+            callers[entity.id] = (entity.kind, names[entity.id], where)
+            largest.append((max(lines(entity), 1), entity.kind, names[entity.id], where))
+        # Keep only what can still make the top rows.
+        if len(largest) > 4 * top:
+            largest.sort(key=lambda row: (-row[0], row[3]))
+            del largest[top:]
+    largest.sort(key=lambda row: (-row[0], row[3]))
+    summary.largest = largest[:top]
+    summary.languages = dict(
+        sorted(languages.items(), key=lambda item: (-item[1].lines, item[0])),
+    )
+    summary.files = sum(stats.files for stats in languages.values())
+    summary.lines = sum(stats.lines for stats in languages.values())
+    summary.entities = sum(stats.entities for stats in languages.values())
+
+    dependents: dict[str, set[str]] = defaultdict(set)
+    edges_in: Counter[str] = Counter()
+    callees: dict[int, set[int]] = defaultdict(set)
+    calls: Counter[int] = Counter()
+    for edge in analysis.edges:
+        summary.edges[edge.kind] += 1
+        if edge.target is None or edge.source not in file_of or edge.target not in file_of:
+            continue
+        if edge.kind == "calls" and edge.source in callers:
+            callees[edge.source].add(edge.target)
+            calls[edge.source] += 1
+        source, target = file_of[edge.source], file_of[edge.target]
+        if source != target:
+            dependents[target].add(source)
+            edges_in[target] += 1
+    summary.depended_on = sorted(
+        ((len(dependents[path]), edges_in[path], path) for path in dependents),
+        key=lambda row: (-row[0], -row[1], row[2]),
+    )[:top]
+    summary.fan_out = sorted(
+        ((len(targets), calls[id_], *callers[id_]) for id_, targets in callees.items()),
+        key=lambda row: (-row[0], -row[1], row[4]),
+    )[:top]
+
+    summary.cycles = sorted(
+        cycles((source, target) for target, sources in dependents.items() for source in sources),
+        key=lambda cycle: (-len(cycle), cycle),
+    )
+    return summary
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+
+def _heading(text: str) -> str:
+    return click.style(text, bold=True)
+
+
+def _number(value: int) -> str:
+    return click.style(f"{value:,}", fg="cyan")
+
+
+def _table(rows: list[list[str]], numeric: int) -> list[str]:
+    """Rows as aligned lines, the first *numeric* columns right-aligned."""
+    if not rows:
+        return ["  none"]
+    widths: list[int] = [
+        max(len(click.unstyle(row[i])) for row in rows) for i in range(len(rows[0]))
+    ]
+    lines: list[str] = []
+    for row in rows:
+        cells: list[str] = []
+        for i, cell in enumerate(row):
+            pad: str = " " * (widths[i] - len(click.unstyle(cell)))
+            cells.append(pad + cell if i < numeric else cell + pad)
+        lines.append("  " + "  ".join(cells).rstrip())
+    return lines
+
+
+def render_summary(summary: Summary, top: int = 10) -> list[str]:
+    """The lines of *summary*, styled with ANSI codes that click strips when uncolored."""
+    via: str = ", ".join(f"{_number(n)} {kind}" for kind, n in sorted(summary.edges.items()))
+    lines: list[str] = [
+        _heading(summary.title),
+        f"  {_number(summary.files)} files, {_number(summary.lines)} lines, "
+        f"{_number(summary.entities)} entities" + (f"; edges: {via}" if via else ""),
+        "",
+        _heading("Languages"),
+        *_table([
+            [
+                _number(stats.files), "files", _number(stats.lines), "lines",
+                f"{100 * stats.lines / summary.lines:5.1f}%" if summary.lines else "",
+                language,
+            ]
+            for language, stats in summary.languages.items()
+        ], 5),
+        "",
+        _heading("Largest entities (lines)"),
+        *_table([
+            [_number(size), kind, name, click.style(where, dim=True)]
+            for size, kind, name, where in summary.largest
+        ], 1),
+        "",
+        _heading("Most depended-on modules (dependent files, edges in)"),
+        *_table([
+            [_number(files), _number(edges), path]
+            for files, edges, path in summary.depended_on
+        ], 2),
+        "",
+        _heading("Highest fan-out (distinct callees, calls)"),
+        *_table([
+            [_number(distinct), _number(total), kind, name, click.style(where, dim=True)]
+            for distinct, total, kind, name, where in summary.fan_out
+        ], 2),
+        "",
+    ]
+    cyclic: int = sum(len(cycle) for cycle in summary.cycles)
+    count: str = click.style(
+        f"{len(summary.cycles)} cycle(s) among {cyclic} files",
+        fg="red" if summary.cycles else "green",
+    )
+    lines.append(f"{_heading('Dependency cycles')}: {count}")
+    for cycle in summary.cycles[:top]:
+        shown: list[str] = cycle if len(cycle) <= 5 else [*cycle[:5], f"{len(cycle) - 5} more"]
+        lines.append(f"  {_number(len(cycle))} files: {', '.join(shown)}")
+    if len(summary.cycles) > top:
+        lines.append(f"  {len(summary.cycles) - top} more")
+    return lines
+
+
+def write_summary(summary: Summary, out: TextIO, top: int = 10, color: bool | None = None) -> None:
+    """Write *summary* to *out*; *color* None colors only when it is a terminal."""
+    for line in render_summary(summary, top):
+        click.echo(line, file=out, color=color)
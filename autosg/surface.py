@@ -0,0 +1,426 @@
+"""Public API surfaces, for ``api`` and ``api diff``.
+
+A surface lists the symbols a package exports, one per function, method,
+type, and field, with the signature it is used by:
+
+- Go: capitalized functions, types, and methods on capitalized types,
+  exported struct fields, and interface methods.  Signatures are the
+  parameter and result types (``func Parse(string) (int, error)``), so
+  renaming a parameter is not a change.
+- Java: ``public`` classes, interfaces, enums, and their ``public``
+  methods, constructors, and fields, and every member of an interface.
+- JavaScript and TypeScript: declarations ``export``ed from a module, and
+  the members of exported classes that are not private or protected.
+
+Outside Go, a signature is the declaration as written up to its body
+(or, for a field, its initializer), with whitespace collapsed; a
+TypeScript interface, type alias, or enum is its whole declaration.
+
+Comparing two surfaces sorts the changes into breaking ones (a removed
+symbol, a changed signature, a method added to an existing interface or
+an abstract method to an existing class, which its implementations then
+lack) and compatible ones (added symbols and overloads), and suggests the
+semantic version bump they call for: major, minor, or patch.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import dataclasses
+import json
+import os
+from collections import defaultdict
+from collections.abc import Iterable, Iterator
+from dataclasses import asdict, dataclass, field
+from pathlib import Path
+from typing import Any
+
+from .analysis import FileResult, Options, iter_analyze
+from .annotating import FileEncoding, read_source_utf8
+from .diffing import materialize
+from .extracting import Entity, is_exported, qualified_names
+
+API_LANGUAGES: frozenset[str] = frozenset({"go", "java", "javascript", "tsx", "typescript"})
+
+SURFACE_VERSION: int = 1
+
+_SYMBOL_KINDS: frozenset[str] = frozenset({
+    "class", "enum", "field", "function", "interface", "method", "type",
+})
+
+# Declarations whose body is their API, so they are compared whole.
+_WHOLE_KINDS: frozenset[str] = frozenset({"enum", "interface", "type"})
+
+
+@dataclass(frozen=True)
+class Symbol:
+    """One exported declaration."""
+
+    language: str
+    module: str  # a package directory (Go, Java) or a module file without extension
+    name: str  # qualified through enclosing declarations: Client.Send
+    kind: str
+    signature: str
+    abstract: bool = False  # implementations must provide it, so adding one breaks them
+
+    def key(self) -> tuple[str, str, str]:
+        return (self.language, self.module, self.name)
+
+
+class SurfaceError(Exception):
+    """Raised when a stored surface cannot be read."""
+
+
+# ---------------------------------------------------------------------------
+# Extraction
+# ---------------------------------------------------------------------------
+
+
+def _module(path: str, language: str) -> str:
+    if language in ("go", "java"):
+        return os.path.dirname(path) or "."
+    stem: str = path.removesuffix(".d.ts")
+    return os.path.splitext(stem)[0]
+
+
+def _header(text: str, stops: str = "{;") -> str:
+    """*text* up to the first of *stops* outside brackets, with whitespace collapsed."""
+    depth: int = 0
+    quote: str | None = None
+    for i, char in enumerate(text):
+        if quote is not None:
+            if char == quote:
+                quote = None
+        elif char in "\"'`":
+            quote = char
+        elif char in "([":
+            depth += 1
+        elif char in ")]":
+            depth -= 1
+        elif depth == 0 and char in stops:
+            text = text[:i]
+            break
+    return " ".join(text.split()).removesuffix("=>").strip()
+
+
+def _go_parameters(parameters: list[dict[str, Any]]) -> str:
+    if not parameters:
+        return ""
+    return "[" + ", ".join(
+        f"{p['name']} {p['constraint']}" if p.get("constraint") else p["name"]
+        for p in parameters
+    ) + "]"
+
+
+def _go_symbols(entity: Entity, module: str, name: str) -> list[Symbol]:
+    attrs: dict[str, Any] = entity.attrs
+    if entity.kind in ("function", "method"):
+        receiver: str = ""
+        if "receiver" in attrs:
+            if not attrs["receiver"][:1].isupper():
+                return []
+            receiver = f"({'*' if attrs.get('pointer_receiver') else ''}{attrs['receiver']}) "
+        signature: str = (
+            f"func {receiver}{entity.name}"
+            f"{_go_parameters(attrs.get('type_parameters', []))}{attrs.get('signature', '()')}"
+        )
+        return [Symbol("go", module, name, entity.kind, signature)]
+    if entity.kind != "type":
+        return []
+    parameters: str = _go_parameters(attrs.get("type_parameters", []))
+    if "fields" in attrs:
+        found: list[Symbol] = [
+            Symbol("go", module, name, "struct", f"type {entity.name}{parameters} struct"),
+        ]
+        found.extend(
+            Symbol("go", module, f"{name}.{f['name']}", "field", f"{f['name']} {f['type']}")
+            for f in attrs["fields"] if f["name"][:1].isupper()
+        )
+        found.extend(
+            Symbol("go", module, f"{name}.{embedded}", "field", embedded)
+            for embedded in attrs.get("embeds", [])
+            if embedded.rsplit(".", 1)[-1].lstrip("*")[:1].isupper()
+        )
+        return found
+    if "methods" in attrs:
+        found = [
+            Symbol("go", module, name, "interface", f"type {entity.name}{parameters} interface"),
+        ]
+        found.extend(
+            Symbol(
+                "go", module, f"{name}.{method}", "method", f"{method}{signature}",
+                abstract=True,
+            )
+            for method, signature in attrs["methods"].items() if method[:1].isupper()
+        )
+        found.extend(
+            Symbol("go", module, f"{name}.{embedded}", "embed", embedded, abstract=True)
+            for embedded in attrs.get("embeds", [])
+        )
+        return found
+    return []  # other types are compared as written, below
+
+
+def _visible(entity: Entity, parent: Entity | None) -> bool:
+    """Whether *entity* is part of the API, not counting its enclosing declarations."""
+    if entity.language == "java":
+        in_interface: bool = parent is not None and parent.kind == "interface"
+        return in_interface or "public" in (entity.attrs.get("visibility") or "").split()
+    return is_exported(entity, parent)
+
+
+def file_symbols(
+    file_result: FileResult, source: str | None, root: Path | None = None,
+) -> list[Symbol]:
+    """The exported symbols of one analyzed file; *source* is its text, for signatures."""
+    entities: list[Entity] = file_result.entities
+    if not entities or file_result.language not in API_LANGUAGES:
+        return []
+    language: str = file_result.language
+    path: str = file_result.path
+    if root is not None:
+        path = Path(os.path.relpath(path, root)).as_posix()
+    module: str = _module(path, language)
+    names: dict[int, str] = qualified_names(entities)
+    by_id: dict[int, Entity] = {e.id: e for e in entities}
+    encoded: bytes = source.encode() if source is not None else b""
+    visible: set[int] = {entities[0].id}
+    found: list[Symbol] = []
+    for entity in entities[1:]:
+        parent: Entity | None = by_id.get(entity.parent) if entity.parent is not None else None
+        if entity.parent not in visible or not _visible(entity, parent):
+            continue
+        visible.add(entity.id)
+        if entity.kind not in _SYMBOL_KINDS:
+            continue
+        if language == "go":
+            go_symbols: list[Symbol] = _go_symbols(entity, module, names[entity.id])
+            if go_symbols or entity.kind != "type":
+                found.extend(go_symbols)
+                continue
+        text: str = ""
+        if entity.start_byte is not None and entity.end_byte is not None:
+            text = encoded[entity.start_byte : entity.end_byte].decode("utf-8", errors="replace")
+        signature: str
+        if entity.kind in _WHOLE_KINDS and language != "java":
+            signature = " ".join(text.split())
+        elif entity.kind == "field":
+            signature = _header(text, "=;")
+        else:
+            signature = _header(text)
+        words: list[str] = signature.split("(", 1)[0].split()
+        abstract: bool = "abstract" in words or (
+            language == "java" and entity.kind == "method" and parent is not None
+            and parent.kind == "interface" and not {"default", "static"} & set(words)
+        )
+        found.append(Symbol(language, module, names[entity.id], entity.kind, signature, abstract))
+    return found
+
+
+def surface(files: Iterable[FileResult], root: Path | None = None) -> list[Symbol]:
+    """The exported symbols of analyzed *files*, sorted, with paths relative to *root*."""
+    found: list[Symbol] = []
+    for file_result in files:
+        source: tuple[bytes, FileEncoding] | None = read_source_utf8(Path(file_result.path))
+        text: str | None = source[0].decode("utf-8", errors="replace") if source else None
+        found.extend(file_symbols(file_result, text, root))
+    return sorted(found, key=lambda s: (s.key(), s.kind, s.signature))
+
+
+def analyze_surface(
+    paths: Iterable[str | os.PathLike[str]], options: Options, root: Path | None = None,
+) -> list[Symbol]:
+    """Analyze *paths* for their API languages only and list their exported symbols."""
+    languages: frozenset[str] = options.languages & API_LANGUAGES or API_LANGUAGES
+    return surface(iter_analyze(paths, dataclasses.replace(options, languages=languages)), root)
+
+
+def to_json(symbols: list[Symbol]) -> dict[str, Any]:
+    return {
+        "version": SURFACE_VERSION,
+        "symbols": [
+            {k: v for k, v in asdict(s).items() if k != "abstract" or v} for s in symbols
+        ],
+    }
+
+
+def load_surface(path: Path) -> list[Symbol]:
+    """Read a surface written by ``api -f json``."""
+    try:
+        data: Any = json.loads(path.read_text())
+    except (OSError, ValueError) as exc:
+        raise SurfaceError(f"cannot read API surface {path}: {exc}") from None
+    if not isinstance(data, dict) or data.get("version") != SURFACE_VERSION:
+        raise SurfaceError(f"{path} is not an API surface written by `autosg api -f json`")
+    try:
+        return [Symbol(**s) for s in data["symbols"]]
+    except (KeyError, TypeError) as exc:
+        raise SurfaceError(f"malformed API surface {path}: {exc}") from None
+
+
+# ---------------------------------------------------------------------------
+# Comparison
+# ---------------------------------------------------------------------------
+
+
+@dataclass
+class ApiChange:
+    """Symbols of one name added, removed, or changed between two surfaces."""
+
+    status: str  # "added", "removed", or "changed"
+    breaking: bool
+    language: str
+    module: str
+    name: str
+    old: list[Symbol] = field(default_factory=list)  # overloads share a name
+    new: list[Symbol] = field(default_factory=list)
+
+    def to_dict(self) -> dict[str, Any]:
+        return {
+            "status": self.status,
+            "breaking": self.breaking,
+            "language": self.language,
+            "module": self.module,
+            "name": self.name,
+            "old": [s.signature for s in self.old],
+            "new": [s.signature for s in self.new],
+        }
+
+
+@dataclass
+class ApiDiff:
+    changes: list[ApiChange] = field(default_factory=list)
+
+    @property
+    def breaking(self) -> list[ApiChange]:
+        return [c for c in self.changes if c.breaking]
+
+    def bump(self) -> str:
+        """The semantic version bump the changes call for."""
+        if self.breaking:
+            return "major"
+        return "minor" if self.changes else "patch"
+
+    def to_dict(self) -> dict[str, Any]:
+        return {"bump": self.bump(), "changes": [c.to_dict() for c in self.changes]}
+
+
+def diff_surfaces(old: list[Symbol], new: list[Symbol]) -> ApiDiff:
+    """Classify the changes from *old* to *new*."""
+    before: dict[tuple[str, str, str], list[Symbol]] = defaultdict(list)
+    after: dict[tuple[str, str, str], list[Symbol]] = defaultdict(list)
+    for symbol in old:
+        before[symbol.key()].append(symbol)
+    for symbol in new:
+        after[symbol.key()].append(symbol)
+    diff: ApiDiff = ApiDiff()
+    for key in sorted(before.keys() | after.keys()):
+        old_symbols: list[Symbol] = before.get(key, [])
+        new_symbols: list[Symbol] = after.get(key, [])
+        if set(old_symbols) == set(new_symbols):
+            continue
+        language, module, name = key
+        added: list[Symbol] = [s for s in new_symbols if s not in old_symbols]
+        container: tuple[str, str, str] = (language, module, name.rpartition(".")[0])
+        if not new_symbols and container in before and container not in after:
+            continue  # listed with the removed declaration around it
+        if not set(old_symbols) <= set(new_symbols):
+            status: str = "removed" if not new_symbols else "changed"
+            diff.changes.append(
+                ApiChange(status, True, language, module, name, old_symbols, new_symbols),
+            )
+            continue
+        # Only additions.  A new abstract member breaks the existing type's implementations.
+        breaking: bool = any(s.abstract for s in added) and container in before
+        diff.changes.append(
+            ApiChange("added", breaking, language, module, name, old_symbols, new_symbols),
+        )
+    return diff
+
+
+@contextlib.contextmanager
+def _side(spec: str, options: Options) -> Iterator[list[Symbol]]:
+    """The surface *spec* names: a stored surface, a directory, or a git revision."""
+    if spec.endswith(".json") and os.path.isfile(spec):
+        yield load_surface(Path(spec))
+        return
+    with materialize(spec) as root:
+        yield analyze_surface([root], options, root)
+
+
+def diff_api(old_spec: str, new_spec: str, options: Options | None = None) -> ApiDiff:
+    """Compare the API of two directories, git revisions, or stored surfaces.
+
+    Raises ``SurfaceError`` for an unreadable surface and ``DiffError``
+    for a side that is none of these.
+    """
+    options = options or Options()
+    with _side(old_spec, options) as old, _side(new_spec, options) as new:
+        return diff_surfaces(old, new)
+
+
+# ---------------------------------------------------------------------------
+# Rendering
+# ---------------------------------------------------------------------------
+
+
+def render_symbols(symbols: list[Symbol]) -> str:
+    """One line per symbol, grouped by module, members indented under their declaration."""
+    lines: list[str] = []
+    module: tuple[str, str] | None = None
+    for symbol in symbols:
+        if (symbol.language, symbol.module) != module:
+            module = (symbol.language, symbol.module)
+            lines.append(f"{symbol.module} ({symbol.language})")
+        lines.append(f"{'  ' * (symbol.name.count('.') + 1)}{symbol.signature}")
+    return "\n".join(lines) + "\n" if lines else ""
+
+
+_SIGILS: dict[str, str] = {"added": "+", "removed": "-", "changed": "~"}
+
+
+def _summary(diff: ApiDiff) -> str:
+    breaking: int = len(diff.breaking)
+    return (
+        f"{breaking} breaking, {len(diff.changes) - breaking} compatible change(s); "
+        f"suggested release: {diff.bump()}."
+    )
+
+
+def render_text(diff: ApiDiff) -> str:
+    """One line per change, ``+``/``-``/``~`` prefixed, breaking ones marked ``!``."""
+    lines: list[str] = []
+    for change in diff.changes:
+        mark: str = "!" if change.breaking else " "
+        lines.append(
+            f"{mark}{_SIGILS[change.status]} {change.name}  {change.module} ({change.language})",
+        )
+        for symbol in change.old:
+            if symbol not in change.new:
+                lines.append(f"     - {symbol.signature}")
+        for symbol in change.new:
+            if symbol not in change.old:
+                lines.append(f"     + {symbol.signature}")
+    lines.append(_summary(diff))
+    return "\n".join(lines) + "\n"
+
+
+def render_markdown(diff: ApiDiff) -> str:
+    """A summary suitable for posting as a pull request comment."""
+    if not diff.changes:
+        return "No public API changes; suggested release: patch.\n"
+    out: list[str] = ["### Public API changes", "", _summary(diff), ""]
+    for title, changes in (
+        ("Breaking", diff.breaking),
+        ("Compatible", [c for c in diff.changes if not c.breaking]),
+    ):
+        if not changes:
+            continue
+        out.append(f"**{title}** ({len(changes)})")
+        out.append("")
+        for change in changes:
+            out.append(f"- {change.status} `{change.name}` in `{change.module}`")
+            out.extend(f"  - was `{s.signature}`" for s in change.old if s not in change.new)
+            out.extend(f"  - now `{s.signature}`" for s in change.new if s not in change.old)
+        out.append("")
+    return "\n".join(out)
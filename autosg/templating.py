@@ -0,0 +1,128 @@
+"""Custom output through Jinja2 templates, for ``analyze -f template``.
+
+A template sees the whole result:
+
+- ``files``: one mapping per file, with ``path``, ``language``, ``root``
+  when several paths were analyzed, and its ``entities`` and ``errors``.
+- ``entities``: every entity, as ``-f json`` writes it, plus its
+  ``qualified_name`` (``Server.Start``).
+- ``edges``: every resolved edge, with ``kind``, ``source``, ``target``
+  (entity ids), and ``attrs``.
+- ``errors``: every parse error.
+
+Besides Jinja2's own filters (``selectattr``, ``groupby``, ``sort``,
+``join``, ...), templates can use:
+
+- ``where(key, value=true)``: the items whose ``key``, which may be
+  dotted (``attrs.visibility``), equals *value*, or is in it when *value*
+  is a list.
+- ``count_by(key)``: ``(value, count)`` pairs, most common first.
+- ``csv``: a list of values as one CSV row, quoted as needed.
+- ``json``: a value as JSON, unescaped (``tojson`` escapes it for HTML).
+- ``dirname`` and ``basename``: the parts of a path.
+- ``entity(id)``: the entity with that id, e.g. an edge's target.
+
+Blocks swallow the newline after them and the indentation before them,
+so a line-oriented report can put one ``{% for %}`` per line.  An
+undefined name is an error rather than an empty string.
+"""
+
+from __future__ import annotations
+
+import csv
+import dataclasses
+import io
+import json
+import os
+from collections import Counter
+from pathlib import Path
+from typing import Any, TextIO
+
+from .analysis import Analysis
+from .extracting import qualified_names
+
+
+class TemplateError(Exception):
+    """Raised when a template cannot be loaded or rendered."""
+
+
+def _lookup(item: Any, key: str) -> Any:
+    for part in key.split("."):
+        if isinstance(item, dict):
+            item = item.get(part)
+        else:
+            item = getattr(item, part, None)
+    return item
+
+
+def _where(items: Any, key: str, value: Any = True) -> list[Any]:
+    if isinstance(value, (list, tuple)):
+        return [item for item in items if _lookup(item, key) in value]
+    return [item for item in items if _lookup(item, key) == value]
+
+
+def _count_by(items: Any, key: str) -> list[tuple[Any, int]]:
+    counts: Counter[Any] = Counter(_lookup(item, key) for item in items)
+    return sorted(counts.items(), key=lambda pair: (-pair[1], str(pair[0])))
+
+
+def _csv(values: Any) -> str:
+    buffer: io.StringIO = io.StringIO()
+    csv.writer(buffer, lineterminator="").writerow(values)
+    return buffer.getvalue()
+
+
+def _json(value: Any) -> str:
+    return json.dumps(value, ensure_ascii=False)
+
+
+def _context(analysis: Analysis) -> dict[str, Any]:
+    files: list[dict[str, Any]] = []
+    entities: list[dict[str, Any]] = []
+    errors: list[dict[str, Any]] = []
+    for file_result in analysis:
+        names: dict[int, str] = qualified_names(file_result.entities)
+        records: list[dict[str, Any]] = [
+            {**dataclasses.asdict(e), "qualified_name": names.get(e.id, e.name)}
+            for e in file_result.entities
+        ]
+        file_errors: list[dict[str, Any]] = [dataclasses.asdict(e) for e in file_result.errors]
+        files.append({**file_result.to_dict(), "entities": records, "errors": file_errors})
+        entities.extend(records)
+        errors.extend(file_errors)
+    edges: list[dict[str, Any]] = [dataclasses.asdict(e) for e in analysis.edges]
+    return {"files": files, "entities": entities, "edges": edges, "errors": errors}
+
+
+def write_template(analysis: Analysis, out: TextIO, template: Path) -> None:
+    """Render *template* with the result of *analysis* to *out*.
+
+    ``{% include %}`` and ``{% import %}`` find templates next to it.
+    """
+    # Import lazily, as for config files.
+    import jinja2
+
+    env: jinja2.Environment = jinja2.Environment(
+        loader=jinja2.FileSystemLoader(template.parent),
+        undefined=jinja2.StrictUndefined,
+        trim_blocks=True,
+        lstrip_blocks=True,
+        keep_trailing_newline=True,
+    )
+    env.filters.update(
+        where=_where, count_by=_count_by, csv=_csv, json=_json,
+        dirname=os.path.dirname, basename=os.path.basename,
+    )
+    try:
+        compiled: jinja2.Template = env.get_template(template.name)
+    except jinja2.TemplateNotFound:
+        raise TemplateError(f"template {template} not found") from None
+    except jinja2.TemplateSyntaxError as exc:
+        raise TemplateError(f"{exc.filename or template}:{exc.lineno}: {exc.message}") from None
+    context: dict[str, Any] = _context(analysis)
+    by_id: dict[int, dict[str, Any]] = {e["id"]: e for e in context["entities"]}
+    try:
+        for chunk in compiled.generate(**context, entity=by_id.get):
+            out.write(chunk)
+    except jinja2.TemplateError as exc:
+        raise TemplateError(f"{template}: {exc}") from None
@@ -0,0 +1,317 @@
+"""Self-profiling: where autosg spends its time, as pprof profiles.
+
+A :class:`Profiler` samples the Python stacks of the threads doing
+autosg's work, :data:`DEFAULT_RATE` times a second, and writes them as a
+gzipped pprof profile, which ``go tool pprof`` and other pprof tools read
+and draw as flame graphs::
+
+    python -m autosg --trace analyze.pprof analyze -r src/ --edges calls -o out.json
+    go tool pprof -http=: analyze.pprof
+
+Work is marked with :func:`phase`: the command, walking the tree,
+extracting and annotating a file, writing the cache, linking, resolving
+edges, and writing output.  Each sample is labeled with the innermost
+phase as ``phase`` and with the labels of the phases around it, such as
+the ``language`` of the file and whether the ``cache`` had it, so
+``pprof -tags`` breaks the time down by them and ``-tagfocus
+language=go`` keeps one language's.  Only threads in a phase are sampled,
+which leaves out idle server threads.
+
+Files extracted by ``--jobs`` worker processes are not sampled.  Each
+adds one sample of its extraction time instead, under a ``worker``
+frame, so the profile still shows what the workers spent it on.  Samples
+count wall time, so with several workers the total can exceed the run's.
+"""
+
+from __future__ import annotations
+
+import contextlib
+import gzip
+import sys
+import threading
+import time
+from collections import Counter
+from collections.abc import Iterator
+from pathlib import Path
+from types import FrameType, TracebackType
+
+from .protowire import Field, encode
+
+DEFAULT_RATE: int = 100  # samples a second
+
+# Longest profile the serve and daemon endpoints take, in seconds.
+MAX_PROFILE_SECONDS: int = 600
+
+# Frames kept of each stack, from the innermost.
+_MAX_DEPTH: int = 128
+
+# ---------------------------------------------------------------------------
+# Phases
+# ---------------------------------------------------------------------------
+
+
+class _Phase:
+    """One phase a thread is in.  Samples keep it, so labels added later count."""
+
+    __slots__ = ("name", "labels")
+
+    def __init__(self, name: str, labels: dict[str, str]) -> None:
+        self.name: str = name
+        self.labels: dict[str, str] = labels
+
+
+# The phases each thread is in, innermost last, by thread id.
+_phases: dict[int, list[_Phase]] = {}
+
+_running: list[Profiler] = []
+
+
+@contextlib.contextmanager
+def phase(name: str, **labels: str) -> Iterator[dict[str, str]]:
+    """Mark the calling thread as in phase *name*.
+
+    Yields the phase's labels, for those the work only reveals as it goes
+    (a file's language); samples taken earlier in the phase get them too.
+    """
+    ident: int = threading.get_ident()
+    stack: list[_Phase] = _phases.setdefault(ident, [])
+    current: _Phase = _Phase(name, dict(labels))
+    stack.append(current)
+    try:
+        yield current.labels
+    finally:
+        stack.pop()
+        if not stack:
+            _phases.pop(ident, None)
+
+
+def record(name: str, seconds: float, **labels: str) -> None:
+    """Count *seconds* of work the sampler cannot see, such as a worker process's."""
+    for profiler in list(_running):
+        profiler.add(name, seconds, labels)
+
+
+def _labels(phases: tuple[_Phase, ...]) -> dict[str, str]:
+    labels: dict[str, str] = {}
+    for outer in phases:
+        labels.update(outer.labels)
+    labels["phase"] = phases[-1].name
+    return labels
+
+
+# ---------------------------------------------------------------------------
+# pprof encoding (github.com/google/pprof, proto/profile.proto)
+# ---------------------------------------------------------------------------
+
+_VALUE_TYPE: tuple[Field, ...] = (Field(1, "type", "int64"), Field(2, "unit", "int64"))
+_LABEL: tuple[Field, ...] = (Field(1, "key", "int64"), Field(2, "str", "int64"))
+_SAMPLE: tuple[Field, ...] = (
+    Field(1, "location_id", "int64", repeated=True),
+    Field(2, "value", "int64", repeated=True),
+    Field(3, "label", "message", repeated=True, message=_LABEL),
+)
+_LINE: tuple[Field, ...] = (Field(1, "function_id", "int64"), Field(2, "line", "int64"))
+_LOCATION: tuple[Field, ...] = (
+    Field(1, "id", "int64"), Field(4, "line", "message", repeated=True, message=_LINE),
+)
+_FUNCTION: tuple[Field, ...] = (
+    Field(1, "id", "int64"), Field(2, "name", "int64"), Field(3, "system_name", "int64"),
+    Field(4, "filename", "int64"), Field(5, "start_line", "int64"),
+)
+_PROFILE: tuple[Field, ...] = (
+    Field(1, "sample_type", "message", repeated=True, message=_VALUE_TYPE),
+    Field(2, "sample", "message", repeated=True, message=_SAMPLE),
+    Field(4, "location", "message", repeated=True, message=_LOCATION),
+    Field(5, "function", "message", repeated=True, message=_FUNCTION),
+    Field(6, "string_table", "string", repeated=True),
+    Field(9, "time_nanos", "int64"),
+    Field(10, "duration_nanos", "int64"),
+    Field(11, "period_type", "message", message=_VALUE_TYPE),
+    Field(12, "period", "int64"),
+    Field(13, "comment", "int64", repeated=True),
+)
+
+# (qualified name, file, first line, current line) of one frame
+_Frame = tuple[str, str, int, int]
+
+
+class _Builder:
+    """The string table, functions, and locations of a profile being encoded."""
+
+    def __init__(self) -> None:
+        self.strings: list[str] = [""]  # pprof requires "" first
+        self._string_ids: dict[str, int] = {"": 0}
+        self.functions: list[dict[str, int]] = []
+        self._function_ids: dict[tuple[str, str, int], int] = {}
+        self.locations: list[dict[str, object]] = []
+        self._location_ids: dict[_Frame, int] = {}
+
+    def string(self, text: str) -> int:
+        if text not in self._string_ids:
+            self._string_ids[text] = len(self.strings)
+            self.strings.append(text)
+        return self._string_ids[text]
+
+    def location(self, frame: _Frame) -> int:
+        if frame not in self._location_ids:
+            name, filename, start, line = frame
+            key: tuple[str, str, int] = (name, filename, start)
+            if key not in self._function_ids:
+                self._function_ids[key] = len(self.functions) + 1
+                self.functions.append({
+                    "id": self._function_ids[key], "name": self.string(name),
+                    "system_name": self.string(name), "filename": self.string(filename),
+                    "start_line": start,
+                })
+            self._location_ids[frame] = len(self.locations) + 1
+            self.locations.append({
+                "id": self._location_ids[frame],
+                "line": [{"function_id": self._function_ids[key], "line": line}],
+            })
+        return self._location_ids[frame]
+
+    def labels(self, labels: dict[str, str]) -> list[dict[str, int]]:
+        return [
+            {"key": self.string(key), "str": self.string(value)}
+            for key, value in sorted(labels.items())
+        ]
+
+
+# ---------------------------------------------------------------------------
+# Sampling
+# ---------------------------------------------------------------------------
+
+
+def _stack(frame: FrameType | None) -> tuple[_Frame, ...]:
+    """*frame* and its callers, innermost first, as pprof orders locations."""
+    frames: list[_Frame] = []
+    while frame is not None and len(frames) < _MAX_DEPTH:
+        code = frame.f_code
+        frames.append((
+            getattr(code, "co_qualname", code.co_name), code.co_filename,
+            code.co_firstlineno, frame.f_lineno or 0,
+        ))
+        frame = frame.f_back
+    return tuple(frames)
+
+
+class Profiler:
+    """Samples the threads in a phase until stopped; use as a context manager."""
+
+    def __init__(self, rate: int = DEFAULT_RATE, comments: tuple[str, ...] = ()) -> None:
+        self.interval: float = 1 / rate
+        self.comments: tuple[str, ...] = comments
+        self.samples: int = 0
+        self.seconds: float = 0.0  # how long it sampled, once stopped
+        self._counts: Counter[tuple[tuple[_Frame, ...], tuple[_Phase, ...]]] = Counter()
+        self._recorded: Counter[tuple[str, tuple[tuple[str, str], ...]]] = Counter()  # ns
+        self._lock: threading.Lock = threading.Lock()
+        self._stop: threading.Event = threading.Event()
+        self._thread: threading.Thread | None = None
+        self._started_ns: int = 0
+        self._started: float = 0.0
+
+    def start(self) -> None:
+        self._started_ns = time.time_ns()
+        self._started = time.perf_counter()
+        _running.append(self)
+        self._thread = threading.Thread(target=self._run, name="autosg-profiler", daemon=True)
+        self._thread.start()
+
+    def stop(self) -> None:
+        self._stop.set()
+        if self._thread is not None:
+            self._thread.join()
+        if self in _running:
+            _running.remove(self)
+        self.seconds = time.perf_counter() - self._started
+
+    def __enter__(self) -> Profiler:
+        self.start()
+        return self
+
+    def __exit__(
+        self, _type: type[BaseException] | None, _value: BaseException | None,
+        _traceback: TracebackType | None,
+    ) -> None:
+        self.stop()
+
+    def _run(self) -> None:
+        me: int = threading.get_ident()
+        while not self._stop.wait(self.interval):
+            frames: dict[int, FrameType] = sys._current_frames()
+            for ident, phases in list(_phases.items()):
+                frame: FrameType | None = frames.get(ident)
+                if ident == me or frame is None or not phases:
+                    continue
+                with self._lock:
+                    self._counts[(_stack(frame), tuple(phases))] += 1
+                    self.samples += 1
+
+    def add(self, name: str, seconds: float, labels: dict[str, str]) -> None:
+        """Count *seconds* of unsampled work in phase *name*, labeled *labels*."""
+        with self._lock:
+            self._recorded[(name, tuple(sorted(labels.items())))] += int(seconds * 1e9)
+
+    def breakdown(self) -> Counter[str]:
+        """Seconds by phase and language, e.g. ``extract go``, most first."""
+        period: float = self.interval
+        seconds: Counter[str] = Counter()
+        with self._lock:
+            for (_stack_, phases), count in self._counts.items():
+                labels: dict[str, str] = _labels(phases)
+                seconds[" ".join(filter(None, (labels["phase"], labels.get("language"))))] += (
+                    count * period
+                )
+            for (name, pairs), nanoseconds in self._recorded.items():
+                language: str | None = dict(pairs).get("language")
+                seconds[" ".join(filter(None, ("worker", name, language)))] += nanoseconds / 1e9
+        return seconds
+
+    def profile(self) -> bytes:
+        """What was sampled, as a gzipped pprof profile."""
+        builder: _Builder = _Builder()
+        period: int = int(self.interval * 1e9)
+        samples: list[dict[str, object]] = []
+        with self._lock:
+            for (stack, phases), count in self._counts.items():
+                samples.append({
+                    "location_id": [builder.location(frame) for frame in stack],
+                    "value": [count * period],
+                    "label": builder.labels(_labels(phases)),
+                })
+            for (name, pairs), nanoseconds in self._recorded.items():
+                samples.append({
+                    "location_id": [
+                        builder.location((name, "<worker>", 0, 0)),
+                        builder.location(("worker", "<worker>", 0, 0)),
+                    ],
+                    "value": [nanoseconds],
+                    "label": builder.labels({**dict(pairs), "phase": name}),
+                })
+        wall: dict[str, int] = {
+            "type": builder.string("wall"), "unit": builder.string("nanoseconds"),
+        }
+        comments: list[int] = [builder.string(comment) for comment in self.comments]
+        return gzip.compress(encode(_PROFILE, {
+            "sample_type": [wall],
+            "sample": samples,
+            "location": builder.locations,
+            "function": builder.functions,
+            "string_table": builder.strings,
+            "time_nanos": self._started_ns,
+            "duration_nanos": int(self.seconds * 1e9),
+            "period_type": wall,
+            "period": period,
+            "comment": comments,
+        }))
+
+    def write(self, path: Path) -> None:
+        path.write_bytes(self.profile())
+
+
+def sample_for(seconds: float, rate: int = DEFAULT_RATE) -> bytes:
+    """A profile of what this process's threads do over the next *seconds*."""
+    with Profiler(rate) as profiler:
+        time.sleep(seconds)
+    return profiler.profile()
@@ -0,0 +1,309 @@
+"""Expansion of command-line paths into the source files to process.
+
+Directory traversal honours ``.gitignore`` files (including those in parent
+directories up to the repository root) and optional include/exclude globs.
+Paths named explicitly on the command line are always processed.
+
+Symbolic links to directories are only walked with ``follow_symlinks``,
+and then not when they lead back into the tree walked or a directory
+above, which would loop.  Links to files in the tree are skipped, since
+the file is found under its own path.  A file reachable through several
+links, hard or symbolic, is processed once, under the first path found.
+"""
+
+from __future__ import annotations
+
+import logging
+import os
+import re
+from collections.abc import Iterable, Iterator
+from dataclasses import dataclass
+from pathlib import Path
+
+from . import components, embedding, idl, infrastructure, manifests, notebooks, plugins, zig
+from .annotating import long_path
+from .parsing import detect_language
+
+logger: logging.Logger = logging.getLogger(__name__)
+
+ANNOTATED_SUFFIX: str = ".annotated"
+
+# Never descend into these, whatever the ignore rules say.
+ALWAYS_SKIPPED_DIRS: frozenset[str] = frozenset({".git", ".autosg"})
+
+
+@dataclass(frozen=True)
+class WalkOptions:
+    """Which files directory traversal should yield."""
+
+    recursive: bool = True
+    gitignore: bool = True  # honour .gitignore files
+    include: tuple[str, ...] = ()  # if set, files must match one of these globs
+    exclude: tuple[str, ...] = ()  # files and directories matching these are skipped
+    languages: frozenset[str] = frozenset()  # if set, only files in these languages
+    follow_symlinks: bool = False  # walk symbolic links to directories
+
+
+# ---------------------------------------------------------------------------
+# Glob patterns
+# ---------------------------------------------------------------------------
+
+
+def glob_to_regex(pattern: str) -> re.Pattern[str]:
+    """Compile a gitignore-style glob to a regex over ``/``-separated paths.
+
+    ``*`` and ``?`` never cross a ``/``; ``**`` matches any number of
+    directories.  Patterns without a ``/`` match at any depth, so ``*.go``
+    behaves like ``**/*.go``.  A leading ``/`` anchors the pattern.
+    """
+    anchored: bool = "/" in pattern.rstrip("/")
+    pattern = pattern.lstrip("/")
+    parts: list[str] = [] if anchored else ["(?:.*/)?"]
+    i: int = 0
+    while i < len(pattern):
+        char: str = pattern[i]
+        if pattern.startswith("**/", i):
+            parts.append("(?:.*/)?")
+            i += 3
+            continue
+        if pattern.startswith("**", i):
+            parts.append(".*")
+            i += 2
+            continue
+        if char == "*":
+            parts.append("[^/]*")
+        elif char == "?":
+            parts.append("[^/]")
+        elif char == "[":
+            end: int = pattern.find("]", i + 1)
+            if end == -1:
+                parts.append(re.escape(char))
+            else:
+                body: str = pattern[i + 1 : end]
+                if body.startswith("!"):
+                    body = "^" + body[1:]
+                parts.append(f"[{body}]")
+                i = end
+        elif char == "\\" and i + 1 < len(pattern):
+            i += 1
+            parts.append(re.escape(pattern[i]))
+        else:
+            parts.append(re.escape(char))
+        i += 1
+    return re.compile("".join(parts) + "$")
+
+
+def _matches_any(rel_path: str, patterns: list[re.Pattern[str]]) -> bool:
+    return any(p.match(rel_path) for p in patterns)
+
+
+# ---------------------------------------------------------------------------
+# .gitignore
+# ---------------------------------------------------------------------------
+
+
+@dataclass(frozen=True)
+class _IgnoreRule:
+    base: Path  # directory containing the .gitignore
+    regex: re.Pattern[str]
+    negate: bool
+    dir_only: bool
+
+
+def _read_gitignore(directory: Path) -> list[_IgnoreRule]:
+    """Parse ``directory/.gitignore`` if it exists."""
+    path: Path = directory / ".gitignore"
+    if not path.is_file():
+        return []
+    base: Path = directory.resolve()
+    rules: list[_IgnoreRule] = []
+    for line in path.read_text(errors="replace").splitlines():
+        if not line.strip() or line.startswith("#"):
+            continue
+        if not line.endswith("\\ "):
+            line = line.rstrip()
+        negate: bool = line.startswith("!")
+        if negate:
+            line = line[1:]
+        if line.startswith("\\"):
+            line = line[1:]  # escaped leading "#" or "!"
+        dir_only: bool = line.endswith("/")
+        rules.append(_IgnoreRule(base, glob_to_regex(line.rstrip("/")), negate, dir_only))
+    return rules
+
+
+def _parent_gitignores(directory: Path) -> list[_IgnoreRule]:
+    """Rules from .gitignore files above *directory*, up to the repo root."""
+    directory = directory.resolve()
+    chain: list[Path] = []
+    for parent in directory.parents:
+        chain.append(parent)
+        if (parent / ".git").exists():
+            break
+    else:
+        return []  # not inside a git repository
+    rules: list[_IgnoreRule] = []
+    for parent in reversed(chain):
+        rules.extend(_read_gitignore(parent))
+    return rules
+
+
+def _is_ignored(path: Path, is_dir: bool, rules: list[_IgnoreRule]) -> bool:
+    """Apply gitignore rules in order; the last matching rule wins."""
+    ignored: bool = False
+    resolved: Path = path.resolve()
+    for rule in rules:
+        if rule.dir_only and not is_dir:
+            continue
+        try:
+            rel: str = resolved.relative_to(rule.base).as_posix()
+        except ValueError:
+            continue
+        if rule.regex.match(rel):
+            ignored = not rule.negate
+    return ignored
+
+
+# ---------------------------------------------------------------------------
+# Traversal
+# ---------------------------------------------------------------------------
+
+
+def _language(path: Path) -> str | None:
+    """Language of *path*, counting plugin files and those read without tree-sitter."""
+    plugin: plugins.Plugin | None = plugins.plugin_for(path)
+    if plugin is not None:
+        return plugin.name
+    return (
+        infrastructure.infrastructure_language(path) or detect_language(path)
+        or idl.idl_language(path) or zig.zig_language(path)
+        or components.component_language(path) or embedding.template_language(path)
+        or notebooks.notebook_language(path)
+    )
+
+
+def _in_languages(path: Path, languages: frozenset[str]) -> bool:
+    """Whether *path* is in *languages*, or a manifest declaring dependencies for one."""
+    return _language(path) in languages or not manifests.manifest_languages(path).isdisjoint(
+        languages,
+    )
+
+
+def file_identity(path: Path) -> tuple[int, int] | str:
+    """What *path* is: its device and inode, which every link to it shares.
+
+    File systems without inode numbers fall back on the normalized path.
+    """
+    try:
+        stat: os.stat_result = os.stat(long_path(path))
+    except OSError:
+        return os.path.normcase(os.path.abspath(path))
+    if not stat.st_ino:
+        return os.path.normcase(os.path.abspath(path))
+    return stat.st_dev, stat.st_ino
+
+
+def _skip_link(path: Path, reason: str, message: str) -> None:
+    logger.info("%s %s, skipping.", path, message, extra={
+        "fields": {"event": "skipped", "path": str(path), "reason": reason},
+    })
+
+
+def _walk_dir(root: Path, options: WalkOptions) -> Iterator[Path]:
+    """Yield the files under *root* that pass the ignore rules and globs."""
+    includes: list[re.Pattern[str]] = [glob_to_regex(p) for p in options.include]
+    excludes: list[re.Pattern[str]] = [glob_to_regex(p) for p in options.exclude]
+    inherited: list[_IgnoreRule] = _parent_gitignores(root) if options.gitignore else []
+    rules_by_dir: dict[Path, list[_IgnoreRule]] = {}
+    real_root: Path = root.resolve()
+    # Directories walked so far, among them every one above the current.
+    walked: set[tuple[int, int] | str] = set()
+
+    for dirpath, dirnames, filenames in os.walk(root, followlinks=options.follow_symlinks):
+        directory: Path = Path(dirpath)
+        walked.add(file_identity(directory))
+        parent_rules: list[_IgnoreRule] = rules_by_dir.get(directory.parent, inherited)
+        rules: list[_IgnoreRule] = parent_rules
+        if options.gitignore:
+            rules = parent_rules + _read_gitignore(directory)
+        rules_by_dir[directory] = rules
+
+        kept: list[str] = []
+        for name in dirnames:
+            sub: Path = directory / name
+            rel: str = sub.relative_to(root).as_posix()
+            if name in ALWAYS_SKIPPED_DIRS:
+                continue
+            if _is_ignored(sub, True, rules):
+                continue
+            if _matches_any(rel, excludes) or _matches_any(rel + "/", excludes):
+                continue
+            if sub.is_symlink():
+                if not options.follow_symlinks:
+                    continue
+                target: Path = sub.resolve()
+                if target.is_relative_to(real_root) or file_identity(target) in walked:
+                    _skip_link(sub, "symlink-loop", f"links to {target}, which is walked already")
+                    continue
+            kept.append(name)
+        dirnames[:] = kept if options.recursive else []
+
+        for name in filenames:
+            file_path: Path = directory / name
+            rel = file_path.relative_to(root).as_posix()
+            if not long_path(file_path).is_file():
+                continue
+            if file_path.is_symlink() and file_path.resolve().is_relative_to(real_root):
+                continue  # found under its own path
+            if _is_ignored(file_path, False, rules):
+                continue
+            if _matches_any(rel, excludes):
+                continue
+            if includes and not _matches_any(rel, includes):
+                continue
+            if options.languages and not _in_languages(file_path, options.languages):
+                continue
+            yield file_path
+
+
+def resolve_paths(
+    paths: Iterable[Path], options: WalkOptions = WalkOptions(),
+) -> Iterator[Path]:
+    """Expand directories into individual file paths, in sorted order.
+
+    A file found again, under another path given or spelled differently
+    (``src\\a.go`` and ``src/a.go``, or another case on Windows), or through
+    another link, is yielded only the first time.
+    """
+    seen: dict[tuple[int, int] | str, Path] = {}
+
+    def first(path: Path) -> bool:
+        identity: tuple[int, int] | str = file_identity(path)
+        if identity in seen:
+            if os.path.normcase(os.path.abspath(path)) != os.path.normcase(
+                os.path.abspath(seen[identity]),
+            ):
+                _skip_link(path, "duplicate", f"is the same file as {seen[identity]}")
+            return False
+        seen[identity] = path
+        return True
+
+    for path in paths:
+        if path.is_file():
+            if first(path):
+                yield path
+        elif path.is_dir():
+            yield from (p for p in sorted(_walk_dir(path, options)) if first(p))
+        else:
+            logger.warning("%s is not a file or directory, skipping.", path, extra={
+                "fields": {"event": "skipped", "path": str(path), "reason": "not-a-file"},
+            })
+
+
+def resolve_source_paths(
+    paths: Iterable[Path], options: WalkOptions = WalkOptions(),
+) -> Iterator[Path]:
+    """Like resolve_paths but skips .annotated files."""
+    for path in resolve_paths(paths, options):
+        if not path.name.endswith(ANNOTATED_SUFFIX):
+            yield path
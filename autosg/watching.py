@@ -0,0 +1,57 @@
+"""Polling file watcher used by ``--watch``.
+
+Polling keeps autosg free of native file-notification dependencies and
+behaves the same on every platform.  Files are compared by modification
+time and size, which is cheap enough for trees with thousands of files.
+"""
+
+from __future__ import annotations
+
+import time
+from collections.abc import Callable, Iterable
+from pathlib import Path
+
+DEFAULT_INTERVAL: float = 0.5
+
+# (mtime_ns, size) — a change in either counts as a modification.
+_Stamp = tuple[int, int]
+
+
+def _snapshot(files: Iterable[Path]) -> dict[Path, _Stamp]:
+    """Stat every file, silently dropping files that vanish mid-scan."""
+    stamps: dict[Path, _Stamp] = {}
+    for path in files:
+        try:
+            st = path.stat()
+        except OSError:
+            continue
+        stamps[path] = (st.st_mtime_ns, st.st_size)
+    return stamps
+
+
+def watch(
+    list_files: Callable[[], Iterable[Path]],
+    on_change: Callable[[list[Path], list[Path]], None],
+    interval: float = DEFAULT_INTERVAL,
+) -> None:
+    """Poll the files produced by *list_files* until interrupted.
+
+    *on_change* is called with ``(changed, removed)`` whenever at least one
+    file was added, modified, or deleted since the previous poll.  The
+    initial state is taken as the baseline, so callers should process all
+    files once before watching.  Returns on ``KeyboardInterrupt``.
+    """
+    previous: dict[Path, _Stamp] = _snapshot(list_files())
+    try:
+        while True:
+            time.sleep(interval)
+            current: dict[Path, _Stamp] = _snapshot(list_files())
+            changed: list[Path] = sorted(
+                p for p, stamp in current.items() if previous.get(p) != stamp
+            )
+            removed: list[Path] = sorted(p for p in previous if p not in current)
+            previous = current
+            if changed or removed:
+                on_change(changed, removed)
+    except KeyboardInterrupt:
+        pass
@@ -0,0 +1,363 @@
+"""Zig source files: functions, containers, and comptime declarations.
+
+The bundled grammar set has no Zig parser, so ``.zig`` files are read
+token by token.  The declarations of the file and of the container types
+in it become entities; function bodies are not looked into.
+
+- ``fn`` declarations are ``function`` entities, or ``method`` inside a
+  container type.  They record their ``parameters`` as written, the names
+  of the ``comptime`` ones in ``comptime_params``, and what they
+  ``returns``; ``extern fn`` prototypes are marked ``"declaration": true``.
+- ``const Name = struct { ... }`` and its ``union``, ``enum``, and
+  ``opaque`` siblings are ``struct``, ``union``, ``enum``, and ``type``
+  entities.  Structs and unions list their ``fields`` with ``name``,
+  ``type``, and ``default``, enums their ``values``; ``packed`` and
+  ``extern`` layouts are kept in ``layout``.  Error sets
+  (``error{ ... }``) are enums marked ``"error_set": true``.
+- ``const std = @import("std")`` is an ``import`` of ``std``, with the
+  name it is bound to as ``alias``.
+- Other ``const`` and ``var`` declarations are ``constant`` and
+  ``variable`` entities with their declared ``type``; a value computed
+  with ``comptime`` is marked ``"comptime": true``.
+- ``comptime { ... }`` blocks are ``comptime`` entities and ``test
+  "name" { ... }`` blocks ``test`` entities.
+
+``pub`` is recorded as ``visibility``, the ``export``, ``extern``,
+``inline``, and ``threadlocal`` modifiers become boolean attrs (with the
+``library`` of ``extern "c"``), and ``///`` comments above a declaration
+are kept in ``doc``.
+"""
+
+from __future__ import annotations
+
+import bisect
+import re
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Any
+
+from .extracting import Entity, ParseError, assign_uids, file_entity
+from .parsing import byte_col_to_char_col
+
+ZIG_EXTENSIONS: dict[str, str] = {".zig": "zig"}
+
+
+def zig_language(path: Path) -> str | None:
+    return ZIG_EXTENSIONS.get(path.suffix)
+
+
+# ---------------------------------------------------------------------------
+# Tokens
+# ---------------------------------------------------------------------------
+
+# A stray non-ASCII character is one punct token, not one per UTF-8 byte.
+_TOKEN_RE: re.Pattern[bytes] = re.compile(rb"""
+    (?P<space>\s+)
+  | (?P<doc>///(?!/)[^\n]*)
+  | (?P<comment>//[^\n]*)
+  | (?P<string>\\\\[^\n]*|"(?:[^"\\\n]|\\.)*"?|'(?:[^'\\\n]|\\.)*'?)
+  | (?P<word>@"(?:[^"\\\n]|\\.)*"|@?[A-Za-z_]\w*)
+  | (?P<number>\d\w*(?:\.\d\w*)?)
+  | (?P<punct>[\xc0-\xf7][\x80-\xbf]*|.)
+""", re.VERBOSE | re.DOTALL)
+
+# Modifiers that may come before a declaration, and the ones kept as attrs.
+_MODIFIERS: frozenset[str] = frozenset(
+    {"export", "extern", "inline", "noinline", "pub", "threadlocal"},
+)
+_FLAG_MODIFIERS: frozenset[str] = frozenset({"export", "extern", "inline", "threadlocal"})
+
+_CONTAINER_KINDS: dict[str, str] = {
+    "enum": "enum", "opaque": "type", "struct": "struct", "union": "union",
+}
+
+_OPENERS: dict[str, str] = {"(": ")", "[": "]", "{": "}"}
+
+
+@dataclass(frozen=True)
+class _Token:
+    kind: str  # "doc", "string", "word", "number", or "punct"
+    text: str
+    start: int  # byte offsets into the file
+    end: int
+
+
+def _tokens(source_utf8: bytes) -> list[_Token]:
+    tokens: list[_Token] = []
+    for match in _TOKEN_RE.finditer(source_utf8):
+        kind: str = match.lastgroup or "punct"
+        if kind not in ("space", "comment"):
+            tokens.append(_Token(
+                kind, match.group().decode("utf-8", errors="replace"), match.start(), match.end(),
+            ))
+    return tokens
+
+
+def _identifier(token: _Token) -> str:
+    """The name of an identifier token: ``@"a b"`` is ``a b``."""
+    return token.text[2:-1] if token.text.startswith('@"') else token.text
+
+
+def _unquote(text: str) -> str:
+    return text[1:-1] if len(text) >= 2 and text[0] == text[-1] == '"' else text
+
+
+# ---------------------------------------------------------------------------
+# Reader
+# ---------------------------------------------------------------------------
+
+
+class _Reader:
+    """Entities of one Zig file, read from its tokens and bracket pairs."""
+
+    def __init__(self, source_utf8: bytes, path: str) -> None:
+        self.source: bytes = source_utf8
+        self.path: str = path
+        self.tokens: list[_Token] = _tokens(source_utf8)
+        self.line_starts: list[int] = [0] + [
+            m.end() for m in re.finditer(rb"\n", source_utf8)
+        ]
+        self.entities: list[Entity] = [file_entity(source_utf8, "zig", path, 0)]
+        self.errors: list[ParseError] = []
+        self.closing: dict[int, int] = self._pair_brackets()
+
+    def _pair_brackets(self) -> dict[int, int]:
+        """Index of the closing bracket of each opening one that has it."""
+        closing: dict[int, int] = {}
+        stack: list[int] = []
+        for i, token in enumerate(self.tokens):
+            if token.kind == "string" and token.text[0] in "\"'" and (
+                len(token.text) < 2 or token.text[-1] != token.text[0]
+            ):
+                self.error("unterminated string", token)
+            elif token.text in _OPENERS:
+                stack.append(i)
+            elif token.text in (")", "]", "}"):
+                while stack and _OPENERS[self.tokens[stack[-1]].text] != token.text:
+                    self.error(f"unclosed {self.tokens[stack.pop()].text!r}", self.tokens[i])
+                if stack:
+                    closing[stack.pop()] = i
+                else:
+                    self.error(f"unmatched {token.text!r}", token)
+        for i in stack:
+            self.error(f"unclosed {self.tokens[i].text!r}", self.tokens[i])
+        return closing
+
+    def position(self, offset: int) -> tuple[int, int]:
+        row: int = bisect.bisect_right(self.line_starts, offset) - 1
+        line: bytes = self.source[self.line_starts[row] : offset]
+        return row + 1, byte_col_to_char_col(line, len(line) + 1)
+
+    def error(self, message: str, token: _Token) -> None:
+        row, col = self.position(token.start)
+        end_row, end_col = self.position(token.end)
+        self.errors.append(ParseError(self.path, "syntax", message, row, col, end_row, end_col))
+
+    def text(self, first: int, last: int) -> str:
+        """Tokens *first* through *last* as written, with whitespace collapsed."""
+        if last < first:
+            return ""
+        raw: bytes = self.source[self.tokens[first].start : self.tokens[last].end]
+        return " ".join(raw.decode("utf-8", errors="replace").split())
+
+    def at(self, i: int, *texts: str) -> bool:
+        return i < len(self.tokens) and self.tokens[i].text in texts
+
+    def skip(self, i: int) -> int:
+        """The index after token *i*, or after the group it opens."""
+        return self.closing.get(i, i) + 1
+
+    def until(self, i: int, stop: int, *texts: str) -> int:
+        """The first token from *i* that is one of *texts*, outside brackets, else *stop*."""
+        while i < stop and self.tokens[i].text not in texts:
+            i = self.skip(i)
+        return min(i, stop)
+
+    def add(
+        self, kind: str, name: str, first: int, last: int, parent: int, attrs: dict[str, Any],
+    ) -> Entity:
+        start: _Token = self.tokens[first]
+        end: _Token = self.tokens[min(last, len(self.tokens) - 1)]
+        row, col = self.position(start.start)
+        end_row, end_col = self.position(end.end)
+        entity: Entity = Entity(
+            id=len(self.entities), kind=kind, name=name, path=self.path, language="zig",
+            row=row, col=col, end_row=end_row, end_col=end_col, parent=parent, attrs=attrs,
+            start_byte=start.start, end_byte=end.end,
+        )
+        self.entities.append(entity)
+        return entity
+
+    # -- declarations --------------------------------------------------------
+
+    def container(self, i: int, stop: int, parent: Entity | None) -> None:
+        """Read the declarations and fields from token *i* up to *stop*."""
+        kind: str = parent.kind if parent is not None else "file"
+        parent_id: int = parent.id if parent is not None else 0
+        fields: list[dict[str, Any]] = []
+        values: list[str] = []
+        while i < stop:
+            docs: list[str] = []
+            while i < stop and self.tokens[i].kind == "doc":
+                docs.append(re.sub(r"^/// ?", "", self.tokens[i].text).rstrip())
+                i += 1
+            if i >= stop:
+                break
+            first: int = i
+            attrs: dict[str, Any] = {}
+            while self.at(i, *_MODIFIERS) or (self.at(i, "comptime") and self.at(i + 1, "var")):
+                word: str = self.tokens[i].text
+                if word == "pub":
+                    attrs["visibility"] = "pub"
+                elif word in _FLAG_MODIFIERS or word == "comptime":
+                    attrs[word] = True
+                i += 1
+                if word == "extern" and i < stop and self.tokens[i].kind == "string":
+                    attrs["library"] = _unquote(self.tokens[i].text)  # extern "c"
+                    i += 1
+            if docs:
+                attrs["doc"] = "\n".join(docs).strip()
+            token: _Token | None = self.tokens[i] if i < stop else None
+            if token is None:
+                break
+            if token.text == "fn":
+                i = self.function(i, stop, first, kind, parent_id, attrs)
+            elif token.text in ("const", "var"):
+                i = self.declaration(i, stop, first, parent_id, attrs)
+            elif token.text in ("comptime", "test") and (
+                self.at(i + 1, "{") or self.at(i + 2, "{")
+            ):
+                body: int = i + 1 if self.at(i + 1, "{") else i + 2
+                name: str = token.text if body == i + 1 else _unquote(
+                    _identifier(self.tokens[i + 1]),
+                )
+                last: int = self.closing.get(body, stop - 1)
+                self.add(token.text, name, first, last, parent_id, attrs)
+                i = last + 1
+            elif token.text == "usingnamespace":
+                i = self.until(i, stop, ";") + 1
+            elif token.kind == "word" and kind in ("struct", "union") and self.at(i + 1, ":"):
+                end: int = self.until(i + 2, stop, ",")
+                default: int = self.until(i + 2, end, "=")
+                field: dict[str, Any] = {
+                    "name": _identifier(token), "type": self.text(i + 2, default - 1),
+                }
+                if default < end:
+                    field["default"] = self.text(default + 1, end - 1)
+                fields.append(field)
+                i = end + 1
+            elif token.kind == "word" and kind in ("enum", "union") and (
+                i + 1 >= stop or self.at(i + 1, ",", "=")
+            ):
+                if kind == "enum":
+                    values.append(_identifier(token))
+                else:
+                    fields.append({"name": _identifier(token)})  # a void field of union(enum)
+                i = self.until(i, stop, ",") + 1
+            else:
+                i = self.skip(i)
+        if parent is not None and fields:
+            parent.attrs["fields"] = fields
+        if parent is not None and values:
+            parent.attrs["values"] = values
+
+    def function(
+        self, i: int, stop: int, first: int, container: str, parent: int, attrs: dict[str, Any],
+    ) -> int:
+        """Read ``fn name(...) T { ... }`` at *i*; returns the index after it."""
+        if i + 2 >= stop or self.tokens[i + 1].kind != "word" or not self.at(i + 2, "("):
+            return i + 1  # a function type: const F = fn (u8) void;
+        name: str = _identifier(self.tokens[i + 1])
+        close: int = self.closing.get(i + 2, stop - 1)
+        parameters: list[str] = []
+        comptime: list[str] = []
+        j: int = i + 3
+        while j < close:
+            end: int = self.until(j, close, ",")
+            if end > j:
+                parameters.append(self.text(j, end - 1))
+                if self.at(j, "comptime") and j + 1 < end:
+                    comptime.append(_identifier(self.tokens[j + 1]))
+            j = end + 1
+        j = close + 1
+        while j < stop and not self.at(j, ";"):
+            # error{A, B}!T and anonymous struct return types open braces of their own.
+            if self.at(j, "{") and not self.at(j - 1, "error", *_CONTAINER_KINDS):
+                break
+            j = self.skip(j)
+        attrs["parameters"] = parameters
+        if comptime:
+            attrs["comptime_params"] = comptime
+        returns: str = self.text(close + 1, j - 1)
+        if returns:
+            attrs["returns"] = returns
+        last: int
+        if self.at(j, "{"):
+            last = self.closing.get(j, stop - 1)
+        else:
+            attrs["declaration"] = True
+            last = min(j, stop - 1)
+        kind: str = "method" if container in _CONTAINER_KINDS.values() else "function"
+        self.add(kind, name, first, last, parent, attrs)
+        return last + 1
+
+    def declaration(
+        self, i: int, stop: int, first: int, parent: int, attrs: dict[str, Any],
+    ) -> int:
+        """Read ``const name: T = value;`` at *i*; returns the index after it."""
+        if i + 1 >= stop or self.tokens[i + 1].kind != "word":
+            return i + 1
+        keyword: str = self.tokens[i].text
+        name: str = _identifier(self.tokens[i + 1])
+        end: int = self.until(i + 2, stop, ";")
+        value: int = self.until(i + 2, end, "=")
+        if self.at(i + 2, ":"):
+            attrs["type"] = self.text(i + 3, value - 1)
+        v: int = value + 1
+        if self.at(v, "extern", "packed"):
+            attrs["layout"] = self.tokens[v].text
+            v += 1
+        if self.at(v, *_CONTAINER_KINDS) and v < end:
+            brace: int = self.skip(v + 1) if self.at(v + 1, "(") else v + 1
+            if self.at(brace, "{"):
+                if brace > v + 1:
+                    attrs["tag"] = self.text(v + 2, brace - 2)  # enum(u8), union(enum)
+                entity: Entity = self.add(
+                    _CONTAINER_KINDS[self.tokens[v].text], name, first, end, parent, attrs,
+                )
+                self.container(brace + 1, self.closing.get(brace, end), entity)
+                return end + 1
+        if self.at(v, "error") and self.at(v + 1, "{"):
+            close: int = self.closing.get(v + 1, end)
+            attrs["error_set"] = True
+            attrs["values"] = [
+                _identifier(t) for t in self.tokens[v + 2 : close] if t.kind == "word"
+            ]
+            self.add("enum", name, first, end, parent, attrs)
+            return end + 1
+        if (
+            self.at(v, "@import") and self.at(v + 1, "(") and self.at(v + 3, ")")
+            and self.tokens[v + 2].kind == "string"
+        ):
+            attrs["alias"] = name
+            if v + 4 < end and self.at(v + 4, "."):  # const print = @import("std").debug.print;
+                attrs["member"] = self.text(v + 5, end - 1)
+            self.add("import", _unquote(self.tokens[v + 2].text), first, end, parent, attrs)
+            return end + 1
+        attrs.pop("layout", None)
+        if self.at(v, "comptime"):
+            attrs["comptime"] = True
+        self.add("constant" if keyword == "const" else "variable", name, first, end, parent, attrs)
+        return end + 1
+
+
+def zig_entities(source_utf8: bytes, path: str) -> tuple[list[Entity], list[ParseError]]:
+    """The entities of a Zig file and its syntax errors.
+
+    Errors are strings left open at the end of a line and brackets that do
+    not pair up; the declarations around them are still read.
+    """
+    reader: _Reader = _Reader(source_utf8, path)
+    reader.container(0, len(reader.tokens), None)
+    assign_uids(reader.entities)
+    return reader.entities, reader.errors
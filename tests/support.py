@@ -0,0 +1,63 @@
+"""Helpers shared by the tests: running the CLI in a scratch directory."""
+
+from __future__ import annotations
+
+import json
+import os
+import tempfile
+import unittest
+from collections.abc import Callable
+from pathlib import Path
+from typing import Any, TypeVar
+
+from click.testing import CliRunner, Result
+
+from autosg.__main__ import cli
+
+# Keep every test in-process, whatever daemon the developer has running.
+os.environ["AUTOSG_NO_DAEMON"] = "1"
+
+_T = TypeVar("_T")
+
+
+def has_grammar(language: str) -> bool:
+    """Whether tree-sitter can parse *language* here."""
+    try:
+        from tree_sitter_languages import get_parser
+
+        get_parser(language)
+    except Exception:
+        return False
+    return True
+
+
+def needs_grammar(language: str) -> Callable[[_T], _T]:
+    return unittest.skipUnless(has_grammar(language), f"no tree-sitter grammar for {language}")
+
+
+class WorkdirTestCase(unittest.TestCase):
+    """Runs each test in a fresh directory, which holds its files and cache."""
+
+    def setUp(self) -> None:
+        scratch: tempfile.TemporaryDirectory[str] = tempfile.TemporaryDirectory()
+        self.addCleanup(scratch.cleanup)
+        previous: str = os.getcwd()
+        os.chdir(scratch.name)
+        self.addCleanup(os.chdir, previous)
+        self.dir: Path = Path(scratch.name)
+
+    def write(self, name: str, text: str) -> Path:
+        path: Path = self.dir / name
+        path.parent.mkdir(parents=True, exist_ok=True)
+        path.write_text(text, encoding="utf-8")
+        return path
+
+    def run_cli(self, *args: str) -> Result:
+        """Run ``python -m autosg ARGS`` here."""
+        return CliRunner().invoke(cli, list(args), catch_exceptions=False)
+
+    def analyze(self, *args: str) -> dict[str, Any]:
+        """The JSON output of ``analyze ARGS``, which must succeed."""
+        result: Result = self.run_cli("analyze", *args)
+        self.assertEqual(result.exit_code, 0, result.output)
+        return json.loads(result.stdout)
@@ -0,0 +1,47 @@
+"""Results read back from the extraction cache match freshly extracted ones."""
+
+from __future__ import annotations
+
+from typing import Any
+
+from tests.support import WorkdirTestCase, needs_grammar
+
+
+class CachedRunTest(WorkdirTestCase):
+    def twice(self, *args: str) -> tuple[dict[str, Any], dict[str, Any]]:
+        """Analyze twice against one cache: extracting, then reading it back."""
+        first: dict[str, Any] = self.analyze(*args)
+        self.assertTrue((self.dir / ".autosg" / "cache").is_dir())
+        return first, self.analyze(*args)
+
+    @needs_grammar("go")
+    def test_go_build_constraint(self) -> None:
+        self.write("sys_linux.go", "//go:build linux\n\npackage sys\n\nfunc Name() {}\n")
+        first, second = self.twice("sys_linux.go")
+        self.assertEqual(first["entities"][0]["attrs"], {"build": "linux"})
+        self.assertEqual(second, first)
+
+    @needs_grammar("python")
+    def test_python_module_follows_the_path(self) -> None:
+        source: str = "def f():\n    return 1\n"
+        self.write("pkg/__init__.py", "")
+        self.write("pkg/mod.py", source)
+        self.write("mod.py", source)
+        first, second = self.twice("-r", ".")
+        self.assertEqual(second, first)
+        modules: dict[str, Any] = {
+            e["path"]: e["attrs"].get("module") for e in second["entities"] if e["kind"] == "file"
+        }
+        self.assertEqual(modules["pkg/mod.py"], "pkg.mod")
+        self.assertEqual(modules["mod.py"], "mod")
+
+    @needs_grammar("yaml")
+    @needs_grammar("bash")
+    def test_workflow_shell_follows_the_path(self) -> None:
+        source: str = "jobs:\n  build:\n    steps:\n      - name: test\n        run: make test\n"
+        self.write("elsewhere/ci.yml", source)
+        self.write(".github/workflows/ci.yml", source)
+        first, second = self.twice("-r", ".")
+        self.assertEqual(second, first)
+        scripts: list[str] = [e["path"] for e in second["entities"] if e["kind"] == "script"]
+        self.assertEqual(scripts, [".github/workflows/ci.yml"])
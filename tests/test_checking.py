@@ -0,0 +1,36 @@
+"""``check`` against architecture rules, with and without a baseline."""
+
+from __future__ import annotations
+
+from click.testing import Result
+
+from tests.support import WorkdirTestCase
+
+
+class BaselineTest(WorkdirTestCase):
+    def setUp(self) -> None:
+        super().setUp()
+        self.write(
+            "autosg.yaml", "rules:\n  - name: api-skips-db\n    forbid: {from: api, to: db}\n",
+        )
+        self.write("src/db/row.proto", 'syntax = "proto3";\npackage db;\nmessage Row {}\n')
+        self.write(
+            "src/api/get.proto",
+            'syntax = "proto3";\npackage api;\nimport "db/row.proto";\nmessage Get {}\n',
+        )
+
+    def test_missing_baseline_is_a_usage_error(self) -> None:
+        result: Result = self.run_cli("check", "-r", "--baseline", "baseline.json", "src")
+        self.assertEqual(result.exit_code, 2, result.output)
+        self.assertIn("no baseline at baseline.json", result.output)
+        self.assertFalse((self.dir / "baseline.json").exists())
+
+    def test_recorded_violations_are_known(self) -> None:
+        self.assertEqual(self.run_cli("check", "-r", "src").exit_code, 1)
+        recorded: Result = self.run_cli(
+            "check", "-r", "--baseline", "baseline.json", "--update-baseline", "src",
+        )
+        self.assertEqual(recorded.exit_code, 0, recorded.output)
+        known: Result = self.run_cli("check", "-r", "--baseline", "baseline.json", "src")
+        self.assertEqual(known.exit_code, 0, known.output)
+        self.assertIn("1 known violation(s)", known.output)
@@ -0,0 +1,30 @@
+"""What extraction records about files, fresh and from the cache."""
+
+from __future__ import annotations
+
+from typing import Any
+
+from tests.support import WorkdirTestCase, needs_grammar
+
+_SCRIPT: str = """#!/bin/sh
+set -e
+deploy() {
+    kubectl apply -f "$1"
+}
+git pull
+deploy k8s/app.yaml
+echo done
+jq . status.json
+"""
+
+
+class BashCommandsTest(WorkdirTestCase):
+    @needs_grammar("bash")
+    def test_commands(self) -> None:
+        self.write("deploy.sh", _SCRIPT)
+        first: dict[str, Any] = self.analyze("deploy.sh")
+        # In order of first use, without builtins or the script's own functions.
+        self.assertEqual(first["entities"][0]["attrs"]["commands"], ["kubectl", "git", "jq"])
+        cached: dict[str, Any] = self.analyze("deploy.sh")
+        self.assertEqual(cached["entities"][0]["attrs"], first["entities"][0]["attrs"])
+        self.assertEqual(cached, first)
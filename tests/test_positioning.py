@@ -0,0 +1,80 @@
+"""Columns in characters, UTF-16 code units, and UTF-8 bytes."""
+
+from __future__ import annotations
+
+import json
+import unittest
+from typing import Any
+
+from click.testing import Result
+
+from autosg.positioning import column
+from tests.support import WorkdirTestCase
+
+
+class ColumnTest(unittest.TestCase):
+    def test_ascii(self) -> None:
+        for unit in ("chars", "utf-16", "bytes"):
+            self.assertEqual(column("func f() {}", 6, unit), 6)
+
+    def test_cjk(self) -> None:
+        line: str = "名前 = x"  # x is the 6th character
+        self.assertEqual(column(line, 6, "chars"), 6)
+        self.assertEqual(column(line, 6, "utf-16"), 6)  # in the BMP: one unit each
+        self.assertEqual(column(line, 6, "bytes"), 10)  # three bytes each
+
+    def test_emoji(self) -> None:
+        line: str = "s = '😀' + x"  # x is the 11th character
+        self.assertEqual(column(line, 11, "chars"), 11)
+        self.assertEqual(column(line, 11, "utf-16"), 12)  # a surrogate pair
+        self.assertEqual(column(line, 11, "bytes"), 14)
+
+    def test_combining_marks(self) -> None:
+        line: str = "cafe\u0301 = x"  # e and a combining acute; x is the 9th character
+        self.assertEqual(column(line, 9, "chars"), 9)
+        self.assertEqual(column(line, 9, "utf-16"), 9)
+        self.assertEqual(column(line, 9, "bytes"), 10)
+
+    def test_end_of_line(self) -> None:
+        line: str = "x = '日本😀'"
+        self.assertEqual(column(line, len(line) + 1, "utf-16"), 11)  # nine characters, ten units
+        self.assertEqual(column(line, len(line) + 1, "bytes"), len(line.encode()) + 1)
+
+
+_PROTO: str = 'syntax = "proto3";\npackage demo;\n/* 日本😀 */ message Foo { string id = 1; }\n'
+
+
+class ColumnsOptionTest(WorkdirTestCase):
+    def setUp(self) -> None:
+        super().setUp()
+        self.write("demo.proto", _PROTO)
+
+    def message(self, unit: str) -> dict[str, Any]:
+        output: dict[str, Any] = self.analyze("--no-cache", "--columns", unit, "demo.proto")
+        return next(e for e in output["entities"] if e["name"] == "Foo")
+
+    def test_units(self) -> None:
+        # "message" follows ten characters: a CJK pair and an emoji among them.
+        spans: dict[str, tuple[int, int]] = {}
+        for unit in ("chars", "utf-16", "bytes"):
+            foo: dict[str, Any] = self.message(unit)
+            spans[unit] = (foo["col"], foo["end_col"])
+        self.assertEqual(spans["chars"], (11, 41))
+        self.assertEqual(spans["utf-16"], (12, 42))
+        self.assertEqual(spans["bytes"], (18, 48))
+
+    def test_utf16_matches_lsif_ranges(self) -> None:
+        line: str = _PROTO.splitlines()[2]
+        foo: dict[str, Any] = self.message("utf-16")
+        result: Result = self.run_cli("analyze", "--no-cache", "-f", "lsif", "demo.proto")
+        self.assertEqual(result.exit_code, 0, result.output)
+        ranges: list[dict[str, Any]] = [
+            v for v in map(json.loads, result.stdout.splitlines())
+            if v.get("label") == "range" and v["start"]["line"] == 2
+        ]
+        self.assertEqual(len(ranges), 1)
+        # LSIF ranges are 0-indexed UTF-16 positions of the name.
+        name: int = line.index("Foo") + 1
+        self.assertEqual(ranges[0]["start"]["character"], column(line, name, "utf-16") - 1)
+        self.assertEqual(ranges[0]["end"]["character"], column(line, name + 3, "utf-16") - 1)
+        self.assertEqual(foo["col"], column(line, line.index("message") + 1, "utf-16"))
@@ -0,0 +1,108 @@
+"""HTTP sinks deliver to the URL they were given, and nowhere else."""
+
+from __future__ import annotations
+
+import os
+import sys
+import threading
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from pathlib import Path
+from unittest import mock
+
+from click.testing import Result
+
+from autosg import sinks
+from tests.support import WorkdirTestCase
+
+
+class _Server:
+    """A local HTTP server answering every POST with *status*, and recording the paths."""
+
+    def __init__(self, status: int, location: str | None = None) -> None:
+        self.paths: list[str] = []
+        recorded: list[str] = self.paths
+
+        class Handler(BaseHTTPRequestHandler):
+            def do_POST(self) -> None:
+                recorded.append(self.path)
+                self.rfile.read(int(self.headers.get("Content-Length", 0)))
+                self.send_response(status)
+                if location is not None:
+                    self.send_header("Location", location)
+                self.send_header("Content-Length", "0")
+                self.end_headers()
+
+            def log_message(self, format: str, *args: object) -> None:
+                pass
+
+        self.httpd: ThreadingHTTPServer = ThreadingHTTPServer(("127.0.0.1", 0), Handler)
+        self.url: str = f"http://127.0.0.1:{self.httpd.server_address[1]}"
+        threading.Thread(target=self.httpd.serve_forever, daemon=True).start()
+
+    def close(self) -> None:
+        self.httpd.shutdown()
+        self.httpd.server_close()
+
+
+class HttpSinkTest(WorkdirTestCase):
+    def setUp(self) -> None:
+        super().setUp()
+        self.enterContext(mock.patch.dict(os.environ))
+        os.environ.pop("AUTOSG_SINK_TOKEN", None)  # only sent over https
+
+    def serve(self, status: int, location: str | None = None) -> _Server:
+        server: _Server = _Server(status, location)
+        self.addCleanup(server.close)
+        return server
+
+    def upload(self, url: str) -> None:
+        path: Path = self.write("output.json", "{}\n")
+        sinks.HttpSink(url).upload(url, path, "application/json")
+
+    def test_upload(self) -> None:
+        server: _Server = self.serve(200)
+        self.upload(f"{server.url}/results")
+        self.assertEqual(server.paths, ["/results"])
+
+    def test_redirects_are_refused(self) -> None:
+        elsewhere: _Server = self.serve(200)
+        for status in (301, 302, 303, 307, 308):
+            with self.subTest(status=status):
+                server: _Server = self.serve(status, f"{elsewhere.url}/stolen")
+                with self.assertRaisesRegex(sinks.SinkError, "do not follow redirects"):
+                    self.upload(f"{server.url}/results")
+                self.assertEqual(server.paths, ["/results"])
+        self.assertEqual(elsewhere.paths, [])
+
+
+class AdapterTest(WorkdirTestCase):
+    def setUp(self) -> None:
+        super().setUp()
+        self.write("autosg.yaml", "sinks:\n  lake: lake_sink:LakeSink\n")
+        self.write(
+            "lake_sink.py",
+            "import pathlib\n"
+            "from autosg.sinks import FileSink\n"
+            "pathlib.Path('imported').touch()\n"
+            "class LakeSink(FileSink):\n"
+            "    def __init__(self, url):\n"
+            "        super().__init__('file:' + url.partition('://')[2])\n",
+        )
+        self.write("src/row.proto", 'syntax = "proto3";\nmessage Row {}\n')
+        self.addCleanup(sys.modules.pop, "lake_sink", None)
+
+    def test_imported_only_for_its_sink(self) -> None:
+        self.analyze("src/row.proto")
+        self.assertFalse((self.dir / "imported").exists())
+        result: Result = self.run_cli("analyze", "--sink", "lake://out.json", "src/row.proto")
+        self.assertEqual(result.exit_code, 0, result.output)
+        self.assertTrue((self.dir / "imported").exists())
+        self.assertTrue((self.dir / "out.json").is_file())
+        self.assertNotIn(str(self.dir), sys.path)
+
+    def test_import_errors_name_the_config(self) -> None:
+        self.write("autosg.yaml", "sinks:\n  lake: missing_sink:LakeSink\n")
+        self.analyze("src/row.proto")
+        result: Result = self.run_cli("analyze", "--sink", "lake://out.json", "src/row.proto")
+        self.assertEqual(result.exit_code, 2, result.output)
+        self.assertIn("sinks.lake: cannot import missing_sink:LakeSink", result.output)